@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/oleksiyp/helmfire/pkg/drift"
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/reportformat"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+	"go.uber.org/zap"
+)
+
+// globalCI switches to output for CI logs: plain text, a group of log lines
+// per release, pipeline exit codes and, on GitHub Actions, a job summary and
+// step outputs
+var globalCI bool
+
+// Exit codes of --ci runs, besides 1 for any other error
+const (
+	exitInvalidConfig = 3
+	exitHelmFailed    = 4
+	exitDrift         = 10
+)
+
+// exitError is an error helmfire exits with a code other than 1 for
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// ciExit makes err exit with code in CI mode
+func ciExit(code int, err error) error {
+	if !globalCI || err == nil {
+		return err
+	}
+	return &exitError{code: code, err: err}
+}
+
+// exitCode is the code helmfire exits with for err
+func exitCode(err error) int {
+	var exit *exitError
+	if errors.As(err, &exit) {
+		return exit.code
+	}
+	return 1
+}
+
+// githubActions reports whether helmfire runs in a GitHub Actions job,
+// whose workflow commands group and annotate the log
+func githubActions() bool {
+	return os.Getenv("GITHUB_ACTIONS") == "true"
+}
+
+// plainSymbols spell out the emoji and symbols of console output, which CI
+// logs may not render
+var plainSymbols = strings.NewReplacer(
+	"⚠️  ", "WARNING: ",
+	"✓ ", "OK ",
+	"✗ ", "FAILED ",
+	"⏱ ", "TIMEOUT ",
+	"⏳ ", "WAITING ",
+	"✅ ", "OK ",
+	"❌ ", "FAILED ",
+	"👀 ", "",
+	"↻ ", "",
+	"⚙ ", "",
+	"⇄ ", "",
+	"· ", "- ",
+	"→", "->",
+)
+
+// plainText spells out the symbols of console output in CI mode
+func plainText(text string) string {
+	if !globalCI {
+		return text
+	}
+	return plainSymbols.Replace(text)
+}
+
+// printf prints console output like fmt.Printf, plain in CI mode
+func printf(format string, a ...interface{}) {
+	fmt.Print(plainText(fmt.Sprintf(format, a...)))
+}
+
+// printLine prints console output like fmt.Println, plain in CI mode
+func printLine(a ...interface{}) {
+	fmt.Print(plainText(fmt.Sprintln(a...)))
+}
+
+// ciGroups folds the output of each release's sync into a group of the CI
+// log, and annotates the releases that failed
+type ciGroups struct{}
+
+func (ciGroups) NotifySync(event drift.SyncEvent) error {
+	if event.ReleaseName == "" {
+		return nil
+	}
+	if event.Phase == drift.SyncStarted {
+		startLogGroup("Sync " + event.Subject())
+		return nil
+	}
+	endLogGroup()
+	if event.Phase == drift.SyncFailed {
+		annotateError(event.Subject()+" failed", event.Error)
+	}
+	return nil
+}
+
+// startLogGroup starts a collapsible group of log lines on GitHub Actions,
+// or a headline elsewhere
+func startLogGroup(title string) {
+	if githubActions() {
+		fmt.Printf("::group::%s\n", workflowEscape(title))
+		return
+	}
+	printf("--- %s\n", title)
+}
+
+// endLogGroup ends the group startLogGroup started
+func endLogGroup() {
+	if githubActions() {
+		fmt.Println("::endgroup::")
+	}
+}
+
+// annotateError shows an error in the summary of a GitHub Actions run
+func annotateError(title, message string) {
+	if githubActions() {
+		fmt.Printf("::error title=%s::%s\n", workflowProperty(title), workflowEscape(strings.TrimSpace(message)))
+	}
+}
+
+// workflowEscape escapes the message of a workflow command, which ends at
+// the first newline
+func workflowEscape(text string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(text)
+}
+
+// workflowProperty escapes a property of a workflow command, which also
+// ends at a colon or comma
+func workflowProperty(text string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(text)
+}
+
+// writeCIResults adds results to the GitHub Actions job summary and sets
+// outputs later steps can read, as steps.<id>.outputs.<name>
+func writeCIResults(results reportformat.Results, outputs map[string]string) error {
+	if path := os.Getenv("GITHUB_STEP_SUMMARY"); path != "" {
+		if err := appendFile(path, func(w io.Writer) error {
+			return reportformat.Write(w, reportformat.Markdown, results)
+		}); err != nil {
+			return fmt.Errorf("failed to write the job summary: %w", err)
+		}
+	}
+	if path := os.Getenv("GITHUB_OUTPUT"); path != "" {
+		if err := appendFile(path, func(w io.Writer) error {
+			names := make([]string, 0, len(outputs))
+			for name := range outputs {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				if _, err := fmt.Fprintf(w, "%s=%s\n", name, outputs[name]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to write step outputs: %w", err)
+		}
+	}
+	return nil
+}
+
+// syncOutputs are the step outputs of a sync: its ID, and the names of the
+// releases whose manifests it changed, installed ones included, and of
+// those that failed. Releases upgraded to the same manifests aren't changed.
+func syncOutputs(report *sync.Report, dryRun bool, executor *sync.Executor) map[string]string {
+	var changed, failed []string
+	for _, result := range report.Results {
+		switch {
+		case result.Status == sync.ReleaseStatusFailed || result.Status == sync.ReleaseStatusTimedOut:
+			failed = append(failed, result.Name)
+		case result.Status == sync.ReleaseStatusSucceeded && !dryRun && result.Helm != nil && result.Helm.Revision > 0:
+			release := helmstate.Release{Name: result.Name, Namespace: result.Namespace}
+			ok, err := executor.RevisionChanged(context.Background(), release, result.Helm.Revision)
+			if err != nil {
+				// Better a downstream step run once too often than skipped
+				globalLogger.Warn("failed to compare revisions, counting the release as changed",
+					zap.String("release", result.Name), zap.Error(err))
+				ok = true
+			}
+			if ok {
+				changed = append(changed, result.Name)
+			}
+		}
+	}
+	return map[string]string{
+		"sync-id":          report.SyncID,
+		"changed-releases": strings.Join(changed, ","),
+		"failed-releases":  strings.Join(failed, ","),
+	}
+}
+
+// appendFile appends what write writes to the file at path
+func appendFile(path string, write func(w io.Writer) error) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/config"
+	"github.com/oleksiyp/helmfire/pkg/dev"
+	"github.com/oleksiyp/helmfire/pkg/filesync"
+	"github.com/oleksiyp/helmfire/pkg/helmfire"
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/preflight"
+	"github.com/oleksiyp/helmfire/pkg/rendercache"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+	"github.com/oleksiyp/helmfire/pkg/watcher"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func newDevCmd() *cobra.Command {
+	var (
+		files         []string
+		environment   string
+		namespace     string
+		kubeContext   string
+		helmBinary    string
+		load          string
+		cluster       string
+		dockerBinary  string
+		watchInterval time.Duration
+		noLogs        bool
+		noPortForward bool
+		strict        bool
+		namespaces    namespaceFlags
+		resources     string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "dev [release...]",
+		Short: "Build, sync, forward ports and stream logs of releases while editing them",
+		Long: `Run a development session in the foreground: build the images declared under
+dev.build of each release and load them into the cluster, substitute them for
+the release's images and sync it, forward the ports under dev.portForward and
+stream the release's logs. Edits then keep the cluster up to date until
+interrupted: file syncs copy changed files into running pods, changes to a
+build context rebuild its image, and values, chart or helmfile changes sync
+the releases using them.
+
+Images reach the cluster as --load says, by default as the kube context
+suggests: kind load for kind-* contexts, k3d image import for k3d-*, minikube
+image load for minikube, and nothing otherwise. The image substitutions only
+live as long as the session.
+
+Examples:
+  # Develop every release of helmfile.yaml
+  helmfire dev
+
+  # Develop only the api and web releases
+  helmfire dev api web
+
+  # Push built images to their registry instead of loading them
+  helmfire dev --load push`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(globalConfigPath)
+			if err != nil {
+				return err
+			}
+			if err := addSubstitutionProviders(cfg); err != nil {
+				return err
+			}
+			profile, err := resourcesProfile(resources)
+			if err != nil {
+				return err
+			}
+			if load != "" {
+				if _, err := dev.ParseLoad(load); err != nil {
+					return err
+				}
+			}
+
+			helm, err := runPreflight(helmBinary, false)
+			if err != nil {
+				return err
+			}
+
+			project, err := helmfire.LoadProject(context.Background(), helmfire.ProjectOptions{
+				Files:             files,
+				Environment:       environment,
+				HelmBinary:        helm.HelmBinary,
+				Namespace:         namespace,
+				KubeContext:       kubeContext,
+				Strict:            strict,
+				Substitutor:       globalSubstitutor,
+				RenderCache:       rendercache.New(rendercache.DefaultSize),
+				OfflineCharts:     offlineCharts(),
+				NamespaceTemplate: namespaceTemplate(),
+				ReleasePrefix:     globalReleasePrefix,
+				StateDir:          projectStateDir(),
+				Logger:            globalLogger,
+			})
+			if err != nil {
+				return err
+			}
+			manager := project.Manager()
+			releases, err := devReleases(manager, args)
+			if err != nil {
+				return err
+			}
+
+			if load == "" {
+				current := kubeContext
+				if current == "" {
+					current = currentKubeContext()
+				}
+				var detected string
+				load, detected = dev.DetectLoad(current)
+				if cluster == "" {
+					cluster = detected
+				}
+			}
+
+			// The board owns the terminal, so only warnings are logged
+			logger := globalLogger.WithOptions(zap.IncreaseLevel(zapcore.WarnLevel))
+
+			names := make([]string, len(releases))
+			selected := make(map[string]bool, len(releases))
+			for i, release := range releases {
+				names[i] = release.Name
+				selected[release.Name] = true
+			}
+			board := dev.NewBoard(os.Stdout, isTerminal(os.Stdout), names)
+
+			builder := dev.NewBuilder(load, cluster, logger)
+			builder.Docker = dockerBinary
+
+			executor := project.Executor(helmfire.ExecutorOptions{
+				Resources:        profile,
+				CreateNamespace:  &namespaces.create,
+				VerifyNamespaces: namespaces.verify,
+				Progress: func(p sync.Progress) {
+					if !p.Ready {
+						board.Set(p.Release, dev.StateSyncing, p.Resource+": "+p.Message)
+					}
+				},
+				Logger: logger,
+			})
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			if repos := manager.RepositoriesFor(releases); len(repos) > 0 {
+				if err := executor.SyncRepositoriesContext(ctx, repos); err != nil {
+					return fmt.Errorf("failed to sync repositories: %w", err)
+				}
+			}
+
+			session := project.NewWatchSession(helmfire.WatchOptions{
+				Executor:    executor,
+				KubeContext: kubeContext,
+				Interval:    watchInterval,
+				Releases:    names,
+				Build: func(ctx context.Context, release helmstate.Release) error {
+					return buildDevImages(ctx, builder, release)
+				},
+				Reporter: boardReporter{board},
+				Logger:   logger,
+			})
+
+			for _, release := range releases {
+				if release.Dev != nil && len(release.Dev.Build) > 0 {
+					session.Rebuild(ctx, release)
+				} else {
+					session.SyncRelease(ctx, release)
+				}
+				if ctx.Err() != nil {
+					return nil
+				}
+			}
+
+			for _, release := range releases {
+				ns := executor.ReleaseNamespace(release)
+				if !noPortForward {
+					startPortForwards(ctx, board, release, ns, kubeContext)
+				}
+				if !noLogs && (release.Dev == nil || release.Dev.Logs == nil || *release.Dev.Logs) {
+					startLogStream(ctx, board, release, ns, kubeContext)
+				}
+			}
+
+			return session.Run(ctx)
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(&files, "file", "f", []string{"helmfile.yaml"}, helmfileFlagUsage)
+	cmd.Flags().StringVarP(&environment, "environment", "e", "", "Environment name")
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Namespace of every release, over the helmfile's")
+	cmd.Flags().StringVar(&kubeContext, "kube-context", "", "Kubernetes context of every release, over the helmfile's")
+	cmd.Flags().StringVar(&helmBinary, "helm-binary", "", "Path to helm binary (default: $"+preflight.EnvHelmBinary+" or helm on PATH)")
+	cmd.Flags().StringVar(&load, "load", "", "How built images reach the cluster: kind, minikube, k3d, push or none (default: detected from the kube context)")
+	cmd.Flags().StringVar(&cluster, "cluster", "", "kind or k3d cluster, or minikube profile, images are loaded into (default: detected from the kube context)")
+	cmd.Flags().StringVar(&dockerBinary, "docker-binary", "docker", "Path to the docker binary that builds images")
+	cmd.Flags().DurationVar(&watchInterval, "watch-interval", watcher.DefaultInterval, "How often watched files are checked for changes")
+	cmd.Flags().BoolVar(&noLogs, "no-logs", false, "Don't stream the logs of releases")
+	cmd.Flags().BoolVar(&noPortForward, "no-port-forward", false, "Don't forward the ports of releases")
+	cmd.Flags().BoolVar(&strict, "strict", false, "Reject the helmfile when it has unknown fields or mistyped values, and templates using missing keys (see helmfire lint)")
+	namespaces.register(cmd)
+	cmd.Flags().StringVar(&resources, "resources-profile", "", resourcesProfileUsage)
+
+	return cmd
+}
+
+// devReleases returns the installed releases named by args, or all of them
+func devReleases(manager *helmstate.Manager, args []string) ([]helmstate.Release, error) {
+	byName := make(map[string]helmstate.Release)
+	var releases []helmstate.Release
+	for _, release := range manager.GetReleases() {
+		if manager.IsReleaseInstalled(release) {
+			byName[release.Name] = release
+			releases = append(releases, release)
+		}
+	}
+	if len(args) == 0 {
+		if len(releases) == 0 {
+			return nil, fmt.Errorf("no installed releases in %s", manager.FilePath)
+		}
+		return releases, nil
+	}
+
+	releases = releases[:0]
+	for _, name := range args {
+		release, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("no installed release %q in %s", name, manager.FilePath)
+		}
+		releases = append(releases, release)
+	}
+	return releases, nil
+}
+
+// buildDevImages builds the dev images of a release and substitutes them
+// for its images
+func buildDevImages(ctx context.Context, builder *dev.Builder, release helmstate.Release) error {
+	for _, build := range release.Dev.Build {
+		tag := dev.DevTag(build.Image, time.Now())
+		if err := builder.Build(ctx, build, tag); err != nil {
+			return fmt.Errorf("%s: %w", build.Image, err)
+		}
+		if err := globalSubstitutor.AddScopedImageSubstitution(build.Image, tag, substitute.Scope{Release: release.Name}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startPortForwards keeps the port-forwards of a release running
+func startPortForwards(ctx context.Context, board *dev.Board, release helmstate.Release, namespace, kubeContext string) {
+	if release.Dev == nil {
+		return
+	}
+	var forwards []string
+	for _, forward := range release.Dev.PortForward {
+		resource := forward.Resource
+		if resource == "" {
+			resource = "svc/" + release.Name
+		}
+		for _, port := range forward.Ports {
+			local, _, _ := strings.Cut(port, ":")
+			forwards = append(forwards, "localhost:"+local)
+		}
+
+		args := dev.PortForwardArgs(namespace, resource, forward.Ports, kubeContext)
+		process := &dev.Process{
+			Binary: "kubectl",
+			Args:   func() []string { return args },
+			OnLine: func(line string) {
+				if !strings.HasPrefix(line, "Handling connection") {
+					board.Log(release.Name, line)
+				}
+			},
+			OnExit: func(err error) {
+				board.Log(release.Name, fmt.Sprintf("port-forward to %s stopped (%v), restarting", resource, err))
+			},
+		}
+		go process.Run(ctx)
+	}
+	board.SetForwards(release.Name, forwards)
+}
+
+// startLogStream keeps streaming the logs of the pods of a release
+func startLogStream(ctx context.Context, board *dev.Board, release helmstate.Release, namespace, kubeContext string) {
+	selector := filesync.InstanceLabel + "=" + release.Name
+	if release.Dev != nil && release.Dev.Selector != "" {
+		selector = release.Dev.Selector
+	}
+
+	// A restarted stream resumes where the last one stopped
+	var stopped time.Time
+	process := &dev.Process{
+		Binary: "kubectl",
+		Args: func() []string {
+			var since time.Duration
+			if !stopped.IsZero() {
+				since = time.Since(stopped)
+			}
+			return dev.LogArgs(namespace, selector, since, kubeContext)
+		},
+		OnLine: func(line string) {
+			board.Log(release.Name, line)
+		},
+		OnExit: func(error) {
+			stopped = time.Now()
+		},
+	}
+	go process.Run(ctx)
+}
+
+// currentKubeContext returns kubectl's current context, if any
+func currentKubeContext() string {
+	out, err := exec.Command("kubectl", "config", "current-context").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// isTerminal reports whether f is a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// boardReporter shows what the watch session of helmfire dev does on its
+// board
+type boardReporter struct {
+	board *dev.Board
+}
+
+func (r boardReporter) Started(paths int) {
+	r.board.Log("dev", fmt.Sprintf("watching %d path(s) for changes, press Ctrl+C to stop", paths))
+}
+
+func (r boardReporter) Changed(what string) {
+	r.board.Log("dev", plainText("↻ "+what+" changed"))
+}
+
+func (r boardReporter) Building(release string) {
+	r.board.Set(release, dev.StateBuilding, "")
+}
+
+func (r boardReporter) Syncing(release string) {
+	r.board.Set(release, dev.StateSyncing, "")
+}
+
+func (r boardReporter) Synced(release string, took time.Duration, err error) {
+	if err != nil {
+		r.board.Set(release, dev.StateFailed, err.Error())
+		return
+	}
+	r.board.Set(release, dev.StateReady, "synced in "+took.Round(time.Millisecond).String())
+}
+
+func (r boardReporter) FilesSynced(change filesync.Change, pods []string, err error) {
+	if err != nil {
+		r.board.Log(change.Release, plainText("✗ file sync failed: "+err.Error()))
+		return
+	}
+	files := len(change.Updated) + len(change.Removed)
+	r.board.Log(change.Release, plainText(fmt.Sprintf("⇄ synced %d file(s) to %s in %s", files, change.Sync.Dest, strings.Join(pods, ", "))))
+}
+
+func (r boardReporter) Failed(err error) {
+	r.board.Log("dev", plainText("✗ "+err.Error()))
+}
+
+func (r boardReporter) Stopped() {
+	r.board.Log("dev", "stopped")
+}
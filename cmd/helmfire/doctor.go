@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/oleksiyp/helmfire/pkg/daemon"
+	"github.com/oleksiyp/helmfire/pkg/doctor"
+	"github.com/oleksiyp/helmfire/pkg/helmfire"
+	"github.com/spf13/cobra"
+)
+
+func newDoctorCmd() *cobra.Command {
+	var (
+		files         []string
+		environment   string
+		kubeContext   string
+		helmBinary    string
+		output        string
+		daemonAPIAddr string
+		daemonPIDFile string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnose the environment helmfire runs in",
+		Long: `Check everything helmfire depends on and print a pass/fail report with
+suggested fixes:
+
+- helm version and the helm-diff plugin
+- kubectl and connectivity to the cluster
+- permission to manage helm releases in each target namespace
+- the helmfile and the chart repositories it uses
+- the health of the project's daemon, if it is running
+
+Examples:
+  # Check the helmfile in the current directory
+  helmfire doctor
+
+  # Check another helmfile against a specific cluster
+  helmfire doctor -f deploy/helmfile.yaml --kube-context staging`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			helmfiles, err := helmfire.ResolveHelmfiles(context.Background(), files, globalLogger)
+			if err != nil {
+				return err
+			}
+
+			report := doctor.Run(doctor.Options{
+				HelmBinary:    helmBinary,
+				KubeContext:   kubeContext,
+				HelmfilePath:  helmfiles[0],
+				ExtraPaths:    helmfiles[1:],
+				Environment:   environment,
+				DaemonAPIAddr: daemonAPIAddr,
+				DaemonPIDFile: daemonPIDFile,
+			})
+
+			if output == "json" {
+				if err := printJSON(report); err != nil {
+					return err
+				}
+			} else {
+				printDoctorReport(report)
+			}
+
+			if report.Failed() {
+				// The report already says what is wrong; usage would bury it
+				cmd.SilenceUsage = true
+				return fmt.Errorf("doctor found problems")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(&files, "file", "f", []string{"helmfile.yaml"}, helmfileFlagUsage)
+	cmd.Flags().StringVarP(&environment, "environment", "e", "", "Environment name")
+	cmd.Flags().StringVar(&kubeContext, "kube-context", "", "Kubernetes context")
+	cmd.Flags().StringVar(&helmBinary, "helm-binary", "", "Path to helm binary")
+	cmd.Flags().StringVarP(&output, "output", "o", "text", "Output format (text, json)")
+	cmd.Flags().StringVar(&daemonAPIAddr, "daemon-api-addr", daemon.DefaultAPIAddr, "Daemon API address")
+	cmd.Flags().StringVar(&daemonPIDFile, "daemon-pid-file", defaultPaths.PIDFile, "Daemon PID file")
+
+	return cmd
+}
+
+// printDoctorReport prints one line per check, with the fix for failures and
+// warnings below it
+func printDoctorReport(report *doctor.Report) {
+	symbols := map[doctor.Status]string{
+		doctor.StatusPass: "✓",
+		doctor.StatusWarn: "⚠️ ",
+		doctor.StatusFail: "✗",
+		doctor.StatusSkip: "-",
+	}
+
+	width := 0
+	for _, check := range report.Checks {
+		width = max(width, len(check.Name))
+	}
+
+	failed, warned := 0, 0
+	for _, check := range report.Checks {
+		detail := check.Detail
+		if check.Status == doctor.StatusSkip {
+			detail = "skipped: " + detail
+		}
+		printf("  %s %-*s  %s\n", symbols[check.Status], width, check.Name, detail)
+		if check.Fix != "" {
+			printf("    %-*s  → %s\n", width, "", check.Fix)
+		}
+
+		switch check.Status {
+		case doctor.StatusFail:
+			failed++
+		case doctor.StatusWarn:
+			warned++
+		}
+	}
+
+	printf("\n%d check(s): %d failed, %d warning(s)\n", len(report.Checks), failed, warned)
+}
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/daemon"
+	"github.com/oleksiyp/helmfire/pkg/drift"
+	"github.com/oleksiyp/helmfire/pkg/helmfire"
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/reportformat"
+	"github.com/spf13/cobra"
+)
+
+func newDriftCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "drift",
+		Short: "Inspect and manage drift",
+	}
+
+	cmd.AddCommand(newDriftCheckCmd())
+	cmd.AddCommand(newDriftListCmd())
+	cmd.AddCommand(newDriftApproveCmd())
+	cmd.AddCommand(newDriftHealCmd())
+	cmd.AddCommand(newDriftConfigCmd())
+
+	return cmd
+}
+
+func newDriftCheckCmd() *cobra.Command {
+	var (
+		files         []string
+		environment   string
+		namespace     string
+		kubeContext   string
+		helmBinary    string
+		output        string
+		reportFile    reportFileFlags
+		daemonAPIAddr string
+		daemonPIDFile string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "check [release]",
+		Short: "Run an immediate drift check",
+		Long: `Compare the cluster against the helmfile now, outside the periodic
+drift detection loop, and print the resulting reports.
+
+If a daemon is running, the check runs in the daemon (including its
+notifiers and auto-heal settings).
+
+Examples:
+  # Check all releases
+  helmfire drift check
+
+  # Check a single release and print JSON
+  helmfire drift check nginx --output json
+
+  # Record drift as JUnit test results in CI
+  helmfire drift check --report-file drift.xml`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			release := ""
+			if len(args) > 0 {
+				release = args[0]
+			}
+			if _, _, _, err := reportFile.exporter(); err != nil {
+				return err
+			}
+
+			var reports []drift.DriftReport
+			if running, _ := daemon.IsDaemonRunning(daemonPIDFile); running {
+				client := daemon.NewAPIClient(daemonAPIAddr)
+				r, err := client.CheckDrift(release)
+				if err != nil {
+					return fmt.Errorf("failed to check drift via daemon: %w", err)
+				}
+				reports = r
+			} else {
+				helm, err := runPreflight(helmBinary, true)
+				if err != nil {
+					return err
+				}
+
+				project, err := helmfire.LoadProject(context.Background(), helmfire.ProjectOptions{
+					Files:             files,
+					Environment:       environment,
+					HelmBinary:        helm.HelmBinary,
+					Namespace:         namespace,
+					KubeContext:       kubeContext,
+					Substitutor:       globalSubstitutor,
+					OfflineCharts:     offlineCharts(),
+					NamespaceTemplate: namespaceTemplate(),
+					ReleasePrefix:     globalReleasePrefix,
+					Logger:            globalLogger,
+				})
+				if err != nil {
+					return err
+				}
+				r, err := project.CheckDrift(context.Background(), release)
+				if err != nil {
+					return err
+				}
+				reports = r
+			}
+
+			if err := printDriftReports(reports, output); err != nil {
+				return err
+			}
+			// Drift checks find none as an empty list, not a missing one
+			if reports == nil {
+				reports = []drift.DriftReport{}
+			}
+			results := reportformat.Results{Helmfile: files[0], Drift: reports}
+			if err := reportFile.write(results); err != nil {
+				return err
+			}
+			if !globalCI {
+				return nil
+			}
+
+			var drifted []string
+			for _, report := range reports {
+				if !report.Healed && report.DriftType != drift.DriftTypeResolved {
+					drifted = append(drifted, report.ReleaseName)
+					annotateError(fmt.Sprintf("%s/%s drifted", report.Namespace, report.ReleaseName), report.Details)
+				}
+			}
+			if err := writeCIResults(results, map[string]string{"drifted-releases": strings.Join(drifted, ",")}); err != nil {
+				return err
+			}
+			if len(drifted) > 0 {
+				return ciExit(exitDrift, fmt.Errorf("drift detected in %d release(s)", len(drifted)))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(&files, "file", "f", []string{"helmfile.yaml"}, helmfileFlagUsage)
+	cmd.Flags().StringVarP(&environment, "environment", "e", "", "Environment name")
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Namespace of every release, over the helmfile's")
+	cmd.Flags().StringVar(&kubeContext, "kube-context", "", "Kubernetes context of every release, over the helmfile's")
+	cmd.Flags().StringVar(&helmBinary, "helm-binary", "", "Path to helm binary")
+	cmd.Flags().StringVarP(&output, "output", "o", "text", "Output format (text, json)")
+	cmd.Flags().StringVar(&daemonAPIAddr, "daemon-api-addr", daemon.DefaultAPIAddr, "Daemon API address")
+	cmd.Flags().StringVar(&daemonPIDFile, "daemon-pid-file", defaultPaths.PIDFile, "Daemon PID file")
+	reportFile.register(cmd)
+
+	return cmd
+}
+
+func newDriftListCmd() *cobra.Command {
+	var (
+		output        string
+		daemonAPIAddr string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List drift reports held by the daemon",
+		Long: `List drift reports awaiting heal approval and recent reports from the
+daemon's drift detector.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client := daemon.NewAPIClient(daemonAPIAddr)
+			list, err := client.ListDrift()
+			if err != nil {
+				return fmt.Errorf("failed to list drift: %w", err)
+			}
+
+			if output == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(list)
+			}
+
+			printf("Awaiting approval (%d):\n", len(list.Pending))
+			for _, report := range list.Pending {
+				printf("  %s  %s/%s: %s drift (%s severity)\n",
+					report.ID, report.Namespace, report.ReleaseName, report.DriftType, report.Severity)
+			}
+			if len(list.Pending) > 0 {
+				printLine("\nUse 'helmfire drift approve <id>' to heal")
+			}
+
+			printf("\nRecent reports (%d):\n", len(list.Recent))
+			return printDriftReports(list.Recent, output)
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "text", "Output format (text, json)")
+	cmd.Flags().StringVar(&daemonAPIAddr, "daemon-api-addr", daemon.DefaultAPIAddr, "Daemon API address")
+
+	return cmd
+}
+
+func newDriftApproveCmd() *cobra.Command {
+	var daemonAPIAddr string
+
+	cmd := &cobra.Command{
+		Use:   "approve <id>",
+		Short: "Heal drift held for manual approval",
+		Long: `Heal a drift report that the auto-heal policy held for approval.
+
+Examples:
+  # Find pending reports, then approve one
+  helmfire drift list
+  helmfire drift approve 3f9a1c2b7d4e`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client := daemon.NewAPIClient(daemonAPIAddr)
+			report, err := client.HealDrift(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to heal drift: %w", err)
+			}
+
+			printf("✓ Healed %s/%s\n", report.Namespace, report.ReleaseName)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&daemonAPIAddr, "daemon-api-addr", daemon.DefaultAPIAddr, "Daemon API address")
+
+	return cmd
+}
+
+func newDriftHealCmd() *cobra.Command {
+	var (
+		files         []string
+		environment   string
+		namespace     string
+		kubeContext   string
+		helmBinary    string
+		dryRun        bool
+		daemonAPIAddr string
+		daemonPIDFile string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "heal <release>",
+		Short: "Re-sync a drifted release",
+		Long: `Re-sync a release from the helmfile to undo drift. With --dry-run, print
+the changes the heal would apply without applying them.
+
+Examples:
+  # Preview healing nginx
+  helmfire drift heal nginx --dry-run
+
+  # Heal nginx
+  helmfire drift heal nginx`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+
+			changes := ""
+			if running, _ := daemon.IsDaemonRunning(daemonPIDFile); running {
+				client := daemon.NewAPIClient(daemonAPIAddr)
+				resp, err := client.HealRelease(name, dryRun)
+				if err != nil {
+					return fmt.Errorf("failed to heal via daemon: %w", err)
+				}
+				changes = resp.Changes
+			} else {
+				helm, err := runPreflight(helmBinary, dryRun)
+				if err != nil {
+					return err
+				}
+
+				project, err := helmfire.LoadProject(context.Background(), helmfire.ProjectOptions{
+					Files:             files,
+					Environment:       environment,
+					HelmBinary:        helm.HelmBinary,
+					Namespace:         namespace,
+					KubeContext:       kubeContext,
+					Substitutor:       globalSubstitutor,
+					OfflineCharts:     offlineCharts(),
+					NamespaceTemplate: namespaceTemplate(),
+					ReleasePrefix:     globalReleasePrefix,
+					Logger:            globalLogger,
+				})
+				if err != nil {
+					return err
+				}
+				manager := project.Manager()
+
+				var release *helmstate.Release
+				for _, r := range manager.GetReleases() {
+					if r.Name == name {
+						release = &r
+						break
+					}
+				}
+				if release == nil {
+					return fmt.Errorf("release not found: %s", name)
+				}
+
+				executor := project.Executor(helmfire.ExecutorOptions{})
+
+				if dryRun {
+					changes, err = executor.PreviewReleaseContext(context.Background(), *release)
+				} else {
+					err = executor.SyncReleaseContext(context.Background(), *release)
+				}
+				if err != nil {
+					return fmt.Errorf("heal failed: %w", err)
+				}
+			}
+
+			if !dryRun {
+				printf("✓ Healed %s\n", name)
+				return nil
+			}
+
+			if changes == "" {
+				printf("✓ Healing %s would not change anything\n", name)
+				return nil
+			}
+			printf("Healing %s would apply:\n\n%s\n", name, changes)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(&files, "file", "f", []string{"helmfile.yaml"}, helmfileFlagUsage)
+	cmd.Flags().StringVarP(&environment, "environment", "e", "", "Environment name")
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Namespace of every release, over the helmfile's")
+	cmd.Flags().StringVar(&kubeContext, "kube-context", "", "Kubernetes context of every release, over the helmfile's")
+	cmd.Flags().StringVar(&helmBinary, "helm-binary", "", "Path to helm binary")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the changes without applying them")
+	cmd.Flags().StringVar(&daemonAPIAddr, "daemon-api-addr", daemon.DefaultAPIAddr, "Daemon API address")
+	cmd.Flags().StringVar(&daemonPIDFile, "daemon-pid-file", defaultPaths.PIDFile, "Daemon PID file")
+
+	return cmd
+}
+
+// newHealPolicy builds the auto-heal policy from command-line flags
+func newHealPolicy(maxSeverity string, manualNamespaces, windows, blackouts []string) (drift.HealPolicy, error) {
+	policy := drift.HealPolicy{ManualNamespaces: manualNamespaces}
+	if maxSeverity != "" {
+		severity, err := drift.ParseSeverity(maxSeverity)
+		if err != nil {
+			return policy, fmt.Errorf("invalid --drift-heal-max-severity: %w", err)
+		}
+		policy.MaxSeverity = severity
+	}
+	for _, spec := range windows {
+		window, err := drift.ParseHealWindow(spec)
+		if err != nil {
+			return policy, fmt.Errorf("invalid --drift-heal-window: %w", err)
+		}
+		policy.Windows = append(policy.Windows, window)
+	}
+	for _, spec := range blackouts {
+		window, err := drift.ParseHealWindow(spec)
+		if err != nil {
+			return policy, fmt.Errorf("invalid --drift-heal-blackout: %w", err)
+		}
+		policy.Blackouts = append(policy.Blackouts, window)
+	}
+	return policy, nil
+}
+
+// printDriftReports prints drift reports as text or JSON
+func printDriftReports(reports []drift.DriftReport, output string) error {
+	switch output {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(reports)
+	case "text", "":
+	default:
+		return fmt.Errorf("unsupported output format: %s", output)
+	}
+
+	if len(reports) == 0 {
+		printLine("✓ No drift detected")
+		return nil
+	}
+
+	printf("Drift detected in %d release(s):\n", len(reports))
+	for _, report := range reports {
+		status := ""
+		if report.Healed {
+			status = " [healed]"
+		}
+		printf("\n⚠️  %s/%s: %s drift (%s severity)%s\n",
+			report.Namespace, report.ReleaseName, report.DriftType, report.Severity, status)
+		printf("   %s (%s)\n", report.Details, report.Timestamp.Format(time.RFC3339))
+		if values := report.ValuesDiff.String(); values != "" {
+			printf("\nValues diff:\n%s\n", values)
+		}
+		if report.Diff != "" {
+			printf("\n%s\n", report.Diff)
+		}
+	}
+
+	return nil
+}
+
+func newDriftConfigCmd() *cobra.Command {
+	var (
+		interval      time.Duration
+		autoHeal      bool
+		enable        []string
+		disable       []string
+		daemonAPIAddr string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Show or change the daemon's drift settings",
+		Long: `Show the drift settings of the running daemon, or change its check
+interval, auto-heal and which releases are checked periodically without
+restarting it. Changes last until the daemon restarts or reloads its
+configuration. Disabled releases can still be checked by name with
+'helmfire drift check'.
+
+Examples:
+  # Check every minute while debugging
+  helmfire drift config --interval=1m
+
+  # Stop healing automatically and leave db alone during maintenance
+  helmfire drift config --auto-heal=false --disable db
+
+  # Check db again
+  helmfire drift config --enable db`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var req daemon.DriftConfigRequest
+			if cmd.Flags().Changed("interval") {
+				req.Interval = interval.String()
+			}
+			if cmd.Flags().Changed("auto-heal") {
+				req.AutoHeal = &autoHeal
+			}
+			if len(enable)+len(disable) > 0 {
+				req.Releases = make(map[string]bool)
+				for _, name := range enable {
+					req.Releases[name] = true
+				}
+				for _, name := range disable {
+					req.Releases[name] = false
+				}
+			}
+
+			client := daemon.NewAPIClient(daemonAPIAddr)
+			var config *daemon.DriftConfigResponse
+			var err error
+			if req.Interval == "" && req.AutoHeal == nil && req.Releases == nil {
+				config, err = client.GetDriftConfig()
+			} else {
+				config, err = client.UpdateDriftConfig(req)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to configure drift: %w", err)
+			}
+
+			printf("Interval: %s\n", config.Interval)
+			printf("Auto-heal: %v\n", config.AutoHeal)
+			if len(config.DisabledReleases) > 0 {
+				printf("Disabled releases: %s\n", strings.Join(config.DisabledReleases, ", "))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().DurationVar(&interval, "interval", 0, "Drift check interval of releases without their own")
+	cmd.Flags().BoolVar(&autoHeal, "auto-heal", false, "Heal detected drift automatically")
+	cmd.Flags().StringSliceVar(&enable, "enable", nil, "Release to check periodically again (repeatable)")
+	cmd.Flags().StringSliceVar(&disable, "disable", nil, "Release to stop checking periodically (repeatable)")
+	cmd.Flags().StringVar(&daemonAPIAddr, "daemon-api-addr", daemon.DefaultAPIAddr, "Daemon API address")
+
+	return cmd
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/oleksiyp/helmfire/pkg/daemon"
+	"github.com/oleksiyp/helmfire/pkg/gitsource"
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/spf13/cobra"
+)
+
+func newSetVersionCmd() *cobra.Command {
+	var (
+		files         []string
+		environment   string
+		daemonAPIAddr string
+		daemonPIDFile string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "set-version <release> <version>",
+		Short: "Set the chart version of a release in the helmfile",
+		Long: `Set the chart version of a release in the helmfile that defines it, adding the
+version field after the release's chart when missing. Only that value changes,
+so comments and formatting are kept. The version may be a constraint such as
+"~1.4". When the daemon is running, it reloads the helmfile.
+
+Examples:
+  # Pin web to a chart version
+  helmfire set-version web 15.4.2
+
+  # Follow patch releases
+  helmfire set-version web "~15.4"`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			release, version := args[0], strings.TrimSpace(args[1])
+			if version == "" {
+				return fmt.Errorf("version is required")
+			}
+
+			helmfiles, err := localHelmfiles(files)
+			if err != nil {
+				return err
+			}
+			// Later helmfiles override earlier ones, so the last definition wins
+			for i := len(helmfiles) - 1; i >= 0; i-- {
+				path := helmfiles[i]
+				data, err := os.ReadFile(path)
+				if err != nil {
+					return fmt.Errorf("failed to read helmfile: %w", err)
+				}
+				updated, found, err := helmstate.SetReleaseVersion(data, release, version)
+				if err != nil {
+					return err
+				}
+				if !found {
+					continue
+				}
+				if err := writeHelmfile(path, updated, helmfiles, environment); err != nil {
+					return err
+				}
+				printf("✓ Set the version of %s to %s in %s\n", release, version, filepath.Base(path))
+				reloadDaemon(daemonAPIAddr, daemonPIDFile)
+				return nil
+			}
+			return fmt.Errorf("release %s is not defined in the helmfiles (a base or template?); update it by hand", release)
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(&files, "file", "f", []string{"helmfile.yaml"}, helmfileFlagUsage)
+	cmd.Flags().StringVarP(&environment, "environment", "e", "", "Environment name")
+	cmd.Flags().StringVar(&daemonAPIAddr, "daemon-api-addr", daemon.DefaultAPIAddr, "Daemon API address")
+	cmd.Flags().StringVar(&daemonPIDFile, "daemon-pid-file", defaultPaths.PIDFile, "Daemon PID file")
+
+	return cmd
+}
+
+func newAddReleaseCmd() *cobra.Command {
+	var (
+		files         []string
+		environment   string
+		release       helmstate.Release
+		valuesFiles   []string
+		setValues     []string
+		daemonAPIAddr string
+		daemonPIDFile string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "add-release <name>",
+		Short: "Add a release to the helmfile",
+		Long: `Append a release to the releases of the helmfile, adding the releases field
+when missing. The rest of the file, comments included, is kept as is. With
+several helmfiles or a directory, the release goes to the first one. When the
+daemon is running, it reloads the helmfile and installs the release on its
+next sync.
+
+Examples:
+  # Add a release of a repository chart
+  helmfire add-release cache --chart bitnami/redis --namespace cache --version 18.0.4
+
+  # Add a local chart with values
+  helmfire add-release api --chart ./charts/api --values api.yaml --set replicas=2`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			release.Name = args[0]
+			if release.Chart == "" {
+				return fmt.Errorf("--chart is required")
+			}
+			for _, file := range valuesFiles {
+				release.Values = append(release.Values, file)
+			}
+			for _, arg := range setValues {
+				name, value, ok := strings.Cut(arg, "=")
+				if !ok || name == "" {
+					return fmt.Errorf("invalid value %q: expected name=value", arg)
+				}
+				release.Set = append(release.Set, helmstate.SetValue{Name: name, Value: value})
+			}
+
+			helmfiles, err := localHelmfiles(files)
+			if err != nil {
+				return err
+			}
+			manager := helmstate.NewManager(helmfiles[0], environment)
+			manager.ExtraPaths = helmfiles[1:]
+			if err := manager.Load(); err != nil {
+				return fmt.Errorf("failed to load helmfile: %w", err)
+			}
+			for _, r := range manager.Spec.Releases {
+				if r.Name == release.Name {
+					return fmt.Errorf("release %s is already defined", release.Name)
+				}
+			}
+
+			path := helmfiles[0]
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to read helmfile: %w", err)
+			}
+			updated, err := helmstate.AddRelease(data, release)
+			if err != nil {
+				return err
+			}
+			if err := writeHelmfile(path, updated, helmfiles, environment); err != nil {
+				return err
+			}
+			printf("✓ Added release %s (%s) to %s\n", release.Name, release.Chart, filepath.Base(path))
+			reloadDaemon(daemonAPIAddr, daemonPIDFile)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(&files, "file", "f", []string{"helmfile.yaml"}, helmfileFlagUsage)
+	cmd.Flags().StringVarP(&environment, "environment", "e", "", "Environment name")
+	cmd.Flags().StringVar(&release.Chart, "chart", "", "Chart of the release, such as bitnami/nginx or ./charts/api (required)")
+	cmd.Flags().StringVarP(&release.Namespace, "namespace", "n", "", "Namespace of the release")
+	cmd.Flags().StringVar(&release.Version, "version", "", "Chart version or constraint")
+	cmd.Flags().StringArrayVar(&valuesFiles, "values", nil, "Values file of the release (repeatable)")
+	cmd.Flags().StringArrayVar(&setValues, "set", nil, "Value of the release as name=value (repeatable)")
+	cmd.Flags().StringVar(&daemonAPIAddr, "daemon-api-addr", daemon.DefaultAPIAddr, "Daemon API address")
+	cmd.Flags().StringVar(&daemonPIDFile, "daemon-pid-file", defaultPaths.PIDFile, "Daemon PID file")
+
+	return cmd
+}
+
+// localHelmfiles expands files into the helmfiles to edit, which must be
+// on disk rather than fetched from git
+func localHelmfiles(files []string) ([]string, error) {
+	for _, file := range files {
+		if gitsource.IsGitURL(file) {
+			return nil, fmt.Errorf("cannot edit %s: helmfiles from git are edited in their repository", file)
+		}
+	}
+	return helmstate.HelmfileFiles(files)
+}
+
+// writeHelmfile replaces the helmfile at path with data, restoring it when
+// the helmfiles no longer load
+func writeHelmfile(path string, data []byte, helmfiles []string, environment string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to update helmfile: %w", err)
+	}
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to update helmfile: %w", err)
+	}
+	if err := os.WriteFile(path, data, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to update helmfile: %w", err)
+	}
+
+	manager := helmstate.NewManager(helmfiles[0], environment)
+	manager.ExtraPaths = helmfiles[1:]
+	if err := manager.Load(); err != nil {
+		if restoreErr := os.WriteFile(path, original, info.Mode().Perm()); restoreErr != nil {
+			return fmt.Errorf("edited helmfile doesn't load (%v) and restoring it failed: %w", err, restoreErr)
+		}
+		return fmt.Errorf("edited helmfile doesn't load, left unchanged: %w", err)
+	}
+	return nil
+}
+
+// reloadDaemon makes a running daemon load the edited helmfile
+func reloadDaemon(apiAddr, pidFile string) {
+	if running, _ := daemon.IsDaemonRunning(pidFile); !running {
+		return
+	}
+	if err := daemon.NewAPIClient(apiAddr).ReloadHelmfile(); err != nil {
+		printf("⚠️  Failed to reload the daemon: %v\n", err)
+		return
+	}
+	printLine("✓ Daemon reloaded")
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/daemon"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+	"github.com/spf13/cobra"
+)
+
+func newEventsCmd() *cobra.Command {
+	var (
+		follow        bool
+		since         int
+		output        string
+		daemonAPIAddr string
+		daemonPIDFile string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: "Show rollout progress and other daemon events",
+		Long: `List the events the daemon kept, such as the rollout progress of releases
+synced with wait: true, or follow new ones as they happen.
+
+Examples:
+  # Show recent events
+  helmfire events
+
+  # Follow rollout progress while the daemon syncs
+  helmfire events --follow
+
+  # Stream events as JSON lines
+  helmfire events --follow -o json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if running, _ := daemon.IsDaemonRunning(daemonPIDFile); !running {
+				return fmt.Errorf("daemon is not running")
+			}
+			client := daemon.NewAPIClient(daemonAPIAddr)
+
+			if !follow {
+				events, err := client.GetEvents(since)
+				if err != nil {
+					return fmt.Errorf("failed to get events via daemon: %w", err)
+				}
+				if output == "json" {
+					return printJSON(daemon.EventsResponse{Events: events})
+				}
+				if len(events) == 0 {
+					printLine("No events recorded")
+				}
+				for _, event := range events {
+					printEvent(event)
+				}
+				return nil
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			encoder := json.NewEncoder(os.Stdout)
+			return client.StreamEvents(ctx, since, func(event daemon.Event) {
+				if output == "json" {
+					encoder.Encode(event)
+					return
+				}
+				printEvent(event)
+			})
+		},
+	}
+
+	cmd.Flags().BoolVar(&follow, "follow", false, "Keep streaming new events until interrupted")
+	cmd.Flags().IntVar(&since, "since", 0, "Only show events with a greater ID")
+	cmd.Flags().StringVarP(&output, "output", "o", "text", "Output format (text, json)")
+	cmd.Flags().StringVar(&daemonAPIAddr, "daemon-api-addr", daemon.DefaultAPIAddr, "Daemon API address")
+	cmd.Flags().StringVar(&daemonPIDFile, "daemon-pid-file", defaultPaths.PIDFile, "Daemon PID file")
+
+	return cmd
+}
+
+// printEvent prints a daemon event on one line
+func printEvent(event daemon.Event) {
+	printf("%s ", event.Time.Local().Format(time.RFC3339))
+	if event.Type != daemon.EventRollout {
+		mark := "⚠️ "
+		if event.Ready {
+			mark = "✓"
+		}
+		printf("  %s %s: %s\n", mark, event.Type, event.Message)
+		return
+	}
+	printProgress(sync.Progress{
+		Release:   event.Release,
+		Namespace: event.Namespace,
+		RolloutStatus: sync.RolloutStatus{
+			Resource: event.Resource,
+			Ready:    event.Ready,
+			Message:  event.Message,
+		},
+	})
+}
+
+// printProgress prints a rollout status change of a release
+func printProgress(p sync.Progress) {
+	mark := "⏳"
+	if p.Ready {
+		mark = "✓"
+	}
+	printf("  %s %s: %s: %s\n", mark, p.Release, p.Resource, p.Message)
+}
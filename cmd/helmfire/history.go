@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/daemon"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"github.com/spf13/cobra"
+)
+
+// syncHistoryFlags locate the daemon whose sync history is shown
+type syncHistoryFlags struct {
+	output        string
+	daemonAPIAddr string
+	daemonPIDFile string
+	stateFile     string
+}
+
+func (f *syncHistoryFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&f.output, "output", "o", "text", "Output format (text, json)")
+	cmd.Flags().StringVar(&f.daemonAPIAddr, "daemon-api-addr", daemon.DefaultAPIAddr, "Daemon API address")
+	cmd.Flags().StringVar(&f.daemonPIDFile, "daemon-pid-file", defaultPaths.PIDFile, "Daemon PID file")
+	cmd.Flags().StringVar(&f.stateFile, "state-file", defaultPaths.StateFile, "Daemon state file, read when the daemon isn't running")
+}
+
+// runs returns the daemon's sync runs, oldest first: from the daemon if it
+// is running, otherwise from the state file it left behind
+func (f *syncHistoryFlags) runs() ([]daemon.SyncRun, error) {
+	if running, _ := daemon.IsDaemonRunning(f.daemonPIDFile); !running {
+		return daemon.LoadSyncHistory(f.stateFile)
+	}
+
+	newest, err := daemon.NewAPIClient(f.daemonAPIAddr).GetSyncs(0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sync history via daemon: %w", err)
+	}
+	runs := make([]daemon.SyncRun, len(newest))
+	for i, run := range newest {
+		runs[len(newest)-1-i] = run
+	}
+	return runs, nil
+}
+
+// run finds a run by its number or by the sync ID stamped on resources
+func (f *syncHistoryFlags) run(runs []daemon.SyncRun, arg string) (daemon.SyncRun, error) {
+	id, err := strconv.Atoi(arg)
+	if err != nil {
+		for _, run := range runs {
+			if run.SyncID == arg {
+				return run, nil
+			}
+		}
+		return daemon.SyncRun{}, fmt.Errorf("sync run not found: %s", arg)
+	}
+	run, ok := daemon.FindSyncRun(runs, id)
+	if !ok {
+		return daemon.SyncRun{}, fmt.Errorf("sync run not found: %d", id)
+	}
+	return run, nil
+}
+
+func newHistoryCmd() *cobra.Command {
+	var (
+		flags syncHistoryFlags
+		limit int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "history [id]",
+		Short: "Browse the daemon's past sync runs",
+		Long: `List the sync runs of the daemon, newest first, or show one run in detail:
+what triggered it, each release's result and duration, and the substitutions
+active at the time. A run can also be named by the sync ID stamped on the
+resources it synced (see --stamp of sync and daemon start).
+
+The history is read from the daemon when it is running and from its state
+file otherwise.
+
+Examples:
+  # List the last 10 runs
+  helmfire history --limit 10
+
+  # Show run 12
+  helmfire history 12
+
+  # Show the run that stamped a resource with helmfire.dev/sync-id
+  helmfire history 20240115T110000Z-a1b2c3
+
+  # Compare runs 11 and 12
+  helmfire history diff 11 12`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			runs, err := flags.runs()
+			if err != nil {
+				return err
+			}
+
+			if len(args) == 1 {
+				run, err := flags.run(runs, args[0])
+				if err != nil {
+					return err
+				}
+				if flags.output == "json" {
+					return printJSON(run)
+				}
+				printSyncRun(run)
+				return nil
+			}
+
+			newest := make([]daemon.SyncRun, 0, len(runs))
+			for i := len(runs) - 1; i >= 0 && (limit == 0 || len(newest) < limit); i-- {
+				newest = append(newest, runs[i])
+			}
+			if flags.output == "json" {
+				return printJSON(daemon.SyncHistoryResponse{Runs: newest})
+			}
+
+			if len(newest) == 0 {
+				printLine("No sync runs recorded")
+				return nil
+			}
+			for _, run := range newest {
+				result := "✓"
+				if run.Failed() {
+					result = "✗"
+				}
+				printf("  %s #%-4d %s  %-6s %d release(s) in %s\n",
+					result, run.ID, run.StartTime.Local().Format(time.RFC3339), run.Trigger,
+					len(run.Results), run.Duration.Round(time.Millisecond))
+			}
+			return nil
+		},
+	}
+
+	flags.register(cmd)
+	cmd.Flags().IntVar(&limit, "limit", 0, "Show at most this many runs (0 = all)")
+
+	cmd.AddCommand(newHistoryDiffCmd())
+
+	return cmd
+}
+
+func newHistoryDiffCmd() *cobra.Command {
+	var flags syncHistoryFlags
+
+	cmd := &cobra.Command{
+		Use:   "diff <from> <to>",
+		Short: "Compare two sync runs",
+		Long: `Show the substitutions added and removed between two sync runs and the
+releases whose result changed.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			runs, err := flags.runs()
+			if err != nil {
+				return err
+			}
+			from, err := flags.run(runs, args[0])
+			if err != nil {
+				return err
+			}
+			to, err := flags.run(runs, args[1])
+			if err != nil {
+				return err
+			}
+
+			diff := daemon.DiffSyncRuns(from, to)
+			if flags.output == "json" {
+				return printJSON(diff)
+			}
+
+			printf("Sync run #%d → #%d\n", diff.From, diff.To)
+			if len(diff.Added.Charts)+len(diff.Added.Images)+len(diff.Removed.Charts)+len(diff.Removed.Images) == 0 {
+				printLine("\nSubstitutions: unchanged")
+			} else {
+				printLine("\nSubstitutions:")
+				printSnapshotChanges("-", diff.Removed)
+				printSnapshotChanges("+", diff.Added)
+			}
+
+			if len(diff.Releases) == 0 {
+				printLine("\nReleases: unchanged")
+				return nil
+			}
+			printLine("\nReleases:")
+			for _, change := range diff.Releases {
+				from, to := string(change.From), string(change.To)
+				if from == "" {
+					from = "not synced"
+				}
+				if to == "" {
+					to = "not synced"
+				}
+				line := fmt.Sprintf("  %s: %s → %s", change.Name, from, to)
+				if change.Error != "" {
+					line += " (" + change.Error + ")"
+				}
+				printLine(line)
+			}
+			return nil
+		},
+	}
+
+	flags.register(cmd)
+
+	return cmd
+}
+
+// printSyncRun prints one sync run in detail
+func printSyncRun(run daemon.SyncRun) {
+	printf("Sync run #%d\n", run.ID)
+	printf("  Trigger: %s\n", run.Trigger)
+	if run.SyncID != "" {
+		printf("  Sync ID: %s\n", run.SyncID)
+	}
+	printf("  Started: %s\n", run.StartTime.Local().Format(time.RFC3339))
+	printSyncReport(&run.Report)
+
+	if len(run.Substitutions.Charts)+len(run.Substitutions.Images) == 0 {
+		printLine("\nNo active substitutions")
+		return
+	}
+	printLine("\nActive substitutions:")
+	printSnapshotChanges(" ", run.Substitutions)
+}
+
+// printSnapshotChanges prints the substitutions of a snapshot, each line
+// marked with prefix
+func printSnapshotChanges(prefix string, s substitute.Snapshot) {
+	for _, c := range s.Charts {
+		printf("  %s chart %s → %s%s\n", prefix, c.Original, c.Path, substitutionSuffix(c.Release, c.Namespace, c.ExpiresAt))
+	}
+	for _, img := range s.Images {
+		printf("  %s image %s → %s%s\n", prefix, img.Original, img.Replacement, substitutionSuffix(img.Release, img.Namespace, img.ExpiresAt))
+	}
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/daemon"
+	"github.com/oleksiyp/helmfire/pkg/helmfire"
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/policy"
+	"github.com/oleksiyp/helmfire/pkg/preflight"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// lintResult is the JSON output of helmfire lint
+type lintResult struct {
+	File     string              `json:"file"`
+	Files    []string            `json:"files,omitempty"` // every helmfile linted, when more than one
+	Problems []helmstate.Problem `json:"problems"`
+	Releases []sync.LintResult   `json:"releases,omitempty"`
+}
+
+// failed reports whether the helmfile or any release has errors
+func (r lintResult) failed() bool {
+	if len(r.Problems) > 0 {
+		return true
+	}
+	for _, release := range r.Releases {
+		if release.Failed() {
+			return true
+		}
+	}
+	return false
+}
+
+func newLintCmd() *cobra.Command {
+	var (
+		files           []string
+		environment     string
+		output          string
+		showSchema      bool
+		charts          bool
+		helmBinary      string
+		validator       string
+		validatorBinary string
+		validatorArgs   []string
+		severity        string
+		policies        policyFlags
+		daemonAPIAddr   string
+		daemonPIDFile   string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Check the helmfile and the charts of its releases",
+		Long: `Validate the helmfile against the schema of the fields helmfire understands
+and report each problem with its line and column: unknown fields (typos such as
+"namspace"), values of the wrong type, missing required fields and malformed
+durations. Without --strict, sync and the daemon silently ignore such mistakes.
+
+Then run helm lint on the chart of each release, with its values files, --set
+values and chart substitutions applied; remote charts are pulled first. With
+--validator, the manifests each release renders to, image substitutions
+included, are also checked by kubeconform or kubeval, and with --policy-dir by
+the Rego policies sync enforces. Findings are grouped per release; --severity
+hides the less severe ones.
+
+The command exits with status 1 when the helmfile has problems or a release
+has errors. Substitutions are taken from the daemon when it is running.
+
+Examples:
+  # Lint the helmfile in the current directory and its charts
+  helmfire lint
+
+  # Only check the helmfile, printing the problems as JSON
+  helmfire lint -f deploy/helmfile.yaml --charts=false -o json
+
+  # Also validate the rendered manifests against Kubernetes 1.29
+  helmfire lint --validator kubeconform --validator-arg=-kubernetes-version=1.29.0
+
+  # Check the rendered manifests against the policies in ./policies
+  helmfire lint --policy-dir policies
+
+  # Only show errors
+  helmfire lint --severity error
+
+  # Print the JSON schema, e.g. for editor completion
+  helmfire lint --schema > helmfile.schema.json`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if showSchema {
+				_, err := os.Stdout.Write(helmstate.Schema)
+				return err
+			}
+
+			minSeverity, err := sync.ParseSeverity(severity)
+			if err != nil {
+				return err
+			}
+			if validator != "" && validator != sync.ValidatorKubeconform && validator != sync.ValidatorKubeval {
+				return fmt.Errorf("invalid validator %q: must be %s or %s", validator, sync.ValidatorKubeconform, sync.ValidatorKubeval)
+			}
+			policyChecker, err := policies.checker()
+			if err != nil {
+				return err
+			}
+
+			helmfiles, err := helmfire.ResolveHelmfiles(context.Background(), files, globalLogger)
+			if err != nil {
+				return err
+			}
+			paths, err := helmstate.HelmfileFiles(helmfiles)
+			if err != nil {
+				return err
+			}
+
+			result := lintResult{File: paths[0], Problems: []helmstate.Problem{}}
+			if len(paths) > 1 {
+				result.Files = paths
+			}
+			for _, path := range paths {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					return fmt.Errorf("failed to read helmfile: %w", err)
+				}
+				for _, problem := range helmstate.Validate(data) {
+					problem.File = path
+					result.Problems = append(result.Problems, problem)
+				}
+			}
+
+			if charts {
+				releases, err := lintCharts(helmfiles, environment, helmBinary, daemonAPIAddr, daemonPIDFile, policyChecker, sync.LintOptions{
+					Validator:       validator,
+					ValidatorBinary: validatorBinary,
+					ValidatorArgs:   validatorArgs,
+					MinSeverity:     minSeverity,
+				})
+				if err != nil {
+					return err
+				}
+				result.Releases = releases
+			}
+
+			if output == "json" {
+				if err := printJSON(result); err != nil {
+					return err
+				}
+			} else {
+				printLintResult(result)
+			}
+
+			if result.failed() {
+				// The problems are already listed; usage would bury them
+				cmd.SilenceUsage = true
+				return fmt.Errorf("lint found problems")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(&files, "file", "f", []string{"helmfile.yaml"}, helmfileFlagUsage)
+	cmd.Flags().StringVarP(&environment, "environment", "e", "", "Environment name")
+	cmd.Flags().StringVarP(&output, "output", "o", "text", "Output format (text, json)")
+	cmd.Flags().BoolVar(&showSchema, "schema", false, "Print the helmfile JSON schema instead of linting")
+	cmd.Flags().BoolVar(&charts, "charts", true, "Run helm lint on the chart of each release")
+	cmd.Flags().StringVar(&helmBinary, "helm-binary", "", "Path to helm binary (default: $"+preflight.EnvHelmBinary+" or helm on PATH)")
+	cmd.Flags().StringVar(&validator, "validator", "", "Validate rendered manifests with kubeconform or kubeval")
+	cmd.Flags().StringVar(&validatorBinary, "validator-binary", "", "Path to the validator binary (default: the validator name)")
+	cmd.Flags().StringArrayVar(&validatorArgs, "validator-arg", nil, "Argument passed to the validator (repeatable)")
+	cmd.Flags().StringVar(&severity, "severity", string(sync.SeverityWarning), "Lowest severity of chart findings shown (info, warning, error)")
+	policies.register(cmd)
+	cmd.Flags().StringVar(&daemonAPIAddr, "daemon-api-addr", daemon.DefaultAPIAddr, "Daemon API address")
+	cmd.Flags().StringVar(&daemonPIDFile, "daemon-pid-file", defaultPaths.PIDFile, "Daemon PID file")
+
+	return cmd
+}
+
+// lintCharts lints the chart of every installed release in the helmfile,
+// applying the daemon's substitutions when it is running
+func lintCharts(helmfiles []string, environment, helmBinary, daemonAPIAddr, daemonPIDFile string, policyChecker policy.Checker, opts sync.LintOptions) ([]sync.LintResult, error) {
+	helm, err := runPreflight(helmBinary, false)
+	if err != nil {
+		return nil, err
+	}
+
+	project, err := helmfire.LoadProject(context.Background(), helmfire.ProjectOptions{
+		Files:             helmfiles,
+		Environment:       environment,
+		HelmBinary:        helm.HelmBinary,
+		Substitutor:       globalSubstitutor,
+		OfflineCharts:     offlineCharts(),
+		NamespaceTemplate: namespaceTemplate(),
+		ReleasePrefix:     globalReleasePrefix,
+		StateDir:          projectStateDir(),
+		Logger:            globalLogger,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if running, _ := daemon.IsDaemonRunning(daemonPIDFile); running {
+		snapshot, err := daemon.NewAPIClient(daemonAPIAddr).ExportSubstitutions()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get substitutions via daemon: %w", err)
+		}
+		if _, err := globalSubstitutor.Import(*snapshot, time.Now()); err != nil {
+			return nil, fmt.Errorf("failed to apply daemon substitutions: %w", err)
+		}
+	}
+
+	executor := project.Executor(helmfire.ExecutorOptions{Policy: policyChecker})
+
+	ctx := context.Background()
+	if repos := project.Manager().RepositoriesFor(project.Releases()); len(repos) > 0 {
+		globalLogger.Info("syncing repositories", zap.Int("count", len(repos)))
+		if err := executor.SyncRepositoriesContext(ctx, repos); err != nil {
+			return nil, fmt.Errorf("failed to sync repositories: %w", err)
+		}
+	}
+
+	return executor.Lint(ctx, project.Releases(), opts), nil
+}
+
+// printLintResult prints the helmfile problems, then the findings of each
+// release
+func printLintResult(result lintResult) {
+	for _, problem := range result.Problems {
+		printf("%s:%s\n", problem.File, problem)
+	}
+	if len(result.Problems) == 0 {
+		files := result.Files
+		if len(files) == 0 {
+			files = []string{result.File}
+		}
+		for _, file := range files {
+			printf("✓ %s is valid\n", file)
+		}
+	}
+
+	symbols := map[sync.Severity]string{
+		sync.SeverityError:   "✗",
+		sync.SeverityWarning: "⚠️ ",
+		sync.SeverityInfo:    "ℹ",
+	}
+	failed := 0
+	for _, release := range result.Releases {
+		if release.Failed() {
+			failed++
+		}
+		printf("\n%s (%s) %s\n", release.Release, release.Namespace, release.Chart)
+		if release.Error != "" {
+			printf("  ✗ %s\n", release.Error)
+		}
+		for _, finding := range release.Findings {
+			message := finding.Message
+			if finding.Resource != "" {
+				message = finding.Resource + ": " + message
+			}
+			printf("  %s [%s] %s\n", symbols[finding.Severity], finding.Source, message)
+		}
+		if release.Error == "" && len(release.Findings) == 0 {
+			printLine("  ✓ no findings")
+		}
+	}
+
+	printf("\n%d problem(s) in the helmfile", len(result.Problems))
+	if len(result.Releases) > 0 {
+		printf(", %d of %d release(s) with errors", failed, len(result.Releases))
+	}
+	printLine()
+}
@@ -3,27 +3,78 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/oleksiyp/helmfire/internal/version"
+	"github.com/oleksiyp/helmfire/pkg/audit"
+	"github.com/oleksiyp/helmfire/pkg/cloudevents"
+	"github.com/oleksiyp/helmfire/pkg/config"
 	"github.com/oleksiyp/helmfire/pkg/daemon"
+	"github.com/oleksiyp/helmfire/pkg/deploystatus"
 	"github.com/oleksiyp/helmfire/pkg/drift"
+	"github.com/oleksiyp/helmfire/pkg/gitsource"
+	"github.com/oleksiyp/helmfire/pkg/helmfire"
 	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/httpclient"
+	"github.com/oleksiyp/helmfire/pkg/incluster"
+	"github.com/oleksiyp/helmfire/pkg/leader"
+	"github.com/oleksiyp/helmfire/pkg/policy"
+	"github.com/oleksiyp/helmfire/pkg/preflight"
+	"github.com/oleksiyp/helmfire/pkg/rendercache"
+	"github.com/oleksiyp/helmfire/pkg/reportformat"
 	"github.com/oleksiyp/helmfire/pkg/substitute"
 	"github.com/oleksiyp/helmfire/pkg/sync"
+	"github.com/oleksiyp/helmfire/pkg/tracing"
+	"github.com/oleksiyp/helmfire/pkg/watcher"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
 )
 
 var (
-	globalLogger     *zap.Logger
+	globalLogger      *zap.Logger
 	globalSubstitutor *substitute.Manager
+	globalConfigPath  string
+	globalAuditLog    string
+	globalOTLP        string
+
+	// globalOffline takes remote charts from globalMirror instead of their
+	// repositories
+	globalOffline bool
+	globalMirror  string
+
+	// globalNamespaceSuffix and globalNamespaceTemplate rewrite the namespace
+	// of every release; see namespaceTemplate
+	globalNamespaceSuffix   string
+	globalNamespaceTemplate string
+
+	// globalReleasePrefix is prepended to the name of every release
+	globalReleasePrefix string
+
+	// globalHTTP are the proxy and CA bundle of outbound HTTP requests
+	globalHTTP httpclient.Options
+
+	// defaultPaths are the daemon files of the project in the working directory
+	defaultPaths daemon.Paths
 )
 
 func main() {
+	// helm runs helmfire itself as the image substitution post-renderer
+	if sync.PostRenderRequested() {
+		if err := runPostRenderer(); err != nil {
+			fmt.Fprintf(os.Stderr, "helmfire post-renderer: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Initialize logger
 	var err error
 	globalLogger, err = zap.NewDevelopment()
@@ -36,6 +87,15 @@ func main() {
 	// Initialize substitutor
 	globalSubstitutor = substitute.NewManager()
 
+	defaultPaths = daemon.DefaultPaths()
+	if cwd, err := os.Getwd(); err == nil {
+		if migrated, err := daemon.MigrateLegacyFiles(defaultPaths, cwd); err != nil {
+			globalLogger.Warn("failed to migrate daemon files from /tmp", zap.Error(err))
+		} else if migrated {
+			globalLogger.Info("migrated running daemon's files from /tmp", zap.String("dir", defaultPaths.Dir))
+		}
+	}
+
 	rootCmd := &cobra.Command{
 		Use:   "helmfire",
 		Short: "Helmfile sync with watching, live substitution, and drift detection",
@@ -48,34 +108,142 @@ func main() {
 		Version: version.Version,
 	}
 
+	shutdownTracing := func(context.Context) error { return nil }
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if globalCI {
+			os.Setenv("NO_COLOR", "1")
+		}
+		if globalNamespaceSuffix != "" && globalNamespaceTemplate != "" {
+			return fmt.Errorf("--namespace-suffix and --namespace-template are mutually exclusive")
+		}
+		if err := httpclient.SetDefaults(globalHTTP); err != nil {
+			return err
+		}
+
+		cfg := tracing.ConfigFromEnv()
+		if globalOTLP != "" {
+			cfg.Endpoint, cfg.TracesEndpoint = globalOTLP, ""
+		}
+		cfg.OnError = func(err error) {
+			globalLogger.Warn("failed to export traces", zap.Error(err))
+		}
+		shutdown, err := tracing.Init(cfg)
+		if err != nil {
+			return err
+		}
+		shutdownTracing = shutdown
+		return nil
+	}
+
+	rootCmd.PersistentFlags().StringVar(&globalConfigPath, "config", "", "Config file (default: $"+config.EnvConfigPath+" or ~/.helmfire/config.yaml)")
+	rootCmd.PersistentFlags().StringVar(&globalAuditLog, "audit-log", defaultPaths.AuditLogFile, "Substitution audit log")
+	rootCmd.PersistentFlags().StringVar(&globalOTLP, "otlp-endpoint", "", "OTLP/HTTP collector to export sync traces to, e.g. http://localhost:4318 (default: $"+tracing.EnvEndpoint+")")
+	rootCmd.PersistentFlags().StringVar(&globalHTTP.Proxy, "proxy", "", "Proxy for outbound HTTP: notifiers, chart downloads, repositories, Vault and traces (default: $HTTPS_PROXY and $HTTP_PROXY)")
+	rootCmd.PersistentFlags().StringVar(&globalHTTP.CAFile, "ca-file", "", "PEM bundle of certificate authorities trusted besides the system's for outbound HTTPS")
+	rootCmd.PersistentFlags().BoolVar(&globalOffline, "offline", false, "Take remote charts from the chart mirror instead of their repositories, which aren't synced")
+	rootCmd.PersistentFlags().StringVar(&globalMirror, "chart-mirror", sync.DefaultMirrorDir(), "Chart mirror directory, filled by helmfire mirror")
+	rootCmd.PersistentFlags().StringVar(&globalNamespaceSuffix, "namespace-suffix", "", "Append -<suffix> to the namespace of every release, e.g. dev-alice, to sync beside others' copies of the helmfile")
+	rootCmd.PersistentFlags().StringVar(&globalNamespaceTemplate, "namespace-template", "", "Rewrite the namespace of every release with a template given {{ .Namespace }}, {{ .Release }} and {{ .Environment }}, e.g. '{{ .Namespace }}-dev-alice'")
+	rootCmd.PersistentFlags().StringVar(&globalReleasePrefix, "release-prefix", "", "Prepend a prefix to the name of every release, e.g. alice-, so copies of the helmfile can share a namespace")
+	rootCmd.PersistentFlags().BoolVar(&globalCI, "ci", false, "Output for CI logs: no emoji or colors, a log group per release, pipeline exit codes, and a job summary and step outputs on GitHub Actions")
+
 	// Add subcommands
 	rootCmd.AddCommand(newSyncCmd())
 	rootCmd.AddCommand(newChartCmd())
 	rootCmd.AddCommand(newImageCmd())
 	rootCmd.AddCommand(newListCmd())
 	rootCmd.AddCommand(newRemoveCmd())
+	rootCmd.AddCommand(newExportCmd())
+	rootCmd.AddCommand(newImportCmd())
 	rootCmd.AddCommand(newDaemonCmd())
+	rootCmd.AddCommand(newOrphansCmd())
+	rootCmd.AddCommand(newDriftCmd())
+	rootCmd.AddCommand(newHistoryCmd())
+	rootCmd.AddCommand(newEventsCmd())
+	rootCmd.AddCommand(newRollbackCmd())
+	rootCmd.AddCommand(newValuesCmd())
+	rootCmd.AddCommand(newPauseCmd())
+	rootCmd.AddCommand(newResumeCmd())
+	rootCmd.AddCommand(newDoctorCmd())
+	rootCmd.AddCommand(newLintCmd())
+	rootCmd.AddCommand(newVersionsCmd())
+	rootCmd.AddCommand(newMirrorCmd())
+	rootCmd.AddCommand(newSetVersionCmd())
+	rootCmd.AddCommand(newAddReleaseCmd())
+	rootCmd.AddCommand(newDevCmd())
+	rootCmd.AddCommand(newUICmd())
+	rootCmd.AddCommand(newPreviewCmd())
+
+	err = rootCmd.Execute()
+
+	// Spans still queued are flushed before exiting
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	shutdownTracing(flushCtx)
+	cancelFlush()
 
-	if err := rootCmd.Execute(); err != nil {
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
 
+// runPostRenderer runs helmfire as helm's post-renderer, tracing it as part
+// of the sync that runs helm
+func runPostRenderer() error {
+	if shutdown, err := tracing.Init(tracing.ConfigFromEnv()); err == nil {
+		defer shutdown(context.Background())
+	}
+	ctx := tracing.ContextWithTraceparent(context.Background(), os.Getenv(tracing.EnvTraceparent))
+	_, span := tracing.Start(ctx, "postrender.substitute")
+	err := sync.RunPostRendererFromEnv(os.Stdin, os.Stdout)
+	span.End(err)
+	return err
+}
+
 func newSyncCmd() *cobra.Command {
 	var (
-		watch           bool
-		daemon          bool
-		driftDetect     bool
-		driftInterval   time.Duration
-		driftAutoHeal   bool
-		driftWebhook    string
-		file            string
-		environment     string
-		selectors       []string
-		namespace       string
-		kubeContext     string
-		dryRun          bool
+		watch         bool
+		watchInterval time.Duration
+		daemon        bool
+		driftDetect   bool
+		driftInterval time.Duration
+		driftAutoHeal bool
+		driftWebhook  string
+		files         []string
+		environment   string
+		selectors     []string
+		namespace     string
+		kubeContext   string
+		dryRun        bool
+		timeout       time.Duration
+		helmBinary    string
+		prune         bool
+		pruneRepos    bool
+		driftOrphans  bool
+		driftJitter   float64
+		driftStagger  bool
+		driftFlap     time.Duration
+		driftContext  int
+		driftWorkers  int
+		driftPrecheck bool
+		renderCache   int
+		healSeverity  string
+		healManualNS  []string
+		healWindows   []string
+		healBlackouts []string
+		healPreview   bool
+		healGitOps    bool
+		canary        string
+		stamp         stampFlags
+		resources     string
+		policies      policyFlags
+		namespaces    namespaceFlags
+		deployStatus  deployStatusFlags
+		reportFile    reportFileFlags
+		strict        bool
+		showNotes     bool
+		checkCluster  bool
+		minKube       string
 	)
 
 	cmd := &cobra.Command{
@@ -94,55 +262,192 @@ Examples:
   helmfire sync --dry-run
 
   # Sync to specific namespace
-  helmfire sync --namespace production`,
+  helmfire sync --namespace production
+
+  # Abort the whole sync run after 10 minutes
+  helmfire sync --timeout 10m
+
+  # Label every resource as managed by helmfire
+  helmfire sync --stamp --stamp-label team=payments`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if watch || daemon {
-				return fmt.Errorf("watch mode and daemon mode not yet implemented (Phase 2 and 4)")
+			if daemon {
+				return fmt.Errorf("daemon mode not yet implemented (Phase 4), use helmfire daemon start")
+			}
+
+			cfg, err := config.Load(globalConfigPath)
+			if err != nil {
+				return err
+			}
+			if err := addSubstitutionProviders(cfg); err != nil {
+				return err
+			}
+
+			policy, err := newHealPolicy(healSeverity, healManualNS, healWindows, healBlackouts)
+			if err != nil {
+				return err
+			}
+			policy.HealGitOpsManaged = healGitOps
+
+			resourceStamp, err := stamp.stamp()
+			if err != nil {
+				return err
+			}
+			profile, err := resourcesProfile(resources)
+			if err != nil {
+				return err
+			}
+			policyChecker, err := policies.checker()
+			if err != nil {
+				return err
+			}
+			statusConfig, err := deployStatus.config(environment)
+			if err != nil {
+				return err
+			}
+			if _, _, _, err := reportFile.exporter(); err != nil {
+				return err
+			}
+			canaryRun, err := helmfire.ParseCanary(canary)
+			if err != nil {
+				return err
+			}
+			configured, err := drift.NewNotifiers(cfg.Notifiers, globalLogger)
+			if err != nil {
+				return fmt.Errorf("failed to configure notifiers: %w", err)
+			}
+
+			// Verify helm installation before touching the cluster
+			helm, err := runPreflight(helmBinary, driftDetect)
+			if err != nil {
+				return err
+			}
+
+			// Renders repeat only while watching or detecting drift
+			var cache *rendercache.Cache
+			if watch || driftDetect {
+				cache = rendercache.New(renderCache)
 			}
 
 			// Load helmfile
-			globalLogger.Info("loading helmfile", zap.String("file", file))
-			manager := helmstate.NewManager(file, environment)
-			if err := manager.Load(); err != nil {
-				return fmt.Errorf("failed to load helmfile: %w", err)
+			globalLogger.Info("loading helmfile", zap.Strings("files", files))
+			project, err := helmfire.LoadProject(context.Background(), helmfire.ProjectOptions{
+				Files:             files,
+				Environment:       environment,
+				HelmBinary:        helm.HelmBinary,
+				Namespace:         namespace,
+				KubeContext:       kubeContext,
+				Strict:            strict,
+				Substitutor:       globalSubstitutor,
+				RenderCache:       cache,
+				OfflineCharts:     offlineCharts(),
+				NamespaceTemplate: namespaceTemplate(),
+				ReleasePrefix:     globalReleasePrefix,
+				StateDir:          projectStateDir(),
+				Logger:            globalLogger,
+			})
+			if err != nil {
+				return ciExit(exitInvalidConfig, err)
+			}
+			manager := project.Manager()
+
+			executor := project.Executor(helmfire.ExecutorOptions{
+				DryRun:           dryRun,
+				Stamp:            resourceStamp,
+				Resources:        profile,
+				Policy:           policyChecker,
+				CreateNamespace:  &namespaces.create,
+				VerifyNamespaces: namespaces.verify,
+				Progress:         printProgress,
+			})
+
+			// Enforce overall deadline for the sync run
+			syncCtx := context.Background()
+			if timeout > 0 {
+				var cancelSync context.CancelFunc
+				syncCtx, cancelSync = context.WithTimeout(syncCtx, timeout)
+				defer cancelSync()
 			}
 
-			// Create executor
-			executor := sync.NewExecutor(globalLogger, globalSubstitutor)
-			executor.SetDryRun(dryRun)
-			if namespace != "" {
-				executor.SetNamespace(namespace)
+			if dryRun {
+				printSyncPlan(project.Releases(), executor)
 			}
-			if kubeContext != "" {
-				executor.SetKubeContext(kubeContext)
+
+			// Dry runs deploy nothing to announce
+			var syncNotifiers []drift.SyncNotifier
+			if !dryRun {
+				syncNotifiers = drift.SyncNotifiers(configured)
+			}
+			if globalCI {
+				syncNotifiers = append(syncNotifiers, ciGroups{})
+			}
+			report, syncErr := project.Sync(syncCtx, helmfire.SyncOptions{
+				Executor:          executor,
+				Notes:             showNotes && !dryRun,
+				CheckCluster:      checkCluster,
+				MinKubeVersion:    minKube,
+				Canary:            canaryRun,
+				PruneRepositories: pruneRepos,
+				Trigger:           "cli",
+				Notifiers:         syncNotifiers,
+			})
+			if report == nil {
+				return syncErr
 			}
 
-			// Sync repositories
-			repos := manager.GetRepositories()
-			if len(repos) > 0 {
-				globalLogger.Info("syncing repositories", zap.Int("count", len(repos)))
-				if err := executor.SyncRepositories(repos); err != nil {
-					return fmt.Errorf("failed to sync repositories: %w", err)
+			printSyncReport(report)
+			if showNotes {
+				printReleaseNotes(report)
+			}
+			if statusConfig != nil && !dryRun {
+				reportDeployStatus(*statusConfig, project.Files()[0], report)
+			}
+			if err := reportFile.write(reportformat.Results{Helmfile: project.Files()[0], Sync: report}); err != nil {
+				if syncErr == nil {
+					return err
+				}
+				globalLogger.Error("failed to export sync report", zap.Error(err))
+			}
+			if globalCI {
+				if err := writeCIResults(reportformat.Results{Helmfile: project.Files()[0], Sync: report}, syncOutputs(report, dryRun, executor)); err != nil {
+					globalLogger.Error("failed to write CI results", zap.Error(err))
+				}
+			}
+			if syncErr != nil {
+				if report.Failed() {
+					return ciExit(exitHelmFailed, syncErr)
 				}
+				return syncErr
 			}
 
-			// Get releases
-			releases := manager.GetReleases()
-			globalLogger.Info("found releases", zap.Int("count", len(releases)))
+			globalLogger.Info("sync completed successfully")
 
-			// Sync each release
-			for _, release := range releases {
-				if !manager.IsReleaseInstalled(release) {
-					globalLogger.Info("skipping release (installed: false)", zap.String("name", release.Name))
-					continue
+			// Remove releases no longer defined in the helmfile
+			if prune {
+				orphans, err := manager.FindOrphans()
+				if err != nil {
+					return fmt.Errorf("failed to find orphaned releases: %w", err)
 				}
-
-				if err := executor.SyncRelease(release); err != nil {
-					return fmt.Errorf("failed to sync release %s: %w", release.Name, err)
+				if err := pruneOrphans(syncCtx, executor, orphans); err != nil {
+					return err
 				}
 			}
 
-			globalLogger.Info("sync completed successfully")
+			// Keep syncing local changes until interrupted
+			if watch {
+				watchCtx, stopWatch := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+				defer stopWatch()
+				watchOpts := helmfire.WatchOptions{
+					Executor:    executor,
+					KubeContext: kubeContext,
+					Interval:    watchInterval,
+					DryRun:      dryRun,
+					Reporter:    consoleReporter{dryRun: dryRun},
+				}
+				if !driftDetect {
+					return project.Watch(watchCtx, watchOpts)
+				}
+				go project.Watch(watchCtx, watchOpts)
+			}
 
 			// Start drift detection if enabled
 			if driftDetect {
@@ -150,31 +455,12 @@ Examples:
 					zap.Duration("interval", driftInterval),
 					zap.Bool("autoHeal", driftAutoHeal))
 
-				// Create drift detector
-				detector := drift.NewDetector(manager, driftInterval, globalLogger)
-
-				// Add stdout notifier
-				detector.AddNotifier(drift.NewStdoutNotifier(globalLogger))
-
-				// Add webhook notifier if configured
+				// Stdout, webhook and the notifiers declared in config
+				notifiers := []drift.Notifier{drift.NewStdoutNotifier(globalLogger)}
 				if driftWebhook != "" {
-					detector.AddNotifier(drift.NewWebhookNotifier(driftWebhook, globalLogger))
-				}
-
-				// Enable auto-heal if requested
-				if driftAutoHeal {
-					healFunc := func(releaseName string) error {
-						// Find the release
-						for _, release := range releases {
-							if release.Name == releaseName {
-								globalLogger.Info("healing release", zap.String("name", releaseName))
-								return executor.SyncRelease(release)
-							}
-						}
-						return fmt.Errorf("release not found: %s", releaseName)
-					}
-					detector.EnableAutoHeal(true, healFunc)
+					notifiers = append(notifiers, drift.NewWebhookNotifier(driftWebhook, globalLogger))
 				}
+				notifiers = append(notifiers, configured...)
 
 				// Create context with signal handling
 				ctx, cancel := context.WithCancel(context.Background())
@@ -184,67 +470,478 @@ Examples:
 				sigChan := make(chan os.Signal, 1)
 				signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
-				// Start detector
-				if err := detector.Start(ctx); err != nil {
-					return fmt.Errorf("failed to start drift detector: %w", err)
+				detector, err := project.Drift(ctx, helmfire.DriftOptions{
+					Executor:        executor,
+					Interval:        driftInterval,
+					Jitter:          driftJitter,
+					Stagger:         driftStagger,
+					FlapWindow:      driftFlap,
+					ContextLines:    driftContext,
+					Workers:         driftWorkers,
+					DisablePrecheck: !driftPrecheck,
+					Notifiers:       notifiers,
+					AutoHeal:        driftAutoHeal,
+					HealPolicy:      policy,
+					HealPreview:     healPreview,
+					Orphans:         driftOrphans,
+					Prune:           prune,
+				})
+				if err != nil {
+					return err
 				}
 
 				globalLogger.Info("drift detector running, press Ctrl+C to stop")
-				fmt.Println("\n✓ Drift detector running...")
-				fmt.Printf("  Interval: %s\n", driftInterval)
-				fmt.Printf("  Auto-heal: %v\n", driftAutoHeal)
+				printLine("\n✓ Drift detector running...")
+				printf("  Interval: %s\n", driftInterval)
+				printf("  Auto-heal: %v\n", driftAutoHeal)
 				if driftWebhook != "" {
-					fmt.Printf("  Webhook: %s\n", driftWebhook)
+					printf("  Webhook: %s\n", driftWebhook)
 				}
-				fmt.Println("\nPress Ctrl+C to stop")
+				printLine("\nPress Ctrl+C to stop")
 
 				// Wait for interrupt
 				<-sigChan
 				globalLogger.Info("received interrupt signal, stopping drift detector")
-				fmt.Println("\nStopping drift detector...")
+				printLine("\nStopping drift detector...")
 
 				// Stop detector
 				if err := detector.Stop(); err != nil {
 					return fmt.Errorf("failed to stop drift detector: %w", err)
 				}
 
-				fmt.Println("✓ Drift detector stopped")
+				printLine("✓ Drift detector stopped")
 			}
 
 			return nil
 		},
 	}
 
-	cmd.Flags().BoolVarP(&watch, "watch", "w", false, "Watch for file changes and auto-sync (Phase 2)")
+	cmd.Flags().BoolVarP(&watch, "watch", "w", false, "Watch the helmfile, values files and file sync sources, syncing changes until interrupted")
+	cmd.Flags().DurationVar(&watchInterval, "watch-interval", watcher.DefaultInterval, "How often watched files are checked for changes")
 	cmd.Flags().BoolVar(&daemon, "daemon", false, "Run as background daemon (Phase 4)")
 	cmd.Flags().BoolVar(&driftDetect, "drift-detect", false, "Enable drift detection")
 	cmd.Flags().DurationVar(&driftInterval, "drift-interval", 30*time.Second, "Drift detection interval")
 	cmd.Flags().BoolVar(&driftAutoHeal, "drift-auto-heal", false, "Automatically heal detected drift")
 	cmd.Flags().StringVar(&driftWebhook, "drift-webhook", "", "Webhook URL for drift notifications")
-	cmd.Flags().StringVarP(&file, "file", "f", "helmfile.yaml", "Path to helmfile")
+	cmd.Flags().StringArrayVarP(&files, "file", "f", []string{"helmfile.yaml"}, helmfileFlagUsage)
 	cmd.Flags().StringVarP(&environment, "environment", "e", "", "Environment name")
 	cmd.Flags().StringSliceVarP(&selectors, "selector", "l", nil, "Label selectors")
-	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Default namespace")
-	cmd.Flags().StringVar(&kubeContext, "kube-context", "", "Kubernetes context")
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Namespace of every release, over the helmfile's")
+	cmd.Flags().StringVar(&kubeContext, "kube-context", "", "Kubernetes context of every release, over the helmfile's")
 	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Simulate sync without making changes")
+	cmd.Flags().DurationVar(&timeout, "timeout", 0, "Overall deadline for the sync run (0 = no limit)")
+	cmd.Flags().StringVar(&helmBinary, "helm-binary", "", "Path to helm binary (default: $"+preflight.EnvHelmBinary+" or helm on PATH)")
+	cmd.Flags().BoolVar(&prune, "prune", false, "Uninstall releases in target namespaces that are not defined in the helmfile")
+	cmd.Flags().BoolVar(&pruneRepos, "prune-repos", false, "Remove helm repositories helmfire added that are no longer defined in the helmfile")
+	cmd.Flags().BoolVar(&driftOrphans, "drift-orphans", false, "Report releases not defined in the helmfile during drift detection")
+	cmd.Flags().Float64Var(&driftJitter, "drift-jitter", 0, "Randomize each drift check interval by up to this fraction (0-1)")
+	cmd.Flags().BoolVar(&driftStagger, "drift-stagger", false, "Spread drift checks of releases evenly across the interval")
+	cmd.Flags().DurationVar(&driftFlap, "drift-flap-window", 0, "How long drift must stay gone before it is notified as resolved")
+	cmd.Flags().IntVar(&driftContext, "drift-context-lines", 0, "Unchanged lines shown around changes in drift diffs (0 shows whole resources)")
+	cmd.Flags().IntVar(&driftWorkers, "drift-workers", drift.DefaultWorkers, "How many releases are diffed at once during drift checks")
+	cmd.Flags().BoolVar(&driftPrecheck, "drift-precheck", true, "Diff only releases whose manifest stored by helm differs from the one rendered locally")
+	cmd.Flags().IntVar(&renderCache, "render-cache-size", rendercache.DefaultSize, renderCacheUsage)
+	cmd.Flags().StringVar(&healSeverity, "drift-heal-max-severity", "", "Highest drift severity healed automatically (low, medium, high); higher severities await approval")
+	cmd.Flags().StringSliceVar(&healManualNS, "drift-heal-manual-namespaces", nil, "Namespaces whose drift always awaits approval")
+	cmd.Flags().StringArrayVar(&healWindows, "drift-heal-window", nil, healWindowUsage)
+	cmd.Flags().StringArrayVar(&healBlackouts, "drift-heal-blackout", nil, healBlackoutUsage)
+	cmd.Flags().BoolVar(&healPreview, "drift-heal-preview", false, "Dry-run each heal first and attach the predicted changes to the drift report")
+	cmd.Flags().BoolVar(&healGitOps, "drift-heal-gitops-managed", false, "Auto-heal releases whose resources ArgoCD or Flux also manage; by default their drift awaits approval")
+	cmd.Flags().BoolVar(&strict, "strict", false, "Reject the helmfile when it has unknown fields or mistyped values, and templates using missing keys (see helmfire lint)")
+	cmd.Flags().BoolVar(&showNotes, "show-notes", false, "Print the rendered NOTES.txt of each synced release after the summary")
+	cmd.Flags().BoolVar(&checkCluster, "check-cluster", false, "Before syncing, check the Kubernetes version and that the cluster serves every API version the rendered releases use")
+	cmd.Flags().StringVar(&minKube, "min-kube-version", sync.DefaultMinKubeVersion, "Oldest Kubernetes version --check-cluster accepts")
+	cmd.Flags().StringVar(&canary, "canary", "", "Sync this release, or this percentage of the releases running workloads (e.g. 25%), first and wait for it to be ready; a failed canary aborts the rest")
+	stamp.register(cmd)
+	cmd.Flags().StringVar(&resources, "resources-profile", "", resourcesProfileUsage)
+	policies.register(cmd)
+	namespaces.register(cmd)
+	deployStatus.register(cmd)
+	reportFile.register(cmd)
 
 	return cmd
 }
 
+// reportDeployStatus reports a sync run as the status of the git revision
+// of the helmfile at path. Failing to report doesn't fail the sync.
+func reportDeployStatus(config deploystatus.Config, path string, report *sync.Report) {
+	rev, err := deploystatus.DetectRevision(path)
+	if err != nil {
+		globalLogger.Warn("failed to detect the git revision of the helmfile, not reporting sync status", zap.Error(err))
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := deploystatus.New(config).Report(ctx, deploystatus.NewStatus(rev, report)); err != nil {
+		globalLogger.Warn("failed to report sync status", zap.Error(err))
+		return
+	}
+	globalLogger.Info("reported sync status", zap.String("commit", rev.Commit))
+}
+
+// pruneOrphans uninstalls releases that are not defined in the helmfile
+func pruneOrphans(ctx context.Context, executor *sync.Executor, orphans []helmstate.DeployedRelease) error {
+	for _, orphan := range orphans {
+		if err := executor.UninstallRelease(ctx, orphan.Name, orphan.Namespace, orphan.KubeContext); err != nil {
+			return fmt.Errorf("failed to prune release %s/%s: %w", orphan.Namespace, orphan.Name, err)
+		}
+		printf("✓ Pruned orphaned release %s/%s\n", orphan.Namespace, orphan.Name)
+	}
+
+	return nil
+}
+
+// helmfileFlagUsage describes the repeatable -f flag
+const helmfileFlagUsage = "Path to helmfile, or directory of *.yaml helmfiles (repeatable; merged in order)"
+
+// healWindowUsage and healBlackoutUsage describe the repeatable heal window
+// flags
+const (
+	healWindowUsage   = `Only auto-heal during this window: cron expression and duration, e.g. "CRON_TZ=Europe/Berlin 0 22 * * mon-fri 8h" (repeatable)`
+	healBlackoutUsage = `Never auto-heal during this window, e.g. a deploy freeze: cron expression and duration (repeatable)`
+)
+
+// renderCacheUsage describes the --render-cache-size flag
+const renderCacheUsage = "Chart renders kept for drift checks and syncs to reuse (0 disables the cache)"
+
+// addSubstitutionProviders registers the substitution providers of the
+// config file with globalSubstitutor
+func addSubstitutionProviders(cfg *config.Config) error {
+	providers, err := substitute.NewProviders(cfg.SubstitutionProviders)
+	if err != nil {
+		return fmt.Errorf("failed to configure substitution providers: %w", err)
+	}
+	for _, provider := range providers {
+		globalSubstitutor.AddProvider(provider)
+	}
+	return nil
+}
+
+// envOrDefault returns the environment variable, or def when unset
+func envOrDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// defaultLeaderIdentity identifies this daemon by pod name, falling back to the hostname
+func defaultLeaderIdentity() string {
+	if name := os.Getenv("POD_NAME"); name != "" {
+		return name
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
+// runPreflight locates helm and verifies its version, requiring helm-diff when
+// drift detection is enabled
+func runPreflight(helmBinary string, needDiff bool) (*preflight.Result, error) {
+	opts := preflight.Options{HelmBinary: helmBinary}
+	if needDiff {
+		opts.RequiredPlugins = append(opts.RequiredPlugins, preflight.PluginDiff)
+	}
+
+	result, err := preflight.Run(opts)
+	if err != nil {
+		return nil, fmt.Errorf("preflight check failed: %w", err)
+	}
+
+	globalLogger.Debug("helm preflight passed",
+		zap.String("binary", result.HelmBinary),
+		zap.String("version", result.HelmVersion))
+	return result, nil
+}
+
+// stampFlags configure the labels and annotations stamped on the resources
+// of synced releases
+type stampFlags struct {
+	managed     bool
+	labels      []string
+	annotations []string
+	restart     bool
+}
+
+func (f *stampFlags) register(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&f.managed, "stamp", false, "Label resources as managed by helmfire and annotate them with the sync ID and substituted images")
+	cmd.Flags().StringArrayVar(&f.labels, "stamp-label", nil, "Label added to every resource (key=value, repeatable)")
+	cmd.Flags().StringArrayVar(&f.annotations, "stamp-annotation", nil, "Annotation added to every resource (key=value, repeatable)")
+	cmd.Flags().BoolVar(&f.restart, "restart-on-substitution", false, "Annotate pod templates with a checksum of the release's image substitutions so workloads restart when they change")
+}
+
+func (f *stampFlags) stamp() (sync.Stamp, error) {
+	labels, err := sync.ParseStampValues(f.labels)
+	if err != nil {
+		return sync.Stamp{}, fmt.Errorf("invalid --stamp-label: %w", err)
+	}
+	annotations, err := sync.ParseStampValues(f.annotations)
+	if err != nil {
+		return sync.Stamp{}, fmt.Errorf("invalid --stamp-annotation: %w", err)
+	}
+	return sync.Stamp{Managed: f.managed, Labels: labels, Annotations: annotations, RestartOnSubstitution: f.restart}, nil
+}
+
+// projectStateDir is where the project in the working directory keeps its
+// state, beside its daemon files; none with the shared legacy ones
+func projectStateDir() string {
+	if defaultPaths.Dir == daemon.LegacyPaths.Dir {
+		return ""
+	}
+	return defaultPaths.Dir
+}
+
+// resourcesProfileUsage describes the --resources-profile flag
+const resourcesProfileUsage = "Scale down CPU and memory requests and limits and replicas of workloads to fit a laptop or kind cluster: dev (x0.1, 1 replica), small (x0.5) or a factor such as 0.25"
+
+// resourcesProfile parses --resources-profile, nil when not given
+func resourcesProfile(name string) (*sync.ResourceProfile, error) {
+	if name == "" {
+		return nil, nil
+	}
+	return sync.ParseResourceProfile(name)
+}
+
+// namespaceFlags configure how release namespaces are created and verified
+type namespaceFlags struct {
+	create bool
+	verify bool
+}
+
+func (f *namespaceFlags) register(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&f.create, "create-namespace", true, "Create release namespaces when missing, with the labels and annotations declared in the helmfile")
+	cmd.Flags().BoolVar(&f.verify, "verify-namespaces", false, "Fail releases whose namespace doesn't exist or lacks the labels declared in the helmfile")
+}
+
+// cloudEventFlags configure where the daemon sends its events
+type cloudEventFlags struct {
+	sink    string
+	subject string
+	source  string
+	types   []string
+}
+
+func (f *cloudEventFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.sink, "cloudevents-sink", "", "Send daemon events as CloudEvents to an http(s) URL, or to nats:// servers (comma-separated)")
+	cmd.Flags().StringVar(&f.subject, "cloudevents-subject", cloudevents.DefaultSubject, "NATS subject events are published to")
+	cmd.Flags().StringVar(&f.source, "cloudevents-source", "", "Source attribute of the events (default: /helmfire/<hostname>)")
+	cmd.Flags().StringSliceVar(&f.types, "cloudevents-types", nil, "Event types sent: sync, heal, drift, substitution, rollout, reload, pause, auth (default: all)")
+}
+
+// deployStatusFlags configure reporting syncs to GitHub or GitLab
+type deployStatusFlags struct {
+	enabled     bool
+	deployments bool
+	provider    string
+	repository  string
+	apiURL      string
+	environment string
+	logURL      string
+}
+
+func (f *deployStatusFlags) register(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&f.enabled, "report-status", false, "Report each sync as a commit status of the helmfile's git revision on GitHub or GitLab (token from $"+deploystatus.EnvGitHubToken+" or $"+deploystatus.EnvGitLabToken+")")
+	cmd.Flags().BoolVar(&f.deployments, "report-deployment", false, "Also record a deployment of the revision in the environment (implies --report-status)")
+	cmd.Flags().StringVar(&f.provider, "report-provider", "", "github or gitlab (default: detected from the origin remote)")
+	cmd.Flags().StringVar(&f.repository, "report-repo", "", "Repository owner/name, or GitLab project path (default: from the origin remote)")
+	cmd.Flags().StringVar(&f.apiURL, "report-api-url", "", "Base URL of the GitHub or GitLab API (default: from the origin remote's host)")
+	cmd.Flags().StringVar(&f.environment, "report-environment", "", "Environment the statuses and deployments are named after (default: --environment, or "+deploystatus.DefaultEnvironment+")")
+	cmd.Flags().StringVar(&f.logURL, "report-log-url", "", "URL linked from the statuses; {syncId} is replaced by the sync run's ID")
+}
+
+// config returns the reporting configuration, or nil when reporting is off
+func (f *deployStatusFlags) config(environment string) (*deploystatus.Config, error) {
+	if !f.enabled && !f.deployments {
+		return nil, nil
+	}
+	config := &deploystatus.Config{
+		Repository:  f.repository,
+		APIURL:      f.apiURL,
+		Environment: f.environment,
+		LogURL:      f.logURL,
+		Deployments: f.deployments,
+	}
+	if f.provider != "" {
+		provider, err := deploystatus.ParseProvider(f.provider)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --report-provider: %w", err)
+		}
+		config.Provider = provider
+	}
+	if config.Environment == "" {
+		config.Environment = environment
+	}
+	return config, nil
+}
+
+// reportFileFlags configure exporting results to a file for CI
+type reportFileFlags struct {
+	format string
+	file   string
+}
+
+func (f *reportFileFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.format, "report-format", "", "Export the results as json, junit, sarif or markdown (default: from the --report-file extension)")
+	cmd.Flags().StringVar(&f.file, "report-file", "", "File the results are exported to, such as $GITHUB_STEP_SUMMARY (default: stdout when --report-format is set)")
+}
+
+// exporter returns the format and file results are exported to, with
+// false when neither flag is set
+func (f *reportFileFlags) exporter() (reportformat.Format, string, bool, error) {
+	if f.format == "" && f.file == "" {
+		return "", "", false, nil
+	}
+	format, err := reportformat.ParseFormat(f.format, f.file)
+	if err != nil {
+		return "", "", false, fmt.Errorf("invalid --report-format: %w", err)
+	}
+	file := f.file
+	if file == "" {
+		file = "-"
+	}
+	return format, file, true, nil
+}
+
+// write exports results when asked to
+func (f *reportFileFlags) write(results reportformat.Results) error {
+	format, file, ok, err := f.exporter()
+	if !ok || err != nil {
+		return err
+	}
+	return reportformat.WriteFile(file, format, results)
+}
+
+// policyFlags configure the policies rendered manifests are checked against
+type policyFlags struct {
+	dir    string
+	mode   string
+	binary string
+}
+
+func (f *policyFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.dir, "policy-dir", "", "Directory of Rego policies (package "+policy.Package+") checked against rendered manifests")
+	cmd.Flags().StringVar(&f.mode, "policy-mode", string(policy.ModeEnforce), "What deny rules do: enforce blocks the release, warn only reports")
+	cmd.Flags().StringVar(&f.binary, "opa-binary", policy.DefaultBinary, "Path to the opa binary that evaluates policies")
+}
+
+func (f *policyFlags) checker() (policy.Checker, error) {
+	mode, err := policy.ParseMode(f.mode)
+	if err != nil {
+		return policy.Checker{}, err
+	}
+	if f.dir != "" {
+		if info, err := os.Stat(f.dir); err != nil || !info.IsDir() {
+			return policy.Checker{}, fmt.Errorf("invalid --policy-dir: %s is not a directory", f.dir)
+		}
+	}
+	return policy.Checker{Dir: f.dir, Mode: mode, Binary: f.binary}, nil
+}
+
+// printSyncPlan prints the namespace and kube context each release is
+// synced to, as resolved from the helmfile and the flags
+func printSyncPlan(releases []helmstate.Release, executor *sync.Executor) {
+	if len(releases) == 0 {
+		return
+	}
+
+	printLine("Sync plan:")
+	for _, release := range releases {
+		printf("  · %s: %s\n", release.Name, releaseTarget(executor.ReleaseNamespace(release), executor.ReleaseKubeContext(release)))
+	}
+}
+
+// printSyncReport prints a per-release summary of a sync run
+func printSyncReport(report *sync.Report) {
+	if len(report.Results) == 0 {
+		return
+	}
+
+	printLine("\nSync summary:")
+	for _, result := range report.Results {
+		switch result.Status {
+		case sync.ReleaseStatusSucceeded:
+			if helm := result.Helm; helm != nil && helm.Revision > 0 {
+				printf("  ✓ %s: revision %d, %s (%s)\n", result.Name, helm.Revision, helm.Status, result.Duration.Round(time.Millisecond))
+			} else {
+				printf("  ✓ %s (%s)\n", result.Name, result.Duration.Round(time.Millisecond))
+			}
+		case sync.ReleaseStatusTimedOut:
+			printf("  ⏱ %s: timed out after %s\n", result.Name, result.Duration.Round(time.Millisecond))
+		case sync.ReleaseStatusSkipped:
+			printf("  - %s: skipped (%s)\n", result.Name, result.Error)
+		default:
+			printf("  ✗ %s: %s\n", result.Name, result.Error)
+		}
+		if result.Helm != nil {
+			printTestResults(result.Helm.Tests)
+		}
+	}
+	printf("Completed in %s\n", report.Duration.Round(time.Millisecond))
+}
+
+// printTestResults prints the smoke tests of a release under it, with the
+// logs of those that failed
+func printTestResults(tests []sync.TestResult) {
+	for _, test := range tests {
+		if test.Passed {
+			printf("      ✓ test %s (%s)\n", test.Name, test.Duration.Round(time.Millisecond))
+			continue
+		}
+		printf("      ✗ test %s: %s\n", test.Name, test.Error)
+		if test.Logs == "" {
+			continue
+		}
+		for _, line := range strings.Split(test.Logs, "\n") {
+			printLine(strings.TrimRight("          "+line, " "))
+		}
+	}
+}
+
+// printReleaseNotes prints the NOTES.txt of the synced releases of a report
+func printReleaseNotes(report *sync.Report) {
+	for _, result := range report.Results {
+		if result.Helm == nil || result.Helm.Notes == "" {
+			continue
+		}
+		printf("\nNotes of %s:\n", result.Name)
+		for _, line := range strings.Split(result.Helm.Notes, "\n") {
+			printLine(strings.TrimRight("  "+line, " "))
+		}
+	}
+}
+
 func newChartCmd() *cobra.Command {
 	var (
+		file          string
+		environment   string
+		helmBinary    string
+		strict        bool
+		release       string
+		namespace     string
+		ttl           time.Duration
 		daemonAPIAddr string
 		daemonPIDFile string
 	)
 
 	cmd := &cobra.Command{
-		Use:   "chart <original> <local-path>",
+		Use:   "chart <original> <local-path|archive|url|git-url>",
 		Short: "Substitute a chart with a local version",
-		Long: `Replace a remote chart reference with a local chart directory.
-
-The substitution applies to all releases using the original chart.
+		Long: `Replace a remote chart reference with a local chart directory, a packaged
+chart (.tgz), the https:// URL of a packaged chart, or a chart in a git
+repository given as git::<repo>[//<path>][?ref=<ref>].
+Chart URLs are downloaded into ~/.helmfire/cache/charts when added.
+Git charts are cloned into ~/.helmfire/cache/git and updated to the latest
+commit of the ref on every sync.
+
+The substitution applies to all releases using the original chart, or only
+to those matching --release and --namespace. A scoped substitution takes
+precedence over a global one.
 Run 'helmfire sync' after adding substitutions to apply them.
 
+The substituted Chart.yaml is checked against the chart it replaces: a
+different name or apiVersion, or a version outside the version: constraint
+of a release in the helmfile, is reported as a warning. With --strict, the
+substitution is rejected instead.
+
 If a daemon is running, the substitution will be sent to the daemon via API.
 
 Examples:
@@ -254,49 +951,134 @@ Examples:
   # Replace with absolute path
   helmfire chart stable/mysql /home/user/charts/mysql
 
+  # Replace with a packaged chart
+  helmfire chart bitnami/nginx ./dist/nginx-15.0.0-dev.tgz
+  helmfire chart bitnami/nginx https://ci.example.com/artifacts/nginx-15.0.0-dev.tgz
+
+  # Replace with a chart from a git branch
+  helmfire chart bitnami/nginx git::https://github.com/org/charts//charts/nginx?ref=feature-x
+
+  # Fail instead of warning when the chart doesn't match
+  helmfire chart bitnami/postgresql ./charts/postgresql --strict
+
+  # Only substitute the chart for the my-db release
+  helmfire chart bitnami/postgresql ./charts/postgresql --release my-db
+
+  # Expire the substitution after 2 hours
+  helmfire chart bitnami/postgresql ./charts/postgresql --ttl 2h
+
   # Add to running daemon
   helmfire chart bitnami/postgresql ./charts/postgresql --daemon-api-addr=127.0.0.1:8080`,
 		Args: cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			original := args[0]
 			localPath := args[1]
+			scope := substitute.Scope{Release: release, Namespace: namespace}
 
 			// Check if daemon is running
 			if running, _ := daemon.IsDaemonRunning(daemonPIDFile); running {
 				// Send to daemon API
 				client := daemon.NewAPIClient(daemonAPIAddr)
-				if err := client.AddChartSubstitution(original, localPath); err != nil {
+				warnings, err := client.AddChartSubstitution(original, localPath, scope, ttl, strict)
+				if err != nil {
 					return fmt.Errorf("failed to add chart substitution via daemon: %w", err)
 				}
+				printChartWarnings(warnings)
 
-				fmt.Printf("✓ Chart substitution added to daemon: %s → %s\n", original, localPath)
+				printf("✓ Chart substitution added to daemon: %s → %s\n", original, localPath)
 				return nil
 			}
 
 			// Add locally
-			if err := globalSubstitutor.AddChartSubstitution(original, localPath); err != nil {
+			if err := globalSubstitutor.AddScopedChartSubstitution(original, localPath, scope); err != nil {
 				return fmt.Errorf("failed to add chart substitution: %w", err)
 			}
 
+			warnings, err := checkChartSubstitution(original, scope, file, environment, helmBinary)
+			if err != nil {
+				globalSubstitutor.RemoveScopedChartSubstitution(original, scope)
+				return err
+			}
+			printChartWarnings(warnings)
+			if strict && len(warnings) > 0 {
+				globalSubstitutor.RemoveScopedChartSubstitution(original, scope)
+				return fmt.Errorf("chart substitution rejected: %d compatibility warning(s)", len(warnings))
+			}
+			globalSubstitutor.SetChartTTL(original, scope, ttl)
+
 			globalLogger.Info("chart substitution added",
 				zap.String("original", original),
 				zap.String("local", localPath))
-
-			fmt.Printf("✓ Chart substitution added: %s → %s\n", original, localPath)
-			fmt.Println("Run 'helmfire sync' to apply the substitution")
+			recordAudit(audit.Entry{
+				Action:    audit.ActionAdd,
+				Kind:      audit.KindChart,
+				Original:  original,
+				Target:    localPath,
+				Release:   scope.Release,
+				Namespace: scope.Namespace,
+			})
+
+			printf("✓ Chart substitution added: %s → %s\n", original, localPath)
+			printLine("Run 'helmfire sync' to apply the substitution")
 
 			return nil
 		},
 	}
 
+	cmd.Flags().StringVarP(&file, "file", "f", "helmfile.yaml", "Helmfile with the releases whose version constraints are checked")
+	cmd.Flags().StringVarP(&environment, "environment", "e", "", "Environment name")
+	cmd.Flags().StringVar(&helmBinary, "helm-binary", "helm", "Path to helm binary")
+	cmd.Flags().BoolVar(&strict, "strict", false, "Reject the substitution when the chart looks incompatible")
+	cmd.Flags().StringVar(&release, "release", "", "Only substitute the chart for this release")
+	cmd.Flags().StringVar(&namespace, "namespace", "", "Only substitute the chart for releases in this namespace")
+	cmd.Flags().DurationVar(&ttl, "ttl", 0, "Expire the substitution after this duration (e.g. 2h)")
 	cmd.Flags().StringVar(&daemonAPIAddr, "daemon-api-addr", daemon.DefaultAPIAddr, "Daemon API address")
-	cmd.Flags().StringVar(&daemonPIDFile, "daemon-pid-file", daemon.DefaultPIDFile, "Daemon PID file")
+	cmd.Flags().StringVar(&daemonPIDFile, "daemon-pid-file", defaultPaths.PIDFile, "Daemon PID file")
 
 	return cmd
 }
 
+// namespaceTemplate returns the template --namespace-suffix or
+// --namespace-template rewrites release namespaces with, "" for none
+func namespaceTemplate() string {
+	if globalNamespaceSuffix != "" {
+		return helmstate.NamespaceSuffixTemplate(globalNamespaceSuffix)
+	}
+	return globalNamespaceTemplate
+}
+
+// checkChartSubstitution checks a chart substitution against the chart it
+// replaces and the releases in the helmfile, when the helmfile exists locally
+func checkChartSubstitution(original string, scope substitute.Scope, file, environment, helmBinary string) ([]string, error) {
+	var releases []helmstate.Release
+	if _, err := os.Stat(file); err == nil {
+		manager := helmstate.NewManager(file, environment)
+		manager.HelmBinary = helmBinary
+		manager.NamespaceTemplate = namespaceTemplate()
+		manager.ReleasePrefix = globalReleasePrefix
+		if err := manager.Load(); err != nil {
+			return nil, fmt.Errorf("failed to load helmfile: %w", err)
+		}
+		releases = manager.GetReleases()
+	}
+
+	executor := sync.NewExecutor(globalLogger, globalSubstitutor)
+	executor.SetHelmBinary(helmBinary)
+	return executor.CheckChartSubstitution(context.Background(), original, scope, releases)
+}
+
+// printChartWarnings prints chart substitution compatibility warnings
+func printChartWarnings(warnings []string) {
+	for _, warning := range warnings {
+		printf("⚠️  %s\n", warning)
+	}
+}
+
 func newImageCmd() *cobra.Command {
 	var (
+		release       string
+		namespace     string
+		ttl           time.Duration
 		daemonAPIAddr string
 		daemonPIDFile string
 	)
@@ -304,7 +1086,9 @@ func newImageCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "image <original> <replacement>",
 		Short: "Substitute a container image",
-		Long: `Replace a container image reference across all releases.
+		Long: `Replace a container image reference across all releases, or only in
+releases matching --release and --namespace. A scoped substitution takes
+precedence over a global one.
 
 The substitution is applied during manifest rendering via post-renderer.
 Run 'helmfire sync' after adding substitutions to apply them.
@@ -318,66 +1102,117 @@ Examples:
   # Replace nginx with custom registry
   helmfire image nginx:1.21 myregistry.io/nginx:custom
 
+  # Only replace the image in the my-db release
+  helmfire image postgres:15 local/pg:dev --release my-db
+
+  # Expire the substitution after 2 hours
+  helmfire image postgres:15 local/pg:dev --ttl 2h
+
   # Add to running daemon
   helmfire image postgres:15 localhost:5000/postgres:dev --daemon-api-addr=127.0.0.1:8080`,
 		Args: cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			original := args[0]
 			replacement := args[1]
+			scope := substitute.Scope{Release: release, Namespace: namespace}
 
 			// Check if daemon is running
 			if running, _ := daemon.IsDaemonRunning(daemonPIDFile); running {
 				// Send to daemon API
 				client := daemon.NewAPIClient(daemonAPIAddr)
-				if err := client.AddImageSubstitution(original, replacement); err != nil {
+				if err := client.AddImageSubstitution(original, replacement, scope, ttl); err != nil {
 					return fmt.Errorf("failed to add image substitution via daemon: %w", err)
 				}
 
-				fmt.Printf("✓ Image substitution added to daemon: %s → %s\n", original, replacement)
+				printf("✓ Image substitution added to daemon: %s → %s\n", original, replacement)
 				return nil
 			}
 
 			// Add locally
-			if err := globalSubstitutor.AddImageSubstitution(original, replacement); err != nil {
+			if err := globalSubstitutor.AddScopedImageSubstitution(original, replacement, scope); err != nil {
 				return fmt.Errorf("failed to add image substitution: %w", err)
 			}
+			globalSubstitutor.SetImageTTL(original, scope, ttl)
 
 			globalLogger.Info("image substitution added",
 				zap.String("original", original),
 				zap.String("replacement", replacement))
-
-			fmt.Printf("✓ Image substitution added: %s → %s\n", original, replacement)
-			fmt.Println("Run 'helmfire sync' to apply the substitution")
+			recordAudit(audit.Entry{
+				Action:    audit.ActionAdd,
+				Kind:      audit.KindImage,
+				Original:  original,
+				Target:    replacement,
+				Release:   scope.Release,
+				Namespace: scope.Namespace,
+			})
+
+			printf("✓ Image substitution added: %s → %s\n", original, replacement)
+			printLine("Run 'helmfire sync' to apply the substitution")
 
 			return nil
 		},
 	}
 
+	cmd.Flags().StringVar(&release, "release", "", "Only substitute the image in this release")
+	cmd.Flags().StringVar(&namespace, "namespace", "", "Only substitute the image in releases in this namespace")
+	cmd.Flags().DurationVar(&ttl, "ttl", 0, "Expire the substitution after this duration (e.g. 2h)")
 	cmd.Flags().StringVar(&daemonAPIAddr, "daemon-api-addr", daemon.DefaultAPIAddr, "Daemon API address")
-	cmd.Flags().StringVar(&daemonPIDFile, "daemon-pid-file", daemon.DefaultPIDFile, "Daemon PID file")
+	cmd.Flags().StringVar(&daemonPIDFile, "daemon-pid-file", defaultPaths.PIDFile, "Daemon PID file")
 
 	return cmd
 }
 
 func newListCmd() *cobra.Command {
+	var (
+		daemonAPIAddr string
+		daemonPIDFile string
+		history       bool
+		limit         int
+	)
+
 	cmd := &cobra.Command{
 		Use:   "list",
-		Short: "List active substitutions",
+		Short: "List active substitutions or the helmfile's releases",
+		Long: `List active substitutions. If a daemon is running, its substitutions are
+listed, including the time left on substitutions added with --ttl.
+
+With --history, the audit log of who added, removed or expired substitutions,
+when and how (CLI, API or daemon) is listed instead.
+
+list releases lists the helmfile's releases and whether they are enabled in
+the environment.`,
 	}
 
+	cmd.PersistentFlags().StringVar(&daemonAPIAddr, "daemon-api-addr", daemon.DefaultAPIAddr, "Daemon API address")
+	cmd.PersistentFlags().StringVar(&daemonPIDFile, "daemon-pid-file", defaultPaths.PIDFile, "Daemon PID file")
+	cmd.PersistentFlags().BoolVar(&history, "history", false, "List the audit log instead of active substitutions")
+	cmd.PersistentFlags().IntVar(&limit, "limit", 0, "Only list the most recent audit log entries (with --history)")
+
 	cmd.AddCommand(&cobra.Command{
 		Use:   "charts",
 		Short: "List chart substitutions",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			subs := globalSubstitutor.ListChartSubstitutions()
-			if len(subs) == 0 {
-				fmt.Println("No chart substitutions active")
+			if history {
+				return printAuditHistory(audit.Filter{Kind: audit.KindChart, Limit: limit}, daemonAPIAddr, daemonPIDFile)
+			}
+
+			subs, err := listSubstitutions(daemonAPIAddr, daemonPIDFile)
+			if err != nil {
+				return err
+			}
+			if len(subs.Charts) == 0 {
+				printLine("No chart substitutions active")
 				return nil
 			}
 
-			fmt.Println("Active chart substitutions:")
-			for _, sub := range subs {
-				fmt.Printf("  %s → %s\n", sub.Original, sub.LocalPath)
+			printLine("Active chart substitutions:")
+			for _, sub := range subs.Charts {
+				suffix := substitutionSuffix(sub.Release, sub.Namespace, sub.ExpiresAt)
+				if sub.Source != "" {
+					printf("  %s → %s (%s)%s\n", sub.Original, sub.Source, sub.LocalPath, suffix)
+					continue
+				}
+				printf("  %s → %s%s\n", sub.Original, sub.LocalPath, suffix)
 			}
 			return nil
 		},
@@ -387,58 +1222,300 @@ func newListCmd() *cobra.Command {
 		Use:   "images",
 		Short: "List image substitutions",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			subs := globalSubstitutor.ListImageSubstitutions()
-			if len(subs) == 0 {
-				fmt.Println("No image substitutions active")
+			if history {
+				return printAuditHistory(audit.Filter{Kind: audit.KindImage, Limit: limit}, daemonAPIAddr, daemonPIDFile)
+			}
+
+			subs, err := listSubstitutions(daemonAPIAddr, daemonPIDFile)
+			if err != nil {
+				return err
+			}
+			if len(subs.Images) == 0 {
+				printLine("No image substitutions active")
 				return nil
 			}
 
-			fmt.Println("Active image substitutions:")
-			for _, sub := range subs {
-				fmt.Printf("  %s → %s\n", sub.Original, sub.Replacement)
+			printLine("Active image substitutions:")
+			for _, sub := range subs.Images {
+				printf("  %s → %s%s\n", sub.Original, sub.Replacement, substitutionSuffix(sub.Release, sub.Namespace, sub.ExpiresAt))
 			}
 			return nil
 		},
 	})
 
+	cmd.AddCommand(newListReleasesCmd())
+
 	return cmd
 }
 
+// listSubstitutions returns the daemon's substitutions if it is running,
+// otherwise the local ones
+func listSubstitutions(daemonAPIAddr, daemonPIDFile string) (*daemon.SubstitutionsResponse, error) {
+	if running, _ := daemon.IsDaemonRunning(daemonPIDFile); running {
+		subs, err := daemon.NewAPIClient(daemonAPIAddr).GetSubstitutions()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list substitutions via daemon: %w", err)
+		}
+		return subs, nil
+	}
+
+	subs := daemon.NewSubstitutionsResponse(globalSubstitutor)
+	return &subs, nil
+}
+
+// printAuditHistory prints the daemon's audit log if it is running,
+// otherwise the local one
+func printAuditHistory(filter audit.Filter, daemonAPIAddr, daemonPIDFile string) error {
+	var entries []audit.Entry
+	if running, _ := daemon.IsDaemonRunning(daemonPIDFile); running {
+		var err error
+		entries, err = daemon.NewAPIClient(daemonAPIAddr).GetAudit(filter)
+		if err != nil {
+			return fmt.Errorf("failed to read audit log via daemon: %w", err)
+		}
+	} else {
+		var err error
+		entries, err = audit.NewLog(globalAuditLog).Entries(filter)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(entries) == 0 {
+		printf("No %s substitution history\n", filter.Kind)
+		return nil
+	}
+
+	for _, e := range entries {
+		line := fmt.Sprintf("  %s  %-6s %s", e.Time.Local().Format(time.RFC3339), e.Action, e.Original)
+		if e.Target != "" {
+			line += " → " + e.Target
+		}
+		line += substitutionSuffix(e.Release, e.Namespace, nil)
+
+		by := e.Via
+		if e.User != "" {
+			by += " by " + e.User
+		}
+		if e.RemoteAddr != "" {
+			by += " from " + e.RemoteAddr
+		}
+		printf("%s (%s)\n", line, by)
+	}
+	return nil
+}
+
+// recordAudit records a substitution change made from the CLI; the change
+// has already happened, so a failure is only logged
+func recordAudit(entry audit.Entry) {
+	entry.Via = audit.ViaCLI
+	entry.User = audit.CurrentUser()
+	if err := audit.NewLog(globalAuditLog).Record(entry); err != nil {
+		globalLogger.Warn("failed to record audit entry", zap.Error(err))
+	}
+}
+
+// substitutionSuffix describes the scope and remaining TTL of a substitution in listings
+func substitutionSuffix(release, namespace string, expiresAt *time.Time) string {
+	suffix := ""
+	if scope := (substitute.Scope{Release: release, Namespace: namespace}); !scope.IsGlobal() {
+		suffix += " [" + scope.String() + "]"
+	}
+	if expiresAt != nil {
+		suffix += fmt.Sprintf(" (expires in %s)", time.Until(*expiresAt).Round(time.Second))
+	}
+	return suffix
+}
+
 func newRemoveCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "remove",
 		Short: "Remove substitutions",
 	}
 
-	cmd.AddCommand(&cobra.Command{
+	var chartScope substitute.Scope
+	chartCmd := &cobra.Command{
 		Use:   "chart <original>",
 		Short: "Remove chart substitution",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			original := args[0]
-			if err := globalSubstitutor.RemoveChartSubstitution(original); err != nil {
+			if err := globalSubstitutor.RemoveScopedChartSubstitution(original, chartScope); err != nil {
 				return err
 			}
-
-			fmt.Printf("✓ Chart substitution removed: %s\n", original)
+			recordAudit(audit.Entry{
+				Action:    audit.ActionRemove,
+				Kind:      audit.KindChart,
+				Original:  original,
+				Release:   chartScope.Release,
+				Namespace: chartScope.Namespace,
+			})
+
+			printf("✓ Chart substitution removed: %s\n", original)
 			return nil
 		},
-	})
+	}
+	chartCmd.Flags().StringVar(&chartScope.Release, "release", "", "Remove the substitution scoped to this release")
+	chartCmd.Flags().StringVar(&chartScope.Namespace, "namespace", "", "Remove the substitution scoped to this namespace")
+	cmd.AddCommand(chartCmd)
 
-	cmd.AddCommand(&cobra.Command{
+	var imageScope substitute.Scope
+	imageCmd := &cobra.Command{
 		Use:   "image <original>",
 		Short: "Remove image substitution",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			original := args[0]
-			if err := globalSubstitutor.RemoveImageSubstitution(original); err != nil {
+			if err := globalSubstitutor.RemoveScopedImageSubstitution(original, imageScope); err != nil {
+				return err
+			}
+			recordAudit(audit.Entry{
+				Action:    audit.ActionRemove,
+				Kind:      audit.KindImage,
+				Original:  original,
+				Release:   imageScope.Release,
+				Namespace: imageScope.Namespace,
+			})
+
+			printf("✓ Image substitution removed: %s\n", original)
+			return nil
+		},
+	}
+	imageCmd.Flags().StringVar(&imageScope.Release, "release", "", "Remove the substitution scoped to this release")
+	imageCmd.Flags().StringVar(&imageScope.Namespace, "namespace", "", "Remove the substitution scoped to this namespace")
+	cmd.AddCommand(imageCmd)
+
+	return cmd
+}
+
+func newExportCmd() *cobra.Command {
+	var (
+		output        string
+		daemonAPIAddr string
+		daemonPIDFile string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export substitutions to YAML",
+		Long: `Write all chart and image substitutions as YAML, to share a dev setup or
+restore it later with 'helmfire import'. If a daemon is running, its
+substitutions are exported.
+
+Git charts are exported as their git:: URL, other charts as their local path.
+
+Examples:
+  helmfire export > subs.yaml
+  helmfire export -o subs.yaml`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var snapshot substitute.Snapshot
+			if running, _ := daemon.IsDaemonRunning(daemonPIDFile); running {
+				exported, err := daemon.NewAPIClient(daemonAPIAddr).ExportSubstitutions()
+				if err != nil {
+					return fmt.Errorf("failed to export substitutions via daemon: %w", err)
+				}
+				snapshot = *exported
+			} else {
+				snapshot = globalSubstitutor.Export()
+			}
+
+			data, err := yaml.Marshal(snapshot)
+			if err != nil {
+				return fmt.Errorf("failed to encode substitutions: %w", err)
+			}
+
+			if output == "" || output == "-" {
+				_, err = os.Stdout.Write(data)
 				return err
 			}
+			if err := os.WriteFile(output, data, 0644); err != nil {
+				return fmt.Errorf("failed to write %s: %w", output, err)
+			}
+			printf("✓ Exported %d chart and %d image substitutions to %s\n", len(snapshot.Charts), len(snapshot.Images), output)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write to this file instead of stdout")
+	cmd.Flags().StringVar(&daemonAPIAddr, "daemon-api-addr", daemon.DefaultAPIAddr, "Daemon API address")
+	cmd.Flags().StringVar(&daemonPIDFile, "daemon-pid-file", defaultPaths.PIDFile, "Daemon PID file")
+
+	return cmd
+}
+
+func newImportCmd() *cobra.Command {
+	var (
+		replace       bool
+		daemonAPIAddr string
+		daemonPIDFile string
+	)
 
-			fmt.Printf("✓ Image substitution removed: %s\n", original)
+	cmd := &cobra.Command{
+		Use:   "import <file|->",
+		Short: "Import substitutions from YAML",
+		Long: `Add the substitutions in a file written by 'helmfire export', or read from
+stdin with '-'. Substitutions of the same original and scope are replaced;
+with --replace, all existing substitutions are removed first. Substitutions
+whose TTL has already passed are skipped.
+
+If a daemon is running, the substitutions are imported into the daemon.
+
+Examples:
+  helmfire import subs.yaml
+  helmfire import --replace subs.yaml
+  cat subs.yaml | helmfire import -`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var (
+				data []byte
+				err  error
+			)
+			if args[0] == "-" {
+				data, err = io.ReadAll(os.Stdin)
+			} else {
+				data, err = os.ReadFile(args[0])
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read substitutions: %w", err)
+			}
+
+			snapshot, err := substitute.ParseSnapshot(data)
+			if err != nil {
+				return err
+			}
+
+			if running, _ := daemon.IsDaemonRunning(daemonPIDFile); running {
+				resp, err := daemon.NewAPIClient(daemonAPIAddr).ImportSubstitutions(snapshot, replace)
+				if err != nil {
+					return fmt.Errorf("failed to import substitutions via daemon: %w", err)
+				}
+				printf("✓ Imported %d chart and %d image substitutions into daemon\n", resp.Charts, resp.Images)
+				return nil
+			}
+
+			if replace {
+				for _, entry := range audit.SnapshotEntries(audit.ActionRemove, globalSubstitutor.Clear()) {
+					recordAudit(entry)
+				}
+			}
+			imported, err := globalSubstitutor.Import(snapshot, time.Now())
+			for _, entry := range audit.SnapshotEntries(audit.ActionAdd, imported) {
+				recordAudit(entry)
+			}
+			if err != nil {
+				return err
+			}
+
+			printf("✓ Imported %d chart and %d image substitutions\n", len(imported.Charts), len(imported.Images))
+			printLine("Run 'helmfire sync' to apply the substitutions")
 			return nil
 		},
-	})
+	}
+
+	cmd.Flags().BoolVar(&replace, "replace", false, "Remove existing substitutions before importing")
+	cmd.Flags().StringVar(&daemonAPIAddr, "daemon-api-addr", daemon.DefaultAPIAddr, "Daemon API address")
+	cmd.Flags().StringVar(&daemonPIDFile, "daemon-pid-file", defaultPaths.PIDFile, "Daemon PID file")
 
 	return cmd
 }
@@ -448,11 +1525,49 @@ func newDaemonCmd() *cobra.Command {
 		pidFile       string
 		logFile       string
 		apiAddr       string
-		file          string
+		files         []string
 		environment   string
 		driftInterval time.Duration
 		driftAutoHeal bool
 		driftWebhook  string
+		driftOrphans  bool
+		driftJitter   float64
+		driftStagger  bool
+		driftFlap     time.Duration
+		driftContext  int
+		driftWorkers  int
+		driftPrecheck bool
+		renderCache   int
+		prune         bool
+		helmBinary    string
+		healSeverity  string
+		healManualNS  []string
+		healWindows   []string
+		healBlackouts []string
+		healPreview   bool
+		healGitOps    bool
+		leaderElect   bool
+		leaderNS      string
+		leaderLease   string
+		leaderID      string
+		inCluster     bool
+		configMapRef  string
+		sourceEvery   time.Duration
+		resyncExpiry  bool
+		rateLimit     float64
+		rateBurst     int
+		corsOrigins   []string
+		accessFile    string
+		supervise     bool
+		stateFile     string
+		resetState    bool
+		stamp         stampFlags
+		resources     string
+		policies      policyFlags
+		namespaces    namespaceFlags
+		events        cloudEventFlags
+		deployStatus  deployStatusFlags
+		strict        bool
 	)
 
 	cmd := &cobra.Command{
@@ -484,25 +1599,205 @@ Examples:
   helmfire daemon start --drift-interval=1m --drift-auto-heal
 
   # Start with custom API address
-  helmfire daemon start --api-addr=:9090`,
+  helmfire daemon start --api-addr=:9090
+
+  # Back a browser dashboard, limiting each client to 10 requests/s
+  helmfire daemon start --api-cors-origin=http://localhost:3000 --api-rate-limit=10
+
+  # Restrict the API to the tokens of a policy file
+  helmfire daemon start --api-access-file=access.yaml
+
+  # Restart the daemon with backoff if it crashes
+  helmfire daemon start --supervise --drift-interval=5m
+
+  # Run in a pod, loading the helmfile from a ConfigMap
+  helmfire daemon start --in-cluster --helmfile-configmap=helmfire-helmfile --drift-interval=5m --drift-auto-heal
+
+  # Publish drift, sync, heal and substitution events to NATS as CloudEvents
+  helmfire daemon start --drift-interval=5m --cloudevents-sink=nats://nats:4222 --cloudevents-subject=platform.helmfire`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// Check if already running
+			cleanStalePIDFile(pidFile)
 			if running, _ := daemon.IsDaemonRunning(pidFile); running {
 				return fmt.Errorf("daemon already running")
 			}
 
-			config := daemon.DaemonConfig{
-				PIDFile:       pidFile,
-				LogFile:       logFile,
-				APIAddr:       apiAddr,
-				HelmfilePath:  file,
-				Environment:   environment,
-				DriftInterval: driftInterval,
-				DriftAutoHeal: driftAutoHeal,
-				DriftWebhook:  driftWebhook,
+			if resetState {
+				if err := daemon.ResetState(stateFile); err != nil {
+					return err
+				}
+			}
+
+			if supervise {
+				return superviseDaemon(logFile)
+			}
+
+			cfg, err := config.Load(globalConfigPath)
+			if err != nil {
+				return err
+			}
+			// The drift interval and webhook flags override the config file
+			driftSettings := func(cfg *config.Config) (time.Duration, string) {
+				interval, webhook := driftInterval, driftWebhook
+				if !cmd.Flags().Changed("drift-interval") {
+					interval = cfg.Drift.Interval
+				}
+				if webhook == "" {
+					webhook = cfg.Drift.Webhook
+				}
+				return interval, webhook
+			}
+			interval, _ := driftSettings(cfg)
+
+			policy, err := newHealPolicy(healSeverity, healManualNS, healWindows, healBlackouts)
+			if err != nil {
+				return err
+			}
+			policy.HealGitOpsManaged = healGitOps
+
+			resourceStamp, err := stamp.stamp()
+			if err != nil {
+				return err
+			}
+			profile, err := resourcesProfile(resources)
+			if err != nil {
+				return err
+			}
+			policyChecker, err := policies.checker()
+			if err != nil {
+				return err
+			}
+			statusConfig, err := deployStatus.config(environment)
+			if err != nil {
+				return err
+			}
+
+			helm, err := runPreflight(helmBinary, interval > 0)
+			if err != nil {
+				return err
+			}
+
+			if inCluster {
+				if !incluster.Detect() {
+					globalLogger.Warn("--in-cluster set but no service account found; helm and kubectl will use the local kubeconfig")
+				}
+				if !cmd.Flags().Changed("api-addr") {
+					apiAddr = incluster.DefaultAPIAddr
+				}
+				if !cmd.Flags().Changed("leader-elect-namespace") {
+					leaderNS = incluster.Namespace()
+				}
+			}
+
+			var source daemon.HelmfileSource
+			if gitsource.IsGitURL(files[0]) {
+				if configMapRef != "" {
+					return fmt.Errorf("--helmfile-configmap cannot be combined with a git helmfile")
+				}
+				if len(files) > 1 {
+					return fmt.Errorf("a git helmfile cannot be combined with other helmfiles")
+				}
+				gs, err := gitsource.ParseHelmfile(files[0])
+				if err != nil {
+					return err
+				}
+				source = gs
+			}
+			if configMapRef != "" {
+				namespace := "default"
+				if inCluster {
+					namespace = incluster.Namespace()
+				}
+				cm, err := incluster.ParseConfigMapRef(configMapRef, namespace)
+				if err != nil {
+					return err
+				}
+				source = cm
+			}
+
+			// newConfig also reloads the daemon's configuration, rereading
+			// the config file
+			newConfig := func() (daemon.DaemonConfig, error) {
+				cfg, err := config.Load(globalConfigPath)
+				if err != nil {
+					return daemon.DaemonConfig{}, err
+				}
+				interval, webhook := driftSettings(cfg)
+				var access *daemon.AccessPolicy
+				if accessFile != "" {
+					if access, err = daemon.LoadAccessPolicy(accessFile); err != nil {
+						return daemon.DaemonConfig{}, err
+					}
+				}
+				return daemon.DaemonConfig{
+					PIDFile:              pidFile,
+					LogFile:              logFile,
+					APIAddr:              apiAddr,
+					HelmfilePath:         files[0],
+					ExtraPaths:           append(slices.Clone(files[1:]), cfg.Watch.Paths...),
+					Environment:          environment,
+					DriftInterval:        interval,
+					DriftAutoHeal:        driftAutoHeal,
+					DriftWebhook:         webhook,
+					DriftOrphans:         driftOrphans,
+					DriftJitter:          driftJitter,
+					DriftStagger:         driftStagger,
+					DriftFlap:            driftFlap,
+					DriftContext:         driftContext,
+					DriftWorkers:         driftWorkers,
+					RenderCacheSize:      renderCache,
+					OfflineCharts:        offlineCharts(),
+					NamespaceTemplate:    namespaceTemplate(),
+					ReleasePrefix:        globalReleasePrefix,
+					DisableDriftPrecheck: !driftPrecheck,
+					HealPolicy:           policy,
+					HealPreview:          healPreview,
+					Prune:                prune,
+					HelmBinary:           helm.HelmBinary,
+					Notifiers:            cfg.Notifiers,
+
+					SubstitutionProviders: cfg.SubstitutionProviders,
+
+					LeaderElection:          leaderElect,
+					LeaderElectionNamespace: leaderNS,
+					LeaderElectionLease:     leaderLease,
+					LeaderElectionIdentity:  leaderID,
+					HelmfileSource:          source,
+					SourceInterval:          sourceEvery,
+					ResyncOnExpiry:          resyncExpiry,
+					AuditLogFile:            globalAuditLog,
+					APIRateLimit:            rateLimit,
+					APIRateBurst:            rateBurst,
+					APICORSOrigins:          corsOrigins,
+					APIAccess:               access,
+					StateFile:               stateFile,
+					Stamp:                   resourceStamp,
+					ResourceProfile:         profile,
+					StrictHelmfile:          strict,
+					Policy:                  policyChecker,
+					DisableCreateNamespace:  !namespaces.create,
+					VerifyNamespaces:        namespaces.verify,
+					CloudEventsSink:         events.sink,
+					CloudEventsSubject:      events.subject,
+					CloudEventsSource:       events.source,
+					CloudEventsTypes:        events.types,
+					DeployStatus:            statusConfig,
+				}, nil
+			}
+			daemonConfig, err := newConfig()
+			if err != nil {
+				return err
+			}
+			daemonConfig.Restarts, daemonConfig.Supervised = daemon.SupervisedRestarts()
+			daemonConfig.Reload = newConfig
+			if daemonConfig.Command, err = daemonCommand(); err != nil {
+				return err
+			}
+			if daemonConfig.Supervised {
+				daemonConfig.Command = append(daemonConfig.Command, "--supervise")
 			}
 
-			d, err := daemon.NewDaemon(config, globalLogger)
+			d, err := daemon.NewDaemon(daemonConfig, globalLogger)
 			if err != nil {
 				return fmt.Errorf("failed to create daemon: %w", err)
 			}
@@ -511,28 +1806,66 @@ Examples:
 				return fmt.Errorf("failed to start daemon: %w", err)
 			}
 
-			fmt.Println("✓ Daemon started")
-			fmt.Printf("  PID file: %s\n", pidFile)
-			fmt.Printf("  Log file: %s\n", logFile)
-			fmt.Printf("  API: http://%s\n", apiAddr)
-			if driftInterval > 0 {
-				fmt.Printf("  Drift detection: enabled (interval: %s)\n", driftInterval)
+			printLine("✓ Daemon started")
+			printf("  PID file: %s\n", pidFile)
+			printf("  Log file: %s\n", logFile)
+			printf("  API: http://%s\n", apiAddr)
+			if daemonConfig.DriftInterval > 0 {
+				printf("  Drift detection: enabled (interval: %s)\n", daemonConfig.DriftInterval)
 			}
-			fmt.Println("\nUse 'helmfire daemon stop' to stop the daemon")
+			printLine("\nUse 'helmfire daemon stop' to stop the daemon")
 
 			// Wait for daemon to exit
 			return d.Wait()
 		},
 	}
 
-	startCmd.Flags().StringVar(&pidFile, "pid-file", daemon.DefaultPIDFile, "PID file path")
-	startCmd.Flags().StringVar(&logFile, "log-file", daemon.DefaultLogFile, "Log file path")
+	startCmd.Flags().StringVar(&pidFile, "pid-file", defaultPaths.PIDFile, "PID file path")
+	startCmd.Flags().StringVar(&logFile, "log-file", defaultPaths.LogFile, "Log file path")
 	startCmd.Flags().StringVar(&apiAddr, "api-addr", daemon.DefaultAPIAddr, "API server address")
-	startCmd.Flags().StringVarP(&file, "file", "f", "helmfile.yaml", "Path to helmfile")
+	startCmd.Flags().Float64Var(&rateLimit, "api-rate-limit", 0, "Requests per second allowed per API client (0 = unlimited)")
+	startCmd.Flags().IntVar(&rateBurst, "api-rate-burst", 0, "Request burst allowed per API client (default: the rate limit, rounded up)")
+	startCmd.Flags().StringSliceVar(&corsOrigins, "api-cors-origin", nil, "Browser origin allowed to call the API (repeatable, * for any)")
+	startCmd.Flags().StringVar(&accessFile, "api-access-file", "", "YAML file mapping API tokens to the releases and namespaces their callers may change (reread on reload)")
+	startCmd.Flags().StringArrayVarP(&files, "file", "f", []string{"helmfile.yaml"}, helmfileFlagUsage)
 	startCmd.Flags().StringVarP(&environment, "environment", "e", "", "Environment name")
 	startCmd.Flags().DurationVar(&driftInterval, "drift-interval", 0, "Drift detection interval (0 = disabled)")
 	startCmd.Flags().BoolVar(&driftAutoHeal, "drift-auto-heal", false, "Automatically heal detected drift")
 	startCmd.Flags().StringVar(&driftWebhook, "drift-webhook", "", "Webhook URL for drift notifications")
+	startCmd.Flags().BoolVar(&driftOrphans, "drift-orphans", false, "Report releases not defined in the helmfile during drift detection")
+	startCmd.Flags().Float64Var(&driftJitter, "drift-jitter", 0, "Randomize each drift check interval by up to this fraction (0-1)")
+	startCmd.Flags().BoolVar(&driftStagger, "drift-stagger", false, "Spread drift checks of releases evenly across the interval")
+	startCmd.Flags().DurationVar(&driftFlap, "drift-flap-window", 0, "How long drift must stay gone before it is notified as resolved")
+	startCmd.Flags().IntVar(&driftContext, "drift-context-lines", 0, "Unchanged lines shown around changes in drift diffs (0 shows whole resources)")
+	startCmd.Flags().IntVar(&driftWorkers, "drift-workers", drift.DefaultWorkers, "How many releases are diffed at once during drift checks")
+	startCmd.Flags().BoolVar(&driftPrecheck, "drift-precheck", true, "Diff only releases whose manifest stored by helm differs from the one rendered locally")
+	startCmd.Flags().IntVar(&renderCache, "render-cache-size", rendercache.DefaultSize, renderCacheUsage)
+	startCmd.Flags().StringVar(&healSeverity, "drift-heal-max-severity", "", "Highest drift severity healed automatically (low, medium, high); higher severities await approval")
+	startCmd.Flags().StringSliceVar(&healManualNS, "drift-heal-manual-namespaces", nil, "Namespaces whose drift always awaits approval")
+	startCmd.Flags().StringArrayVar(&healWindows, "drift-heal-window", nil, healWindowUsage)
+	startCmd.Flags().StringArrayVar(&healBlackouts, "drift-heal-blackout", nil, healBlackoutUsage)
+	startCmd.Flags().BoolVar(&healPreview, "drift-heal-preview", false, "Dry-run each heal first and attach the predicted changes to the drift report")
+	startCmd.Flags().BoolVar(&healGitOps, "drift-heal-gitops-managed", false, "Auto-heal releases whose resources ArgoCD or Flux also manage; by default their drift awaits approval")
+	startCmd.Flags().BoolVar(&leaderElect, "leader-elect", false, "Use a Kubernetes Lease so only one of several daemons syncs and heals")
+	startCmd.Flags().StringVar(&leaderNS, "leader-elect-namespace", envOrDefault("POD_NAMESPACE", "default"), "Namespace of the leader election Lease")
+	startCmd.Flags().StringVar(&leaderLease, "leader-elect-lease", leader.DefaultLeaseName, "Name of the leader election Lease")
+	startCmd.Flags().StringVar(&leaderID, "leader-elect-identity", defaultLeaderIdentity(), "Identity of this daemon in leader election")
+	startCmd.Flags().BoolVar(&inCluster, "in-cluster", false, "Run inside the cluster: serve the API on "+incluster.DefaultAPIAddr+" and default namespaces to the pod's")
+	startCmd.Flags().StringVar(&configMapRef, "helmfile-configmap", "", "Load the helmfile from a ConfigMap ([namespace/]name[:key]) instead of --file")
+	startCmd.Flags().DurationVar(&sourceEvery, "source-interval", daemon.DefaultSourceInterval, "How often to check the helmfile source for changes")
+	startCmd.Flags().BoolVar(&resyncExpiry, "resync-on-expiry", false, "Resync affected releases when a substitution's --ttl expires")
+	startCmd.Flags().BoolVar(&prune, "prune", false, "Uninstall orphaned releases found during drift detection")
+	startCmd.Flags().StringVar(&stateFile, "state-file", defaultPaths.StateFile, "File keeping substitutions, drift history and the last sync across restarts")
+	startCmd.Flags().BoolVar(&resetState, "reset-state", false, "Start without the substitutions, drift history and last sync saved by a previous run")
+	startCmd.Flags().BoolVar(&supervise, "supervise", false, "Run the daemon under a supervisor that restarts it with backoff when it crashes")
+	startCmd.Flags().StringVar(&helmBinary, "helm-binary", "", "Path to helm binary (default: $"+preflight.EnvHelmBinary+" or helm on PATH)")
+	startCmd.Flags().BoolVar(&strict, "strict", false, "Reject the helmfile when it has unknown fields or mistyped values, and templates using missing keys (see helmfire lint)")
+	stamp.register(startCmd)
+	startCmd.Flags().StringVar(&resources, "resources-profile", "", resourcesProfileUsage)
+	policies.register(startCmd)
+	namespaces.register(startCmd)
+	events.register(startCmd)
+	deployStatus.register(startCmd)
 
 	// Stop command
 	stopCmd := &cobra.Command{
@@ -541,20 +1874,82 @@ Examples:
 		Long:  `Stop a running helmfire daemon gracefully.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if running, _ := daemon.IsDaemonRunning(pidFile); !running {
+				cleanStalePIDFile(pidFile)
 				return fmt.Errorf("daemon not running")
 			}
 
-			fmt.Println("Stopping daemon...")
-			if err := daemon.StopDaemon(pidFile); err != nil {
+			printLine("Stopping daemon...")
+			if err := daemon.StopDaemon(pidFile, apiAddr); err != nil {
 				return fmt.Errorf("failed to stop daemon: %w", err)
 			}
 
-			fmt.Println("✓ Daemon stopped")
+			printLine("✓ Daemon stopped")
+			return nil
+		},
+	}
+
+	stopCmd.Flags().StringVar(&pidFile, "pid-file", defaultPaths.PIDFile, "PID file path")
+	stopCmd.Flags().StringVar(&apiAddr, "api-addr", daemon.DefaultAPIAddr, "API server address")
+
+	// Restart command
+	restartCmd := &cobra.Command{
+		Use:   "restart",
+		Short: "Restart the daemon",
+		Long: `Stop a running helmfire daemon and start it again in the background with
+the flags and in the directory it was started with. Substitutions, drift
+history and the last sync are kept in its state file.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if running, _ := daemon.IsDaemonRunning(pidFile); !running {
+				cleanStalePIDFile(pidFile)
+				return fmt.Errorf("daemon not running")
+			}
+
+			printLine("Restarting daemon...")
+			pid, err := daemon.RestartDaemon(pidFile, apiAddr)
+			if err != nil {
+				return fmt.Errorf("failed to restart daemon: %w", err)
+			}
+
+			printf("✓ Daemon restarted (PID %d)\n", pid)
+			return nil
+		},
+	}
+
+	restartCmd.Flags().StringVar(&pidFile, "pid-file", defaultPaths.PIDFile, "PID file path")
+	restartCmd.Flags().StringVar(&apiAddr, "api-addr", daemon.DefaultAPIAddr, "API server address")
+
+	// Reload command
+	reloadCmd := &cobra.Command{
+		Use:   "reload",
+		Short: "Reload the daemon's configuration",
+		Long: `Make a running helmfire daemon reread the config file and apply its
+notifiers, drift interval and watch paths without dropping its state, as
+sending it SIGHUP does.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if running, _ := daemon.IsDaemonRunning(pidFile); !running {
+				return fmt.Errorf("daemon not running")
+			}
+
+			resp, err := daemon.NewAPIClient(apiAddr).ReloadConfig()
+			if err != nil {
+				return fmt.Errorf("failed to reload configuration: %w", err)
+			}
+
+			printLine("✓ Configuration reloaded")
+			if resp.DriftInterval != "" {
+				printf("  Drift interval: %s\n", resp.DriftInterval)
+				printf("  Notifiers: %d\n", resp.Notifiers)
+			}
+			printf("  Helmfiles: %s\n", strings.Join(resp.Files, ", "))
+			for _, warning := range resp.Warnings {
+				printf("  Warning: %s\n", warning)
+			}
 			return nil
 		},
 	}
 
-	stopCmd.Flags().StringVar(&pidFile, "pid-file", daemon.DefaultPIDFile, "PID file path")
+	reloadCmd.Flags().StringVar(&pidFile, "pid-file", defaultPaths.PIDFile, "PID file path")
+	reloadCmd.Flags().StringVar(&apiAddr, "api-addr", daemon.DefaultAPIAddr, "API server address")
 
 	// Status command
 	statusCmd := &cobra.Command{
@@ -568,23 +1963,68 @@ Examples:
 			}
 
 			if !status.Running {
-				fmt.Println("Daemon: not running")
+				printLine("Daemon: not running")
 				return nil
 			}
 
-			fmt.Println("Daemon: running")
-			fmt.Printf("  PID: %d\n", status.PID)
-			fmt.Printf("  Uptime: %s\n", status.Uptime)
-			fmt.Printf("  Started: %s\n", status.StartTime.Format(time.RFC3339))
-			fmt.Printf("  Active substitutions:\n")
-			fmt.Printf("    Charts: %d\n", status.ActiveSubstitutions.Charts)
-			fmt.Printf("    Images: %d\n", status.ActiveSubstitutions.Images)
+			printLine("Daemon: running")
+			printf("  PID: %d\n", status.PID)
+			printf("  Uptime: %s\n", status.Uptime)
+			printf("  Started: %s\n", status.StartTime.Format(time.RFC3339))
+			printf("  Leader: %v\n", status.Leader)
+			if status.SpecGeneration > 0 {
+				printf("  Helmfile generation: %d\n", status.SpecGeneration)
+			}
+			if status.Supervised {
+				printf("  Supervised: yes (%d restarts)\n", status.Restarts)
+			}
+			if pause := status.Pause; pause != nil {
+				until := "until resumed"
+				if pause.Until != nil {
+					until = "until " + pause.Until.Local().Format(time.RFC3339)
+				}
+				if pause.Reason != "" {
+					until += ": " + pause.Reason
+				}
+				printf("  Paused: %s\n", until)
+			}
+			printf("  Active substitutions:\n")
+			printf("    Charts: %d\n", status.ActiveSubstitutions.Charts)
+			printf("    Images: %d\n", status.ActiveSubstitutions.Images)
+			if !status.LastSync.IsZero() {
+				result := "ok"
+				if status.LastSyncError != "" {
+					result = status.LastSyncError
+				}
+				printf("  Last sync: %s (%s)\n", status.LastSync.Format(time.RFC3339), result)
+			}
+			if len(status.Releases) > 0 {
+				printf("  Releases:\n")
+				for _, release := range status.Releases {
+					state := string(release.Status)
+					if helm := release.Helm; helm != nil {
+						state = fmt.Sprintf("revision %d, %s", helm.Revision, helm.Status)
+					}
+					printf("    %s: %s\n", release.Name, state)
+				}
+			}
+
+			readiness, err := daemon.NewAPIClient(apiAddr).GetReadiness()
+			if err != nil {
+				return fmt.Errorf("failed to get readiness: %w", err)
+			}
+			printf("  Ready: %s\n", readiness.Status)
+			for _, check := range readiness.Checks {
+				if !check.Ready {
+					printf("    %s: %s\n", check.Name, check.Message)
+				}
+			}
 
 			return nil
 		},
 	}
 
-	statusCmd.Flags().StringVar(&pidFile, "pid-file", daemon.DefaultPIDFile, "PID file path")
+	statusCmd.Flags().StringVar(&pidFile, "pid-file", defaultPaths.PIDFile, "PID file path")
 	statusCmd.Flags().StringVar(&apiAddr, "api-addr", daemon.DefaultAPIAddr, "API server address")
 
 	// Logs command
@@ -602,7 +2042,7 @@ Examples:
 			data, err := os.ReadFile(logFile)
 			if err != nil {
 				if os.IsNotExist(err) {
-					fmt.Println("No logs available")
+					printLine("No logs available")
 					return nil
 				}
 				return fmt.Errorf("failed to read log file: %w", err)
@@ -613,37 +2053,80 @@ Examples:
 		},
 	}
 
-	logsCmd.Flags().StringVar(&pidFile, "pid-file", daemon.DefaultPIDFile, "PID file path")
-	logsCmd.Flags().StringVar(&logFile, "log-file", daemon.DefaultLogFile, "Log file path")
+	logsCmd.Flags().StringVar(&pidFile, "pid-file", defaultPaths.PIDFile, "PID file path")
+	logsCmd.Flags().StringVar(&logFile, "log-file", defaultPaths.LogFile, "Log file path")
 
 	cmd.AddCommand(startCmd)
 	cmd.AddCommand(stopCmd)
+	cmd.AddCommand(restartCmd)
+	cmd.AddCommand(reloadCmd)
 	cmd.AddCommand(statusCmd)
 	cmd.AddCommand(logsCmd)
+	cmd.AddCommand(newInstallServiceCmd())
+	cmd.AddCommand(newUninstallServiceCmd())
 
 	return cmd
 }
 
-// Helper function to check if daemon is running (wrapper for package function)
-func isDaemonRunning(pidFile string) (bool, error) {
-	data, err := os.ReadFile(pidFile)
+// supervisorFlags are handled by the supervisor and not passed on to the
+// daemon it runs; a restarted daemon must not reset its state again
+var supervisorFlags = []string{"--supervise", "--reset-state"}
+
+// superviseDaemon reruns 'daemon start' without supervisorFlags as a child
+// process, restarting it when it crashes until it stops cleanly or this
+// process is interrupted
+func superviseDaemon(logFile string) error {
+	command, err := daemonCommand()
 	if err != nil {
-		if os.IsNotExist(err) {
-			return false, nil
-		}
-		return false, err
+		return err
 	}
 
-	var pid int
-	if _, err := fmt.Sscanf(string(data), "%d", &pid); err != nil {
-		return false, err
+	if err := os.MkdirAll(filepath.Dir(logFile), 0700); err != nil {
+		return err
 	}
 
-	process, err := os.FindProcess(pid)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	supervisor := daemon.NewSupervisor(daemon.SupervisorConfig{
+		Command: command,
+		LogFile: logFile,
+	}, globalLogger)
+	return supervisor.Run(ctx)
+}
+
+// daemonCommand returns the command line of this helmfire without
+// supervisorFlags
+func daemonCommand() ([]string, error) {
+	executable, err := os.Executable()
 	if err != nil {
-		return false, nil
+		return nil, fmt.Errorf("failed to locate helmfire binary: %w", err)
+	}
+	command := []string{executable}
+	for _, arg := range os.Args[1:] {
+		if !isSupervisorFlag(arg) {
+			command = append(command, arg)
+		}
 	}
+	return command, nil
+}
 
-	err = process.Signal(syscall.Signal(0))
-	return err == nil, nil
+func isSupervisorFlag(arg string) bool {
+	for _, flag := range supervisorFlags {
+		if arg == flag || strings.HasPrefix(arg, flag+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanStalePIDFile removes the PID file of a daemon that crashed, warning
+// about it
+func cleanStalePIDFile(pidFile string) {
+	reason, err := daemon.CleanStalePIDFile(pidFile)
+	if err != nil {
+		printf("⚠️  %v\n", err)
+	} else if reason != "" {
+		printf("⚠️  Removed stale PID file %s: %s\n", pidFile, reason)
+	}
 }
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/oleksiyp/helmfire/pkg/helmfire"
+	"github.com/oleksiyp/helmfire/pkg/preflight"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// offlineCharts returns the chart mirror with --offline, or "" online
+func offlineCharts() string {
+	if globalOffline {
+		return globalMirror
+	}
+	return ""
+}
+
+func newMirrorCmd() *cobra.Command {
+	var (
+		files       []string
+		environment string
+		output      string
+		helmBinary  string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "mirror",
+		Short: "Download the charts of the helmfile's releases for offline use",
+		Long: `Download the remote chart of every release into the chart mirror, a directory
+of <chart>-<version>.tgz archives (--chart-mirror, ~/.helmfire/cache/mirror by
+default). Repositories are added and updated first, as sync does. Charts
+pinned to a version already in the mirror aren't downloaded again; releases
+pinning a constraint get the latest matching version.
+
+With --offline, every command takes remote charts from the mirror instead of
+their repositories and skips syncing repositories, so an air-gapped cluster
+can be synced with no network besides the cluster. Releases whose chart isn't
+in the mirror fail, naming the chart and version missing. Copy the directory
+to the air-gapped machine, or point --chart-mirror at a shared one.
+
+Examples:
+  # Fill the mirror while online
+  helmfire mirror -e dev
+
+  # Sync from the mirror
+  helmfire sync -e dev --offline`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if globalOffline {
+				return fmt.Errorf("mirror downloads charts from their repositories; run it without --offline")
+			}
+			helm, err := runPreflight(helmBinary, false)
+			if err != nil {
+				return err
+			}
+
+			project, err := helmfire.LoadProject(context.Background(), helmfire.ProjectOptions{
+				Files:       files,
+				Environment: environment,
+				HelmBinary:  helm.HelmBinary,
+				StateDir:    projectStateDir(),
+				Logger:      globalLogger,
+			})
+			if err != nil {
+				return err
+			}
+			executor := project.Executor(helmfire.ExecutorOptions{})
+
+			ctx := context.Background()
+			if repos := project.Manager().RepositoriesFor(project.Releases()); len(repos) > 0 {
+				globalLogger.Info("syncing repositories", zap.Int("count", len(repos)))
+				if err := executor.SyncRepositoriesContext(ctx, repos); err != nil {
+					return fmt.Errorf("failed to sync repositories: %w", err)
+				}
+			}
+
+			mirrored := executor.MirrorCharts(ctx, project.Releases(), globalMirror)
+			if output == "json" {
+				if err := printJSON(mirrored); err != nil {
+					return err
+				}
+			} else {
+				printMirrored(mirrored, globalMirror)
+			}
+			for _, m := range mirrored {
+				if m.Error != "" {
+					return fmt.Errorf("failed to download some charts")
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(&files, "file", "f", []string{"helmfile.yaml"}, helmfileFlagUsage)
+	cmd.Flags().StringVarP(&environment, "environment", "e", "", "Environment name")
+	cmd.Flags().StringVarP(&output, "output", "o", "text", "Output format (text, json)")
+	cmd.Flags().StringVar(&helmBinary, "helm-binary", "", "Path to helm binary (default: $"+preflight.EnvHelmBinary+" or helm on PATH)")
+
+	return cmd
+}
+
+// printMirrored prints the charts downloaded into the mirror
+func printMirrored(mirrored []sync.MirroredChart, dir string) {
+	if len(mirrored) == 0 {
+		printLine("No releases")
+		return
+	}
+
+	downloaded := 0
+	for _, m := range mirrored {
+		switch {
+		case m.Local:
+			printf("  · %s: %s is a local chart\n", m.Release, m.Chart)
+		case m.Error != "":
+			printf("  ✗ %s: %s: %s\n", m.Release, m.Chart, m.Error)
+		case m.Cached:
+			printf("  ✓ %s: %s (already mirrored)\n", m.Release, filepath.Base(m.Archive))
+		default:
+			downloaded++
+			printf("  ⬇ %s: %s\n", m.Release, filepath.Base(m.Archive))
+		}
+	}
+	printf("%d chart(s) downloaded into %s\n", downloaded, dir)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/oleksiyp/helmfire/pkg/helmfire"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+func newOrphansCmd() *cobra.Command {
+	var (
+		files       []string
+		environment string
+		kubeContext string
+		helmBinary  string
+		prune       bool
+		dryRun      bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "orphans",
+		Short: "List releases in the cluster that are not in the helmfile",
+		Long: `List helm releases deployed in the helmfile's target namespaces that
+are not defined in the helmfile, such as stale experiments.
+
+Examples:
+  # List orphaned releases
+  helmfire orphans
+
+  # Uninstall them
+  helmfire orphans --prune`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			helm, err := runPreflight(helmBinary, false)
+			if err != nil {
+				return err
+			}
+
+			project, err := helmfire.LoadProject(context.Background(), helmfire.ProjectOptions{
+				Files:             files,
+				Environment:       environment,
+				HelmBinary:        helm.HelmBinary,
+				KubeContext:       kubeContext,
+				Substitutor:       globalSubstitutor,
+				OfflineCharts:     offlineCharts(),
+				NamespaceTemplate: namespaceTemplate(),
+				ReleasePrefix:     globalReleasePrefix,
+				Logger:            globalLogger,
+			})
+			if err != nil {
+				return err
+			}
+			manager := project.Manager()
+
+			orphans, err := manager.FindOrphans()
+			if err != nil {
+				return fmt.Errorf("failed to find orphaned releases: %w", err)
+			}
+
+			if len(orphans) == 0 {
+				printLine("No orphaned releases")
+				return nil
+			}
+
+			printLine("Orphaned releases:")
+			for _, orphan := range orphans {
+				printf("  %s/%s (%s, %s)\n", orphan.Namespace, orphan.Name, orphan.Chart, orphan.Status)
+			}
+
+			if !prune {
+				printLine("Run with --prune to uninstall them")
+				return nil
+			}
+
+			executor := project.Executor(helmfire.ExecutorOptions{DryRun: dryRun})
+
+			globalLogger.Info("pruning orphaned releases", zap.Int("count", len(orphans)))
+			return pruneOrphans(context.Background(), executor, orphans)
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(&files, "file", "f", []string{"helmfile.yaml"}, helmfileFlagUsage)
+	cmd.Flags().StringVarP(&environment, "environment", "e", "", "Environment name")
+	cmd.Flags().StringVar(&kubeContext, "kube-context", "", "Kubernetes context")
+	cmd.Flags().StringVar(&helmBinary, "helm-binary", "", "Path to helm binary")
+	cmd.Flags().BoolVar(&prune, "prune", false, "Uninstall orphaned releases")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Simulate uninstall without making changes")
+
+	return cmd
+}
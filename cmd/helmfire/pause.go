@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/daemon"
+	"github.com/spf13/cobra"
+)
+
+func newPauseCmd() *cobra.Command {
+	var (
+		duration      time.Duration
+		reason        string
+		daemonAPIAddr string
+		daemonPIDFile string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "pause",
+		Short: "Pause the daemon's automatic syncs, drift checks and healing",
+		Long: `Suspend what the daemon does on its own: syncs after helmfile source
+changes, substitution expiry and drift checks and healing, such as during
+incident response or manual changes to the cluster. Syncs, drift checks and
+heals run with helmfire still work. With --for the daemon resumes by itself;
+the pause survives daemon restarts.
+
+Examples:
+  # Keep the daemon's hands off the cluster for the next hour
+  helmfire pause --for 1h --reason "INC-1234 failover"
+
+  # Pause until 'helmfire resume'
+  helmfire pause`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if running, _ := daemon.IsDaemonRunning(daemonPIDFile); !running {
+				return fmt.Errorf("daemon is not running")
+			}
+
+			status, err := daemon.NewAPIClient(daemonAPIAddr).Pause(duration, reason)
+			if err != nil {
+				return fmt.Errorf("failed to pause daemon: %w", err)
+			}
+
+			if status.Until != nil {
+				printf("✓ Daemon paused until %s\n", status.Until.Local().Format(time.RFC3339))
+			} else {
+				printLine("✓ Daemon paused until 'helmfire resume'")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().DurationVar(&duration, "for", 0, "Resume automatically after this long (default: until resumed)")
+	cmd.Flags().StringVar(&reason, "reason", "", "Why the daemon is paused, shown in its status")
+	cmd.Flags().StringVar(&daemonAPIAddr, "daemon-api-addr", daemon.DefaultAPIAddr, "Daemon API address")
+	cmd.Flags().StringVar(&daemonPIDFile, "daemon-pid-file", defaultPaths.PIDFile, "Daemon PID file")
+
+	return cmd
+}
+
+func newResumeCmd() *cobra.Command {
+	var (
+		daemonAPIAddr string
+		daemonPIDFile string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "resume",
+		Short: "Resume the daemon's automatic syncs, drift checks and healing",
+		Long: `End a pause started with 'helmfire pause'. Drift checks that came due and
+substitutions that expired while paused are handled right away, and a
+changed helmfile source is synced at its next poll.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if running, _ := daemon.IsDaemonRunning(daemonPIDFile); !running {
+				return fmt.Errorf("daemon is not running")
+			}
+
+			if err := daemon.NewAPIClient(daemonAPIAddr).Resume(); err != nil {
+				return fmt.Errorf("failed to resume daemon: %w", err)
+			}
+
+			printLine("✓ Daemon resumed")
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&daemonAPIAddr, "daemon-api-addr", daemon.DefaultAPIAddr, "Daemon API address")
+	cmd.Flags().StringVar(&daemonPIDFile, "daemon-pid-file", defaultPaths.PIDFile, "Daemon PID file")
+
+	return cmd
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/config"
+	"github.com/oleksiyp/helmfire/pkg/drift"
+	"github.com/oleksiyp/helmfire/pkg/helmfire"
+	"github.com/oleksiyp/helmfire/pkg/reportformat"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+func newPreviewCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "preview",
+		Short: "Create and destroy pull request preview environments",
+	}
+
+	cmd.AddCommand(newPreviewCreateCmd())
+	cmd.AddCommand(newPreviewDestroyCmd())
+
+	return cmd
+}
+
+// previewFlags select the helmfile and pull request of a preview
+type previewFlags struct {
+	files       []string
+	environment string
+	kubeContext string
+	helmBinary  string
+	pr          int
+	sha         string
+	namespace   string
+}
+
+func (f *previewFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVarP(&f.files, "file", "f", []string{"helmfile.yaml"}, helmfileFlagUsage)
+	cmd.Flags().StringVarP(&f.environment, "environment", "e", "", "Environment name")
+	cmd.Flags().StringVar(&f.kubeContext, "kube-context", "", "Kubeconfig context of the preview")
+	cmd.Flags().StringVar(&f.helmBinary, "helm-binary", "", "Path to helm binary")
+	cmd.Flags().IntVar(&f.pr, "pr", 0, "Pull request number")
+	cmd.Flags().StringVar(&f.sha, "sha", "", "Head commit of the pull request, available to templates as {{ .SHA }}")
+	cmd.Flags().StringVar(&f.namespace, "preview-namespace", helmfire.DefaultPreviewNamespace, "Template of the preview's namespace, given {{ .PR }} and {{ .SHA }}")
+	cmd.MarkFlagRequired("pr")
+}
+
+// load returns the preview with images, and the project loaded into its
+// namespace
+func (f *previewFlags) load(images []string) (helmfire.Preview, *helmfire.Project, error) {
+	preview, err := helmfire.NewPreview(f.pr, f.sha, f.namespace, images)
+	if err != nil {
+		return helmfire.Preview{}, nil, err
+	}
+	helm, err := runPreflight(f.helmBinary, false)
+	if err != nil {
+		return helmfire.Preview{}, nil, err
+	}
+	project, err := helmfire.LoadProject(context.Background(), helmfire.ProjectOptions{
+		Files:         f.files,
+		Environment:   f.environment,
+		HelmBinary:    helm.HelmBinary,
+		Namespace:     preview.Namespace,
+		KubeContext:   f.kubeContext,
+		Substitutor:   globalSubstitutor,
+		OfflineCharts: offlineCharts(),
+		Logger:        globalLogger,
+	})
+	if err != nil {
+		return helmfire.Preview{}, nil, ciExit(exitInvalidConfig, err)
+	}
+	return preview, project, nil
+}
+
+func newPreviewCreateCmd() *cobra.Command {
+	var (
+		flags   previewFlags
+		images  []string
+		dryRun  bool
+		timeout time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "create --pr <number>",
+		Short: "Sync the helmfile's releases into a namespace of a pull request",
+		Long: `Sync every release of the helmfile into a namespace of its own for a pull
+request, named by --preview-namespace (pr-<number> by default), replacing
+images with the ones built for the pull request. The namespace is created
+labelled helmfire.dev/preview=<number>. Running create again updates the
+preview.
+
+Examples:
+  # Preview pull request 123 with the image its CI built
+  helmfire preview create --pr 123 \
+    --image ghcr.io/acme/web:latest=ghcr.io/acme/web:pr-{{ .PR }}
+
+  # Name images after the head commit
+  helmfire preview create --pr 123 --sha "$GITHUB_SHA" \
+    --image ghcr.io/acme/web:latest=ghcr.io/acme/web:{{ .SHA }}`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(globalConfigPath)
+			if err != nil {
+				return err
+			}
+			if err := addSubstitutionProviders(cfg); err != nil {
+				return err
+			}
+			preview, project, err := flags.load(images)
+			if err != nil {
+				return err
+			}
+			configured, err := drift.NewNotifiers(cfg.Notifiers, globalLogger)
+			if err != nil {
+				return fmt.Errorf("failed to configure notifiers: %w", err)
+			}
+
+			executor := project.Executor(helmfire.ExecutorOptions{DryRun: dryRun, Progress: printProgress})
+			var syncNotifiers []drift.SyncNotifier
+			if !dryRun {
+				syncNotifiers = drift.SyncNotifiers(configured)
+			}
+			if globalCI {
+				syncNotifiers = append(syncNotifiers, ciGroups{})
+			}
+
+			printf("Preview of PR #%d in namespace %s\n", preview.PR, preview.Namespace)
+			originals := make([]string, 0, len(preview.Images))
+			for original := range preview.Images {
+				originals = append(originals, original)
+			}
+			sort.Strings(originals)
+			for _, original := range originals {
+				printf("  %s → %s\n", original, preview.Images[original])
+			}
+			report, syncErr := project.CreatePreview(context.Background(), preview, helmfire.SyncOptions{
+				Executor:  executor,
+				Timeout:   timeout,
+				Trigger:   "preview",
+				Notifiers: syncNotifiers,
+			})
+			if report == nil {
+				return syncErr
+			}
+
+			printSyncReport(report)
+			if globalCI {
+				outputs := syncOutputs(report, dryRun, executor)
+				outputs["namespace"] = preview.Namespace
+				if err := writeCIResults(reportformat.Results{Helmfile: project.Files()[0], Sync: report}, outputs); err != nil {
+					globalLogger.Error("failed to write CI results", zap.Error(err))
+				}
+			}
+			if syncErr != nil && report.Failed() {
+				return ciExit(exitHelmFailed, syncErr)
+			}
+			return syncErr
+		},
+	}
+
+	flags.register(cmd)
+	cmd.Flags().StringArrayVar(&images, "image", nil, "Replace an image in the preview as original=replacement; the replacement is a template given {{ .PR }} and {{ .SHA }} (repeatable)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be synced without applying it")
+	cmd.Flags().DurationVar(&timeout, "timeout", 0, "Abort the sync after this long (0 means no timeout)")
+
+	return cmd
+}
+
+func newPreviewDestroyCmd() *cobra.Command {
+	var (
+		flags  previewFlags
+		dryRun bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "destroy --pr <number>",
+		Short: "Tear down the preview environment of a pull request",
+		Long: `Uninstall every release in the namespace of a pull request's preview, and
+delete the namespace if it was created by 'helmfire preview create'.
+
+Examples:
+  # Tear down the preview of pull request 123 once it closed
+  helmfire preview destroy --pr 123`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			preview, project, err := flags.load(nil)
+			if err != nil {
+				return err
+			}
+			executor := project.Executor(helmfire.ExecutorOptions{DryRun: dryRun})
+
+			uninstalled, err := project.DestroyPreview(context.Background(), preview, executor)
+			for _, name := range uninstalled {
+				printf("✓ Uninstalled %s/%s\n", preview.Namespace, name)
+			}
+			if err != nil {
+				return err
+			}
+			if len(uninstalled) == 0 {
+				printf("No releases in namespace %s\n", preview.Namespace)
+			}
+			printf("✓ Preview of PR #%d destroyed\n", preview.PR)
+			if globalCI {
+				return writeCIResults(reportformat.Results{}, map[string]string{
+					"namespace":            preview.Namespace,
+					"uninstalled-releases": strings.Join(uninstalled, ","),
+				})
+			}
+			return nil
+		},
+	}
+
+	flags.register(cmd)
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be uninstalled without doing it")
+
+	return cmd
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/oleksiyp/helmfire/pkg/helmfire"
+	"github.com/spf13/cobra"
+)
+
+// releaseEntry is a release as listed by helmfire list releases
+type releaseEntry struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Chart     string `json:"chart"`
+	Version   string `json:"version,omitempty"`
+	Enabled   bool   `json:"enabled"`
+	Condition string `json:"condition,omitempty"`
+
+	KubeContext string `json:"kubeContext,omitempty"` // the current context when empty
+}
+
+func newListReleasesCmd() *cobra.Command {
+	var (
+		files       []string
+		environment string
+		output      string
+		namespace   string
+		kubeContext string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "releases",
+		Short: "List the helmfile's releases and whether they are enabled",
+		Long: `List the releases of the helmfile in the environment selected with -e, and
+whether each is enabled: installed is not false, its installedTemplate renders
+true and its condition, a boolean in the environment values such as
+cache.enabled, is true. Disabled releases are left out of syncs.
+
+Each release is shown with the namespace and kube context it is synced to,
+resolved from --namespace and --kube-context, the release, its environment
+and helmDefaults, in that order.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			project, err := helmfire.LoadProject(context.Background(), helmfire.ProjectOptions{
+				Files:             files,
+				Environment:       environment,
+				Namespace:         namespace,
+				KubeContext:       kubeContext,
+				OfflineCharts:     offlineCharts(),
+				NamespaceTemplate: namespaceTemplate(),
+				ReleasePrefix:     globalReleasePrefix,
+				Logger:            globalLogger,
+			})
+			if err != nil {
+				return err
+			}
+
+			manager := project.Manager()
+			executor := project.Executor(helmfire.ExecutorOptions{})
+			entries := make([]releaseEntry, 0, len(manager.GetReleases()))
+			for _, release := range manager.GetReleases() {
+				entries = append(entries, releaseEntry{
+					Name:        release.Name,
+					Namespace:   executor.ReleaseNamespace(release),
+					KubeContext: executor.ReleaseKubeContext(release),
+					Chart:       release.Chart,
+					Version:     release.Version,
+					Enabled:     manager.IsReleaseInstalled(release),
+					Condition:   release.Condition,
+				})
+			}
+
+			if output == "json" {
+				return printJSON(entries)
+			}
+			printReleases(entries, environment)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(&files, "file", "f", []string{"helmfile.yaml"}, helmfileFlagUsage)
+	cmd.Flags().StringVarP(&environment, "environment", "e", "", "Environment name")
+	cmd.Flags().StringVarP(&output, "output", "o", "text", "Output format (text, json)")
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Namespace of every release, over the helmfile's")
+	cmd.Flags().StringVar(&kubeContext, "kube-context", "", "Kubernetes context of every release, over the helmfile's")
+
+	return cmd
+}
+
+// printReleases prints the releases, enabled or not
+func printReleases(entries []releaseEntry, environment string) {
+	if len(entries) == 0 {
+		printLine("No releases")
+		return
+	}
+
+	if environment != "" {
+		printf("Releases in environment %s:\n", environment)
+	} else {
+		printLine("Releases:")
+	}
+	enabled := 0
+	for _, e := range entries {
+		mark := "✗"
+		if e.Enabled {
+			mark = "✓"
+			enabled++
+		}
+		line := fmt.Sprintf("  %s %s (%s) %s", mark, e.Name, releaseTarget(e.Namespace, e.KubeContext), e.Chart)
+		if e.Version != "" {
+			line += " " + e.Version
+		}
+		if e.Condition != "" {
+			line += " [condition " + e.Condition + "]"
+		}
+		printLine(line)
+	}
+	printf("%d of %d release(s) enabled\n", enabled, len(entries))
+}
+
+// releaseTarget describes where a release is synced: its namespace, or
+// namespace/release, followed by @context unless it is the current context
+func releaseTarget(namespace, kubeContext string) string {
+	if kubeContext == "" {
+		return namespace
+	}
+	return namespace + "@" + kubeContext
+}
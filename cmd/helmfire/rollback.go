@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/oleksiyp/helmfire/pkg/daemon"
+	"github.com/oleksiyp/helmfire/pkg/helmfire"
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+	"github.com/spf13/cobra"
+)
+
+func newRollbackCmd() *cobra.Command {
+	var (
+		files         []string
+		environment   string
+		namespace     string
+		kubeContext   string
+		helmBinary    string
+		all           bool
+		dryRun        bool
+		daemonAPIAddr string
+		daemonPIDFile string
+		stateFile     string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "rollback <release> [revision] | rollback --all",
+		Short: "Roll back releases with helm rollback",
+		Long: `Roll back a release from the helmfile to a helm revision, using the
+namespace and kube context it is synced with. Without a revision, and for every
+release with --all, releases go back to the revision they had before the last
+helmfire sync; releases helmfire never synced are skipped.
+
+If a daemon is running, the rollback runs in the daemon. Either way it is
+recorded in the sync history (see 'helmfire history').
+
+Examples:
+  # Roll back nginx to before the last helmfire sync
+  helmfire rollback nginx
+
+  # Roll back nginx to revision 3
+  helmfire rollback nginx 3
+
+  # Show what rolling back every release would do
+  helmfire rollback --all --dry-run`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if all {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.RangeArgs(1, 2)(cmd, args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			req := daemon.RollbackRequest{All: all, DryRun: dryRun}
+			if !all {
+				req.Release = args[0]
+			}
+			if len(args) == 2 {
+				revision, err := strconv.Atoi(args[1])
+				if err != nil || revision <= 0 {
+					return fmt.Errorf("invalid revision: %q", args[1])
+				}
+				req.Revision = revision
+			}
+
+			var resp *daemon.RollbackResponse
+			if running, _ := daemon.IsDaemonRunning(daemonPIDFile); running {
+				r, err := daemon.NewAPIClient(daemonAPIAddr).Rollback(req)
+				if err != nil {
+					return fmt.Errorf("failed to roll back via daemon: %w", err)
+				}
+				resp = r
+			} else {
+				helm, err := runPreflight(helmBinary, false)
+				if err != nil {
+					return err
+				}
+
+				project, err := helmfire.LoadProject(context.Background(), helmfire.ProjectOptions{
+					Files:             files,
+					Environment:       environment,
+					HelmBinary:        helm.HelmBinary,
+					Namespace:         namespace,
+					KubeContext:       kubeContext,
+					Substitutor:       globalSubstitutor,
+					OfflineCharts:     offlineCharts(),
+					NamespaceTemplate: namespaceTemplate(),
+					ReleasePrefix:     globalReleasePrefix,
+					Logger:            globalLogger,
+				})
+				if err != nil {
+					return err
+				}
+				manager := project.Manager()
+
+				releases, err := rollbackReleases(manager, req)
+				if err != nil {
+					return err
+				}
+
+				executor := project.Executor(helmfire.ExecutorOptions{})
+
+				steps, err := executor.PlanRollback(context.Background(), releases, req.Revision)
+				if err != nil {
+					return err
+				}
+				resp = &daemon.RollbackResponse{Steps: steps, DryRun: dryRun}
+				if !dryRun {
+					report := executor.Rollback(context.Background(), steps)
+					run, err := daemon.RecordSyncRun(stateFile, daemon.TriggerRollback, report, globalSubstitutor.Export())
+					if err != nil {
+						printf("⚠️  Rollback not recorded in the sync history: %v\n", err)
+						run = daemon.SyncRun{Trigger: daemon.TriggerRollback, Report: *report}
+					}
+					resp.Run = &run
+				}
+			}
+
+			return printRollback(resp)
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(&files, "file", "f", []string{"helmfile.yaml"}, helmfileFlagUsage)
+	cmd.Flags().StringVarP(&environment, "environment", "e", "", "Environment name")
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Namespace of every release, over the helmfile's")
+	cmd.Flags().StringVar(&kubeContext, "kube-context", "", "Kubernetes context of every release, over the helmfile's")
+	cmd.Flags().StringVar(&helmBinary, "helm-binary", "", "Path to helm binary")
+	cmd.Flags().BoolVar(&all, "all", false, "Roll back every release to before the last helmfire sync")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the revisions releases would be rolled back to")
+	cmd.Flags().StringVar(&daemonAPIAddr, "daemon-api-addr", daemon.DefaultAPIAddr, "Daemon API address")
+	cmd.Flags().StringVar(&daemonPIDFile, "daemon-pid-file", defaultPaths.PIDFile, "Daemon PID file")
+	cmd.Flags().StringVar(&stateFile, "state-file", defaultPaths.StateFile, "Daemon state file the rollback is recorded in when the daemon isn't running")
+
+	return cmd
+}
+
+// rollbackReleases returns the helmfile releases a rollback request names
+func rollbackReleases(manager *helmstate.Manager, req daemon.RollbackRequest) ([]helmstate.Release, error) {
+	var releases []helmstate.Release
+	for _, release := range manager.GetReleases() {
+		if req.All && manager.IsReleaseInstalled(release) || release.Name == req.Release {
+			releases = append(releases, release)
+		}
+	}
+	if !req.All && len(releases) == 0 {
+		return nil, fmt.Errorf("release not found: %s", req.Release)
+	}
+	return releases, nil
+}
+
+func printRollback(resp *daemon.RollbackResponse) error {
+	if resp.DryRun {
+		for _, step := range resp.Steps {
+			name := releaseTarget(step.Namespace+"/"+step.Release, step.KubeContext)
+			if step.Skip != "" {
+				printf("  - %s: skipped (%s)\n", name, step.Skip)
+			} else if step.Revision > 0 {
+				printf("  ↩ %s: would roll back to revision %d\n", name, step.Revision)
+			} else {
+				printf("  ↩ %s: would roll back to the previous revision\n", name)
+			}
+		}
+		return nil
+	}
+
+	revisions := make(map[string]int, len(resp.Steps))
+	for _, step := range resp.Steps {
+		revisions[step.Namespace+"/"+step.Release] = step.Revision
+	}
+	run := resp.Run
+	for _, result := range run.Results {
+		name := result.Namespace + "/" + result.Name
+		switch result.Status {
+		case sync.ReleaseStatusSucceeded:
+			printf("  ✓ %s: rolled back to revision %d\n", name, revisions[name])
+		case sync.ReleaseStatusSkipped:
+			printf("  - %s: skipped (%s)\n", name, result.Error)
+		default:
+			printf("  ✗ %s: %s\n", name, result.Error)
+		}
+	}
+	if run.ID > 0 {
+		printf("Recorded as sync run #%d\n", run.ID)
+	}
+
+	if run.Failed() {
+		return fmt.Errorf("rollback failed: %d failed, %d timed out",
+			run.Count(sync.ReleaseStatusFailed), run.Count(sync.ReleaseStatusTimedOut))
+	}
+	return nil
+}
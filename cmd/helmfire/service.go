@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/oleksiyp/helmfire/pkg/config"
+	"github.com/oleksiyp/helmfire/pkg/daemon"
+	"github.com/oleksiyp/helmfire/pkg/preflight"
+	"github.com/oleksiyp/helmfire/pkg/service"
+	"github.com/spf13/cobra"
+)
+
+// serviceEnv lists the environment variables copied into the service so
+// helm, kubectl and helmfire behave as they do in the installing shell
+var serviceEnv = []string{"PATH", "HOME", "KUBECONFIG", daemon.EnvStateHome, preflight.EnvHelmBinary, config.EnvConfigPath}
+
+func newInstallServiceCmd() *cobra.Command {
+	var (
+		system    bool
+		printOnly bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "install-service [-- daemon start flags]",
+		Short: "Run the daemon as a systemd or launchd service",
+		Long: `Install a systemd unit (Linux) or launchd agent (macOS) that runs
+'helmfire daemon start' at boot and restarts it on failure.
+
+Flags after -- are passed to 'daemon start'. The service runs in the current
+directory with the current PATH and KUBECONFIG, so relative paths and tools
+resolve as they do now.
+
+Examples:
+  # Install a user service for ./helmfile.yaml with drift detection
+  helmfire daemon install-service -- -f helmfile.yaml --drift-interval=5m
+
+  # Install system-wide (needs root)
+  sudo helmfire daemon install-service --system
+
+  # Show the unit without installing it
+  helmfire daemon install-service --print`,
+		Args: cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svcConfig, err := newServiceConfig(cmd, args, system)
+			if err != nil {
+				return err
+			}
+
+			svc, err := service.Current(svcConfig)
+			if err != nil {
+				return err
+			}
+
+			if printOnly {
+				fmt.Print(svc.Content)
+				return nil
+			}
+
+			// launchd opens the log file but won't create its directory
+			if err := os.MkdirAll(filepath.Dir(svcConfig.LogFile), 0700); err != nil {
+				return err
+			}
+			if err := svc.Install(); err != nil {
+				return fmt.Errorf("failed to install service: %w", err)
+			}
+
+			printf("✓ Installed %s service: %s\n", svc.Manager, svc.Path)
+			printLine("\nUse 'helmfire daemon status' to check it and 'helmfire daemon uninstall-service' to remove it")
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&system, "system", false, "Install a system-wide service instead of one for the current user")
+	cmd.Flags().BoolVar(&printOnly, "print", false, "Print the service definition instead of installing it")
+
+	return cmd
+}
+
+func newUninstallServiceCmd() *cobra.Command {
+	var system bool
+
+	cmd := &cobra.Command{
+		Use:   "uninstall-service",
+		Short: "Stop and remove the daemon service",
+		Long:  `Stop and remove the systemd unit or launchd agent installed by 'helmfire daemon install-service'.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			svc, err := service.Current(service.Config{System: system})
+			if err != nil {
+				return err
+			}
+
+			if err := svc.Uninstall(); err != nil {
+				return fmt.Errorf("failed to uninstall service: %w", err)
+			}
+
+			printf("✓ Removed %s service: %s\n", svc.Manager, svc.Path)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&system, "system", false, "Remove the system-wide service instead of the current user's")
+
+	return cmd
+}
+
+// newServiceConfig describes a service running 'helmfire daemon start' with
+// startArgs and the global flags given on this command line
+func newServiceConfig(cmd *cobra.Command, startArgs []string, system bool) (service.Config, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return service.Config{}, fmt.Errorf("failed to locate helmfire binary: %w", err)
+	}
+	if executable, err = filepath.EvalSymlinks(executable); err != nil {
+		return service.Config{}, fmt.Errorf("failed to locate helmfire binary: %w", err)
+	}
+
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return service.Config{}, err
+	}
+
+	args := []string{"daemon", "start"}
+	if cmd.Flags().Changed("config") {
+		path, err := filepath.Abs(globalConfigPath)
+		if err != nil {
+			return service.Config{}, err
+		}
+		args = append(args, "--config", path)
+	}
+	if cmd.Flags().Changed("audit-log") {
+		args = append(args, "--audit-log", globalAuditLog)
+	}
+	args = append(args, startArgs...)
+
+	env := make(map[string]string)
+	for _, name := range serviceEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			env[name] = value
+		}
+	}
+
+	return service.Config{
+		Executable: executable,
+		Args:       args,
+		WorkingDir: workingDir,
+		LogFile:    defaultPaths.LogFile,
+		Env:        env,
+		System:     system,
+	}, nil
+}
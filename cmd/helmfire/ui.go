@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/oleksiyp/helmfire/pkg/daemon"
+	"github.com/oleksiyp/helmfire/pkg/tui"
+	"github.com/spf13/cobra"
+)
+
+func newUICmd() *cobra.Command {
+	var (
+		daemonAPIAddr string
+		daemonPIDFile string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "ui",
+		Short: "Manage the daemon's releases and substitutions in an interactive terminal UI",
+		Long: `Show the releases of the running daemon with their last sync result and
+unhealed drift, the rollout progress and results of actions in a log pane,
+and the daemon's substitutions.
+
+Keys:
+  ↑/↓ or k/j   select
+  s            sync the selected release
+  d            show the changes a sync would apply
+  h            heal the release, approving its drift when held for approval
+  c            check the release for drift now
+  tab          switch between releases and substitutions
+  a            add an image substitution (substitutions)
+  x            remove the selected substitution (substitutions)
+  r            refresh
+  esc          close the diff
+  q            quit`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if running, _ := daemon.IsDaemonRunning(daemonPIDFile); !running {
+				return fmt.Errorf("daemon is not running")
+			}
+			client := daemon.NewAPIClient(daemonAPIAddr)
+			if !client.IsHealthy() {
+				return fmt.Errorf("daemon API at %s is not responding", daemonAPIAddr)
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			return tui.Run(ctx, tui.New(client), os.Stdin, os.Stdout)
+		},
+	}
+
+	cmd.Flags().StringVar(&daemonAPIAddr, "daemon-api-addr", daemon.DefaultAPIAddr, "Daemon API address")
+	cmd.Flags().StringVar(&daemonPIDFile, "daemon-pid-file", defaultPaths.PIDFile, "Daemon PID file")
+
+	return cmd
+}
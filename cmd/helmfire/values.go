@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/oleksiyp/helmfire/pkg/daemon"
+	"github.com/spf13/cobra"
+)
+
+func newValuesCmd() *cobra.Command {
+	var (
+		clear         bool
+		daemonAPIAddr string
+		daemonPIDFile string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "values <release> [name=value...]",
+		Short: "Overlay temporary values on a release in the daemon",
+		Long: `Show, set or clear the temporary --set values the daemon overlays on a
+release, on top of the values in the helmfile. Overlays apply from the next
+sync of the release, survive daemon restarts and stay until cleared, so
+feature flags can be flipped without editing the helmfile.
+
+Examples:
+  # Enable a feature flag on the next sync of web
+  helmfire values web features.beta=true
+
+  # Show the overlay of web
+  helmfire values web
+
+  # Go back to the helmfile's values
+  helmfire values web --clear`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if running, _ := daemon.IsDaemonRunning(daemonPIDFile); !running {
+				return fmt.Errorf("daemon is not running")
+			}
+			client := daemon.NewAPIClient(daemonAPIAddr)
+			release := args[0]
+
+			if clear {
+				if len(args) > 1 {
+					return fmt.Errorf("--clear takes no values")
+				}
+				if err := client.ClearReleaseValues(release); err != nil {
+					return fmt.Errorf("failed to clear values via daemon: %w", err)
+				}
+				printf("✓ Value overlay of %s cleared, applying from its next sync\n", release)
+				return nil
+			}
+
+			if len(args) == 1 {
+				values, err := client.GetReleaseValues(release)
+				if err != nil {
+					return fmt.Errorf("failed to get values via daemon: %w", err)
+				}
+				printValues(release, values)
+				return nil
+			}
+
+			values := make(map[string]string, len(args)-1)
+			for _, arg := range args[1:] {
+				name, value, ok := strings.Cut(arg, "=")
+				if !ok || name == "" {
+					return fmt.Errorf("invalid value %q: expected name=value", arg)
+				}
+				values[name] = value
+			}
+			overlay, err := client.SetReleaseValues(release, values)
+			if err != nil {
+				return fmt.Errorf("failed to set values via daemon: %w", err)
+			}
+			printf("✓ Values set, applying from the next sync of %s\n", release)
+			printValues(release, overlay)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&clear, "clear", false, "Remove the value overlay of the release")
+	cmd.Flags().StringVar(&daemonAPIAddr, "daemon-api-addr", daemon.DefaultAPIAddr, "Daemon API address")
+	cmd.Flags().StringVar(&daemonPIDFile, "daemon-pid-file", defaultPaths.PIDFile, "Daemon PID file")
+
+	return cmd
+}
+
+func printValues(release string, values map[string]string) {
+	if len(values) == 0 {
+		printf("No values overlaid on %s\n", release)
+		return
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		printf("  %s=%s\n", name, values[name])
+	}
+}
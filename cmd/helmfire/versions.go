@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/oleksiyp/helmfire/pkg/helmfire"
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/preflight"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// versionsResult is the JSON output of helmfire versions
+type versionsResult struct {
+	Releases []sync.ChartVersion `json:"releases"`
+	Updated  []versionUpdate     `json:"updated,omitempty"`
+	Warnings []string            `json:"warnings,omitempty"` // versions --update left alone
+}
+
+// versionUpdate records a version bumped by helmfire versions --update
+type versionUpdate struct {
+	Release string `json:"release"`
+	File    string `json:"file"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+}
+
+func newVersionsCmd() *cobra.Command {
+	var (
+		files       []string
+		environment string
+		output      string
+		update      bool
+		helmBinary  string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "versions",
+		Short: "Compare the chart versions releases pin with the latest ones",
+		Long: `List, for every release, the chart version it pins, the latest version in the
+chart's repository and whether a newer one exists. Repositories are added and
+updated first, as sync does. Releases pinning a constraint such as "~1.4" are
+outdated when the latest version falls outside it; releases without a version
+already take the latest, and local charts have nothing to compare with.
+
+With --update, the version of each outdated release pinning an exact version
+is bumped to the latest in the helmfile that defines it, leaving the rest of
+the file, comments included, untouched. Constraints and templated versions
+are left for you to update.
+
+Examples:
+  # Show which releases have newer charts
+  helmfire versions
+
+  # The same as JSON, e.g. for a dependency bot
+  helmfire versions -o json
+
+  # Bump outdated pinned versions in the helmfile
+  helmfire versions --update`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			helm, err := runPreflight(helmBinary, false)
+			if err != nil {
+				return err
+			}
+
+			project, err := helmfire.LoadProject(context.Background(), helmfire.ProjectOptions{
+				Files:             files,
+				Environment:       environment,
+				HelmBinary:        helm.HelmBinary,
+				OfflineCharts:     offlineCharts(),
+				NamespaceTemplate: namespaceTemplate(),
+				ReleasePrefix:     globalReleasePrefix,
+				StateDir:          projectStateDir(),
+				Logger:            globalLogger,
+			})
+			if err != nil {
+				return err
+			}
+			executor := project.Executor(helmfire.ExecutorOptions{})
+
+			ctx := context.Background()
+			if repos := project.Manager().RepositoriesFor(project.Releases()); len(repos) > 0 {
+				globalLogger.Info("syncing repositories", zap.Int("count", len(repos)))
+				if err := executor.SyncRepositoriesContext(ctx, repos); err != nil {
+					return fmt.Errorf("failed to sync repositories: %w", err)
+				}
+			}
+
+			result := versionsResult{Releases: executor.ChartVersions(ctx, project.Releases())}
+			if update {
+				result.Updated, result.Warnings, err = updateVersions(project.Manager().Files, result.Releases)
+				if err != nil {
+					return err
+				}
+			}
+
+			if output == "json" {
+				return printJSON(result)
+			}
+			printVersions(result)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringArrayVarP(&files, "file", "f", []string{"helmfile.yaml"}, helmfileFlagUsage)
+	cmd.Flags().StringVarP(&environment, "environment", "e", "", "Environment name")
+	cmd.Flags().StringVarP(&output, "output", "o", "text", "Output format (text, json)")
+	cmd.Flags().BoolVar(&update, "update", false, "Bump outdated pinned versions to the latest in the helmfile")
+	cmd.Flags().StringVar(&helmBinary, "helm-binary", "", "Path to helm binary (default: $"+preflight.EnvHelmBinary+" or helm on PATH)")
+
+	return cmd
+}
+
+// updateVersions bumps the version of each outdated release that pins an
+// exact version in the helmfile defining it, returning what it bumped and
+// warnings about the releases it couldn't
+func updateVersions(helmfiles []string, versions []sync.ChartVersion) ([]versionUpdate, []string, error) {
+	contents := make(map[string][]byte, len(helmfiles))
+	for _, path := range helmfiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read helmfile: %w", err)
+		}
+		contents[path] = data
+	}
+
+	var (
+		updates  []versionUpdate
+		warnings []string
+		changed  = make(map[string]bool)
+	)
+	for _, v := range versions {
+		if !v.Outdated {
+			continue
+		}
+		if !substitute.IsVersion(v.Pinned) {
+			warnings = append(warnings, fmt.Sprintf("%s: version constraint %q left as is; %s is the latest", v.Release, v.Pinned, v.Latest))
+			continue
+		}
+
+		found := false
+		var problem error
+		// Later helmfiles override earlier ones, so the last definition wins
+		for i := len(helmfiles) - 1; i >= 0 && !found && problem == nil; i-- {
+			path := helmfiles[i]
+			var data []byte
+			data, found, problem = helmstate.SetReleaseVersion(contents[path], v.Release, v.Latest)
+			if found {
+				contents[path], changed[path] = data, true
+				updates = append(updates, versionUpdate{Release: v.Release, File: path, From: v.Pinned, To: v.Latest})
+			}
+		}
+		switch {
+		case problem != nil:
+			warnings = append(warnings, fmt.Sprintf("%s: %v", v.Release, problem))
+		case !found:
+			warnings = append(warnings, fmt.Sprintf("%s: not defined in the helmfiles (a base or template?); update it by hand", v.Release))
+		}
+	}
+
+	for path := range changed {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to update helmfile: %w", err)
+		}
+		if err := os.WriteFile(path, contents[path], info.Mode().Perm()); err != nil {
+			return nil, nil, fmt.Errorf("failed to update helmfile: %w", err)
+		}
+	}
+	return updates, warnings, nil
+}
+
+// printVersions prints the chart versions of the releases, the versions
+// bumped and those left alone
+func printVersions(result versionsResult) {
+	if len(result.Releases) == 0 {
+		printLine("No releases")
+		return
+	}
+
+	outdated := 0
+	for _, v := range result.Releases {
+		pinned := v.Pinned
+		if pinned == "" {
+			pinned = "(unpinned)"
+		}
+		switch {
+		case v.Local:
+			printf("  · %s: %s is a local chart\n", v.Release, v.Chart)
+		case v.Error != "":
+			printf("  ✗ %s: %s %s: %s\n", v.Release, v.Chart, pinned, v.Error)
+		case v.Outdated:
+			outdated++
+			printf("  ⬆ %s: %s %s → %s available\n", v.Release, v.Chart, pinned, v.Latest)
+		default:
+			printf("  ✓ %s: %s %s (latest %s)\n", v.Release, v.Chart, pinned, v.Latest)
+		}
+	}
+	printf("%d of %d release(s) have a newer chart\n", outdated, len(result.Releases))
+
+	for _, u := range result.Updated {
+		printf("Updated %s: %s → %s in %s\n", u.Release, u.From, u.To, filepath.Base(u.File))
+	}
+	for _, warning := range result.Warnings {
+		printf("⚠️  %s\n", warning)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/filesync"
+)
+
+// consoleReporter prints what a sync --watch session does
+type consoleReporter struct {
+	dryRun bool
+}
+
+func (r consoleReporter) Started(paths int) {
+	printf("\n👀 Watching %d path(s) for changes, press Ctrl+C to stop\n", paths)
+}
+
+func (r consoleReporter) Changed(what string) {
+	printf("\n↻ %s changed\n", what)
+}
+
+func (r consoleReporter) Building(release string) {
+	printf("  ⚙ %s: building\n", release)
+}
+
+func (r consoleReporter) Syncing(release string) {}
+
+func (r consoleReporter) Synced(release string, took time.Duration, err error) {
+	if err != nil {
+		printf("  ✗ %s: %v\n", release, err)
+		return
+	}
+	printf("  ✓ %s (%s)\n", release, took.Round(time.Millisecond))
+}
+
+func (r consoleReporter) FilesSynced(change filesync.Change, pods []string, err error) {
+	files := len(change.Updated) + len(change.Removed)
+	switch {
+	case err != nil:
+		printf("  ✗ %s: file sync failed: %v\n", change.Release, err)
+	case r.dryRun:
+		printf("  ⇄ %s: would sync %d file(s) to %s\n", change.Release, files, change.Sync.Dest)
+	default:
+		printf("  ⇄ %s: synced %d file(s) to %s in %s\n", change.Release, files, change.Sync.Dest, strings.Join(pods, ", "))
+	}
+}
+
+func (r consoleReporter) Failed(err error) {
+	printf("  ✗ %v\n", err)
+}
+
+func (r consoleReporter) Stopped() {
+	printLine("\n✓ Stopped watching")
+}
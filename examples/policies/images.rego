@@ -0,0 +1,28 @@
+package helmfire
+
+import rego.v1
+
+workload_kinds := {"Deployment", "StatefulSet", "DaemonSet", "Job"}
+
+containers contains c if {
+	workload_kinds[input.kind]
+	some c in input.spec.template.spec.containers
+}
+
+containers contains c if {
+	input.kind == "CronJob"
+	some c in input.spec.jobTemplate.spec.template.spec.containers
+}
+
+deny contains msg if {
+	some c in containers
+	endswith(c.image, ":latest")
+	msg := sprintf("container %s uses the latest tag (%s)", [c.name, c.image])
+}
+
+deny contains msg if {
+	some c in containers
+	not contains(c.image, ":")
+	not contains(c.image, "@")
+	msg := sprintf("container %s has no image tag (%s)", [c.name, c.image])
+}
@@ -0,0 +1,15 @@
+package helmfire
+
+import rego.v1
+
+deny contains msg if {
+	some c in containers
+	not c.resources.limits.memory
+	msg := sprintf("container %s has no memory limit", [c.name])
+}
+
+warn contains msg if {
+	some c in containers
+	not c.resources.requests.cpu
+	msg := sprintf("container %s has no CPU request", [c.name])
+}
@@ -0,0 +1,189 @@
+// Package audit records changes to substitutions in an append-only log
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionAdd    = "add"
+	ActionRemove = "remove"
+	ActionExpire = "expire"
+)
+
+// Kinds of substitutions
+const (
+	KindChart = "chart"
+	KindImage = "image"
+)
+
+// Origins of a change
+const (
+	ViaCLI    = "cli"
+	ViaAPI    = "api"
+	ViaDaemon = "daemon"
+)
+
+// Entry is one change to a substitution
+type Entry struct {
+	Time       time.Time `json:"time"`
+	Action     string    `json:"action"`
+	Kind       string    `json:"kind"`
+	Original   string    `json:"original"`
+	Target     string    `json:"target,omitempty"`
+	Release    string    `json:"release,omitempty"`
+	Namespace  string    `json:"namespace,omitempty"`
+	Via        string    `json:"via"`
+	User       string    `json:"user,omitempty"`
+	RemoteAddr string    `json:"remoteAddr,omitempty"`
+}
+
+// Filter selects audit log entries; zero fields match everything
+type Filter struct {
+	Kind     string
+	Original string
+	// Limit keeps only the most recent entries
+	Limit int
+}
+
+// Matches reports whether an entry passes the filter
+func (f Filter) Matches(e Entry) bool {
+	if f.Kind != "" && e.Kind != f.Kind {
+		return false
+	}
+	if f.Original != "" && e.Original != f.Original {
+		return false
+	}
+	return true
+}
+
+// Log is an append-only audit log stored as JSON lines
+type Log struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewLog creates an audit log backed by the file at path
+func NewLog(path string) *Log {
+	return &Log{path: path}
+}
+
+// Path returns the file backing the log
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Record appends an entry, stamping it with the current time if unset
+func (l *Log) Record(e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// Entries returns the entries matching filter, oldest first. A missing log
+// has no entries.
+func (l *Log) Entries(filter Filter) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("failed to parse audit log line %d: %w", lineNo, err)
+		}
+		if filter.Matches(e) {
+			entries = append(entries, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[len(entries)-filter.Limit:]
+	}
+	return entries, nil
+}
+
+// CurrentUser returns the name of the user running helmfire
+func CurrentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// SnapshotEntries returns an entry for every substitution in a snapshot, for
+// recording bulk changes such as imports
+func SnapshotEntries(action string, s substitute.Snapshot) []Entry {
+	var entries []Entry
+	for _, c := range s.Charts {
+		entries = append(entries, Entry{
+			Action:    action,
+			Kind:      KindChart,
+			Original:  c.Original,
+			Target:    c.Path,
+			Release:   c.Release,
+			Namespace: c.Namespace,
+		})
+	}
+	for _, img := range s.Images {
+		entries = append(entries, Entry{
+			Action:    action,
+			Kind:      KindImage,
+			Original:  img.Original,
+			Target:    img.Replacement,
+			Release:   img.Release,
+			Namespace: img.Namespace,
+		})
+	}
+	return entries
+}
@@ -0,0 +1,105 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLogRecordAndEntries(t *testing.T) {
+	log := NewLog(filepath.Join(t.TempDir(), "nested", "audit.log"))
+
+	entries, err := log.Entries(Filter{})
+	if err != nil {
+		t.Fatalf("Entries on missing log: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected no entries, got %d", len(entries))
+	}
+
+	records := []Entry{
+		{Action: ActionAdd, Kind: KindChart, Original: "bitnami/nginx", Target: "./nginx", Via: ViaCLI, User: "alice"},
+		{Action: ActionAdd, Kind: KindImage, Original: "nginx:1.21", Target: "local/nginx:dev", Via: ViaAPI, RemoteAddr: "127.0.0.1:5000"},
+		{Action: ActionRemove, Kind: KindChart, Original: "bitnami/nginx", Via: ViaAPI, Release: "web"},
+		{Action: ActionExpire, Kind: KindChart, Original: "bitnami/redis", Via: ViaDaemon},
+	}
+	for _, e := range records {
+		if err := log.Record(e); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"all", Filter{}, []string{"bitnami/nginx", "nginx:1.21", "bitnami/nginx", "bitnami/redis"}},
+		{"charts", Filter{Kind: KindChart}, []string{"bitnami/nginx", "bitnami/nginx", "bitnami/redis"}},
+		{"original", Filter{Original: "bitnami/nginx"}, []string{"bitnami/nginx", "bitnami/nginx"}},
+		{"limit keeps latest", Filter{Kind: KindChart, Limit: 1}, []string{"bitnami/redis"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := log.Entries(tt.filter)
+			if err != nil {
+				t.Fatalf("Entries: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d entries, want %d", len(got), len(tt.want))
+			}
+			for i, e := range got {
+				if e.Original != tt.want[i] {
+					t.Errorf("entry %d: got %s, want %s", i, e.Original, tt.want[i])
+				}
+				if e.Time.IsZero() {
+					t.Errorf("entry %d has no timestamp", i)
+				}
+			}
+		})
+	}
+}
+
+func TestLogAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	when := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	if err := NewLog(path).Record(Entry{Time: when, Action: ActionAdd, Kind: KindChart, Original: "a", Via: ViaCLI}); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewLog(path).Record(Entry{Action: ActionRemove, Kind: KindChart, Original: "a", Via: ViaCLI}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := NewLog(path).Entries(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if !entries[0].Time.Equal(when) {
+		t.Errorf("expected recorded time to be kept, got %s", entries[0].Time)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected audit log mode 0600, got %v", info.Mode().Perm())
+	}
+}
+
+func TestEntriesRejectsCorruptLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	if err := os.WriteFile(path, []byte("{\"action\":\"add\"}\nnot json\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewLog(path).Entries(Filter{}); err == nil {
+		t.Fatal("expected an error for a corrupt line")
+	}
+}
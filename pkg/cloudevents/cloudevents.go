@@ -0,0 +1,163 @@
+// Package cloudevents delivers events to external automation in the
+// CloudEvents 1.0 structured JSON format, over HTTP or NATS.
+package cloudevents
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/httpclient"
+	"github.com/oleksiyp/helmfire/pkg/nats"
+)
+
+// SpecVersion is the CloudEvents version events are encoded in
+const SpecVersion = "1.0"
+
+// ContentType is the media type of an event in structured mode
+const ContentType = "application/cloudevents+json"
+
+// TypePrefix prefixes the types of helmfire's events, e.g.
+// io.helmfire.drift
+const TypePrefix = "io.helmfire."
+
+// DefaultSubject is the NATS subject events are published to by default
+const DefaultSubject = "helmfire.events"
+
+// sendTimeout bounds delivering an event
+const sendTimeout = 10 * time.Second
+
+// Event is a CloudEvent. Source and ID identify it uniquely; Subject names
+// the release it is about, if any.
+type Event struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+}
+
+// New returns an event of type TypePrefix+eventType with data encoded as
+// JSON
+func New(source, id, eventType, subject string, t time.Time, data interface{}) (Event, error) {
+	event := Event{
+		SpecVersion: SpecVersion,
+		ID:          id,
+		Source:      source,
+		Type:        TypePrefix + eventType,
+		Subject:     subject,
+		Time:        t.UTC(),
+	}
+	if data != nil {
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			return Event{}, fmt.Errorf("failed to encode event data: %w", err)
+		}
+		event.Data = encoded
+		event.DataContentType = "application/json"
+	}
+	return event, nil
+}
+
+// Sink delivers events
+type Sink interface {
+	Send(ctx context.Context, event Event) error
+}
+
+// NewSink returns the sink of target: an http:// or https:// URL events
+// are posted to, or a nats:// or tls:// URL (a comma-separated list for a
+// cluster) whose subject they are published to, DefaultSubject when "".
+func NewSink(target, subject string) (Sink, error) {
+	u, err := url.Parse(strings.SplitN(target, ",", 2)[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid event sink %q: %w", target, err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return NewHTTPSink(target), nil
+	case "nats", "tls":
+		if subject == "" {
+			subject = DefaultSubject
+		}
+		return NewNATSSink(target, subject)
+	}
+	return nil, fmt.Errorf("invalid event sink %q: must be an http, https, nats or tls URL", target)
+}
+
+// HTTPSink posts each event to a URL
+type HTTPSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPSink creates a sink posting to url through the default proxy of
+// package httpclient
+func NewHTTPSink(url string) *HTTPSink {
+	return &HTTPSink{url: url, client: httpclient.New(sendTimeout)}
+}
+
+// Send posts the event in structured mode
+func (s *HTTPSink) Send(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create event request: %w", err)
+	}
+	req.Header.Set("Content-Type", ContentType)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send event: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("event sink returned non-2xx status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// NATSSink publishes each event to a NATS subject
+type NATSSink struct {
+	publisher *nats.Publisher
+	subject   string
+}
+
+// NewNATSSink creates a sink publishing to subject on the servers of urls
+func NewNATSSink(urls, subject string) (*NATSSink, error) {
+	publisher, err := nats.NewPublisher(urls)
+	if err != nil {
+		return nil, err
+	}
+	return &NATSSink{publisher: publisher, subject: subject}, nil
+}
+
+// Send publishes the event in structured mode
+func (s *NATSSink) Send(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	if err := s.publisher.Publish(ctx, s.subject, payload); err != nil {
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+	return nil
+}
+
+// Close closes the connection to NATS
+func (s *NATSSink) Close() error {
+	return s.publisher.Close()
+}
@@ -0,0 +1,74 @@
+package cloudevents
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPSink(t *testing.T) {
+	var contentType string
+	var received Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &received)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	sink, err := NewSink(server.URL, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	event, err := New("/helmfire/ci", "abc-1", "drift", "web/nginx", at, map[string]string{"severity": "high"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Send(context.Background(), event); err != nil {
+		t.Fatalf("Send() failed: %v", err)
+	}
+
+	if contentType != ContentType {
+		t.Errorf("Content-Type = %q, want %q", contentType, ContentType)
+	}
+	if received.SpecVersion != "1.0" || received.Type != "io.helmfire.drift" || received.Subject != "web/nginx" ||
+		received.ID != "abc-1" || !received.Time.Equal(at) || received.DataContentType != "application/json" {
+		t.Errorf("unexpected event: %+v", received)
+	}
+	if string(received.Data) != `{"severity":"high"}` {
+		t.Errorf("unexpected data: %s", received.Data)
+	}
+}
+
+func TestHTTPSinkError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	if err := NewHTTPSink(server.URL).Send(context.Background(), Event{}); err == nil {
+		t.Error("expected a non-2xx status to fail")
+	}
+}
+
+func TestNewSink(t *testing.T) {
+	sink, err := NewSink("nats://nats-1:4222,nats://nats-2:4222", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nats, ok := sink.(*NATSSink); !ok || nats.subject != DefaultSubject {
+		t.Errorf("expected a NATS sink on %s, got %#v", DefaultSubject, sink)
+	}
+
+	for _, target := range []string{"", "kafka://broker:9092", "hooks.example.com/events"} {
+		if _, err := NewSink(target, ""); err == nil {
+			t.Errorf("NewSink(%q) succeeded, want error", target)
+		}
+	}
+}
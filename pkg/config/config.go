@@ -0,0 +1,81 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/drift"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvConfigPath overrides the default config file location
+const EnvConfigPath = "HELMFIRE_CONFIG"
+
+// Config represents the helmfire configuration file
+type Config struct {
+	Notifiers []drift.NotifierConfig `yaml:"notifiers,omitempty"`
+
+	// SubstitutionProviders supply chart and image substitutions at sync
+	// time
+	SubstitutionProviders []substitute.ProviderConfig `yaml:"substitutionProviders,omitempty"`
+
+	// Drift and Watch configure the daemon where its flags don't; the
+	// daemon rereads them when it reloads its configuration
+	Drift DriftConfig `yaml:"drift,omitempty"`
+	Watch WatchConfig `yaml:"watch,omitempty"`
+}
+
+// DriftConfig configures the daemon's drift detection
+type DriftConfig struct {
+	Interval time.Duration `yaml:"interval,omitempty"`
+	Webhook  string        `yaml:"webhook,omitempty"`
+}
+
+// WatchConfig lists more helmfiles, or directories of them, the daemon
+// merges after those given with -f
+type WatchConfig struct {
+	Paths []string `yaml:"paths,omitempty"`
+}
+
+// DefaultPath returns the config file path from HELMFIRE_CONFIG or ~/.helmfire/config.yaml
+func DefaultPath() string {
+	if path := os.Getenv(EnvConfigPath); path != "" {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".helmfire", "config.yaml")
+}
+
+// Load reads the config file at path. An empty path loads DefaultPath, and a
+// missing default file yields an empty config; an explicitly given path must exist.
+func Load(path string) (*Config, error) {
+	explicit := path != ""
+	if !explicit {
+		path = DefaultPath()
+	}
+	if path == "" {
+		return &Config{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !explicit {
+			return &Config{}, nil
+		}
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	cfg := &Config{}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `
+notifiers:
+  - type: webhook
+    url: https://hooks.example.com/drift
+  - type: exec
+    command: notify-send
+substitutionProviders:
+  - name: builds
+    command: build-images
+    timeout: 10s
+drift:
+  interval: 5m
+watch:
+  paths: [shared/helmfile.yaml]
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if len(cfg.Notifiers) != 2 {
+		t.Fatalf("expected 2 notifiers, got %d", len(cfg.Notifiers))
+	}
+	if cfg.Notifiers[0].Type != "webhook" {
+		t.Errorf("expected webhook, got %s", cfg.Notifiers[0].Type)
+	}
+	if cfg.Notifiers[0].String("url") != "https://hooks.example.com/drift" {
+		t.Errorf("unexpected url: %s", cfg.Notifiers[0].String("url"))
+	}
+	if len(cfg.SubstitutionProviders) != 1 || cfg.SubstitutionProviders[0].Timeout != "10s" {
+		t.Errorf("unexpected substitution providers: %+v", cfg.SubstitutionProviders)
+	}
+	if cfg.Drift.Interval != 5*time.Minute || len(cfg.Watch.Paths) != 1 {
+		t.Errorf("unexpected drift or watch settings: %+v %+v", cfg.Drift, cfg.Watch)
+	}
+}
+
+func TestLoadMissingDefault(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(EnvConfigPath, "")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("expected missing default config to be ignored, got %v", err)
+	}
+	if len(cfg.Notifiers) != 0 {
+		t.Errorf("expected empty config, got %+v", cfg)
+	}
+}
+
+func TestLoadMissingExplicit(t *testing.T) {
+	if _, err := Load("/nonexistent/config.yaml"); err == nil {
+		t.Fatal("expected error for missing explicit config")
+	}
+}
@@ -0,0 +1,311 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"gopkg.in/yaml.v3"
+)
+
+// AccessAction is a change a scoped API token may be allowed to make
+type AccessAction string
+
+// Actions a scoped token may be allowed; everything else that changes the
+// daemon, such as pausing it or importing substitutions, takes an admin token
+const (
+	AccessSubstitute AccessAction = "substitute" // add and remove substitutions
+	AccessSync       AccessAction = "sync"       // sync releases
+	AccessHeal       AccessAction = "heal"       // check and heal drift
+	AccessRollback   AccessAction = "rollback"   // roll back releases
+	AccessValues     AccessAction = "values"     // overlay release values
+)
+
+var accessActions = []AccessAction{AccessSubstitute, AccessSync, AccessHeal, AccessRollback, AccessValues}
+
+// AccessPolicy restricts the API to callers presenting one of its tokens as
+// "Authorization: Bearer <token>". Any token may read; changes are limited
+// to the token's scopes and actions.
+type AccessPolicy struct {
+	Tokens []AccessToken `yaml:"tokens"`
+}
+
+// AccessToken is an API token and what its caller may change
+type AccessToken struct {
+	// Name identifies the caller in logs and the audit log
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
+
+	// Admin may make any request
+	Admin bool `yaml:"admin,omitempty"`
+
+	// Scopes are the releases the caller may change, written as release,
+	// namespace/release, namespace/* or * for all. Without scopes the token
+	// only reads.
+	Scopes []string `yaml:"scopes,omitempty"`
+
+	// Actions limit what the caller may do within its scopes; all of them
+	// when empty
+	Actions []AccessAction `yaml:"actions,omitempty"`
+
+	scopes []substitute.Scope
+}
+
+// LoadAccessPolicy reads an access policy from a YAML file
+func LoadAccessPolicy(path string) (*AccessPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read access policy: %w", err)
+	}
+
+	var policy AccessPolicy
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("failed to parse access policy %s: %w", path, err)
+	}
+	if err := policy.compile(); err != nil {
+		return nil, fmt.Errorf("invalid access policy %s: %w", path, err)
+	}
+	return &policy, nil
+}
+
+// compile checks the policy and parses the scopes of its tokens
+func (p *AccessPolicy) compile() error {
+	if len(p.Tokens) == 0 {
+		return fmt.Errorf("no tokens")
+	}
+	names := make(map[string]bool)
+	tokens := make(map[string]bool)
+	for i := range p.Tokens {
+		t := &p.Tokens[i]
+		if t.Name == "" {
+			return fmt.Errorf("token %d: name is required", i+1)
+		}
+		if t.Token == "" {
+			return fmt.Errorf("token %s: token is required", t.Name)
+		}
+		if names[t.Name] {
+			return fmt.Errorf("token %s: duplicate name", t.Name)
+		}
+		if tokens[t.Token] {
+			return fmt.Errorf("token %s: token is already used by another entry", t.Name)
+		}
+		names[t.Name], tokens[t.Token] = true, true
+
+		for _, action := range t.Actions {
+			if !validAccessAction(action) {
+				return fmt.Errorf("token %s: unknown action %q", t.Name, action)
+			}
+		}
+		t.scopes = nil
+		for _, raw := range t.Scopes {
+			scope, err := parseAccessScope(raw)
+			if err != nil {
+				return fmt.Errorf("token %s: %w", t.Name, err)
+			}
+			t.scopes = append(t.scopes, scope)
+		}
+	}
+	return nil
+}
+
+// validAccessAction reports whether action is one of accessActions
+func validAccessAction(action AccessAction) bool {
+	for _, a := range accessActions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAccessScope parses a scope written as substitute.Scope.String does
+func parseAccessScope(raw string) (substitute.Scope, error) {
+	if raw == "*" {
+		return substitute.Scope{}, nil
+	}
+	namespace, release, hasNamespace := strings.Cut(raw, "/")
+	if !hasNamespace {
+		release, namespace = namespace, ""
+	}
+	if release == "*" {
+		release = ""
+	}
+	if (hasNamespace && namespace == "") || (!hasNamespace && release == "") || strings.Contains(release, "/") {
+		return substitute.Scope{}, fmt.Errorf("invalid scope %q (expected release, namespace/release, namespace/* or *)", raw)
+	}
+	return substitute.Scope{Release: release, Namespace: namespace}, nil
+}
+
+// lookup returns the entry of token, or nil for an unknown token
+func (p *AccessPolicy) lookup(token string) *AccessToken {
+	if token == "" {
+		return nil
+	}
+	var found *AccessToken
+	for i := range p.Tokens {
+		if subtle.ConstantTimeCompare([]byte(p.Tokens[i].Token), []byte(token)) == 1 {
+			found = &p.Tokens[i]
+		}
+	}
+	return found
+}
+
+// may reports whether the caller may take action on releases in scope: a
+// substitution scope, or the scope of a single release
+func (t *AccessToken) may(action AccessAction, scope substitute.Scope) bool {
+	if t.Admin {
+		return true
+	}
+	if len(t.Actions) > 0 {
+		allowed := false
+		for _, a := range t.Actions {
+			allowed = allowed || a == action
+		}
+		if !allowed {
+			return false
+		}
+	}
+	for _, granted := range t.scopes {
+		if granted.Matches(scope.Release, scope.Namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// accessControl holds the daemon's access policy, replaced on reload
+type accessControl struct {
+	mu     sync.RWMutex
+	policy *AccessPolicy
+}
+
+// setAccessPolicy replaces the access policy; nil lets anyone call the API
+func (d *Daemon) setAccessPolicy(policy *AccessPolicy) {
+	d.access.mu.Lock()
+	defer d.access.mu.Unlock()
+	d.access.policy = policy
+}
+
+// accessPolicy returns the access policy, or nil when the API is open
+func (d *Daemon) accessPolicy() *AccessPolicy {
+	d.access.mu.RLock()
+	defer d.access.mu.RUnlock()
+	return d.access.policy
+}
+
+type callerKey struct{}
+
+// Caller returns the token entry of the caller of the API request handled
+// under ctx, or nil when the API has no access policy
+func Caller(ctx context.Context) *AccessToken {
+	caller, _ := ctx.Value(callerKey{}).(*AccessToken)
+	return caller
+}
+
+// authenticate rejects requests without a known token when the daemon has
+// an access policy, and changes by scoped tokens on routes whose handlers
+// don't check scopes. Health checks and the API description stay open.
+func (h *APIHandler) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var policy *AccessPolicy
+		if h.daemon != nil {
+			policy = h.daemon.accessPolicy()
+		}
+		if policy == nil || publicPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		caller := policy.lookup(strings.TrimSpace(token))
+		if caller == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="helmfire"`)
+			h.sendErrorCode(w, CodeUnauthorized, "Missing or unknown API token", http.StatusUnauthorized)
+			return
+		}
+		if !caller.Admin && !readOnlyMethod(r.Method) && !scopedRoute(r) {
+			h.sendErrorCode(w, CodeForbidden, fmt.Sprintf("Token %s may not %s %s: it takes an admin token", caller.Name, r.Method, r.URL.Path), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callerKey{}, caller)))
+	})
+}
+
+// publicPath reports whether path is served without a token
+func publicPath(path string) bool {
+	switch path {
+	case "/health", "/healthz", "/readyz", "/api/v1/openapi.json":
+		return true
+	}
+	return false
+}
+
+// readOnlyMethod reports whether requests with method change nothing
+func readOnlyMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// scopedRoute reports whether the handler of r checks the caller's scopes
+// with authorize
+func scopedRoute(r *http.Request) bool {
+	path := r.URL.Path
+	switch {
+	case path == "/api/v1/charts" || path == "/api/v1/images" || path == "/api/v1/substitutions":
+		return true
+	case strings.HasPrefix(path, chartsPrefix) || strings.HasPrefix(path, imagesPrefix):
+		return true
+	case path == "/api/v1/sync" || path == "/api/v1/rollback" || path == "/api/v1/drift/check" || path == "/api/v1/drift/heal":
+		return true
+	case strings.HasPrefix(path, "/api/v1/drift/") && strings.HasSuffix(path, "/heal"):
+		return true
+	case strings.HasPrefix(path, "/api/v1/releases/") && strings.HasSuffix(path, "/values"):
+		return true
+	}
+	return false
+}
+
+// authorize answers 403 unless the caller may take action on every scope
+func (h *APIHandler) authorize(w http.ResponseWriter, r *http.Request, action AccessAction, scopes ...substitute.Scope) bool {
+	caller := Caller(r.Context())
+	if caller == nil {
+		return true
+	}
+	for _, scope := range scopes {
+		if !caller.may(action, scope) {
+			h.sendErrorCode(w, CodeForbidden, fmt.Sprintf("Token %s may not %s %s", caller.Name, action, scope), http.StatusForbidden)
+			return false
+		}
+	}
+	return true
+}
+
+// authorizeReleases answers 403 unless the caller may take action on every
+// release
+func (h *APIHandler) authorizeReleases(w http.ResponseWriter, r *http.Request, action AccessAction, releases ...helmstate.Release) bool {
+	scopes := make([]substitute.Scope, len(releases))
+	for i, release := range releases {
+		scopes[i] = substitute.Scope{Release: release.Name, Namespace: release.Namespace}
+	}
+	return h.authorize(w, r, action, scopes...)
+}
+
+// substitutionScope returns the scope a substitution applies to, with the
+// namespace of the release it is scoped to, so that namespace grants cover
+// release-scoped substitutions
+func (h *APIHandler) substitutionScope(scope substitute.Scope) substitute.Scope {
+	if scope.Release != "" && scope.Namespace == "" {
+		if release, err := h.daemon.findRelease(scope.Release); err == nil {
+			scope.Namespace = release.Namespace
+		}
+	}
+	return scope
+}
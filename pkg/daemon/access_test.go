@@ -0,0 +1,167 @@
+package daemon
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oleksiyp/helmfire/pkg/audit"
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+)
+
+const testAccessPolicy = `tokens:
+  - name: ops
+    token: ops-token
+    admin: true
+  - name: payments
+    token: payments-token
+    scopes: ["payments/*", "shared"]
+    actions: [substitute]
+  - name: viewer
+    token: viewer-token
+`
+
+func writeAccessPolicy(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "access.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadAccessPolicy(t *testing.T) {
+	policy, err := LoadAccessPolicy(writeAccessPolicy(t, testAccessPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caller := policy.lookup("payments-token"); caller == nil || caller.Name != "payments" {
+		t.Fatalf("expected the payments token, got %+v", caller)
+	}
+	if policy.lookup("") != nil || policy.lookup("unknown") != nil {
+		t.Error("expected unknown tokens not to be found")
+	}
+
+	for _, content := range []string{
+		"tokens: []",
+		"tokens:\n  - name: a\n",
+		"tokens:\n  - token: a\n",
+		"tokens:\n  - name: a\n    token: x\n  - name: b\n    token: x\n",
+		"tokens:\n  - name: a\n    token: x\n    actions: [deploy]\n",
+		"tokens:\n  - name: a\n    token: x\n    scopes: [a/b/c]\n",
+		"tokens:\n  - name: a\n    token: x\n    role: admin\n",
+	} {
+		if _, err := LoadAccessPolicy(writeAccessPolicy(t, content)); err == nil {
+			t.Errorf("expected an error for %q", content)
+		}
+	}
+}
+
+func TestAccessTokenMay(t *testing.T) {
+	policy, err := LoadAccessPolicy(writeAccessPolicy(t, testAccessPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payments := policy.lookup("payments-token")
+
+	tests := []struct {
+		action AccessAction
+		scope  substitute.Scope
+		want   bool
+	}{
+		{AccessSubstitute, substitute.Scope{Release: "api", Namespace: "payments"}, true},
+		{AccessSubstitute, substitute.Scope{Namespace: "payments"}, true},
+		{AccessSubstitute, substitute.Scope{Release: "shared", Namespace: "frontend"}, true},
+		{AccessSubstitute, substitute.Scope{Release: "web", Namespace: "frontend"}, false},
+		{AccessSubstitute, substitute.Scope{Release: "api"}, false},
+		{AccessSubstitute, substitute.Scope{}, false},
+		{AccessSync, substitute.Scope{Release: "api", Namespace: "payments"}, false},
+	}
+	for _, tt := range tests {
+		if got := payments.may(tt.action, tt.scope); got != tt.want {
+			t.Errorf("may(%s, %s) = %v, want %v", tt.action, tt.scope, got, tt.want)
+		}
+	}
+	if !policy.lookup("ops-token").may(AccessSync, substitute.Scope{}) {
+		t.Error("expected an admin to sync everything")
+	}
+	if policy.lookup("viewer-token").may(AccessSubstitute, substitute.Scope{Release: "api", Namespace: "payments"}) {
+		t.Error("expected a token without scopes to change nothing")
+	}
+}
+
+func TestAccessPolicyEnforced(t *testing.T) {
+	server, handler := newTestServer(t)
+	handler.daemon.manager.Spec.Releases = []helmstate.Release{
+		{Name: "api", Namespace: "payments"},
+		{Name: "web", Namespace: "frontend"},
+	}
+	policy, err := LoadAccessPolicy(writeAccessPolicy(t, testAccessPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler.daemon.setAccessPolicy(policy)
+
+	do := func(method, path, token, body string) int {
+		t.Helper()
+		req, err := http.NewRequest(method, server.URL+path, bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	tests := []struct {
+		name                string
+		method, path, token string
+		body                string
+		want                int
+	}{
+		{"health checks stay open", http.MethodGet, "/healthz", "", "", http.StatusOK},
+		{"no token", http.MethodGet, "/api/v1/substitutions", "", "", http.StatusUnauthorized},
+		{"unknown token", http.MethodGet, "/api/v1/substitutions", "guess", "", http.StatusUnauthorized},
+		{"any token reads", http.MethodGet, "/api/v1/substitutions", "viewer-token", "", http.StatusOK},
+		{"read-only token", http.MethodPost, "/api/v1/images", "viewer-token", `{"original": "nginx", "replacement": "nginx:dev", "namespace": "payments"}`, http.StatusForbidden},
+		{"release in scope", http.MethodPost, "/api/v1/images", "payments-token", `{"original": "nginx", "replacement": "nginx:dev", "release": "api"}`, http.StatusOK},
+		{"release out of scope", http.MethodPost, "/api/v1/images", "payments-token", `{"original": "nginx", "replacement": "nginx:dev", "release": "web"}`, http.StatusForbidden},
+		{"global substitution", http.MethodPost, "/api/v1/images", "payments-token", `{"original": "nginx", "replacement": "nginx:dev"}`, http.StatusForbidden},
+		{"bulk out of scope", http.MethodPut, "/api/v1/substitutions", "payments-token", `{"add": {"images": [{"original": "redis", "replacement": "redis:dev", "namespace": "frontend"}]}}`, http.StatusForbidden},
+		{"action not allowed", http.MethodPost, "/api/v1/sync", "payments-token", `{"releases": ["api"], "dryRun": true}`, http.StatusForbidden},
+		{"admin route", http.MethodPost, "/api/v1/resume", "payments-token", "", http.StatusForbidden},
+		{"admin", http.MethodPost, "/api/v1/resume", "ops-token", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := do(tt.method, tt.path, tt.token, tt.body); got != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+
+	entries, err := handler.daemon.audit.Entries(audit.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].User != "payments" {
+		t.Errorf("expected the change audited as the token's caller, got %+v", entries)
+	}
+
+	// The client presents the token from the environment
+	t.Setenv(EnvAPIToken, "payments-token")
+	client := NewAPIClient(strings.TrimPrefix(server.URL, "http://"))
+	if err := client.AddImageSubstitution("redis", "redis:dev", substitute.Scope{Namespace: "payments"}, 0); err != nil {
+		t.Errorf("expected the client to authenticate: %v", err)
+	}
+}
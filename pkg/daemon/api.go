@@ -3,10 +3,15 @@ package daemon
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/oleksiyp/helmfire/pkg/audit"
+	"github.com/oleksiyp/helmfire/pkg/drift"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
 	"go.uber.org/zap"
 )
 
@@ -34,38 +39,66 @@ func NewAPIServer(addr string, daemon *Daemon, logger *zap.Logger) *APIServer {
 
 	mux := http.NewServeMux()
 
-	// Health check
-	mux.HandleFunc("/health", handler.handleHealth)
+	// Liveness and readiness; /health is the original liveness route
+	mux.HandleFunc("/health", handler.handleHealthz)
+	mux.HandleFunc("/healthz", handler.handleHealthz)
+	mux.HandleFunc("/readyz", handler.handleReadyz)
+
+	// Prometheus metrics
+	mux.HandleFunc("/metrics", handler.handleMetrics)
 
 	// Status
 	mux.HandleFunc("/api/v1/status", handler.handleStatus)
 
-	// Chart substitutions
+	// Chart substitutions; /api/v1/charts/{original} is routed by
+	// withResourceRoutes
 	mux.HandleFunc("/api/v1/charts", handler.handleCharts)
-	mux.HandleFunc("/api/v1/charts/remove", handler.handleRemoveChart)
+	mux.HandleFunc(legacyRemoveChartPath, deprecated(handler.handleRemoveChart, chartsPrefix+"{original}"))
 
-	// Image substitutions
+	// Image substitutions; /api/v1/images/{original} is routed by
+	// withResourceRoutes
 	mux.HandleFunc("/api/v1/images", handler.handleImages)
-	mux.HandleFunc("/api/v1/images/remove", handler.handleRemoveImage)
+	mux.HandleFunc(legacyRemoveImagePath, deprecated(handler.handleRemoveImage, imagesPrefix+"{original}"))
 
 	// Substitutions list
 	mux.HandleFunc("/api/v1/substitutions", handler.handleSubstitutions)
+	mux.HandleFunc("/api/v1/substitutions/export", handler.handleExport)
+	mux.HandleFunc("/api/v1/substitutions/import", handler.handleImport)
+	mux.HandleFunc("/api/v1/audit", handler.handleAudit)
 
 	// Sync
+	mux.HandleFunc("/api/v1/releases", handler.handleReleases)
+	mux.HandleFunc("/api/v1/releases/", handler.handleReleaseValues)
 	mux.HandleFunc("/api/v1/sync", handler.handleSync)
+	mux.HandleFunc("/api/v1/syncs", handler.handleSyncs)
+	mux.HandleFunc("/api/v1/syncs/", handler.handleSyncRun)
+	mux.HandleFunc("/api/v1/rollback", handler.handleRollback)
+
+	// Rollout progress and other events
+	mux.HandleFunc("/api/v1/events", handler.handleEvents)
 
 	// Drift reports
 	mux.HandleFunc("/api/v1/drift", handler.handleDrift)
+	mux.HandleFunc("/api/v1/drift/check", handler.handleDriftCheck)
+	mux.HandleFunc("/api/v1/drift/heal", handler.handleHealRelease)
+	mux.HandleFunc("/api/v1/drift/config", handler.handleDriftConfig)
+	mux.HandleFunc("/api/v1/drift/", handler.handleDriftReport)
 
 	// Reload
 	mux.HandleFunc("/api/v1/reload", handler.handleReload)
+	mux.HandleFunc("/api/v1/config/reload", handler.handleConfigReload)
+	mux.HandleFunc("/api/v1/pause", handler.handlePause)
+	mux.HandleFunc("/api/v1/resume", handler.handleResume)
 
 	// Shutdown
 	mux.HandleFunc("/api/v1/shutdown", handler.handleShutdown)
 
+	// API description
+	mux.HandleFunc("/api/v1/openapi.json", handler.handleOpenAPI)
+
 	server := &http.Server{
 		Addr:    addr,
-		Handler: mux,
+		Handler: handler.withMiddleware(handler.withResourceRoutes(mux), daemon.apiMiddleware),
 	}
 
 	return &APIServer{
@@ -95,16 +128,10 @@ func (s *APIServer) Stop() error {
 	return s.server.Shutdown(ctx)
 }
 
-// handleHealth handles health check requests
-func (h *APIHandler) handleHealth(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
-}
-
 // handleStatus handles status requests
 func (h *APIHandler) handleStatus(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		h.methodNotAllowed(w)
 		return
 	}
 
@@ -113,113 +140,443 @@ func (h *APIHandler) handleStatus(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(status)
 }
 
-// handleCharts handles chart substitution requests
+// handleCharts lists chart substitutions (GET) or adds one (POST)
 func (h *APIHandler) handleCharts(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ChartsResponse{Charts: NewSubstitutionsResponse(h.daemon.GetSubstitutor()).Charts})
+	case http.MethodPost:
+		var req AddChartRequest
+		if err := decodeRequest(r, &req); err != nil {
+			h.sendError(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		h.addChart(w, r, req)
+	default:
+		h.methodNotAllowed(w)
+	}
+}
+
+// addChart adds a chart substitution and reports compatibility warnings
+func (h *APIHandler) addChart(w http.ResponseWriter, r *http.Request, req AddChartRequest) {
+	if err := req.Validate(); err != nil {
+		h.sendValidationError(w, err)
 		return
 	}
 
-	var req AddChartRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.sendError(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+	ttl, err := parseTTL(req.TTL)
+	if err != nil {
+		h.sendError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	scope := substitute.Scope{Release: req.Release, Namespace: req.Namespace}
+	if !h.authorize(w, r, AccessSubstitute, h.substitutionScope(scope)) {
+		return
+	}
 	substitutor := h.daemon.GetSubstitutor()
-	if err := substitutor.AddChartSubstitution(req.Original, req.LocalPath); err != nil {
+	if err := substitutor.AddScopedChartSubstitution(req.Original, req.LocalPath, scope); err != nil {
 		h.sendError(w, fmt.Sprintf("Failed to add chart substitution: %v", err), http.StatusBadRequest)
 		return
 	}
+	substitutor.SetChartTTL(req.Original, scope, ttl)
+
+	warnings, err := h.daemon.GetExecutor().CheckChartSubstitution(r.Context(), req.Original, scope, h.daemon.GetManager().GetReleases())
+	if err != nil {
+		warnings = []string{fmt.Sprintf("compatibility check failed: %v", err)}
+	}
+	for _, warning := range warnings {
+		h.logger.Warn("chart substitution may be incompatible",
+			zap.String("original", req.Original),
+			zap.String("warning", warning))
+	}
+	if req.Strict && len(warnings) > 0 {
+		substitutor.RemoveScopedChartSubstitution(req.Original, scope)
+		h.sendErrorCode(w, CodeIncompatibleChart, fmt.Sprintf("Chart substitution rejected: %s", strings.Join(warnings, "; ")), http.StatusBadRequest)
+		return
+	}
 
 	h.logger.Info("chart substitution added via API",
 		zap.String("original", req.Original),
-		zap.String("local", req.LocalPath))
+		zap.String("local", req.LocalPath),
+		zap.Stringer("scope", scope))
+	h.auditRequest(r, audit.Entry{
+		Action:    audit.ActionAdd,
+		Kind:      audit.KindChart,
+		Original:  req.Original,
+		Target:    req.LocalPath,
+		Release:   scope.Release,
+		Namespace: scope.Namespace,
+	})
 
-	h.sendSuccess(w, fmt.Sprintf("Chart substitution added: %s → %s", req.Original, req.LocalPath))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AddChartResponse{
+		Message:  fmt.Sprintf("Chart substitution added: %s → %s", req.Original, req.LocalPath),
+		Warnings: warnings,
+	})
 }
 
-// handleRemoveChart handles chart substitution removal
+// handleRemoveChart handles chart substitution removal through the legacy
+// POST /api/v1/charts/remove route
 func (h *APIHandler) handleRemoveChart(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		h.methodNotAllowed(w)
 		return
 	}
 
 	var req RemoveChartRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := decodeRequest(r, &req); err != nil {
 		h.sendError(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
 		return
 	}
+	h.removeChart(w, r, req, http.StatusBadRequest)
+}
+
+// removeChart removes a chart substitution, answering notFoundStatus if it
+// doesn't exist
+func (h *APIHandler) removeChart(w http.ResponseWriter, r *http.Request, req RemoveChartRequest, notFoundStatus int) {
+	if err := req.Validate(); err != nil {
+		h.sendValidationError(w, err)
+		return
+	}
 
 	substitutor := h.daemon.GetSubstitutor()
-	if err := substitutor.RemoveChartSubstitution(req.Original); err != nil {
-		h.sendError(w, fmt.Sprintf("Failed to remove chart substitution: %v", err), http.StatusBadRequest)
+	scope := substitute.Scope{Release: req.Release, Namespace: req.Namespace}
+	if !h.authorize(w, r, AccessSubstitute, h.substitutionScope(scope)) {
+		return
+	}
+	if err := substitutor.RemoveScopedChartSubstitution(req.Original, scope); err != nil {
+		h.sendError(w, fmt.Sprintf("Failed to remove chart substitution: %v", err), notFoundStatus)
 		return
 	}
 
 	h.logger.Info("chart substitution removed via API", zap.String("original", req.Original))
+	h.auditRequest(r, audit.Entry{
+		Action:    audit.ActionRemove,
+		Kind:      audit.KindChart,
+		Original:  req.Original,
+		Release:   scope.Release,
+		Namespace: scope.Namespace,
+	})
 	h.sendSuccess(w, fmt.Sprintf("Chart substitution removed: %s", req.Original))
 }
 
-// handleImages handles image substitution requests
+// handleImages lists image substitutions (GET) or adds one (POST)
 func (h *APIHandler) handleImages(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ImagesResponse{Images: NewSubstitutionsResponse(h.daemon.GetSubstitutor()).Images})
+	case http.MethodPost:
+		var req AddImageRequest
+		if err := decodeRequest(r, &req); err != nil {
+			h.sendError(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		h.addImage(w, r, req)
+	default:
+		h.methodNotAllowed(w)
 	}
+}
 
-	var req AddImageRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.sendError(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+// addImage adds an image substitution
+func (h *APIHandler) addImage(w http.ResponseWriter, r *http.Request, req AddImageRequest) {
+	if err := req.Validate(); err != nil {
+		h.sendValidationError(w, err)
 		return
 	}
 
 	substitutor := h.daemon.GetSubstitutor()
-	if err := substitutor.AddImageSubstitution(req.Original, req.Replacement); err != nil {
+	ttl, err := parseTTL(req.TTL)
+	if err != nil {
+		h.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	scope := substitute.Scope{Release: req.Release, Namespace: req.Namespace}
+	if !h.authorize(w, r, AccessSubstitute, h.substitutionScope(scope)) {
+		return
+	}
+	if err := substitutor.AddScopedImageSubstitution(req.Original, req.Replacement, scope); err != nil {
 		h.sendError(w, fmt.Sprintf("Failed to add image substitution: %v", err), http.StatusBadRequest)
 		return
 	}
+	substitutor.SetImageTTL(req.Original, scope, ttl)
 
 	h.logger.Info("image substitution added via API",
 		zap.String("original", req.Original),
-		zap.String("replacement", req.Replacement))
+		zap.String("replacement", req.Replacement),
+		zap.Stringer("scope", scope))
+	h.auditRequest(r, audit.Entry{
+		Action:    audit.ActionAdd,
+		Kind:      audit.KindImage,
+		Original:  req.Original,
+		Target:    req.Replacement,
+		Release:   scope.Release,
+		Namespace: scope.Namespace,
+	})
 
 	h.sendSuccess(w, fmt.Sprintf("Image substitution added: %s → %s", req.Original, req.Replacement))
 }
 
-// handleRemoveImage handles image substitution removal
+// handleRemoveImage handles image substitution removal through the legacy
+// POST /api/v1/images/remove route
 func (h *APIHandler) handleRemoveImage(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		h.methodNotAllowed(w)
 		return
 	}
 
 	var req RemoveImageRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := decodeRequest(r, &req); err != nil {
 		h.sendError(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
 		return
 	}
+	h.removeImage(w, r, req, http.StatusBadRequest)
+}
+
+// removeImage removes an image substitution, answering notFoundStatus if it
+// doesn't exist
+func (h *APIHandler) removeImage(w http.ResponseWriter, r *http.Request, req RemoveImageRequest, notFoundStatus int) {
+	if err := req.Validate(); err != nil {
+		h.sendValidationError(w, err)
+		return
+	}
 
 	substitutor := h.daemon.GetSubstitutor()
-	if err := substitutor.RemoveImageSubstitution(req.Original); err != nil {
-		h.sendError(w, fmt.Sprintf("Failed to remove image substitution: %v", err), http.StatusBadRequest)
+	scope := substitute.Scope{Release: req.Release, Namespace: req.Namespace}
+	if !h.authorize(w, r, AccessSubstitute, h.substitutionScope(scope)) {
+		return
+	}
+	if err := substitutor.RemoveScopedImageSubstitution(req.Original, scope); err != nil {
+		h.sendError(w, fmt.Sprintf("Failed to remove image substitution: %v", err), notFoundStatus)
 		return
 	}
 
 	h.logger.Info("image substitution removed via API", zap.String("original", req.Original))
+	h.auditRequest(r, audit.Entry{
+		Action:    audit.ActionRemove,
+		Kind:      audit.KindImage,
+		Original:  req.Original,
+		Release:   scope.Release,
+		Namespace: scope.Namespace,
+	})
 	h.sendSuccess(w, fmt.Sprintf("Image substitution removed: %s", req.Original))
 }
 
-// handleSubstitutions handles listing all substitutions
+// handleSubstitutions handles listing all substitutions and bulk changes
 func (h *APIHandler) handleSubstitutions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(NewSubstitutionsResponse(h.daemon.GetSubstitutor()))
+	case http.MethodPut:
+		h.handleBulk(w, r)
+	default:
+		h.methodNotAllowed(w)
+	}
+}
+
+// handleBulk adds and removes substitutions in one transaction: either every
+// change is applied or none is
+func (h *APIHandler) handleBulk(w http.ResponseWriter, r *http.Request) {
+	var req BulkRequest
+	if err := decodeRequest(r, &req); err != nil {
+		h.sendError(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		h.sendValidationError(w, err)
+		return
+	}
+
+	batch, err := newBatch(req, time.Now())
+	if err != nil {
+		h.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.authorize(w, r, AccessSubstitute, h.batchScopes(batch)...) {
+		return
+	}
+
+	substitutor := h.daemon.GetSubstitutor()
+	if err := substitutor.ApplyBatch(batch); err != nil {
+		h.sendError(w, fmt.Sprintf("Bulk substitution failed, nothing was changed: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	for _, ref := range batch.RemoveCharts {
+		h.auditRequest(r, audit.Entry{Action: audit.ActionRemove, Kind: audit.KindChart, Original: ref.Original, Release: ref.Scope.Release, Namespace: ref.Scope.Namespace})
+	}
+	for _, ref := range batch.RemoveImages {
+		h.auditRequest(r, audit.Entry{Action: audit.ActionRemove, Kind: audit.KindImage, Original: ref.Original, Release: ref.Scope.Release, Namespace: ref.Scope.Namespace})
+	}
+	for _, entry := range audit.SnapshotEntries(audit.ActionAdd, batch.Add) {
+		h.auditRequest(r, entry)
+	}
+
+	var warnings []string
+	for _, c := range batch.Add.Charts {
+		chartWarnings, err := h.daemon.GetExecutor().CheckChartSubstitution(r.Context(), c.Original, c.Scope(), h.daemon.GetManager().GetReleases())
+		if err != nil {
+			chartWarnings = []string{fmt.Sprintf("compatibility check failed: %v", err)}
+		}
+		for _, warning := range chartWarnings {
+			warnings = append(warnings, fmt.Sprintf("%s: %s", c.Original, warning))
+		}
+	}
+
+	h.logger.Info("bulk substitution applied via API",
+		zap.Int("added", len(batch.Add.Charts)+len(batch.Add.Images)),
+		zap.Int("removed", len(batch.RemoveCharts)+len(batch.RemoveImages)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BulkResponse{
+		Message: fmt.Sprintf("Added %d and removed %d substitutions",
+			len(batch.Add.Charts)+len(batch.Add.Images), len(batch.RemoveCharts)+len(batch.RemoveImages)),
+		Warnings: warnings,
+	})
+}
+
+// newBatch converts a bulk request into a substitution batch, resolving TTLs
+// relative to now
+func newBatch(req BulkRequest, now time.Time) (substitute.Batch, error) {
+	var batch substitute.Batch
+
+	for _, c := range req.Add.Charts {
+		expiry, err := batchExpiry(c.TTL, now)
+		if err != nil {
+			return batch, err
+		}
+		batch.Add.Charts = append(batch.Add.Charts, substitute.SnapshotChart{
+			Original:  c.Original,
+			Path:      c.LocalPath,
+			Release:   c.Release,
+			Namespace: c.Namespace,
+			ExpiresAt: expiry,
+		})
+	}
+	for _, img := range req.Add.Images {
+		expiry, err := batchExpiry(img.TTL, now)
+		if err != nil {
+			return batch, err
+		}
+		batch.Add.Images = append(batch.Add.Images, substitute.SnapshotImage{
+			Original:    img.Original,
+			Replacement: img.Replacement,
+			Release:     img.Release,
+			Namespace:   img.Namespace,
+			ExpiresAt:   expiry,
+		})
+	}
+
+	for _, c := range req.Remove.Charts {
+		batch.RemoveCharts = append(batch.RemoveCharts, substitute.Ref{
+			Original: c.Original,
+			Scope:    substitute.Scope{Release: c.Release, Namespace: c.Namespace},
+		})
+	}
+	for _, img := range req.Remove.Images {
+		batch.RemoveImages = append(batch.RemoveImages, substitute.Ref{
+			Original: img.Original,
+			Scope:    substitute.Scope{Release: img.Release, Namespace: img.Namespace},
+		})
+	}
+	return batch, nil
+}
+
+// batchScopes returns the scopes of every substitution a batch changes
+func (h *APIHandler) batchScopes(batch substitute.Batch) []substitute.Scope {
+	var scopes []substitute.Scope
+	for _, c := range batch.Add.Charts {
+		scopes = append(scopes, h.substitutionScope(c.Scope()))
+	}
+	for _, img := range batch.Add.Images {
+		scopes = append(scopes, h.substitutionScope(img.Scope()))
+	}
+	for _, ref := range batch.RemoveCharts {
+		scopes = append(scopes, h.substitutionScope(ref.Scope))
+	}
+	for _, ref := range batch.RemoveImages {
+		scopes = append(scopes, h.substitutionScope(ref.Scope))
+	}
+	return scopes
+}
+
+// batchExpiry returns when a substitution with the given TTL expires, or nil
+// without a TTL
+func batchExpiry(ttl string, now time.Time) (*time.Time, error) {
+	d, err := parseTTL(ttl)
+	if err != nil || d == 0 {
+		return nil, err
+	}
+	at := now.Add(d)
+	return &at, nil
+}
+
+// handleExport returns a snapshot of all substitutions
+func (h *APIHandler) handleExport(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		h.methodNotAllowed(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.daemon.GetSubstitutor().Export())
+}
+
+// handleImport restores a substitution snapshot
+func (h *APIHandler) handleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.methodNotAllowed(w)
+		return
+	}
+
+	var req ImportRequest
+	if err := decodeRequest(r, &req); err != nil {
+		h.sendError(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		h.sendValidationError(w, err)
 		return
 	}
 
 	substitutor := h.daemon.GetSubstitutor()
+	var removed substitute.Snapshot
+	if req.Replace {
+		removed = substitutor.Clear()
+		for _, entry := range audit.SnapshotEntries(audit.ActionRemove, removed) {
+			h.auditRequest(r, entry)
+		}
+	}
+
+	imported, err := substitutor.Import(req.Substitutions, time.Now())
+	for _, entry := range audit.SnapshotEntries(audit.ActionAdd, imported) {
+		h.auditRequest(r, entry)
+	}
+	if err != nil {
+		h.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.logger.Info("substitutions imported via API",
+		zap.Int("charts", len(imported.Charts)),
+		zap.Int("images", len(imported.Images)),
+		zap.Bool("replace", req.Replace))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ImportResponse{
+		Message: fmt.Sprintf("Imported %d chart and %d image substitutions", len(imported.Charts), len(imported.Images)),
+		Charts:  len(imported.Charts),
+		Images:  len(imported.Images),
+		Removed: len(removed.Charts) + len(removed.Images),
+	})
+}
 
+// NewSubstitutionsResponse lists the substitutions of a substitution manager
+func NewSubstitutionsResponse(substitutor *substitute.Manager) SubstitutionsResponse {
 	charts := substitutor.ListChartSubstitutions()
 	images := substitutor.ListImageSubstitutions()
 
@@ -232,6 +589,10 @@ func (h *APIHandler) handleSubstitutions(w http.ResponseWriter, r *http.Request)
 		response.Charts[i] = ChartSubstitution{
 			Original:  c.Original,
 			LocalPath: c.LocalPath,
+			Source:    c.Source,
+			Release:   c.Scope.Release,
+			Namespace: c.Scope.Namespace,
+			ExpiresAt: expiresAt(c.ExpiresAt),
 		}
 	}
 
@@ -239,36 +600,39 @@ func (h *APIHandler) handleSubstitutions(w http.ResponseWriter, r *http.Request)
 		response.Images[i] = ImageSubstitution{
 			Original:    img.Original,
 			Replacement: img.Replacement,
+			Release:     img.Scope.Release,
+			Namespace:   img.Scope.Namespace,
+			ExpiresAt:   expiresAt(img.ExpiresAt),
 		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	return response
 }
 
-// handleSync handles manual sync requests
-func (h *APIHandler) handleSync(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// expiresAt returns nil for substitutions that never expire
+func expiresAt(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
 	}
+	return &t
+}
 
-	var req SyncRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.sendError(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
-		return
+// parseTTL parses a substitution TTL, where "" means no expiry
+func parseTTL(raw string) (time.Duration, error) {
+	if raw == "" {
+		return 0, nil
 	}
-
-	// TODO: Implement sync functionality
-	// This would require access to the sync executor
-	h.logger.Info("sync requested via API", zap.Bool("dryRun", req.DryRun))
-	h.sendSuccess(w, "Sync functionality not yet implemented in daemon mode")
+	ttl, err := time.ParseDuration(raw)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("invalid ttl %q: must be a positive duration such as 2h", raw)
+	}
+	return ttl, nil
 }
 
 // handleDrift handles drift report requests
 func (h *APIHandler) handleDrift(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		h.methodNotAllowed(w)
 		return
 	}
 
@@ -278,32 +642,191 @@ func (h *APIHandler) handleDrift(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// TODO: Implement drift report retrieval
-	// This would require storing drift reports in the detector
-	h.sendSuccess(w, "Drift report retrieval not yet implemented")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DriftListResponse{
+		Pending: detector.PendingReports(),
+		Recent:  detector.Reports(),
+	})
+}
+
+// handleDriftReport handles actions on a single drift report
+// (POST /api/v1/drift/{id}/heal)
+func (h *APIHandler) handleDriftReport(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/drift/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] != "heal" {
+		h.notFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		h.methodNotAllowed(w)
+		return
+	}
+
+	if !h.requireLeader(w) {
+		return
+	}
+
+	detector := h.daemon.GetDetector()
+	if detector == nil {
+		h.sendError(w, "Drift detection not enabled", http.StatusBadRequest)
+		return
+	}
+
+	id := parts[0]
+	for _, report := range detector.PendingReports() {
+		if report.ID == id && !h.authorize(w, r, AccessHeal, substitute.Scope{Release: report.ReleaseName, Namespace: report.Namespace}) {
+			return
+		}
+	}
+	h.logger.Info("drift heal approved via API", zap.String("id", id))
+
+	report, err := detector.Heal(id)
+	if errors.Is(err, drift.ErrReportNotFound) {
+		h.sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.sendError(w, fmt.Sprintf("Heal failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DriftHealResponse{Report: report})
+}
+
+// handleDriftCheck runs an immediate drift check and returns the reports
+func (h *APIHandler) handleDriftCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.methodNotAllowed(w)
+		return
+	}
+
+	var req DriftCheckRequest
+	if r.ContentLength != 0 {
+		if err := decodeRequest(r, &req); err != nil {
+			h.sendError(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var names []string
+	if req.Release != "" {
+		names = []string{req.Release}
+	}
+	if releases, err := h.daemon.namedReleases(names); err == nil && !h.authorizeReleases(w, r, AccessHeal, releases...) {
+		return
+	}
+
+	// Without periodic detection, or on a follower, run a one-off check that
+	// only reports
+	detector := h.daemon.GetDetector()
+	if detector == nil || !h.daemon.IsLeader() {
+		detector = drift.NewDetector(h.daemon.GetManager(), 0, h.logger)
+		detector.SetInspector(h.daemon.driftInspector())
+	}
+
+	h.logger.Info("drift check requested via API", zap.String("release", req.Release))
+
+	reports, err := detector.CheckNow(req.Release)
+	if errors.Is(err, drift.ErrReleaseNotFound) {
+		h.sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.sendError(w, fmt.Sprintf("Drift check failed: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DriftCheckResponse{Reports: reports})
+}
+
+// handleHealRelease re-syncs a release, or previews the changes with dryRun
+func (h *APIHandler) handleHealRelease(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.methodNotAllowed(w)
+		return
+	}
+
+	var req HealReleaseRequest
+	if err := decodeRequest(r, &req); err != nil {
+		h.sendError(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		h.sendValidationError(w, err)
+		return
+	}
+
+	release, err := h.daemon.findRelease(req.Release)
+	if err != nil {
+		h.sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if !h.authorizeReleases(w, r, AccessHeal, release) {
+		return
+	}
+
+	if !req.DryRun && !h.requireLeader(w) {
+		return
+	}
+
+	h.logger.Info("heal requested via API",
+		zap.String("release", req.Release),
+		zap.Bool("dryRun", req.DryRun))
+
+	resp := HealReleaseResponse{Release: req.Release, DryRun: req.DryRun}
+	if req.DryRun {
+		changes, err := h.daemon.previewRelease(req.Release)
+		if err != nil {
+			h.sendError(w, fmt.Sprintf("Heal dry-run failed: %v", err), http.StatusInternalServerError)
+			return
+		}
+		resp.Changes = changes
+	} else if err := h.daemon.healRelease(req.Release); err != nil {
+		h.sendError(w, fmt.Sprintf("Heal failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// requireLeader rejects requests that change the cluster when this daemon is
+// not the leader; followers serve a read-only API
+func (h *APIHandler) requireLeader(w http.ResponseWriter) bool {
+	if h.daemon.IsLeader() {
+		return true
+	}
+	h.sendErrorCode(w, CodeNotLeader, "Not the leader: this daemon serves a read-only API", http.StatusServiceUnavailable)
+	return false
 }
 
 // handleReload handles helmfile reload requests
 func (h *APIHandler) handleReload(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		h.methodNotAllowed(w)
 		return
 	}
 
-	manager := h.daemon.GetManager()
-	if err := manager.Load(); err != nil {
+	if err := h.daemon.GetManager().Load(); err != nil {
 		h.sendError(w, fmt.Sprintf("Failed to reload helmfile: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	h.logger.Info("helmfile reloaded via API")
+	stats := h.daemon.helmfileReloaded().Stats
+	h.logger.Info("helmfile reloaded via API",
+		zap.Duration("took", stats.Duration),
+		zap.Int("unchanged", stats.Reused))
 	h.sendSuccess(w, "Helmfile reloaded successfully")
 }
 
 // handleShutdown handles graceful shutdown requests
 func (h *APIHandler) handleShutdown(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		h.methodNotAllowed(w)
 		return
 	}
 
@@ -321,7 +844,7 @@ func (h *APIHandler) handleShutdown(w http.ResponseWriter, r *http.Request) {
 func (h *APIHandler) sendError(w http.ResponseWriter, message string, statusCode int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(ErrorResponse{Error: message})
+	json.NewEncoder(w).Encode(ErrorResponse{Error: message, Code: codeForStatus(statusCode)})
 }
 
 // sendSuccess sends a success response
@@ -0,0 +1,418 @@
+package daemon
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/audit"
+	"github.com/oleksiyp/helmfire/pkg/drift"
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/leader"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+	"go.uber.org/zap"
+)
+
+// newTestHandler creates an API handler backed by a daemon with an empty helmfile
+func newTestHandler(t *testing.T) *APIHandler {
+	t.Helper()
+
+	manager := helmstate.NewManager("", "")
+	manager.Spec = &helmstate.HelmfileSpec{}
+
+	d := &Daemon{
+		manager: manager,
+		logger:  zap.NewNop(),
+		audit:   audit.NewLog(filepath.Join(t.TempDir(), "audit.log")),
+	}
+
+	return &APIHandler{daemon: d, logger: zap.NewNop()}
+}
+
+func TestHandleDriftCheck(t *testing.T) {
+	handler := newTestHandler(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/drift/check", nil)
+	rec := httptest.NewRecorder()
+	handler.handleDriftCheck(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp DriftCheckResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Reports) != 0 {
+		t.Errorf("expected no reports, got %d", len(resp.Reports))
+	}
+}
+
+func TestHandleDriftCheckUnknownRelease(t *testing.T) {
+	handler := newTestHandler(t)
+
+	body, _ := json.Marshal(DriftCheckRequest{Release: "missing"})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/drift/check", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler.handleDriftCheck(rec, req)
+
+	var errResp ErrorResponse
+	json.NewDecoder(rec.Body).Decode(&errResp)
+	if rec.Code != http.StatusNotFound || errResp.Code != CodeNotFound {
+		t.Errorf("expected 404 %s, got %d %+v", CodeNotFound, rec.Code, errResp)
+	}
+}
+
+func TestHandleDriftCheckMethod(t *testing.T) {
+	handler := newTestHandler(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/drift/check", nil)
+	rec := httptest.NewRecorder()
+	handler.handleDriftCheck(rec, req)
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", rec.Code)
+	}
+}
+
+func TestHandleDriftReportHeal(t *testing.T) {
+	handler := newTestHandler(t)
+
+	detector := drift.NewDetector(handler.daemon.manager, time.Hour, zap.NewNop())
+	detector.EnableAutoHeal(true, func(string) error { return nil })
+	detector.SetHealPolicy(drift.HealPolicy{ManualNamespaces: []string{"prod"}})
+	handler.daemon.detector = detector
+
+	// Unknown reports are not found
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/drift/unknown/heal", nil)
+	rec := httptest.NewRecorder()
+	handler.handleDriftReport(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+
+	// Unsupported actions are not routed
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/drift/abc/ignore", nil)
+	rec = httptest.NewRecorder()
+	handler.handleDriftReport(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/drift/abc/heal", nil)
+	rec = httptest.NewRecorder()
+	handler.handleDriftReport(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", rec.Code)
+	}
+}
+
+func TestHandleDriftList(t *testing.T) {
+	handler := newTestHandler(t)
+	handler.daemon.detector = drift.NewDetector(handler.daemon.manager, time.Hour, zap.NewNop())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/drift", nil)
+	rec := httptest.NewRecorder()
+	handler.handleDrift(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp DriftListResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Pending) != 0 || len(resp.Recent) != 0 {
+		t.Errorf("expected empty lists, got %+v", resp)
+	}
+}
+
+func TestHandleHealReleaseUnknown(t *testing.T) {
+	handler := newTestHandler(t)
+
+	body, _ := json.Marshal(HealReleaseRequest{Release: "missing", DryRun: true})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/drift/heal", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	handler.handleHealRelease(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/drift/heal", bytes.NewReader([]byte("{}")))
+	rec = httptest.NewRecorder()
+	handler.handleHealRelease(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without release, got %d", rec.Code)
+	}
+}
+
+func TestFollowerRejectsWrites(t *testing.T) {
+	handler := newTestHandler(t)
+
+	elector, err := leader.NewElector(leader.Config{Identity: "pod-b", Namespace: "helmfire"}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewElector failed: %v", err)
+	}
+	handler.daemon.elector = elector
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/sync", bytes.NewReader([]byte("{}")))
+	rec := httptest.NewRecorder()
+	handler.handleSync(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 for sync on follower, got %d", rec.Code)
+	}
+
+	// Reads are still served
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/drift/check", nil)
+	rec = httptest.NewRecorder()
+	handler.handleDriftCheck(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200 for drift check on follower, got %d", rec.Code)
+	}
+}
+
+func TestHandleChartsStrict(t *testing.T) {
+	handler := newTestHandler(t)
+	handler.daemon.manager.Spec.Releases = []helmstate.Release{{Name: "web", Chart: "bitnami/nginx", Version: "^14.0.0"}}
+	handler.daemon.substitutor = substitute.NewManager()
+	handler.daemon.executor = sync.NewExecutor(zap.NewNop(), handler.daemon.substitutor)
+	handler.daemon.executor.SetHelmBinary(filepath.Join(t.TempDir(), "missing-helm"))
+
+	chartDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte("apiVersion: v2\nname: nginx\nversion: 15.0.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(strict bool) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(AddChartRequest{Original: "bitnami/nginx", LocalPath: chartDir, Strict: strict})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/charts", bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		handler.handleCharts(rec, req)
+		return rec
+	}
+
+	rec := post(true)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 in strict mode, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, ok := handler.daemon.substitutor.GetChartPath("bitnami/nginx"); ok {
+		t.Error("expected rejected substitution to be removed")
+	}
+
+	rec = post(false)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp AddChartResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], "constraint") {
+		t.Errorf("expected a version constraint warning, got %v", resp.Warnings)
+	}
+}
+
+func TestHandleAudit(t *testing.T) {
+	handler := newTestHandler(t)
+	handler.daemon.substitutor = substitute.NewManager()
+
+	post := func(path string, data interface{}, handle http.HandlerFunc) {
+		body, _ := json.Marshal(data)
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+		req.Header.Set(UserHeader, "alice")
+		req.RemoteAddr = "10.0.0.5:4321"
+		rec := httptest.NewRecorder()
+		handle(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", path, rec.Code, rec.Body.String())
+		}
+	}
+
+	post("/api/v1/images", AddImageRequest{Original: "nginx:1.21", Replacement: "local/nginx:dev", Release: "web"}, handler.handleImages)
+	post("/api/v1/images/remove", RemoveImageRequest{Original: "nginx:1.21", Release: "web"}, handler.handleRemoveImage)
+
+	rec := httptest.NewRecorder()
+	handler.handleAudit(rec, httptest.NewRequest(http.MethodGet, "/api/v1/audit?kind=image", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp AuditResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Entries) != 2 {
+		t.Fatalf("expected 2 audit entries, got %d", len(resp.Entries))
+	}
+
+	added := resp.Entries[0]
+	if added.Action != audit.ActionAdd || added.Target != "local/nginx:dev" || added.Release != "web" {
+		t.Errorf("unexpected add entry: %+v", added)
+	}
+	if added.Via != audit.ViaAPI || added.User != "alice" || added.RemoteAddr != "10.0.0.5:4321" {
+		t.Errorf("expected the caller to be recorded, got %+v", added)
+	}
+	if resp.Entries[1].Action != audit.ActionRemove {
+		t.Errorf("expected a remove entry, got %+v", resp.Entries[1])
+	}
+
+	rec = httptest.NewRecorder()
+	handler.handleAudit(rec, httptest.NewRequest(http.MethodGet, "/api/v1/audit?kind=chart", nil))
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Entries) != 0 {
+		t.Errorf("expected no chart entries, got %d", len(resp.Entries))
+	}
+
+	rec = httptest.NewRecorder()
+	handler.handleAudit(rec, httptest.NewRequest(http.MethodGet, "/api/v1/audit?limit=x", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid limit, got %d", rec.Code)
+	}
+}
+
+func TestHandleImportExport(t *testing.T) {
+	handler := newTestHandler(t)
+	handler.daemon.substitutor = substitute.NewManager()
+	handler.daemon.substitutor.AddImageSubstitution("redis:7", "local/redis:old")
+
+	importSnapshot := func(req ImportRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(req)
+		rec := httptest.NewRecorder()
+		handler.handleImport(rec, httptest.NewRequest(http.MethodPost, "/api/v1/substitutions/import", bytes.NewReader(body)))
+		return rec
+	}
+
+	rec := importSnapshot(ImportRequest{
+		Substitutions: substitute.Snapshot{Images: []substitute.SnapshotImage{
+			{Original: "nginx:1.21", Replacement: "local/nginx:dev", Release: "web"},
+		}},
+		Replace: true,
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp ImportResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Images != 1 || resp.Removed != 1 {
+		t.Errorf("expected 1 image imported and 1 removed, got %+v", resp)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.handleExport(rec, httptest.NewRequest(http.MethodGet, "/api/v1/substitutions/export", nil))
+	var snapshot substitute.Snapshot
+	if err := json.NewDecoder(rec.Body).Decode(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot.Images) != 1 || snapshot.Images[0].Original != "nginx:1.21" || snapshot.Images[0].Release != "web" {
+		t.Errorf("expected only the imported image to be exported, got %+v", snapshot.Images)
+	}
+
+	entries, err := handler.daemon.audit.Entries(audit.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Action != audit.ActionRemove || entries[1].Action != audit.ActionAdd {
+		t.Errorf("expected the replace and import to be audited, got %+v", entries)
+	}
+
+	rec = importSnapshot(ImportRequest{Substitutions: substitute.Snapshot{Charts: []substitute.SnapshotChart{
+		{Original: "bitnami/nginx", Path: filepath.Join(t.TempDir(), "missing")},
+	}}})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid chart, got %d", rec.Code)
+	}
+}
+
+func TestHandleBulk(t *testing.T) {
+	handler := newTestHandler(t)
+	handler.daemon.substitutor = substitute.NewManager()
+	handler.daemon.substitutor.AddImageSubstitution("redis:7", "local/redis:old")
+
+	put := func(req BulkRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(req)
+		rec := httptest.NewRecorder()
+		handler.handleSubstitutions(rec, httptest.NewRequest(http.MethodPut, "/api/v1/substitutions", bytes.NewReader(body)))
+		return rec
+	}
+
+	rec := put(BulkRequest{
+		Add: BulkAdd{Images: []AddImageRequest{
+			{Original: "nginx:1.21", Replacement: "local/nginx:dev"},
+			{Original: "postgres:15", Replacement: "local/pg:dev", Release: "my-db", TTL: "1h"},
+		}},
+		Remove: BulkRemove{Images: []RemoveImageRequest{{Original: "redis:7"}, {Original: "redis:7", Release: "cache"}}},
+	})
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown removal, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if subs := handler.daemon.substitutor.ListImageSubstitutions(); len(subs) != 1 || subs[0].Original != "redis:7" {
+		t.Fatalf("expected a failed bulk request to change nothing, got %+v", subs)
+	}
+
+	rec = put(BulkRequest{Add: BulkAdd{Charts: []AddChartRequest{{Original: "bitnami/nginx", LocalPath: t.TempDir(), Strict: true}}}})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for strict in a bulk request, got %d", rec.Code)
+	}
+
+	rec = put(BulkRequest{
+		Add: BulkAdd{Images: []AddImageRequest{
+			{Original: "nginx:1.21", Replacement: "local/nginx:dev"},
+			{Original: "postgres:15", Replacement: "local/pg:dev", Release: "my-db", TTL: "1h"},
+		}},
+		Remove: BulkRemove{Images: []RemoveImageRequest{{Original: "redis:7"}}},
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	subs := NewSubstitutionsResponse(handler.daemon.substitutor)
+	if len(subs.Images) != 2 {
+		t.Fatalf("expected 2 image substitutions, got %+v", subs.Images)
+	}
+	for _, img := range subs.Images {
+		if img.Original == "redis:7" {
+			t.Error("expected redis substitution to be removed")
+		}
+		if img.Original == "postgres:15" && (img.Release != "my-db" || img.ExpiresAt == nil) {
+			t.Errorf("expected scoped postgres substitution with a TTL, got %+v", img)
+		}
+	}
+
+	entries, err := handler.daemon.audit.Entries(audit.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("expected 3 audit entries, got %+v", entries)
+	}
+}
+
+func TestHandleMetrics(t *testing.T) {
+	handler := newTestHandler(t)
+	handler.daemon.detector = drift.NewDetector(handler.daemon.manager, time.Minute, zap.NewNop())
+	handler.daemon.detector.CheckNow("")
+
+	rec := httptest.NewRecorder()
+	handler.handleMetrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, line := range []string{"# TYPE helmfire_drift_sweeps_total counter", "helmfire_drift_sweeps_total 0"} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected %q, got:\n%s", line, body)
+		}
+	}
+}
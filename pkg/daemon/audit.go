@@ -0,0 +1,78 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/oleksiyp/helmfire/pkg/audit"
+	"go.uber.org/zap"
+)
+
+// UserHeader carries the name of the user behind an API request, for the
+// audit log
+const UserHeader = "X-Helmfire-User"
+
+// recordAudit appends an entry to the audit log; failures are logged so they
+// never fail the change itself. Every substitution change is audited, so it
+// also saves the daemon's state and publishes a substitution event.
+func (d *Daemon) recordAudit(entry audit.Entry) {
+	d.saveState()
+	d.publishSubstitution(entry)
+	if d.audit == nil {
+		return
+	}
+	if err := d.audit.Record(entry); err != nil {
+		d.logger.Warn("failed to record audit entry",
+			zap.String("action", entry.Action),
+			zap.String("original", entry.Original),
+			zap.Error(err))
+	}
+}
+
+// auditRequest records a substitution change made through the API. The
+// caller's token names the user when the API has an access policy.
+func (h *APIHandler) auditRequest(r *http.Request, entry audit.Entry) {
+	entry.Via = audit.ViaAPI
+	entry.User = r.Header.Get(UserHeader)
+	if caller := Caller(r.Context()); caller != nil {
+		entry.User = caller.Name
+	}
+	entry.RemoteAddr = r.RemoteAddr
+	h.daemon.recordAudit(entry)
+}
+
+// handleAudit lists audit log entries, filtered by the kind, original and
+// limit query parameters
+func (h *APIHandler) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.methodNotAllowed(w)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := audit.Filter{
+		Kind:     query.Get("kind"),
+		Original: query.Get("original"),
+	}
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 0 {
+			h.sendError(w, "Invalid limit: must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+
+	entries, err := h.daemon.audit.Entries(filter)
+	if err != nil {
+		h.sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []audit.Entry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AuditResponse{Entries: entries})
+}
@@ -0,0 +1,145 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/drift"
+	"github.com/oleksiyp/helmfire/pkg/kubeauth"
+	"go.uber.org/zap"
+)
+
+// EventAuth is published when Kubernetes authentication starts failing
+// persistently or recovers
+const EventAuth = "auth"
+
+const (
+	// authFailureThreshold is how many authentication errors in a row, with
+	// credential refreshes in between, make the failure persistent
+	authFailureThreshold = 3
+
+	// authRefreshInterval is how often credentials are refreshed while
+	// authentication fails
+	authRefreshInterval = time.Minute
+)
+
+// credentialRefresher renews the credentials helm and kubectl use
+type credentialRefresher interface {
+	Refresh(ctx context.Context) (kubeauth.Credential, error)
+}
+
+// kubeAuth tracks whether the cluster accepts the daemon's credentials
+type kubeAuth struct {
+	refresher credentialRefresher
+
+	mu          sync.Mutex
+	failures    int // authentication errors in a row
+	since       time.Time
+	lastErr     error
+	lastRefresh time.Time
+	refreshErr  error // why the last refresh failed, nil when it didn't
+	failing     bool
+}
+
+// failure describes the current failure; a.mu must be held
+func (a *kubeAuth) failure() string {
+	msg := fmt.Sprintf("kubernetes authentication failing since %s: %v", a.since.Format(time.RFC3339), a.lastErr)
+	if a.refreshErr != nil {
+		msg += fmt.Sprintf("; refreshing credentials failed: %v", a.refreshErr)
+	}
+	return msg
+}
+
+// observeKubeResult records the outcome of a query of the cluster, nil
+// when it succeeded. Authentication errors refresh the credentials with the
+// kubeconfig's exec plugin; when they persist, the daemon turns not ready
+// and notifies, since drift checks would otherwise keep failing in the log.
+func (d *Daemon) observeKubeResult(err error) {
+	a := d.kubeAuth
+	if a == nil {
+		return
+	}
+	if err != nil && !kubeauth.IsAuthError(err) {
+		return
+	}
+
+	a.mu.Lock()
+	if err == nil {
+		recovered := a.failing
+		a.failures, a.failing, a.lastErr, a.refreshErr = 0, false, nil, nil
+		a.mu.Unlock()
+		if recovered {
+			d.logger.Info("kubernetes authentication recovered")
+			d.events.publish(Event{Type: EventAuth, Ready: true, Message: "kubernetes authentication recovered"})
+		}
+		return
+	}
+
+	if a.failures == 0 {
+		a.since = time.Now()
+	}
+	a.failures++
+	a.lastErr = err
+	refresh := a.refresher != nil && time.Since(a.lastRefresh) >= authRefreshInterval
+	if refresh {
+		a.lastRefresh = time.Now()
+	}
+	a.mu.Unlock()
+
+	d.logger.Warn("kubernetes authentication failed", zap.Error(err))
+	var refreshErr error
+	if refresh {
+		credential, err := a.refresher.Refresh(d.ctx)
+		switch {
+		case errors.Is(err, kubeauth.ErrNoExecPlugin):
+			d.logger.Debug("no credential plugin to refresh credentials with")
+		case err != nil:
+			d.logger.Error("failed to refresh kubernetes credentials", zap.Error(err))
+			refreshErr = err
+		default:
+			d.logger.Info("refreshed kubernetes credentials", zap.Time("expiresAt", credential.ExpiresAt))
+		}
+	}
+
+	a.mu.Lock()
+	if refresh {
+		a.refreshErr = refreshErr
+	}
+	persistent := a.failures >= authFailureThreshold && !a.failing
+	if persistent {
+		a.failing = true
+	}
+	message := a.failure()
+	a.mu.Unlock()
+
+	if !persistent {
+		return
+	}
+	d.logger.Error("kubernetes authentication failing persistently", zap.String("reason", message))
+	d.events.publish(Event{Type: EventAuth, Message: message})
+	if d.detector != nil {
+		d.detector.Notify(drift.DriftReport{
+			Timestamp: time.Now(),
+			DriftType: drift.DriftTypeAuth,
+			Severity:  drift.SeverityHigh,
+			Details:   message,
+		})
+	}
+}
+
+// checkKubeAuth fails while authentication fails persistently
+func (d *Daemon) checkKubeAuth(ctx context.Context) error {
+	a := d.kubeAuth
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.failing {
+		return errors.New(a.failure())
+	}
+	return nil
+}
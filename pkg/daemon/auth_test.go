@@ -0,0 +1,85 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/oleksiyp/helmfire/pkg/drift"
+	"github.com/oleksiyp/helmfire/pkg/kubeauth"
+	"go.uber.org/zap"
+)
+
+// fakeRefresher counts refreshes and fails them with err
+type fakeRefresher struct {
+	calls int
+	err   error
+}
+
+func (r *fakeRefresher) Refresh(ctx context.Context) (kubeauth.Credential, error) {
+	r.calls++
+	return kubeauth.Credential{}, r.err
+}
+
+// authNotifier records the reports it is sent
+type authNotifier struct {
+	reports []drift.DriftReport
+}
+
+func (n *authNotifier) Notify(report drift.DriftReport) error {
+	n.reports = append(n.reports, report)
+	return nil
+}
+
+func TestObserveKubeResult(t *testing.T) {
+	refresher := &fakeRefresher{err: errors.New("refresh token expired")}
+	notifier := &authNotifier{}
+	d := &Daemon{
+		logger:   zap.NewNop(),
+		ctx:      context.Background(),
+		kubeAuth: &kubeAuth{refresher: refresher},
+		detector: drift.NewDetector(nil, 0, zap.NewNop()),
+	}
+	d.detector.AddNotifier(notifier)
+
+	// Errors other than authentication failures are ignored
+	d.observeKubeResult(errors.New("helm command failed: connection refused"))
+	if d.kubeAuth.failures != 0 {
+		t.Errorf("expected a non-auth error ignored, got %d failures", d.kubeAuth.failures)
+	}
+
+	unauthorized := errors.New("helm command failed: exit status 1\nstderr: Error: Kubernetes cluster unreachable: Unauthorized")
+	for i := 0; i < authFailureThreshold; i++ {
+		if err := d.checkKubeAuth(context.Background()); err != nil {
+			t.Fatalf("expected ready before %d failures, got %v", authFailureThreshold, err)
+		}
+		d.observeKubeResult(unauthorized)
+	}
+	if refresher.calls != 1 {
+		t.Errorf("expected one refresh per interval, got %d", refresher.calls)
+	}
+	err := d.checkKubeAuth(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "refresh token expired") {
+		t.Errorf("expected persistent auth failure with the refresh error, got %v", err)
+	}
+	if len(notifier.reports) != 1 || notifier.reports[0].DriftType != drift.DriftTypeAuth {
+		t.Errorf("expected one auth notification, got %+v", notifier.reports)
+	}
+	if events := d.events.since(0); len(events) != 1 || events[0].Type != EventAuth || events[0].Ready {
+		t.Errorf("expected an auth failure event, got %+v", events)
+	}
+
+	// Further failures don't notify again; a success recovers
+	d.observeKubeResult(unauthorized)
+	if len(notifier.reports) != 1 {
+		t.Errorf("expected no repeated notification, got %d", len(notifier.reports))
+	}
+	d.observeKubeResult(nil)
+	if err := d.checkKubeAuth(context.Background()); err != nil {
+		t.Errorf("expected recovery, got %v", err)
+	}
+	if events := d.events.since(0); len(events) != 2 || !events[1].Ready {
+		t.Errorf("expected a recovery event, got %+v", events)
+	}
+}
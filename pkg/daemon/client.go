@@ -1,30 +1,64 @@
 package daemon
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/audit"
+	"github.com/oleksiyp/helmfire/pkg/drift"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
 )
 
+// slowRequestTimeout bounds requests that wait for helm operations
+const slowRequestTimeout = 10 * time.Minute
+
+// EnvAPIToken is the token the client presents to daemons with an access
+// policy
+const EnvAPIToken = "HELMFIRE_API_TOKEN"
+
 // APIClient is a client for the daemon API
 type APIClient struct {
 	baseURL string
 	client  *http.Client
 }
 
-// NewAPIClient creates a new API client
+// NewAPIClient creates a new API client, authenticating with the token in
+// HELMFIRE_API_TOKEN when set
 func NewAPIClient(addr string) *APIClient {
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+	}
+	if token := os.Getenv(EnvAPIToken); token != "" {
+		client.Transport = tokenTransport{token: token, base: http.DefaultTransport}
+	}
 	return &APIClient{
 		baseURL: fmt.Sprintf("http://%s", addr),
-		client: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+		client:  client,
 	}
 }
 
+// tokenTransport sends a bearer token with every request
+type tokenTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return t.base.RoundTrip(req)
+}
+
 // GetStatus gets the daemon status
 func (c *APIClient) GetStatus() (*Status, error) {
 	resp, err := c.client.Get(c.baseURL + "/api/v1/status")
@@ -45,42 +79,80 @@ func (c *APIClient) GetStatus() (*Status, error) {
 	return &status, nil
 }
 
-// AddChartSubstitution adds a chart substitution
-func (c *APIClient) AddChartSubstitution(original, localPath string) error {
+// AddChartSubstitution adds a chart substitution for the releases in scope and
+// returns compatibility warnings. A non-zero ttl makes it expire. With strict,
+// the daemon rejects the substitution on warnings.
+func (c *APIClient) AddChartSubstitution(original, localPath string, scope substitute.Scope, ttl time.Duration, strict bool) ([]string, error) {
+	// The daemon may run in another directory
+	localPath, err := substitute.AbsChartPath(localPath)
+	if err != nil {
+		return nil, err
+	}
+
 	req := AddChartRequest{
 		Original:  original,
 		LocalPath: localPath,
+		Release:   scope.Release,
+		Namespace: scope.Namespace,
+		TTL:       formatTTL(ttl),
+		Strict:    strict,
 	}
 
-	return c.post("/api/v1/charts", req)
+	var resp AddChartResponse
+	// The compatibility check may run helm show chart
+	if err := c.postJSON(c.slowClient(), "/api/v1/charts", req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Warnings, nil
 }
 
-// AddImageSubstitution adds an image substitution
-func (c *APIClient) AddImageSubstitution(original, replacement string) error {
+// AddImageSubstitution adds an image substitution for the releases in scope.
+// A non-zero ttl makes it expire.
+func (c *APIClient) AddImageSubstitution(original, replacement string, scope substitute.Scope, ttl time.Duration) error {
 	req := AddImageRequest{
 		Original:    original,
 		Replacement: replacement,
+		Release:     scope.Release,
+		Namespace:   scope.Namespace,
+		TTL:         formatTTL(ttl),
 	}
 
 	return c.post("/api/v1/images", req)
 }
 
-// RemoveChartSubstitution removes a chart substitution
-func (c *APIClient) RemoveChartSubstitution(original string) error {
-	req := RemoveChartRequest{
-		Original: original,
+// formatTTL encodes a TTL for the API, where zero means no expiry
+func formatTTL(ttl time.Duration) string {
+	if ttl <= 0 {
+		return ""
 	}
+	return ttl.String()
+}
 
-	return c.post("/api/v1/charts/remove", req)
+// RemoveChartSubstitution removes a chart substitution registered for scope
+func (c *APIClient) RemoveChartSubstitution(original string, scope substitute.Scope) error {
+	return c.sendJSON(c.client, http.MethodDelete, resourcePath(chartsPrefix, original, scope), nil, nil)
 }
 
-// RemoveImageSubstitution removes an image substitution
-func (c *APIClient) RemoveImageSubstitution(original string) error {
-	req := RemoveImageRequest{
-		Original: original,
-	}
+// RemoveImageSubstitution removes an image substitution registered for scope
+func (c *APIClient) RemoveImageSubstitution(original string, scope substitute.Scope) error {
+	return c.sendJSON(c.client, http.MethodDelete, resourcePath(imagesPrefix, original, scope), nil, nil)
+}
+
+// resourcePath returns the route of a single substitution in scope
+func resourcePath(prefix, original string, scope substitute.Scope) string {
+	path := prefix + url.PathEscape(original)
 
-	return c.post("/api/v1/images/remove", req)
+	query := url.Values{}
+	if scope.Release != "" {
+		query.Set("release", scope.Release)
+	}
+	if scope.Namespace != "" {
+		query.Set("namespace", scope.Namespace)
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return path
 }
 
 // GetSubstitutions gets all substitutions
@@ -103,6 +175,312 @@ func (c *APIClient) GetSubstitutions() (*SubstitutionsResponse, error) {
 	return &subs, nil
 }
 
+// ApplyBulk adds and removes substitutions in one all-or-nothing request and
+// returns compatibility warnings for the added charts
+func (c *APIClient) ApplyBulk(req BulkRequest) ([]string, error) {
+	var resp BulkResponse
+	if err := c.sendJSON(c.slowClient(), http.MethodPut, "/api/v1/substitutions", req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Warnings, nil
+}
+
+// ExportSubstitutions returns a snapshot of the daemon's substitutions
+func (c *APIClient) ExportSubstitutions() (*substitute.Snapshot, error) {
+	resp, err := c.client.Get(c.baseURL + "/api/v1/substitutions/export")
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to daemon: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var snapshot substitute.Snapshot
+	if err := json.NewDecoder(resp.Body).Decode(&snapshot); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &snapshot, nil
+}
+
+// ImportSubstitutions restores a substitution snapshot in the daemon,
+// removing its existing substitutions first with replace
+func (c *APIClient) ImportSubstitutions(snapshot substitute.Snapshot, replace bool) (*ImportResponse, error) {
+	// The daemon may run in another directory
+	charts := make([]substitute.SnapshotChart, len(snapshot.Charts))
+	for i, chart := range snapshot.Charts {
+		path, err := substitute.AbsChartPath(chart.Path)
+		if err != nil {
+			return nil, err
+		}
+		chart.Path = path
+		charts[i] = chart
+	}
+	snapshot.Charts = charts
+
+	var resp ImportResponse
+	if err := c.postJSON(c.slowClient(), "/api/v1/substitutions/import", ImportRequest{Substitutions: snapshot, Replace: replace}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetAudit lists substitution audit log entries matching filter
+func (c *APIClient) GetAudit(filter audit.Filter) ([]audit.Entry, error) {
+	query := url.Values{}
+	if filter.Kind != "" {
+		query.Set("kind", filter.Kind)
+	}
+	if filter.Original != "" {
+		query.Set("original", filter.Original)
+	}
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+
+	resp, err := c.client.Get(c.baseURL + "/api/v1/audit?" + query.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to daemon: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var auditResp AuditResponse
+	if err := json.NewDecoder(resp.Body).Decode(&auditResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return auditResp.Entries, nil
+}
+
+// GetSyncs gets the daemon's sync runs, newest first; limit 0 gets all
+func (c *APIClient) GetSyncs(limit int) ([]SyncRun, error) {
+	path := "/api/v1/syncs"
+	if limit > 0 {
+		path += "?limit=" + strconv.Itoa(limit)
+	}
+	var resp SyncHistoryResponse
+	if err := c.sendJSON(c.client, http.MethodGet, path, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Runs, nil
+}
+
+// GetReleases lists the releases of the daemon's helmfile with their state
+func (c *APIClient) GetReleases() ([]ReleaseState, error) {
+	var resp ReleasesResponse
+	if err := c.sendJSON(c.client, http.MethodGet, "/api/v1/releases", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Releases, nil
+}
+
+// Sync syncs releases, every installed one when none are named, or with
+// dryRun returns the changes it would apply
+func (c *APIClient) Sync(releases []string, dryRun bool) (*SyncResponse, error) {
+	var resp SyncResponse
+	if err := c.postJSON(c.slowClient(), "/api/v1/sync", SyncRequest{Releases: releases, DryRun: dryRun}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetReleaseValues gets the value overlay of a release
+func (c *APIClient) GetReleaseValues(release string) (map[string]string, error) {
+	var resp ValuesOverlayResponse
+	if err := c.sendJSON(c.client, http.MethodGet, releaseValuesPath(release), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Values, nil
+}
+
+// SetReleaseValues merges --set style values into the value overlay of a
+// release, returning the whole overlay. It applies from the release's next
+// sync.
+func (c *APIClient) SetReleaseValues(release string, values map[string]string) (map[string]string, error) {
+	var resp ValuesOverlayResponse
+	if err := c.postJSON(c.client, releaseValuesPath(release), ValuesOverlayRequest{Values: values}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Values, nil
+}
+
+// ClearReleaseValues removes the value overlay of a release
+func (c *APIClient) ClearReleaseValues(release string) error {
+	return c.sendJSON(c.client, http.MethodDelete, releaseValuesPath(release), nil, nil)
+}
+
+// releaseValuesPath returns the API path of the value overlay of a release
+func releaseValuesPath(release string) string {
+	return "/api/v1/releases/" + url.PathEscape(release) + "/values"
+}
+
+// GetEvents lists the events the daemon kept with an ID greater than since
+func (c *APIClient) GetEvents(since int) ([]Event, error) {
+	var resp EventsResponse
+	if err := c.sendJSON(c.client, http.MethodGet, "/api/v1/events?since="+strconv.Itoa(since), nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Events, nil
+}
+
+// StreamEvents calls fn for each event with an ID greater than since until
+// ctx is done or the daemon closes the stream
+func (c *APIClient) StreamEvents(ctx context.Context, since int, fn func(Event)) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/v1/events?since="+strconv.Itoa(since), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	// The stream stays open, so only connecting is bounded
+	client := *c.client
+	client.Timeout = 0
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to daemon: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err == nil {
+			return fmt.Errorf("%s", errResp.Error)
+		}
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var event Event
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return fmt.Errorf("failed to decode event: %w", err)
+		}
+		fn(event)
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("event stream failed: %w", err)
+	}
+	return nil
+}
+
+// CheckDrift runs an immediate drift check, optionally scoped to one release
+func (c *APIClient) CheckDrift(release string) ([]drift.DriftReport, error) {
+	var resp DriftCheckResponse
+	if err := c.postJSON(c.slowClient(), "/api/v1/drift/check", DriftCheckRequest{Release: release}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Reports, nil
+}
+
+// ListDrift gets pending and recent drift reports from the detector
+func (c *APIClient) ListDrift() (*DriftListResponse, error) {
+	resp, err := c.client.Get(c.baseURL + "/api/v1/drift")
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to daemon: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err == nil {
+			return nil, fmt.Errorf("%s", errResp.Error)
+		}
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var list DriftListResponse
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &list, nil
+}
+
+// Rollback rolls back releases, or for a dry run returns the revisions it
+// would roll them back to
+func (c *APIClient) Rollback(req RollbackRequest) (*RollbackResponse, error) {
+	var resp RollbackResponse
+	if err := c.postJSON(c.slowClient(), "/api/v1/rollback", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// HealDrift approves healing of a drift report held by the heal policy
+func (c *APIClient) HealDrift(id string) (*drift.DriftReport, error) {
+	var resp DriftHealResponse
+	if err := c.postJSON(c.slowClient(), "/api/v1/drift/"+url.PathEscape(id)+"/heal", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Report, nil
+}
+
+// GetDriftConfig gets the drift settings of the daemon
+func (c *APIClient) GetDriftConfig() (*DriftConfigResponse, error) {
+	var resp DriftConfigResponse
+	if err := c.sendJSON(c.client, http.MethodGet, "/api/v1/drift/config", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// UpdateDriftConfig changes the drift settings of the daemon set in req
+func (c *APIClient) UpdateDriftConfig(req DriftConfigRequest) (*DriftConfigResponse, error) {
+	var resp DriftConfigResponse
+	if err := c.sendJSON(c.client, http.MethodPatch, "/api/v1/drift/config", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// HealRelease re-syncs a release, or with dryRun returns the changes it would apply
+func (c *APIClient) HealRelease(release string, dryRun bool) (*HealReleaseResponse, error) {
+	var resp HealReleaseResponse
+	if err := c.postJSON(c.slowClient(), "/api/v1/drift/heal", HealReleaseRequest{Release: release, DryRun: dryRun}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Pause pauses the daemon's automation for duration, or until resumed when
+// zero
+func (c *APIClient) Pause(duration time.Duration, reason string) (*PauseStatus, error) {
+	var resp PauseStatus
+	if err := c.postJSON(c.client, "/api/v1/pause", PauseRequest{Duration: formatTTL(duration), Reason: reason}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Resume resumes the daemon's automation
+func (c *APIClient) Resume() error {
+	return c.postJSON(c.client, "/api/v1/resume", nil, nil)
+}
+
+// ReloadHelmfile makes the daemon load the helmfile again
+func (c *APIClient) ReloadHelmfile() error {
+	return c.postJSON(c.client, "/api/v1/reload", nil, nil)
+}
+
+// ReloadConfig makes the daemon reload its configuration, as on SIGHUP
+func (c *APIClient) ReloadConfig() (*ConfigReloadResponse, error) {
+	var resp ConfigReloadResponse
+	if err := c.postJSON(c.client, "/api/v1/config/reload", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // Shutdown sends shutdown request to daemon
 func (c *APIClient) Shutdown() error {
 	return c.post("/api/v1/shutdown", nil)
@@ -110,6 +488,24 @@ func (c *APIClient) Shutdown() error {
 
 // post sends a POST request
 func (c *APIClient) post(path string, data interface{}) error {
+	return c.postJSON(c.client, path, data, nil)
+}
+
+// slowClient returns a client for requests that run helm synchronously
+func (c *APIClient) slowClient() *http.Client {
+	client := *c.client
+	client.Timeout = slowRequestTimeout
+	return &client
+}
+
+// postJSON sends a POST request and decodes the response into out, if set
+func (c *APIClient) postJSON(client *http.Client, path string, data, out interface{}) error {
+	return c.sendJSON(client, http.MethodPost, path, data, out)
+}
+
+// sendJSON sends a request with a JSON body and decodes the response into
+// out, if set
+func (c *APIClient) sendJSON(client *http.Client, method, path string, data, out interface{}) error {
 	var body io.Reader
 	if data != nil {
 		jsonData, err := json.Marshal(data)
@@ -119,7 +515,14 @@ func (c *APIClient) post(path string, data interface{}) error {
 		body = bytes.NewBuffer(jsonData)
 	}
 
-	resp, err := c.client.Post(c.baseURL+path, "application/json", body)
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(UserHeader, audit.CurrentUser())
+
+	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to connect to daemon: %w", err)
 	}
@@ -133,6 +536,13 @@ func (c *APIClient) post(path string, data interface{}) error {
 		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+		return nil
+	}
+
 	var successResp SuccessResponse
 	if err := json.NewDecoder(resp.Body).Decode(&successResp); err != nil {
 		return nil // Success even if we can't decode response
@@ -143,10 +553,31 @@ func (c *APIClient) post(path string, data interface{}) error {
 
 // IsHealthy checks if the daemon is healthy
 func (c *APIClient) IsHealthy() bool {
-	resp, err := c.client.Get(c.baseURL + "/health")
+	resp, err := c.client.Get(c.baseURL + "/healthz")
 	if err != nil {
 		return false
 	}
 	defer resp.Body.Close()
 	return resp.StatusCode == http.StatusOK
 }
+
+// GetReadiness returns the daemon's readiness checks; a not ready daemon is
+// not an error
+func (c *APIClient) GetReadiness() (*ReadinessResponse, error) {
+	resp, err := c.client.Get(c.baseURL + "/readyz")
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to daemon: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var readiness ReadinessResponse
+	if err := json.NewDecoder(resp.Body).Decode(&readiness); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &readiness, nil
+}
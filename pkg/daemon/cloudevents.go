@@ -0,0 +1,224 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/audit"
+	"github.com/oleksiyp/helmfire/pkg/cloudevents"
+	"github.com/oleksiyp/helmfire/pkg/drift"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+	"go.uber.org/zap"
+)
+
+// eventTypes are the types of events the daemon publishes
+var eventTypes = []string{EventSync, EventHeal, EventDrift, EventSubstitution, EventRollout, EventReload, EventPause, EventAuth}
+
+// forwardQueueSize bounds the events waiting for the sink; more are dropped
+const forwardQueueSize = 256
+
+// forwardFlushTimeout bounds delivering the queued events when the daemon
+// stops
+const forwardFlushTimeout = 5 * time.Second
+
+// eventForwarder delivers daemon events to a CloudEvents sink in the
+// background, so publishing never waits for the sink
+type eventForwarder struct {
+	sink   cloudevents.Sink
+	source string
+	// instance tells apart the event IDs of daemon runs, which restart at 1
+	instance string
+	// types are those forwarded; every type when nil
+	types  map[string]bool
+	logger *zap.Logger
+
+	queue chan Event
+	stop  chan struct{}
+	done  chan struct{}
+
+	delivered, failed, dropped atomic.Uint64
+}
+
+// newEventForwarder creates the forwarder to the sink config names, or
+// nil when it names none
+func newEventForwarder(config DaemonConfig, logger *zap.Logger) (*eventForwarder, error) {
+	if config.CloudEventsSink == "" {
+		return nil, nil
+	}
+	sink, err := cloudevents.NewSink(config.CloudEventsSink, config.CloudEventsSubject)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &eventForwarder{
+		sink:     sink,
+		source:   config.CloudEventsSource,
+		instance: strconv.FormatInt(time.Now().UnixNano(), 36),
+		logger:   logger,
+		queue:    make(chan Event, forwardQueueSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if f.source == "" {
+		hostname, _ := os.Hostname()
+		f.source = "/helmfire/" + hostname
+	}
+	if len(config.CloudEventsTypes) > 0 {
+		f.types = make(map[string]bool)
+		for _, t := range config.CloudEventsTypes {
+			if !slices.Contains(eventTypes, t) {
+				return nil, fmt.Errorf("unknown event type %q (types: %v)", t, eventTypes)
+			}
+			f.types[t] = true
+		}
+	}
+	return f, nil
+}
+
+// forward queues an event for the sink, dropping it when the queue is full
+func (f *eventForwarder) forward(event Event) {
+	if f.types != nil && !f.types[event.Type] {
+		return
+	}
+	select {
+	case f.queue <- event:
+	default:
+		f.dropped.Add(1)
+		f.logger.Warn("event sink is falling behind; dropped event", zap.String("type", event.Type), zap.Int("id", event.ID))
+	}
+}
+
+// run delivers queued events until stopped, then delivers those still
+// queued for up to forwardFlushTimeout
+func (f *eventForwarder) run() {
+	defer close(f.done)
+	for {
+		select {
+		case event := <-f.queue:
+			f.send(context.Background(), event)
+		case <-f.stop:
+			ctx, cancel := context.WithTimeout(context.Background(), forwardFlushTimeout)
+			defer cancel()
+			for {
+				select {
+				case event := <-f.queue:
+					f.send(ctx, event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// shutdown stops the forwarder once the queued events are delivered
+func (f *eventForwarder) shutdown() {
+	close(f.stop)
+	<-f.done
+	if closer, ok := f.sink.(interface{ Close() error }); ok {
+		closer.Close()
+	}
+}
+
+// send delivers an event as a CloudEvent
+func (f *eventForwarder) send(ctx context.Context, event Event) {
+	subject := event.Release
+	if subject != "" && event.Namespace != "" {
+		subject = event.Namespace + "/" + subject
+	}
+	ce, err := cloudevents.New(f.source, f.instance+"-"+strconv.Itoa(event.ID), event.Type, subject, event.Time, event)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(ctx, forwardFlushTimeout)
+		err = f.sink.Send(ctx, ce)
+		cancel()
+	}
+	if err != nil {
+		f.failed.Add(1)
+		f.logger.Warn("failed to forward event", zap.String("type", event.Type), zap.Int("id", event.ID), zap.Error(err))
+		return
+	}
+	f.delivered.Add(1)
+}
+
+// driftEvents publishes drift reports as daemon events
+type driftEvents struct {
+	events *eventHub
+}
+
+// Notify publishes the report
+func (n driftEvents) Notify(report drift.DriftReport) error {
+	message := fmt.Sprintf("%s drifted (%s, %s severity): %s", report.ReleaseName, report.DriftType, report.Severity, report.Details)
+	if report.DriftType == drift.DriftTypeResolved {
+		message = fmt.Sprintf("drift of %s resolved", report.ReleaseName)
+	}
+	n.events.publish(Event{
+		Time:      report.Timestamp,
+		Type:      EventDrift,
+		Release:   report.ReleaseName,
+		Namespace: report.Namespace,
+		Ready:     report.DriftType == drift.DriftTypeResolved || report.Healed,
+		Message:   message,
+		Data:      report,
+	})
+	return nil
+}
+
+// setDriftNotifiers makes the detector notify notifiers and publish drift
+// events, and sends sync events to the notifiers configured for them
+func (d *Daemon) setDriftNotifiers(notifiers []drift.Notifier) {
+	d.syncNotify.set(drift.SyncNotifiers(notifiers))
+	if d.detector != nil {
+		d.detector.SetNotifiers(append(notifiers, driftEvents{events: &d.events}))
+	}
+}
+
+// publishSyncRun publishes a finished sync run, a heal event when it
+// healed a release
+func (d *Daemon) publishSyncRun(run SyncRun) {
+	succeeded := run.Report.Count(sync.ReleaseStatusSucceeded)
+	failed := run.Report.Count(sync.ReleaseStatusFailed)
+	event := Event{
+		Time:    run.StartTime.Add(run.Duration),
+		Type:    EventSync,
+		Ready:   !run.Report.Failed(),
+		Message: fmt.Sprintf("%s sync: %d succeeded, %d failed", run.Trigger, succeeded, failed),
+		Data:    run.Report,
+	}
+	if run.Trigger == TriggerHeal && len(run.Report.Results) == 1 {
+		result := run.Report.Results[0]
+		event.Type, event.Release, event.Namespace = EventHeal, result.Name, result.Namespace
+		event.Message = fmt.Sprintf("%s healed", result.Name)
+		if failed > 0 {
+			event.Message = fmt.Sprintf("failed to heal %s: %s", result.Name, result.Error)
+		}
+	}
+	d.events.publish(event)
+}
+
+// publishSubstitution publishes a substitution change recorded in the
+// audit log
+func (d *Daemon) publishSubstitution(entry audit.Entry) {
+	var message string
+	switch entry.Action {
+	case audit.ActionAdd:
+		message = fmt.Sprintf("%s %s substituted with %s", entry.Kind, entry.Original, entry.Target)
+	case audit.ActionRemove:
+		message = fmt.Sprintf("%s substitution of %s removed", entry.Kind, entry.Original)
+	default:
+		message = fmt.Sprintf("%s substitution of %s %sd", entry.Kind, entry.Original, entry.Action)
+	}
+	d.events.publish(Event{
+		Time:      entry.Time,
+		Type:      EventSubstitution,
+		Release:   entry.Release,
+		Namespace: entry.Namespace,
+		Ready:     true,
+		Message:   message,
+		Data:      entry,
+	})
+}
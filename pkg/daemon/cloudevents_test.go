@@ -0,0 +1,93 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/audit"
+	"github.com/oleksiyp/helmfire/pkg/cloudevents"
+	"github.com/oleksiyp/helmfire/pkg/drift"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+	"go.uber.org/zap"
+)
+
+func TestEventForwarder(t *testing.T) {
+	var (
+		mu       gosync.Mutex
+		received []cloudevents.Event
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event cloudevents.Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("failed to decode event: %v", err)
+		}
+		mu.Lock()
+		received = append(received, event)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	forwarder, err := newEventForwarder(DaemonConfig{
+		CloudEventsSink:   server.URL,
+		CloudEventsSource: "/helmfire/test",
+		CloudEventsTypes:  []string{EventHeal, EventDrift, EventSubstitution},
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &Daemon{forwarder: forwarder}
+	d.events.forward = forwarder.forward
+	go forwarder.run()
+
+	heal := sync.NewReport()
+	heal.Record("web", "apps", time.Second, nil)
+	d.publishSyncRun(SyncRun{Trigger: TriggerHeal, Report: *heal})
+	run := sync.NewReport()
+	run.Record("web", "apps", time.Second, nil)
+	d.publishSyncRun(SyncRun{Trigger: TriggerSource, Report: *run}) // not forwarded
+	d.publishSubstitution(audit.Entry{Action: audit.ActionAdd, Kind: audit.KindImage, Original: "nginx:1.25", Target: "nginx:1.26", Via: audit.ViaAPI})
+	driftEvents{events: &d.events}.Notify(drift.DriftReport{ReleaseName: "web", Namespace: "apps", DriftType: drift.DriftTypeResolved, Timestamp: time.Now()})
+	forwarder.shutdown()
+
+	if len(received) != 3 {
+		t.Fatalf("expected 3 events forwarded, got %+v", received)
+	}
+	want := []struct{ eventType, subject, message string }{
+		{"io.helmfire.heal", "apps/web", "web healed"},
+		{"io.helmfire.substitution", "", "image nginx:1.25 substituted with nginx:1.26"},
+		{"io.helmfire.drift", "apps/web", "drift of web resolved"},
+	}
+	for i, w := range want {
+		event := received[i]
+		var data Event
+		json.Unmarshal(event.Data, &data)
+		if event.Type != w.eventType || event.Subject != w.subject || data.Message != w.message || event.Source != "/helmfire/test" {
+			t.Errorf("event %d = %+v (message %q), want %s on %q: %q", i, event, data.Message, w.eventType, w.subject, w.message)
+		}
+	}
+	if received[0].ID == received[1].ID {
+		t.Errorf("expected unique event IDs, got %s twice", received[0].ID)
+	}
+	if forwarder.delivered.Load() != 3 || forwarder.failed.Load() != 0 {
+		t.Errorf("expected 3 events delivered, got %d delivered, %d failed", forwarder.delivered.Load(), forwarder.failed.Load())
+	}
+}
+
+func TestNewEventForwarderErrors(t *testing.T) {
+	for _, config := range []DaemonConfig{
+		{CloudEventsSink: "kafka://broker:9092"},
+		{CloudEventsSink: "http://localhost:9000", CloudEventsTypes: []string{"deploy"}},
+	} {
+		if _, err := newEventForwarder(config, zap.NewNop()); err == nil {
+			t.Errorf("newEventForwarder(%+v) succeeded, want error", config)
+		}
+	}
+
+	if f, err := newEventForwarder(DaemonConfig{}, zap.NewNop()); f != nil || err != nil {
+		t.Errorf("expected no forwarder without a sink, got %v, %v", f, err)
+	}
+}
@@ -5,35 +5,43 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
-	"strconv"
-	"strings"
-	"syscall"
 	"time"
 
+	"github.com/oleksiyp/helmfire/pkg/audit"
+	"github.com/oleksiyp/helmfire/pkg/deploystatus"
 	"github.com/oleksiyp/helmfire/pkg/drift"
 	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/kubeauth"
+	"github.com/oleksiyp/helmfire/pkg/leader"
+	"github.com/oleksiyp/helmfire/pkg/rendercache"
 	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"github.com/oleksiyp/helmfire/pkg/sync"
 	"go.uber.org/zap"
 )
 
 const (
-	DefaultPIDFile = "/tmp/helmfire.pid"
-	DefaultLogFile = "/tmp/helmfire.log"
 	DefaultAPIAddr = "127.0.0.1:8080"
 )
 
 // NewDaemon creates a new daemon instance
 func NewDaemon(config DaemonConfig, logger *zap.Logger) (*Daemon, error) {
 	// Set defaults
+	defaults := DefaultPaths()
 	if config.PIDFile == "" {
-		config.PIDFile = DefaultPIDFile
+		config.PIDFile = defaults.PIDFile
 	}
 	if config.LogFile == "" {
-		config.LogFile = DefaultLogFile
+		config.LogFile = defaults.LogFile
 	}
 	if config.APIAddr == "" {
 		config.APIAddr = DefaultAPIAddr
 	}
+	if config.AuditLogFile == "" {
+		config.AuditLogFile = defaults.AuditLogFile
+	}
+	if config.StateFile == "" {
+		config.StateFile = defaults.StateFile
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -46,40 +54,192 @@ func NewDaemon(config DaemonConfig, logger *zap.Logger) (*Daemon, error) {
 		cancel:     cancel,
 		shutdownCh: make(chan os.Signal, 1),
 		startTime:  time.Now(),
+
+		resyncOnExpiry: config.ResyncOnExpiry,
+		audit:          audit.NewLog(config.AuditLogFile),
+		apiMiddleware: MiddlewareConfig{
+			RateLimit:   config.APIRateLimit,
+			RateBurst:   config.APIRateBurst,
+			CORSOrigins: config.APICORSOrigins,
+		},
+		supervised: config.Supervised,
+		restarts:   config.Restarts,
+		command:    config.Command,
+		reloader:   reloader{reload: config.Reload},
+		access:     accessControl{policy: config.APIAccess},
 	}
 
 	// Initialize substitutor
 	d.substitutor = substitute.NewManager()
+	providers, err := substitute.NewProviders(config.SubstitutionProviders)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure substitution providers: %w", err)
+	}
+	for _, provider := range providers {
+		d.substitutor.AddProvider(provider)
+	}
+
+	// Fetch the helmfile from its source if configured
+	if config.HelmfileSource != nil {
+		path, err := d.fetchSource(config.HelmfileSource)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch helmfile from %s: %w", config.HelmfileSource, err)
+		}
+		config.HelmfilePath = path
+
+		d.sourceInterval = config.SourceInterval
+		if d.sourceInterval <= 0 {
+			d.sourceInterval = DefaultSourceInterval
+		}
+	}
 
 	// Initialize helmfile manager
 	d.manager = helmstate.NewManager(config.HelmfilePath, config.Environment)
+	if config.HelmfileSource == nil {
+		d.manager.ExtraPaths = config.ExtraPaths
+	}
+	if config.HelmBinary != "" {
+		d.manager.HelmBinary = config.HelmBinary
+	}
+	d.manager.Strict = config.StrictHelmfile
+	d.manager.DiffContext = config.DriftContext
+	d.renderCache = rendercache.New(config.RenderCacheSize)
+	d.manager.RenderCache = d.renderCache
+	d.manager.OfflineCharts = config.OfflineCharts
+	d.manager.NamespaceTemplate = config.NamespaceTemplate
+	d.manager.ReleasePrefix = config.ReleasePrefix
 	if err := d.manager.Load(); err != nil {
+		if d.sourceDir != "" {
+			os.RemoveAll(d.sourceDir)
+		}
 		return nil, fmt.Errorf("failed to load helmfile: %w", err)
 	}
+	d.logMissingFiles()
+	d.events.generation = d.manager.Generation
+
+	// Forward events to external automation if configured
+	if d.forwarder, err = newEventForwarder(config, logger); err != nil {
+		return nil, fmt.Errorf("failed to configure event sink: %w", err)
+	}
+	if d.forwarder != nil {
+		d.events.forward = d.forwarder.forward
+	}
+	if config.DeployStatus != nil {
+		d.deployStatus = deploystatus.New(*config.DeployStatus)
+	}
+
+	// Initialize sync executor
+	d.executor = sync.NewExecutor(logger, d.substitutor)
+	if config.HelmBinary != "" {
+		d.executor.SetHelmBinary(config.HelmBinary)
+	}
+	d.executor.SetStamp(config.Stamp)
+	d.executor.SetResourceProfile(config.ResourceProfile)
+	d.executor.SetPolicy(config.Policy)
+	d.executor.SetCreateNamespace(!config.DisableCreateNamespace)
+	d.executor.SetVerifyNamespaces(config.VerifyNamespaces)
+	d.executor.SetNamespaceLookup(d.manager.GetNamespace)
+	d.executor.SetRenderCache(d.renderCache)
+	d.executor.SetOfflineCharts(config.OfflineCharts)
+	d.executor.SetProgress(d.publishProgress)
+
+	d.kubeAuth = &kubeAuth{refresher: kubeauth.NewRefresher()}
+
+	notifiers, err := driftNotifiers(config, logger)
+	if err != nil {
+		return nil, err
+	}
 
 	// Initialize drift detector if configured
 	if config.DriftInterval > 0 {
 		d.detector = drift.NewDetector(d.manager, config.DriftInterval, logger)
-		d.detector.AddNotifier(drift.NewStdoutNotifier(logger))
+		d.detector.SetInspector(d.driftInspector())
+		d.detector.OnCheck(d.observeKubeResult)
+		d.detector.SetJitter(config.DriftJitter)
+		d.detector.SetStagger(config.DriftStagger)
+		d.detector.SetFlapWindow(config.DriftFlap)
+		d.detector.SetRedactor(d.executor.Redactor())
+		d.detector.SetWorkers(config.DriftWorkers)
+		d.detector.SetPrecheck(!config.DisableDriftPrecheck)
+
+		// Auto-heal can be turned on through the API later
+		d.detector.EnableAutoHeal(config.DriftAutoHeal, d.healRelease)
+		d.detector.SetHealPolicy(config.HealPolicy)
+		if config.HealPreview {
+			d.detector.EnableHealPreview(d.previewRelease)
+		}
 
-		if config.DriftWebhook != "" {
-			d.detector.AddNotifier(drift.NewWebhookNotifier(config.DriftWebhook, logger))
+		if config.DriftOrphans || config.Prune {
+			var pruneFunc func(name, namespace, kubeContext string) error
+			if config.Prune {
+				pruneFunc = func(name, namespace, kubeContext string) error {
+					return d.executor.UninstallRelease(d.ctx, name, namespace, kubeContext)
+				}
+			}
+			d.detector.EnableOrphanDetection(true, pruneFunc)
 		}
+	}
+	d.setDriftNotifiers(notifiers)
+
+	// Initialize leader election if configured
+	if config.LeaderElection {
+		elector, err := leader.NewElector(leader.Config{
+			LeaseName:        config.LeaderElectionLease,
+			Namespace:        config.LeaderElectionNamespace,
+			Identity:         config.LeaderElectionIdentity,
+			OnStartedLeading: d.startLeading,
+			OnStoppedLeading: d.stopLeading,
+		}, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure leader election: %w", err)
+		}
+		d.elector = elector
+	}
 
-		if config.DriftAutoHeal {
-			// Auto-heal function will be set when we have access to executor
-			d.detector.EnableAutoHeal(true, nil)
+	// Restore substitutions, drift reports and the last sync result from
+	// before the daemon last stopped, and keep saving them
+	if config.StateFile != "" {
+		d.state = &stateStore{path: config.StateFile}
+		if err := d.restoreState(); err != nil {
+			logger.Warn("failed to restore daemon state", zap.String("stateFile", config.StateFile), zap.Error(err))
+		}
+		if d.detector != nil {
+			d.detector.OnChange(d.saveState)
 		}
 	}
 
+	d.readiness = d.newReadiness(config)
+
 	// Initialize API server
 	d.apiServer = NewAPIServer(d.apiAddr, d, logger)
 
 	return d, nil
 }
 
+// driftNotifiers creates the notifiers of drift reports: stdout, the drift
+// webhook and the notifiers from the config file
+func driftNotifiers(config DaemonConfig, logger *zap.Logger) ([]drift.Notifier, error) {
+	notifiers := []drift.Notifier{drift.NewStdoutNotifier(logger)}
+	if config.DriftWebhook != "" {
+		notifiers = append(notifiers, drift.NewWebhookNotifier(config.DriftWebhook, logger))
+	}
+
+	configured, err := drift.NewNotifiers(config.Notifiers, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure notifiers: %w", err)
+	}
+	return append(notifiers, configured...), nil
+}
+
 // Start starts the daemon
 func (d *Daemon) Start() error {
+	// A daemon that crashed leaves its PID file behind
+	if reason, err := CleanStalePIDFile(d.pidFile); err != nil {
+		d.logger.Warn("failed to check PID file", zap.String("pidFile", d.pidFile), zap.Error(err))
+	} else if reason != "" {
+		d.logger.Warn("removed stale PID file", zap.String("pidFile", d.pidFile), zap.String("reason", reason))
+	}
+
 	// Check if already running
 	if running, err := d.IsRunning(); err == nil && running {
 		return fmt.Errorf("daemon already running (PID file: %s)", d.pidFile)
@@ -101,8 +261,14 @@ func (d *Daemon) Start() error {
 		return fmt.Errorf("failed to start API server: %w", err)
 	}
 
-	// Start drift detector if configured
-	if d.detector != nil {
+	// With leader election, the detector only runs while leading
+	if d.elector != nil {
+		d.electorDone = make(chan struct{})
+		go func() {
+			defer close(d.electorDone)
+			d.elector.Run(d.ctx)
+		}()
+	} else if d.detector != nil {
 		if err := d.detector.Start(d.ctx); err != nil {
 			d.apiServer.Stop()
 			d.removePIDFile()
@@ -111,8 +277,20 @@ func (d *Daemon) Start() error {
 		d.logger.Info("drift detector started")
 	}
 
+	// Watch the helmfile source for changes
+	if d.source != nil {
+		go d.pollSource()
+	}
+
+	go d.expireSubstitutions()
+
+	if d.forwarder != nil {
+		go d.forwarder.run()
+	}
+
 	// Setup signal handling
-	signal.Notify(d.shutdownCh, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(d.shutdownCh, shutdownSignals...)
+	d.reloadOnSignal()
 
 	d.logger.Info("daemon started successfully")
 	return nil
@@ -120,9 +298,12 @@ func (d *Daemon) Start() error {
 
 // Wait waits for the daemon to be stopped
 func (d *Daemon) Wait() error {
-	// Wait for shutdown signal
-	sig := <-d.shutdownCh
-	d.logger.Info("received shutdown signal", zap.String("signal", sig.String()))
+	// Wait for shutdown signal; nil is a shutdown requested through the API
+	if sig := <-d.shutdownCh; sig != nil {
+		d.logger.Info("received shutdown signal", zap.String("signal", sig.String()))
+	} else {
+		d.logger.Info("received shutdown request")
+	}
 
 	return d.Stop()
 }
@@ -133,9 +314,12 @@ func (d *Daemon) Stop() error {
 
 	// Cancel context
 	d.cancel()
+	d.reloader.stop()
 
-	// Stop drift detector
-	if d.detector != nil {
+	// Stop drift detector; with leader election, giving up the lease stops it
+	if d.electorDone != nil {
+		<-d.electorDone
+	} else if d.detector != nil {
 		if err := d.detector.Stop(); err != nil {
 			d.logger.Error("failed to stop drift detector", zap.Error(err))
 		}
@@ -146,6 +330,17 @@ func (d *Daemon) Stop() error {
 		d.logger.Error("failed to stop API server", zap.Error(err))
 	}
 
+	// Deliver the events still queued for the sink
+	if d.forwarder != nil {
+		d.forwarder.shutdown()
+	}
+
+	if d.sourceDir != "" {
+		os.RemoveAll(d.sourceDir)
+	}
+
+	d.saveState()
+
 	// Remove PID file
 	if err := d.removePIDFile(); err != nil {
 		d.logger.Error("failed to remove PID file", zap.Error(err))
@@ -162,7 +357,7 @@ func (d *Daemon) IsRunning() (bool, error) {
 
 // GetPID returns the daemon PID
 func (d *Daemon) GetPID() (int, error) {
-	data, err := os.ReadFile(d.pidFile)
+	info, err := readPIDFile(d.pidFile)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return 0, fmt.Errorf("daemon not running (PID file not found)")
@@ -170,13 +365,7 @@ func (d *Daemon) GetPID() (int, error) {
 		return 0, err
 	}
 
-	pidStr := strings.TrimSpace(string(data))
-	pid, err := strconv.Atoi(pidStr)
-	if err != nil {
-		return 0, fmt.Errorf("invalid PID in file: %s", pidStr)
-	}
-
-	return pid, nil
+	return info.PID, nil
 }
 
 // GetStatus returns the daemon status
@@ -193,6 +382,29 @@ func (d *Daemon) GetStatus() Status {
 	images := d.substitutor.ListImageSubstitutions()
 	status.ActiveSubstitutions.Charts = len(charts)
 	status.ActiveSubstitutions.Images = len(images)
+	status.Leader = d.IsLeader()
+	status.Supervised = d.supervised
+	status.Restarts = d.restarts
+
+	if last := d.lastSyncResult(); !last.time.IsZero() {
+		status.LastSync = last.time
+		if last.err != nil {
+			status.LastSyncError = last.err.Error()
+		}
+	}
+	for _, state := range d.releaseStates() {
+		if state.LastSync != nil {
+			status.Releases = append(status.Releases, *state.LastSync)
+		}
+	}
+	if d.detector != nil {
+		metrics := d.detector.Metrics()
+		status.Drift = &metrics
+	}
+	if pause := d.PauseStatus(); pause.Paused {
+		status.Pause = &pause
+	}
+	status.SpecGeneration = d.manager.Generation()
 
 	return status
 }
@@ -207,15 +419,118 @@ func (d *Daemon) GetManager() *helmstate.Manager {
 	return d.manager
 }
 
+// GetExecutor returns the sync executor
+func (d *Daemon) GetExecutor() *sync.Executor {
+	return d.executor
+}
+
+// driftInspector compares releases with the cluster as the executor syncs
+// them, with their set values, substitutions, stamp and resources profile
+func (d *Daemon) driftInspector() drift.ReleaseInspector {
+	return sync.NewDriftInspector(d.manager, d.executor)
+}
+
+// healRelease re-syncs a release from the current helmfile
+func (d *Daemon) healRelease(releaseName string) error {
+	release, err := d.findRelease(releaseName)
+	if err != nil {
+		return err
+	}
+
+	d.logger.Info("healing release", zap.String("name", releaseName))
+	report := sync.NewReport()
+	announcer := d.syncAnnouncer(report, TriggerHeal)
+	announcer.ReleaseStarted(release.Name, release.Namespace)
+	start := time.Now()
+	helmRelease, err := d.executor.UpgradeReleaseContext(sync.WithSyncID(d.ctx, report.SyncID), release)
+	report.RecordRelease(release.Name, release.Namespace, time.Since(start), helmRelease, err)
+	announcer.ReleaseFinished(report.Results[0])
+	d.recordSyncRun(TriggerHeal, report)
+	return err
+}
+
+// previewRelease returns the changes healing a release would apply
+func (d *Daemon) previewRelease(releaseName string) (string, error) {
+	release, err := d.findRelease(releaseName)
+	if err != nil {
+		return "", err
+	}
+
+	return d.executor.PreviewReleaseContext(d.ctx, release)
+}
+
+// publishProgress streams rollout progress of waiting releases as events
+func (d *Daemon) publishProgress(p sync.Progress) {
+	d.logger.Info("rollout progress",
+		zap.String("release", p.Release),
+		zap.String("resource", p.Resource),
+		zap.Bool("ready", p.Ready),
+		zap.String("message", p.Message))
+
+	d.events.publish(Event{
+		Time:      p.Time,
+		Type:      EventRollout,
+		Release:   p.Release,
+		Namespace: p.Namespace,
+		Resource:  p.Resource,
+		Ready:     p.Ready,
+		Message:   p.Message,
+	})
+}
+
+// findRelease looks up a release in the current helmfile
+func (d *Daemon) findRelease(releaseName string) (helmstate.Release, error) {
+	for _, release := range d.manager.GetReleases() {
+		if release.Name == releaseName {
+			return release, nil
+		}
+	}
+	return helmstate.Release{}, fmt.Errorf("release not found: %s", releaseName)
+}
+
+// IsLeader reports whether this daemon may sync and heal. Without leader
+// election every daemon is the leader.
+func (d *Daemon) IsLeader() bool {
+	return d.elector == nil || d.elector.IsLeader()
+}
+
+// startLeading starts drift detection when this daemon becomes the leader
+func (d *Daemon) startLeading(ctx context.Context) {
+	if d.detector == nil {
+		return
+	}
+	if err := d.detector.Start(ctx); err != nil {
+		d.logger.Error("failed to start drift detector", zap.Error(err))
+		return
+	}
+	d.logger.Info("drift detector started")
+}
+
+// stopLeading stops drift detection when this daemon loses leadership
+func (d *Daemon) stopLeading() {
+	if d.detector == nil {
+		return
+	}
+	if err := d.detector.Stop(); err != nil {
+		d.logger.Error("failed to stop drift detector", zap.Error(err))
+	}
+}
+
 // GetDetector returns the drift detector
 func (d *Daemon) GetDetector() *drift.Detector {
 	return d.detector
 }
 
-// writePIDFile writes the current PID to the PID file
+// writePIDFile records the current process in the PID file
 func (d *Daemon) writePIDFile() error {
-	pid := os.Getpid()
-	return os.WriteFile(d.pidFile, []byte(fmt.Sprintf("%d\n", pid)), 0644)
+	info, err := currentPIDInfo()
+	if err != nil {
+		return err
+	}
+	info.Command = d.command
+	info.LogFile = d.logFile
+	info.Supervised = d.supervised
+	return writePIDFile(d.pidFile, info)
 }
 
 // removePIDFile removes the PID file
@@ -223,9 +538,11 @@ func (d *Daemon) removePIDFile() error {
 	return os.Remove(d.pidFile)
 }
 
-// IsDaemonRunning checks if a daemon is running based on PID file
+// IsDaemonRunning checks if a daemon is running based on PID file. A process
+// with the PID whose project, start time or binary differ from those recorded
+// is not the daemon but a reused PID.
 func IsDaemonRunning(pidFile string) (bool, error) {
-	data, err := os.ReadFile(pidFile)
+	info, err := readPIDFile(pidFile)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return false, nil
@@ -233,30 +550,12 @@ func IsDaemonRunning(pidFile string) (bool, error) {
 		return false, err
 	}
 
-	pidStr := strings.TrimSpace(string(data))
-	pid, err := strconv.Atoi(pidStr)
-	if err != nil {
-		return false, fmt.Errorf("invalid PID in file: %s", pidStr)
-	}
-
-	// Check if process exists
-	process, err := os.FindProcess(pid)
-	if err != nil {
-		return false, nil
-	}
-
-	// Send signal 0 to check if process is running
-	err = process.Signal(syscall.Signal(0))
-	if err != nil {
-		return false, nil
-	}
-
-	return true, nil
+	return staleReason(info) == "", nil
 }
 
 // StopDaemon stops a running daemon
-func StopDaemon(pidFile string) error {
-	data, err := os.ReadFile(pidFile)
+func StopDaemon(pidFile, apiAddr string) error {
+	info, err := readPIDFile(pidFile)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return fmt.Errorf("daemon not running (PID file not found)")
@@ -264,10 +563,11 @@ func StopDaemon(pidFile string) error {
 		return err
 	}
 
-	pidStr := strings.TrimSpace(string(data))
-	pid, err := strconv.Atoi(pidStr)
-	if err != nil {
-		return fmt.Errorf("invalid PID in file: %s", pidStr)
+	// Never signal a process that merely inherited the daemon's PID
+	pid := info.PID
+	if reason := staleReason(info); reason != "" {
+		os.Remove(pidFile)
+		return fmt.Errorf("daemon not running: removed stale PID file (%s)", reason)
 	}
 
 	process, err := os.FindProcess(pid)
@@ -275,16 +575,18 @@ func StopDaemon(pidFile string) error {
 		return fmt.Errorf("process not found: %w", err)
 	}
 
-	// Send SIGTERM
-	if err := process.Signal(syscall.SIGTERM); err != nil {
-		return fmt.Errorf("failed to send SIGTERM: %w", err)
+	// Ask the daemon to shut down through its API, which works on every
+	// platform, and fall back to a signal when the API at apiAddr is
+	// unreachable or belongs to another daemon
+	if !requestShutdown(apiAddr, pid) {
+		if err := terminateProcess(process); err != nil {
+			return fmt.Errorf("failed to stop process: %w", err)
+		}
 	}
 
 	// Wait for process to exit (with timeout)
 	for i := 0; i < 30; i++ {
-		err := process.Signal(syscall.Signal(0))
-		if err != nil {
-			// Process no longer exists
+		if !processRunning(pid) {
 			os.Remove(pidFile)
 			return nil
 		}
@@ -300,6 +602,19 @@ func StopDaemon(pidFile string) error {
 	return nil
 }
 
+// requestShutdown asks the daemon with pid to shut down through its API
+func requestShutdown(apiAddr string, pid int) bool {
+	if apiAddr == "" {
+		return false
+	}
+	client := NewAPIClient(apiAddr)
+	status, err := client.GetStatus()
+	if err != nil || status.PID != pid {
+		return false
+	}
+	return client.Shutdown() == nil
+}
+
 // GetDaemonStatus returns the status of a daemon
 func GetDaemonStatus(pidFile, apiAddr string) (*Status, error) {
 	running, err := IsDaemonRunning(pidFile)
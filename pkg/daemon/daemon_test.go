@@ -3,6 +3,7 @@ package daemon
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -91,3 +92,26 @@ func TestStatus(t *testing.T) {
 		t.Errorf("Expected PID to be 12345, got: %d", status.PID)
 	}
 }
+
+func TestRequestShutdownChecksPID(t *testing.T) {
+	server, handler := newTestServer(t)
+	handler.daemon.shutdownCh = make(chan os.Signal, 1)
+	handler.daemon.startTime = time.Now()
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	if requestShutdown(addr, os.Getpid()+1) {
+		t.Fatal("expected no shutdown request to a daemon with another PID")
+	}
+
+	if !requestShutdown(addr, os.Getpid()) {
+		t.Fatal("expected shutdown request to be accepted")
+	}
+	select {
+	case sig := <-handler.daemon.shutdownCh:
+		if sig != nil {
+			t.Errorf("expected an API shutdown, got signal %v", sig)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected the daemon to be asked to shut down")
+	}
+}
@@ -0,0 +1,41 @@
+package daemon
+
+import (
+	"context"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/deploystatus"
+	"go.uber.org/zap"
+)
+
+// deployStatusTimeout bounds reporting the status of one sync run
+const deployStatusTimeout = time.Minute
+
+// reportDeployStatus reports a sync run as the status of the git revision
+// of the helmfile, in the background so syncs never wait for the API.
+// Rollbacks aren't reported: they deploy an earlier helm revision, not the
+// helmfile's commit.
+func (d *Daemon) reportDeployStatus(run SyncRun) {
+	if d.deployStatus == nil || run.Trigger == TriggerRollback || len(run.Results) == 0 {
+		return
+	}
+	files := d.manager.Snapshot().Files
+	if len(files) == 0 {
+		return
+	}
+
+	go func() {
+		rev, err := deploystatus.DetectRevision(files[0])
+		if err != nil {
+			d.logger.Warn("failed to detect the git revision of the helmfile, not reporting sync status", zap.Error(err))
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), deployStatusTimeout)
+		defer cancel()
+		if err := d.deployStatus.Report(ctx, deploystatus.NewStatus(rev, &run.Report)); err != nil {
+			d.logger.Warn("failed to report sync status", zap.Int("run", run.ID), zap.Error(err))
+			return
+		}
+		d.logger.Debug("reported sync status", zap.Int("run", run.ID), zap.String("commit", rev.Commit))
+	}()
+}
@@ -0,0 +1,75 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/deploystatus"
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+	"go.uber.org/zap"
+)
+
+func TestReportDeployStatus(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	dir := t.TempDir()
+	helmfile := filepath.Join(dir, "helmfile.yaml")
+	os.WriteFile(helmfile, []byte("releases: []\n"), 0644)
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"remote", "add", "origin", "https://github.com/org/deploy.git"},
+		{"add", "helmfile.yaml"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", "initial"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+
+	statuses := make(chan map[string]string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		body["path"] = r.URL.Path
+		statuses <- body
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	manager := helmstate.NewManager(helmfile, "")
+	if err := manager.Load(); err != nil {
+		t.Fatal(err)
+	}
+	d := &Daemon{
+		manager:      manager,
+		logger:       zap.NewNop(),
+		deployStatus: deploystatus.New(deploystatus.Config{APIURL: server.URL, Token: "test", Environment: "staging"}),
+	}
+
+	report := sync.NewReport()
+	report.Record("web", "apps", time.Second, nil)
+	d.reportDeployStatus(SyncRun{ID: 1, Trigger: TriggerRollback, Report: *report}) // not reported
+	d.reportDeployStatus(SyncRun{ID: 2, Trigger: TriggerSource, Report: *report})
+
+	select {
+	case status := <-statuses:
+		if len(status["path"]) != len("/repos/org/deploy/statuses/")+40 || status["state"] != "success" || status["context"] != "helmfire/staging" {
+			t.Errorf("unexpected status %+v", status)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the sync status")
+	}
+	select {
+	case status := <-statuses:
+		t.Errorf("expected one status, got another: %+v", status)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
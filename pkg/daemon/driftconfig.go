@@ -0,0 +1,80 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/drift"
+	"go.uber.org/zap"
+)
+
+// handleDriftConfig serves the drift settings of the running daemon
+// (/api/v1/drift/config): GET returns them and PATCH changes the interval,
+// auto-heal and which releases are checked periodically, until the daemon
+// restarts or reloads its configuration.
+func (h *APIHandler) handleDriftConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPatch {
+		h.methodNotAllowed(w)
+		return
+	}
+
+	detector := h.daemon.GetDetector()
+	if detector == nil {
+		h.sendError(w, "Drift detection not enabled", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodPatch {
+		var req DriftConfigRequest
+		if err := decodeRequest(r, &req); err != nil {
+			h.sendError(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			h.sendValidationError(w, err)
+			return
+		}
+
+		// Check every release before changing anything
+		names := make([]string, 0, len(req.Releases))
+		for name := range req.Releases {
+			if _, err := h.daemon.findRelease(name); err != nil {
+				h.sendError(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		if req.Interval != "" {
+			interval, _ := time.ParseDuration(req.Interval)
+			detector.SetInterval(interval)
+		}
+		if req.AutoHeal != nil {
+			detector.SetAutoHeal(*req.AutoHeal)
+		}
+		for _, name := range names {
+			detector.SetReleaseEnabled(name, req.Releases[name])
+		}
+
+		h.logger.Info("drift settings changed via API",
+			zap.String("interval", req.Interval),
+			zap.Any("autoHeal", req.AutoHeal),
+			zap.Any("releases", req.Releases))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(driftConfig(detector))
+}
+
+// driftConfig returns the current drift settings of detector
+func driftConfig(detector *drift.Detector) DriftConfigResponse {
+	return DriftConfigResponse{
+		Interval:         detector.Interval().String(),
+		AutoHeal:         detector.AutoHeal(),
+		DisabledReleases: detector.DisabledReleases(),
+	}
+}
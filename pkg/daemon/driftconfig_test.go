@@ -0,0 +1,75 @@
+package daemon
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/drift"
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+)
+
+func TestHandleDriftConfig(t *testing.T) {
+	handler := newTestHandler(t)
+	handler.daemon.manager.Spec.Releases = []helmstate.Release{{Name: "web"}, {Name: "db"}}
+
+	patch := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/api/v1/drift/config", bytes.NewBufferString(body))
+		rec := httptest.NewRecorder()
+		handler.handleDriftConfig(rec, req)
+		return rec
+	}
+
+	if rec := patch(`{"autoHeal": true}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without drift detection, got %d", rec.Code)
+	}
+
+	detector := drift.NewDetector(handler.daemon.manager, time.Minute, handler.logger)
+	detector.EnableAutoHeal(false, func(string) error { return nil })
+	handler.daemon.detector = detector
+
+	rec := patch(`{"interval": "5m", "autoHeal": true, "releases": {"db": false}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp DriftConfigResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	want := DriftConfigResponse{Interval: "5m0s", AutoHeal: true, DisabledReleases: []string{"db"}}
+	if !reflect.DeepEqual(resp, want) {
+		t.Errorf("expected %+v, got %+v", want, resp)
+	}
+	if detector.Interval() != 5*time.Minute || !detector.AutoHeal() || detector.ReleaseEnabled("db") {
+		t.Error("expected the detector to be reconfigured")
+	}
+
+	// Nothing is applied when a release is unknown
+	if rec := patch(`{"autoHeal": false, "releases": {"db": true, "cache": false}}`); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown release, got %d", rec.Code)
+	}
+	if !detector.AutoHeal() || detector.ReleaseEnabled("db") {
+		t.Error("expected a rejected request to change nothing")
+	}
+
+	for _, body := range []string{`{}`, `{"interval": "-1m"}`, `{"interval": "soon"}`} {
+		if rec := patch(body); rec.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s, got %d", body, rec.Code)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	handler.handleDriftConfig(rec, httptest.NewRequest(http.MethodGet, "/api/v1/drift/config", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	handler.handleDriftConfig(rec, httptest.NewRequest(http.MethodPost, "/api/v1/drift/config", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", rec.Code)
+	}
+}
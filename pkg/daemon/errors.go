@@ -0,0 +1,119 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Error codes returned in ErrorResponse.Code
+const (
+	CodeInvalidRequest    = "invalid_request"
+	CodeValidationFailed  = "validation_failed"
+	CodeNotFound          = "not_found"
+	CodeMethodNotAllowed  = "method_not_allowed"
+	CodeIncompatibleChart = "incompatible_chart"
+	CodeNotLeader         = "not_leader"
+	CodeUnavailable       = "unavailable"
+	CodeRateLimited       = "rate_limited"
+	CodeUnauthorized      = "unauthorized"
+	CodeForbidden         = "forbidden"
+	CodeInternal          = "internal"
+)
+
+// FieldError describes a problem with one field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists the problems found validating a request
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	messages := make([]string, len(e))
+	for i, f := range e {
+		messages[i] = f.Field + ": " + f.Message
+	}
+	return "invalid request: " + strings.Join(messages, "; ")
+}
+
+// validator collects field errors while validating a request
+type validator struct {
+	errs ValidationError
+}
+
+// require records an error if a required field is empty
+func (v *validator) require(field, value string) bool {
+	if value == "" {
+		v.errs = append(v.errs, FieldError{Field: field, Message: "is required"})
+		return false
+	}
+	return true
+}
+
+// check records err, if any, against field
+func (v *validator) check(field string, err error) {
+	if err != nil {
+		v.errs = append(v.errs, FieldError{Field: field, Message: err.Error()})
+	}
+}
+
+// err returns the collected errors, or nil if the request is valid
+func (v *validator) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// codeForStatus returns the error code used for an HTTP status by default
+func codeForStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return CodeInvalidRequest
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	}
+	return CodeInternal
+}
+
+// sendErrorCode sends an error response with a specific error code
+func (h *APIHandler) sendErrorCode(w http.ResponseWriter, code, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: message, Code: code})
+}
+
+// sendValidationError sends the field errors of an invalid request
+func (h *APIHandler) sendValidationError(w http.ResponseWriter, err error) {
+	fields, ok := err.(ValidationError)
+	if !ok {
+		h.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: fields.Error(), Code: CodeValidationFailed, Fields: fields})
+}
+
+// methodNotAllowed rejects a request with an unsupported method
+func (h *APIHandler) methodNotAllowed(w http.ResponseWriter) {
+	h.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+}
+
+// notFound answers a request for an unknown route
+func (h *APIHandler) notFound(w http.ResponseWriter, r *http.Request) {
+	h.sendError(w, "Not found: "+r.URL.Path, http.StatusNotFound)
+}
@@ -0,0 +1,199 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	EventRollout      = "rollout"      // a workload of a waiting release changed readiness
+	EventReload       = "reload"       // the helmfile was loaded again
+	EventSync         = "sync"         // a sync run finished
+	EventHeal         = "heal"         // a drifted release was synced again
+	EventDrift        = "drift"        // drift was detected or resolved
+	EventSubstitution = "substitution" // a substitution was added, removed or expired
+)
+
+// maxEvents bounds the number of events kept for clients catching up
+const maxEvents = 200
+
+// eventKeepAlive is how often an idle event stream sends a comment so
+// proxies don't close it
+const eventKeepAlive = 15 * time.Second
+
+// Event is something that happened in the daemon, streamed to clients
+type Event struct {
+	ID        int       `json:"id"`
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	Release   string    `json:"release,omitempty"`
+	Namespace string    `json:"namespace,omitempty"`
+	Resource  string    `json:"resource,omitempty"`
+	Ready     bool      `json:"ready"`
+	Message   string    `json:"message"`
+
+	// Generation is the spec generation the daemon was working with
+	Generation uint64 `json:"generation,omitempty"`
+
+	// Data details sync, heal, drift and substitution events: the sync
+	// report, drift report or audit entry
+	Data interface{} `json:"data,omitempty"`
+}
+
+// EventsResponse lists events, oldest first
+type EventsResponse struct {
+	Events []Event `json:"events"`
+}
+
+// eventHub keeps the latest events and wakes up streaming clients. The zero
+// value is ready to use.
+type eventHub struct {
+	mu          sync.Mutex
+	nextID      int
+	events      []Event
+	subscribers map[chan struct{}]struct{}
+
+	// generation stamps events that don't carry a spec generation; none
+	// when nil
+	generation func() uint64
+
+	// forward passes each event on as it is published, without blocking
+	forward func(Event)
+}
+
+// publish assigns event an ID and notifies subscribers
+func (h *eventHub) publish(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.nextID++
+	event.ID = h.nextID
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if event.Generation == 0 && h.generation != nil {
+		event.Generation = h.generation()
+	}
+	h.events = append(h.events, event)
+	if h.forward != nil {
+		h.forward(event)
+	}
+	if len(h.events) > maxEvents {
+		h.events = h.events[len(h.events)-maxEvents:]
+	}
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// since returns the kept events with an ID greater than id
+func (h *eventHub) since(id int) []Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	events := []Event{}
+	for _, event := range h.events {
+		if event.ID > id {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// subscribe returns a channel signalled when events are published and a
+// function removing it
+func (h *eventHub) subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	h.mu.Lock()
+	if h.subscribers == nil {
+		h.subscribers = make(map[chan struct{}]struct{})
+	}
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subscribers, ch)
+		h.mu.Unlock()
+	}
+}
+
+// handleEvents lists events after ?since= (GET /api/v1/events), or streams
+// them as server-sent events when the client accepts text/event-stream or
+// sets ?stream=true
+func (h *APIHandler) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.methodNotAllowed(w)
+		return
+	}
+
+	since := 0
+	raw := r.URL.Query().Get("since")
+	if raw == "" {
+		raw = r.Header.Get("Last-Event-ID")
+	}
+	if raw != "" {
+		var err error
+		if since, err = strconv.Atoi(raw); err != nil || since < 0 {
+			h.sendError(w, "Invalid since: must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if r.URL.Query().Get("stream") != "true" && !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(EventsResponse{Events: h.daemon.events.since(since)})
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		h.sendError(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	notify, unsubscribe := h.daemon.events.subscribe()
+	defer unsubscribe()
+
+	var daemonDone <-chan struct{}
+	if h.daemon.ctx != nil {
+		daemonDone = h.daemon.ctx.Done()
+	}
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		for _, event := range h.daemon.events.since(since) {
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+			since = event.ID
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-daemonDone:
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-notify:
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/sync"
+)
+
+func TestEventHub(t *testing.T) {
+	var hub eventHub
+	for i := 0; i < maxEvents+5; i++ {
+		hub.publish(Event{Type: EventRollout})
+	}
+
+	events := hub.since(0)
+	if len(events) != maxEvents {
+		t.Fatalf("expected %d events kept, got %d", maxEvents, len(events))
+	}
+	if events[0].ID != 6 || events[len(events)-1].ID != maxEvents+5 {
+		t.Errorf("expected the newest events, got IDs %d to %d", events[0].ID, events[len(events)-1].ID)
+	}
+	if got := hub.since(maxEvents + 3); len(got) != 2 {
+		t.Errorf("expected 2 events after %d, got %d", maxEvents+3, len(got))
+	}
+
+	notify, unsubscribe := hub.subscribe()
+	hub.publish(Event{Type: EventRollout})
+	select {
+	case <-notify:
+	default:
+		t.Error("expected the subscriber to be notified")
+	}
+	unsubscribe()
+	if len(hub.subscribers) != 0 {
+		t.Error("expected the subscriber to be removed")
+	}
+}
+
+func TestHandleEvents(t *testing.T) {
+	handler := newTestHandler(t)
+	handler.daemon.publishProgress(sync.Progress{
+		Release:       "web",
+		Namespace:     "apps",
+		RolloutStatus: sync.RolloutStatus{Resource: "Deployment/web", Message: "1 of 3 updated replicas"},
+	})
+	handler.daemon.publishProgress(sync.Progress{
+		Release:       "web",
+		Namespace:     "apps",
+		RolloutStatus: sync.RolloutStatus{Resource: "Deployment/web", Ready: true, Message: "3 of 3 replicas available"},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/events?since=1", nil)
+	rec := httptest.NewRecorder()
+	handler.handleEvents(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp EventsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Events) != 1 || resp.Events[0].ID != 2 || !resp.Events[0].Ready || resp.Events[0].Type != EventRollout {
+		t.Errorf("unexpected events: %+v", resp.Events)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/events?since=x", nil)
+	rec = httptest.NewRecorder()
+	handler.handleEvents(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid since, got %d", rec.Code)
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	handler := newTestHandler(t)
+	handler.daemon.events.publish(Event{Type: EventRollout, Resource: "Deployment/web"})
+
+	server := httptest.NewServer(handler.withMiddleware(http.HandlerFunc(handler.handleEvents), MiddlewareConfig{}))
+	defer server.Close()
+	client := NewAPIClient(strings.TrimPrefix(server.URL, "http://"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	received := make(chan Event)
+	done := make(chan error, 1)
+	go func() {
+		done <- client.StreamEvents(ctx, 0, func(event Event) { received <- event })
+	}()
+
+	// The kept event is replayed, then new ones are streamed as published
+	if event := <-received; event.ID != 1 || event.Resource != "Deployment/web" {
+		t.Errorf("unexpected replayed event: %+v", event)
+	}
+	handler.daemon.events.publish(Event{Type: EventRollout, Resource: "Job/migrate", Ready: true})
+	if event := <-received; event.ID != 2 || event.Resource != "Job/migrate" || !event.Ready {
+		t.Errorf("unexpected streamed event: %+v", event)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("expected the stream to end cleanly, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package daemon
+
+import (
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/audit"
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"go.uber.org/zap"
+)
+
+// substitutionExpiryInterval is how often substitution TTLs are checked
+const substitutionExpiryInterval = 10 * time.Second
+
+// expireSubstitutions removes substitutions whose TTL has passed until the
+// daemon stops
+func (d *Daemon) expireSubstitutions() {
+	ticker := time.NewTicker(substitutionExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case now := <-ticker.C:
+			// Substitutions expiring while paused expire once resumed
+			if !d.paused() {
+				d.expireSubstitutionsAt(now)
+			}
+		}
+	}
+}
+
+// expireSubstitutionsAt removes expired substitutions and, when configured,
+// resyncs the releases they applied to back to the original chart or image
+func (d *Daemon) expireSubstitutionsAt(now time.Time) {
+	charts, images := d.substitutor.ExpireSubstitutions(now)
+	if len(charts) == 0 && len(images) == 0 {
+		return
+	}
+
+	for _, c := range charts {
+		d.logger.Info("chart substitution expired",
+			zap.String("original", c.Original),
+			zap.String("local", c.LocalPath),
+			zap.Stringer("scope", c.Scope))
+		d.recordAudit(audit.Entry{
+			Time:      now,
+			Action:    audit.ActionExpire,
+			Kind:      audit.KindChart,
+			Original:  c.Original,
+			Target:    c.LocalPath,
+			Release:   c.Scope.Release,
+			Namespace: c.Scope.Namespace,
+			Via:       audit.ViaDaemon,
+		})
+	}
+	for _, img := range images {
+		d.logger.Info("image substitution expired",
+			zap.String("original", img.Original),
+			zap.String("replacement", img.Replacement),
+			zap.Stringer("scope", img.Scope))
+		d.recordAudit(audit.Entry{
+			Time:      now,
+			Action:    audit.ActionExpire,
+			Kind:      audit.KindImage,
+			Original:  img.Original,
+			Target:    img.Replacement,
+			Release:   img.Scope.Release,
+			Namespace: img.Scope.Namespace,
+			Via:       audit.ViaDaemon,
+		})
+	}
+
+	if !d.resyncOnExpiry || !d.IsLeader() {
+		return
+	}
+
+	releases := d.expiredReleases(charts, images)
+	for _, release := range releases {
+		d.logger.Info("resyncing release after substitution expired", zap.String("release", release.Name))
+	}
+	if len(releases) > 0 {
+		d.syncReleases(TriggerExpiry, releases)
+	}
+}
+
+// expiredReleases returns the releases affected by expired substitutions:
+// releases of an expired chart, and every release in the scope of an expired
+// image since images aren't known until rendering
+func (d *Daemon) expiredReleases(charts []substitute.ChartSubstitution, images []substitute.ImageSubstitution) []helmstate.Release {
+	var releases []helmstate.Release
+	for _, release := range d.manager.GetReleases() {
+		namespace := d.executor.ReleaseNamespace(release)
+
+		affected := false
+		for _, c := range charts {
+			if c.Original == release.Chart && c.Scope.Matches(release.Name, namespace) {
+				affected = true
+			}
+		}
+		for _, img := range images {
+			if img.Scope.Matches(release.Name, namespace) {
+				affected = true
+			}
+		}
+
+		if affected {
+			releases = append(releases, release)
+		}
+	}
+	return releases
+}
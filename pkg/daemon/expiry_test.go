@@ -0,0 +1,84 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+	"go.uber.org/zap"
+)
+
+func TestExpiredReleases(t *testing.T) {
+	manager := helmstate.NewManager("", "")
+	manager.Spec = &helmstate.HelmfileSpec{Releases: []helmstate.Release{
+		{Name: "web", Chart: "bitnami/nginx", Namespace: "frontend"},
+		{Name: "my-db", Chart: "bitnami/postgresql", Namespace: "data"},
+		{Name: "other-db", Chart: "bitnami/postgresql", Namespace: "data"},
+		{Name: "cache", Chart: "bitnami/redis", Namespace: "data"},
+	}}
+
+	sub := substitute.NewManager()
+	d := &Daemon{
+		manager:     manager,
+		substitutor: sub,
+		executor:    sync.NewExecutor(zap.NewNop(), sub),
+		logger:      zap.NewNop(),
+	}
+
+	tests := []struct {
+		name     string
+		charts   []substitute.ChartSubstitution
+		images   []substitute.ImageSubstitution
+		expected []string
+	}{
+		{
+			name:     "global chart",
+			charts:   []substitute.ChartSubstitution{{Original: "bitnami/postgresql"}},
+			expected: []string{"my-db", "other-db"},
+		},
+		{
+			name:     "scoped chart",
+			charts:   []substitute.ChartSubstitution{{Original: "bitnami/postgresql", Scope: substitute.Scope{Release: "my-db"}}},
+			expected: []string{"my-db"},
+		},
+		{
+			name:     "namespaced image",
+			images:   []substitute.ImageSubstitution{{Original: "postgres:15", Scope: substitute.Scope{Namespace: "data"}}},
+			expected: []string{"my-db", "other-db", "cache"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			releases := d.expiredReleases(tt.charts, tt.images)
+			if len(releases) != len(tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, releases)
+			}
+			for i, name := range tt.expected {
+				if releases[i].Name != name {
+					t.Errorf("expected %s at %d, got %s", name, i, releases[i].Name)
+				}
+			}
+		})
+	}
+}
+
+func TestExpireSubstitutionsAt(t *testing.T) {
+	sub := substitute.NewManager()
+	sub.AddImageSubstitution("nginx:1.21", "nginx:dev")
+	sub.SetImageTTL("nginx:1.21", substitute.Scope{}, time.Minute)
+
+	d := &Daemon{substitutor: sub, logger: zap.NewNop()}
+
+	d.expireSubstitutionsAt(time.Now())
+	if len(sub.ListImageSubstitutions()) != 1 {
+		t.Fatal("expected substitution to remain before its TTL")
+	}
+
+	d.expireSubstitutionsAt(time.Now().Add(2 * time.Minute))
+	if len(sub.ListImageSubstitutions()) != 0 {
+		t.Error("expected substitution to expire after its TTL")
+	}
+}
@@ -0,0 +1,183 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/preflight"
+)
+
+const (
+	// readinessCacheTTL is how long readiness check results are reused, so
+	// frequent probes don't run helm and kubectl on every request
+	readinessCacheTTL = 10 * time.Second
+
+	// readinessCheckTimeout bounds each external readiness check
+	readinessCheckTimeout = 5 * time.Second
+)
+
+// ReadinessCheck is the result of one readiness check
+type ReadinessCheck struct {
+	Name    string `json:"name"`
+	Ready   bool   `json:"ready"`
+	Message string `json:"message,omitempty"`
+}
+
+// ReadinessResponse is returned by /readyz
+type ReadinessResponse struct {
+	Status string           `json:"status"`
+	Checks []ReadinessCheck `json:"checks"`
+}
+
+// readinessCheck is a named check; a nil error means ready
+type readinessCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// readiness runs the readiness checks, caching the result for a short time
+type readiness struct {
+	checks []readinessCheck
+
+	mu      sync.Mutex
+	checked time.Time
+	result  []ReadinessCheck
+}
+
+// syncResult is the outcome of a sync
+type syncResult struct {
+	time time.Time
+	err  error
+}
+
+// syncStatus records the outcome of the most recent sync
+type syncStatus struct {
+	mu   sync.Mutex
+	last syncResult
+	runs []SyncRun
+}
+
+// newReadiness returns the readiness checks of a daemon: the helmfile is
+// loaded, the Kubernetes API answers, helm and required plugins are
+// installed, the last sync succeeded and the cluster accepts the daemon's
+// credentials
+func (d *Daemon) newReadiness(config DaemonConfig) *readiness {
+	var plugins []string
+	if config.DriftInterval > 0 {
+		plugins = append(plugins, preflight.PluginDiff)
+	}
+
+	return &readiness{checks: []readinessCheck{
+		{name: "helmfile", check: d.checkHelmfile},
+		{name: "kubernetes", check: checkKubernetes},
+		{name: "helm", check: func(ctx context.Context) error {
+			_, err := preflight.Run(preflight.Options{HelmBinary: config.HelmBinary, RequiredPlugins: plugins})
+			return err
+		}},
+		{name: "sync", check: d.checkLastSync},
+		{name: "kube-auth", check: d.checkKubeAuth},
+	}}
+}
+
+// run returns the check results, reusing recent ones
+func (r *readiness) run(ctx context.Context, now time.Time) []ReadinessCheck {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.result != nil && now.Sub(r.checked) < readinessCacheTTL {
+		return r.result
+	}
+
+	results := make([]ReadinessCheck, len(r.checks))
+	var wg sync.WaitGroup
+	for i, c := range r.checks {
+		wg.Add(1)
+		go func(i int, c readinessCheck) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+			defer cancel()
+
+			results[i] = ReadinessCheck{Name: c.name, Ready: true}
+			if err := c.check(checkCtx); err != nil {
+				results[i].Ready = false
+				results[i].Message = err.Error()
+			}
+		}(i, c)
+	}
+	wg.Wait()
+
+	r.checked = now
+	r.result = results
+	return results
+}
+
+// checkHelmfile reports whether a helmfile is loaded
+func (d *Daemon) checkHelmfile(ctx context.Context) error {
+	if d.manager == nil || d.manager.Snapshot().Spec == nil {
+		return fmt.Errorf("helmfile not loaded")
+	}
+	return nil
+}
+
+// checkLastSync fails when the most recent sync failed
+func (d *Daemon) checkLastSync(ctx context.Context) error {
+	last := d.lastSyncResult()
+	if last.err != nil {
+		return fmt.Errorf("last sync at %s failed: %v", last.time.Format(time.RFC3339), last.err)
+	}
+	return nil
+}
+
+// checkKubernetes asks the Kubernetes API server whether it is ready
+func checkKubernetes(ctx context.Context) error {
+	out, err := exec.CommandContext(ctx, "kubectl", "get", "--raw", "/readyz").CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("kubernetes API not reachable: %s", msg)
+		}
+		return fmt.Errorf("kubernetes API not reachable: %w", err)
+	}
+	return nil
+}
+
+// lastSyncResult returns the outcome of the most recent sync
+func (d *Daemon) lastSyncResult() syncResult {
+	d.syncStatus.mu.Lock()
+	defer d.syncStatus.mu.Unlock()
+	return d.syncStatus.last
+}
+
+// handleHealthz reports that the daemon process is alive
+func (h *APIHandler) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
+}
+
+// handleReadyz reports whether the daemon can do its job, answering 503
+// with the failing checks when it can't
+func (h *APIHandler) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.methodNotAllowed(w)
+		return
+	}
+
+	resp := ReadinessResponse{Status: "ready", Checks: h.daemon.readiness.run(r.Context(), time.Now())}
+	status := http.StatusOK
+	for _, c := range resp.Checks {
+		if !c.Ready {
+			resp.Status = "not ready"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
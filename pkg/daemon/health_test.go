@@ -0,0 +1,87 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+)
+
+func TestHandleReadyz(t *testing.T) {
+	handler := newTestHandler(t)
+	handler.daemon.substitutor = substitute.NewManager()
+	handler.daemon.readiness = &readiness{checks: []readinessCheck{
+		{name: "helmfile", check: handler.daemon.checkHelmfile},
+		{name: "sync", check: handler.daemon.checkLastSync},
+	}}
+
+	readyz := func() (int, ReadinessResponse) {
+		rec := httptest.NewRecorder()
+		handler.handleReadyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var resp ReadinessResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return rec.Code, resp
+	}
+
+	if code, resp := readyz(); code != http.StatusOK || resp.Status != "ready" || len(resp.Checks) != 2 {
+		t.Fatalf("expected ready, got %d %+v", code, resp)
+	}
+
+	// A failed sync makes the daemon not ready once the cached result expires
+	handler.daemon.recordSyncRun(TriggerSource, syncReport("nginx", errors.New("upgrade failed")))
+	handler.daemon.readiness.checked = time.Time{}
+
+	code, resp := readyz()
+	if code != http.StatusServiceUnavailable || resp.Status != "not ready" {
+		t.Fatalf("expected 503 not ready, got %d %+v", code, resp)
+	}
+	if !resp.Checks[0].Ready || resp.Checks[1].Ready || resp.Checks[1].Message == "" {
+		t.Errorf("expected only the sync check to fail with a reason, got %+v", resp.Checks)
+	}
+
+	handler.daemon.recordSyncRun(TriggerSource, syncReport("nginx", nil))
+	handler.daemon.readiness.checked = time.Time{}
+	if code, _ := readyz(); code != http.StatusOK {
+		t.Errorf("expected ready after a successful sync, got %d", code)
+	}
+}
+
+func TestReadinessCachesResults(t *testing.T) {
+	calls := 0
+	r := &readiness{checks: []readinessCheck{{name: "counted", check: func(ctx context.Context) error {
+		calls++
+		return nil
+	}}}}
+
+	now := time.Now()
+	r.run(context.Background(), now)
+	r.run(context.Background(), now.Add(readinessCacheTTL/2))
+	if calls != 1 {
+		t.Errorf("expected cached result to be reused, got %d calls", calls)
+	}
+
+	r.run(context.Background(), now.Add(readinessCacheTTL))
+	if calls != 2 {
+		t.Errorf("expected checks to rerun after %s, got %d calls", readinessCacheTTL, calls)
+	}
+}
+
+func TestHealthzAlwaysHealthy(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	for _, path := range []string{"/health", "/healthz"} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d", path, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+)
+
+// Triggers of a sync run
+const (
+	TriggerSource   = "source"   // the helmfile source changed
+	TriggerExpiry   = "expiry"   // a substitution's TTL passed
+	TriggerHeal     = "heal"     // drift was healed, automatically or on approval
+	TriggerRollback = "rollback" // releases were rolled back with helmfire rollback
+	TriggerAPI      = "api"      // requested through the API, e.g. from helmfire ui
+)
+
+// maxSyncHistory bounds the number of sync runs kept
+const maxSyncHistory = 100
+
+// SyncRun is one sync of one or more releases by the daemon
+type SyncRun struct {
+	ID      int    `json:"id"`
+	Trigger string `json:"trigger"`
+	sync.Report
+
+	// Substitutions are those active during the run
+	Substitutions substitute.Snapshot `json:"substitutions"`
+}
+
+// SyncHistoryResponse lists sync runs, newest first
+type SyncHistoryResponse struct {
+	Runs []SyncRun `json:"runs"`
+}
+
+// SyncRunDiff is what changed between two sync runs
+type SyncRunDiff struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+
+	// Substitutions added and removed; a changed substitution is removed
+	// with its old target and added with the new one
+	Added   substitute.Snapshot `json:"added"`
+	Removed substitute.Snapshot `json:"removed"`
+
+	// Releases whose result changed; a status is empty when the release
+	// wasn't part of that run
+	Releases []ReleaseChange `json:"releases"`
+}
+
+// ReleaseChange is a release whose sync result differs between two runs
+type ReleaseChange struct {
+	Name      string             `json:"name"`
+	Namespace string             `json:"namespace,omitempty"`
+	From      sync.ReleaseStatus `json:"from,omitempty"`
+	To        sync.ReleaseStatus `json:"to,omitempty"`
+	Error     string             `json:"error,omitempty"`
+}
+
+// DiffSyncRuns compares the substitutions and release results of two runs
+func DiffSyncRuns(from, to SyncRun) SyncRunDiff {
+	diff := SyncRunDiff{From: from.ID, To: to.ID, Releases: []ReleaseChange{}}
+
+	fromCharts := snapshotCharts(from.Substitutions)
+	toCharts := snapshotCharts(to.Substitutions)
+	for k, c := range toCharts {
+		if old, ok := fromCharts[k]; !ok || old.Path != c.Path {
+			diff.Added.Charts = append(diff.Added.Charts, c)
+		}
+	}
+	for k, c := range fromCharts {
+		if cur, ok := toCharts[k]; !ok || cur.Path != c.Path {
+			diff.Removed.Charts = append(diff.Removed.Charts, c)
+		}
+	}
+
+	fromImages := snapshotImages(from.Substitutions)
+	toImages := snapshotImages(to.Substitutions)
+	for k, img := range toImages {
+		if old, ok := fromImages[k]; !ok || old.Replacement != img.Replacement {
+			diff.Added.Images = append(diff.Added.Images, img)
+		}
+	}
+	for k, img := range fromImages {
+		if cur, ok := toImages[k]; !ok || cur.Replacement != img.Replacement {
+			diff.Removed.Images = append(diff.Removed.Images, img)
+		}
+	}
+
+	fromResults := make(map[string]sync.ReleaseResult)
+	for _, result := range from.Results {
+		fromResults[result.Namespace+"/"+result.Name] = result
+	}
+	seen := make(map[string]bool)
+	for _, result := range to.Results {
+		k := result.Namespace + "/" + result.Name
+		seen[k] = true
+		if old, ok := fromResults[k]; !ok || old.Status != result.Status {
+			diff.Releases = append(diff.Releases, ReleaseChange{
+				Name:      result.Name,
+				Namespace: result.Namespace,
+				From:      old.Status,
+				To:        result.Status,
+				Error:     result.Error,
+			})
+		}
+	}
+	for k, result := range fromResults {
+		if !seen[k] {
+			diff.Releases = append(diff.Releases, ReleaseChange{Name: result.Name, Namespace: result.Namespace, From: result.Status})
+		}
+	}
+
+	diff.Added.Sort()
+	diff.Removed.Sort()
+	sort.Slice(diff.Releases, func(i, j int) bool {
+		a, b := diff.Releases[i], diff.Releases[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return diff
+}
+
+func snapshotCharts(s substitute.Snapshot) map[string]substitute.SnapshotChart {
+	charts := make(map[string]substitute.SnapshotChart, len(s.Charts))
+	for _, c := range s.Charts {
+		charts[c.Original+"@"+c.Scope().String()] = c
+	}
+	return charts
+}
+
+func snapshotImages(s substitute.Snapshot) map[string]substitute.SnapshotImage {
+	images := make(map[string]substitute.SnapshotImage, len(s.Images))
+	for _, img := range s.Images {
+		images[img.Original+"@"+img.Scope().String()] = img
+	}
+	return images
+}
+
+// recordSyncRun adds a finished run to the sync history and makes it the
+// last sync result
+func (d *Daemon) recordSyncRun(trigger string, report *sync.Report) SyncRun {
+	report.Finish()
+	run := SyncRun{
+		Trigger:       trigger,
+		Report:        *report,
+		Substitutions: d.substitutor.Export(),
+	}
+
+	d.syncStatus.mu.Lock()
+	d.syncStatus.runs = appendSyncRun(d.syncStatus.runs, &run)
+	d.syncStatus.last = syncResult{time: run.StartTime.Add(run.Duration), err: run.err()}
+	d.syncStatus.mu.Unlock()
+
+	d.saveState()
+	d.observeKubeResult(run.err())
+	d.publishSyncRun(run)
+	d.reportDeployStatus(run)
+	return run
+}
+
+// RecordSyncRun adds a run to the sync history in the state file of a
+// daemon that isn't running, such as a rollback done without it
+func RecordSyncRun(stateFile, trigger string, report *sync.Report, substitutions substitute.Snapshot) (SyncRun, error) {
+	run := SyncRun{Trigger: trigger, Report: *report, Substitutions: substitutions}
+
+	store := &stateStore{path: stateFile}
+	state, err := store.load()
+	if err != nil {
+		return SyncRun{}, err
+	}
+	if state == nil {
+		state = &persistedState{}
+	}
+
+	state.Version = stateVersion
+	state.SavedAt = time.Now()
+	state.SyncHistory = appendSyncRun(state.SyncHistory, &run)
+	last := run.StartTime.Add(run.Duration)
+	state.LastSync = &last
+	state.LastSyncError = ""
+	if err := run.err(); err != nil {
+		state.LastSyncError = err.Error()
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if err := store.write(*state); err != nil {
+		return SyncRun{}, fmt.Errorf("failed to record sync run: %w", err)
+	}
+	return run, nil
+}
+
+// appendSyncRun gives run the next ID and adds it to runs, dropping the
+// oldest beyond maxSyncHistory
+func appendSyncRun(runs []SyncRun, run *SyncRun) []SyncRun {
+	run.ID = 1
+	if n := len(runs); n > 0 {
+		run.ID = runs[n-1].ID + 1
+	}
+	runs = append(runs, *run)
+	if len(runs) > maxSyncHistory {
+		runs = runs[len(runs)-maxSyncHistory:]
+	}
+	return runs
+}
+
+// err summarizes the releases that failed in the run, or returns nil
+func (run SyncRun) err() error {
+	if !run.Failed() {
+		return nil
+	}
+	var failed []string
+	for _, result := range run.Results {
+		if result.Status == sync.ReleaseStatusFailed || result.Status == sync.ReleaseStatusTimedOut {
+			failed = append(failed, result.Name)
+		}
+	}
+	return fmt.Errorf("failed to sync %s", strings.Join(failed, ", "))
+}
+
+// SyncHistory returns the recorded sync runs, oldest first
+func (d *Daemon) SyncHistory() []SyncRun {
+	d.syncStatus.mu.Lock()
+	defer d.syncStatus.mu.Unlock()
+
+	runs := make([]SyncRun, len(d.syncStatus.runs))
+	copy(runs, d.syncStatus.runs)
+	return runs
+}
+
+// FindSyncRun returns the sync run with id from runs
+func FindSyncRun(runs []SyncRun, id int) (SyncRun, bool) {
+	for _, run := range runs {
+		if run.ID == id {
+			return run, true
+		}
+	}
+	return SyncRun{}, false
+}
+
+// LoadSyncHistory reads the sync runs saved in a daemon's state file, for
+// browsing them while the daemon isn't running
+func LoadSyncHistory(stateFile string) ([]SyncRun, error) {
+	state, err := (&stateStore{path: stateFile}).load()
+	if err != nil || state == nil {
+		return nil, err
+	}
+	return state.SyncHistory, nil
+}
+
+// handleSyncs lists sync runs, newest first, limited by the limit query
+// parameter (GET /api/v1/syncs)
+func (h *APIHandler) handleSyncs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.methodNotAllowed(w)
+		return
+	}
+
+	limit := 0
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		var err error
+		if limit, err = strconv.Atoi(raw); err != nil || limit < 0 {
+			h.sendError(w, "Invalid limit: must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	runs := h.daemon.SyncHistory()
+	newest := make([]SyncRun, 0, len(runs))
+	for i := len(runs) - 1; i >= 0 && (limit == 0 || len(newest) < limit); i-- {
+		newest = append(newest, runs[i])
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SyncHistoryResponse{Runs: newest})
+}
+
+// handleSyncRun returns one sync run (GET /api/v1/syncs/{id}) or the
+// difference between two (GET /api/v1/syncs/diff?from={id}&to={id})
+func (h *APIHandler) handleSyncRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.methodNotAllowed(w)
+		return
+	}
+
+	runs := h.daemon.SyncHistory()
+	name := strings.TrimPrefix(r.URL.Path, "/api/v1/syncs/")
+	if name == "diff" {
+		query := r.URL.Query()
+		from, ok := h.syncRunParam(w, runs, query.Get("from"))
+		if !ok {
+			return
+		}
+		to, ok := h.syncRunParam(w, runs, query.Get("to"))
+		if !ok {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(DiffSyncRuns(from, to))
+		return
+	}
+
+	if run, ok := h.syncRunParam(w, runs, name); ok {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(run)
+	}
+}
+
+// syncRunParam looks up the sync run a request names by ID
+func (h *APIHandler) syncRunParam(w http.ResponseWriter, runs []SyncRun, raw string) (SyncRun, bool) {
+	id, err := strconv.Atoi(raw)
+	if err != nil {
+		h.sendError(w, fmt.Sprintf("Invalid sync run ID: %q", raw), http.StatusBadRequest)
+		return SyncRun{}, false
+	}
+	run, ok := FindSyncRun(runs, id)
+	if !ok {
+		h.sendError(w, fmt.Sprintf("sync run not found: %d", id), http.StatusNotFound)
+		return SyncRun{}, false
+	}
+	return run, true
+}
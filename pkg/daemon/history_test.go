@@ -0,0 +1,169 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+)
+
+// syncReport returns a report of syncing release, failing with err
+func syncReport(release string, err error) *sync.Report {
+	report := sync.NewReport()
+	report.Record(release, "default", time.Second, err)
+	return report
+}
+
+func TestRecordSyncRun(t *testing.T) {
+	handler := newTestHandler(t)
+	d := handler.daemon
+	d.substitutor = substitute.NewManager()
+
+	d.recordSyncRun(TriggerSource, syncReport("nginx", nil))
+	d.substitutor.AddImageSubstitution("nginx:1.21", "nginx:dev")
+	d.recordSyncRun(TriggerExpiry, syncReport("nginx", errors.New("upgrade failed")))
+
+	runs := d.SyncHistory()
+	if len(runs) != 2 || runs[0].ID != 1 || runs[1].ID != 2 {
+		t.Fatalf("expected runs 1 and 2, got %+v", runs)
+	}
+	if runs[1].Trigger != TriggerExpiry || !runs[1].Failed() || len(runs[1].Substitutions.Images) != 1 {
+		t.Errorf("unexpected run %+v", runs[1])
+	}
+	if last := d.lastSyncResult(); last.err == nil || last.err.Error() != "failed to sync nginx" {
+		t.Errorf("expected the failed run to be the last sync, got %+v", last)
+	}
+
+	for i := 0; i < maxSyncHistory; i++ {
+		d.recordSyncRun(TriggerHeal, syncReport("nginx", nil))
+	}
+	if runs := d.SyncHistory(); len(runs) != maxSyncHistory || runs[len(runs)-1].ID != maxSyncHistory+2 {
+		t.Errorf("expected the newest %d runs, got %d ending at %d", maxSyncHistory, len(runs), runs[len(runs)-1].ID)
+	}
+}
+
+func TestDiffSyncRuns(t *testing.T) {
+	from := SyncRun{
+		ID: 1,
+		Report: sync.Report{Results: []sync.ReleaseResult{
+			{Name: "nginx", Namespace: "web", Status: sync.ReleaseStatusSucceeded},
+			{Name: "api", Namespace: "web", Status: sync.ReleaseStatusSucceeded},
+			{Name: "old", Namespace: "web", Status: sync.ReleaseStatusSucceeded},
+		}},
+		Substitutions: substitute.Snapshot{Images: []substitute.SnapshotImage{
+			{Original: "nginx:1.21", Replacement: "nginx:dev"},
+			{Original: "redis:7", Replacement: "redis:dev"},
+		}},
+	}
+	to := SyncRun{
+		ID: 2,
+		Report: sync.Report{Results: []sync.ReleaseResult{
+			{Name: "nginx", Namespace: "web", Status: sync.ReleaseStatusSucceeded},
+			{Name: "api", Namespace: "web", Status: sync.ReleaseStatusFailed, Error: "timeout"},
+		}},
+		Substitutions: substitute.Snapshot{Images: []substitute.SnapshotImage{
+			{Original: "nginx:1.21", Replacement: "nginx:dev2"},
+		}},
+	}
+
+	diff := DiffSyncRuns(from, to)
+	if len(diff.Added.Images) != 1 || diff.Added.Images[0].Replacement != "nginx:dev2" {
+		t.Errorf("expected the changed image as added, got %+v", diff.Added)
+	}
+	if len(diff.Removed.Images) != 2 {
+		t.Errorf("expected the old nginx and the redis substitutions as removed, got %+v", diff.Removed)
+	}
+	if len(diff.Releases) != 2 ||
+		diff.Releases[0].Name != "api" || diff.Releases[0].To != sync.ReleaseStatusFailed ||
+		diff.Releases[1].Name != "old" || diff.Releases[1].To != "" {
+		t.Errorf("expected api to fail and old to be dropped, got %+v", diff.Releases)
+	}
+}
+
+func TestHandleSyncs(t *testing.T) {
+	server, handler := newTestServer(t)
+	d := handler.daemon
+	d.recordSyncRun(TriggerSource, syncReport("nginx", nil))
+	d.recordSyncRun(TriggerHeal, syncReport("nginx", errors.New("upgrade failed")))
+
+	get := func(path string, out interface{}) int {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		json.NewDecoder(resp.Body).Decode(out)
+		return resp.StatusCode
+	}
+
+	var list SyncHistoryResponse
+	if code := get("/api/v1/syncs?limit=1", &list); code != http.StatusOK || len(list.Runs) != 1 || list.Runs[0].ID != 2 {
+		t.Errorf("expected the newest run, got %d %+v", code, list)
+	}
+
+	var run SyncRun
+	if code := get("/api/v1/syncs/1", &run); code != http.StatusOK || run.ID != 1 || run.Trigger != TriggerSource {
+		t.Errorf("expected run 1, got %d %+v", code, run)
+	}
+
+	var diff SyncRunDiff
+	if code := get("/api/v1/syncs/diff?from=1&to=2", &diff); code != http.StatusOK || len(diff.Releases) != 1 {
+		t.Errorf("expected nginx to change between runs, got %d %+v", code, diff)
+	}
+
+	var errResp ErrorResponse
+	if code := get("/api/v1/syncs/7", &errResp); code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown run, got %d", code)
+	}
+	if code := get("/api/v1/syncs/latest", &errResp); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid ID, got %d", code)
+	}
+}
+
+func TestLoadSyncHistory(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	d := newStateTestDaemon(stateFile)
+	d.recordSyncRun(TriggerSource, syncReport("nginx", nil))
+
+	runs, err := LoadSyncHistory(stateFile)
+	if err != nil || len(runs) != 1 || runs[0].Results[0].Name != "nginx" {
+		t.Errorf("expected the saved run, got %+v %v", runs, err)
+	}
+
+	if runs, err := LoadSyncHistory(filepath.Join(t.TempDir(), "missing.json")); err != nil || runs != nil {
+		t.Errorf("expected no runs without a state file, got %+v %v", runs, err)
+	}
+}
+
+func TestRecordSyncRunToStateFile(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	d := newStateTestDaemon(stateFile)
+	d.recordSyncRun(TriggerSource, syncReport("nginx", nil))
+
+	report := syncReport("nginx", errors.New("rollback failed"))
+	report.Finish()
+	run, err := RecordSyncRun(stateFile, TriggerRollback, report, substitute.Snapshot{})
+	if err != nil {
+		t.Fatalf("RecordSyncRun failed: %v", err)
+	}
+	if run.ID != 2 {
+		t.Errorf("expected run 2, got %d", run.ID)
+	}
+
+	restored := newStateTestDaemon(stateFile)
+	if err := restored.restoreState(); err != nil {
+		t.Fatalf("restoreState failed: %v", err)
+	}
+	runs := restored.SyncHistory()
+	if len(runs) != 2 || runs[1].Trigger != TriggerRollback {
+		t.Errorf("expected the rollback after the sync, got %+v", runs)
+	}
+	if last := restored.lastSyncResult(); last.err == nil {
+		t.Errorf("expected the failed rollback to be the last sync, got %+v", last)
+	}
+}
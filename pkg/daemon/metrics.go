@@ -0,0 +1,50 @@
+package daemon
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// handleMetrics serves the render cache, event sink and drift sweep metrics
+// in the Prometheus text format
+func (h *APIHandler) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.methodNotAllowed(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if h.daemon.renderCache != nil {
+		stats := h.daemon.renderCache.Stats()
+		writeMetric(w, "helmfire_render_cache_hits_total", "counter", "Chart renders served from the render cache", float64(stats.Hits))
+		writeMetric(w, "helmfire_render_cache_misses_total", "counter", "Chart renders the render cache ran helm for", float64(stats.Misses))
+		writeMetric(w, "helmfire_render_cache_entries", "gauge", "Chart renders kept in the render cache", float64(stats.Entries))
+	}
+	if f := h.daemon.forwarder; f != nil {
+		writeMetric(w, "helmfire_cloudevents_delivered_total", "counter", "Events delivered to the CloudEvents sink", float64(f.delivered.Load()))
+		writeMetric(w, "helmfire_cloudevents_failed_total", "counter", "Events the CloudEvents sink failed to accept", float64(f.failed.Load()))
+		writeMetric(w, "helmfire_cloudevents_dropped_total", "counter", "Events dropped while the CloudEvents sink fell behind", float64(f.dropped.Load()))
+	}
+	if h.daemon.detector == nil {
+		return
+	}
+	metrics := h.daemon.detector.Metrics()
+
+	writeMetric(w, "helmfire_drift_sweeps_total", "counter", "Drift sweeps completed", float64(metrics.Sweeps))
+	writeMetric(w, "helmfire_drift_sweep_seconds_total", "counter", "Time spent in drift sweeps", metrics.TotalDuration.Seconds())
+	if last := metrics.Last; last != nil {
+		writeMetric(w, "helmfire_drift_last_sweep_seconds", "gauge", "Duration of the last drift sweep", last.Duration.Seconds())
+		writeMetric(w, "helmfire_drift_last_sweep_timestamp_seconds", "gauge", "When the last drift sweep started", float64(last.Started.Unix()))
+		writeMetric(w, "helmfire_drift_last_sweep_releases", "gauge", "Releases checked by the last drift sweep", float64(last.Releases))
+		writeMetric(w, "helmfire_drift_last_sweep_drifted", "gauge", "Releases found drifted by the last drift sweep", float64(last.Drifted))
+		writeMetric(w, "helmfire_drift_last_sweep_failed", "gauge", "Releases the last drift sweep failed to check", float64(last.Failed))
+		writeMetric(w, "helmfire_drift_last_sweep_skipped", "gauge", "Diffs the last drift sweep skipped as manifests matched", float64(last.Skipped))
+		writeMetric(w, "helmfire_drift_last_sweep_workers", "gauge", "Releases diffed at once by the last drift sweep", float64(last.Workers))
+	}
+}
+
+// writeMetric writes a metric without labels in the Prometheus text format
+func writeMetric(w io.Writer, name, kind, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %g\n", name, help, name, kind, name, value)
+}
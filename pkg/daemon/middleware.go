@@ -0,0 +1,307 @@
+package daemon
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"math"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/redact"
+	"go.uber.org/zap"
+)
+
+// RequestIDHeader carries the ID of an API request; a client-supplied ID is
+// kept, otherwise one is generated
+const RequestIDHeader = "X-Request-ID"
+
+// rateLimiterIdleTimeout is how long an idle client's rate limit state is kept
+const rateLimiterIdleTimeout = 10 * time.Minute
+
+// MiddlewareConfig configures the API middleware
+type MiddlewareConfig struct {
+	// RateLimit is the sustained number of requests per second allowed per
+	// client address, with bursts of up to RateBurst; 0 disables limiting
+	RateLimit float64
+	RateBurst int
+
+	// CORSOrigins are the browser origins allowed to call the API; "*"
+	// allows any origin
+	CORSOrigins []string
+}
+
+type requestIDKey struct{}
+
+// RequestID returns the ID of the API request handled under ctx
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// withMiddleware wraps the API router with request IDs, access logging,
+// panic recovery, CORS, per-client rate limiting and token authentication,
+// outermost first
+func (h *APIHandler) withMiddleware(next http.Handler, config MiddlewareConfig) http.Handler {
+	next = h.authenticate(next)
+	if config.RateLimit > 0 {
+		next = h.rateLimit(next, newRateLimiter(config.RateLimit, config.RateBurst))
+	}
+	if len(config.CORSOrigins) > 0 {
+		next = cors(next, config.CORSOrigins)
+	}
+	next = h.redactResponses(next)
+	next = h.recoverPanics(next)
+	next = h.logRequests(next)
+	return withRequestID(next)
+}
+
+// redactingWriter masks secrets in what a handler writes
+type redactingWriter struct {
+	http.ResponseWriter
+	redactor *redact.Redactor
+}
+
+func (w *redactingWriter) Write(b []byte) (int, error) {
+	if _, err := w.ResponseWriter.Write(w.redactor.Bytes(b)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Flush lets streaming handlers flush through the writer
+func (w *redactingWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// redactResponses masks the secrets the executor resolved or was told are
+// sensitive in every response, such as in release notes or sync errors
+func (h *APIHandler) redactResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.daemon == nil || h.daemon.executor == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&redactingWriter{ResponseWriter: w, redactor: h.daemon.executor.Redactor()}, r)
+	})
+}
+
+// withRequestID assigns every request an ID, echoed in the response
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// newRequestID returns a random request ID
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Flush lets streaming handlers flush through the recorder
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// logRequests writes a structured access log entry for every request
+func (h *APIHandler) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		h.logger.Info("api request",
+			zap.String("requestId", RequestID(r.Context())),
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.Int("status", status),
+			zap.Duration("duration", time.Since(start)),
+			zap.String("remoteAddr", r.RemoteAddr))
+	})
+}
+
+// recoverPanics turns a panicking handler into a 500 response instead of a
+// dropped connection
+func (h *APIHandler) recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if p := recover(); p != nil {
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				h.logger.Error("api handler panicked",
+					zap.String("requestId", RequestID(r.Context())),
+					zap.String("path", r.URL.Path),
+					zap.Any("panic", p),
+					zap.ByteString("stack", debug.Stack()))
+				h.sendErrorCode(w, CodeInternal, "Internal server error", http.StatusInternalServerError)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// cors allows browsers on the given origins to call the API and answers
+// preflight requests
+func cors(next http.Handler, origins []string) http.Handler {
+	allowed := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		allowed[strings.TrimSuffix(origin, "/")] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || !(allowed["*"] || allowed[origin]) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := w.Header()
+		if allowed["*"] {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+			header.Add("Vary", "Origin")
+		}
+		header.Set("Access-Control-Expose-Headers", RequestIDHeader)
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			header.Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			header.Set("Access-Control-Allow-Headers", strings.Join([]string{"Authorization", "Content-Type", UserHeader, RequestIDHeader}, ", "))
+			header.Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimit rejects requests from clients over their rate limit. Health
+// checks are never limited so probes keep working under load.
+func (h *APIHandler) rateLimit(next http.Handler, limiter *rateLimiter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" || r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if wait, ok := limiter.allow(clientIP(r), time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			h.sendErrorCode(w, CodeRateLimited, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the address a request came from, without its port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rateLimiter is a token bucket per client
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// allow takes a token for client, or returns how long until one is available
+func (l *rateLimiter) allow(client string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / l.rate * float64(time.Second)), false
+	}
+	b.tokens--
+	return 0, true
+}
+
+// sweep forgets clients idle long enough for their bucket to be full again
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimiterIdleTimeout {
+		return
+	}
+	l.lastSweep = now
+	for client, b := range l.buckets {
+		if now.Sub(b.last) > rateLimiterIdleTimeout {
+			delete(l.buckets, client)
+		}
+	}
+}
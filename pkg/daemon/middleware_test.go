@@ -0,0 +1,164 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+	"go.uber.org/zap"
+)
+
+func TestMiddlewareRequestID(t *testing.T) {
+	handler := newTestHandler(t)
+	var seen string
+	h := handler.withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestID(r.Context())
+	}), MiddlewareConfig{})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if seen == "" || rec.Header().Get(RequestIDHeader) != seen {
+		t.Errorf("expected generated request ID %q to be echoed, got %q", seen, rec.Header().Get(RequestIDHeader))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set(RequestIDHeader, "abc123")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if seen != "abc123" || rec.Header().Get(RequestIDHeader) != "abc123" {
+		t.Errorf("expected client request ID to be kept, got %q", seen)
+	}
+}
+
+func TestMiddlewareRecoversPanics(t *testing.T) {
+	handler := newTestHandler(t)
+	h := handler.withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}), MiddlewareConfig{})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/status", nil))
+
+	var resp ErrorResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if rec.Code != http.StatusInternalServerError || resp.Code != CodeInternal {
+		t.Errorf("expected 500 %s, got %d %+v", CodeInternal, rec.Code, resp)
+	}
+}
+
+func TestMiddlewareCORS(t *testing.T) {
+	handler := newTestHandler(t)
+	h := handler.withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		MiddlewareConfig{CORSOrigins: []string{"http://localhost:3000/"}})
+
+	tests := []struct {
+		name        string
+		method      string
+		origin      string
+		wantStatus  int
+		wantAllowed string
+	}{
+		{name: "allowed origin", method: http.MethodGet, origin: "http://localhost:3000", wantStatus: http.StatusOK, wantAllowed: "http://localhost:3000"},
+		{name: "preflight", method: http.MethodOptions, origin: "http://localhost:3000", wantStatus: http.StatusNoContent, wantAllowed: "http://localhost:3000"},
+		{name: "other origin", method: http.MethodGet, origin: "http://evil.example", wantStatus: http.StatusOK},
+		{name: "no origin", method: http.MethodGet, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/charts", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.method == http.MethodOptions {
+				req.Header.Set("Access-Control-Request-Method", http.MethodDelete)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantAllowed {
+				t.Errorf("expected allowed origin %q, got %q", tt.wantAllowed, got)
+			}
+		})
+	}
+}
+
+func TestMiddlewareRateLimit(t *testing.T) {
+	handler := newTestHandler(t)
+	h := handler.withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		MiddlewareConfig{RateLimit: 1, RateBurst: 2})
+
+	request := func(path, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := request("/api/v1/status", "10.0.0.1:1234"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200 within burst, got %d", i+1, rec.Code)
+		}
+	}
+
+	rec := request("/api/v1/status", "10.0.0.1:5678")
+	var resp ErrorResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if rec.Code != http.StatusTooManyRequests || resp.Code != CodeRateLimited || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected 429 %s with Retry-After, got %d %+v %q", CodeRateLimited, rec.Code, resp, rec.Header().Get("Retry-After"))
+	}
+
+	if rec := request("/api/v1/status", "10.0.0.2:1234"); rec.Code != http.StatusOK {
+		t.Errorf("expected other clients not to be limited, got %d", rec.Code)
+	}
+	if rec := request("/health", "10.0.0.1:1234"); rec.Code != http.StatusOK {
+		t.Errorf("expected health checks not to be limited, got %d", rec.Code)
+	}
+}
+
+func TestRateLimiterRefills(t *testing.T) {
+	limiter := newRateLimiter(2, 1)
+	now := time.Now()
+
+	if _, ok := limiter.allow("a", now); !ok {
+		t.Fatal("expected first request to be allowed")
+	}
+	wait, ok := limiter.allow("a", now)
+	if ok || wait != 500*time.Millisecond {
+		t.Fatalf("expected to wait 500ms, got %s (allowed %v)", wait, ok)
+	}
+	if _, ok := limiter.allow("a", now.Add(500*time.Millisecond)); !ok {
+		t.Error("expected a token after 500ms")
+	}
+
+	limiter.allow("b", now)
+	limiter.allow("a", now.Add(rateLimiterIdleTimeout+time.Second))
+	if _, ok := limiter.buckets["b"]; ok {
+		t.Error("expected idle client to be swept")
+	}
+}
+
+func TestMiddlewareRedactsResponses(t *testing.T) {
+	handler := newTestHandler(t)
+	handler.daemon.executor = sync.NewExecutor(zap.NewNop(), substitute.NewManager())
+	handler.daemon.executor.Redactor().Add("hunter2")
+
+	h := handler.withMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"notes": "admin password: hunter2"})
+	}), MiddlewareConfig{})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/releases", nil))
+	if body := rec.Body.String(); strings.Contains(body, "hunter2") || !strings.Contains(body, "[redacted]") {
+		t.Errorf("expected the secret masked, got %s", body)
+	}
+}
@@ -0,0 +1,164 @@
+package daemon
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// EnvStateHome overrides where per-user state is kept, following the XDG
+// base directory spec
+const EnvStateHome = "XDG_STATE_HOME"
+
+// Paths are the files of one project's daemon
+type Paths struct {
+	Dir          string
+	PIDFile      string
+	LogFile      string
+	AuditLogFile string
+	StateFile    string
+}
+
+// LegacyPaths are the shared /tmp files used before daemons got
+// per-project state directories. They have no state file, so daemons using
+// them don't persist state.
+var LegacyPaths = Paths{
+	Dir:          "/tmp",
+	PIDFile:      "/tmp/helmfire.pid",
+	LogFile:      "/tmp/helmfire.log",
+	AuditLogFile: "/tmp/helmfire-audit.log",
+}
+
+// StateDir returns the directory holding helmfire's per-user state:
+// $XDG_STATE_HOME/helmfire, or ~/.local/state/helmfire
+func StateDir() (string, error) {
+	if dir := os.Getenv(EnvStateHome); dir != "" {
+		return filepath.Join(dir, "helmfire"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state", "helmfire"), nil
+}
+
+// ProjectName names the state directory of the project in dir: its base name
+// and a short hash of its absolute path, so projects with the same name
+// don't collide
+func ProjectName(dir string) string {
+	sum := sha256.Sum256([]byte(dir))
+	return filepath.Base(dir) + "-" + hex.EncodeToString(sum[:])[:8]
+}
+
+// ProjectPaths returns the daemon files of the project in dir
+func ProjectPaths(dir string) (Paths, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return Paths{}, err
+	}
+	state, err := StateDir()
+	if err != nil {
+		return Paths{}, err
+	}
+
+	projectDir := filepath.Join(state, ProjectName(dir))
+	return Paths{
+		Dir:          projectDir,
+		PIDFile:      filepath.Join(projectDir, "daemon.pid"),
+		LogFile:      filepath.Join(projectDir, "daemon.log"),
+		AuditLogFile: filepath.Join(projectDir, "audit.log"),
+		StateFile:    filepath.Join(projectDir, "state.json"),
+	}, nil
+}
+
+// DefaultPaths returns the daemon files of the project in the working
+// directory, or LegacyPaths when it has no state directory
+func DefaultPaths() Paths {
+	dir, err := os.Getwd()
+	if err != nil {
+		return LegacyPaths
+	}
+	paths, err := ProjectPaths(dir)
+	if err != nil {
+		return LegacyPaths
+	}
+	return paths
+}
+
+// MigrateLegacyFiles moves the PID and log files of a daemon started with
+// the old /tmp defaults into paths when it is still running and belongs to
+// project, so it can be found and stopped. It reports whether anything moved.
+func MigrateLegacyFiles(paths Paths, project string) (bool, error) {
+	return migrateFiles(LegacyPaths, paths, project)
+}
+
+func migrateFiles(from, to Paths, project string) (bool, error) {
+	if from.PIDFile == to.PIDFile || fileExists(to.PIDFile) {
+		return false, nil
+	}
+
+	info, err := readPIDFile(from.PIDFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if staleReason(info) != "" {
+		return false, nil
+	}
+	pidProject := info.Project
+	if pidProject == "" {
+		pidProject, _ = processDir(info.PID)
+	}
+	if pidProject == "" || pidProject != project {
+		return false, nil
+	}
+
+	if err := os.MkdirAll(to.Dir, 0700); err != nil {
+		return false, err
+	}
+	if err := moveFile(from.PIDFile, to.PIDFile); err != nil {
+		return false, fmt.Errorf("failed to migrate %s: %w", from.PIDFile, err)
+	}
+	// The daemon may still be writing its log, so only move it when a rename
+	// keeps the open file
+	if fileExists(from.LogFile) && !fileExists(to.LogFile) {
+		os.Rename(from.LogFile, to.LogFile)
+	}
+	return true, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// moveFile renames a file, copying it when it crosses filesystems
+func moveFile(from, to string) error {
+	if err := os.Rename(from, to); err == nil {
+		return nil
+	}
+
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(from)
+}
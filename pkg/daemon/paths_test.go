@@ -0,0 +1,99 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProjectPaths(t *testing.T) {
+	state := t.TempDir()
+	t.Setenv(EnvStateHome, state)
+
+	paths, err := ProjectPaths("/home/dev/shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(paths.Dir, filepath.Join(state, "helmfire", "shop-")) {
+		t.Errorf("expected project dir under the state home, got %s", paths.Dir)
+	}
+	if paths.PIDFile != filepath.Join(paths.Dir, "daemon.pid") || paths.AuditLogFile != filepath.Join(paths.Dir, "audit.log") {
+		t.Errorf("unexpected paths %+v", paths)
+	}
+
+	other, err := ProjectPaths("/home/other/shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Dir == paths.Dir {
+		t.Error("expected projects with the same name in different directories not to collide")
+	}
+}
+
+func TestIsDaemonRunningChecksProject(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir, ok := processDir(os.Getpid()); !ok || dir != cwd {
+		t.Skip("process working directories are not available on this platform")
+	}
+
+	pidFile := filepath.Join(t.TempDir(), "daemon.pid")
+	os.WriteFile(pidFile, []byte(fmt.Sprintf("%d\n%s\n", os.Getpid(), cwd)), 0644)
+	if running, err := IsDaemonRunning(pidFile); err != nil || !running {
+		t.Errorf("expected daemon of this project to be running, got %v %v", running, err)
+	}
+
+	os.WriteFile(pidFile, []byte(fmt.Sprintf("%d\n/some/other/project\n", os.Getpid())), 0644)
+	if running, _ := IsDaemonRunning(pidFile); running {
+		t.Error("expected a reused PID working in another project not to count as running")
+	}
+}
+
+func TestMigrateFiles(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	legacyDir := t.TempDir()
+	legacy := Paths{
+		Dir:     legacyDir,
+		PIDFile: filepath.Join(legacyDir, "helmfire.pid"),
+		LogFile: filepath.Join(legacyDir, "helmfire.log"),
+	}
+	projectDir := filepath.Join(t.TempDir(), "project")
+	paths := Paths{
+		Dir:     projectDir,
+		PIDFile: filepath.Join(projectDir, "daemon.pid"),
+		LogFile: filepath.Join(projectDir, "daemon.log"),
+	}
+
+	os.WriteFile(legacy.PIDFile, []byte(fmt.Sprintf("%d\n%s\n", os.Getpid(), cwd)), 0644)
+	os.WriteFile(legacy.LogFile, []byte("started\n"), 0644)
+
+	if migrated, err := migrateFiles(legacy, paths, "/some/other/project"); err != nil || migrated {
+		t.Fatalf("expected another project's daemon not to be migrated, got %v %v", migrated, err)
+	}
+
+	migrated, err := migrateFiles(legacy, paths, cwd)
+	if err != nil || !migrated {
+		t.Fatalf("expected running daemon to be migrated, got %v %v", migrated, err)
+	}
+	if fileExists(legacy.PIDFile) || !fileExists(paths.PIDFile) || !fileExists(paths.LogFile) {
+		t.Error("expected PID and log files to move to the project directory")
+	}
+	if info, err := readPIDFile(paths.PIDFile); err != nil || info.PID != os.Getpid() {
+		t.Errorf("expected migrated PID file to keep the PID, got %d %v", info.PID, err)
+	}
+
+	// Stale legacy files of stopped daemons are left alone
+	os.Remove(paths.PIDFile)
+	os.WriteFile(legacy.PIDFile, []byte("999999999\n"), 0644)
+	if migrated, _ := migrateFiles(legacy, paths, cwd); migrated {
+		t.Error("expected a stopped daemon not to be migrated")
+	}
+}
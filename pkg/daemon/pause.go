@@ -0,0 +1,187 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// EventPause is published when the daemon's automation is paused or resumed
+const EventPause = "pause"
+
+// PauseStatus describes whether the daemon's automation is paused
+type PauseStatus struct {
+	Paused bool       `json:"paused"`
+	Since  *time.Time `json:"since,omitempty"`
+	Until  *time.Time `json:"until,omitempty"` // unset when paused until resumed
+	Reason string     `json:"reason,omitempty"`
+}
+
+// pause suspends source syncs, substitution expiry and drift checks and
+// healing, resuming by itself when until passes
+type pause struct {
+	mu     sync.Mutex
+	status PauseStatus
+	timer  *time.Timer
+}
+
+// Pause suspends syncs triggered by helmfile source changes, substitution
+// expiry and drift checks and healing, for duration or, when zero, until
+// Resume. Syncs, checks and heals asked for through the API still run.
+// Changes and expiries that happen meanwhile are picked up on resume.
+func (d *Daemon) Pause(duration time.Duration, reason string) PauseStatus {
+	now := time.Now()
+	var until time.Time
+	if duration > 0 {
+		until = now.Add(duration)
+	}
+	status := d.setPause(now, until, reason)
+	d.saveState()
+
+	d.logger.Warn("automation paused",
+		zap.Time("until", until),
+		zap.String("reason", reason))
+	message := "automation paused until resumed"
+	if !until.IsZero() {
+		message = fmt.Sprintf("automation paused until %s", until.Format(time.RFC3339))
+	}
+	if reason != "" {
+		message += ": " + reason
+	}
+	d.events.publish(Event{Type: EventPause, Message: message})
+	return status
+}
+
+// setPause pauses the daemon from since until until, or until resumed when
+// until is zero
+func (d *Daemon) setPause(since, until time.Time, reason string) PauseStatus {
+	d.pause.mu.Lock()
+	defer d.pause.mu.Unlock()
+
+	if d.pause.timer != nil {
+		d.pause.timer.Stop()
+		d.pause.timer = nil
+	}
+	d.pause.status = PauseStatus{Paused: true, Since: &since, Reason: reason}
+	if !until.IsZero() {
+		d.pause.status.Until = &until
+		d.pause.timer = time.AfterFunc(time.Until(until), func() { d.resumeAt(until) })
+	}
+	if d.detector != nil {
+		d.detector.SetPaused(true)
+	}
+	return d.pause.status
+}
+
+// resumeAt resumes the daemon when it is still paused until until
+func (d *Daemon) resumeAt(until time.Time) {
+	d.pause.mu.Lock()
+	due := d.pause.status.Until != nil && d.pause.status.Until.Equal(until)
+	d.pause.mu.Unlock()
+	if due {
+		d.Resume()
+	}
+}
+
+// Resume ends a pause, returning false when the daemon wasn't paused
+func (d *Daemon) Resume() bool {
+	d.pause.mu.Lock()
+	if !d.pause.status.Paused {
+		d.pause.mu.Unlock()
+		return false
+	}
+	if d.pause.timer != nil {
+		d.pause.timer.Stop()
+		d.pause.timer = nil
+	}
+	d.pause.status = PauseStatus{}
+	if d.detector != nil {
+		d.detector.SetPaused(false)
+	}
+	d.pause.mu.Unlock()
+	d.saveState()
+
+	d.logger.Info("automation resumed")
+	d.events.publish(Event{Type: EventPause, Ready: true, Message: "automation resumed"})
+	return true
+}
+
+// PauseStatus returns whether the daemon's automation is paused
+func (d *Daemon) PauseStatus() PauseStatus {
+	d.pause.mu.Lock()
+	defer d.pause.mu.Unlock()
+	return d.pause.status
+}
+
+// paused reports whether the daemon's automation is paused
+func (d *Daemon) paused() bool {
+	return d.PauseStatus().Paused
+}
+
+// restorePause pauses the daemon as saved in status, unless the pause
+// ended while it was stopped
+func (d *Daemon) restorePause(status *PauseStatus) {
+	if status == nil || !status.Paused {
+		return
+	}
+	var until time.Time
+	if status.Until != nil {
+		if !status.Until.After(time.Now()) {
+			return
+		}
+		until = *status.Until
+	}
+	since := time.Now()
+	if status.Since != nil {
+		since = *status.Since
+	}
+	d.setPause(since, until, status.Reason)
+}
+
+// handlePause pauses the daemon's automation (POST) or returns whether it
+// is paused (GET)
+func (h *APIHandler) handlePause(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req PauseRequest
+		if r.ContentLength != 0 {
+			if err := decodeRequest(r, &req); err != nil {
+				h.sendError(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+		if err := req.Validate(); err != nil {
+			h.sendValidationError(w, err)
+			return
+		}
+		duration, _ := parseTTL(req.Duration)
+		h.logger.Info("pause requested via API", zap.String("duration", req.Duration))
+		h.daemon.Pause(duration, req.Reason)
+	default:
+		h.methodNotAllowed(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.daemon.PauseStatus())
+}
+
+// handleResume resumes the daemon's automation; resuming a daemon that
+// isn't paused does nothing
+func (h *APIHandler) handleResume(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.methodNotAllowed(w)
+		return
+	}
+
+	h.logger.Info("resume requested via API")
+	h.daemon.Resume()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.daemon.PauseStatus())
+}
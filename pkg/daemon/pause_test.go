@@ -0,0 +1,102 @@
+package daemon
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPauseResumesAfterDuration(t *testing.T) {
+	d := newStateTestDaemon(filepath.Join(t.TempDir(), "state.json"))
+
+	status := d.Pause(20*time.Millisecond, "failover")
+	if !status.Paused || status.Until == nil || status.Reason != "failover" {
+		t.Fatalf("expected a timed pause, got %+v", status)
+	}
+	if !d.detector.Paused() {
+		t.Error("expected drift detection to be paused")
+	}
+	if d.GetStatus().Pause == nil {
+		t.Error("expected the status to report the pause")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for d.paused() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if d.paused() || d.detector.Paused() {
+		t.Error("expected the pause to end by itself")
+	}
+	if d.Resume() {
+		t.Error("expected resuming a running daemon to do nothing")
+	}
+}
+
+func TestPauseSurvivesRestart(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+
+	d := newStateTestDaemon(stateFile)
+	d.Pause(0, "manual surgery")
+
+	restarted := newStateTestDaemon(stateFile)
+	if err := restarted.restoreState(); err != nil {
+		t.Fatal(err)
+	}
+	status := restarted.PauseStatus()
+	if !status.Paused || status.Until != nil || status.Reason != "manual surgery" {
+		t.Errorf("expected the pause to be restored, got %+v", status)
+	}
+	if !restarted.detector.Paused() {
+		t.Error("expected restored drift detection to be paused")
+	}
+
+	// A pause that ended while the daemon was stopped isn't restored
+	ended := time.Now().Add(-time.Minute)
+	other := newStateTestDaemon(stateFile)
+	other.restorePause(&PauseStatus{Paused: true, Until: &ended})
+	if other.paused() {
+		t.Error("expected an ended pause not to be restored")
+	}
+}
+
+func TestHandlePause(t *testing.T) {
+	handler := newTestHandler(t)
+
+	rec := httptest.NewRecorder()
+	handler.handlePause(rec, httptest.NewRequest(http.MethodPost, "/api/v1/pause", bytes.NewBufferString(`{"duration": "1h", "reason": "incident"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var status PauseStatus
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !status.Paused || status.Until == nil || time.Until(*status.Until) < 59*time.Minute {
+		t.Errorf("expected a pause of an hour, got %+v", status)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.handlePause(rec, httptest.NewRequest(http.MethodPost, "/api/v1/pause", bytes.NewBufferString(`{"duration": "soon"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid duration, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.handleResume(rec, httptest.NewRequest(http.MethodPost, "/api/v1/resume", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if handler.daemon.paused() {
+		t.Error("expected the daemon to be resumed")
+	}
+
+	rec = httptest.NewRecorder()
+	handler.handleResume(rec, httptest.NewRequest(http.MethodGet, "/api/v1/resume", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", rec.Code)
+	}
+}
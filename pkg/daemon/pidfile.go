@@ -0,0 +1,207 @@
+package daemon
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pidInfo is the content of a PID file. Besides the PID it records enough
+// about the daemon process to tell it apart from an unrelated process that
+// was given the same PID after the daemon died.
+type pidInfo struct {
+	PID     int    `json:"pid"`
+	Project string `json:"project,omitempty"`
+
+	// StartTime is when the daemon started, for display
+	StartTime time.Time `json:"startTime"`
+
+	// ProcessStart is the start time of the process as reported by the OS,
+	// in a platform specific format only compared for equality
+	ProcessStart string `json:"processStart,omitempty"`
+
+	// BinaryHash is the sha256 of the daemon's executable
+	BinaryHash string `json:"binaryHash,omitempty"`
+
+	// Command starts the daemon again on restart: the executable and the
+	// arguments it was started with. The new daemon's output is appended to
+	// LogFile, unless it is Supervised and its supervisor writes the log.
+	Command    []string `json:"command,omitempty"`
+	LogFile    string   `json:"logFile,omitempty"`
+	Supervised bool     `json:"supervised,omitempty"`
+}
+
+// currentPIDInfo describes the running process
+func currentPIDInfo() (pidInfo, error) {
+	project, err := os.Getwd()
+	if err != nil {
+		return pidInfo{}, err
+	}
+
+	info := pidInfo{
+		PID:       os.Getpid(),
+		Project:   project,
+		StartTime: time.Now(),
+	}
+	info.ProcessStart, _ = processStartTime(info.PID)
+	if executable, err := os.Executable(); err == nil {
+		info.BinaryHash, _ = fileHash(executable)
+	}
+	return info, nil
+}
+
+// writePIDFile writes info to path, replacing the file atomically so readers
+// never see it half written
+func writePIDFile(path string, info pidInfo) error {
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// readPIDFile reads a PID file. Besides the JSON written by current daemons
+// it accepts the older plain PID, optionally followed by the project
+// directory on a second line.
+func readPIDFile(path string) (pidInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return pidInfo{}, err
+	}
+	return parsePIDFile(data)
+}
+
+func parsePIDFile(data []byte) (pidInfo, error) {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("{")) {
+		var info pidInfo
+		if err := json.Unmarshal(data, &info); err != nil {
+			return pidInfo{}, fmt.Errorf("invalid PID file: %w", err)
+		}
+		if info.PID <= 0 {
+			return pidInfo{}, fmt.Errorf("invalid PID in file: %d", info.PID)
+		}
+		return info, nil
+	}
+
+	lines := strings.SplitN(string(data), "\n", 2)
+	pid, err := strconv.Atoi(strings.TrimSpace(lines[0]))
+	if err != nil {
+		return pidInfo{}, fmt.Errorf("invalid PID in file: %s", lines[0])
+	}
+
+	info := pidInfo{PID: pid}
+	if len(lines) == 2 {
+		info.Project = strings.TrimSpace(lines[1])
+	}
+	return info, nil
+}
+
+// staleReason explains why the process in info is not the daemon that wrote
+// the PID file, or returns "" when it is. Each recorded detail the platform
+// can check must match; older PID files record fewer of them.
+func staleReason(info pidInfo) string {
+	if !processRunning(info.PID) {
+		return fmt.Sprintf("process %d is not running", info.PID)
+	}
+	if info.Project != "" {
+		if dir, ok := processDir(info.PID); ok && dir != info.Project {
+			return fmt.Sprintf("process %d runs in %s, not %s", info.PID, dir, info.Project)
+		}
+	}
+	if info.ProcessStart != "" {
+		if start, ok := processStartTime(info.PID); ok && start != info.ProcessStart {
+			return fmt.Sprintf("process %d started at a different time than the daemon", info.PID)
+		}
+	}
+	if info.BinaryHash != "" {
+		if hash, ok := processBinaryHash(info.PID); ok && hash != info.BinaryHash {
+			return fmt.Sprintf("process %d runs a different binary", info.PID)
+		}
+	}
+	return ""
+}
+
+// CleanStalePIDFile removes a PID file left behind by a daemon that is no
+// longer running, such as after a crash, and returns why it was stale. It
+// returns "" when there is no PID file or its daemon is running.
+func CleanStalePIDFile(pidFile string) (string, error) {
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	reason := "unreadable PID file"
+	if info, err := parsePIDFile(data); err == nil {
+		if reason = staleReason(info); reason == "" {
+			return "", nil
+		}
+	}
+
+	// A daemon starting meanwhile replaces the file; leave its PID alone
+	if current, err := os.ReadFile(pidFile); err != nil || !bytes.Equal(current, data) {
+		return "", nil
+	}
+	if err := os.Remove(pidFile); err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to remove stale PID file: %w", err)
+	}
+	return reason, nil
+}
+
+// processDir returns the working directory of a process, where the
+// platform exposes it
+func processDir(pid int) (string, bool) {
+	dir, err := os.Readlink(filepath.Join("/proc", strconv.Itoa(pid), "cwd"))
+	if err != nil {
+		return "", false
+	}
+	return dir, true
+}
+
+// processBinaryHash returns the sha256 of a process's executable, where the
+// platform exposes it. It reads the image the process runs, so replacing the
+// binary on disk, as an upgrade does, doesn't change the hash.
+func processBinaryHash(pid int) (string, bool) {
+	hash, err := fileHash(filepath.Join("/proc", strconv.Itoa(pid), "exe"))
+	if err != nil {
+		return "", false
+	}
+	return hash, true
+}
+
+func fileHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,120 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParsePIDFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    pidInfo
+		wantErr bool
+	}{
+		{name: "legacy", content: "123\n", want: pidInfo{PID: 123}},
+		{name: "with project", content: "123\n/home/dev/shop\n", want: pidInfo{PID: 123, Project: "/home/dev/shop"}},
+		{
+			name:    "json",
+			content: `{"pid": 123, "project": "/home/dev/shop", "processStart": "4711", "binaryHash": "abc"}`,
+			want:    pidInfo{PID: 123, Project: "/home/dev/shop", ProcessStart: "4711", BinaryHash: "abc"},
+		},
+		{name: "invalid", content: "abc\n", wantErr: true},
+		{name: "json without pid", content: `{"project": "/home/dev/shop"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePIDFile([]byte(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWritePIDFileRoundTrip(t *testing.T) {
+	info, err := currentPIDInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "state", "daemon.pid")
+	if err := writePIDFile(path, info); err != nil {
+		t.Fatal(err)
+	}
+	read, err := readPIDFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.PID != info.PID || read.ProcessStart != info.ProcessStart || read.BinaryHash != info.BinaryHash || !read.StartTime.Equal(info.StartTime) {
+		t.Errorf("got %+v, want %+v", read, info)
+	}
+	if reason := staleReason(read); reason != "" {
+		t.Errorf("expected this process to match its own PID file, got %q", reason)
+	}
+}
+
+func TestStaleReason(t *testing.T) {
+	info, err := currentPIDInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dead := info
+	dead.PID = 999999999
+	if staleReason(dead) == "" {
+		t.Error("expected a PID that isn't running to be stale")
+	}
+
+	if info.ProcessStart != "" {
+		restarted := info
+		restarted.ProcessStart = "0"
+		if staleReason(restarted) == "" {
+			t.Error("expected a process started at another time to be stale")
+		}
+	}
+
+	if _, ok := processBinaryHash(info.PID); ok {
+		other := info
+		other.BinaryHash = "0000"
+		if staleReason(other) == "" {
+			t.Error("expected a process running another binary to be stale")
+		}
+	}
+}
+
+func TestCleanStalePIDFile(t *testing.T) {
+	dir := t.TempDir()
+
+	if reason, err := CleanStalePIDFile(filepath.Join(dir, "missing.pid")); err != nil || reason != "" {
+		t.Errorf("expected nothing to clean without a PID file, got %q %v", reason, err)
+	}
+
+	info, err := currentPIDInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	live := filepath.Join(dir, "live.pid")
+	writePIDFile(live, info)
+	if reason, err := CleanStalePIDFile(live); err != nil || reason != "" || !fileExists(live) {
+		t.Errorf("expected a running daemon's PID file to be kept, got %q %v", reason, err)
+	}
+
+	for name, content := range map[string]string{"dead.pid": "999999999\n", "garbage.pid": "not a pid\n"} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(content), 0644)
+		reason, err := CleanStalePIDFile(path)
+		if err != nil || reason == "" {
+			t.Errorf("%s: expected stale PID file to be removed with a reason, got %q %v", name, reason, err)
+		}
+		if fileExists(path) {
+			t.Errorf("%s: expected stale PID file to be removed", name)
+		}
+	}
+}
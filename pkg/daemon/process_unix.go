@@ -0,0 +1,64 @@
+//go:build !windows
+
+package daemon
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// shutdownSignals stop the daemon gracefully
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// reloadSignals make the daemon reload its configuration
+var reloadSignals = []os.Signal{syscall.SIGHUP}
+
+// processRunning reports whether a process with pid exists
+func processRunning(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	// Send signal 0 to check if process is running
+	return process.Signal(syscall.Signal(0)) == nil
+}
+
+// terminateProcess asks a process to exit gracefully
+func terminateProcess(process *os.Process) error {
+	return process.Signal(syscall.SIGTERM)
+}
+
+// detachProcess starts cmd in a session of its own, so it outlives the
+// terminal that restarted it
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// processStartTime returns when a process started: the start time in clock
+// ticks after boot from /proc on Linux, or ps's lstart elsewhere
+func processStartTime(pid int) (string, bool) {
+	if data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat")); err == nil {
+		// The command name in parentheses may contain spaces, so count the
+		// fields after it; starttime is the 22nd field overall
+		stat := string(data)
+		fields := strings.Fields(stat[strings.LastIndexByte(stat, ')')+1:])
+		if len(fields) < 20 {
+			return "", false
+		}
+		return fields[19], true
+	}
+
+	cmd := exec.Command("ps", "-o", "lstart=", "-p", strconv.Itoa(pid))
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	out, err := cmd.Output()
+	if err != nil {
+		return "", false
+	}
+	start := strings.TrimSpace(string(out))
+	return start, start != ""
+}
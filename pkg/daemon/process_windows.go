@@ -0,0 +1,66 @@
+//go:build windows
+
+package daemon
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// stillActive is the exit code GetExitCodeProcess reports for a running process
+const stillActive = 259
+
+// detachedProcess starts a process without a console
+const detachedProcess = 0x00000008
+
+// shutdownSignals stop the daemon gracefully; Windows only delivers Ctrl+C
+var shutdownSignals = []os.Signal{os.Interrupt}
+
+// reloadSignals make the daemon reload its configuration; Windows has none,
+// so it reloads through the API only
+var reloadSignals []os.Signal
+
+// processRunning reports whether a process with pid exists
+func processRunning(pid int) bool {
+	handle, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(handle)
+
+	var code uint32
+	if err := syscall.GetExitCodeProcess(handle, &code); err != nil {
+		return false
+	}
+	return code == stillActive
+}
+
+// terminateProcess stops a process. Windows can't signal other processes,
+// so this is a hard kill; StopDaemon asks the daemon's API to shut down first.
+func terminateProcess(process *os.Process) error {
+	return process.Kill()
+}
+
+// detachProcess starts cmd without a console and outside the process group
+// of the terminal that restarted it
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP | detachedProcess}
+}
+
+// processStartTime returns when a process was created, in 100ns intervals
+// since 1601
+func processStartTime(pid int) (string, bool) {
+	handle, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return "", false
+	}
+	defer syscall.CloseHandle(handle)
+
+	var creation, exit, kernel, user syscall.Filetime
+	if err := syscall.GetProcessTimes(handle, &creation, &exit, &kernel, &user); err != nil {
+		return "", false
+	}
+	return strconv.FormatUint(uint64(creation.HighDateTime)<<32|uint64(creation.LowDateTime), 10), true
+}
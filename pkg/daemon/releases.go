@@ -0,0 +1,265 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/drift"
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+	"go.uber.org/zap"
+)
+
+// ReleaseState is a release of the helmfile with its last sync result and
+// the drift found since
+type ReleaseState struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	Chart     string `json:"chart"`
+	Version   string `json:"version,omitempty"`
+	Installed bool   `json:"installed"`
+
+	// LastSync is the release's result in the latest sync run including it
+	LastSync     *sync.ReleaseResult `json:"lastSync,omitempty"`
+	LastSyncTime time.Time           `json:"lastSyncTime,omitempty"`
+
+	// Drift is the latest unhealed drift report of the release newer than
+	// its last sync
+	Drift *drift.DriftReport `json:"drift,omitempty"`
+
+	// Values are the temporary --set values overlaid on the release through
+	// the API
+	Values map[string]string `json:"values,omitempty"`
+}
+
+// ReleasesResponse lists the releases of the helmfile
+type ReleasesResponse struct {
+	Releases []ReleaseState `json:"releases"`
+}
+
+// SyncResponse is the result of a sync requested through the API: the run
+// recorded in the sync history, or for a dry run the changes per release
+type SyncResponse struct {
+	Run     *SyncRun          `json:"run,omitempty"`
+	Changes map[string]string `json:"changes,omitempty"`
+}
+
+// releaseStates returns the releases of the helmfile with their state
+func (d *Daemon) releaseStates() []ReleaseState {
+	runs := d.SyncHistory()
+
+	var reports []drift.DriftReport
+	if detector := d.GetDetector(); detector != nil {
+		reports = append(detector.Reports(), detector.PendingReports()...)
+	}
+
+	releases := d.manager.GetReleases()
+	states := make([]ReleaseState, 0, len(releases))
+	for _, release := range releases {
+		state := ReleaseState{
+			Name:      release.Name,
+			Namespace: d.executor.ReleaseNamespace(release),
+			Chart:     release.Chart,
+			Version:   release.Version,
+			Installed: d.manager.IsReleaseInstalled(release),
+			Values:    d.manager.Overlay(release.Name),
+		}
+
+		for i := len(runs) - 1; i >= 0 && state.LastSync == nil; i-- {
+			for _, result := range runs[i].Results {
+				if result.Name == release.Name {
+					result := result
+					state.LastSync = &result
+					state.LastSyncTime = runs[i].StartTime
+					break
+				}
+			}
+		}
+
+		for _, report := range reports {
+			if report.ReleaseName != release.Name || report.Healed || report.DriftType == drift.DriftTypeOrphan {
+				continue
+			}
+			if report.DriftType == drift.DriftTypeResolved {
+				if state.Drift != nil && report.Timestamp.After(state.Drift.Timestamp) {
+					state.Drift = nil
+				}
+				continue
+			}
+			if report.Timestamp.After(state.LastSyncTime) && (state.Drift == nil || report.Timestamp.After(state.Drift.Timestamp)) {
+				report := report
+				state.Drift = &report
+			}
+		}
+		states = append(states, state)
+	}
+	return states
+}
+
+// previewReleases returns the changes syncing releases would apply
+func (d *Daemon) previewReleases(releases []helmstate.Release) (map[string]string, error) {
+	changes := make(map[string]string, len(releases))
+	for _, release := range releases {
+		preview, err := d.executor.PreviewReleaseContext(d.ctx, release)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", release.Name, err)
+		}
+		changes[release.Name] = preview
+	}
+	return changes, nil
+}
+
+// namedReleases looks up releases by name; no names means every installed
+// release
+func (d *Daemon) namedReleases(names []string) ([]helmstate.Release, error) {
+	var releases []helmstate.Release
+	if len(names) == 0 {
+		for _, release := range d.manager.GetReleases() {
+			if d.manager.IsReleaseInstalled(release) {
+				releases = append(releases, release)
+			}
+		}
+		return releases, nil
+	}
+	for _, name := range names {
+		release, err := d.findRelease(name)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, release)
+	}
+	return releases, nil
+}
+
+// handleReleases lists the releases of the helmfile (GET /api/v1/releases)
+func (h *APIHandler) handleReleases(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.methodNotAllowed(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ReleasesResponse{Releases: h.daemon.releaseStates()})
+}
+
+// handleSync syncs releases, or previews the changes with dryRun
+// (POST /api/v1/sync)
+func (h *APIHandler) handleSync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.methodNotAllowed(w)
+		return
+	}
+
+	if !h.requireLeader(w) {
+		return
+	}
+
+	var req SyncRequest
+	if err := decodeRequest(r, &req); err != nil {
+		h.sendError(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		h.sendValidationError(w, err)
+		return
+	}
+	releases, err := h.daemon.namedReleases(req.Releases)
+	if err != nil {
+		h.sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if !h.authorizeReleases(w, r, AccessSync, releases...) {
+		return
+	}
+
+	h.logger.Info("sync requested via API",
+		zap.Strings("releases", req.Releases),
+		zap.Bool("dryRun", req.DryRun))
+
+	var resp SyncResponse
+	if req.DryRun {
+		changes, err := h.daemon.previewReleases(releases)
+		if err != nil {
+			h.sendError(w, fmt.Sprintf("Sync dry-run failed: %v", err), http.StatusInternalServerError)
+			return
+		}
+		resp.Changes = changes
+	} else {
+		run := h.daemon.syncReleases(TriggerAPI, releases)
+		resp.Run = &run
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleReleaseValues serves the value overlay of a release
+// (/api/v1/releases/{name}/values): GET returns it, POST merges values into
+// it and DELETE clears it. Overlays apply from the next sync of the release.
+func (h *APIHandler) handleReleaseValues(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/releases/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] != "values" {
+		h.notFound(w, r)
+		return
+	}
+
+	name := parts[0]
+	release, err := h.daemon.findRelease(name)
+	if err != nil {
+		h.sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	manager := h.daemon.GetManager()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if !h.authorizeReleases(w, r, AccessValues, release) {
+			return
+		}
+		var req ValuesOverlayRequest
+		if err := decodeRequest(r, &req); err != nil {
+			h.sendError(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			h.sendValidationError(w, err)
+			return
+		}
+		manager.SetOverlay(name, req.Values)
+		h.daemon.saveState()
+		h.logger.Info("release values overlaid via API",
+			zap.String("release", name),
+			zap.Strings("names", sortedKeys(req.Values)))
+	case http.MethodDelete:
+		if !h.authorizeReleases(w, r, AccessValues, release) {
+			return
+		}
+		if !manager.ClearOverlay(name) {
+			h.sendError(w, fmt.Sprintf("release %s has no value overlay", name), http.StatusNotFound)
+			return
+		}
+		h.daemon.saveState()
+		h.logger.Info("release value overlay cleared via API", zap.String("release", name))
+	default:
+		h.methodNotAllowed(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ValuesOverlayResponse{Release: name, Values: manager.Overlay(name)})
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
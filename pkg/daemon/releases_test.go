@@ -0,0 +1,234 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+	"go.uber.org/zap"
+)
+
+// newReleasesHandler returns a handler whose helmfile has the web and db
+// releases, synced with a helm binary that doesn't exist
+func newReleasesHandler(t *testing.T) *APIHandler {
+	handler := newTestHandler(t)
+	disabled := false
+	handler.daemon.ctx = context.Background()
+	handler.daemon.manager.Spec.Releases = []helmstate.Release{
+		{Name: "web", Namespace: "apps", Chart: "bitnami/nginx", Version: "15.0.0"},
+		{Name: "db", Chart: "bitnami/postgresql", Installed: &disabled},
+	}
+	handler.daemon.substitutor = substitute.NewManager()
+	handler.daemon.executor = sync.NewExecutor(zap.NewNop(), handler.daemon.substitutor)
+	handler.daemon.executor.SetHelmBinary(filepath.Join(t.TempDir(), "missing-helm"))
+	return handler
+}
+
+func TestHandleReleases(t *testing.T) {
+	handler := newReleasesHandler(t)
+
+	old := sync.NewReport()
+	old.Record("web", "apps", time.Second, nil)
+	handler.daemon.recordSyncRun(TriggerSource, old)
+	latest := sync.NewReport()
+	latest.Record("web", "apps", time.Second, context.DeadlineExceeded)
+	handler.daemon.recordSyncRun(TriggerHeal, latest)
+	other := sync.NewReport()
+	other.Record("cache", "apps", time.Second, nil)
+	handler.daemon.recordSyncRun(TriggerSource, other)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/releases", nil)
+	rec := httptest.NewRecorder()
+	handler.handleReleases(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp ReleasesResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Releases) != 2 {
+		t.Fatalf("expected 2 releases, got %+v", resp.Releases)
+	}
+
+	web, db := resp.Releases[0], resp.Releases[1]
+	if web.Name != "web" || web.Namespace != "apps" || web.Version != "15.0.0" || !web.Installed {
+		t.Errorf("unexpected web release %+v", web)
+	}
+	if web.LastSync == nil || web.LastSync.Status == sync.ReleaseStatusSucceeded {
+		t.Errorf("expected the result of the latest run including web, got %+v", web.LastSync)
+	}
+	if db.Installed || db.LastSync != nil {
+		t.Errorf("expected db not installed and never synced, got %+v", db)
+	}
+}
+
+func TestHandleSync(t *testing.T) {
+	handler := newReleasesHandler(t)
+
+	post := func(req SyncRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(req)
+		rec := httptest.NewRecorder()
+		handler.handleSync(rec, httptest.NewRequest(http.MethodPost, "/api/v1/sync", bytes.NewReader(body)))
+		return rec
+	}
+
+	if rec := post(SyncRequest{Releases: []string{"missing"}}); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown release, got %d", rec.Code)
+	}
+
+	// Installed releases only, recorded in the history even when they fail
+	rec := post(SyncRequest{})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp SyncResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Run == nil || resp.Run.Trigger != TriggerAPI || len(resp.Run.Results) != 1 || resp.Run.Results[0].Name != "web" {
+		t.Fatalf("expected a run syncing web, got %+v", resp.Run)
+	}
+	if resp.Run.Results[0].Status != sync.ReleaseStatusFailed {
+		t.Errorf("expected web to fail without helm, got %+v", resp.Run.Results[0])
+	}
+	if runs := handler.daemon.SyncHistory(); len(runs) != 1 || runs[0].ID != resp.Run.ID {
+		t.Errorf("expected the run in the sync history, got %+v", runs)
+	}
+
+	if rec := post(SyncRequest{Releases: []string{"web"}, DryRun: true}); rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected the dry run to fail without helm, got %d", rec.Code)
+	}
+}
+
+func TestHandleReleaseValues(t *testing.T) {
+	handler := newReleasesHandler(t)
+
+	send := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var data []byte
+		if body != nil {
+			data, _ = json.Marshal(body)
+		}
+		rec := httptest.NewRecorder()
+		handler.handleReleaseValues(rec, httptest.NewRequest(method, path, bytes.NewReader(data)))
+		return rec
+	}
+
+	if rec := send(http.MethodPost, "/api/v1/releases/missing/values", ValuesOverlayRequest{Values: map[string]string{"a": "1"}}); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown release, got %d", rec.Code)
+	}
+	if rec := send(http.MethodPost, "/api/v1/releases/web/values", ValuesOverlayRequest{}); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without values, got %d", rec.Code)
+	}
+	if rec := send(http.MethodPost, "/api/v1/releases/web/values", ValuesOverlayRequest{Values: map[string]string{"a=b": "1"}}); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid value name, got %d", rec.Code)
+	}
+
+	send(http.MethodPost, "/api/v1/releases/web/values", ValuesOverlayRequest{Values: map[string]string{"features.beta": "true"}})
+	rec := send(http.MethodPost, "/api/v1/releases/web/values", ValuesOverlayRequest{Values: map[string]string{"replicas": "1"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp ValuesOverlayResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Release != "web" || len(resp.Values) != 2 || resp.Values["features.beta"] != "true" {
+		t.Errorf("expected the values to be merged, got %+v", resp)
+	}
+
+	web := handler.daemon.manager.GetReleases()[0]
+	if len(web.Set) != 2 || web.Set[0].Name != "features.beta" || web.Set[1].Name != "replicas" {
+		t.Errorf("expected the next sync of web to set the overlay, got %+v", web.Set)
+	}
+	if states := handler.daemon.releaseStates(); states[0].Values["replicas"] != "1" || states[1].Values != nil {
+		t.Errorf("expected the overlay in the release states, got %+v", states)
+	}
+
+	if rec := send(http.MethodDelete, "/api/v1/releases/web/values", nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 clearing, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := send(http.MethodDelete, "/api/v1/releases/web/values", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 clearing twice, got %d", rec.Code)
+	}
+	if web := handler.daemon.manager.GetReleases()[0]; len(web.Set) != 0 {
+		t.Errorf("expected the overlay to be gone, got %+v", web.Set)
+	}
+	if rec := send(http.MethodGet, "/api/v1/releases/web/other", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown route, got %d", rec.Code)
+	}
+}
+
+func TestOverlaySyncedWithoutDrift(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	// Fake helm renders the set values into the manifest, keeps the one
+	// upgraded for helm get manifest and reports any diff as a change
+	dir := t.TempDir()
+	stored := filepath.Join(dir, "manifest")
+	helm := filepath.Join(dir, "helm")
+	script := `#!/bin/sh
+command=$1
+manifest="kind: ConfigMap"
+while [ $# -gt 0 ]; do
+  case "$1" in
+    --set) manifest="$manifest
+# $2"; shift ;;
+  esac
+  shift
+done
+case "$command" in
+  status) echo "STATUS: deployed" ;;
+  upgrade) echo "$manifest" > ` + stored + `; echo '{"name":"web","namespace":"apps","version":1,"info":{"status":"deployed"}}' ;;
+  template) echo "$manifest" ;;
+  get) cat ` + stored + ` ;;
+  diff) echo "apps, web, ConfigMap (v1) has changed:"; exit 2 ;;
+esac
+`
+	if err := os.WriteFile(helm, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake helm: %v", err)
+	}
+
+	handler := newReleasesHandler(t)
+	d := handler.daemon
+	d.manager.HelmBinary = helm
+	d.executor.SetHelmBinary(helm)
+	d.executor.SetCreateNamespace(false)
+
+	data, _ := json.Marshal(ValuesOverlayRequest{Values: map[string]string{"replicas": "1"}})
+	rec := httptest.NewRecorder()
+	handler.handleReleaseValues(rec, httptest.NewRequest(http.MethodPost, "/api/v1/releases/web/values", bytes.NewReader(data)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 setting the overlay, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if err := d.healRelease("web"); err != nil {
+		t.Fatalf("failed to sync web: %v", err)
+	}
+
+	data, _ = json.Marshal(DriftCheckRequest{Release: "web"})
+	rec = httptest.NewRecorder()
+	handler.handleDriftCheck(rec, httptest.NewRequest(http.MethodPost, "/api/v1/drift/check", bytes.NewReader(data)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 checking drift, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp DriftCheckResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(resp.Reports) != 0 {
+		t.Errorf("expected no drift after syncing the overlay, got %+v", resp.Reports)
+	}
+}
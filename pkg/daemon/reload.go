@@ -0,0 +1,180 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"go.uber.org/zap"
+)
+
+// ReloadFunc rebuilds the daemon's configuration, such as from its flags and
+// a reread config file
+type ReloadFunc func() (DaemonConfig, error)
+
+// errReloadUnsupported is returned by reloads of daemons without a
+// ReloadFunc
+var errReloadUnsupported = errors.New("configuration reload is not supported by this daemon")
+
+// reloader reloads the daemon's configuration, one reload at a time
+type reloader struct {
+	reload  ReloadFunc
+	mu      sync.Mutex
+	signals chan os.Signal
+}
+
+// reloadOnSignal reloads the configuration whenever one of reloadSignals
+// arrives, until the daemon stops
+func (d *Daemon) reloadOnSignal() {
+	if len(reloadSignals) == 0 {
+		return
+	}
+	d.reloader.signals = make(chan os.Signal, 1)
+	signal.Notify(d.reloader.signals, reloadSignals...)
+
+	go func() {
+		for {
+			select {
+			case <-d.ctx.Done():
+				return
+			case sig := <-d.reloader.signals:
+				d.logger.Info("received reload signal", zap.String("signal", sig.String()))
+				if _, err := d.ReloadConfig(); err != nil {
+					d.logger.Error("failed to reload configuration", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// stop stops delivering reload signals
+func (r *reloader) stop() {
+	if r.signals != nil {
+		signal.Stop(r.signals)
+	}
+}
+
+// ReloadConfig rebuilds the configuration with the daemon's ReloadFunc and
+// applies its notifiers, drift interval, helmfile paths and API access
+// policy. Substitutions,
+// value overlays, drift history and sync results are kept. Nothing is
+// applied when the new configuration is invalid; turning drift detection on
+// or off takes a restart and is reported as a warning.
+func (d *Daemon) ReloadConfig() (ConfigReloadResponse, error) {
+	d.reloader.mu.Lock()
+	defer d.reloader.mu.Unlock()
+
+	if d.reloader.reload == nil {
+		return ConfigReloadResponse{}, errReloadUnsupported
+	}
+	config, err := d.reloader.reload()
+	if err != nil {
+		return ConfigReloadResponse{}, fmt.Errorf("failed to reload configuration: %w", err)
+	}
+
+	// Check everything before applying anything
+	notifiers, err := driftNotifiers(config, d.logger)
+	if err != nil {
+		return ConfigReloadResponse{}, err
+	}
+	if err := d.reloadHelmfilePaths(config); err != nil {
+		return ConfigReloadResponse{}, err
+	}
+
+	d.setAccessPolicy(config.APIAccess)
+
+	resp := ConfigReloadResponse{Message: "Configuration reloaded"}
+	d.setDriftNotifiers(notifiers)
+	if d.detector != nil {
+		if config.DriftInterval > 0 {
+			d.detector.SetInterval(config.DriftInterval)
+		} else {
+			resp.Warnings = append(resp.Warnings, "drift detection stays enabled until the daemon restarts")
+		}
+		resp.Notifiers = len(notifiers)
+		resp.DriftInterval = d.detector.Interval().String()
+	} else if config.DriftInterval > 0 {
+		resp.Warnings = append(resp.Warnings, "drift detection is enabled when the daemon restarts")
+	}
+	resp.Files = d.manager.Snapshot().Files
+
+	for _, warning := range resp.Warnings {
+		d.logger.Warn("configuration reload incomplete", zap.String("warning", warning))
+	}
+	d.logger.Info("configuration reloaded",
+		zap.Int("notifiers", resp.Notifiers),
+		zap.String("driftInterval", resp.DriftInterval),
+		zap.Strings("files", resp.Files))
+	return resp, nil
+}
+
+// reloadHelmfilePaths loads the helmfiles of config when they differ from
+// the current ones, keeping the current ones when they fail to load. Paths
+// of a helmfile source don't change on reload.
+func (d *Daemon) reloadHelmfilePaths(config DaemonConfig) error {
+	if d.source != nil || config.HelmfilePath == "" {
+		return nil
+	}
+	path, err := filepath.Abs(config.HelmfilePath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path: %w", err)
+	}
+	if path == d.manager.FilePath && slices.Equal(config.ExtraPaths, d.manager.ExtraPaths) {
+		return nil
+	}
+
+	if err := d.manager.LoadPaths(path, config.ExtraPaths); err != nil {
+		return fmt.Errorf("failed to load helmfile: %w", err)
+	}
+	snapshot := d.helmfileReloaded()
+	d.logger.Info("helmfile paths changed",
+		zap.String("file", path),
+		zap.Strings("extra", config.ExtraPaths),
+		zap.Int("releases", snapshot.Stats.Releases))
+	return nil
+}
+
+// helmfileReloaded reports a successful reload of the helmfile: the values
+// files it skipped, and an event carrying the new spec generation. It
+// returns the state of the reload.
+func (d *Daemon) helmfileReloaded() helmstate.Snapshot {
+	d.logMissingFiles()
+	snapshot := d.manager.Snapshot()
+	d.events.publish(Event{
+		Type:       EventReload,
+		Generation: snapshot.Generation,
+		Ready:      true,
+		Message:    fmt.Sprintf("helmfile loaded: %d release(s) from %d file(s)", snapshot.Stats.Releases, snapshot.Stats.Files),
+	})
+	return snapshot
+}
+
+// handleConfigReload reloads the daemon's configuration
+// (POST /api/v1/config/reload)
+func (h *APIHandler) handleConfigReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.methodNotAllowed(w)
+		return
+	}
+
+	h.logger.Info("configuration reload requested via API")
+	resp, err := h.daemon.ReloadConfig()
+	if errors.Is(err, errReloadUnsupported) {
+		h.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,149 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/drift"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+	"go.uber.org/zap"
+)
+
+// newReloadTestHandler returns a handler whose daemon detects drift every
+// minute and reloads to the configuration returned by reload
+func newReloadTestHandler(t *testing.T, reload ReloadFunc) *APIHandler {
+	handler := newTestHandler(t)
+	handler.daemon.detector = drift.NewDetector(handler.daemon.manager, time.Minute, handler.logger)
+	handler.daemon.reloader.reload = reload
+	return handler
+}
+
+func TestReloadConfigKeepsStateOnError(t *testing.T) {
+	helmfile := filepath.Join(t.TempDir(), "helmfile.yaml")
+	if err := os.WriteFile(helmfile, []byte("releases:\n- name: web\n  chart: bitnami/nginx\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DaemonConfig{
+		HelmfilePath:  helmfile,
+		DriftInterval: 5 * time.Minute,
+		DriftWebhook:  "http://localhost:9999/drift",
+	}
+	handler := newReloadTestHandler(t, func() (DaemonConfig, error) { return config, nil })
+	d := handler.daemon
+	d.manager.SetOverlay("web", map[string]string{"replicas": "1"})
+
+	resp, err := d.ReloadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.DriftInterval != "5m0s" || d.detector.Interval() != 5*time.Minute {
+		t.Errorf("expected the drift interval to be reloaded, got %+v", resp)
+	}
+	if resp.Notifiers != 2 {
+		t.Errorf("expected stdout and webhook notifiers, got %d", resp.Notifiers)
+	}
+	if len(resp.Files) != 1 || len(d.manager.GetReleases()) != 1 {
+		t.Errorf("expected the helmfile to be loaded, got %+v", resp)
+	}
+	if d.manager.Overlay("web")["replicas"] != "1" {
+		t.Error("expected the value overlay to survive the reload")
+	}
+
+	config.DriftInterval = time.Hour
+	config.Notifiers = []drift.NotifierConfig{{Type: "carrier-pigeon"}}
+	if _, err := d.ReloadConfig(); err == nil {
+		t.Fatal("expected an unknown notifier to fail the reload")
+	}
+	if d.detector.Interval() != 5*time.Minute {
+		t.Errorf("expected a failed reload to apply nothing, got interval %s", d.detector.Interval())
+	}
+
+	config.Notifiers = nil
+	config.DriftInterval = 0
+	resp, err = d.ReloadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Warnings) != 1 || d.detector.Interval() != 5*time.Minute {
+		t.Errorf("expected disabling drift detection to wait for a restart, got %+v", resp)
+	}
+}
+
+func TestHandleConfigReload(t *testing.T) {
+	handler := newReloadTestHandler(t, func() (DaemonConfig, error) {
+		return DaemonConfig{DriftInterval: 2 * time.Minute}, nil
+	})
+
+	rec := httptest.NewRecorder()
+	handler.handleConfigReload(rec, httptest.NewRequest(http.MethodPost, "/api/v1/config/reload", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp ConfigReloadResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.DriftInterval != "2m0s" {
+		t.Errorf("expected the new drift interval, got %+v", resp)
+	}
+
+	handler.daemon.reloader.reload = func() (DaemonConfig, error) { return DaemonConfig{}, errors.New("bad config file") }
+	rec = httptest.NewRecorder()
+	handler.handleConfigReload(rec, httptest.NewRequest(http.MethodPost, "/api/v1/config/reload", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500 for a failed reload, got %d", rec.Code)
+	}
+
+	handler.daemon.reloader.reload = nil
+	rec = httptest.NewRecorder()
+	handler.handleConfigReload(rec, httptest.NewRequest(http.MethodPost, "/api/v1/config/reload", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without reload support, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.handleConfigReload(rec, httptest.NewRequest(http.MethodGet, "/api/v1/config/reload", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", rec.Code)
+	}
+}
+
+func TestReloadPublishesSpecGeneration(t *testing.T) {
+	helmfile := filepath.Join(t.TempDir(), "helmfile.yaml")
+	if err := os.WriteFile(helmfile, []byte("releases:\n- name: web\n  chart: bitnami/nginx\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := newReloadTestHandler(t, func() (DaemonConfig, error) {
+		return DaemonConfig{HelmfilePath: helmfile, DriftInterval: time.Minute}, nil
+	})
+	d := handler.daemon
+	d.substitutor = substitute.NewManager()
+	d.executor = sync.NewExecutor(zap.NewNop(), d.substitutor)
+	d.events.generation = d.manager.Generation
+
+	if _, err := d.ReloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	events := d.events.since(0)
+	if len(events) != 1 || events[0].Type != EventReload || events[0].Generation != 1 {
+		t.Fatalf("expected a reload event of generation 1, got %+v", events)
+	}
+	if status := d.GetStatus(); status.SpecGeneration != 1 {
+		t.Errorf("expected status to report generation 1, got %d", status.SpecGeneration)
+	}
+
+	// Other events carry the generation the daemon works with
+	d.events.publish(Event{Type: EventRollout, Release: "web"})
+	if events := d.events.since(1); len(events) != 1 || events[0].Generation != 1 {
+		t.Errorf("expected the rollout event to carry generation 1, got %+v", events)
+	}
+}
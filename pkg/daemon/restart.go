@@ -0,0 +1,79 @@
+package daemon
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// RestartTimeout bounds how long RestartDaemon waits for the new daemon to
+// write its PID file
+const RestartTimeout = 30 * time.Second
+
+// RestartDaemon stops the daemon of pidFile and starts it again in the
+// background with the command and in the directory it was started with, so
+// it keeps its configuration and, through its state file, its state. It
+// returns the PID of the new daemon.
+func RestartDaemon(pidFile, apiAddr string) (int, error) {
+	info, err := readPIDFile(pidFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, fmt.Errorf("daemon not running (PID file not found)")
+		}
+		return 0, err
+	}
+	if len(info.Command) == 0 {
+		return 0, fmt.Errorf("daemon did not record how it was started; stop it and start it again")
+	}
+
+	if err := StopDaemon(pidFile, apiAddr); err != nil {
+		return 0, err
+	}
+	return startDetached(info, pidFile, RestartTimeout)
+}
+
+// startDetached runs the command of info in the background and waits for it
+// to write pidFile
+func startDetached(info pidInfo, pidFile string, timeout time.Duration) (int, error) {
+	cmd := exec.Command(info.Command[0], info.Command[1:]...)
+	cmd.Dir = info.Project
+	detachProcess(cmd)
+
+	// A supervised daemon's supervisor writes the log itself
+	var output io.Writer
+	if info.LogFile != "" && !info.Supervised {
+		log, err := openLogFile(info.LogFile)
+		if err != nil {
+			return 0, fmt.Errorf("failed to open daemon log file: %w", err)
+		}
+		defer log.Close()
+		output = log
+	}
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("failed to start daemon: %w", err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.After(timeout)
+	for {
+		select {
+		case err := <-exited:
+			return 0, fmt.Errorf("daemon exited while starting (%v); see %s", err, info.LogFile)
+		case <-deadline:
+			return 0, fmt.Errorf("daemon did not start within %s; see %s", timeout, info.LogFile)
+		case <-ticker.C:
+			started, err := readPIDFile(pidFile)
+			if err == nil && started.PID != info.PID && staleReason(started) == "" {
+				return started.PID, nil
+			}
+		}
+	}
+}
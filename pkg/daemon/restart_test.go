@@ -0,0 +1,89 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestRestartHelperProcess is the daemon started by the restart tests: it
+// writes its PID file and runs until killed, for a minute at most
+func TestRestartHelperProcess(t *testing.T) {
+	pidFile := os.Getenv("HELMFIRE_TEST_PID_FILE")
+	if pidFile == "" {
+		t.Skip("run by the restart tests")
+	}
+	info, err := currentPIDInfo()
+	if err != nil {
+		os.Exit(1)
+	}
+	if err := writePIDFile(pidFile, info); err != nil {
+		os.Exit(1)
+	}
+	time.Sleep(time.Minute)
+}
+
+func TestStartDetachedWaitsForPIDFile(t *testing.T) {
+	dir := t.TempDir()
+	pidFile := filepath.Join(dir, "daemon.pid")
+	t.Setenv("HELMFIRE_TEST_PID_FILE", pidFile)
+
+	info := pidInfo{
+		PID:     os.Getpid(),
+		Project: dir,
+		Command: []string{os.Args[0], "-test.run=^TestRestartHelperProcess$"},
+		LogFile: filepath.Join(dir, "daemon.log"),
+	}
+	pid, err := startDetached(info, pidFile, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if process, err := os.FindProcess(pid); err == nil {
+		defer process.Kill()
+	}
+
+	if pid == info.PID {
+		t.Errorf("expected a new daemon, got PID %d", pid)
+	}
+	started, err := readPIDFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if started.Project != dir {
+		t.Errorf("expected the daemon to run in %s, got %s", dir, started.Project)
+	}
+	if _, err := os.Stat(info.LogFile); err != nil {
+		t.Errorf("expected the daemon's output in its log file: %v", err)
+	}
+}
+
+func TestStartDetachedReportsExit(t *testing.T) {
+	dir := t.TempDir()
+	info := pidInfo{
+		Project: dir,
+		Command: []string{os.Args[0], "-test.run=^TestRestartHelperProcess$"},
+	}
+	// Without HELMFIRE_TEST_PID_FILE the helper exits without a PID file
+	if _, err := startDetached(info, filepath.Join(dir, "daemon.pid"), 10*time.Second); err == nil {
+		t.Fatal("expected an error for a daemon that exits while starting")
+	}
+}
+
+func TestRestartDaemonNeedsCommand(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "daemon.pid")
+	info, err := currentPIDInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writePIDFile(pidFile, info); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RestartDaemon(pidFile, "127.0.0.1:1"); err == nil {
+		t.Fatal("expected an error for a daemon that did not record its command")
+	}
+	if _, err := os.Stat(pidFile); err != nil {
+		t.Errorf("expected the daemon to be left running: %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"go.uber.org/zap"
+)
+
+// rollback rolls back the releases a request names and records the run in
+// the sync history. A dry run only plans the rollback.
+func (d *Daemon) rollback(req RollbackRequest) (RollbackResponse, error) {
+	var releases []helmstate.Release
+	if req.All {
+		for _, release := range d.manager.GetReleases() {
+			if d.manager.IsReleaseInstalled(release) {
+				releases = append(releases, release)
+			}
+		}
+	} else {
+		release, err := d.findRelease(req.Release)
+		if err != nil {
+			return RollbackResponse{}, err
+		}
+		releases = append(releases, release)
+	}
+
+	steps, err := d.executor.PlanRollback(d.ctx, releases, req.Revision)
+	if err != nil {
+		return RollbackResponse{}, err
+	}
+	resp := RollbackResponse{Steps: steps, DryRun: req.DryRun}
+	if req.DryRun {
+		return resp, nil
+	}
+
+	d.logger.Info("rolling back releases", zap.Int("count", len(steps)))
+	run := d.recordSyncRun(TriggerRollback, d.executor.Rollback(d.ctx, steps))
+	resp.Run = &run
+	return resp, nil
+}
+
+// handleRollback rolls back releases (POST /api/v1/rollback)
+func (h *APIHandler) handleRollback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.methodNotAllowed(w)
+		return
+	}
+
+	var req RollbackRequest
+	if err := decodeRequest(r, &req); err != nil {
+		h.sendError(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		h.sendValidationError(w, err)
+		return
+	}
+
+	var names []string
+	if !req.All {
+		names = []string{req.Release}
+	}
+	releases, err := h.daemon.namedReleases(names)
+	if err != nil {
+		h.sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if !h.authorizeReleases(w, r, AccessRollback, releases...) {
+		return
+	}
+
+	if !req.DryRun && !h.requireLeader(w) {
+		return
+	}
+
+	h.logger.Info("rollback requested via API",
+		zap.String("release", req.Release),
+		zap.Int("revision", req.Revision),
+		zap.Bool("all", req.All),
+		zap.Bool("dryRun", req.DryRun))
+
+	resp, err := h.daemon.rollback(req)
+	if err != nil {
+		h.sendError(w, fmt.Sprintf("Rollback failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
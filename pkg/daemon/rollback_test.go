@@ -0,0 +1,89 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+	"go.uber.org/zap"
+)
+
+func TestHandleRollback(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	// Fake helm: web was synced by helmfire at revision 4
+	helm := filepath.Join(t.TempDir(), "helm")
+	script := `#!/bin/sh
+case "$1" in
+history) echo '[{"revision":3,"description":"Upgrade complete"},{"revision":4,"description":"helmfire sync"}]' ;;
+rollback) ;;
+*) exit 1 ;;
+esac
+`
+	if err := os.WriteFile(helm, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake helm: %v", err)
+	}
+
+	handler := newTestHandler(t)
+	d := handler.daemon
+	d.ctx = context.Background()
+	d.manager.Spec.Releases = []helmstate.Release{{Name: "web", Chart: "bitnami/nginx", Namespace: "frontend"}}
+	d.substitutor = substitute.NewManager()
+	d.executor = sync.NewExecutor(zap.NewNop(), d.substitutor)
+	d.executor.SetHelmBinary(helm)
+
+	post := func(req RollbackRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(req)
+		rec := httptest.NewRecorder()
+		handler.handleRollback(rec, httptest.NewRequest(http.MethodPost, "/api/v1/rollback", bytes.NewReader(body)))
+		return rec
+	}
+
+	rec := post(RollbackRequest{All: true, DryRun: true})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp RollbackResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Steps) != 1 || resp.Steps[0] != (sync.RollbackStep{Release: "web", Namespace: "frontend", Revision: 3}) || resp.Run != nil {
+		t.Errorf("expected a plan to roll web back to revision 3, got %+v", resp)
+	}
+	if runs := d.SyncHistory(); len(runs) != 0 {
+		t.Errorf("expected a dry run not to be recorded, got %+v", runs)
+	}
+
+	rec = post(RollbackRequest{Release: "web"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	resp = RollbackResponse{}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Run == nil || resp.Run.Trigger != TriggerRollback || resp.Run.Failed() {
+		t.Errorf("expected a successful rollback run, got %+v", resp.Run)
+	}
+	if runs := d.SyncHistory(); len(runs) != 1 || runs[0].ID != resp.Run.ID {
+		t.Errorf("expected the rollback in the sync history, got %+v", runs)
+	}
+
+	if rec := post(RollbackRequest{Release: "missing"}); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown release, got %d", rec.Code)
+	}
+	if rec := post(RollbackRequest{}); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a release, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,174 @@
+package daemon
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+)
+
+// Resource routes for a single substitution, addressed by its path-escaped
+// original: /api/v1/charts/{original} and /api/v1/images/{original}
+const (
+	chartsPrefix = "/api/v1/charts/"
+	imagesPrefix = "/api/v1/images/"
+)
+
+// Legacy POST-only removal routes, kept for older clients
+const (
+	legacyRemoveChartPath = "/api/v1/charts/remove"
+	legacyRemoveImagePath = "/api/v1/images/remove"
+)
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// withResourceRoutes serves the single substitution routes ahead of mux,
+// whose path cleaning would mangle originals such as oci://registry/chart
+func (h *APIHandler) withResourceRoutes(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		switch {
+		case r.Method == http.MethodPost && (path == legacyRemoveChartPath || path == legacyRemoveImagePath):
+			mux.ServeHTTP(w, r)
+		case strings.HasPrefix(path, chartsPrefix):
+			h.handleChart(w, r)
+		case strings.HasPrefix(path, imagesPrefix):
+			h.handleImage(w, r)
+		default:
+			if _, pattern := mux.Handler(r); pattern == "" {
+				h.notFound(w, r)
+				return
+			}
+			mux.ServeHTTP(w, r)
+		}
+	})
+}
+
+// handleChart serves one chart substitution: GET returns it, POST adds it
+// and DELETE removes it. GET and DELETE take the scope from the release and
+// namespace query parameters.
+func (h *APIHandler) handleChart(w http.ResponseWriter, r *http.Request) {
+	original, ok := h.resourceOriginal(w, r, chartsPrefix)
+	if !ok {
+		return
+	}
+	scope := queryScope(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		for _, c := range NewSubstitutionsResponse(h.daemon.GetSubstitutor()).Charts {
+			if c.Original == original && c.Release == scope.Release && c.Namespace == scope.Namespace {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(c)
+				return
+			}
+		}
+		h.sendError(w, fmt.Sprintf("chart substitution not found: %s", original), http.StatusNotFound)
+	case http.MethodPost:
+		var req AddChartRequest
+		if err := decodeRequest(r, &req); err != nil {
+			h.sendError(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		if req.Original != "" && req.Original != original {
+			h.sendError(w, fmt.Sprintf("original %q in body does not match %q in path", req.Original, original), http.StatusBadRequest)
+			return
+		}
+		req.Original = original
+		if req.Release == "" && req.Namespace == "" {
+			req.Release, req.Namespace = scope.Release, scope.Namespace
+		}
+		h.addChart(w, r, req)
+	case http.MethodDelete:
+		h.removeChart(w, r, RemoveChartRequest{Original: original, Release: scope.Release, Namespace: scope.Namespace}, http.StatusNotFound)
+	default:
+		h.methodNotAllowed(w)
+	}
+}
+
+// handleImage serves one image substitution: GET returns it, POST adds it
+// and DELETE removes it. GET and DELETE take the scope from the release and
+// namespace query parameters.
+func (h *APIHandler) handleImage(w http.ResponseWriter, r *http.Request) {
+	original, ok := h.resourceOriginal(w, r, imagesPrefix)
+	if !ok {
+		return
+	}
+	scope := queryScope(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		for _, img := range NewSubstitutionsResponse(h.daemon.GetSubstitutor()).Images {
+			if img.Original == original && img.Release == scope.Release && img.Namespace == scope.Namespace {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(img)
+				return
+			}
+		}
+		h.sendError(w, fmt.Sprintf("image substitution not found: %s", original), http.StatusNotFound)
+	case http.MethodPost:
+		var req AddImageRequest
+		if err := decodeRequest(r, &req); err != nil {
+			h.sendError(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		if req.Original != "" && req.Original != original {
+			h.sendError(w, fmt.Sprintf("original %q in body does not match %q in path", req.Original, original), http.StatusBadRequest)
+			return
+		}
+		req.Original = original
+		if req.Release == "" && req.Namespace == "" {
+			req.Release, req.Namespace = scope.Release, scope.Namespace
+		}
+		h.addImage(w, r, req)
+	case http.MethodDelete:
+		h.removeImage(w, r, RemoveImageRequest{Original: original, Release: scope.Release, Namespace: scope.Namespace}, http.StatusNotFound)
+	default:
+		h.methodNotAllowed(w)
+	}
+}
+
+// resourceOriginal returns the unescaped original after prefix in the request
+// path, answering 404 when it is missing
+func (h *APIHandler) resourceOriginal(w http.ResponseWriter, r *http.Request, prefix string) (string, bool) {
+	escaped := strings.TrimPrefix(r.URL.EscapedPath(), prefix)
+	original, err := url.PathUnescape(escaped)
+	if err != nil || original == "" {
+		h.notFound(w, r)
+		return "", false
+	}
+	return original, true
+}
+
+// queryScope returns the scope given by the release and namespace query
+// parameters
+func queryScope(r *http.Request) substitute.Scope {
+	query := r.URL.Query()
+	return substitute.Scope{Release: query.Get("release"), Namespace: query.Get("namespace")}
+}
+
+// deprecated marks the responses of a legacy route as deprecated in favor of
+// successor
+func deprecated(handler http.HandlerFunc, successor string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+		handler(w, r)
+	}
+}
+
+// handleOpenAPI serves the OpenAPI description of the API
+func (h *APIHandler) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.methodNotAllowed(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
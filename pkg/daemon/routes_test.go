@@ -0,0 +1,187 @@
+package daemon
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"go.uber.org/zap"
+)
+
+// newTestServer serves the full API router of a test handler's daemon
+func newTestServer(t *testing.T) (*httptest.Server, *APIHandler) {
+	t.Helper()
+
+	handler := newTestHandler(t)
+	handler.daemon.substitutor = substitute.NewManager()
+
+	server := httptest.NewServer(NewAPIServer("", handler.daemon, zap.NewNop()).server.Handler)
+	t.Cleanup(server.Close)
+	return server, handler
+}
+
+func TestImageResourceRoutes(t *testing.T) {
+	server, handler := newTestServer(t)
+	client := NewAPIClient(strings.TrimPrefix(server.URL, "http://"))
+	original := "docker.io/library/nginx:1.21"
+
+	body, _ := json.Marshal(AddImageRequest{Replacement: "local/nginx:dev"})
+	resp, err := http.Post(server.URL+resourcePath(imagesPrefix, original, substitute.Scope{Release: "web"}), "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 adding image, got %d", resp.StatusCode)
+	}
+	if subs := handler.daemon.substitutor.ImageSubstitutionsFor("web", ""); len(subs) != 1 || subs[0].Original != original {
+		t.Fatalf("expected image substitution scoped to web, got %+v", subs)
+	}
+
+	resp, err = http.Get(server.URL + resourcePath(imagesPrefix, original, substitute.Scope{Release: "web"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var img ImageSubstitution
+	json.NewDecoder(resp.Body).Decode(&img)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || img.Replacement != "local/nginx:dev" || img.Release != "web" {
+		t.Errorf("unexpected GET response %d: %+v", resp.StatusCode, img)
+	}
+
+	resp, err = http.Get(server.URL + resourcePath(imagesPrefix, original, substitute.Scope{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for the unscoped image, got %d", resp.StatusCode)
+	}
+
+	if err := client.RemoveImageSubstitution(original, substitute.Scope{}); err == nil {
+		t.Error("expected error removing an unscoped image that doesn't exist")
+	}
+	if err := client.RemoveImageSubstitution(original, substitute.Scope{Release: "web"}); err != nil {
+		t.Fatalf("RemoveImageSubstitution failed: %v", err)
+	}
+	if subs := handler.daemon.substitutor.ListImageSubstitutions(); len(subs) != 0 {
+		t.Errorf("expected image substitution to be removed, got %+v", subs)
+	}
+}
+
+func TestChartResourceRoutesKeepDoubleSlashes(t *testing.T) {
+	server, handler := newTestServer(t)
+	original := "oci://registry.example.com/charts/nginx"
+	chartDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte("apiVersion: v2\nname: nginx\nversion: 1.0.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := handler.daemon.substitutor.AddChartSubstitution(original, chartDir); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get(server.URL + resourcePath(chartsPrefix, original, substitute.Scope{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chart ChartSubstitution
+	json.NewDecoder(resp.Body).Decode(&chart)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || chart.Original != original {
+		t.Fatalf("unexpected GET response %d: %+v", resp.StatusCode, chart)
+	}
+
+	resp, err = http.Get(server.URL + "/api/v1/charts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var charts ChartsResponse
+	json.NewDecoder(resp.Body).Decode(&charts)
+	resp.Body.Close()
+	if len(charts.Charts) != 1 {
+		t.Errorf("expected 1 chart in the collection, got %+v", charts.Charts)
+	}
+}
+
+func TestLegacyRemoveRoutes(t *testing.T) {
+	server, handler := newTestServer(t)
+	handler.daemon.substitutor.AddImageSubstitution("nginx:1.21", "local/nginx:dev")
+
+	body, _ := json.Marshal(RemoveImageRequest{Original: "nginx:1.21"})
+	resp, err := http.Post(server.URL+legacyRemoveImagePath, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Deprecation") != "true" || !strings.Contains(resp.Header.Get("Link"), imagesPrefix) {
+		t.Errorf("expected deprecation headers, got %v", resp.Header)
+	}
+	if _, ok := handler.daemon.substitutor.GetImageReplacement("nginx:1.21"); ok {
+		t.Error("expected image substitution to be removed")
+	}
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	resp, err := http.Get(server.URL + "/api/v1/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var spec struct {
+		OpenAPI string                     `json:"openapi"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&spec); err != nil {
+		t.Fatalf("invalid OpenAPI document: %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Errorf("expected an OpenAPI 3 document, got %q", spec.OpenAPI)
+	}
+
+	for _, path := range []string{
+		"/health",
+		"/metrics",
+		"/api/v1/status",
+		"/api/v1/charts",
+		"/api/v1/charts/{original}",
+		legacyRemoveChartPath,
+		"/api/v1/images",
+		"/api/v1/images/{original}",
+		legacyRemoveImagePath,
+		"/api/v1/substitutions",
+		"/api/v1/substitutions/export",
+		"/api/v1/substitutions/import",
+		"/api/v1/audit",
+		"/api/v1/releases",
+		"/api/v1/releases/{name}/values",
+		"/api/v1/sync",
+		"/api/v1/drift",
+		"/api/v1/drift/check",
+		"/api/v1/drift/config",
+		"/api/v1/drift/heal",
+		"/api/v1/drift/{id}/heal",
+		"/api/v1/reload",
+		"/api/v1/config/reload",
+		"/api/v1/pause",
+		"/api/v1/resume",
+		"/api/v1/shutdown",
+		"/api/v1/openapi.json",
+	} {
+		if _, ok := spec.Paths[path]; !ok {
+			t.Errorf("OpenAPI document is missing %s", path)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+	"github.com/oleksiyp/helmfire/pkg/tracing"
+	"go.uber.org/zap"
+)
+
+// HelmfileSource fetches the helmfile from outside the local filesystem,
+// such as a ConfigMap, into a working directory
+type HelmfileSource interface {
+	// Fetch writes the helmfile to dir and returns its path. changed is
+	// false when nothing changed since the previous fetch.
+	Fetch(dir string) (path string, changed bool, err error)
+	String() string
+}
+
+// DefaultSourceInterval is how often a helmfile source is polled for changes
+const DefaultSourceInterval = time.Minute
+
+// fetchSource fetches the helmfile source into a new working directory
+func (d *Daemon) fetchSource(source HelmfileSource) (string, error) {
+	dir, err := os.MkdirTemp("", "helmfire-source-")
+	if err != nil {
+		return "", err
+	}
+
+	path, _, err := source.Fetch(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+
+	d.source = source
+	d.sourceDir = dir
+	return path, nil
+}
+
+// pollSource reloads the helmfile and syncs all releases when the source changes
+func (d *Daemon) pollSource() {
+	ticker := time.NewTicker(d.sourceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+			// A change found once resumed is synced then
+			if !d.paused() {
+				d.refreshSource()
+			}
+		}
+	}
+}
+
+// refreshSource fetches the source once and applies any change
+func (d *Daemon) refreshSource() {
+	_, changed, err := d.source.Fetch(d.sourceDir)
+	if err != nil {
+		d.logger.Error("failed to fetch helmfile source",
+			zap.String("source", d.source.String()),
+			zap.Error(err))
+		return
+	}
+	if !changed {
+		return
+	}
+
+	d.logger.Info("helmfile source changed, reloading", zap.String("source", d.source.String()))
+	if err := d.manager.Load(); err != nil {
+		d.logger.Error("failed to reload helmfile", zap.Error(err))
+		return
+	}
+	stats := d.helmfileReloaded().Stats
+	d.logger.Debug("reloaded helmfile",
+		zap.Duration("took", stats.Duration),
+		zap.Int("releases", stats.Releases),
+		zap.Int("files", stats.Files),
+		zap.Int("unchanged", stats.Reused))
+
+	if !d.IsLeader() {
+		return
+	}
+	d.syncAll(TriggerSource)
+}
+
+// logMissingFiles reports the values files the most recent helmfile load
+// skipped, at the level their missingFileHandler names
+func (d *Daemon) logMissingFiles() {
+	for _, missing := range d.manager.Snapshot().Missing {
+		fields := []zap.Field{zap.String("path", missing.Path), zap.String("release", missing.Release)}
+		switch missing.Handler {
+		case helmstate.MissingFileWarn:
+			d.logger.Warn("skipping missing values file", fields...)
+		case helmstate.MissingFileInfo:
+			d.logger.Info("skipping missing values file", fields...)
+		default:
+			d.logger.Debug("skipping missing values file", fields...)
+		}
+	}
+}
+
+// syncAll syncs every release in the helmfile, continuing past failures
+func (d *Daemon) syncAll(trigger string) {
+	d.syncReleases(trigger, d.manager.GetReleases())
+}
+
+// syncReleases syncs releases phase by phase, continuing past failures
+// within a phase but skipping the phases after a failed one, and records
+// the run in the sync history
+func (d *Daemon) syncReleases(trigger string, releases []helmstate.Release) SyncRun {
+	report := sync.NewReport()
+	ctx, span := tracing.Start(sync.WithSyncID(d.ctx, report.SyncID), "helmfire.sync",
+		tracing.String("sync.id", report.SyncID), tracing.String("sync.trigger", trigger), tracing.Int("releases", len(releases)))
+	announcer := d.syncAnnouncer(report, trigger)
+	announcer.RunStarted(len(releases))
+	failedPhase := ""
+	for _, phase := range d.manager.Phases(releases) {
+		for _, release := range phase.Releases {
+			if failedPhase != "" {
+				report.Skip(release.Name, release.Namespace, fmt.Sprintf("phase %s failed", failedPhase))
+				continue
+			}
+			announcer.ReleaseStarted(release.Name, release.Namespace)
+			start := time.Now()
+			helmRelease, err := d.executor.UpgradeReleaseContext(ctx, release)
+			if err != nil {
+				d.logger.Error("failed to sync release",
+					zap.String("release", release.Name),
+					zap.Error(err))
+			}
+			report.RecordRelease(release.Name, release.Namespace, time.Since(start), helmRelease, err)
+			announcer.ReleaseFinished(report.Results[len(report.Results)-1])
+		}
+		if failedPhase == "" && report.Failed() {
+			failedPhase = phase.Name
+		}
+	}
+	if report.Failed() {
+		span.End(fmt.Errorf("%d release(s) failed", report.Count(sync.ReleaseStatusFailed)+report.Count(sync.ReleaseStatusTimedOut)))
+	} else {
+		span.End(nil)
+	}
+	run := d.recordSyncRun(trigger, report)
+	announcer.RunFinished(report)
+	return run
+}
@@ -0,0 +1,194 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/drift"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"go.uber.org/zap"
+)
+
+// stateVersion is the format of the state file
+const stateVersion = 1
+
+// persistedState is what the daemon keeps across restarts
+type persistedState struct {
+	Version       int                 `json:"version"`
+	SavedAt       time.Time           `json:"savedAt"`
+	Substitutions substitute.Snapshot `json:"substitutions"`
+	DriftHistory  []drift.DriftReport `json:"driftHistory,omitempty"`
+	PendingDrift  []drift.DriftReport `json:"pendingDrift,omitempty"`
+	LastSync      *time.Time          `json:"lastSync,omitempty"`
+	LastSyncError string              `json:"lastSyncError,omitempty"`
+	SyncHistory   []SyncRun           `json:"syncHistory,omitempty"`
+
+	// ValueOverlays are the --set values overlaid on releases through the
+	// API, by release
+	ValueOverlays map[string]map[string]string `json:"valueOverlays,omitempty"`
+
+	// Pause is set while automation is paused, so a restart doesn't resume it
+	Pause *PauseStatus `json:"pause,omitempty"`
+}
+
+// stateStore writes the daemon's state to a file, one save at a time
+type stateStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// ResetState deletes the state saved by the daemon using path, so it starts
+// without substitutions, drift history or sync results
+func ResetState(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to reset daemon state: %w", err)
+	}
+	return nil
+}
+
+// saveState persists the daemon's state; failures are logged so they never
+// fail the change that triggered the save. The state is collected while
+// holding the store's lock, so concurrent saves can't write it out of order.
+func (d *Daemon) saveState() {
+	if d.state == nil {
+		return
+	}
+	d.state.mu.Lock()
+	defer d.state.mu.Unlock()
+	if err := d.state.write(d.currentState()); err != nil {
+		d.logger.Warn("failed to save daemon state", zap.String("stateFile", d.state.path), zap.Error(err))
+	}
+}
+
+// currentState collects the state to persist
+func (d *Daemon) currentState() persistedState {
+	state := persistedState{
+		Version:       stateVersion,
+		SavedAt:       time.Now(),
+		Substitutions: d.substitutor.Export(),
+	}
+	if d.detector != nil {
+		state.DriftHistory = d.detector.Reports()
+		state.PendingDrift = d.detector.PendingReports()
+	}
+	if last := d.lastSyncResult(); !last.time.IsZero() {
+		state.LastSync = &last.time
+		if last.err != nil {
+			state.LastSyncError = last.err.Error()
+		}
+	}
+	state.SyncHistory = d.SyncHistory()
+	if d.manager != nil {
+		state.ValueOverlays = d.manager.Overlays()
+	}
+	if pause := d.PauseStatus(); pause.Paused {
+		state.Pause = &pause
+	}
+	return state
+}
+
+// restoreState loads the state saved before the daemon last stopped.
+// Substitutions that can't be restored, such as ones whose local chart was
+// deleted, are skipped with a warning.
+func (d *Daemon) restoreState() error {
+	state, err := d.state.load()
+	if err != nil || state == nil {
+		return err
+	}
+
+	now := time.Now()
+	restored := 0
+	for _, c := range state.Substitutions.Charts {
+		imported, err := d.substitutor.Import(substitute.Snapshot{Charts: []substitute.SnapshotChart{c}}, now)
+		if err != nil {
+			d.logger.Warn("failed to restore chart substitution", zap.String("original", c.Original), zap.Error(err))
+		}
+		restored += len(imported.Charts)
+	}
+	for _, img := range state.Substitutions.Images {
+		imported, err := d.substitutor.Import(substitute.Snapshot{Images: []substitute.SnapshotImage{img}}, now)
+		if err != nil {
+			d.logger.Warn("failed to restore image substitution", zap.String("original", img.Original), zap.Error(err))
+		}
+		restored += len(imported.Images)
+	}
+
+	if d.detector != nil {
+		d.detector.Restore(state.DriftHistory, state.PendingDrift)
+	}
+
+	for release, values := range state.ValueOverlays {
+		d.manager.SetOverlay(release, values)
+	}
+	d.restorePause(state.Pause)
+
+	d.syncStatus.mu.Lock()
+	if state.LastSync != nil {
+		d.syncStatus.last = syncResult{time: *state.LastSync}
+		if state.LastSyncError != "" {
+			d.syncStatus.last.err = errors.New(state.LastSyncError)
+		}
+	}
+	d.syncStatus.runs = state.SyncHistory
+	d.syncStatus.mu.Unlock()
+
+	d.logger.Info("restored daemon state",
+		zap.String("stateFile", d.state.path),
+		zap.Time("savedAt", state.SavedAt),
+		zap.Int("substitutions", restored),
+		zap.Int("driftReports", len(state.DriftHistory)),
+		zap.Int("syncRuns", len(state.SyncHistory)),
+		zap.Int("valueOverlays", len(state.ValueOverlays)),
+		zap.Bool("paused", d.paused()))
+	return nil
+}
+
+// write writes state to the file, replacing it atomically so a crash never
+// leaves it half written; s.mu must be held
+func (s *stateStore) write(state persistedState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// load reads the saved state, returning nil when there is none
+func (s *stateStore) load() (*persistedState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var state persistedState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %w", s.path, err)
+	}
+	if state.Version > stateVersion {
+		return nil, fmt.Errorf("state file %s was written by a newer helmfire (version %d)", s.path, state.Version)
+	}
+	return &state, nil
+}
@@ -0,0 +1,125 @@
+package daemon
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/drift"
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"go.uber.org/zap"
+)
+
+func newStateTestDaemon(stateFile string) *Daemon {
+	manager := helmstate.NewManager("", "")
+	return &Daemon{
+		logger:      zap.NewNop(),
+		substitutor: substitute.NewManager(),
+		manager:     manager,
+		detector:    drift.NewDetector(manager, time.Minute, zap.NewNop()),
+		state:       &stateStore{path: stateFile},
+	}
+}
+
+func TestStateSurvivesRestart(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "project", "state.json")
+
+	d := newStateTestDaemon(stateFile)
+	d.substitutor.AddImageSubstitution("nginx:1.21", "nginx:dev")
+	d.substitutor.AddScopedImageSubstitution("redis:7", "redis:dev", substitute.Scope{Release: "cache"})
+	d.substitutor.SetImageTTL("redis:7", substitute.Scope{Release: "cache"}, time.Hour)
+	d.detector.Restore(
+		[]drift.DriftReport{{ID: "r1", ReleaseName: "nginx", Severity: drift.SeverityHigh}},
+		[]drift.DriftReport{{ID: "r2", ReleaseName: "api", PendingApproval: true}},
+	)
+	d.manager.SetOverlay("api", map[string]string{"features.beta": "true"})
+	d.recordSyncRun(TriggerHeal, syncReport("api", errors.New("upgrade failed")))
+
+	restarted := newStateTestDaemon(stateFile)
+	if err := restarted.restoreState(); err != nil {
+		t.Fatal(err)
+	}
+
+	if replacement, ok := restarted.substitutor.GetImageReplacement("nginx:1.21"); !ok || replacement != "nginx:dev" {
+		t.Errorf("expected image substitution to be restored, got %q %v", replacement, ok)
+	}
+	images := restarted.substitutor.ListImageSubstitutions()
+	if len(images) != 2 {
+		t.Fatalf("expected 2 image substitutions, got %+v", images)
+	}
+	for _, img := range images {
+		if img.Original == "redis:7" && (img.Scope.Release != "cache" || img.ExpiresAt.IsZero()) {
+			t.Errorf("expected scope and expiry to be restored, got %+v", img)
+		}
+	}
+
+	if reports := restarted.detector.Reports(); len(reports) != 1 || reports[0].ID != "r1" {
+		t.Errorf("expected drift history to be restored, got %+v", reports)
+	}
+	if pending := restarted.detector.PendingReports(); len(pending) != 1 || pending[0].ID != "r2" {
+		t.Errorf("expected pending drift to be restored, got %+v", pending)
+	}
+	if last := restarted.lastSyncResult(); last.time.IsZero() || last.err == nil || last.err.Error() != "failed to sync api" {
+		t.Errorf("expected last sync to be restored, got %+v", last)
+	}
+	if runs := restarted.SyncHistory(); len(runs) != 1 || runs[0].Trigger != TriggerHeal || len(runs[0].Substitutions.Images) != 2 {
+		t.Errorf("expected sync history to be restored, got %+v", runs)
+	}
+	if overlay := restarted.manager.Overlay("api"); overlay["features.beta"] != "true" {
+		t.Errorf("expected value overlay to be restored, got %+v", overlay)
+	}
+}
+
+func TestRestoreStateSkipsBrokenSubstitutions(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	store := &stateStore{path: stateFile}
+	expired := time.Now().Add(-time.Minute)
+	store.write(persistedState{
+		Version: stateVersion,
+		Substitutions: substitute.Snapshot{
+			Charts: []substitute.SnapshotChart{{Original: "bitnami/nginx", Path: filepath.Join(t.TempDir(), "deleted")}},
+			Images: []substitute.SnapshotImage{
+				{Original: "old:1", Replacement: "old:dev", ExpiresAt: &expired},
+				{Original: "nginx:1.21", Replacement: "nginx:dev"},
+			},
+		},
+	})
+
+	d := newStateTestDaemon(stateFile)
+	if err := d.restoreState(); err != nil {
+		t.Fatal(err)
+	}
+	if charts := d.substitutor.ListChartSubstitutions(); len(charts) != 0 {
+		t.Errorf("expected the chart with a deleted path to be skipped, got %+v", charts)
+	}
+	if images := d.substitutor.ListImageSubstitutions(); len(images) != 1 || images[0].Original != "nginx:1.21" {
+		t.Errorf("expected only the unexpired image substitution, got %+v", images)
+	}
+}
+
+func TestRestoreStateWithoutFile(t *testing.T) {
+	d := newStateTestDaemon(filepath.Join(t.TempDir(), "state.json"))
+	if err := d.restoreState(); err != nil {
+		t.Errorf("expected a missing state file to be no error, got %v", err)
+	}
+}
+
+func TestResetState(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	d := newStateTestDaemon(stateFile)
+	d.substitutor.AddImageSubstitution("nginx:1.21", "nginx:dev")
+	d.saveState()
+
+	if err := ResetState(stateFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stateFile); !os.IsNotExist(err) {
+		t.Errorf("expected state file to be removed, got %v", err)
+	}
+	if err := ResetState(stateFile); err != nil {
+		t.Errorf("expected resetting without state to succeed, got %v", err)
+	}
+}
@@ -0,0 +1,225 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// EnvSupervisorRestarts is set in the environment of a daemon run by a
+// supervisor to the number of times it has been restarted
+const EnvSupervisorRestarts = "HELMFIRE_SUPERVISOR_RESTARTS"
+
+const (
+	// DefaultMinBackoff is the delay before the first restart after a crash
+	DefaultMinBackoff = time.Second
+
+	// DefaultMaxBackoff caps the delay between restarts, which doubles with
+	// each crash in a row
+	DefaultMaxBackoff = time.Minute
+
+	// DefaultStableAfter is how long the daemon must run before a crash
+	// counts as a new one rather than one more in a row
+	DefaultStableAfter = time.Minute
+
+	// crashOutputLimit is how much of the daemon's last output is searched
+	// for the panic that crashed it
+	crashOutputLimit = 64 * 1024
+)
+
+// SupervisorConfig configures a Supervisor
+type SupervisorConfig struct {
+	// Command runs the daemon: the executable followed by its arguments
+	Command []string
+
+	// LogFile receives the daemon's output, including the stack of a panic
+	// that crashed it, and a note of each restart
+	LogFile string
+
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+	StableAfter time.Duration
+}
+
+// Supervisor runs the daemon as a child process and restarts it when it
+// crashes, waiting longer after each crash in a row
+type Supervisor struct {
+	config SupervisorConfig
+	logger *zap.Logger
+
+	restarts int
+}
+
+// NewSupervisor creates a supervisor
+func NewSupervisor(config SupervisorConfig, logger *zap.Logger) *Supervisor {
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = DefaultMinBackoff
+	}
+	if config.MaxBackoff < config.MinBackoff {
+		config.MaxBackoff = max(DefaultMaxBackoff, config.MinBackoff)
+	}
+	if config.StableAfter <= 0 {
+		config.StableAfter = DefaultStableAfter
+	}
+	return &Supervisor{config: config, logger: logger}
+}
+
+// Restarts returns how often the daemon has been restarted
+func (s *Supervisor) Restarts() int {
+	return s.restarts
+}
+
+// Run runs the daemon until it exits cleanly or ctx is done, in which case
+// the daemon is asked to stop first
+func (s *Supervisor) Run(ctx context.Context) error {
+	if len(s.config.Command) == 0 {
+		return fmt.Errorf("no daemon command to supervise")
+	}
+
+	backoff := s.config.MinBackoff
+	for {
+		started := time.Now()
+		output, err := s.runOnce(ctx)
+		if err == nil || ctx.Err() != nil {
+			return nil
+		}
+		if _, ok := err.(*exec.ExitError); !ok {
+			return fmt.Errorf("failed to run daemon: %w", err)
+		}
+
+		// A daemon that ran for a while crashed afresh rather than in a loop
+		if time.Since(started) >= s.config.StableAfter {
+			backoff = s.config.MinBackoff
+		}
+
+		reason := err.Error()
+		if panicked := panicMessage(output); panicked != "" {
+			reason += ": " + panicked
+		}
+		s.logger.Warn("daemon crashed, restarting",
+			zap.String("reason", reason),
+			zap.Int("restarts", s.restarts),
+			zap.Duration("backoff", backoff))
+		s.reportCrash(reason, backoff)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		s.restarts++
+		backoff = min(backoff*2, s.config.MaxBackoff)
+	}
+}
+
+// runOnce runs the daemon until it exits, returning the tail of its output
+func (s *Supervisor) runOnce(ctx context.Context) ([]byte, error) {
+	cmd := exec.Command(s.config.Command[0], s.config.Command[1:]...)
+	cmd.Env = append(os.Environ(), EnvSupervisorRestarts+"="+strconv.Itoa(s.restarts))
+	cmd.Stdin = os.Stdin
+
+	tail := &tailBuffer{limit: crashOutputLimit}
+	stdout := []io.Writer{os.Stdout}
+	stderr := []io.Writer{os.Stderr, tail}
+	if s.config.LogFile != "" {
+		if log, err := openLogFile(s.config.LogFile); err != nil {
+			s.logger.Warn("failed to open daemon log file", zap.String("logFile", s.config.LogFile), zap.Error(err))
+		} else {
+			defer log.Close()
+			stdout = append(stdout, log)
+			stderr = append(stderr, log)
+		}
+	}
+	cmd.Stdout = io.MultiWriter(stdout...)
+	cmd.Stderr = io.MultiWriter(stderr...)
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		return tail.Bytes(), err
+	case <-ctx.Done():
+		terminateProcess(cmd.Process)
+		return tail.Bytes(), <-done
+	}
+}
+
+// reportCrash notes a crash in the log file, below the output of the
+// daemon that crashed
+func (s *Supervisor) reportCrash(reason string, backoff time.Duration) {
+	if s.config.LogFile == "" {
+		return
+	}
+	log, err := openLogFile(s.config.LogFile)
+	if err != nil {
+		s.logger.Warn("failed to write crash report", zap.String("logFile", s.config.LogFile), zap.Error(err))
+		return
+	}
+	defer log.Close()
+
+	fmt.Fprintf(log, "%s\thelmfire supervisor: daemon crashed (%s), restart %d in %s\n",
+		time.Now().Format(time.RFC3339), reason, s.restarts+1, backoff)
+}
+
+// panicMessage returns the first line of the last panic in output
+func panicMessage(output []byte) string {
+	i := bytes.LastIndex(output, []byte("panic: "))
+	if i < 0 {
+		return ""
+	}
+	line, _, _ := strings.Cut(string(output[i:]), "\n")
+	return strings.TrimSpace(line)
+}
+
+func openLogFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+}
+
+// SupervisedRestarts reports whether this process runs under a supervisor
+// and how often it has restarted the daemon
+func SupervisedRestarts() (int, bool) {
+	value, ok := os.LookupEnv(EnvSupervisorRestarts)
+	if !ok {
+		return 0, false
+	}
+	restarts, _ := strconv.Atoi(value)
+	return restarts, true
+}
+
+// tailBuffer keeps the last limit bytes written to it
+type tailBuffer struct {
+	mu    sync.Mutex
+	limit int
+	buf   []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.buf = append(t.buf, p...)
+	if over := len(t.buf) - t.limit; over > 0 {
+		t.buf = append(t.buf[:0], t.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) Bytes() []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]byte(nil), t.buf...)
+}
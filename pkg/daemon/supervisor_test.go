@@ -0,0 +1,93 @@
+package daemon
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var helperCommand = []string{os.Args[0], "-test.run=^TestSupervisorHelperProcess$"}
+
+// TestSupervisorHelperProcess is the supervised child of the supervisor
+// tests: it runs until stopped, or panics until it has been restarted twice
+// and then exits cleanly
+func TestSupervisorHelperProcess(t *testing.T) {
+	switch os.Getenv("HELMFIRE_TEST_SUPERVISED") {
+	case "crash":
+	case "block":
+		select {}
+	default:
+		t.Skip("run by the supervisor tests")
+	}
+	if restarts, _ := SupervisedRestarts(); restarts < 2 {
+		// Outside the test goroutine, so the testing package can't recover it
+		go panic("daemon exploded")
+		select {}
+	}
+	os.Exit(0)
+}
+
+func TestSupervisorRestartsOnCrash(t *testing.T) {
+	t.Setenv("HELMFIRE_TEST_SUPERVISED", "crash")
+	logFile := filepath.Join(t.TempDir(), "daemon.log")
+
+	supervisor := NewSupervisor(SupervisorConfig{
+		Command:    helperCommand,
+		LogFile:    logFile,
+		MinBackoff: time.Millisecond,
+		MaxBackoff: 2 * time.Millisecond,
+	}, zap.NewNop())
+
+	if err := supervisor.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if supervisor.Restarts() != 2 {
+		t.Errorf("expected 2 restarts, got %d", supervisor.Restarts())
+	}
+
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := string(data)
+	if strings.Count(log, "panic: daemon exploded") < 2 || !strings.Contains(log, "goroutine ") {
+		t.Errorf("expected the panic stacks in the log, got:\n%s", log)
+	}
+	if !strings.Contains(log, "daemon crashed (exit status 2: panic: daemon exploded), restart 2") {
+		t.Errorf("expected restarts to be noted in the log, got:\n%s", log)
+	}
+}
+
+func TestSupervisorStopsOnCancel(t *testing.T) {
+	t.Setenv("HELMFIRE_TEST_SUPERVISED", "block")
+	ctx, cancel := context.WithCancel(context.Background())
+	supervisor := NewSupervisor(SupervisorConfig{Command: helperCommand}, zap.NewNop())
+
+	done := make(chan error, 1)
+	go func() { done <- supervisor.Run(ctx) }()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil || supervisor.Restarts() != 0 {
+			t.Errorf("expected a clean stop without restarts, got %v after %d restarts", err, supervisor.Restarts())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("supervisor didn't stop the daemon")
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	tail := &tailBuffer{limit: 5}
+	tail.Write([]byte("abc"))
+	tail.Write([]byte("defg"))
+	if got := string(tail.Bytes()); got != "cdefg" {
+		t.Errorf("expected the last 5 bytes, got %q", got)
+	}
+}
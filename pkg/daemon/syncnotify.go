@@ -0,0 +1,30 @@
+package daemon
+
+import (
+	gosync "sync"
+
+	"github.com/oleksiyp/helmfire/pkg/drift"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+)
+
+// syncNotify holds the notifiers sent sync events, replaced when the
+// configuration is reloaded
+type syncNotify struct {
+	mu        gosync.RWMutex
+	notifiers []drift.SyncNotifier
+}
+
+func (s *syncNotify) set(notifiers []drift.SyncNotifier) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notifiers = notifiers
+}
+
+// syncAnnouncer returns the announcer of a sync run to the notifiers
+// configured with events: [sync], nil when there are none
+func (d *Daemon) syncAnnouncer(report *sync.Report, trigger string) *drift.SyncAnnouncer {
+	d.syncNotify.mu.RLock()
+	notifiers := d.syncNotify.notifiers
+	d.syncNotify.mu.RUnlock()
+	return drift.NewSyncAnnouncer(notifiers, report, trigger, d.logger)
+}
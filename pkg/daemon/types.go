@@ -5,38 +5,200 @@ import (
 	"os"
 	"time"
 
+	"github.com/oleksiyp/helmfire/pkg/audit"
+	"github.com/oleksiyp/helmfire/pkg/deploystatus"
 	"github.com/oleksiyp/helmfire/pkg/drift"
 	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/leader"
+	"github.com/oleksiyp/helmfire/pkg/policy"
+	"github.com/oleksiyp/helmfire/pkg/rendercache"
 	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"github.com/oleksiyp/helmfire/pkg/sync"
 	"go.uber.org/zap"
 )
 
 // Daemon manages background helmfire process
 type Daemon struct {
-	pidFile      string
-	logFile      string
-	apiAddr      string
-	apiServer    *APIServer
-	substitutor  *substitute.Manager
-	manager      *helmstate.Manager
-	detector     *drift.Detector
-	logger       *zap.Logger
-	ctx          context.Context
-	cancel       context.CancelFunc
-	shutdownCh   chan os.Signal
-	startTime    time.Time
+	pidFile     string
+	logFile     string
+	apiAddr     string
+	apiServer   *APIServer
+	substitutor *substitute.Manager
+	manager     *helmstate.Manager
+	executor    *sync.Executor
+	renderCache *rendercache.Cache
+	detector    *drift.Detector
+	logger      *zap.Logger
+	ctx         context.Context
+	cancel      context.CancelFunc
+	shutdownCh  chan os.Signal
+	startTime   time.Time
+	elector     *leader.Elector
+	electorDone chan struct{}
+
+	source         HelmfileSource
+	sourceDir      string
+	sourceInterval time.Duration
+
+	resyncOnExpiry bool
+
+	audit *audit.Log
+
+	apiMiddleware MiddlewareConfig
+	supervised    bool
+	restarts      int
+	command       []string
+
+	readiness  *readiness
+	kubeAuth   *kubeAuth
+	syncStatus syncStatus
+	state      *stateStore
+	events     eventHub
+	forwarder  *eventForwarder
+	syncNotify syncNotify
+	// deployStatus reports sync runs to GitHub or GitLab; nil when off
+	deployStatus *deploystatus.Reporter
+	reloader     reloader
+	pause        pause
+	access       accessControl
 }
 
 // DaemonConfig configures the daemon
 type DaemonConfig struct {
-	PIDFile         string
-	LogFile         string
-	APIAddr         string
-	HelmfilePath    string
-	Environment     string
-	DriftInterval   time.Duration
-	DriftAutoHeal   bool
-	DriftWebhook    string
+	PIDFile       string
+	LogFile       string
+	APIAddr       string
+	HelmfilePath  string
+	ExtraPaths    []string // more helmfiles or directories merged after HelmfilePath
+	Environment   string
+	DriftInterval time.Duration
+	DriftAutoHeal bool
+	DriftWebhook  string
+	DriftOrphans  bool
+	DriftJitter   float64
+	DriftStagger  bool
+	DriftFlap     time.Duration // how long drift must stay gone to be resolved
+	DriftContext  int           // unchanged lines around changes in drift diffs; whole resources when 0
+	DriftWorkers  int           // releases diffed at once; drift.DefaultWorkers when 0
+	// OfflineCharts, when set, is the directory remote charts are taken
+	// from instead of their repositories, which aren't synced
+	OfflineCharts string
+	// NamespaceTemplate rewrites the namespace of every release; see
+	// helmstate.Manager.NamespaceTemplate
+	NamespaceTemplate string
+	// ReleasePrefix is prepended to the name of every release; see
+	// helmstate.Manager.ReleasePrefix
+	ReleasePrefix string
+	// RenderCacheSize is how many chart renders drift prechecks and syncs
+	// share; every render runs helm when 0
+	RenderCacheSize int
+	// CloudEventsSink, when set, receives the daemon's events as
+	// CloudEvents: an http(s) URL they are posted to, or nats:// servers
+	// they are published to on CloudEventsSubject. CloudEventsSource is
+	// their source, /helmfire/<hostname> when empty; CloudEventsTypes limits
+	// the event types sent.
+	CloudEventsSink    string
+	CloudEventsSubject string
+	CloudEventsSource  string
+	CloudEventsTypes   []string
+	// DeployStatus, when set, reports each sync run as a commit status,
+	// and optionally a deployment, of the helmfile's git revision
+	DeployStatus *deploystatus.Config
+	// DisableDriftPrecheck diffs every release checked for drift, instead
+	// of only those whose stored and rendered manifests differ
+	DisableDriftPrecheck bool
+	HealPolicy           drift.HealPolicy
+	HealPreview          bool
+	Prune                bool
+	HelmBinary           string
+	Notifiers            []drift.NotifierConfig
+
+	// SubstitutionProviders are asked for chart and image substitutions at
+	// sync time, after those added through the API
+	SubstitutionProviders []substitute.ProviderConfig
+
+	// Leader election lets several daemons share a cluster; only the
+	// instance holding the lease syncs and heals
+	LeaderElection          bool
+	LeaderElectionNamespace string
+	LeaderElectionLease     string
+	LeaderElectionIdentity  string
+
+	// HelmfileSource, when set, replaces HelmfilePath; it is polled every
+	// SourceInterval and changes are synced
+	HelmfileSource HelmfileSource
+	SourceInterval time.Duration
+
+	// ResyncOnExpiry resyncs the affected releases when a substitution's
+	// TTL passes, restoring the original chart or image
+	ResyncOnExpiry bool
+
+	// AuditLogFile records who added, removed or expired each substitution
+	AuditLogFile string
+
+	// API middleware: per-client rate limiting in requests per second with
+	// bursts of APIRateBurst (0 disables it), and the browser origins
+	// allowed by CORS
+	APIRateLimit   float64
+	APIRateBurst   int
+	APICORSOrigins []string
+
+	// APIAccess restricts the API to the callers holding its tokens, and
+	// their changes to the releases in their scopes; nil leaves the API open
+	APIAccess *AccessPolicy
+
+	// StateFile keeps substitutions, drift reports and the last sync result
+	// across restarts
+	StateFile string
+
+	// Stamp labels and annotates the resources of synced releases
+	Stamp sync.Stamp
+
+	// ResourceProfile scales down the resources and replicas of workloads;
+	// as rendered when nil
+	ResourceProfile *sync.ResourceProfile
+
+	// Policy checks the rendered manifests of each release before it is
+	// synced or healed
+	Policy policy.Checker
+
+	// DisableCreateNamespace stops release namespaces from being created
+	// when missing, unless a release sets createNamespace
+	DisableCreateNamespace bool
+
+	// VerifyNamespaces fails releases whose namespace doesn't exist or lacks
+	// the labels declared in the helmfile
+	VerifyNamespaces bool
+
+	// StrictHelmfile rejects helmfiles with unknown fields or mistyped
+	// values, also when they are reloaded
+	StrictHelmfile bool
+
+	// Supervised is set when a supervisor runs the daemon, having restarted
+	// it Restarts times after crashes
+	Supervised bool
+	Restarts   int
+
+	// Command is the executable and arguments that start the daemon again
+	// with this configuration, recorded for 'helmfire daemon restart'
+	Command []string
+
+	// Reload rebuilds the configuration when the daemon reloads it on
+	// SIGHUP or through the API; the daemon applies its notifiers, drift
+	// interval, helmfile paths and API access policy. Without it, reloads
+	// fail.
+	Reload ReloadFunc
+}
+
+// ConfigReloadResponse describes the configuration a reload applied
+type ConfigReloadResponse struct {
+	Message       string   `json:"message"`
+	Notifiers     int      `json:"notifiers"`
+	DriftInterval string   `json:"driftInterval,omitempty"`
+	Files         []string `json:"files"`
+
+	// Warnings list the changes only a restart applies
+	Warnings []string `json:"warnings,omitempty"`
 }
 
 // Status represents daemon status
@@ -46,10 +208,29 @@ type Status struct {
 	Uptime              string    `json:"uptime,omitempty"`
 	StartTime           time.Time `json:"startTime,omitempty"`
 	LastSync            time.Time `json:"lastSync,omitempty"`
+	LastSyncError       string    `json:"lastSyncError,omitempty"`
 	ActiveSubstitutions struct {
 		Charts int `json:"charts"`
 		Images int `json:"images"`
 	} `json:"activeSubstitutions"`
+	Leader bool `json:"leader"`
+
+	// Releases are the outcomes of the last sync of each release
+	Releases []sync.ReleaseResult `json:"releases,omitempty"`
+
+	// Supervised daemons report how often their supervisor restarted them
+	Supervised bool `json:"supervised,omitempty"`
+	Restarts   int  `json:"restarts,omitempty"`
+
+	// Drift describes the drift sweeps so far, when drift is detected
+	Drift *drift.SweepMetrics `json:"drift,omitempty"`
+
+	// Pause is set while automation is paused
+	Pause *PauseStatus `json:"pause,omitempty"`
+
+	// SpecGeneration counts the loads of the helmfile, so clients can tell
+	// when the releases changed
+	SpecGeneration uint64 `json:"specGeneration,omitempty"`
 }
 
 // SubstitutionsResponse represents API response for substitutions
@@ -58,38 +239,123 @@ type SubstitutionsResponse struct {
 	Images []ImageSubstitution `json:"images"`
 }
 
+// ChartsResponse represents API response for chart substitutions
+type ChartsResponse struct {
+	Charts []ChartSubstitution `json:"charts"`
+}
+
+// ImagesResponse represents API response for image substitutions
+type ImagesResponse struct {
+	Images []ImageSubstitution `json:"images"`
+}
+
+// ImportRequest restores a substitution snapshot. With Replace, existing
+// substitutions are removed first.
+type ImportRequest struct {
+	Substitutions substitute.Snapshot `json:"substitutions"`
+	Replace       bool                `json:"replace,omitempty"`
+}
+
+// ImportResponse reports how many substitutions were imported
+type ImportResponse struct {
+	Message string `json:"message"`
+	Charts  int    `json:"charts"`
+	Images  int    `json:"images"`
+	Removed int    `json:"removed,omitempty"`
+}
+
+// AuditResponse lists substitution audit log entries, oldest first
+type AuditResponse struct {
+	Entries []audit.Entry `json:"entries"`
+}
+
 // ChartSubstitution represents a chart override
 type ChartSubstitution struct {
-	Original  string `json:"original"`
-	LocalPath string `json:"localPath"`
+	Original  string     `json:"original"`
+	LocalPath string     `json:"localPath"`
+	Source    string     `json:"source,omitempty"`
+	Release   string     `json:"release,omitempty"`
+	Namespace string     `json:"namespace,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
 }
 
 // ImageSubstitution represents an image override
 type ImageSubstitution struct {
-	Original    string `json:"original"`
-	Replacement string `json:"replacement"`
+	Original    string     `json:"original"`
+	Replacement string     `json:"replacement"`
+	Release     string     `json:"release,omitempty"`
+	Namespace   string     `json:"namespace,omitempty"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
 }
 
-// AddChartRequest represents request to add chart substitution
+// AddChartRequest represents request to add chart substitution. Release and
+// Namespace limit the substitution to matching releases.
 type AddChartRequest struct {
 	Original  string `json:"original"`
 	LocalPath string `json:"localPath"`
+	Release   string `json:"release,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	// TTL is a duration such as "2h" after which the substitution expires
+	TTL string `json:"ttl,omitempty"`
+	// Strict rejects the substitution when the compatibility check warns
+	Strict bool `json:"strict,omitempty"`
+}
+
+// AddChartResponse represents response to adding a chart substitution
+type AddChartResponse struct {
+	Message  string   `json:"message"`
+	Warnings []string `json:"warnings,omitempty"`
 }
 
-// AddImageRequest represents request to add image substitution
+// AddImageRequest represents request to add image substitution. Release and
+// Namespace limit the substitution to matching releases; TTL is a duration
+// such as "2h" after which it expires.
 type AddImageRequest struct {
 	Original    string `json:"original"`
 	Replacement string `json:"replacement"`
+	Release     string `json:"release,omitempty"`
+	Namespace   string `json:"namespace,omitempty"`
+	TTL         string `json:"ttl,omitempty"`
 }
 
 // RemoveChartRequest represents request to remove chart substitution
 type RemoveChartRequest struct {
-	Original string `json:"original"`
+	Original  string `json:"original"`
+	Release   string `json:"release,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
 }
 
 // RemoveImageRequest represents request to remove image substitution
 type RemoveImageRequest struct {
-	Original string `json:"original"`
+	Original  string `json:"original"`
+	Release   string `json:"release,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// BulkRequest adds and removes several substitutions in one all-or-nothing
+// transaction. Removals are applied before additions.
+type BulkRequest struct {
+	Add    BulkAdd    `json:"add"`
+	Remove BulkRemove `json:"remove"`
+}
+
+// BulkAdd lists the substitutions a bulk request adds
+type BulkAdd struct {
+	Charts []AddChartRequest `json:"charts,omitempty"`
+	Images []AddImageRequest `json:"images,omitempty"`
+}
+
+// BulkRemove lists the substitutions a bulk request removes
+type BulkRemove struct {
+	Charts []RemoveChartRequest `json:"charts,omitempty"`
+	Images []RemoveImageRequest `json:"images,omitempty"`
+}
+
+// BulkResponse represents response to a bulk request, with compatibility
+// warnings for the added charts
+type BulkResponse struct {
+	Message  string   `json:"message"`
+	Warnings []string `json:"warnings,omitempty"`
 }
 
 // SyncRequest represents request to trigger sync
@@ -98,9 +364,100 @@ type SyncRequest struct {
 	DryRun   bool     `json:"dryRun"`
 }
 
-// ErrorResponse represents API error response
+// ValuesOverlayRequest merges --set style values, such as
+// "features.beta": "true", into the value overlay of a release
+type ValuesOverlayRequest struct {
+	Values map[string]string `json:"values"`
+}
+
+// ValuesOverlayResponse represents the value overlay of a release, applied
+// from its next sync; Values is empty once cleared
+type ValuesOverlayResponse struct {
+	Release string            `json:"release"`
+	Values  map[string]string `json:"values,omitempty"`
+}
+
+// DriftCheckRequest represents request to run an immediate drift check
+type DriftCheckRequest struct {
+	Release string `json:"release,omitempty"`
+}
+
+// DriftCheckResponse represents the reports from an immediate drift check
+type DriftCheckResponse struct {
+	Reports []drift.DriftReport `json:"reports"`
+}
+
+// DriftListResponse represents drift reports held by the detector
+type DriftListResponse struct {
+	Pending []drift.DriftReport `json:"pending"`
+	Recent  []drift.DriftReport `json:"recent"`
+}
+
+// PauseRequest pauses the daemon's automation, for Duration or until
+// resumed when it is empty
+type PauseRequest struct {
+	Duration string `json:"duration,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// DriftConfigRequest changes drift settings of the running daemon; unset
+// fields are left alone. Releases maps release names to whether they are
+// checked periodically.
+type DriftConfigRequest struct {
+	Interval string          `json:"interval,omitempty"`
+	AutoHeal *bool           `json:"autoHeal,omitempty"`
+	Releases map[string]bool `json:"releases,omitempty"`
+}
+
+// DriftConfigResponse represents the drift settings of the running daemon
+type DriftConfigResponse struct {
+	Interval         string   `json:"interval"`
+	AutoHeal         bool     `json:"autoHeal"`
+	DisabledReleases []string `json:"disabledReleases"`
+}
+
+// DriftHealResponse represents the result of an approved heal
+type DriftHealResponse struct {
+	Report drift.DriftReport `json:"report"`
+}
+
+// HealReleaseRequest represents request to heal (or preview healing) a release
+type HealReleaseRequest struct {
+	Release string `json:"release"`
+	DryRun  bool   `json:"dryRun"`
+}
+
+// HealReleaseResponse represents the result of a release heal
+type HealReleaseResponse struct {
+	Release string `json:"release"`
+	DryRun  bool   `json:"dryRun"`
+	Changes string `json:"changes,omitempty"`
+}
+
+// RollbackRequest represents request to roll back a release to a revision,
+// or with All every release to the revision before the last helmfire sync.
+// Without a revision a single release also goes back to before that sync.
+type RollbackRequest struct {
+	Release  string `json:"release,omitempty"`
+	Revision int    `json:"revision,omitempty"`
+	All      bool   `json:"all,omitempty"`
+	DryRun   bool   `json:"dryRun"`
+}
+
+// RollbackResponse represents the planned rollback and, unless it was a dry
+// run, the sync run recording it
+type RollbackResponse struct {
+	Steps  []sync.RollbackStep `json:"steps"`
+	DryRun bool                `json:"dryRun"`
+	Run    *SyncRun            `json:"run,omitempty"`
+}
+
+// ErrorResponse represents API error response. Code is one of the Code*
+// constants; Fields lists the problems of a request that failed validation.
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error  string       `json:"error"`
+	Code   string       `json:"code,omitempty"`
+	Fields []FieldError `json:"fields,omitempty"`
 }
 
 // SuccessResponse represents API success response
@@ -0,0 +1,220 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+)
+
+// decodeRequest decodes a JSON request body into v
+func decodeRequest(r *http.Request, v interface{}) error {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("request body is empty")
+	}
+	return err
+}
+
+// Validate checks an add chart request
+func (req AddChartRequest) Validate() error {
+	v := &validator{}
+	req.validate(v, "")
+	return v.err()
+}
+
+func (req AddChartRequest) validate(v *validator, prefix string) {
+	v.require(prefix+"original", req.Original)
+	if v.require(prefix+"localPath", req.LocalPath) && substitute.IsLocalChartPath(req.LocalPath) && !filepath.IsAbs(req.LocalPath) {
+		v.check(prefix+"localPath", fmt.Errorf("must be an absolute path, a chart URL or a git:: URL"))
+	}
+	validateScope(v, prefix, req.Release, req.Namespace)
+	v.check(prefix+"ttl", validateTTL(req.TTL))
+}
+
+// Validate checks an add image request
+func (req AddImageRequest) Validate() error {
+	v := &validator{}
+	req.validate(v, "")
+	return v.err()
+}
+
+func (req AddImageRequest) validate(v *validator, prefix string) {
+	if v.require(prefix+"original", req.Original) {
+		v.check(prefix+"original", substitute.ValidateImageReference(req.Original))
+	}
+	if v.require(prefix+"replacement", req.Replacement) {
+		v.check(prefix+"replacement", substitute.ValidateImageReference(req.Replacement))
+	}
+	validateScope(v, prefix, req.Release, req.Namespace)
+	v.check(prefix+"ttl", validateTTL(req.TTL))
+}
+
+// Validate checks a remove chart request
+func (req RemoveChartRequest) Validate() error {
+	v := &validator{}
+	req.validate(v, "")
+	return v.err()
+}
+
+func (req RemoveChartRequest) validate(v *validator, prefix string) {
+	v.require(prefix+"original", req.Original)
+	validateScope(v, prefix, req.Release, req.Namespace)
+}
+
+// Validate checks a remove image request
+func (req RemoveImageRequest) Validate() error {
+	v := &validator{}
+	req.validate(v, "")
+	return v.err()
+}
+
+func (req RemoveImageRequest) validate(v *validator, prefix string) {
+	v.require(prefix+"original", req.Original)
+	validateScope(v, prefix, req.Release, req.Namespace)
+}
+
+// Validate checks every change of a bulk request
+func (req BulkRequest) Validate() error {
+	v := &validator{}
+	for i, c := range req.Add.Charts {
+		c.validate(v, fmt.Sprintf("add.charts[%d].", i))
+		if c.Strict {
+			v.check(fmt.Sprintf("add.charts[%d].strict", i), fmt.Errorf("is not supported in bulk requests"))
+		}
+	}
+	for i, img := range req.Add.Images {
+		img.validate(v, fmt.Sprintf("add.images[%d].", i))
+	}
+	for i, c := range req.Remove.Charts {
+		c.validate(v, fmt.Sprintf("remove.charts[%d].", i))
+	}
+	for i, img := range req.Remove.Images {
+		img.validate(v, fmt.Sprintf("remove.images[%d].", i))
+	}
+	if len(req.Add.Charts)+len(req.Add.Images)+len(req.Remove.Charts)+len(req.Remove.Images) == 0 {
+		v.check("add", fmt.Errorf("at least one substitution must be added or removed"))
+	}
+	return v.err()
+}
+
+// Validate checks the substitutions of an import request
+func (req ImportRequest) Validate() error {
+	v := &validator{}
+	for i, c := range req.Substitutions.Charts {
+		prefix := fmt.Sprintf("substitutions.charts[%d].", i)
+		v.require(prefix+"original", c.Original)
+		if v.require(prefix+"path", c.Path) && substitute.IsLocalChartPath(c.Path) && !filepath.IsAbs(c.Path) {
+			v.check(prefix+"path", fmt.Errorf("must be an absolute path, a chart URL or a git:: URL"))
+		}
+		validateScope(v, prefix, c.Release, c.Namespace)
+	}
+	for i, img := range req.Substitutions.Images {
+		prefix := fmt.Sprintf("substitutions.images[%d].", i)
+		if v.require(prefix+"original", img.Original) {
+			v.check(prefix+"original", substitute.ValidateImageReference(img.Original))
+		}
+		if v.require(prefix+"replacement", img.Replacement) {
+			v.check(prefix+"replacement", substitute.ValidateImageReference(img.Replacement))
+		}
+		validateScope(v, prefix, img.Release, img.Namespace)
+	}
+	return v.err()
+}
+
+// Validate checks a heal release request
+func (req HealReleaseRequest) Validate() error {
+	v := &validator{}
+	v.require("release", req.Release)
+	return v.err()
+}
+
+// Validate checks a rollback request
+func (req RollbackRequest) Validate() error {
+	v := &validator{}
+	switch {
+	case req.All && req.Release != "":
+		v.check("release", fmt.Errorf("must be empty with all"))
+	case req.All && req.Revision != 0:
+		v.check("revision", fmt.Errorf("must be empty with all"))
+	case !req.All:
+		v.require("release", req.Release)
+	}
+	if req.Revision < 0 {
+		v.check("revision", fmt.Errorf("must be positive"))
+	}
+	return v.err()
+}
+
+// Validate checks a sync request
+func (req SyncRequest) Validate() error {
+	v := &validator{}
+	for i, release := range req.Releases {
+		v.require(fmt.Sprintf("releases[%d]", i), release)
+	}
+	return v.err()
+}
+
+// Validate checks a values overlay request
+func (req ValuesOverlayRequest) Validate() error {
+	v := &validator{}
+	if len(req.Values) == 0 {
+		v.check("values", fmt.Errorf("is required"))
+	}
+	for _, name := range sortedKeys(req.Values) {
+		if strings.TrimSpace(name) == "" || strings.ContainsAny(name, "=,") {
+			v.check("values", fmt.Errorf("invalid value name %q", name))
+		}
+	}
+	return v.err()
+}
+
+// Validate checks a pause request
+func (req PauseRequest) Validate() error {
+	v := &validator{}
+	if _, err := parseTTL(req.Duration); err != nil {
+		v.check("duration", fmt.Errorf("must be a positive duration such as 30m"))
+	}
+	return v.err()
+}
+
+// Validate checks a drift config request
+func (req DriftConfigRequest) Validate() error {
+	v := &validator{}
+	if req.Interval == "" && req.AutoHeal == nil && len(req.Releases) == 0 {
+		v.check("request", fmt.Errorf("must set interval, autoHeal or releases"))
+	}
+	if req.Interval != "" {
+		if interval, err := time.ParseDuration(req.Interval); err != nil || interval <= 0 {
+			v.check("interval", fmt.Errorf("must be a positive duration such as 5m"))
+		}
+	}
+	for name := range req.Releases {
+		v.require("releases", name)
+	}
+	return v.err()
+}
+
+// validateScope checks the release and namespace a substitution is scoped to
+func validateScope(v *validator, prefix, release, namespace string) {
+	if release != "" {
+		v.check(prefix+"release", substitute.ValidateReleaseName(release))
+	}
+	if namespace != "" {
+		v.check(prefix+"namespace", substitute.ValidateNamespace(namespace))
+	}
+}
+
+// validateTTL checks a substitution TTL
+func validateTTL(ttl string) error {
+	if _, err := parseTTL(ttl); err != nil {
+		return fmt.Errorf("must be a positive duration such as 2h")
+	}
+	return nil
+}
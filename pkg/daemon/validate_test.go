@@ -0,0 +1,119 @@
+package daemon
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestRequestValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		req    interface{ Validate() error }
+		fields []string
+	}{
+		{"valid chart", AddChartRequest{Original: "bitnami/nginx", LocalPath: "/charts/nginx", Release: "web", TTL: "2h"}, nil},
+		{"chart url", AddChartRequest{Original: "bitnami/nginx", LocalPath: "https://ci.example.com/nginx.tgz"}, nil},
+		{"empty chart", AddChartRequest{}, []string{"localPath", "original"}},
+		{"relative chart", AddChartRequest{Original: "bitnami/nginx", LocalPath: "./charts/nginx"}, []string{"localPath"}},
+		{"bad scope and ttl", AddChartRequest{Original: "bitnami/nginx", LocalPath: "/charts/nginx", Release: "Web", Namespace: "a_b", TTL: "soon"}, []string{"namespace", "release", "ttl"}},
+		{"valid image", AddImageRequest{Original: "nginx:1.21", Replacement: "localhost:5000/nginx:dev"}, nil},
+		{"bad image", AddImageRequest{Original: "nginx::1.21", Replacement: ""}, []string{"original", "replacement"}},
+		{"remove", RemoveImageRequest{}, []string{"original"}},
+		{"heal", HealReleaseRequest{}, []string{"release"}},
+		{"rollback", RollbackRequest{Release: "web", Revision: 3}, nil},
+		{"rollback all", RollbackRequest{All: true}, nil},
+		{"empty rollback", RollbackRequest{Revision: -1}, []string{"release", "revision"}},
+		{"rollback all with revision", RollbackRequest{All: true, Revision: 2}, []string{"revision"}},
+		{"empty bulk", BulkRequest{}, []string{"add"}},
+		{"bulk", BulkRequest{
+			Add: BulkAdd{
+				Charts: []AddChartRequest{{Original: "bitnami/nginx", LocalPath: "/charts/nginx", Strict: true}},
+				Images: []AddImageRequest{{Original: "nginx:1.21", Replacement: "local/nginx:dev"}, {Original: "redis:7"}},
+			},
+			Remove: BulkRemove{Charts: []RemoveChartRequest{{Original: "bitnami/redis", Namespace: "Cache"}}},
+		}, []string{"add.charts[0].strict", "add.images[1].replacement", "remove.charts[0].namespace"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.req.Validate()
+			if tt.fields == nil {
+				if err != nil {
+					t.Fatalf("expected request to be valid, got %v", err)
+				}
+				return
+			}
+
+			verr, ok := err.(ValidationError)
+			if !ok {
+				t.Fatalf("expected a ValidationError, got %v", err)
+			}
+			var fields []string
+			for _, f := range verr {
+				fields = append(fields, f.Field)
+			}
+			sort.Strings(fields)
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("expected errors for %v, got %v", tt.fields, verr)
+			}
+		})
+	}
+}
+
+func TestValidationErrorResponse(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	body, _ := json.Marshal(AddImageRequest{Original: "nginx:1.21", Replacement: "Bad Image"})
+	resp, err := http.Post(server.URL+"/api/v1/images", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var errResp ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusBadRequest || errResp.Code != CodeValidationFailed {
+		t.Fatalf("expected 400 %s, got %d %+v", CodeValidationFailed, resp.StatusCode, errResp)
+	}
+	if len(errResp.Fields) != 1 || errResp.Fields[0].Field != "replacement" {
+		t.Errorf("expected a replacement field error, got %+v", errResp.Fields)
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	tests := []struct {
+		method, path string
+		status       int
+		code         string
+	}{
+		{http.MethodGet, "/api/v1/unknown", http.StatusNotFound, CodeNotFound},
+		{http.MethodDelete, "/api/v1/status", http.StatusMethodNotAllowed, CodeMethodNotAllowed},
+		{http.MethodPost, "/api/v1/images", http.StatusBadRequest, CodeInvalidRequest},
+		{http.MethodGet, "/api/v1/images/nginx:1.21", http.StatusNotFound, CodeNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, server.URL+tt.path, nil)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			var errResp ErrorResponse
+			json.NewDecoder(resp.Body).Decode(&errResp)
+			if resp.StatusCode != tt.status || errResp.Code != tt.code {
+				t.Errorf("expected %d %s, got %d %+v", tt.status, tt.code, resp.StatusCode, errResp)
+			}
+		})
+	}
+}
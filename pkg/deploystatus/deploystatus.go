@@ -0,0 +1,409 @@
+// Package deploystatus reports the outcome of syncs to GitHub or GitLab, as
+// a commit status and optionally a deployment of the git revision the
+// helmfile was loaded from, so their dashboards show what was deployed from
+// which commit.
+package deploystatus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/httpclient"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+)
+
+// Provider is where statuses are reported
+type Provider string
+
+const (
+	GitHub Provider = "github"
+	GitLab Provider = "gitlab"
+)
+
+// Environment variables the API token is read from when none is configured
+const (
+	EnvGitHubToken = "GITHUB_TOKEN"
+	EnvGitLabToken = "GITLAB_TOKEN"
+)
+
+// DefaultEnvironment is the environment reported when none is configured
+const DefaultEnvironment = "default"
+
+// ParseProvider parses a provider name as given to --report-status
+func ParseProvider(name string) (Provider, error) {
+	switch p := Provider(strings.ToLower(name)); p {
+	case GitHub, GitLab:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown provider %q (providers: github, gitlab)", name)
+}
+
+// Config configures where and what a Reporter reports
+type Config struct {
+	// Provider is GitHub or GitLab; detected from the host of the git
+	// remote when empty
+	Provider Provider
+
+	// Repository is owner/name on GitHub or the project path on GitLab;
+	// taken from the git remote when empty
+	Repository string
+
+	// APIURL is the base URL of the REST API; derived from the host of the
+	// git remote when empty, e.g. https://api.github.com
+	APIURL string
+
+	// Token authenticates with the API; read from GITHUB_TOKEN or
+	// GITLAB_TOKEN when empty
+	Token string
+
+	// Environment is what the statuses and deployments are named after;
+	// DefaultEnvironment when empty
+	Environment string
+
+	// LogURL is linked from the statuses, with {syncId} replaced by the ID
+	// of the sync run; none when empty
+	LogURL string
+
+	// Deployments also records a deployment of the revision in the
+	// environment, besides the commit status
+	Deployments bool
+}
+
+// Revision is the git commit a helmfile was loaded from
+type Revision struct {
+	Commit string
+	Ref    string // the branch checked out; the commit when detached
+	Remote string // URL of the origin remote
+}
+
+// DetectRevision returns the revision of the git checkout holding path, a
+// helmfile or a directory of them
+func DetectRevision(path string) (Revision, error) {
+	dir := path
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		dir = filepath.Dir(path)
+	}
+
+	commit, err := git(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return Revision{}, err
+	}
+	rev := Revision{Commit: commit, Ref: commit}
+	if ref, err := git(dir, "rev-parse", "--abbrev-ref", "HEAD"); err == nil && ref != "HEAD" {
+		rev.Ref = ref
+	}
+	if remote, err := git(dir, "remote", "get-url", "origin"); err == nil {
+		rev.Remote = remote
+	}
+	return rev, nil
+}
+
+// git runs a git command in dir and returns its trimmed stdout
+func git(dir string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w (stderr: %s)", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// State is the outcome reported
+type State string
+
+const (
+	StateSuccess State = "success"
+	StateFailure State = "failure"
+)
+
+// Status is the outcome of a sync run of a revision
+type Status struct {
+	Revision    Revision
+	State       State
+	Description string
+	SyncID      string
+}
+
+// NewStatus summarizes a sync report as the status of rev
+func NewStatus(rev Revision, report *sync.Report) Status {
+	status := Status{Revision: rev, State: StateSuccess, SyncID: report.SyncID}
+	total := len(report.Results)
+	if report.Failed() {
+		status.State = StateFailure
+		failed := report.Count(sync.ReleaseStatusFailed) + report.Count(sync.ReleaseStatusTimedOut)
+		status.Description = fmt.Sprintf("helmfire sync failed: %d of %d releases failed", failed, total)
+	} else {
+		status.Description = fmt.Sprintf("helmfire synced %d releases in %s", total, report.Duration.Round(time.Second))
+	}
+	return status
+}
+
+// Reporter reports statuses through the REST API of GitHub or GitLab
+type Reporter struct {
+	config Config
+	client *http.Client
+}
+
+// New creates a reporter for config
+func New(config Config) *Reporter {
+	if config.Environment == "" {
+		config.Environment = DefaultEnvironment
+	}
+	return &Reporter{config: config, client: httpclient.New(30 * time.Second)}
+}
+
+// SetHTTPClient replaces the HTTP client, e.g. for tests
+func (r *Reporter) SetHTTPClient(client *http.Client) {
+	r.client = client
+}
+
+// Report reports the status of a sync run on its revision
+func (r *Reporter) Report(ctx context.Context, status Status) error {
+	if status.Revision.Commit == "" {
+		return fmt.Errorf("no git revision to report the status of")
+	}
+	t, err := r.resolve(status.Revision)
+	if err != nil {
+		return err
+	}
+
+	logURL := strings.ReplaceAll(r.config.LogURL, "{syncId}", status.SyncID)
+	if t.provider == GitLab {
+		return r.reportGitLab(ctx, t, status, logURL)
+	}
+	return r.reportGitHub(ctx, t, status, logURL)
+}
+
+// target is where a revision's statuses are reported
+type target struct {
+	provider   Provider
+	repository string
+	apiURL     string
+	token      string
+}
+
+// resolve fills what the config leaves out from the revision's remote
+func (r *Reporter) resolve(rev Revision) (target, error) {
+	t := target{
+		provider:   r.config.Provider,
+		repository: r.config.Repository,
+		apiURL:     strings.TrimSuffix(r.config.APIURL, "/"),
+		token:      r.config.Token,
+	}
+
+	if t.provider == "" || t.repository == "" || t.apiURL == "" {
+		host, path, err := parseRemote(rev.Remote)
+		if err != nil {
+			return target{}, fmt.Errorf("%w; configure the provider, repository and API URL", err)
+		}
+		if t.provider == "" {
+			switch {
+			case strings.Contains(host, "github"):
+				t.provider = GitHub
+			case strings.Contains(host, "gitlab"):
+				t.provider = GitLab
+			default:
+				return target{}, fmt.Errorf("cannot tell whether %s is GitHub or GitLab; configure the provider", host)
+			}
+		}
+		if t.repository == "" {
+			t.repository = path
+		}
+		if t.apiURL == "" {
+			switch {
+			case t.provider == GitLab:
+				t.apiURL = "https://" + host + "/api/v4"
+			case host == "github.com":
+				t.apiURL = "https://api.github.com"
+			default:
+				t.apiURL = "https://" + host + "/api/v3"
+			}
+		}
+	}
+
+	if t.token == "" {
+		env := EnvGitHubToken
+		if t.provider == GitLab {
+			env = EnvGitLabToken
+		}
+		if t.token = os.Getenv(env); t.token == "" {
+			return target{}, fmt.Errorf("no %s API token: set %s", t.provider, env)
+		}
+	}
+	return t, nil
+}
+
+// parseRemote returns the host and repository path of a git remote URL,
+// in URL or scp-like form (git@github.com:org/repo.git)
+func parseRemote(remote string) (host, path string, err error) {
+	if remote == "" {
+		return "", "", fmt.Errorf("the helmfile's git checkout has no origin remote")
+	}
+	if !strings.Contains(remote, "://") {
+		// scp-like: [user@]host:path
+		if at := strings.Index(remote, "@"); at >= 0 {
+			remote = remote[at+1:]
+		}
+		colon := strings.Index(remote, ":")
+		if colon <= 0 {
+			return "", "", fmt.Errorf("unsupported git remote %q", remote)
+		}
+		host, path = remote[:colon], remote[colon+1:]
+	} else {
+		u, err := url.Parse(remote)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid git remote: %w", err)
+		}
+		host, path = u.Hostname(), u.Path
+	}
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	if host == "" || !strings.Contains(path, "/") {
+		return "", "", fmt.Errorf("unsupported git remote %q", remote)
+	}
+	return host, path, nil
+}
+
+// reportGitHub sets a commit status and, with deployments, creates a
+// deployment of the commit with a status of its own
+func (r *Reporter) reportGitHub(ctx context.Context, t target, status Status, logURL string) error {
+	repo := t.apiURL + "/repos/" + t.repository
+	commitStatus := map[string]string{
+		"state":       string(status.State),
+		"context":     "helmfire/" + r.config.Environment,
+		"description": truncate(status.Description, 140),
+	}
+	if logURL != "" {
+		commitStatus["target_url"] = logURL
+	}
+	if err := r.post(ctx, t, repo+"/statuses/"+status.Revision.Commit, commitStatus, nil); err != nil {
+		return fmt.Errorf("failed to set commit status: %w", err)
+	}
+	if !r.config.Deployments {
+		return nil
+	}
+
+	var deployment struct {
+		ID int64 `json:"id"`
+	}
+	err := r.post(ctx, t, repo+"/deployments", map[string]interface{}{
+		"ref":               status.Revision.Commit,
+		"environment":       r.config.Environment,
+		"description":       status.Description,
+		"auto_merge":        false,
+		"required_contexts": []string{},
+	}, &deployment)
+	if err != nil {
+		return fmt.Errorf("failed to create deployment: %w", err)
+	}
+	deploymentStatus := map[string]string{
+		"state":       string(status.State),
+		"environment": r.config.Environment,
+		"description": truncate(status.Description, 140),
+	}
+	if logURL != "" {
+		deploymentStatus["log_url"] = logURL
+	}
+	if err := r.post(ctx, t, fmt.Sprintf("%s/deployments/%d/statuses", repo, deployment.ID), deploymentStatus, nil); err != nil {
+		return fmt.Errorf("failed to set deployment status: %w", err)
+	}
+	return nil
+}
+
+// reportGitLab sets a commit status and, with deployments, records a
+// deployment of the commit
+func (r *Reporter) reportGitLab(ctx context.Context, t target, status Status, logURL string) error {
+	project := t.apiURL + "/projects/" + url.PathEscape(t.repository)
+	state := "success"
+	if status.State == StateFailure {
+		state = "failed"
+	}
+
+	commitStatus := map[string]string{
+		"state":       state,
+		"name":        "helmfire/" + r.config.Environment,
+		"description": truncate(status.Description, 255),
+	}
+	if status.Revision.Ref != status.Revision.Commit {
+		commitStatus["ref"] = status.Revision.Ref
+	}
+	if logURL != "" {
+		commitStatus["target_url"] = logURL
+	}
+	if err := r.post(ctx, t, project+"/statuses/"+status.Revision.Commit, commitStatus, nil); err != nil {
+		return fmt.Errorf("failed to set commit status: %w", err)
+	}
+	if !r.config.Deployments {
+		return nil
+	}
+
+	err := r.post(ctx, t, project+"/deployments", map[string]interface{}{
+		"environment": r.config.Environment,
+		"sha":         status.Revision.Commit,
+		"ref":         status.Revision.Ref,
+		"tag":         false,
+		"status":      state,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create deployment: %w", err)
+	}
+	return nil
+}
+
+// post sends body as JSON and decodes the response into out, if not nil
+func (r *Reporter) post(ctx context.Context, t target, endpoint string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t.provider == GitLab {
+		req.Header.Set("PRIVATE-TOKEN", t.token)
+	} else {
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned status %d: %s", t.provider, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("invalid response from %s: %w", t.provider, err)
+		}
+	}
+	return nil
+}
+
+// truncate shortens s to at most n bytes, as the APIs limit descriptions
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
@@ -0,0 +1,180 @@
+package deploystatus
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	helmsync "github.com/oleksiyp/helmfire/pkg/sync"
+)
+
+// request is an API call a fake server received
+type request struct {
+	path string
+	auth string
+	body map[string]interface{}
+}
+
+func newFakeAPI(t *testing.T) (*httptest.Server, func() []request) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		auth := r.Header.Get("Authorization")
+		if auth == "" {
+			auth = r.Header.Get("PRIVATE-TOKEN")
+		}
+		mu.Lock()
+		requests = append(requests, request{path: r.URL.EscapedPath(), auth: auth, body: body})
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": 42}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []request {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]request(nil), requests...)
+	}
+}
+
+func TestReportGitHub(t *testing.T) {
+	server, requests := newFakeAPI(t)
+	reporter := New(Config{
+		APIURL:      server.URL,
+		Token:       "ghp_test",
+		Environment: "production",
+		LogURL:      "https://ci.example.com/syncs/{syncId}",
+		Deployments: true,
+	})
+
+	status := Status{
+		Revision:    Revision{Commit: "abc123", Ref: "main", Remote: "git@github.com:org/deploy.git"},
+		State:       StateSuccess,
+		Description: "helmfire synced 2 releases in 3s",
+		SyncID:      "s-1",
+	}
+	if err := reporter.Report(context.Background(), status); err != nil {
+		t.Fatalf("Report() failed: %v", err)
+	}
+
+	got := requests()
+	if len(got) != 3 {
+		t.Fatalf("expected 3 requests, got %+v", got)
+	}
+	if got[0].path != "/repos/org/deploy/statuses/abc123" || got[0].auth != "Bearer ghp_test" ||
+		got[0].body["context"] != "helmfire/production" || got[0].body["target_url"] != "https://ci.example.com/syncs/s-1" {
+		t.Errorf("unexpected commit status request %+v", got[0])
+	}
+	if got[1].path != "/repos/org/deploy/deployments" || got[1].body["ref"] != "abc123" || got[1].body["environment"] != "production" {
+		t.Errorf("unexpected deployment request %+v", got[1])
+	}
+	if got[2].path != "/repos/org/deploy/deployments/42/statuses" || got[2].body["state"] != "success" || got[2].body["log_url"] != "https://ci.example.com/syncs/s-1" {
+		t.Errorf("unexpected deployment status request %+v", got[2])
+	}
+}
+
+func TestReportGitLab(t *testing.T) {
+	server, requests := newFakeAPI(t)
+	t.Setenv(EnvGitLabToken, "glpat-test")
+	reporter := New(Config{Provider: GitLab, APIURL: server.URL})
+
+	status := Status{
+		Revision: Revision{Commit: "abc123", Ref: "main", Remote: "https://gitlab.example.com/group/sub/deploy.git"},
+		State:    StateFailure,
+	}
+	if err := reporter.Report(context.Background(), status); err != nil {
+		t.Fatalf("Report() failed: %v", err)
+	}
+
+	got := requests()
+	if len(got) != 1 {
+		t.Fatalf("expected only a commit status without deployments, got %+v", got)
+	}
+	if got[0].path != "/projects/group%2Fsub%2Fdeploy/statuses/abc123" || got[0].auth != "glpat-test" ||
+		got[0].body["state"] != "failed" || got[0].body["name"] != "helmfire/default" || got[0].body["ref"] != "main" {
+		t.Errorf("unexpected commit status request %+v", got[0])
+	}
+}
+
+func TestResolve(t *testing.T) {
+	t.Setenv(EnvGitHubToken, "ghp_env")
+	t.Setenv(EnvGitLabToken, "")
+	reporter := New(Config{})
+
+	tests := []struct {
+		remote string
+		want   target
+	}{
+		{"git@github.com:org/deploy.git", target{GitHub, "org/deploy", "https://api.github.com", "ghp_env"}},
+		{"https://x-access-token:t@github.com/org/deploy", target{GitHub, "org/deploy", "https://api.github.com", "ghp_env"}},
+		{"ssh://git@github.example.com:2222/org/deploy.git", target{GitHub, "org/deploy", "https://github.example.com/api/v3", "ghp_env"}},
+	}
+	for _, tt := range tests {
+		got, err := reporter.resolve(Revision{Commit: "abc", Remote: tt.remote})
+		if err != nil {
+			t.Errorf("resolve(%q) failed: %v", tt.remote, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("resolve(%q) = %+v, want %+v", tt.remote, got, tt.want)
+		}
+	}
+
+	for _, remote := range []string{"", "https://git.example.com/org/deploy.git", "https://gitlab.com/deploy", "git@gitlab.com:org/deploy.git"} {
+		if _, err := reporter.resolve(Revision{Commit: "abc", Remote: remote}); err == nil {
+			t.Errorf("resolve(%q) succeeded, want error", remote)
+		}
+	}
+}
+
+func TestNewStatus(t *testing.T) {
+	report := &helmsync.Report{SyncID: "s-1", Duration: 3 * time.Second}
+	report.Record("web", "apps", time.Second, nil)
+	report.Record("api", "apps", time.Second, os.ErrPermission)
+
+	status := NewStatus(Revision{Commit: "abc"}, report)
+	if status.State != StateFailure || status.SyncID != "s-1" || !strings.Contains(status.Description, "1 of 2 releases failed") {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestDetectRevision(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "--quiet", "--initial-branch", "main"},
+		{"remote", "add", "origin", "git@github.com:org/deploy.git"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "--allow-empty", "-m", "initial"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	helmfile := filepath.Join(dir, "helmfile.yaml")
+	os.WriteFile(helmfile, []byte("releases: []\n"), 0644)
+
+	rev, err := DetectRevision(helmfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rev.Commit) != 40 || rev.Ref != "main" || rev.Remote != "git@github.com:org/deploy.git" {
+		t.Errorf("unexpected revision %+v", rev)
+	}
+
+	if _, err := DetectRevision(t.TempDir()); err == nil {
+		t.Error("expected an error outside a git checkout")
+	}
+}
@@ -0,0 +1,135 @@
+package dev
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// State is where a release is in a dev session
+type State string
+
+// Release states
+const (
+	StatePending  State = "pending"
+	StateBuilding State = "building"
+	StateSyncing  State = "syncing"
+	StateReady    State = "ready"
+	StateFailed   State = "failed"
+)
+
+var stateMarks = map[State]string{
+	StatePending:  "·",
+	StateBuilding: "⚙",
+	StateSyncing:  "↻",
+	StateReady:    "✓",
+	StateFailed:   "✗",
+}
+
+// Board shows the state of every release of a dev session with their logs.
+// Live boards, for terminals, keep the release table below the scrolling
+// logs and redraw it in place; others print each state change as a line.
+type Board struct {
+	mu    sync.Mutex
+	out   io.Writer
+	live  bool
+	order []string
+	rows  map[string]*boardRow
+	width int // of release names
+	drawn int // lines of the table on screen
+}
+
+type boardRow struct {
+	state    State
+	message  string
+	forwards []string
+}
+
+// NewBoard returns a board of releases writing to out
+func NewBoard(out io.Writer, live bool, releases []string) *Board {
+	b := &Board{out: out, live: live, order: releases, rows: make(map[string]*boardRow)}
+	for _, release := range releases {
+		b.rows[release] = &boardRow{state: StatePending}
+		b.width = max(b.width, len(release))
+	}
+	b.mu.Lock()
+	b.redraw()
+	b.mu.Unlock()
+	return b
+}
+
+// Set changes the state of release. The first line of message is shown
+// next to it; failures show the whole message in the log.
+func (b *Board) Set(release string, state State, message string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	row, ok := b.rows[release]
+	if !ok {
+		return
+	}
+	first, rest, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	row.state, row.message = state, first
+
+	if !b.live {
+		fmt.Fprintf(b.out, "%s %-*s  %-8s %s\n", stateMarks[state], b.width, release, state, first)
+	}
+	if state == StateFailed && rest != "" {
+		b.erase()
+		for _, line := range strings.Split(rest, "\n") {
+			b.logLine(release, line)
+		}
+	}
+	b.redraw()
+}
+
+// SetForwards sets the local addresses forwarded to release
+func (b *Board) SetForwards(release string, forwards []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if row, ok := b.rows[release]; ok {
+		row.forwards = forwards
+		b.redraw()
+	}
+}
+
+// Log prints a log line of release above the table
+func (b *Board) Log(release, line string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.erase()
+	b.logLine(release, line)
+	b.redraw()
+}
+
+func (b *Board) logLine(release, line string) {
+	fmt.Fprintf(b.out, "%-*s │ %s\n", b.width, release, line)
+}
+
+// erase removes the table from a live board before other output
+func (b *Board) erase() {
+	if b.live && b.drawn > 0 {
+		fmt.Fprintf(b.out, "\x1b[%dA\x1b[J", b.drawn)
+		b.drawn = 0
+	}
+}
+
+// redraw draws the table of a live board
+func (b *Board) redraw() {
+	if !b.live {
+		return
+	}
+	b.erase()
+	fmt.Fprintf(b.out, "── helmfire dev · %s ──\n", time.Now().Format("15:04:05"))
+	for _, release := range b.order {
+		row := b.rows[release]
+		line := fmt.Sprintf("%s %-*s  %-8s %s", stateMarks[row.state], b.width, release, row.state, row.message)
+		if len(row.forwards) > 0 {
+			line += "  → " + strings.Join(row.forwards, ", ")
+		}
+		fmt.Fprintln(b.out, line)
+	}
+	b.drawn = len(b.order) + 1
+}
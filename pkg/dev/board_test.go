@@ -0,0 +1,109 @@
+package dev
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBoardPlain(t *testing.T) {
+	var out bytes.Buffer
+	board := NewBoard(&out, false, []string{"api", "frontend"})
+	board.Set("api", StateReady, "synced in 2s")
+	board.Log("frontend", "[pod/frontend-1/web] listening on :3000")
+	board.Set("frontend", StateFailed, "UPGRADE FAILED\nimage pull backoff")
+	board.Set("unknown", StateReady, "")
+
+	want := "✓ api       ready    synced in 2s\n" +
+		"frontend │ [pod/frontend-1/web] listening on :3000\n" +
+		"✗ frontend  failed   UPGRADE FAILED\n" +
+		"frontend │ image pull backoff\n"
+	if out.String() != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, out.String())
+	}
+}
+
+func TestBoardLive(t *testing.T) {
+	var out bytes.Buffer
+	board := NewBoard(&out, true, []string{"api"})
+	board.SetForwards("api", []string{"localhost:8080"})
+	out.Reset()
+
+	board.Log("api", "started")
+	got := out.String()
+	if !strings.HasPrefix(got, "\x1b[2A\x1b[J"+"api │ started\n") {
+		t.Errorf("expected the table to be erased before the log line, got %q", got)
+	}
+	if !strings.HasSuffix(got, "· api  pending    → localhost:8080\n") {
+		t.Errorf("expected the table redrawn below the log line, got %q", got)
+	}
+}
+
+func TestArgs(t *testing.T) {
+	got := PortForwardArgs("dev", "svc/api", []string{"8080:80", "9090"}, "kind-dev")
+	want := []string{"port-forward", "--namespace", "dev", "svc/api", "8080:80", "9090", "--context", "kind-dev"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	got = LogArgs("dev", "app=api", 0, "")
+	if !reflect.DeepEqual(got[len(got)-2:], []string{"--tail", "10"}) {
+		t.Errorf("expected a first stream to start with the last lines, got %v", got)
+	}
+	got = LogArgs("dev", "app=api", 1500*time.Millisecond, "")
+	if !reflect.DeepEqual(got[len(got)-2:], []string{"--since", "2s"}) {
+		t.Errorf("expected a restarted stream to resume, got %v", got)
+	}
+}
+
+func TestProcessRestarts(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake binary scripts require a POSIX shell")
+	}
+
+	script := filepath.Join(t.TempDir(), "stream")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho \"line $1\"\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	lines := make(chan string, 10)
+	exits := 0
+	process := &Process{
+		Binary: script,
+		Args:   func() []string { return []string{string(rune('a' + exits))} },
+		OnLine: func(line string) { lines <- line },
+		OnExit: func(err error) {
+			if err == nil {
+				t.Error("expected the exit error")
+			}
+			exits++
+		},
+	}
+	done := make(chan struct{})
+	go func() {
+		process.Run(ctx)
+		close(done)
+	}()
+
+	for _, want := range []string{"line a", "line b"} {
+		select {
+		case got := <-lines:
+			if got != want {
+				t.Errorf("expected %q, got %q", want, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+	cancel()
+	<-done
+}
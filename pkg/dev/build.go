@@ -0,0 +1,155 @@
+// Package dev provides the parts of a helmfire dev session: building images
+// and loading them into a local cluster, supervising port-forwards and log
+// streams, and a compact board of release states
+package dev
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"go.uber.org/zap"
+)
+
+// Ways built images reach the cluster
+const (
+	LoadKind     = "kind"     // kind load docker-image
+	LoadMinikube = "minikube" // minikube image load
+	LoadK3d      = "k3d"      // k3d image import
+	LoadPush     = "push"     // docker push to the image's registry
+	LoadNone     = "none"     // the cluster shares the docker daemon
+)
+
+// DetectLoad picks how images reach the cluster of a kube context from the
+// context names kind, minikube and k3d create, returning the cluster name
+func DetectLoad(kubeContext string) (load, cluster string) {
+	switch {
+	case strings.HasPrefix(kubeContext, "kind-"):
+		return LoadKind, strings.TrimPrefix(kubeContext, "kind-")
+	case strings.HasPrefix(kubeContext, "k3d-"):
+		return LoadK3d, strings.TrimPrefix(kubeContext, "k3d-")
+	case kubeContext == "minikube":
+		return LoadMinikube, ""
+	default:
+		return LoadNone, ""
+	}
+}
+
+// ParseLoad validates a --load value
+func ParseLoad(s string) (string, error) {
+	switch s {
+	case LoadKind, LoadMinikube, LoadK3d, LoadPush, LoadNone:
+		return s, nil
+	default:
+		return "", fmt.Errorf("invalid load %q: must be one of kind, minikube, k3d, push, none", s)
+	}
+}
+
+// Builder builds images with docker and makes them available to the cluster
+type Builder struct {
+	Docker  string // docker binary
+	Load    string // one of the Load constants
+	Cluster string // kind or k3d cluster, or minikube profile
+	Logger  *zap.Logger
+}
+
+// NewBuilder returns a builder using docker from PATH that loads images as
+// load says
+func NewBuilder(load, cluster string, logger *zap.Logger) *Builder {
+	return &Builder{Docker: "docker", Load: load, Cluster: cluster, Logger: logger}
+}
+
+// DevTag returns a new tag for a build of image: its repository with a
+// helmfire-dev tag unique to now, so every build rolls the pods using it
+func DevTag(image string, now time.Time) string {
+	repo := image
+	if i := strings.Index(repo, "@"); i >= 0 {
+		repo = repo[:i]
+	}
+	if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		repo = repo[:i]
+	}
+	return repo + ":helmfire-dev-" + now.UTC().Format("20060102150405")
+}
+
+// Build builds build as tag and loads it into the cluster
+func (b *Builder) Build(ctx context.Context, build helmstate.ImageBuild, tag string) error {
+	args := []string{"build", "--tag", tag}
+	if build.Dockerfile != "" {
+		args = append(args, "--file", filepath.Join(build.Context, build.Dockerfile))
+	}
+	keys := make([]string, 0, len(build.Args))
+	for k := range build.Args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "--build-arg", k+"="+build.Args[k])
+	}
+	args = append(args, build.Context)
+
+	b.Logger.Info("building image", zap.String("image", build.Image), zap.String("tag", tag))
+	if err := b.run(ctx, b.Docker, args...); err != nil {
+		return fmt.Errorf("docker build failed: %w", err)
+	}
+	if err := b.load(ctx, tag); err != nil {
+		return fmt.Errorf("failed to load %s into the cluster: %w", tag, err)
+	}
+	return nil
+}
+
+// load makes tag available to the cluster
+func (b *Builder) load(ctx context.Context, tag string) error {
+	switch b.Load {
+	case LoadKind:
+		args := []string{"load", "docker-image", tag}
+		if b.Cluster != "" {
+			args = append(args, "--name", b.Cluster)
+		}
+		return b.run(ctx, "kind", args...)
+	case LoadMinikube:
+		args := []string{"image", "load", tag}
+		if b.Cluster != "" {
+			args = append(args, "--profile", b.Cluster)
+		}
+		return b.run(ctx, "minikube", args...)
+	case LoadK3d:
+		args := []string{"image", "import", tag}
+		if b.Cluster != "" {
+			args = append(args, "--cluster", b.Cluster)
+		}
+		return b.run(ctx, "k3d", args...)
+	case LoadPush:
+		return b.run(ctx, b.Docker, "push", tag)
+	default:
+		return nil
+	}
+}
+
+func (b *Builder) run(ctx context.Context, binary string, args ...string) error {
+	cmd := exec.CommandContext(ctx, binary, args...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	b.Logger.Debug("executing build command", zap.String("binary", binary), zap.Strings("args", args))
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w\n%s", err, lastLines(output.String(), 10))
+	}
+	return nil
+}
+
+// lastLines returns the last n lines of s, where build errors are
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
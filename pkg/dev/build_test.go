@@ -0,0 +1,119 @@
+package dev
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"go.uber.org/zap"
+)
+
+func TestDetectLoad(t *testing.T) {
+	tests := []struct {
+		context, load, cluster string
+	}{
+		{"kind-dev", LoadKind, "dev"},
+		{"k3d-local", LoadK3d, "local"},
+		{"minikube", LoadMinikube, ""},
+		{"prod-eu", LoadNone, ""},
+		{"", LoadNone, ""},
+	}
+	for _, tt := range tests {
+		load, cluster := DetectLoad(tt.context)
+		if load != tt.load || cluster != tt.cluster {
+			t.Errorf("DetectLoad(%q) = %q, %q, expected %q, %q", tt.context, load, cluster, tt.load, tt.cluster)
+		}
+	}
+}
+
+func TestParseLoad(t *testing.T) {
+	if load, err := ParseLoad("push"); err != nil || load != LoadPush {
+		t.Errorf("expected push, got %q, %v", load, err)
+	}
+	if _, err := ParseLoad("scp"); err == nil {
+		t.Error("expected an error for an unknown load")
+	}
+}
+
+func TestDevTag(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 30, 45, 0, time.UTC)
+	tests := map[string]string{
+		"myapp":                        "myapp:helmfire-dev-20240501123045",
+		"myapp:1.2":                    "myapp:helmfire-dev-20240501123045",
+		"localhost:5000/team/api:v1":   "localhost:5000/team/api:helmfire-dev-20240501123045",
+		"localhost:5000/team/api":      "localhost:5000/team/api:helmfire-dev-20240501123045",
+		"ghcr.io/org/web@sha256:abcd0": "ghcr.io/org/web:helmfire-dev-20240501123045",
+	}
+	for image, want := range tests {
+		if got := DevTag(image, now); got != want {
+			t.Errorf("DevTag(%q) = %q, expected %q", image, got, want)
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake binary scripts require a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	log := filepath.Join(dir, "calls.log")
+	script := "#!/bin/sh\necho \"$(basename \"$0\") $*\" >> " + log + "\n"
+	for _, name := range []string{"docker", "kind"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	builder := NewBuilder(LoadKind, "dev", zap.NewNop())
+	build := helmstate.ImageBuild{
+		Image:      "api",
+		Context:    "/src/api",
+		Dockerfile: "Dockerfile.dev",
+		Args:       map[string]string{"B": "2", "A": "1"},
+	}
+	if err := builder.Build(context.Background(), build, "api:helmfire-dev-1"); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "docker build --tag api:helmfire-dev-1 --file /src/api/Dockerfile.dev --build-arg A=1 --build-arg B=2 /src/api\n" +
+		"kind load docker-image api:helmfire-dev-1 --name dev\n"
+	if string(data) != want {
+		t.Errorf("expected calls\n%s\ngot\n%s", want, data)
+	}
+}
+
+func TestBuildFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake binary scripts require a POSIX shell")
+	}
+
+	docker := filepath.Join(t.TempDir(), "docker")
+	script := "#!/bin/sh\nfor i in 1 2 3 4 5 6 7 8 9 10 11 12; do echo step $i; done\necho 'no such file: go.mod' >&2\nexit 1\n"
+	if err := os.WriteFile(docker, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	builder := NewBuilder(LoadNone, "", zap.NewNop())
+	builder.Docker = docker
+	err := builder.Build(context.Background(), helmstate.ImageBuild{Image: "api", Context: "."}, "api:dev")
+	if err == nil {
+		t.Fatal("expected the build to fail")
+	}
+	if !strings.Contains(err.Error(), "no such file: go.mod") {
+		t.Errorf("expected the build output in the error, got %v", err)
+	}
+	if strings.Contains(err.Error(), "step 2\n") {
+		t.Errorf("expected only the last lines of the output, got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package dev
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os/exec"
+	"time"
+)
+
+// Backoff bounds of supervised processes
+const (
+	minRestartDelay = time.Second
+	maxRestartDelay = 30 * time.Second
+)
+
+// Process is a long-running command, such as kubectl port-forward or
+// kubectl logs --follow, restarted with backoff whenever it exits: pods
+// come and go during a dev session and take their streams with them
+type Process struct {
+	Binary string
+	Args   func() []string // evaluated on every start
+
+	// OnLine receives each line the process writes to stdout or stderr
+	OnLine func(line string)
+
+	// OnExit is called when the process exits, before it is restarted
+	OnExit func(err error)
+}
+
+// Run starts the process and restarts it until ctx is done
+func (p *Process) Run(ctx context.Context) {
+	delay := minRestartDelay
+	for {
+		start := time.Now()
+		err := p.runOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if p.OnExit != nil {
+			p.OnExit(err)
+		}
+
+		// A process that ran for a while failed afresh
+		if time.Since(start) > maxRestartDelay {
+			delay = minRestartDelay
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRestartDelay)
+	}
+}
+
+func (p *Process) runOnce(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, p.Binary, p.Args()...)
+	reader, writer := io.Pipe()
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			if p.OnLine != nil {
+				p.OnLine(scanner.Text())
+			}
+		}
+		io.Copy(io.Discard, reader)
+	}()
+
+	err := cmd.Run()
+	writer.Close()
+	<-done
+	return err
+}
+
+// PortForwardArgs returns the kubectl arguments forwarding ports, as
+// LOCAL:REMOTE pairs, to resource
+func PortForwardArgs(namespace, resource string, ports []string, kubeContext string) []string {
+	args := append([]string{"port-forward", "--namespace", namespace, resource}, ports...)
+	if kubeContext != "" {
+		args = append(args, "--context", kubeContext)
+	}
+	return args
+}
+
+// LogArgs returns the kubectl arguments following the logs of the pods
+// matching selector. since limits a restarted stream to what it missed;
+// a first stream starts with the last few lines instead.
+func LogArgs(namespace, selector string, since time.Duration, kubeContext string) []string {
+	args := []string{"logs", "--follow", "--namespace", namespace, "--selector", selector,
+		"--all-containers", "--prefix", "--ignore-errors", "--max-log-requests", "20"}
+	if since > 0 {
+		args = append(args, "--since", max(since, time.Second).Round(time.Second).String())
+	} else {
+		args = append(args, "--tail", "10")
+	}
+	if kubeContext != "" {
+		args = append(args, "--context", kubeContext)
+	}
+	return args
+}
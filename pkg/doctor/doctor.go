@@ -0,0 +1,353 @@
+package doctor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/daemon"
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/httpclient"
+	"github.com/oleksiyp/helmfire/pkg/preflight"
+)
+
+// Status is the outcome of a check
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusWarn Status = "warn" // works, but some features won't
+	StatusFail Status = "fail"
+	StatusSkip Status = "skip" // not checked, usually because an earlier check failed
+)
+
+// DefaultTimeout bounds each check that talks to the cluster or a repository
+const DefaultTimeout = 10 * time.Second
+
+// releaseStorageVerbs are what helm needs on secrets, where it stores
+// releases, in every target namespace
+var releaseStorageVerbs = []string{"get", "list", "create", "update", "delete"}
+
+// Check is the result of one diagnostic
+type Check struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	Detail string `json:"detail,omitempty"`
+
+	// Fix suggests how to resolve a failure or warning
+	Fix string `json:"fix,omitempty"`
+}
+
+// Report is the result of all diagnostics, in the order they ran
+type Report struct {
+	Checks []Check `json:"checks"`
+}
+
+// Failed reports whether any check failed
+func (r *Report) Failed() bool {
+	for _, check := range r.Checks {
+		if check.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Report) add(check Check) {
+	r.Checks = append(r.Checks, check)
+}
+
+// Options configures the diagnostics
+type Options struct {
+	HelmBinary    string // as for preflight.Options
+	KubectlBinary string // defaults to kubectl on PATH
+	KubeContext   string
+	HelmfilePath  string
+	ExtraPaths    []string // more helmfiles or directories, as for helmstate.Manager
+	Environment   string
+	DaemonAPIAddr string
+	DaemonPIDFile string
+	Timeout       time.Duration
+}
+
+// Run checks the tools, cluster, helmfile, repositories and daemon helmfire
+// depends on. Checks that need an earlier one to pass are skipped when it
+// fails.
+func Run(opts Options) *Report {
+	if opts.KubectlBinary == "" {
+		opts.KubectlBinary = "kubectl"
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+
+	report := &Report{}
+	helm := checkHelm(report, opts)
+	kubectl := checkKubectl(report, opts)
+	manager := checkHelmfile(report, opts, helm)
+
+	connected := false
+	if kubectl {
+		connected = checkCluster(report, opts)
+	} else {
+		report.add(Check{Name: "cluster", Status: StatusSkip, Detail: "kubectl not available"})
+	}
+
+	switch {
+	case manager == nil:
+		report.add(Check{Name: "rbac", Status: StatusSkip, Detail: "helmfile not loaded"})
+	case !connected:
+		report.add(Check{Name: "rbac", Status: StatusSkip, Detail: "cluster not reachable"})
+	default:
+		for _, ns := range manager.TargetNamespaces() {
+			report.add(checkRBAC(opts, ns))
+		}
+	}
+
+	if manager != nil {
+		for _, repo := range manager.GetRepositories() {
+			report.add(checkRepository(opts, repo))
+		}
+	}
+
+	report.add(checkDaemon(opts))
+	return report
+}
+
+// checkHelm checks the helm version and the helm-diff plugin, returning the
+// helm binary or "" when it is unusable
+func checkHelm(report *Report, opts Options) string {
+	binary, err := preflight.ResolveHelmBinary(opts.HelmBinary)
+	if err != nil {
+		report.add(Check{Name: "helm", Status: StatusFail, Detail: err.Error(),
+			Fix: "install helm 3 (https://helm.sh/docs/intro/install/) or pass --helm-binary"})
+		report.add(Check{Name: "helm-diff", Status: StatusSkip, Detail: "helm not available"})
+		return ""
+	}
+
+	version, err := preflight.HelmVersion(binary)
+	if err != nil {
+		report.add(Check{Name: "helm", Status: StatusFail, Detail: err.Error(),
+			Fix: "check that " + binary + " is a working helm binary"})
+		report.add(Check{Name: "helm-diff", Status: StatusSkip, Detail: "helm not available"})
+		return ""
+	}
+	if preflight.CompareVersions(version, preflight.MinHelmVersion) < 0 {
+		report.add(Check{Name: "helm", Status: StatusFail,
+			Detail: fmt.Sprintf("%s (%s) is older than %s", version, binary, preflight.MinHelmVersion),
+			Fix:    "upgrade helm (https://helm.sh/docs/intro/install/)"})
+	} else {
+		report.add(Check{Name: "helm", Status: StatusPass, Detail: fmt.Sprintf("%s (%s)", version, binary)})
+	}
+
+	plugins, err := preflight.InstalledPlugins(binary)
+	switch {
+	case err != nil:
+		report.add(Check{Name: "helm-diff", Status: StatusWarn, Detail: err.Error()})
+	case plugins[preflight.PluginDiff] == "":
+		report.add(Check{Name: "helm-diff", Status: StatusWarn,
+			Detail: "not installed; drift detection and heal previews need it",
+			Fix:    fmt.Sprintf("%s plugin install https://github.com/databus23/helm-diff", binary)})
+	default:
+		report.add(Check{Name: "helm-diff", Status: StatusPass, Detail: plugins[preflight.PluginDiff]})
+	}
+	return binary
+}
+
+// checkKubectl checks that kubectl runs
+func checkKubectl(report *Report, opts Options) bool {
+	out, err := run(opts, opts.KubectlBinary, "version", "--client", "--output", "json")
+	if err != nil {
+		report.add(Check{Name: "kubectl", Status: StatusFail, Detail: err.Error(),
+			Fix: "install kubectl (https://kubernetes.io/docs/tasks/tools/)"})
+		return false
+	}
+
+	var version struct {
+		ClientVersion struct {
+			GitVersion string `json:"gitVersion"`
+		} `json:"clientVersion"`
+	}
+	json.Unmarshal([]byte(out), &version)
+	report.add(Check{Name: "kubectl", Status: StatusPass, Detail: version.ClientVersion.GitVersion})
+	return true
+}
+
+// checkHelmfile checks that the helmfile parses, returning its manager
+func checkHelmfile(report *Report, opts Options, helm string) *helmstate.Manager {
+	manager := helmstate.NewManager(opts.HelmfilePath, opts.Environment)
+	manager.ExtraPaths = opts.ExtraPaths
+	manager.HelmBinary = helm
+	if err := manager.Load(); err != nil {
+		report.add(Check{Name: "helmfile", Status: StatusFail, Detail: err.Error(),
+			Fix: "fix the helmfile or pass its path with -f"})
+		return nil
+	}
+
+	releases := manager.GetReleases()
+	if len(releases) == 0 {
+		report.add(Check{Name: "helmfile", Status: StatusWarn, Detail: opts.HelmfilePath + " defines no releases"})
+		return manager
+	}
+	source := opts.HelmfilePath
+	if len(manager.Files) > 1 {
+		source = fmt.Sprintf("%d helmfiles", len(manager.Files))
+	}
+	report.add(Check{Name: "helmfile", Status: StatusPass,
+		Detail: fmt.Sprintf("%s: %d release(s) in %d namespace(s)", source, len(releases), len(manager.TargetNamespaces()))})
+	return manager
+}
+
+// checkCluster checks that the Kubernetes API server is reachable
+func checkCluster(report *Report, opts Options) bool {
+	out, err := run(opts, opts.KubectlBinary, kubectlArgs(opts, "version", "--output", "json")...)
+	var version struct {
+		ServerVersion *struct {
+			GitVersion string `json:"gitVersion"`
+		} `json:"serverVersion"`
+	}
+	if err == nil {
+		json.Unmarshal([]byte(out), &version)
+	}
+	if err != nil || version.ServerVersion == nil {
+		detail := "no server version reported"
+		if err != nil {
+			detail = err.Error()
+		}
+		report.add(Check{Name: "cluster", Status: StatusFail, Detail: detail,
+			Fix: "check your kubeconfig and current context (kubectl config current-context), or pass --kube-context"})
+		return false
+	}
+
+	detail := version.ServerVersion.GitVersion
+	if opts.KubeContext != "" {
+		detail += " (context " + opts.KubeContext + ")"
+	}
+	report.add(Check{Name: "cluster", Status: StatusPass, Detail: detail})
+	return true
+}
+
+// checkRBAC checks that helm can manage its release secrets in namespace
+func checkRBAC(opts Options, namespace string) Check {
+	name := "rbac " + namespace
+	var denied []string
+	for _, verb := range releaseStorageVerbs {
+		out, err := run(opts, opts.KubectlBinary, kubectlArgs(opts, "auth", "can-i", verb, "secrets", "--namespace", namespace)...)
+		// can-i exits 1 and prints "no" when denied
+		if strings.TrimSpace(out) != "yes" {
+			if err != nil && strings.TrimSpace(out) == "" {
+				return Check{Name: name, Status: StatusFail, Detail: err.Error()}
+			}
+			denied = append(denied, verb)
+		}
+	}
+
+	if len(denied) > 0 {
+		return Check{Name: name, Status: StatusFail,
+			Detail: "cannot " + strings.Join(denied, ", ") + " secrets, where helm stores releases",
+			Fix:    fmt.Sprintf("grant your user a Role with %s on secrets in %s", strings.Join(releaseStorageVerbs, ", "), namespace)}
+	}
+	return Check{Name: name, Status: StatusPass, Detail: "can manage helm release secrets"}
+}
+
+// checkRepository checks that a chart repository serves its index
+func checkRepository(opts Options, repo helmstate.Repository) Check {
+	name := "repo " + repo.Name
+	if repo.OCI {
+		return Check{Name: name, Status: StatusSkip, Detail: "OCI registry " + repo.URL + " not checked"}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	url := strings.TrimSuffix(repo.URL, "/") + "/index.yaml"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return Check{Name: name, Status: StatusFail, Detail: err.Error(), Fix: "fix the repository URL in the helmfile"}
+	}
+	if repo.Username != "" {
+		req.SetBasicAuth(repo.Username, repo.Password)
+	}
+
+	client, err := httpclient.NewWith(httpclient.Options{CAFile: repo.CAFile, InsecureSkipVerify: repo.SkipTLSVerify}, 0)
+	if err != nil {
+		return Check{Name: name, Status: StatusFail, Detail: err.Error(), Fix: "fix the repository's caFile in the helmfile"}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Check{Name: name, Status: StatusFail, Detail: err.Error(),
+			Fix: "check the repository URL and your network or proxy settings"}
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return Check{Name: name, Status: StatusFail, Detail: fmt.Sprintf("%s: %s", url, resp.Status),
+			Fix: "set the repository's username and password in the helmfile"}
+	case resp.StatusCode != http.StatusOK:
+		return Check{Name: name, Status: StatusFail, Detail: fmt.Sprintf("%s: %s", url, resp.Status),
+			Fix: "check the repository URL in the helmfile"}
+	}
+	return Check{Name: name, Status: StatusPass, Detail: repo.URL}
+}
+
+// checkDaemon checks the health of the project's daemon, if it is running
+func checkDaemon(opts Options) Check {
+	running, err := daemon.IsDaemonRunning(opts.DaemonPIDFile)
+	if err != nil {
+		return Check{Name: "daemon", Status: StatusWarn, Detail: err.Error(),
+			Fix: "remove the PID file " + opts.DaemonPIDFile + " if no daemon is running"}
+	}
+	if !running {
+		return Check{Name: "daemon", Status: StatusPass, Detail: "not running"}
+	}
+
+	readiness, err := daemon.NewAPIClient(opts.DaemonAPIAddr).GetReadiness()
+	if err != nil {
+		return Check{Name: "daemon", Status: StatusFail, Detail: err.Error(),
+			Fix: "check --daemon-api-addr, or restart the daemon (helmfire daemon stop && helmfire daemon start)"}
+	}
+	if readiness.Status != "ready" {
+		var problems []string
+		for _, check := range readiness.Checks {
+			if !check.Ready {
+				problems = append(problems, check.Name+": "+check.Message)
+			}
+		}
+		return Check{Name: "daemon", Status: StatusFail, Detail: "not ready: " + strings.Join(problems, "; "),
+			Fix: "see helmfire daemon logs"}
+	}
+	return Check{Name: "daemon", Status: StatusPass, Detail: "running and ready at " + opts.DaemonAPIAddr}
+}
+
+// kubectlArgs adds the kube context to kubectl arguments
+func kubectlArgs(opts Options, args ...string) []string {
+	if opts.KubeContext != "" {
+		args = append([]string{"--context", opts.KubeContext}, args...)
+	}
+	return args
+}
+
+// run runs a binary with the check timeout and returns its stdout
+func run(opts Options, binary string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, binary, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return stdout.String(), fmt.Errorf("%s: %s", binary, msg)
+		}
+		return stdout.String(), fmt.Errorf("%s: %w", binary, err)
+	}
+	return stdout.String(), nil
+}
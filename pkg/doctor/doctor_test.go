@@ -0,0 +1,132 @@
+package doctor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// writeScript writes an executable shell script to dir
+func writeScript(t *testing.T, dir, name, script string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("failed to write fake %s: %v", name, err)
+	}
+	return path
+}
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake binaries require a POSIX shell")
+	}
+
+	repo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/charts/index.yaml" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer repo.Close()
+
+	dir := t.TempDir()
+	helm := writeScript(t, dir, "helm", `case "$1" in
+version) printf v3.14.2 ;;
+plugin) printf 'NAME\tVERSION\tDESCRIPTION\n' ;;
+esac
+`)
+	// Everything is allowed in web; nothing but get in db
+	kubectl := writeScript(t, dir, "kubectl", `case "$*" in
+"version --client"*) echo '{"clientVersion":{"gitVersion":"v1.29.0"}}' ;;
+*"version --output json") echo '{"clientVersion":{},"serverVersion":{"gitVersion":"v1.28.3"}}' ;;
+*"can-i get secrets --namespace db") echo yes ;;
+*"--namespace db") echo no; exit 1 ;;
+*"can-i"*) echo yes ;;
+esac
+`)
+
+	helmfile := filepath.Join(dir, "helmfile.yaml")
+	spec := `repositories:
+- name: good
+  url: ` + repo.URL + `/charts
+- name: gone
+  url: ` + repo.URL + `/missing
+releases:
+- name: web
+  namespace: web
+  chart: good/nginx
+- name: pg
+  namespace: db
+  chart: good/postgresql
+`
+	if err := os.WriteFile(helmfile, []byte(spec), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report := Run(Options{
+		HelmBinary:    helm,
+		KubectlBinary: kubectl,
+		HelmfilePath:  helmfile,
+		DaemonPIDFile: filepath.Join(dir, "daemon.pid"),
+	})
+
+	want := map[string]Status{
+		"helm":      StatusPass,
+		"helm-diff": StatusWarn,
+		"kubectl":   StatusPass,
+		"helmfile":  StatusPass,
+		"cluster":   StatusPass,
+		"rbac web":  StatusPass,
+		"rbac db":   StatusFail,
+		"repo good": StatusPass,
+		"repo gone": StatusFail,
+		"daemon":    StatusPass,
+	}
+	got := make(map[string]Check)
+	for _, check := range report.Checks {
+		got[check.Name] = check
+	}
+	for name, status := range want {
+		check, ok := got[name]
+		if !ok {
+			t.Errorf("missing check %q in %+v", name, report.Checks)
+			continue
+		}
+		if check.Status != status {
+			t.Errorf("check %q: expected %s, got %s (%s)", name, status, check.Status, check.Detail)
+		}
+		if (status == StatusFail || status == StatusWarn) && check.Fix == "" {
+			t.Errorf("check %q: expected a fix", name)
+		}
+	}
+	if !strings.Contains(got["rbac db"].Detail, "list, create, update, delete") {
+		t.Errorf("expected the denied verbs, got %q", got["rbac db"].Detail)
+	}
+	if !report.Failed() {
+		t.Error("expected the report to fail")
+	}
+}
+
+func TestRunWithoutTools(t *testing.T) {
+	dir := t.TempDir()
+	report := Run(Options{
+		HelmBinary:    filepath.Join(dir, "missing-helm"),
+		KubectlBinary: filepath.Join(dir, "missing-kubectl"),
+		HelmfilePath:  filepath.Join(dir, "helmfile.yaml"),
+		DaemonPIDFile: filepath.Join(dir, "daemon.pid"),
+	})
+
+	statuses := make(map[string]Status)
+	for _, check := range report.Checks {
+		statuses[check.Name] = check.Status
+	}
+	if statuses["helm"] != StatusFail || statuses["kubectl"] != StatusFail || statuses["helmfile"] != StatusFail {
+		t.Errorf("expected helm, kubectl and helmfile to fail, got %v", statuses)
+	}
+	if statuses["cluster"] != StatusSkip || statuses["rbac"] != StatusSkip {
+		t.Errorf("expected cluster and rbac to be skipped, got %v", statuses)
+	}
+}
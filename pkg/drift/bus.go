@@ -0,0 +1,126 @@
+package drift
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/kafka"
+	"github.com/oleksiyp/helmfire/pkg/nats"
+	"go.uber.org/zap"
+)
+
+// NATSNotifier publishes drift reports to a NATS subject
+type NATSNotifier struct {
+	publisher *nats.Publisher
+	subject   string
+	timeout   time.Duration
+	logger    *zap.Logger
+}
+
+// NewNATSNotifier creates a notifier publishing to subject through
+// publisher
+func NewNATSNotifier(publisher *nats.Publisher, subject string, logger *zap.Logger) *NATSNotifier {
+	return &NATSNotifier{
+		publisher: publisher,
+		subject:   subject,
+		timeout:   nats.DefaultTimeout,
+		logger:    logger,
+	}
+}
+
+// Notify publishes the drift report as JSON
+func (n *NATSNotifier) Notify(report DriftReport) error {
+	payload, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal drift report: %w", err)
+	}
+	if err := n.publish(report.ReleaseName, payload); err != nil {
+		return fmt.Errorf("failed to publish drift report: %w", err)
+	}
+	return nil
+}
+
+// NotifySync publishes the sync event as JSON
+func (n *NATSNotifier) NotifySync(event SyncEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal sync event: %w", err)
+	}
+	if err := n.publish(event.Subject(), payload); err != nil {
+		return fmt.Errorf("failed to publish sync event: %w", err)
+	}
+	return nil
+}
+
+// publish publishes a payload to the subject
+func (n *NATSNotifier) publish(about string, payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), n.timeout)
+	defer cancel()
+	if err := n.publisher.Publish(ctx, n.subject, payload); err != nil {
+		return err
+	}
+
+	n.logger.Debug("nats notification sent",
+		zap.String("subject", n.subject),
+		zap.String("about", about))
+
+	return nil
+}
+
+// KafkaNotifier produces drift reports to a Kafka topic, keyed by the
+// release's namespace and name so the reports of a release stay in order
+type KafkaNotifier struct {
+	producer *kafka.Producer
+	topic    string
+	logger   *zap.Logger
+}
+
+// NewKafkaNotifier creates a notifier producing to topic through producer
+func NewKafkaNotifier(producer *kafka.Producer, topic string, logger *zap.Logger) *KafkaNotifier {
+	return &KafkaNotifier{
+		producer: producer,
+		topic:    topic,
+		logger:   logger,
+	}
+}
+
+// Notify produces the drift report as JSON
+func (n *KafkaNotifier) Notify(report DriftReport) error {
+	payload, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal drift report: %w", err)
+	}
+
+	key := report.Namespace + "/" + report.ReleaseName
+	if err := n.producer.Produce(context.Background(), n.topic, []byte(key), payload); err != nil {
+		return fmt.Errorf("failed to produce drift report: %w", err)
+	}
+
+	n.logger.Debug("kafka notification sent",
+		zap.String("topic", n.topic),
+		zap.String("release", report.ReleaseName))
+
+	return nil
+}
+
+// NotifySync produces the sync event as JSON, keyed by the sync ID so the
+// events of a run stay in order
+func (n *KafkaNotifier) NotifySync(event SyncEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal sync event: %w", err)
+	}
+
+	if err := n.producer.Produce(context.Background(), n.topic, []byte(event.SyncID), payload); err != nil {
+		return fmt.Errorf("failed to produce sync event: %w", err)
+	}
+
+	n.logger.Debug("kafka notification sent",
+		zap.String("topic", n.topic),
+		zap.String("syncId", event.SyncID),
+		zap.String("phase", string(event.Phase)))
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package drift
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// seenDrift is the drift last notified for a release
+type seenDrift struct {
+	fingerprint string
+	orphan      bool
+	goneSince   time.Time // when checks stopped finding the drift; zero while they do
+}
+
+// SetFlapWindow sets how long drift must stay gone before it is reported
+// resolved. Drift coming back unchanged within the window is treated as if
+// it never went away, so releases flapping between states don't notify on
+// every check. Zero reports drift resolved on the first check not finding it.
+func (d *Detector) SetFlapWindow(window time.Duration) {
+	if window < 0 {
+		window = 0
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.flapWindow = window
+}
+
+// Fingerprint identifies the drift a report describes, so the same drift
+// found again can be told apart from new or changed drift
+func Fingerprint(report DriftReport) string {
+	h := sha256.New()
+	h.Write([]byte(report.Namespace + "/" + report.ReleaseName + "\x00" + string(report.DriftType) + "\x00" + report.Diff))
+	if report.DriftType == DriftTypeOrphan {
+		// Orphans have no diff; their chart and status are in the details
+		h.Write([]byte("\x00" + report.Details))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// observe records drift found by a check and reports whether it is new or
+// changed since it was last notified
+func (d *Detector) observe(report DriftReport) bool {
+	key := report.Namespace + "/" + report.ReleaseName
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	prev, ok := d.seen[key]
+	d.seen[key] = seenDrift{fingerprint: report.Fingerprint, orphan: report.DriftType == DriftTypeOrphan}
+	return !ok || prev.fingerprint != report.Fingerprint
+}
+
+// forget drops the drift recorded for a release, such as once it's healed,
+// so that it's notified again if it comes back
+func (d *Detector) forget(name, namespace string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.seen, namespace+"/"+name)
+}
+
+// resolve notes that a check no longer finds the drift recorded under key
+// and notifies that it's resolved once it has stayed gone for the flap window
+func (d *Detector) resolve(key string, now time.Time) {
+	d.mu.Lock()
+	prev, ok := d.seen[key]
+	if !ok {
+		d.mu.Unlock()
+		return
+	}
+	if prev.goneSince.IsZero() {
+		prev.goneSince = now
+		d.seen[key] = prev
+	}
+	if now.Sub(prev.goneSince) < d.flapWindow {
+		d.mu.Unlock()
+		return
+	}
+	delete(d.seen, key)
+	notifiers := append([]Notifier(nil), d.notifiers...)
+	d.mu.Unlock()
+
+	namespace, name, _ := strings.Cut(key, "/")
+	d.logger.Info("drift resolved",
+		zap.String("release", name),
+		zap.String("namespace", namespace))
+
+	report := DriftReport{
+		ID:          newReportID(),
+		Timestamp:   now,
+		ReleaseName: name,
+		Namespace:   namespace,
+		DriftType:   DriftTypeResolved,
+		Severity:    SeverityLow,
+		Details:     "Drift no longer detected",
+		Fingerprint: prev.fingerprint,
+	}
+	d.notify(notifiers, report)
+	d.record(report)
+}
+
+// resolveOrphans resolves the orphans recorded earlier that aren't among
+// those found by the last check
+func (d *Detector) resolveOrphans(found []DriftReport, now time.Time) {
+	current := make(map[string]bool, len(found))
+	for _, report := range found {
+		current[report.Namespace+"/"+report.ReleaseName] = true
+	}
+
+	d.mu.RLock()
+	var gone []string
+	for key, seen := range d.seen {
+		if seen.orphan && !current[key] {
+			gone = append(gone, key)
+		}
+	}
+	d.mu.RUnlock()
+
+	for _, key := range gone {
+		d.resolve(key, now)
+	}
+}
+
+// restoreSeen rebuilds the drift last notified for each release from the
+// report history, so a restart doesn't notify it again; d.mu must be held
+func (d *Detector) restoreSeen() {
+	d.seen = make(map[string]seenDrift)
+	for _, report := range d.history {
+		key := report.Namespace + "/" + report.ReleaseName
+		switch {
+		case report.Healed || report.DriftType == DriftTypeResolved || report.Fingerprint == "":
+			delete(d.seen, key)
+		default:
+			d.seen[key] = seenDrift{fingerprint: report.Fingerprint, orphan: report.DriftType == DriftTypeOrphan}
+		}
+	}
+}
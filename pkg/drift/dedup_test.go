@@ -0,0 +1,140 @@
+package drift
+
+import (
+	"testing"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"go.uber.org/zap"
+)
+
+func TestCheckReleaseNotifiesChangesOnly(t *testing.T) {
+	detector := NewDetector(nil, time.Minute, zap.NewNop())
+	notifier := &MockNotifier{}
+	detector.AddNotifier(notifier)
+	inspector := &fakeInspector{exists: true, diff: "- replicas: 1\n+ replicas: 3"}
+	detector.inspector = inspector
+	release := helmstate.Release{Name: "web", Namespace: "prod"}
+
+	detector.checkRelease(release)
+	detector.checkRelease(release)
+	if len(notifier.reports) != 1 {
+		t.Fatalf("expected unchanged drift notified once, got %d notifications", len(notifier.reports))
+	}
+	if len(detector.Reports()) != 2 {
+		t.Errorf("expected both checks recorded, got %d reports", len(detector.Reports()))
+	}
+
+	inspector.diff = "- replicas: 1\n+ replicas: 5"
+	detector.checkRelease(release)
+	if len(notifier.reports) != 2 || notifier.reports[1].Fingerprint == notifier.reports[0].Fingerprint {
+		t.Fatalf("expected changed drift notified with a new fingerprint, got %+v", notifier.reports)
+	}
+
+	inspector.diff = ""
+	detector.checkRelease(release)
+	detector.checkRelease(release)
+	if len(notifier.reports) != 3 || notifier.reports[2].DriftType != DriftTypeResolved {
+		t.Fatalf("expected one resolved notification, got %+v", notifier.reports)
+	}
+	if notifier.reports[2].ReleaseName != "web" || notifier.reports[2].Namespace != "prod" {
+		t.Errorf("expected resolved report for prod/web, got %+v", notifier.reports[2])
+	}
+
+	inspector.diff = "- replicas: 1\n+ replicas: 5"
+	detector.checkRelease(release)
+	if len(notifier.reports) != 4 {
+		t.Errorf("expected drift coming back after it resolved notified, got %d notifications", len(notifier.reports))
+	}
+}
+
+func TestResolveFlapWindow(t *testing.T) {
+	detector := NewDetector(nil, time.Minute, zap.NewNop())
+	notifier := &MockNotifier{}
+	detector.AddNotifier(notifier)
+	detector.SetFlapWindow(10 * time.Minute)
+
+	report := DriftReport{ReleaseName: "web", Namespace: "prod", DriftType: DriftTypeConfiguration, Diff: "+ replicas: 3"}
+	detector.handleCheckedReport(report)
+
+	now := time.Now()
+	detector.resolve("prod/web", now)
+	detector.handleCheckedReport(report)
+	if len(notifier.reports) != 1 {
+		t.Fatalf("expected drift flapping within the window notified once, got %+v", notifier.reports)
+	}
+
+	detector.resolve("prod/web", now.Add(time.Minute))
+	detector.resolve("prod/web", now.Add(5*time.Minute))
+	if len(notifier.reports) != 1 {
+		t.Fatalf("expected no resolved notification within the window, got %+v", notifier.reports)
+	}
+	detector.resolve("prod/web", now.Add(12*time.Minute))
+	if len(notifier.reports) != 2 || notifier.reports[1].DriftType != DriftTypeResolved {
+		t.Errorf("expected resolved notification after the window, got %+v", notifier.reports)
+	}
+}
+
+func TestHealedDriftNotResolved(t *testing.T) {
+	detector := NewDetector(nil, time.Minute, zap.NewNop())
+	notifier := &MockNotifier{}
+	detector.AddNotifier(notifier)
+	detector.EnableAutoHeal(true, func(string) error { return nil })
+
+	detector.handleCheckedReport(DriftReport{ReleaseName: "web", DriftType: DriftTypeConfiguration, Diff: "+ replicas: 3"})
+	detector.resolve("/web", time.Now())
+	if len(notifier.reports) != 2 || !notifier.reports[1].Healed {
+		t.Errorf("expected detection and heal notifications only, got %+v", notifier.reports)
+	}
+}
+
+func TestUnchangedDriftKeepsPendingID(t *testing.T) {
+	detector := NewDetector(nil, time.Minute, zap.NewNop())
+	detector.EnableAutoHeal(true, func(string) error { return nil })
+	detector.SetHealPolicy(HealPolicy{MaxSeverity: SeverityLow})
+
+	report := DriftReport{ReleaseName: "db", Namespace: "prod", DriftType: DriftTypeDeletion, Severity: SeverityHigh}
+	first := detector.handleCheckedReport(report)
+	second := detector.handleCheckedReport(report)
+	if !first.PendingApproval || second.ID != first.ID {
+		t.Fatalf("expected unchanged drift to keep awaiting approval as %s, got %+v", first.ID, second)
+	}
+	if pending := detector.PendingReports(); len(pending) != 1 || pending[0].ID != first.ID {
+		t.Errorf("expected one pending report %s, got %+v", first.ID, pending)
+	}
+}
+
+func TestResolveOrphans(t *testing.T) {
+	detector := NewDetector(nil, time.Minute, zap.NewNop())
+	notifier := &MockNotifier{}
+	detector.AddNotifier(notifier)
+	detector.EnableOrphanDetection(true, nil)
+	detector.inspector = &fakeInspector{orphans: []helmstate.DeployedRelease{{Name: "old", Namespace: "default", Chart: "nginx-1.0.0", Status: "deployed"}}}
+
+	detector.checkAllOrphans()
+	detector.checkAllOrphans()
+	if len(notifier.reports) != 1 {
+		t.Fatalf("expected the orphan notified once, got %+v", notifier.reports)
+	}
+
+	detector.inspector = &fakeInspector{}
+	detector.checkAllOrphans()
+	if len(notifier.reports) != 2 || notifier.reports[1].DriftType != DriftTypeResolved || notifier.reports[1].ReleaseName != "old" {
+		t.Errorf("expected the removed orphan resolved, got %+v", notifier.reports)
+	}
+}
+
+func TestRestoreSeen(t *testing.T) {
+	detector := NewDetector(nil, time.Minute, zap.NewNop())
+	notifier := &MockNotifier{}
+	detector.AddNotifier(notifier)
+
+	report := DriftReport{ReleaseName: "web", DriftType: DriftTypeConfiguration, Diff: "+ replicas: 3"}
+	report.Fingerprint = Fingerprint(report)
+	detector.Restore([]DriftReport{report}, nil)
+
+	detector.handleCheckedReport(report)
+	if len(notifier.reports) != 0 {
+		t.Errorf("expected drift notified before a restart not notified again, got %+v", notifier.reports)
+	}
+}
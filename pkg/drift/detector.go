@@ -2,17 +2,31 @@ package drift
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	mathrand "math/rand"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/redact"
 	"go.uber.org/zap"
 )
 
+// ReleaseInspector compares desired releases against the cluster
+type ReleaseInspector interface {
+	ReleaseExists(release helmstate.Release) (bool, error)
+	DiffRelease(release helmstate.Release) (string, error)
+	FindOrphans() ([]helmstate.DeployedRelease, error)
+}
+
 // Detector monitors for configuration drift between desired and actual state
 type Detector struct {
 	manager    *helmstate.Manager
+	inspector  ReleaseInspector
 	interval   time.Duration
 	autoHeal   bool
 	notifiers  []Notifier
@@ -23,20 +37,70 @@ type Detector struct {
 	mu         sync.RWMutex
 	running    bool
 	healFunc   func(releaseName string) error
+	orphans    bool
+	pruneFunc  func(name, namespace, kubeContext string) error
+	jitter     float64
+	stagger    bool
+	rand       *mathrand.Rand
+	policy     HealPolicy
+	preview    func(string) (string, error)
+	pending    map[string]DriftReport // report ID -> report awaiting approval
+	history    []DriftReport
+	onChange   func()
+	onCheck    func(err error)
+	seen       map[string]seenDrift // namespace/name -> drift last notified
+	flapWindow time.Duration
+	redactor   *redact.Redactor
+	workers    int
+	metrics    SweepMetrics
+	precheck   bool
+	wake       chan struct{}   // reschedules a running detector's checks
+	disabled   map[string]bool // names of releases not checked periodically
+	paused     bool
+
+	// sweepMu serializes sweeps and orphan checks, so a release isn't
+	// checked and healed or pruned by the monitoring loop and CheckNow at once
+	sweepMu sync.Mutex
 }
 
+// maxHistory bounds the number of recent reports kept in memory
+const maxHistory = 100
+
+// ErrReportNotFound is returned when a drift report ID is unknown
+var ErrReportNotFound = errors.New("drift report not found")
+
+// ErrReleaseNotFound is returned when a release to check isn't installed
+var ErrReleaseNotFound = errors.New("release not found")
+
 // NewDetector creates a new drift detector
 func NewDetector(manager *helmstate.Manager, interval time.Duration, logger *zap.Logger) *Detector {
 	return &Detector{
 		manager:   manager,
+		inspector: manager,
 		interval:  interval,
 		autoHeal:  false,
 		notifiers: make([]Notifier, 0),
 		logger:    logger,
 		running:   false,
+		rand:      mathrand.New(mathrand.NewSource(time.Now().UnixNano())),
+		pending:   make(map[string]DriftReport),
+		precheck:  true,
+		seen:      make(map[string]seenDrift),
+		workers:   DefaultWorkers,
+		wake:      make(chan struct{}, 1),
+		disabled:  make(map[string]bool),
 	}
 }
 
+// SetInspector replaces what compares releases with the cluster, the
+// manager by default, such as with a sync.DriftInspector rendering them as
+// they are synced
+func (d *Detector) SetInspector(inspector ReleaseInspector) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.inspector = inspector
+}
+
 // AddNotifier adds a notification handler for drift reports
 func (d *Detector) AddNotifier(n Notifier) {
 	d.mu.Lock()
@@ -44,6 +108,13 @@ func (d *Detector) AddNotifier(n Notifier) {
 	d.notifiers = append(d.notifiers, n)
 }
 
+// SetNotifiers replaces the notification handlers for drift reports
+func (d *Detector) SetNotifiers(notifiers []Notifier) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.notifiers = append([]Notifier(nil), notifiers...)
+}
+
 // EnableAutoHeal enables or disables automatic healing of drift
 func (d *Detector) EnableAutoHeal(enable bool, healFunc func(string) error) {
 	d.mu.Lock()
@@ -52,6 +123,241 @@ func (d *Detector) EnableAutoHeal(enable bool, healFunc func(string) error) {
 	d.healFunc = healFunc
 }
 
+// SetAutoHeal turns automatic healing on or off, keeping the heal function
+// set with EnableAutoHeal
+func (d *Detector) SetAutoHeal(enable bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.autoHeal = enable
+}
+
+// AutoHeal reports whether drift is healed automatically
+func (d *Detector) AutoHeal() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.autoHeal && d.healFunc != nil
+}
+
+// SetHealPolicy restricts which drift is healed automatically. Drift the
+// policy rejects is held until approved with Heal.
+func (d *Detector) SetHealPolicy(policy HealPolicy) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.policy = policy
+}
+
+// EnableHealPreview runs previewFunc, a dry-run of the heal, before healing and
+// attaches the predicted changes to the report. Drift whose dry-run fails is
+// held for approval instead of being healed automatically.
+func (d *Detector) EnableHealPreview(previewFunc func(releaseName string) (string, error)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.preview = previewFunc
+}
+
+// SetRedactor masks the secrets r knows, such as values resolved for
+// releases, in diffs besides the data of Secrets
+func (d *Detector) SetRedactor(r *redact.Redactor) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.redactor = r
+}
+
+// redact masks the secrets the redactor knows in s
+func (d *Detector) redact(s string) string {
+	d.mu.RLock()
+	r := d.redactor
+	d.mu.RUnlock()
+	return r.String(s)
+}
+
+// OnChange calls fn whenever the report history or the reports awaiting
+// approval change, so they can be persisted
+func (d *Detector) OnChange(fn func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onChange = fn
+}
+
+// Restore replaces the report history and the reports awaiting approval,
+// such as with those saved before a restart
+func (d *Detector) Restore(history, pending []DriftReport) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(history) > maxHistory {
+		history = history[len(history)-maxHistory:]
+	}
+	d.history = append([]DriftReport(nil), history...)
+	d.pending = make(map[string]DriftReport, len(pending))
+	for _, report := range pending {
+		d.pending[report.ID] = report
+	}
+	d.restoreSeen()
+}
+
+// OnCheck calls fn with the outcome of each query of the cluster, nil when
+// it succeeded, so that failures which are otherwise only logged, such as
+// expired credentials, can be acted on
+func (d *Detector) OnCheck(fn func(err error)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onCheck = fn
+}
+
+// checked calls the OnCheck function; d.mu must not be held
+func (d *Detector) checked(err error) {
+	d.mu.RLock()
+	fn := d.onCheck
+	d.mu.RUnlock()
+	if fn != nil {
+		fn(err)
+	}
+}
+
+// Notify sends a report to all notifiers without recording it as drift,
+// for conditions that keep drift from being detected
+func (d *Detector) Notify(report DriftReport) {
+	d.mu.RLock()
+	notifiers := append([]Notifier(nil), d.notifiers...)
+	d.mu.RUnlock()
+	d.notify(notifiers, report)
+}
+
+// changed calls the OnChange function; d.mu must not be held
+func (d *Detector) changed() {
+	d.mu.RLock()
+	fn := d.onChange
+	d.mu.RUnlock()
+	if fn != nil {
+		fn()
+	}
+}
+
+// PendingReports returns reports awaiting manual heal approval
+func (d *Detector) PendingReports() []DriftReport {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	reports := make([]DriftReport, 0, len(d.pending))
+	for _, report := range d.pending {
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Timestamp.Before(reports[j].Timestamp)
+	})
+	return reports
+}
+
+// Reports returns the most recent drift reports, oldest first
+func (d *Detector) Reports() []DriftReport {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	reports := make([]DriftReport, len(d.history))
+	copy(reports, d.history)
+	return reports
+}
+
+// Heal applies a drift report held for manual approval
+func (d *Detector) Heal(id string) (DriftReport, error) {
+	d.mu.Lock()
+	report, ok := d.pending[id]
+	if ok {
+		delete(d.pending, id)
+	}
+	healFunc := d.healFunc
+	notifiers := make([]Notifier, len(d.notifiers))
+	copy(notifiers, d.notifiers)
+	d.mu.Unlock()
+
+	if !ok {
+		return DriftReport{}, fmt.Errorf("%w: %s", ErrReportNotFound, id)
+	}
+	if healFunc == nil {
+		d.setPending(report)
+		return DriftReport{}, fmt.Errorf("healing not configured")
+	}
+
+	d.logger.Info("healing approved drift",
+		zap.String("id", id),
+		zap.String("release", report.ReleaseName))
+
+	report.PendingApproval = false
+	healed, err := d.healReport(report, healFunc, notifiers, true)
+	if err != nil {
+		report.PendingApproval = true
+		d.setPending(report)
+		return DriftReport{}, err
+	}
+
+	d.forget(healed.ReleaseName, healed.Namespace)
+	d.record(healed)
+	return healed, nil
+}
+
+// setPending holds a report for approval, replacing older reports for the release
+func (d *Detector) setPending(report DriftReport) {
+	d.mu.Lock()
+	for id, pending := range d.pending {
+		if pending.ReleaseName == report.ReleaseName && pending.Namespace == report.Namespace {
+			delete(d.pending, id)
+		}
+	}
+	d.pending[report.ID] = report
+	d.mu.Unlock()
+
+	d.changed()
+}
+
+// clearPending drops pending reports for a release that no longer drifts
+func (d *Detector) clearPending(release helmstate.Release) {
+	d.mu.Lock()
+	cleared := false
+	for id, pending := range d.pending {
+		if pending.ReleaseName == release.Name && pending.Namespace == release.Namespace {
+			delete(d.pending, id)
+			cleared = true
+		}
+	}
+	d.mu.Unlock()
+
+	if cleared {
+		d.changed()
+	}
+}
+
+// record appends a report to the bounded history
+func (d *Detector) record(report DriftReport) {
+	d.mu.Lock()
+	d.history = append(d.history, report)
+	if len(d.history) > maxHistory {
+		d.history = d.history[len(d.history)-maxHistory:]
+	}
+	d.mu.Unlock()
+
+	d.changed()
+}
+
+// newReportID returns a random identifier for a drift report
+func newReportID() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// EnableOrphanDetection enables reporting of releases deployed in the target
+// namespaces but missing from the helmfile. When pruneFunc is set, orphans are
+// uninstalled with it, from the kubeconfig context they were found in.
+func (d *Detector) EnableOrphanDetection(enable bool, pruneFunc func(name, namespace, kubeContext string) error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.orphans = enable
+	d.pruneFunc = pruneFunc
+}
+
 // Start begins the drift detection monitoring loop
 func (d *Detector) Start(ctx context.Context) error {
 	d.mu.Lock()
@@ -65,7 +371,7 @@ func (d *Detector) Start(ctx context.Context) error {
 	d.mu.Unlock()
 
 	d.logger.Info("starting drift detector",
-		zap.Duration("interval", d.interval),
+		zap.Duration("interval", d.Interval()),
 		zap.Bool("autoHeal", d.autoHeal))
 
 	d.wg.Add(1)
@@ -94,23 +400,94 @@ func (d *Detector) Stop() error {
 	return nil
 }
 
-// run is the main monitoring loop
+// SetPaused suspends or resumes periodic checks and automatic healing and
+// pruning. Checks due while paused run when resumed; checks asked for with
+// CheckNow still run but only report.
+func (d *Detector) SetPaused(paused bool) {
+	d.mu.Lock()
+	d.paused = paused
+	d.mu.Unlock()
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Paused reports whether the detector is paused
+func (d *Detector) Paused() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.paused
+}
+
+// run is the main monitoring loop. Each release is checked on its own
+// schedule; see schedule.go.
 func (d *Detector) run() {
 	defer d.wg.Done()
 
-	ticker := time.NewTicker(d.interval)
-	defer ticker.Stop()
-
-	// Run initial check
-	d.checkDrift()
+	due := make(map[string]time.Time)
+	nextOrphanCheck := time.Now()
 
 	for {
+		if d.Paused() {
+			select {
+			case <-d.ctx.Done():
+				d.logger.Info("drift detector context cancelled")
+				return
+			case <-d.wake:
+			}
+			continue
+		}
+
+		now := time.Now()
+		releases := d.enabledReleases()
+		d.scheduleReleases(due, releases, now)
+
+		var dueNow []helmstate.Release
+		for _, release := range releases {
+			if !due[releaseKey(release)].After(now) {
+				dueNow = append(dueNow, release)
+			}
+		}
+		d.sweep(dueNow)
+		for _, release := range dueNow {
+			due[releaseKey(release)] = time.Now().Add(d.nextDelay(d.releaseInterval(release)))
+		}
+
+		d.mu.RLock()
+		orphans := d.orphans
+		d.mu.RUnlock()
+
+		if orphans && !nextOrphanCheck.After(now) {
+			d.checkAllOrphans()
+			nextOrphanCheck = time.Now().Add(d.nextDelay(d.Interval()))
+		}
+
+		next := time.Now().Add(d.Interval())
+		for _, t := range due {
+			if t.Before(next) {
+				next = t
+			}
+		}
+		if orphans && nextOrphanCheck.Before(next) {
+			next = nextOrphanCheck
+		}
+
+		timer := time.NewTimer(time.Until(next))
 		select {
 		case <-d.ctx.Done():
+			timer.Stop()
 			d.logger.Info("drift detector context cancelled")
 			return
-		case <-ticker.C:
-			d.checkDrift()
+		case <-d.wake:
+			timer.Stop()
+			now := time.Now()
+			capSchedule(due, releases, now, d.releaseInterval)
+			if limit := now.Add(d.Interval()); nextOrphanCheck.After(limit) {
+				nextOrphanCheck = limit
+			}
+		case <-timer.C:
 		}
 	}
 }
@@ -130,39 +507,171 @@ func (d *Detector) checkDrift() {
 		return
 	}
 
+	var installed []helmstate.Release
 	for _, release := range releases {
 		// Skip releases that are not installed
-		if !d.manager.IsReleaseInstalled(release) {
-			continue
+		if d.manager.IsReleaseInstalled(release) {
+			installed = append(installed, release)
 		}
+	}
+	d.sweep(installed)
+
+	d.mu.RLock()
+	orphans := d.orphans
+	d.mu.RUnlock()
+
+	if orphans {
+		d.checkAllOrphans()
+	}
+}
+
+// checkRelease checks a single release and handles any drift found
+func (d *Detector) checkRelease(release helmstate.Release) *DriftReport {
+	return d.handleInspection(d.inspect(release))
+}
+
+// checkAllOrphans checks for orphans and handles those found
+func (d *Detector) checkAllOrphans() []DriftReport {
+	d.sweepMu.Lock()
+	defer d.sweepMu.Unlock()
+
+	found, err := d.checkOrphans()
+	if err != nil {
+		return nil
+	}
+	d.resolveOrphans(found, time.Now())
+
+	reports := make([]DriftReport, 0, len(found))
+	for _, report := range found {
+		reports = append(reports, d.handleCheckedReport(report))
+	}
+	return reports
+}
 
-		report := d.checkReleaseDrift(release)
-		if report != nil {
-			d.handleDriftReport(*report)
+// CheckNow runs an immediate drift check outside the monitoring loop and
+// returns the resulting reports. An empty releaseName checks every installed
+// release not disabled with SetReleaseEnabled and, if enabled, orphans;
+// otherwise only the named release is checked.
+func (d *Detector) CheckNow(releaseName string) ([]DriftReport, error) {
+	if d.manager == nil {
+		return nil, fmt.Errorf("no helmfile loaded")
+	}
+
+	var releases []helmstate.Release
+	for _, release := range d.installedReleases() {
+		if releaseName == "" && d.ReleaseEnabled(release.Name) || release.Name == releaseName {
+			releases = append(releases, release)
 		}
 	}
+	if releaseName != "" && len(releases) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrReleaseNotFound, releaseName)
+	}
+
+	reports := append(make([]DriftReport, 0), d.sweep(releases)...)
+	if releaseName != "" {
+		return reports, nil
+	}
+
+	d.mu.RLock()
+	orphans := d.orphans
+	d.mu.RUnlock()
+
+	if orphans {
+		reports = append(reports, d.checkAllOrphans()...)
+	}
+
+	return reports, nil
+}
+
+// checkOrphans reports releases in the cluster that the helmfile does not define
+func (d *Detector) checkOrphans() ([]DriftReport, error) {
+	orphans, err := d.inspector.FindOrphans()
+	d.checked(err)
+	if err != nil {
+		d.logger.Error("failed to check for orphaned releases", zap.Error(err))
+		return nil, err
+	}
+
+	reports := make([]DriftReport, 0, len(orphans))
+	for _, orphan := range orphans {
+		d.logger.Info("orphaned release detected",
+			zap.String("release", orphan.Name),
+			zap.String("namespace", orphan.Namespace))
+
+		reports = append(reports, DriftReport{
+			Timestamp:   time.Now(),
+			ReleaseName: orphan.Name,
+			Namespace:   orphan.Namespace,
+			KubeContext: orphan.KubeContext,
+			DriftType:   DriftTypeOrphan,
+			Severity:    SeverityLow,
+			Details:     fmt.Sprintf("Release not defined in helmfile (chart %s, status %s)", orphan.Chart, orphan.Status),
+		})
+	}
+	return reports, nil
+}
+
+// checkReleaseDrift checks a single release for drift, returning nil when
+// there's none and an error when the release couldn't be checked
+func (d *Detector) checkReleaseDrift(release helmstate.Release) (*DriftReport, error) {
+	report, _, err := d.examine(release)
+	return report, err
 }
 
-// checkReleaseDrift checks a single release for drift
-func (d *Detector) checkReleaseDrift(release helmstate.Release) *DriftReport {
+// examine is checkReleaseDrift, also reporting whether the diff was skipped
+// because the release's manifests matched
+func (d *Detector) examine(release helmstate.Release) (_ *DriftReport, skipped bool, err error) {
 	d.logger.Debug("checking release for drift",
 		zap.String("release", release.Name),
 		zap.String("namespace", release.Namespace))
 
+	// A release missing from the cluster was uninstalled out-of-band
+	exists, err := d.inspector.ReleaseExists(release)
+	d.checked(err)
+	if err != nil {
+		d.logger.Error("failed to check release status",
+			zap.String("release", release.Name),
+			zap.Error(err))
+		return nil, false, err
+	}
+
+	if !exists {
+		d.logger.Info("release missing from cluster",
+			zap.String("release", release.Name),
+			zap.String("namespace", release.Namespace))
+
+		return &DriftReport{
+			Timestamp:   time.Now(),
+			ReleaseName: release.Name,
+			Namespace:   release.Namespace,
+			DriftType:   DriftTypeDeletion,
+			Severity:    SeverityHigh,
+			Details:     "Release not found in cluster",
+			Healed:      false,
+		}, false, nil
+	}
+
+	if d.manifestsMatch(release) {
+		d.logger.Debug("no drift detected, manifests match",
+			zap.String("release", release.Name))
+		return nil, true, nil
+	}
+
 	// Get the diff output
-	diff, err := d.manager.DiffRelease(release)
+	diff, err := d.inspector.DiffRelease(release)
+	d.checked(err)
 	if err != nil {
 		d.logger.Error("failed to diff release",
 			zap.String("release", release.Name),
 			zap.Error(err))
-		return nil
+		return nil, false, err
 	}
 
 	// If diff is empty, no drift detected
 	if diff == "" {
 		d.logger.Debug("no drift detected",
 			zap.String("release", release.Name))
-		return nil
+		return nil, false, nil
 	}
 
 	// Drift detected - create report
@@ -170,16 +679,29 @@ func (d *Detector) checkReleaseDrift(release helmstate.Release) *DriftReport {
 		zap.String("release", release.Name),
 		zap.String("namespace", release.Namespace))
 
-	return &DriftReport{
+	// Secret data never leaves the detector
+	hunks := RedactSecrets(ParseDiff(d.redact(diff)))
+
+	report := &DriftReport{
 		Timestamp:   time.Now(),
 		ReleaseName: release.Name,
 		Namespace:   release.Namespace,
 		DriftType:   d.classifyDrift(diff),
 		Severity:    d.calculateSeverity(diff),
 		Details:     "Configuration drift detected",
-		Diff:        diff,
+		Diff:        RenderDiff(hunks),
+		Hunks:       hunks,
 		Healed:      false,
 	}
+
+	// Changed values point at the helmfile, unchanged ones at the cluster
+	d.explainByValues(release, report)
+
+	// The drift may be a GitOps controller applying its own version
+	if report.ManagedBy = d.gitOpsOwners(release); len(report.ManagedBy) > 0 {
+		report.Details = fmt.Sprintf("%s; resources also managed by %s", report.Details, ownerList(report.ManagedBy))
+	}
+	return report, false, nil
 }
 
 // classifyDrift determines the type of drift from the diff output
@@ -202,47 +724,186 @@ func (d *Detector) calculateSeverity(diff string) Severity {
 	return SeverityLow
 }
 
-// handleDriftReport processes a drift report
-func (d *Detector) handleDriftReport(report DriftReport) {
-	// Notify all registered notifiers
+// handleDriftReport processes a drift report, notifying and healing as
+// configured, and returns the report in its final state
+func (d *Detector) handleDriftReport(report DriftReport) DriftReport {
+	if report.ID == "" {
+		report.ID = newReportID()
+	}
+
+	if report.Fingerprint == "" {
+		report.Fingerprint = Fingerprint(report)
+	}
+
+	report = d.processDriftReport(report, true)
+	d.record(report)
+	return report
+}
+
+// handleCheckedReport handles a report of drift found by a check. Drift
+// already notified and found again unchanged isn't notified again, and
+// keeps the ID it awaits approval under.
+func (d *Detector) handleCheckedReport(report DriftReport) DriftReport {
+	report.Fingerprint = Fingerprint(report)
+	notify := d.observe(report)
+	if !notify {
+		d.logger.Debug("drift unchanged since notified",
+			zap.String("release", report.ReleaseName),
+			zap.String("fingerprint", report.Fingerprint))
+		report.ID = d.pendingID(report)
+	}
+	if report.ID == "" {
+		report.ID = newReportID()
+	}
+
+	report = d.processDriftReport(report, notify)
+	d.record(report)
+	return report
+}
+
+// pendingID returns the ID the same drift awaits approval under, if any
+func (d *Detector) pendingID(report DriftReport) string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for id, pending := range d.pending {
+		if pending.ReleaseName == report.ReleaseName && pending.Namespace == report.Namespace && pending.Fingerprint == report.Fingerprint {
+			return id
+		}
+	}
+	return ""
+}
+
+// processDriftReport notifies about a report, unless notify is false, and
+// heals or prunes it as configured. Heals and prunes are always notified.
+func (d *Detector) processDriftReport(report DriftReport, notify bool) DriftReport {
 	d.mu.RLock()
 	notifiers := make([]Notifier, len(d.notifiers))
 	copy(notifiers, d.notifiers)
-	autoHeal := d.autoHeal
+	autoHeal := d.autoHeal && !d.paused
 	healFunc := d.healFunc
+	pruneFunc := d.pruneFunc
+	if d.paused {
+		pruneFunc = nil
+	}
+	policy := d.policy
+	previewFunc := d.preview
 	d.mu.RUnlock()
 
-	for _, notifier := range notifiers {
-		if err := notifier.Notify(report); err != nil {
-			d.logger.Error("failed to notify",
+	if report.DriftType != DriftTypeOrphan && autoHeal && healFunc != nil {
+		hold := ""
+
+		// Predict what healing would change before applying it
+		if previewFunc != nil {
+			preview, err := previewFunc(report.ReleaseName)
+			if err != nil {
+				d.logger.Warn("heal dry-run failed",
+					zap.String("release", report.ReleaseName),
+					zap.Error(err))
+				hold = fmt.Sprintf("heal dry-run failed: %v", err)
+			}
+			report.HealPreview = RedactDiff(d.redact(preview))
+		}
+
+		// Hold drift the policy doesn't allow healing automatically
+		if hold == "" {
+			if ok, reason := policy.AllowsAutoHeal(report); !ok {
+				hold = reason
+			}
+		}
+
+		if hold != "" {
+			d.logger.Info("auto-heal held for approval",
+				zap.String("id", report.ID),
+				zap.String("release", report.ReleaseName),
+				zap.String("reason", hold))
+
+			report.PendingApproval = true
+			report.Details = fmt.Sprintf("%s; awaiting heal approval (%s)", report.Details, hold)
+			d.setPending(report)
+		}
+	}
+
+	// Notify all registered notifiers
+	if notify {
+		d.notify(notifiers, report)
+	}
+
+	// Orphans are only removed when pruning is enabled
+	if report.DriftType == DriftTypeOrphan {
+		if pruneFunc == nil {
+			return report
+		}
+
+		d.logger.Info("pruning orphaned release",
+			zap.String("release", report.ReleaseName),
+			zap.String("namespace", report.Namespace))
+
+		if err := pruneFunc(report.ReleaseName, report.Namespace, report.KubeContext); err != nil {
+			d.logger.Error("prune failed",
 				zap.String("release", report.ReleaseName),
 				zap.Error(err))
+			return report
 		}
+
+		report.Healed = true
+		report.Details = "Orphaned release pruned"
+		d.forget(report.ReleaseName, report.Namespace)
+		d.notify(notifiers, report)
+		return report
 	}
 
 	// Auto-heal if enabled
-	if autoHeal && healFunc != nil {
+	if autoHeal && healFunc != nil && !report.PendingApproval {
 		d.logger.Info("attempting auto-heal",
 			zap.String("release", report.ReleaseName))
 
-		if err := healFunc(report.ReleaseName); err != nil {
-			d.logger.Error("auto-heal failed",
+		if healed, err := d.healReport(report, healFunc, notifiers, false); err == nil {
+			return healed
+		}
+	}
+
+	return report
+}
+
+// healReport runs the heal function for a report and notifies on success,
+// as healed after approval when approved or else as auto-healed
+func (d *Detector) healReport(report DriftReport, healFunc func(string) error, notifiers []Notifier, approved bool) (DriftReport, error) {
+	if err := healFunc(report.ReleaseName); err != nil {
+		d.logger.Error("heal failed",
+			zap.String("release", report.ReleaseName),
+			zap.Error(err))
+		return report, err
+	}
+
+	d.logger.Info("heal successful",
+		zap.String("release", report.ReleaseName))
+
+	// Update report and re-notify
+	d.forget(report.ReleaseName, report.Namespace)
+	report.Healed = true
+	switch {
+	case report.DriftType == DriftTypeDeletion && approved:
+		report.Details = "Deleted release reinstalled after approval"
+	case report.DriftType == DriftTypeDeletion:
+		report.Details = "Deleted release reinstalled by auto-heal"
+	case approved:
+		report.Details = "Configuration drift healed after approval"
+	default:
+		report.Details = "Configuration drift detected and auto-healed"
+	}
+	d.notify(notifiers, report)
+
+	return report, nil
+}
+
+// notify sends a report to all notifiers, logging failures
+func (d *Detector) notify(notifiers []Notifier, report DriftReport) {
+	for _, notifier := range notifiers {
+		if err := notifier.Notify(report); err != nil {
+			d.logger.Error("failed to notify",
 				zap.String("release", report.ReleaseName),
+				zap.Bool("healed", report.Healed),
 				zap.Error(err))
-		} else {
-			d.logger.Info("auto-heal successful",
-				zap.String("release", report.ReleaseName))
-
-			// Update report and re-notify
-			report.Healed = true
-			report.Details = "Configuration drift detected and auto-healed"
-			for _, notifier := range notifiers {
-				if err := notifier.Notify(report); err != nil {
-					d.logger.Error("failed to notify heal success",
-						zap.String("release", report.ReleaseName),
-						zap.Error(err))
-				}
-			}
 		}
 	}
 }
@@ -2,9 +2,12 @@ package drift
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
 	"go.uber.org/zap"
 )
 
@@ -18,6 +21,25 @@ func (m *MockNotifier) Notify(report DriftReport) error {
 	return nil
 }
 
+// fakeInspector returns canned release state for tests
+type fakeInspector struct {
+	exists  bool
+	diff    string
+	orphans []helmstate.DeployedRelease
+}
+
+func (f *fakeInspector) ReleaseExists(helmstate.Release) (bool, error) {
+	return f.exists, nil
+}
+
+func (f *fakeInspector) DiffRelease(helmstate.Release) (string, error) {
+	return f.diff, nil
+}
+
+func (f *fakeInspector) FindOrphans() ([]helmstate.DeployedRelease, error) {
+	return f.orphans, nil
+}
+
 func TestNewDetector(t *testing.T) {
 	logger, _ := zap.NewDevelopment()
 	detector := NewDetector(nil, 30*time.Second, logger)
@@ -64,6 +86,15 @@ func TestEnableAutoHeal(t *testing.T) {
 	if detector.healFunc == nil {
 		t.Error("expected healFunc to be set")
 	}
+
+	detector.SetAutoHeal(false)
+	if detector.AutoHeal() || detector.healFunc == nil {
+		t.Error("expected auto-heal to be off with healFunc kept")
+	}
+	detector.SetAutoHeal(true)
+	if !detector.AutoHeal() {
+		t.Error("expected auto-heal to be back on")
+	}
 }
 
 func TestDetectorStartStop(t *testing.T) {
@@ -137,3 +168,288 @@ func TestCalculateSeverity(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckReleaseDriftDeleted(t *testing.T) {
+	detector := NewDetector(nil, 30*time.Second, zap.NewNop())
+	detector.inspector = &fakeInspector{exists: false}
+
+	report, err := detector.checkReleaseDrift(helmstate.Release{Name: "nginx", Namespace: "web"})
+	if err != nil || report == nil {
+		t.Fatal("expected drift report for deleted release")
+	}
+	if report.DriftType != DriftTypeDeletion {
+		t.Errorf("expected DriftTypeDeletion, got %s", report.DriftType)
+	}
+	if report.Severity != SeverityHigh {
+		t.Errorf("expected SeverityHigh, got %s", report.Severity)
+	}
+}
+
+func TestCheckReleaseDriftNoDrift(t *testing.T) {
+	detector := NewDetector(nil, 30*time.Second, zap.NewNop())
+	detector.inspector = &fakeInspector{exists: true}
+
+	if report, err := detector.checkReleaseDrift(helmstate.Release{Name: "nginx"}); err != nil || report != nil {
+		t.Errorf("expected no drift, got %+v", report)
+	}
+}
+
+func TestHandleDeletionAutoHeal(t *testing.T) {
+	detector := NewDetector(nil, 30*time.Second, zap.NewNop())
+	notifier := &MockNotifier{}
+	detector.AddNotifier(notifier)
+
+	var healed string
+	detector.EnableAutoHeal(true, func(releaseName string) error {
+		healed = releaseName
+		return nil
+	})
+
+	detector.handleDriftReport(DriftReport{
+		ReleaseName: "nginx",
+		DriftType:   DriftTypeDeletion,
+		Severity:    SeverityHigh,
+	})
+
+	if healed != "nginx" {
+		t.Errorf("expected nginx to be reinstalled, got %q", healed)
+	}
+	if len(notifier.reports) != 2 || !notifier.reports[1].Healed {
+		t.Errorf("expected detection and heal notifications, got %+v", notifier.reports)
+	}
+}
+
+func TestCheckOrphans(t *testing.T) {
+	detector := NewDetector(nil, 30*time.Second, zap.NewNop())
+	detector.inspector = &fakeInspector{orphans: []helmstate.DeployedRelease{
+		{Name: "old-experiment", Namespace: "default", Chart: "nginx-13.2.0", Status: "deployed"},
+	}}
+
+	reports, err := detector.checkOrphans()
+	if err != nil || len(reports) != 1 {
+		t.Fatalf("expected 1 orphan report, got %d", len(reports))
+	}
+	if reports[0].DriftType != DriftTypeOrphan {
+		t.Errorf("expected DriftTypeOrphan, got %s", reports[0].DriftType)
+	}
+	if reports[0].ReleaseName != "old-experiment" {
+		t.Errorf("expected old-experiment, got %s", reports[0].ReleaseName)
+	}
+}
+
+func TestHandleOrphanPrune(t *testing.T) {
+	detector := NewDetector(nil, 30*time.Second, zap.NewNop())
+	notifier := &MockNotifier{}
+	detector.AddNotifier(notifier)
+
+	healCalled := false
+	detector.EnableAutoHeal(true, func(string) error {
+		healCalled = true
+		return nil
+	})
+
+	report := DriftReport{ReleaseName: "old-experiment", Namespace: "default", DriftType: DriftTypeOrphan}
+
+	// Without prune, orphans are only reported
+	detector.EnableOrphanDetection(true, nil)
+	detector.handleDriftReport(report)
+	if len(notifier.reports) != 1 {
+		t.Fatalf("expected 1 notification, got %d", len(notifier.reports))
+	}
+
+	var pruned string
+	detector.EnableOrphanDetection(true, func(name, namespace, kubeContext string) error {
+		pruned = namespace + "/" + name
+		return nil
+	})
+	detector.handleDriftReport(report)
+
+	if pruned != "default/old-experiment" {
+		t.Errorf("expected default/old-experiment to be pruned, got %q", pruned)
+	}
+	if healCalled {
+		t.Error("expected orphan not to be passed to heal function")
+	}
+	if len(notifier.reports) != 3 || !notifier.reports[2].Healed {
+		t.Errorf("expected prune notification, got %+v", notifier.reports)
+	}
+}
+
+func TestPausedDetectorDoesNotHeal(t *testing.T) {
+	manager := helmstate.NewManager("", "")
+	manager.Spec = &helmstate.HelmfileSpec{Releases: []helmstate.Release{{Name: "nginx"}}}
+
+	detector := NewDetector(manager, time.Hour, zap.NewNop())
+	detector.inspector = &fakeInspector{exists: true, diff: "- replicas: 1\n+ replicas: 3"}
+	healed := 0
+	detector.EnableAutoHeal(true, func(string) error {
+		healed++
+		return nil
+	})
+	detector.SetPaused(true)
+
+	reports, err := detector.CheckNow("nginx")
+	if err != nil {
+		t.Fatalf("CheckNow failed: %v", err)
+	}
+	if len(reports) != 1 || reports[0].Healed || healed != 0 {
+		t.Errorf("expected drift to be reported but not healed while paused, got %+v", reports)
+	}
+}
+
+func TestCheckNow(t *testing.T) {
+	manager := helmstate.NewManager("", "")
+	manager.Spec = &helmstate.HelmfileSpec{
+		Releases: []helmstate.Release{{Name: "nginx"}, {Name: "redis"}},
+	}
+
+	detector := NewDetector(manager, time.Hour, zap.NewNop())
+	detector.inspector = &fakeInspector{exists: true, diff: "- replicas: 1\n+ replicas: 3"}
+
+	reports, err := detector.CheckNow("")
+	if err != nil {
+		t.Fatalf("CheckNow failed: %v", err)
+	}
+	if len(reports) != 2 {
+		t.Errorf("expected 2 reports, got %d", len(reports))
+	}
+
+	reports, err = detector.CheckNow("redis")
+	if err != nil {
+		t.Fatalf("CheckNow failed: %v", err)
+	}
+	if len(reports) != 1 || reports[0].ReleaseName != "redis" {
+		t.Errorf("expected single redis report, got %+v", reports)
+	}
+
+	if _, err := detector.CheckNow("missing"); err == nil {
+		t.Error("expected error for unknown release")
+	}
+}
+
+func TestHandleDriftHeldForApproval(t *testing.T) {
+	detector := NewDetector(nil, 30*time.Second, zap.NewNop())
+	notifier := &MockNotifier{}
+	detector.AddNotifier(notifier)
+
+	var healed []string
+	detector.EnableAutoHeal(true, func(releaseName string) error {
+		healed = append(healed, releaseName)
+		return nil
+	})
+	detector.SetHealPolicy(HealPolicy{MaxSeverity: SeverityMedium})
+
+	report := detector.handleDriftReport(DriftReport{
+		ReleaseName: "postgres",
+		Namespace:   "prod",
+		DriftType:   DriftTypeDeletion,
+		Severity:    SeverityHigh,
+	})
+
+	if !report.PendingApproval || report.Healed {
+		t.Fatalf("expected report to await approval, got %+v", report)
+	}
+	if len(healed) != 0 {
+		t.Fatalf("expected no auto-heal, got %v", healed)
+	}
+	if pending := detector.PendingReports(); len(pending) != 1 || pending[0].ID != report.ID {
+		t.Fatalf("expected report to be pending, got %+v", pending)
+	}
+
+	approved, err := detector.Heal(report.ID)
+	if err != nil {
+		t.Fatalf("Heal failed: %v", err)
+	}
+	if !approved.Healed || len(healed) != 1 {
+		t.Errorf("expected approved heal, got %+v (healed %v)", approved, healed)
+	}
+	if len(detector.PendingReports()) != 0 {
+		t.Error("expected no pending reports after approval")
+	}
+	if len(notifier.reports) != 2 || !notifier.reports[1].Healed {
+		t.Errorf("expected detection and heal notifications, got %+v", notifier.reports)
+	}
+	if approved.Details != "Deleted release reinstalled after approval" {
+		t.Errorf("expected the heal reported as approved, got %q", approved.Details)
+	}
+
+	if _, err := detector.Heal(report.ID); !errors.Is(err, ErrReportNotFound) {
+		t.Errorf("expected ErrReportNotFound, got %v", err)
+	}
+}
+
+func TestPendingClearedWhenDriftResolves(t *testing.T) {
+	detector := NewDetector(nil, 30*time.Second, zap.NewNop())
+	detector.EnableAutoHeal(true, func(string) error { return nil })
+	detector.SetHealPolicy(HealPolicy{ManualNamespaces: []string{"prod"}})
+
+	release := helmstate.Release{Name: "api", Namespace: "prod"}
+
+	detector.inspector = &fakeInspector{exists: true, diff: "- replicas: 1\n+ replicas: 3"}
+	detector.checkRelease(release)
+	detector.checkRelease(release)
+	if pending := detector.PendingReports(); len(pending) != 1 {
+		t.Fatalf("expected a single pending report per release, got %d", len(pending))
+	}
+
+	detector.inspector = &fakeInspector{exists: true}
+	detector.checkRelease(release)
+	if pending := detector.PendingReports(); len(pending) != 0 {
+		t.Errorf("expected pending report to be cleared, got %+v", pending)
+	}
+	if recent := detector.Reports(); len(recent) != 3 || recent[2].DriftType != DriftTypeResolved {
+		t.Errorf("expected 2 drift reports and a resolved one, got %+v", recent)
+	}
+}
+
+func TestHandleDriftHealPreview(t *testing.T) {
+	detector := NewDetector(nil, 30*time.Second, zap.NewNop())
+
+	healed := 0
+	detector.EnableAutoHeal(true, func(string) error {
+		healed++
+		return nil
+	})
+	detector.EnableHealPreview(func(releaseName string) (string, error) {
+		if releaseName == "broken" {
+			return "", fmt.Errorf("chart not found")
+		}
+		return "+ replicas: 3", nil
+	})
+
+	report := detector.handleDriftReport(DriftReport{ReleaseName: "api", DriftType: DriftTypeConfiguration, Severity: SeverityLow})
+	if report.HealPreview != "+ replicas: 3" {
+		t.Errorf("expected heal preview to be attached, got %q", report.HealPreview)
+	}
+	if !report.Healed || healed != 1 {
+		t.Errorf("expected report to be healed after preview, got %+v", report)
+	}
+
+	// A failed dry-run holds the heal for approval
+	report = detector.handleDriftReport(DriftReport{ReleaseName: "broken", DriftType: DriftTypeConfiguration, Severity: SeverityLow})
+	if !report.PendingApproval || report.Healed || healed != 1 {
+		t.Errorf("expected failed dry-run to hold heal, got %+v", report)
+	}
+}
+
+func TestOnChangeAndRestore(t *testing.T) {
+	detector := NewDetector(nil, 30*time.Second, zap.NewNop())
+	changes := 0
+	detector.OnChange(func() { changes++ })
+
+	detector.record(DriftReport{ID: "a", ReleaseName: "nginx"})
+	detector.setPending(DriftReport{ID: "b", ReleaseName: "api", PendingApproval: true})
+	detector.clearPending(helmstate.Release{Name: "nginx"})
+	if changes != 2 {
+		t.Errorf("expected a change per recorded and pending report only, got %d", changes)
+	}
+
+	restored := NewDetector(nil, 30*time.Second, zap.NewNop())
+	restored.Restore(detector.Reports(), detector.PendingReports())
+	if reports := restored.Reports(); len(reports) != 1 || reports[0].ID != "a" {
+		t.Errorf("expected history to be restored, got %+v", reports)
+	}
+	if _, err := restored.Heal("b"); errors.Is(err, ErrReportNotFound) {
+		t.Error("expected restored pending report to be approvable")
+	}
+}
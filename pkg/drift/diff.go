@@ -0,0 +1,129 @@
+package drift
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/oleksiyp/helmfire/pkg/redact"
+)
+
+// Changes of a DiffHunk
+const (
+	ChangeModified = "changed"
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+)
+
+// RedactedValue replaces Secret data in diffs
+const RedactedValue = redact.Mask
+
+// DiffHunk is the part of a helm diff about one resource
+type DiffHunk struct {
+	Namespace string   `json:"namespace,omitempty"`
+	Name      string   `json:"name,omitempty"`
+	Kind      string   `json:"kind,omitempty"`
+	Change    string   `json:"change,omitempty"`
+	Header    string   `json:"header,omitempty"`
+	Lines     []string `json:"lines"`
+}
+
+// hunkHeader matches the line helm diff starts each resource with, such as
+// "default, web, Deployment (apps) has changed:"
+var hunkHeader = regexp.MustCompile(`^(\S*), (\S+), (\S+) \(([^)]*)\) has (changed|been added|been removed)`)
+
+// ParseDiff splits helm diff output into a hunk per resource. Output before
+// the first resource, or in a format not recognized, is kept in a hunk
+// without a resource.
+func ParseDiff(diff string) []DiffHunk {
+	var hunks []DiffHunk
+	var current *DiffHunk
+	for _, line := range strings.Split(strings.TrimRight(diff, "\n"), "\n") {
+		if m := hunkHeader.FindStringSubmatch(line); m != nil {
+			hunks = append(hunks, DiffHunk{
+				Namespace: m[1],
+				Name:      m[2],
+				Kind:      m[3],
+				Change:    strings.TrimPrefix(m[5], "been "),
+				Header:    line,
+			})
+			current = &hunks[len(hunks)-1]
+			continue
+		}
+		if current == nil {
+			if line == "" {
+				continue
+			}
+			hunks = append(hunks, DiffHunk{})
+			current = &hunks[len(hunks)-1]
+		}
+		current.Lines = append(current.Lines, line)
+	}
+	return hunks
+}
+
+// RenderDiff turns hunks back into helm diff output
+func RenderDiff(hunks []DiffHunk) string {
+	var b strings.Builder
+	for _, hunk := range hunks {
+		if hunk.Header != "" {
+			b.WriteString(hunk.Header + "\n")
+		}
+		for _, line := range hunk.Lines {
+			b.WriteString(line + "\n")
+		}
+	}
+	return b.String()
+}
+
+// RedactSecrets replaces the values under data and stringData of the
+// Secrets in hunks, so their contents don't reach notifiers or logs
+func RedactSecrets(hunks []DiffHunk) []DiffHunk {
+	redacted := make([]DiffHunk, len(hunks))
+	for i, hunk := range hunks {
+		redacted[i] = hunk
+		if hunk.Kind != "Secret" {
+			continue
+		}
+		redacted[i].Lines = redact.DiffLines(hunk.Lines)
+	}
+	return redacted
+}
+
+// RedactDiff returns helm diff output with its Secret data redacted
+func RedactDiff(diff string) string {
+	if diff == "" || !strings.Contains(diff, "Secret") {
+		return diff
+	}
+	return RenderDiff(RedactSecrets(ParseDiff(diff)))
+}
+
+// ANSI colors of rendered diffs
+const (
+	colorReset  = "\x1b[0m"
+	colorBold   = "\x1b[1m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+)
+
+// HighlightDiff renders hunks for a terminal, with resource headers in
+// bold, additions green and removals red
+func HighlightDiff(hunks []DiffHunk) string {
+	var b strings.Builder
+	for _, hunk := range hunks {
+		if hunk.Header != "" {
+			b.WriteString(colorBold + colorYellow + hunk.Header + colorReset + "\n")
+		}
+		for _, line := range hunk.Lines {
+			switch {
+			case strings.HasPrefix(line, "+"):
+				b.WriteString(colorGreen + line + colorReset + "\n")
+			case strings.HasPrefix(line, "-"):
+				b.WriteString(colorRed + line + colorReset + "\n")
+			default:
+				b.WriteString(line + "\n")
+			}
+		}
+	}
+	return b.String()
+}
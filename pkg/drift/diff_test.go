@@ -0,0 +1,92 @@
+package drift
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"go.uber.org/zap"
+)
+
+const secretDiff = `default, web, Deployment (apps) has changed:
+  spec:
+-   replicas: 1
++   replicas: 3
+default, web-credentials, Secret (v1) has changed:
+  apiVersion: v1
+  data:
+-   password: aHVudGVyMg==
++   password: c2VjcmV0
+    username: YWRtaW4=
+  kind: Secret
+default, web-cache, ConfigMap (v1) has been added:
++ data:
++   size: 1Gi
+`
+
+func TestParseDiff(t *testing.T) {
+	hunks := ParseDiff(secretDiff)
+	if len(hunks) != 3 {
+		t.Fatalf("expected 3 hunks, got %+v", hunks)
+	}
+	want := []DiffHunk{
+		{Namespace: "default", Name: "web", Kind: "Deployment", Change: ChangeModified},
+		{Namespace: "default", Name: "web-credentials", Kind: "Secret", Change: ChangeModified},
+		{Namespace: "default", Name: "web-cache", Kind: "ConfigMap", Change: ChangeAdded},
+	}
+	for i, w := range want {
+		h := hunks[i]
+		if h.Namespace != w.Namespace || h.Name != w.Name || h.Kind != w.Kind || h.Change != w.Change {
+			t.Errorf("hunk %d: expected %+v, got %+v", i, w, h)
+		}
+	}
+	if len(hunks[0].Lines) != 3 {
+		t.Errorf("expected 3 lines in the Deployment hunk, got %q", hunks[0].Lines)
+	}
+	if got := RenderDiff(hunks); got != secretDiff {
+		t.Errorf("expected the diff rendered back unchanged, got:\n%s", got)
+	}
+
+	if hunks := ParseDiff("unexpected output\n"); len(hunks) != 1 || hunks[0].Kind != "" || hunks[0].Lines[0] != "unexpected output" {
+		t.Errorf("expected unrecognized output kept in a hunk without a resource, got %+v", hunks)
+	}
+}
+
+func TestRedactDiff(t *testing.T) {
+	got := RedactDiff(secretDiff)
+	for _, secret := range []string{"aHVudGVyMg==", "c2VjcmV0", "YWRtaW4="} {
+		if strings.Contains(got, secret) {
+			t.Errorf("expected %s redacted, got:\n%s", secret, got)
+		}
+	}
+	for _, line := range []string{"-   password: [redacted]", "+   password: [redacted]", "    username: [redacted]", "  kind: Secret", "+   replicas: 3", "+   size: 1Gi"} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("expected line %q, got:\n%s", line, got)
+		}
+	}
+
+	flow := "prod, token, Secret (v1) has been added:\n+ stringData: {token: abc123}\n+ type: Opaque\n"
+	if got := RedactDiff(flow); strings.Contains(got, "abc123") || !strings.Contains(got, "+ type: Opaque") {
+		t.Errorf("expected flow style data redacted, got:\n%s", got)
+	}
+}
+
+func TestCheckReleaseDriftRedactsSecrets(t *testing.T) {
+	detector := NewDetector(nil, 0, zap.NewNop())
+	detector.inspector = &fakeInspector{exists: true, diff: secretDiff}
+
+	report, err := detector.checkReleaseDrift(helmstate.Release{Name: "web"})
+	if err != nil || report == nil {
+		t.Fatalf("expected drift, got %v %v", report, err)
+	}
+	if strings.Contains(report.Diff, "c2VjcmV0") || len(report.Hunks) != 3 || strings.Contains(strings.Join(report.Hunks[1].Lines, "\n"), "c2VjcmV0") {
+		t.Errorf("expected secret data redacted from the diff and hunks, got %+v", report)
+	}
+}
+
+func TestHighlightDiff(t *testing.T) {
+	got := HighlightDiff(ParseDiff(secretDiff))
+	if !strings.Contains(got, colorGreen+"+   replicas: 3"+colorReset) || !strings.Contains(got, colorRed+"-   replicas: 1"+colorReset) {
+		t.Errorf("expected additions and removals colored, got %q", got)
+	}
+}
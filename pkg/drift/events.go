@@ -0,0 +1,181 @@
+package drift
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// eventComponent identifies helmfire as the source of Kubernetes events
+const eventComponent = "helmfire"
+
+// maxEventMessage is the longest message the API server accepts for an event
+const maxEventMessage = 1024
+
+// kubeEvent is the subset of a core/v1 Event that helmfire creates
+type kubeEvent struct {
+	APIVersion         string          `json:"apiVersion"`
+	Kind               string          `json:"kind"`
+	Metadata           kubeEventMeta   `json:"metadata"`
+	InvolvedObject     kubeObjectRef   `json:"involvedObject"`
+	Reason             string          `json:"reason"`
+	Message            string          `json:"message"`
+	Type               string          `json:"type"`
+	Count              int             `json:"count"`
+	FirstTimestamp     string          `json:"firstTimestamp"`
+	LastTimestamp      string          `json:"lastTimestamp"`
+	Source             kubeEventSource `json:"source"`
+	ReportingComponent string          `json:"reportingComponent"`
+}
+
+type kubeEventMeta struct {
+	GenerateName string            `json:"generateName"`
+	Namespace    string            `json:"namespace"`
+	Labels       map[string]string `json:"labels,omitempty"`
+}
+
+type kubeObjectRef struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace"`
+}
+
+type kubeEventSource struct {
+	Component string `json:"component"`
+}
+
+// KubeEventNotifier records drift reports as Kubernetes Events in the
+// release namespace, so they show up in kubectl get events and event
+// exporters. Events are created with kubectl.
+type KubeEventNotifier struct {
+	kubectl     string
+	kubeContext string
+	timeout     time.Duration
+	logger      *zap.Logger
+}
+
+// NewKubeEventNotifier creates a new Kubernetes event notifier
+func NewKubeEventNotifier(logger *zap.Logger) *KubeEventNotifier {
+	return &KubeEventNotifier{
+		kubectl: "kubectl",
+		timeout: 30 * time.Second,
+		logger:  logger,
+	}
+}
+
+// SetKubectl sets the kubectl binary used to create events
+func (n *KubeEventNotifier) SetKubectl(kubectl string) {
+	n.kubectl = kubectl
+}
+
+// SetKubeContext sets the kubeconfig context events are created in
+func (n *KubeEventNotifier) SetKubeContext(kubeContext string) {
+	n.kubeContext = kubeContext
+}
+
+// SetTimeout sets how long creating an event may take
+func (n *KubeEventNotifier) SetTimeout(timeout time.Duration) {
+	n.timeout = timeout
+}
+
+// Notify creates an Event for the report in the release namespace
+func (n *KubeEventNotifier) Notify(report DriftReport) error {
+	payload, err := json.Marshal(newKubeEvent(report))
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), n.timeout)
+	defer cancel()
+
+	args := []string{"create", "-f", "-", "-o", "name"}
+	if n.kubeContext != "" {
+		args = append([]string{"--context", n.kubeContext}, args...)
+	}
+
+	cmd := exec.CommandContext(ctx, n.kubectl, args...)
+	cmd.Stdin = bytes.NewReader(payload)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to create event: %w (stderr: %s)", err, stderr.String())
+	}
+
+	n.logger.Debug("kubernetes event created",
+		zap.String("release", report.ReleaseName),
+		zap.String("namespace", report.Namespace))
+
+	return nil
+}
+
+// newKubeEvent builds the Event for a drift report
+func newKubeEvent(report DriftReport) kubeEvent {
+	namespace := report.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	timestamp := report.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	reason, eventType := eventReason(report)
+
+	message := fmt.Sprintf("%s drift (%s severity): %s", report.DriftType, report.Severity, report.Details)
+	if len(message) > maxEventMessage {
+		message = message[:maxEventMessage-3] + "..."
+	}
+
+	return kubeEvent{
+		APIVersion: "v1",
+		Kind:       "Event",
+		Metadata: kubeEventMeta{
+			GenerateName: report.ReleaseName + ".",
+			Namespace:    namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by": eventComponent,
+			},
+		},
+		InvolvedObject: kubeObjectRef{
+			APIVersion: "helm.sh/v3",
+			Kind:       "Release",
+			Name:       report.ReleaseName,
+			Namespace:  namespace,
+		},
+		Reason:             reason,
+		Message:            message,
+		Type:               eventType,
+		Count:              1,
+		FirstTimestamp:     timestamp.UTC().Format(time.RFC3339),
+		LastTimestamp:      timestamp.UTC().Format(time.RFC3339),
+		Source:             kubeEventSource{Component: eventComponent},
+		ReportingComponent: eventComponent,
+	}
+}
+
+// eventReason maps a report to an event reason and type (Normal or Warning)
+func eventReason(report DriftReport) (string, string) {
+	switch {
+	case report.DriftType == DriftTypeOrphan && report.Healed:
+		return "OrphanPruned", "Normal"
+	case report.DriftType == DriftTypeOrphan:
+		return "OrphanDetected", "Warning"
+	case report.Healed:
+		return "DriftHealed", "Normal"
+	case report.DriftType == DriftTypeResolved:
+		return "DriftResolved", "Normal"
+	case report.PendingApproval:
+		return "DriftHealPending", "Warning"
+	default:
+		return "DriftDetected", "Warning"
+	}
+}
@@ -0,0 +1,99 @@
+package drift
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestKubeEventNotifier(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake kubectl script requires a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	kubectl := filepath.Join(dir, "kubectl")
+	script := "#!/bin/sh\necho \"$@\" > \"" + dir + "/args\"\ncat > \"" + dir + "/event.json\"\n"
+	if err := os.WriteFile(kubectl, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake kubectl: %v", err)
+	}
+
+	notifier := NewKubeEventNotifier(zap.NewNop())
+	notifier.SetKubectl(kubectl)
+	notifier.SetKubeContext("staging")
+
+	report := DriftReport{
+		Timestamp:   time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		ReleaseName: "nginx",
+		Namespace:   "web",
+		DriftType:   DriftTypeConfiguration,
+		Severity:    SeverityMedium,
+		Details:     "Configuration drift detected and auto-healed",
+		Healed:      true,
+	}
+	if err := notifier.Notify(report); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	if !strings.HasPrefix(string(args), "--context staging create -f -") {
+		t.Errorf("unexpected kubectl args: %q", args)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "event.json"))
+	if err != nil {
+		t.Fatalf("kubectl did not receive event: %v", err)
+	}
+
+	var event kubeEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		t.Fatalf("failed to decode event: %v", err)
+	}
+	if event.Metadata.Namespace != "web" || event.InvolvedObject.Name != "nginx" {
+		t.Errorf("unexpected event target: %+v", event)
+	}
+	if event.Reason != "DriftHealed" || event.Type != "Normal" {
+		t.Errorf("expected Normal DriftHealed event, got %s %s", event.Type, event.Reason)
+	}
+	if event.FirstTimestamp != "2024-03-01T12:00:00Z" {
+		t.Errorf("unexpected timestamp %s", event.FirstTimestamp)
+	}
+}
+
+func TestEventReason(t *testing.T) {
+	tests := []struct {
+		report    DriftReport
+		reason    string
+		eventType string
+	}{
+		{DriftReport{DriftType: DriftTypeConfiguration}, "DriftDetected", "Warning"},
+		{DriftReport{DriftType: DriftTypeDeletion, Healed: true}, "DriftHealed", "Normal"},
+		{DriftReport{DriftType: DriftTypeConfiguration, PendingApproval: true}, "DriftHealPending", "Warning"},
+		{DriftReport{DriftType: DriftTypeOrphan}, "OrphanDetected", "Warning"},
+		{DriftReport{DriftType: DriftTypeOrphan, Healed: true}, "OrphanPruned", "Normal"},
+	}
+
+	for _, tt := range tests {
+		reason, eventType := eventReason(tt.report)
+		if reason != tt.reason || eventType != tt.eventType {
+			t.Errorf("eventReason(%+v) = %s %s, expected %s %s", tt.report, reason, eventType, tt.reason, tt.eventType)
+		}
+	}
+}
+
+func TestNewKubeEventTruncatesMessage(t *testing.T) {
+	event := newKubeEvent(DriftReport{ReleaseName: "nginx", Details: strings.Repeat("x", 2000)})
+
+	if len(event.Message) != maxEventMessage {
+		t.Errorf("expected message truncated to %d, got %d", maxEventMessage, len(event.Message))
+	}
+	if event.Metadata.Namespace != "default" {
+		t.Errorf("expected default namespace, got %s", event.Metadata.Namespace)
+	}
+}
@@ -0,0 +1,120 @@
+package drift
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"go.uber.org/zap"
+)
+
+// GitOps controllers that may also manage a release's resources
+const (
+	ControllerArgoCD = "argocd"
+	ControllerFlux   = "flux"
+)
+
+// GitOpsOwner is a GitOps controller object that also manages resources of
+// a release. Healing such a release fights the controller, each reverting
+// what the other applied.
+type GitOpsOwner struct {
+	Controller string `json:"controller"`
+	Kind       string `json:"kind"` // Application, Kustomization or HelmRelease
+	Name       string `json:"name"` // [namespace/]name
+}
+
+func (o GitOpsOwner) String() string {
+	controller := "ArgoCD"
+	if o.Controller == ControllerFlux {
+		controller = "Flux"
+	}
+	return fmt.Sprintf("%s %s %s", controller, o.Kind, o.Name)
+}
+
+// liveInspector is implemented by inspectors that can read the resources
+// of a release as they are in the cluster
+type liveInspector interface {
+	LiveObjects(release helmstate.Release) ([]helmstate.LiveObject, error)
+}
+
+// GitOpsOwners returns the ArgoCD and Flux objects that manage any of
+// objects, as told by the tracking labels and annotations they set
+func GitOpsOwners(objects []helmstate.LiveObject) []GitOpsOwner {
+	seen := make(map[GitOpsOwner]bool)
+	for _, obj := range objects {
+		for _, owner := range objectOwners(obj) {
+			seen[owner] = true
+		}
+	}
+
+	owners := make([]GitOpsOwner, 0, len(seen))
+	for owner := range seen {
+		owners = append(owners, owner)
+	}
+	sort.Slice(owners, func(i, j int) bool { return owners[i].String() < owners[j].String() })
+	return owners
+}
+
+// objectOwners returns the GitOps objects one resource names
+func objectOwners(obj helmstate.LiveObject) []GitOpsOwner {
+	var owners []GitOpsOwner
+
+	// ArgoCD annotation tracking: <app>:<group>/<kind>:<namespace>/<name>,
+	// or the instance label when ArgoCD is configured to use it
+	if id := obj.Annotations["argocd.argoproj.io/tracking-id"]; id != "" {
+		app, _, _ := strings.Cut(id, ":")
+		owners = append(owners, GitOpsOwner{Controller: ControllerArgoCD, Kind: "Application", Name: app})
+	} else if app := obj.Labels["argocd.argoproj.io/instance"]; app != "" {
+		owners = append(owners, GitOpsOwner{Controller: ControllerArgoCD, Kind: "Application", Name: app})
+	}
+
+	for _, flux := range []struct{ prefix, kind string }{
+		{"kustomize.toolkit.fluxcd.io/", "Kustomization"},
+		{"helm.toolkit.fluxcd.io/", "HelmRelease"},
+	} {
+		name := obj.Labels[flux.prefix+"name"]
+		if name == "" {
+			continue
+		}
+		if ns := obj.Labels[flux.prefix+"namespace"]; ns != "" {
+			name = ns + "/" + name
+		}
+		owners = append(owners, GitOpsOwner{Controller: ControllerFlux, Kind: flux.kind, Name: name})
+	}
+	return owners
+}
+
+// gitOpsOwners looks up the GitOps controllers also managing a drifted
+// release, warning when there are any
+func (d *Detector) gitOpsOwners(release helmstate.Release) []GitOpsOwner {
+	inspector, ok := d.inspector.(liveInspector)
+	if !ok {
+		return nil
+	}
+	objects, err := inspector.LiveObjects(release)
+	if err != nil {
+		d.logger.Debug("failed to read live resources, not checking GitOps ownership",
+			zap.String("release", release.Name),
+			zap.Error(err))
+		return nil
+	}
+
+	owners := GitOpsOwners(objects)
+	if len(owners) > 0 {
+		d.logger.Warn("release resources are also managed by GitOps, healing them would fight it",
+			zap.String("release", release.Name),
+			zap.String("namespace", release.Namespace),
+			zap.String("managedBy", ownerList(owners)))
+	}
+	return owners
+}
+
+// ownerList joins owners for messages
+func ownerList(owners []GitOpsOwner) string {
+	names := make([]string, len(owners))
+	for i, owner := range owners {
+		names[i] = owner.String()
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,79 @@
+package drift
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"go.uber.org/zap"
+)
+
+// liveFakeInspector is a fakeInspector that also returns live resources
+type liveFakeInspector struct {
+	fakeInspector
+	objects []helmstate.LiveObject
+}
+
+func (f *liveFakeInspector) LiveObjects(helmstate.Release) ([]helmstate.LiveObject, error) {
+	return f.objects, nil
+}
+
+func TestGitOpsOwners(t *testing.T) {
+	objects := []helmstate.LiveObject{
+		{Kind: "Deployment", Name: "web", Annotations: map[string]string{"argocd.argoproj.io/tracking-id": "web-prod:apps/Deployment:prod/web"}},
+		{Kind: "Service", Name: "web", Annotations: map[string]string{"argocd.argoproj.io/tracking-id": "web-prod:/Service:prod/web"}},
+		{Kind: "ConfigMap", Name: "settings", Labels: map[string]string{
+			"kustomize.toolkit.fluxcd.io/name":      "apps",
+			"kustomize.toolkit.fluxcd.io/namespace": "flux-system",
+		}},
+		{Kind: "Secret", Name: "token", Labels: map[string]string{"helm.toolkit.fluxcd.io/name": "web"}},
+		{Kind: "ServiceAccount", Name: "web", Labels: map[string]string{"app.kubernetes.io/instance": "web"}},
+	}
+
+	got := GitOpsOwners(objects)
+	want := []string{"ArgoCD Application web-prod", "Flux HelmRelease web", "Flux Kustomization flux-system/apps"}
+	if ownerList(got) != strings.Join(want, ", ") {
+		t.Errorf("GitOpsOwners() = %s, want %s", ownerList(got), strings.Join(want, ", "))
+	}
+
+	if owners := GitOpsOwners(objects[4:]); len(owners) != 0 {
+		t.Errorf("expected the common instance label ignored, got %+v", owners)
+	}
+}
+
+func TestGitOpsManagedHeal(t *testing.T) {
+	detector := NewDetector(nil, time.Minute, zap.NewNop())
+	notifier := &MockNotifier{}
+	detector.AddNotifier(notifier)
+	healed := 0
+	detector.EnableAutoHeal(true, func(string) error {
+		healed++
+		return nil
+	})
+	detector.inspector = &liveFakeInspector{
+		fakeInspector: fakeInspector{exists: true, diff: "- replicas: 1\n+ replicas: 3"},
+		objects: []helmstate.LiveObject{
+			{Kind: "Deployment", Name: "web", Labels: map[string]string{"argocd.argoproj.io/instance": "web"}},
+		},
+	}
+	release := helmstate.Release{Name: "web", Namespace: "prod"}
+
+	// Held for approval instead of fighting ArgoCD
+	detector.checkRelease(release)
+	if healed != 0 || len(notifier.reports) != 1 {
+		t.Fatalf("expected drift notified but not healed, got %d heals and %+v", healed, notifier.reports)
+	}
+	report := notifier.reports[0]
+	if !report.PendingApproval || len(report.ManagedBy) != 1 || !strings.Contains(report.Details, "also managed by ArgoCD Application web") {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	// Unless the policy allows it
+	detector.SetHealPolicy(HealPolicy{HealGitOpsManaged: true})
+	detector.inspector.(*liveFakeInspector).diff = "- replicas: 1\n+ replicas: 4"
+	detector.checkRelease(release)
+	if healed != 1 {
+		t.Errorf("expected drift healed with HealGitOpsManaged, got %d heals", healed)
+	}
+}
@@ -2,34 +2,51 @@ package drift
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
+	"os/exec"
+	"strings"
 	"time"
 
+	"github.com/oleksiyp/helmfire/pkg/httpclient"
 	"go.uber.org/zap"
 )
 
 // StdoutNotifier outputs drift reports to standard output
 type StdoutNotifier struct {
 	logger *zap.Logger
+	color  bool
 }
 
-// NewStdoutNotifier creates a new stdout notifier
+// NewStdoutNotifier creates a new stdout notifier, highlighting diffs when
+// stdout is a terminal and NO_COLOR is unset
 func NewStdoutNotifier(logger *zap.Logger) *StdoutNotifier {
 	return &StdoutNotifier{
 		logger: logger,
+		color:  isTerminal(os.Stdout) && os.Getenv("NO_COLOR") == "",
 	}
 }
 
+// isTerminal reports whether f is a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
 // Notify outputs the drift report to stdout
 func (n *StdoutNotifier) Notify(report DriftReport) error {
-	icon := "⚠️"
+	icon, title := "⚠️", "DRIFT DETECTED"
 	if report.Healed {
 		icon = "✅"
 	}
+	if report.DriftType == DriftTypeResolved {
+		icon, title = "✅", "DRIFT RESOLVED"
+	}
 
-	fmt.Printf("\n%s DRIFT DETECTED %s\n", icon, icon)
+	fmt.Printf("\n%s %s %s\n", icon, title, icon)
 	fmt.Printf("Timestamp:    %s\n", report.Timestamp.Format(time.RFC3339))
 	fmt.Printf("Release:      %s\n", report.ReleaseName)
 	fmt.Printf("Namespace:    %s\n", report.Namespace)
@@ -39,7 +56,18 @@ func (n *StdoutNotifier) Notify(report DriftReport) error {
 	if report.Healed {
 		fmt.Printf("Status:       Auto-healed\n")
 	}
-	fmt.Printf("\nDiff:\n%s\n", report.Diff)
+	if values := report.ValuesDiff.String(); values != "" {
+		fmt.Printf("\nValues diff:\n%s\n", values)
+	}
+	diff := report.Diff
+	if n.color {
+		hunks := report.Hunks
+		if len(hunks) == 0 {
+			hunks = ParseDiff(diff)
+		}
+		diff = HighlightDiff(hunks)
+	}
+	fmt.Printf("\nDiff:\n%s\n", diff)
 	fmt.Printf("═══════════════════════════════════════════════════\n\n")
 
 	n.logger.Warn("drift detected",
@@ -52,6 +80,39 @@ func (n *StdoutNotifier) Notify(report DriftReport) error {
 	return nil
 }
 
+// NotifySync outputs a line announcing the sync event
+func (n *StdoutNotifier) NotifySync(event SyncEvent) error {
+	icon := map[SyncPhase]string{SyncStarted: "🚀", SyncSucceeded: "✅", SyncFailed: "❌"}[event.Phase]
+	fmt.Printf("%s %s\n", icon, syncSummary(event))
+
+	n.logger.Info("sync "+string(event.Phase),
+		zap.String("syncId", event.SyncID),
+		zap.String("release", event.ReleaseName),
+		zap.String("namespace", event.Namespace),
+		zap.String("error", event.Error))
+	return nil
+}
+
+// syncSummary describes a sync event in one line
+func syncSummary(event SyncEvent) string {
+	summary := fmt.Sprintf("Sync of %s %s", event.Subject(), event.Phase)
+	switch {
+	case event.ReleaseName == "" && event.Phase == SyncStarted:
+		summary += fmt.Sprintf(" (%d release(s))", event.Releases)
+	case event.Revision > 0 && len(event.Tests) > 0:
+		summary += fmt.Sprintf(" (revision %d, %d/%d smoke test(s) passed)", event.Revision, event.TestsPassed(), len(event.Tests))
+	case event.Revision > 0:
+		summary += fmt.Sprintf(" (revision %d)", event.Revision)
+	}
+	if event.Phase != SyncStarted && event.Duration > 0 {
+		summary += " in " + event.Duration.Round(time.Second).String()
+	}
+	if event.Error != "" {
+		summary += ": " + event.Error
+	}
+	return summary
+}
+
 // WebhookNotifier sends drift reports to a webhook URL
 type WebhookNotifier struct {
 	webhookURL string
@@ -63,26 +124,45 @@ type WebhookNotifier struct {
 func NewWebhookNotifier(webhookURL string, logger *zap.Logger) *WebhookNotifier {
 	return &WebhookNotifier{
 		webhookURL: webhookURL,
-		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
-		},
-		logger: logger,
+		httpClient: httpclient.New(10 * time.Second),
+		logger:     logger,
 	}
 }
 
+// SetHTTPClient replaces the client posting to the webhook, such as one
+// trusting the endpoint's CA
+func (n *WebhookNotifier) SetHTTPClient(client *http.Client) {
+	n.httpClient = client
+}
+
 // Notify sends the drift report to the configured webhook
 func (n *WebhookNotifier) Notify(report DriftReport) error {
 	payload, err := json.Marshal(report)
 	if err != nil {
 		return fmt.Errorf("failed to marshal drift report: %w", err)
 	}
+	return n.post(EventsDrift, report.ReleaseName, payload)
+}
 
+// NotifySync sends the sync event to the configured webhook
+func (n *WebhookNotifier) NotifySync(event SyncEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal sync event: %w", err)
+	}
+	return n.post(EventsSync, event.Subject(), payload)
+}
+
+// post sends a payload to the webhook, telling which kind of event it is
+// in the X-Helmfire-Event header
+func (n *WebhookNotifier) post(event, subject string, payload []byte) error {
 	req, err := http.NewRequest("POST", n.webhookURL, bytes.NewBuffer(payload))
 	if err != nil {
 		return fmt.Errorf("failed to create webhook request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Helmfire-Event", event)
 
 	resp, err := n.httpClient.Do(req)
 	if err != nil {
@@ -96,7 +176,8 @@ func (n *WebhookNotifier) Notify(report DriftReport) error {
 
 	n.logger.Debug("webhook notification sent",
 		zap.String("url", n.webhookURL),
-		zap.String("release", report.ReleaseName),
+		zap.String("event", event),
+		zap.String("subject", subject),
 		zap.Int("statusCode", resp.StatusCode))
 
 	return nil
@@ -125,3 +206,235 @@ func (n *FileNotifier) Notify(report DriftReport) error {
 		zap.String("release", report.ReleaseName))
 	return nil
 }
+
+// ExecNotifier pipes drift reports as JSON to an external command
+type ExecNotifier struct {
+	command string
+	args    []string
+	timeout time.Duration
+	logger  *zap.Logger
+}
+
+// NewExecNotifier creates a new exec notifier
+func NewExecNotifier(command string, args []string, logger *zap.Logger) *ExecNotifier {
+	return &ExecNotifier{
+		command: command,
+		args:    args,
+		timeout: 30 * time.Second,
+		logger:  logger,
+	}
+}
+
+// SetTimeout sets how long the command may run per report
+func (n *ExecNotifier) SetTimeout(timeout time.Duration) {
+	n.timeout = timeout
+}
+
+// Notify runs the command with the drift report JSON on stdin
+func (n *ExecNotifier) Notify(report DriftReport) error {
+	payload, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal drift report: %w", err)
+	}
+	return n.run(report.ReleaseName, payload,
+		"HELMFIRE_EVENT="+EventsDrift,
+		"HELMFIRE_DRIFT_RELEASE="+report.ReleaseName,
+		"HELMFIRE_DRIFT_NAMESPACE="+report.Namespace,
+		"HELMFIRE_DRIFT_TYPE="+string(report.DriftType),
+		"HELMFIRE_DRIFT_SEVERITY="+string(report.Severity),
+		fmt.Sprintf("HELMFIRE_DRIFT_HEALED=%t", report.Healed))
+}
+
+// NotifySync runs the command with the sync event JSON on stdin
+func (n *ExecNotifier) NotifySync(event SyncEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal sync event: %w", err)
+	}
+	return n.run(event.Subject(), payload,
+		"HELMFIRE_EVENT="+EventsSync,
+		"HELMFIRE_SYNC_ID="+event.SyncID,
+		"HELMFIRE_SYNC_PHASE="+string(event.Phase),
+		"HELMFIRE_SYNC_RELEASE="+event.ReleaseName,
+		"HELMFIRE_SYNC_NAMESPACE="+event.Namespace)
+}
+
+// run runs the command with payload on stdin and env added to the
+// environment
+func (n *ExecNotifier) run(subject string, payload []byte, env ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), n.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, n.command, n.args...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(os.Environ(), env...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("notifier command %s failed: %w (stderr: %s)", n.command, err, stderr.String())
+	}
+
+	n.logger.Debug("exec notification sent",
+		zap.String("command", n.command),
+		zap.String("subject", subject))
+
+	return nil
+}
+
+// SlackNotifier posts drift reports to a Slack incoming webhook, with a
+// section per changed resource
+type SlackNotifier struct {
+	webhookURL string
+	httpClient *http.Client
+	logger     *zap.Logger
+}
+
+// NewSlackNotifier creates a notifier posting to a Slack incoming webhook
+func NewSlackNotifier(webhookURL string, logger *zap.Logger) *SlackNotifier {
+	return &SlackNotifier{
+		webhookURL: webhookURL,
+		httpClient: httpclient.New(10 * time.Second),
+		logger:     logger,
+	}
+}
+
+// SetHTTPClient replaces the client posting to Slack
+func (n *SlackNotifier) SetHTTPClient(client *http.Client) {
+	n.httpClient = client
+}
+
+// Slack limits
+const (
+	slackMaxBlocks  = 50
+	slackMaxSection = 3000
+)
+
+// Notify posts the drift report to Slack
+func (n *SlackNotifier) Notify(report DriftReport) error {
+	return n.post(report.ReleaseName, slackMessage(report))
+}
+
+// NotifySync posts the sync event to Slack
+func (n *SlackNotifier) NotifySync(event SyncEvent) error {
+	return n.post(event.Subject(), slackSyncMessage(event))
+}
+
+// post sends a message to the Slack webhook
+func (n *SlackNotifier) post(subject string, message map[string]interface{}) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal slack message: %w", err)
+	}
+
+	resp, err := n.httpClient.Post(n.webhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to post to slack: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("slack returned non-2xx status: %d", resp.StatusCode)
+	}
+
+	n.logger.Debug("slack notification sent",
+		zap.String("subject", subject),
+		zap.Int("statusCode", resp.StatusCode))
+
+	return nil
+}
+
+// slackMessage builds the Block Kit message of a report. Slack doesn't
+// highlight code blocks, so each resource is marked by how it changed.
+func slackMessage(report DriftReport) map[string]interface{} {
+	icon, title := ":warning:", "Drift detected"
+	switch {
+	case report.DriftType == DriftTypeResolved:
+		icon, title = ":white_check_mark:", "Drift resolved"
+	case report.Healed:
+		icon, title = ":white_check_mark:", "Drift healed"
+	case report.PendingApproval:
+		icon, title = ":hourglass:", "Drift awaiting heal approval"
+	}
+
+	summary := fmt.Sprintf("%s *%s* in `%s/%s`\n*Type:* %s  *Severity:* %s\n%s",
+		icon, title, report.Namespace, report.ReleaseName, report.DriftType, report.Severity, report.Details)
+	blocks := []interface{}{slackSection(summary)}
+	if values := report.ValuesDiff.String(); values != "" {
+		if len(values) > slackMaxSection-40 {
+			values = values[:slackMaxSection-40] + "\n…"
+		}
+		blocks = append(blocks, slackSection("*Values diff*\n```"+values+"```"))
+	}
+
+	hunks := report.Hunks
+	if len(hunks) == 0 && report.Diff != "" {
+		hunks = ParseDiff(report.Diff)
+	}
+	for i, hunk := range hunks {
+		if len(blocks) == slackMaxBlocks-1 {
+			blocks = append(blocks, slackSection(fmt.Sprintf("_%d more resources not shown_", len(hunks)-i)))
+			break
+		}
+		heading := ""
+		if hunk.Kind != "" {
+			marker := map[string]string{ChangeAdded: ":heavy_plus_sign:", ChangeRemoved: ":heavy_minus_sign:"}[hunk.Change]
+			if marker == "" {
+				marker = ":pencil2:"
+			}
+			heading = fmt.Sprintf("%s *%s* `%s` %s\n", marker, hunk.Kind, hunk.Name, hunk.Change)
+		}
+		body := strings.Join(hunk.Lines, "\n")
+		if limit := slackMaxSection - len(heading) - 20; len(body) > limit {
+			body = body[:limit] + "\n…"
+		}
+		if body != "" {
+			body = "```" + body + "```"
+		}
+		blocks = append(blocks, slackSection(heading+body))
+	}
+
+	return map[string]interface{}{
+		"text":   fmt.Sprintf("%s: %s/%s", title, report.Namespace, report.ReleaseName),
+		"blocks": blocks,
+	}
+}
+
+// slackSyncMessage builds the Block Kit message of a sync event
+func slackSyncMessage(event SyncEvent) map[string]interface{} {
+	icon := map[SyncPhase]string{SyncStarted: ":rocket:", SyncSucceeded: ":white_check_mark:", SyncFailed: ":x:"}[event.Phase]
+	text := fmt.Sprintf("%s %s", icon, syncSummary(event))
+	footer := fmt.Sprintf("Sync `%s`", event.SyncID)
+	if event.Trigger != "" {
+		footer += ", triggered by " + event.Trigger
+	}
+
+	blocks := []interface{}{slackSection(text)}
+	var failedTests []string
+	for _, test := range event.Tests {
+		if !test.Passed {
+			failedTests = append(failedTests, fmt.Sprintf("• `%s`: %s", test.Name, test.Error))
+		}
+	}
+	if len(failedTests) > 0 {
+		blocks = append(blocks, slackSection("*Failed smoke tests*\n"+strings.Join(failedTests, "\n")))
+	}
+	blocks = append(blocks, map[string]interface{}{
+		"type":     "context",
+		"elements": []interface{}{map[string]string{"type": "mrkdwn", "text": footer}},
+	})
+
+	return map[string]interface{}{
+		"text":   syncSummary(event),
+		"blocks": blocks,
+	}
+}
+
+// slackSection is a Block Kit section of mrkdwn text
+func slackSection(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "section",
+		"text": map[string]string{"type": "mrkdwn", "text": text},
+	}
+}
@@ -4,6 +4,10 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -122,3 +126,91 @@ func TestFileNotifier(t *testing.T) {
 		t.Errorf("unexpected error: %v", err)
 	}
 }
+
+func TestExecNotifier(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	outFile := filepath.Join(t.TempDir(), "report.json")
+	logger := zap.NewNop()
+	notifier := NewExecNotifier("sh", []string{"-c", `cat > "$0"; echo "$HELMFIRE_DRIFT_RELEASE" >> "$0.env"`, outFile}, logger)
+
+	report := DriftReport{
+		Timestamp:   time.Now(),
+		ReleaseName: "test-release",
+		Namespace:   "default",
+		DriftType:   DriftTypeConfiguration,
+		Severity:    SeverityMedium,
+		Details:     "Test drift",
+	}
+
+	if err := notifier.Notify(report); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("command did not write report: %v", err)
+	}
+
+	var received DriftReport
+	if err := json.Unmarshal(data, &received); err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+	if received.ReleaseName != "test-release" {
+		t.Errorf("expected test-release, got %s", received.ReleaseName)
+	}
+
+	env, err := os.ReadFile(outFile + ".env")
+	if err != nil {
+		t.Fatalf("command did not write env: %v", err)
+	}
+	if strings.TrimSpace(string(env)) != "test-release" {
+		t.Errorf("expected HELMFIRE_DRIFT_RELEASE=test-release, got %q", env)
+	}
+}
+
+func TestExecNotifier_Error(t *testing.T) {
+	notifier := NewExecNotifier("false", nil, zap.NewNop())
+
+	if err := notifier.Notify(DriftReport{ReleaseName: "test-release"}); err == nil {
+		t.Error("expected error for failing command")
+	}
+}
+
+func TestSlackNotifier(t *testing.T) {
+	var message struct {
+		Text   string `json:"text"`
+		Blocks []struct {
+			Text struct {
+				Text string `json:"text"`
+			} `json:"text"`
+		} `json:"blocks"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+			t.Errorf("failed to decode body: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	notifier := NewSlackNotifier(server.URL, zap.NewNop())
+	report := DriftReport{
+		ReleaseName: "web",
+		Namespace:   "prod",
+		DriftType:   DriftTypeConfiguration,
+		Severity:    SeverityLow,
+		Diff:        "prod, web, Deployment (apps) has changed:\n-   replicas: 1\n+   replicas: 3\n",
+	}
+	if err := notifier.Notify(report); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	if message.Text != "Drift detected: prod/web" || len(message.Blocks) != 2 {
+		t.Fatalf("expected a summary and a resource section, got %+v", message)
+	}
+	if section := message.Blocks[1].Text.Text; !strings.Contains(section, "*Deployment* `web` changed") || !strings.Contains(section, "+   replicas: 3") {
+		t.Errorf("expected the Deployment's diff, got %q", section)
+	}
+}
@@ -0,0 +1,84 @@
+package drift
+
+import (
+	"fmt"
+	"time"
+)
+
+// severityRank orders severities from least to most important
+var severityRank = map[Severity]int{
+	SeverityLow:    1,
+	SeverityMedium: 2,
+	SeverityHigh:   3,
+}
+
+// ParseSeverity validates a severity name
+func ParseSeverity(s string) (Severity, error) {
+	severity := Severity(s)
+	if _, ok := severityRank[severity]; !ok {
+		return "", fmt.Errorf("invalid severity %q (expected low, medium or high)", s)
+	}
+	return severity, nil
+}
+
+// HealPolicy decides which drift may be auto-healed. Drift it rejects is held
+// for manual approval.
+type HealPolicy struct {
+	// MaxSeverity is the highest severity healed automatically; empty allows all
+	MaxSeverity Severity
+	// ManualNamespaces always require manual approval
+	ManualNamespaces []string
+	// Windows, when set, are the only times drift is healed automatically
+	Windows []HealWindow
+	// Blackouts are times drift is never healed automatically, such as
+	// deploy freezes
+	Blackouts []HealWindow
+	// HealGitOpsManaged heals releases whose resources ArgoCD or Flux also
+	// manage automatically; otherwise their drift awaits approval, as
+	// healing would fight the controller
+	HealGitOpsManaged bool
+}
+
+// AllowsAutoHeal reports whether the policy permits healing the report
+// automatically, and if not, why
+func (p HealPolicy) AllowsAutoHeal(report DriftReport) (bool, string) {
+	if len(report.ManagedBy) > 0 && !p.HealGitOpsManaged {
+		return false, fmt.Sprintf("also managed by %s", ownerList(report.ManagedBy))
+	}
+
+	for _, ns := range p.ManualNamespaces {
+		if report.Namespace == ns {
+			return false, fmt.Sprintf("namespace %s requires manual approval", ns)
+		}
+	}
+
+	if p.MaxSeverity != "" && severityRank[report.Severity] > severityRank[p.MaxSeverity] {
+		return false, fmt.Sprintf("%s severity exceeds auto-heal limit %s", report.Severity, p.MaxSeverity)
+	}
+
+	return p.allowsAutoHealAt(report.Timestamp)
+}
+
+// allowsAutoHealAt checks the heal windows and blackouts at t, or now when
+// t is zero
+func (p HealPolicy) allowsAutoHealAt(t time.Time) (bool, string) {
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	for _, blackout := range p.Blackouts {
+		if blackout.Contains(t) {
+			return false, fmt.Sprintf("auto-heal blocked during %q", blackout.String())
+		}
+	}
+
+	if len(p.Windows) == 0 {
+		return true, ""
+	}
+	for _, window := range p.Windows {
+		if window.Contains(t) {
+			return true, ""
+		}
+	}
+	return false, "outside the auto-heal windows"
+}
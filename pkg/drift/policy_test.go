@@ -0,0 +1,82 @@
+package drift
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSeverity(t *testing.T) {
+	if s, err := ParseSeverity("medium"); err != nil || s != SeverityMedium {
+		t.Errorf("expected medium, got %q (%v)", s, err)
+	}
+	if _, err := ParseSeverity("critical"); err == nil {
+		t.Error("expected error for unknown severity")
+	}
+}
+
+func TestHealPolicyAllowsAutoHeal(t *testing.T) {
+	policy := HealPolicy{
+		MaxSeverity:      SeverityMedium,
+		ManualNamespaces: []string{"prod"},
+	}
+
+	tests := []struct {
+		name     string
+		report   DriftReport
+		expected bool
+	}{
+		{"low severity", DriftReport{Namespace: "dev", Severity: SeverityLow}, true},
+		{"at limit", DriftReport{Namespace: "dev", Severity: SeverityMedium}, true},
+		{"above limit", DriftReport{Namespace: "dev", Severity: SeverityHigh}, false},
+		{"manual namespace", DriftReport{Namespace: "prod", Severity: SeverityLow}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, reason := policy.AllowsAutoHeal(tt.report)
+			if allowed != tt.expected {
+				t.Errorf("expected %v, got %v (%s)", tt.expected, allowed, reason)
+			}
+			if !allowed && reason == "" {
+				t.Error("expected a reason when auto-heal is denied")
+			}
+		})
+	}
+
+	if allowed, _ := (HealPolicy{}).AllowsAutoHeal(DriftReport{Severity: SeverityHigh}); !allowed {
+		t.Error("expected empty policy to allow all drift")
+	}
+}
+
+func TestHealPolicyWindows(t *testing.T) {
+	nights, err := ParseHealWindow("CRON_TZ=UTC 0 22 * * * 8h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	freeze, err := ParseHealWindow("CRON_TZ=UTC 0 0 24 12 * 48h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := HealPolicy{Windows: []HealWindow{nights}, Blackouts: []HealWindow{freeze}}
+
+	tests := []struct {
+		name     string
+		time     time.Time
+		expected bool
+	}{
+		{"in window", time.Date(2024, 3, 1, 23, 0, 0, 0, time.UTC), true},
+		{"outside window", time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), false},
+		{"window during freeze", time.Date(2024, 12, 24, 23, 0, 0, 0, time.UTC), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, reason := policy.AllowsAutoHeal(DriftReport{Timestamp: tt.time, Severity: SeverityLow})
+			if allowed != tt.expected {
+				t.Errorf("expected %v, got %v (%s)", tt.expected, allowed, reason)
+			}
+			if !allowed && reason == "" {
+				t.Error("expected a reason when auto-heal is denied")
+			}
+		})
+	}
+}
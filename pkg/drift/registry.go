@@ -0,0 +1,316 @@
+package drift
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/httpclient"
+	"github.com/oleksiyp/helmfire/pkg/kafka"
+	"github.com/oleksiyp/helmfire/pkg/nats"
+	"github.com/oleksiyp/helmfire/pkg/preflight"
+	"go.uber.org/zap"
+)
+
+// NotifierConfig declares a notifier in configuration. Type selects the
+// registered factory; all other keys are passed to it as options.
+//
+//	notifiers:
+//	  - type: webhook
+//	    url: https://hooks.example.com/drift
+//	  - type: kafka
+//	    brokers: [kafka-1:9093, kafka-2:9093]
+//	    topic: drift
+//	  - type: exec
+//	    command: /usr/local/bin/page-oncall
+//	    args: ["--team", "platform"]
+type NotifierConfig struct {
+	Type    string                 `yaml:"type" json:"type"`
+	Options map[string]interface{} `yaml:",inline" json:"options,omitempty"`
+}
+
+// String returns a string option, or "" when unset
+func (c NotifierConfig) String(key string) string {
+	if v, ok := c.Options[key]; ok && v != nil {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// StringSlice returns a list option, accepting a single string as a one-element list
+func (c NotifierConfig) StringSlice(key string) []string {
+	switch v := c.Options[key].(type) {
+	case []interface{}:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			result = append(result, fmt.Sprint(item))
+		}
+		return result
+	case []string:
+		return v
+	case string:
+		return []string{v}
+	}
+	return nil
+}
+
+// Duration returns a duration option, or def when unset
+func (c NotifierConfig) Duration(key string, def time.Duration) (time.Duration, error) {
+	raw := c.String(key)
+	if raw == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, raw, err)
+	}
+	return d, nil
+}
+
+// Bool returns a boolean option, or false when unset
+func (c NotifierConfig) Bool(key string) (bool, error) {
+	switch v := c.Options[key].(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	}
+	raw := c.String(key)
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q: %w", key, raw, err)
+	}
+	return b, nil
+}
+
+// HTTPClient returns a client for notifiers posting over HTTP, honoring
+// the proxy, caFile and insecureSkipVerify options over the defaults set
+// by --proxy and --ca-file
+func (c NotifierConfig) HTTPClient(timeout time.Duration) (*http.Client, error) {
+	insecure, err := c.Bool("insecureSkipVerify")
+	if err != nil {
+		return nil, err
+	}
+	return httpclient.NewWith(httpclient.Options{
+		Proxy:              c.String("proxy"),
+		CAFile:             c.String("caFile"),
+		InsecureSkipVerify: insecure,
+	}, timeout)
+}
+
+// tlsOptions returns the TLS options of notifiers connecting to message
+// buses: set when the tls option is true or caFile or insecureSkipVerify
+// are given, nil for plain connections
+func (c NotifierConfig) tlsOptions() (*httpclient.Options, error) {
+	enabled, err := c.Bool("tls")
+	if err != nil {
+		return nil, err
+	}
+	insecure, err := c.Bool("insecureSkipVerify")
+	if err != nil {
+		return nil, err
+	}
+	opts := httpclient.Options{CAFile: c.String("caFile"), InsecureSkipVerify: insecure}
+	if !enabled && opts == (httpclient.Options{}) {
+		return nil, nil
+	}
+	// Check the CA bundle now rather than at the first report
+	if _, err := httpclient.TLSConfig(opts); err != nil {
+		return nil, err
+	}
+	return &opts, nil
+}
+
+// NotifierFactory creates a notifier from its configuration
+type NotifierFactory func(cfg NotifierConfig, logger *zap.Logger) (Notifier, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]NotifierFactory{}
+)
+
+func init() {
+	RegisterNotifier("stdout", func(_ NotifierConfig, logger *zap.Logger) (Notifier, error) {
+		return NewStdoutNotifier(logger), nil
+	})
+
+	RegisterNotifier("webhook", func(cfg NotifierConfig, logger *zap.Logger) (Notifier, error) {
+		url := cfg.String("url")
+		if url == "" {
+			return nil, fmt.Errorf("webhook notifier requires url")
+		}
+		client, err := cfg.HTTPClient(10 * time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("webhook notifier: %w", err)
+		}
+		n := NewWebhookNotifier(url, logger)
+		n.SetHTTPClient(client)
+		return n, nil
+	})
+
+	RegisterNotifier("slack", func(cfg NotifierConfig, logger *zap.Logger) (Notifier, error) {
+		url := cfg.String("url")
+		if url == "" {
+			return nil, fmt.Errorf("slack notifier requires url")
+		}
+		client, err := cfg.HTTPClient(10 * time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("slack notifier: %w", err)
+		}
+		n := NewSlackNotifier(url, logger)
+		n.SetHTTPClient(client)
+		return n, nil
+	})
+
+	RegisterNotifier("nats", func(cfg NotifierConfig, logger *zap.Logger) (Notifier, error) {
+		url, subject := cfg.String("url"), cfg.String("subject")
+		if url == "" || subject == "" {
+			return nil, fmt.Errorf("nats notifier requires url and subject")
+		}
+		timeout, err := cfg.Duration("timeout", nats.DefaultTimeout)
+		if err != nil {
+			return nil, err
+		}
+		tlsOpts, err := cfg.tlsOptions()
+		if err != nil {
+			return nil, fmt.Errorf("nats notifier: %w", err)
+		}
+		publisher, err := nats.NewPublisher(url)
+		if err != nil {
+			return nil, fmt.Errorf("nats notifier: %w", err)
+		}
+		publisher.SetCredentials(cfg.String("user"), cfg.String("password"), cfg.String("token"))
+		publisher.SetTimeout(timeout)
+		if tlsOpts != nil {
+			publisher.SetTLS(*tlsOpts)
+		}
+		n := NewNATSNotifier(publisher, subject, logger)
+		n.timeout = timeout
+		return n, nil
+	})
+
+	RegisterNotifier("kafka", func(cfg NotifierConfig, logger *zap.Logger) (Notifier, error) {
+		brokers, topic := cfg.StringSlice("brokers"), cfg.String("topic")
+		if len(brokers) == 0 || topic == "" {
+			return nil, fmt.Errorf("kafka notifier requires brokers and topic")
+		}
+		timeout, err := cfg.Duration("timeout", kafka.DefaultTimeout)
+		if err != nil {
+			return nil, err
+		}
+		tlsOpts, err := cfg.tlsOptions()
+		if err != nil {
+			return nil, fmt.Errorf("kafka notifier: %w", err)
+		}
+		producer, err := kafka.NewProducer(brokers)
+		if err != nil {
+			return nil, fmt.Errorf("kafka notifier: %w", err)
+		}
+		producer.SetTimeout(timeout)
+		if tlsOpts != nil {
+			producer.SetTLS(*tlsOpts)
+		}
+		if username := cfg.String("username"); username != "" {
+			producer.SetSASLPlain(username, cfg.String("password"))
+		}
+		return NewKafkaNotifier(producer, topic, logger), nil
+	})
+
+	RegisterNotifier("file", func(cfg NotifierConfig, logger *zap.Logger) (Notifier, error) {
+		path := cfg.String("path")
+		if path == "" {
+			return nil, fmt.Errorf("file notifier requires path")
+		}
+		return NewFileNotifier(path, logger), nil
+	})
+
+	RegisterNotifier("exec", func(cfg NotifierConfig, logger *zap.Logger) (Notifier, error) {
+		command := cfg.String("command")
+		if command == "" {
+			return nil, fmt.Errorf("exec notifier requires command")
+		}
+		timeout, err := cfg.Duration("timeout", 30*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		n := NewExecNotifier(command, cfg.StringSlice("args"), logger)
+		n.SetTimeout(timeout)
+		return n, nil
+	})
+
+	RegisterNotifier("kube-events", func(cfg NotifierConfig, logger *zap.Logger) (Notifier, error) {
+		timeout, err := cfg.Duration("timeout", 30*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		// Events are created with kubectl, checked for up front
+		kubectl, err := preflight.ResolveKubectlBinary(cfg.String("kubectl"))
+		if err != nil {
+			return nil, fmt.Errorf("kube-events notifier: %w", err)
+		}
+		n := NewKubeEventNotifier(logger)
+		n.SetKubectl(kubectl)
+		n.SetKubeContext(cfg.String("context"))
+		n.SetTimeout(timeout)
+		return n, nil
+	})
+}
+
+// RegisterNotifier makes a notifier type available to configuration.
+// Registering an existing type replaces its factory.
+func RegisterNotifier(notifierType string, factory NotifierFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[notifierType] = factory
+}
+
+// NotifierTypes returns the registered notifier types in sorted order
+func NotifierTypes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	types := make([]string, 0, len(registry))
+	for t := range registry {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// NewNotifier creates a notifier from configuration using the registry. It
+// is sent drift reports, and sync events too when its events option lists
+// sync.
+func NewNotifier(cfg NotifierConfig, logger *zap.Logger) (Notifier, error) {
+	registryMu.RLock()
+	factory, ok := registry[cfg.Type]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown notifier type %q (available: %v)", cfg.Type, NotifierTypes())
+	}
+
+	n, err := factory(cfg, logger)
+	if err == nil {
+		n, err = filterEvents(cfg, n)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s notifier: %w", cfg.Type, err)
+	}
+	return n, nil
+}
+
+// NewNotifiers creates all configured notifiers, failing on the first invalid entry
+func NewNotifiers(cfgs []NotifierConfig, logger *zap.Logger) ([]Notifier, error) {
+	notifiers := make([]Notifier, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		n, err := NewNotifier(cfg, logger)
+		if err != nil {
+			return nil, fmt.Errorf("notifiers[%d]: %w", i, err)
+		}
+		notifiers = append(notifiers, n)
+	}
+	return notifiers, nil
+}
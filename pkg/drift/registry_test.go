@@ -0,0 +1,115 @@
+package drift
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+func TestNewNotifiersFromYAML(t *testing.T) {
+	data := `
+- type: stdout
+- type: webhook
+  url: https://hooks.example.com/drift
+- type: exec
+  command: /usr/local/bin/notify
+  args: ["--team", "platform"]
+  timeout: 5s
+`
+	var cfgs []NotifierConfig
+	if err := yaml.Unmarshal([]byte(data), &cfgs); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+
+	notifiers, err := NewNotifiers(cfgs, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewNotifiers failed: %v", err)
+	}
+	if len(notifiers) != 3 {
+		t.Fatalf("expected 3 notifiers, got %d", len(notifiers))
+	}
+
+	execNotifier, ok := notifiers[2].(*ExecNotifier)
+	if !ok {
+		t.Fatalf("expected *ExecNotifier, got %T", notifiers[2])
+	}
+	if len(execNotifier.args) != 2 || execNotifier.args[1] != "platform" {
+		t.Errorf("unexpected args: %v", execNotifier.args)
+	}
+	if execNotifier.timeout.Seconds() != 5 {
+		t.Errorf("expected 5s timeout, got %v", execNotifier.timeout)
+	}
+}
+
+func TestNewNotifierErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  NotifierConfig
+	}{
+		{"unknown type", NotifierConfig{Type: "carrier-pigeon"}},
+		{"webhook without url", NotifierConfig{Type: "webhook"}},
+		{"exec without command", NotifierConfig{Type: "exec"}},
+		{"exec with bad timeout", NotifierConfig{Type: "exec", Options: map[string]interface{}{"command": "true", "timeout": "soon"}}},
+		{"webhook with missing caFile", NotifierConfig{Type: "webhook", Options: map[string]interface{}{"url": "https://hooks.example.com", "caFile": "/nonexistent/ca.pem"}}},
+		{"nats without subject", NotifierConfig{Type: "nats", Options: map[string]interface{}{"url": "nats://nats:4222"}}},
+		{"nats with bad url", NotifierConfig{Type: "nats", Options: map[string]interface{}{"url": "http://nats:4222", "subject": "drift"}}},
+		{"kafka without brokers", NotifierConfig{Type: "kafka", Options: map[string]interface{}{"topic": "drift"}}},
+		{"kafka with missing caFile", NotifierConfig{Type: "kafka", Options: map[string]interface{}{"brokers": "kafka:9093", "topic": "drift", "caFile": "/nonexistent/ca.pem"}}},
+		{"slack with bad insecureSkipVerify", NotifierConfig{Type: "slack", Options: map[string]interface{}{"url": "https://hooks.slack.com", "insecureSkipVerify": "sometimes"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewNotifier(tt.cfg, zap.NewNop()); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestNewBusNotifiers(t *testing.T) {
+	data := `
+- type: nats
+  url: tls://nats-1,nats://nats-2:4222
+  subject: alerts.drift
+  token: s3cr3t
+  timeout: 5s
+- type: kafka
+  brokers: [kafka-1:9093, kafka-2:9093]
+  topic: drift
+  username: helmfire
+  password: s3cr3t
+  tls: true
+`
+	var cfgs []NotifierConfig
+	if err := yaml.Unmarshal([]byte(data), &cfgs); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+
+	notifiers, err := NewNotifiers(cfgs, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewNotifiers failed: %v", err)
+	}
+	if n, ok := notifiers[0].(*NATSNotifier); !ok || n.subject != "alerts.drift" || n.timeout.Seconds() != 5 {
+		t.Errorf("expected a NATS notifier on alerts.drift, got %#v", notifiers[0])
+	}
+	if n, ok := notifiers[1].(*KafkaNotifier); !ok || n.topic != "drift" {
+		t.Errorf("expected a Kafka notifier on drift, got %#v", notifiers[1])
+	}
+}
+
+func TestRegisterNotifier(t *testing.T) {
+	mock := &MockNotifier{}
+	RegisterNotifier("mock", func(NotifierConfig, *zap.Logger) (Notifier, error) {
+		return mock, nil
+	})
+
+	n, err := NewNotifier(NotifierConfig{Type: "mock"}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewNotifier failed: %v", err)
+	}
+	if n != mock {
+		t.Error("expected registered mock notifier")
+	}
+}
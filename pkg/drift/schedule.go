@@ -0,0 +1,198 @@
+package drift
+
+import (
+	"sort"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"go.uber.org/zap"
+)
+
+// SetJitter randomizes each check interval by up to ±fraction (0 to 1) so
+// checks of many releases drift apart instead of hitting the API server together
+func (d *Detector) SetJitter(fraction float64) {
+	if fraction < 0 {
+		fraction = 0
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.jitter = fraction
+}
+
+// SetStagger spreads the first check of each release evenly across its
+// interval instead of checking every release at startup
+func (d *Detector) SetStagger(stagger bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stagger = stagger
+}
+
+// SetInterval changes the check interval. A running detector checks
+// releases due later than one new interval from now by then instead.
+func (d *Detector) SetInterval(interval time.Duration) {
+	d.mu.Lock()
+	d.interval = interval
+	d.mu.Unlock()
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Interval returns the check interval of releases without their own
+func (d *Detector) Interval() time.Duration {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.interval
+}
+
+// SetReleaseEnabled turns periodic drift checks of the named release on or
+// off. A disabled release is still checked when asked for by name.
+func (d *Detector) SetReleaseEnabled(name string, enabled bool) {
+	d.mu.Lock()
+	if enabled {
+		delete(d.disabled, name)
+	} else {
+		d.disabled[name] = true
+	}
+	d.mu.Unlock()
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// ReleaseEnabled reports whether the named release is checked periodically
+func (d *Detector) ReleaseEnabled(name string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return !d.disabled[name]
+}
+
+// DisabledReleases returns the sorted names of the releases disabled with
+// SetReleaseEnabled
+func (d *Detector) DisabledReleases() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	names := make([]string, 0, len(d.disabled))
+	for name := range d.disabled {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// enabledReleases returns the installed releases checked periodically
+func (d *Detector) enabledReleases() []helmstate.Release {
+	var releases []helmstate.Release
+	for _, release := range d.installedReleases() {
+		if d.ReleaseEnabled(release.Name) {
+			releases = append(releases, release)
+		}
+	}
+	return releases
+}
+
+// installedReleases returns the releases that should be checked for drift
+func (d *Detector) installedReleases() []helmstate.Release {
+	if d.manager == nil {
+		return nil
+	}
+
+	var releases []helmstate.Release
+	for _, release := range d.manager.GetReleases() {
+		if d.manager.IsReleaseInstalled(release) {
+			releases = append(releases, release)
+		}
+	}
+	return releases
+}
+
+// scheduleReleases assigns first check times to releases not yet scheduled and
+// forgets releases that are no longer defined
+func (d *Detector) scheduleReleases(due map[string]time.Time, releases []helmstate.Release, now time.Time) {
+	d.mu.RLock()
+	stagger := d.stagger
+	d.mu.RUnlock()
+
+	current := make(map[string]bool, len(releases))
+	for i, release := range releases {
+		key := releaseKey(release)
+		current[key] = true
+		if _, ok := due[key]; ok {
+			continue
+		}
+
+		first := now
+		if stagger {
+			first = now.Add(staggerOffset(i, len(releases), d.releaseInterval(release)))
+		}
+		due[key] = first
+
+		d.logger.Debug("scheduled drift check",
+			zap.String("release", release.Name),
+			zap.Time("first", first))
+	}
+
+	for key := range due {
+		if !current[key] {
+			delete(due, key)
+		}
+	}
+}
+
+// releaseInterval returns the check interval for a release
+func (d *Detector) releaseInterval(release helmstate.Release) time.Duration {
+	if release.Drift != nil && release.Drift.Interval > 0 {
+		return release.Drift.Interval
+	}
+	return d.Interval()
+}
+
+// capSchedule moves checks of releases due later than one interval from now
+// to then, after the interval shrank
+func capSchedule(due map[string]time.Time, releases []helmstate.Release, now time.Time, interval func(helmstate.Release) time.Duration) {
+	for _, release := range releases {
+		key := releaseKey(release)
+		if limit := now.Add(interval(release)); due[key].After(limit) {
+			due[key] = limit
+		}
+	}
+}
+
+// nextDelay applies jitter to an interval
+func (d *Detector) nextDelay(interval time.Duration) time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.jitter == 0 {
+		return interval
+	}
+
+	factor := 1 + d.jitter*(2*d.rand.Float64()-1)
+	delay := time.Duration(float64(interval) * factor)
+	if delay <= 0 {
+		return interval
+	}
+	return delay
+}
+
+// staggerOffset returns the offset of the i-th of n releases within interval
+func staggerOffset(i, n int, interval time.Duration) time.Duration {
+	if n <= 1 {
+		return 0
+	}
+	return interval * time.Duration(i) / time.Duration(n)
+}
+
+// releaseKey identifies a release across reloads
+func releaseKey(release helmstate.Release) string {
+	return release.Namespace + "/" + release.Name
+}
@@ -0,0 +1,222 @@
+package drift
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"go.uber.org/zap"
+)
+
+// countingInspector counts diff calls per release
+type countingInspector struct {
+	mu     sync.Mutex
+	checks map[string]int
+}
+
+func (c *countingInspector) ReleaseExists(helmstate.Release) (bool, error) {
+	return true, nil
+}
+
+func (c *countingInspector) DiffRelease(release helmstate.Release) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[release.Name]++
+	return "", nil
+}
+
+func (c *countingInspector) FindOrphans() ([]helmstate.DeployedRelease, error) {
+	return nil, nil
+}
+
+func (c *countingInspector) count(name string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.checks[name]
+}
+
+func TestNextDelayJitter(t *testing.T) {
+	detector := NewDetector(nil, time.Minute, zap.NewNop())
+
+	if delay := detector.nextDelay(time.Minute); delay != time.Minute {
+		t.Errorf("expected no jitter by default, got %v", delay)
+	}
+
+	detector.SetJitter(0.2)
+	varied := false
+	for i := 0; i < 100; i++ {
+		delay := detector.nextDelay(time.Minute)
+		if delay < 48*time.Second || delay > 72*time.Second {
+			t.Fatalf("delay %v outside ±20%% of 1m", delay)
+		}
+		if delay != time.Minute {
+			varied = true
+		}
+	}
+	if !varied {
+		t.Error("expected jitter to vary the delay")
+	}
+}
+
+func TestStaggerOffset(t *testing.T) {
+	tests := []struct {
+		i, n     int
+		expected time.Duration
+	}{
+		{0, 1, 0},
+		{0, 4, 0},
+		{1, 4, 15 * time.Second},
+		{3, 4, 45 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := staggerOffset(tt.i, tt.n, time.Minute); got != tt.expected {
+			t.Errorf("staggerOffset(%d, %d) = %v, expected %v", tt.i, tt.n, got, tt.expected)
+		}
+	}
+}
+
+func TestScheduleReleasesStagger(t *testing.T) {
+	detector := NewDetector(nil, time.Minute, zap.NewNop())
+	detector.SetStagger(true)
+
+	releases := []helmstate.Release{{Name: "a"}, {Name: "b"}}
+	now := time.Now()
+	due := map[string]time.Time{"/removed": now}
+
+	detector.scheduleReleases(due, releases, now)
+
+	if !due["/a"].Equal(now) {
+		t.Errorf("expected first release due now, got %v", due["/a"].Sub(now))
+	}
+	if due["/b"].Sub(now) != 30*time.Second {
+		t.Errorf("expected second release due in 30s, got %v", due["/b"].Sub(now))
+	}
+	if _, ok := due["/removed"]; ok {
+		t.Error("expected removed release to be unscheduled")
+	}
+}
+
+func TestPerReleaseInterval(t *testing.T) {
+	manager := helmstate.NewManager("", "")
+	manager.Spec = &helmstate.HelmfileSpec{
+		Releases: []helmstate.Release{
+			{Name: "fast", Drift: &helmstate.ReleaseDrift{Interval: 10 * time.Millisecond}},
+			{Name: "slow"},
+		},
+	}
+
+	inspector := &countingInspector{checks: make(map[string]int)}
+	detector := NewDetector(manager, time.Hour, zap.NewNop())
+	detector.inspector = inspector
+
+	if err := detector.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start detector: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := detector.Stop(); err != nil {
+		t.Fatalf("failed to stop detector: %v", err)
+	}
+
+	if got := inspector.count("fast"); got < 3 {
+		t.Errorf("expected fast release to be checked repeatedly, got %d checks", got)
+	}
+	if got := inspector.count("slow"); got != 1 {
+		t.Errorf("expected slow release to be checked once, got %d checks", got)
+	}
+}
+
+func TestSetIntervalReschedulesRunningDetector(t *testing.T) {
+	manager := helmstate.NewManager("", "")
+	manager.Spec = &helmstate.HelmfileSpec{Releases: []helmstate.Release{{Name: "web"}}}
+
+	inspector := &countingInspector{checks: make(map[string]int)}
+	detector := NewDetector(manager, time.Hour, zap.NewNop())
+	detector.inspector = inspector
+
+	if err := detector.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start detector: %v", err)
+	}
+	defer detector.Stop()
+
+	time.Sleep(50 * time.Millisecond)
+	if got := inspector.count("web"); got != 1 {
+		t.Fatalf("expected one check before the interval changed, got %d", got)
+	}
+
+	detector.SetInterval(10 * time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	if got := inspector.count("web"); got < 3 {
+		t.Errorf("expected checks at the new interval, got %d", got)
+	}
+	if detector.Interval() != 10*time.Millisecond {
+		t.Errorf("expected the new interval, got %v", detector.Interval())
+	}
+}
+
+func TestDisabledReleaseNotCheckedPeriodically(t *testing.T) {
+	manager := helmstate.NewManager("", "")
+	manager.Spec = &helmstate.HelmfileSpec{Releases: []helmstate.Release{{Name: "web"}, {Name: "db"}}}
+
+	inspector := &countingInspector{checks: make(map[string]int)}
+	detector := NewDetector(manager, 10*time.Millisecond, zap.NewNop())
+	detector.inspector = inspector
+	detector.SetReleaseEnabled("db", false)
+
+	if _, err := detector.CheckNow(""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := detector.CheckNow("db"); err != nil {
+		t.Fatal(err)
+	}
+	if got := inspector.count("db"); got != 1 {
+		t.Errorf("expected db to be checked only by name, got %d checks", got)
+	}
+
+	if err := detector.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start detector: %v", err)
+	}
+	defer detector.Stop()
+
+	time.Sleep(50 * time.Millisecond)
+	if got := inspector.count("db"); got != 1 {
+		t.Errorf("expected disabled db to be skipped, got %d checks", got)
+	}
+
+	detector.SetReleaseEnabled("db", true)
+	time.Sleep(50 * time.Millisecond)
+	if got := inspector.count("db"); got < 2 {
+		t.Errorf("expected db to be checked again once enabled, got %d checks", got)
+	}
+	if disabled := detector.DisabledReleases(); len(disabled) != 0 {
+		t.Errorf("expected no disabled releases, got %v", disabled)
+	}
+}
+
+func TestPausedDetectorChecksWhenResumed(t *testing.T) {
+	manager := helmstate.NewManager("", "")
+	manager.Spec = &helmstate.HelmfileSpec{Releases: []helmstate.Release{{Name: "web"}}}
+
+	inspector := &countingInspector{checks: make(map[string]int)}
+	detector := NewDetector(manager, time.Hour, zap.NewNop())
+	detector.inspector = inspector
+	detector.SetPaused(true)
+
+	if err := detector.Start(context.Background()); err != nil {
+		t.Fatalf("failed to start detector: %v", err)
+	}
+	defer detector.Stop()
+
+	time.Sleep(50 * time.Millisecond)
+	if got := inspector.count("web"); got != 0 {
+		t.Fatalf("expected no checks while paused, got %d", got)
+	}
+
+	detector.SetPaused(false)
+	time.Sleep(50 * time.Millisecond)
+	if got := inspector.count("web"); got != 1 {
+		t.Errorf("expected the due check once resumed, got %d", got)
+	}
+}
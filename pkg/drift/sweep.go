@@ -0,0 +1,221 @@
+package drift
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/tracing"
+	"go.uber.org/zap"
+)
+
+// DefaultWorkers is how many releases are diffed at once by default
+const DefaultWorkers = 4
+
+// sweepInspector is implemented by inspectors that can share work, such as
+// pulled charts, between the releases of a sweep
+type sweepInspector interface {
+	BeginSweep() error
+	EndSweep()
+}
+
+// manifestInspector is implemented by inspectors that can tell cheaply that
+// a release can't have drifted, so its diff can be skipped
+type manifestInspector interface {
+	ManifestsMatch(release helmstate.Release) (bool, error)
+}
+
+// SweepStats describes a drift sweep, a check of the releases due at once
+type SweepStats struct {
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+	Releases int           `json:"releases"`
+	Drifted  int           `json:"drifted"`
+	Failed   int           `json:"failed"`
+	Skipped  int           `json:"skipped"` // diffs skipped as manifests matched
+	Workers  int           `json:"workers"`
+}
+
+// SweepMetrics describes the sweeps of a detector
+type SweepMetrics struct {
+	Sweeps        int           `json:"sweeps"`
+	TotalDuration time.Duration `json:"totalDuration"`
+	Last          *SweepStats   `json:"last,omitempty"`
+}
+
+// SetWorkers sets how many releases are diffed at once; DefaultWorkers
+// when n is below 1
+func (d *Detector) SetWorkers(n int) {
+	if n < 1 {
+		n = DefaultWorkers
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.workers = n
+}
+
+// SetPrecheck sets whether the manifest helm stored for a release is
+// compared with the release rendered locally before diffing it, skipping
+// the diff when they match. It is enabled by default.
+func (d *Detector) SetPrecheck(enabled bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.precheck = enabled
+}
+
+// manifestsMatch reports whether the pre-check found a release's stored and
+// rendered manifests the same; false when it's disabled or fails, so the
+// release is diffed
+func (d *Detector) manifestsMatch(release helmstate.Release) bool {
+	d.mu.RLock()
+	enabled := d.precheck
+	d.mu.RUnlock()
+	inspector, ok := d.inspector.(manifestInspector)
+	if !enabled || !ok {
+		return false
+	}
+
+	match, err := inspector.ManifestsMatch(release)
+	if err != nil {
+		d.logger.Debug("manifest pre-check failed, diffing release",
+			zap.String("release", release.Name),
+			zap.Error(err))
+		return false
+	}
+	return match
+}
+
+// Metrics returns the counts and durations of the sweeps so far
+func (d *Detector) Metrics() SweepMetrics {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	metrics := d.metrics
+	if metrics.Last != nil {
+		last := *metrics.Last
+		metrics.Last = &last
+	}
+	return metrics
+}
+
+// inspection is the outcome of checking a release
+type inspection struct {
+	release helmstate.Release
+	report  *DriftReport
+	skipped bool
+	err     error
+}
+
+// inspect checks a release for drift in a trace span
+func (d *Detector) inspect(release helmstate.Release) inspection {
+	_, span := tracing.Start(context.Background(), "drift.check",
+		tracing.String("release.name", release.Name), tracing.String("release.namespace", release.Namespace))
+	report, skipped, err := d.examine(release)
+	span.SetAttributes(tracing.Bool("drift.detected", report != nil), tracing.Bool("drift.diff_skipped", skipped))
+	if report != nil {
+		span.SetAttributes(tracing.String("drift.type", string(report.DriftType)), tracing.String("drift.severity", string(report.Severity)))
+	}
+	span.End(err)
+	return inspection{release: release, report: report, skipped: skipped, err: err}
+}
+
+// sweep checks releases, diffing up to the configured number of them at
+// once, then handles the drift found in release order, so notifiers and
+// healing see one report at a time. Sweeps run one at a time. It returns
+// the reports handled.
+func (d *Detector) sweep(releases []helmstate.Release) []DriftReport {
+	if len(releases) == 0 {
+		return nil
+	}
+
+	d.sweepMu.Lock()
+	defer d.sweepMu.Unlock()
+
+	d.mu.RLock()
+	workers := d.workers
+	d.mu.RUnlock()
+	if workers < 1 {
+		workers = DefaultWorkers
+	}
+	if workers > len(releases) {
+		workers = len(releases)
+	}
+
+	stats := SweepStats{Started: time.Now(), Releases: len(releases), Workers: workers}
+
+	if s, ok := d.inspector.(sweepInspector); ok {
+		if err := s.BeginSweep(); err != nil {
+			d.logger.Warn("failed to share charts between drift checks", zap.Error(err))
+		} else {
+			defer s.EndSweep()
+		}
+	}
+
+	results := make([]inspection, len(releases))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = d.inspect(releases[i])
+			}
+		}()
+	}
+	for i := range releases {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	var reports []DriftReport
+	for _, result := range results {
+		switch {
+		case result.err != nil:
+			stats.Failed++
+		case result.report != nil:
+			stats.Drifted++
+		case result.skipped:
+			stats.Skipped++
+		}
+		if report := d.handleInspection(result); report != nil {
+			reports = append(reports, *report)
+		}
+	}
+
+	stats.Duration = time.Since(stats.Started)
+	d.logger.Info("drift sweep finished",
+		zap.Int("releases", stats.Releases),
+		zap.Int("drifted", stats.Drifted),
+		zap.Int("failed", stats.Failed),
+		zap.Int("skipped", stats.Skipped),
+		zap.Int("workers", stats.Workers),
+		zap.Duration("duration", stats.Duration))
+
+	d.mu.Lock()
+	d.metrics.Sweeps++
+	d.metrics.TotalDuration += stats.Duration
+	d.metrics.Last = &stats
+	d.mu.Unlock()
+
+	return reports
+}
+
+// handleInspection handles the outcome of checking a release, returning
+// the report of drift found
+func (d *Detector) handleInspection(result inspection) *DriftReport {
+	if result.err != nil {
+		return nil
+	}
+	if result.report == nil {
+		d.clearPending(result.release)
+		d.resolve(releaseKey(result.release), time.Now())
+		return nil
+	}
+
+	handled := d.handleCheckedReport(*result.report)
+	return &handled
+}
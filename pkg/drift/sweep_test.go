@@ -0,0 +1,156 @@
+package drift
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"go.uber.org/zap"
+)
+
+// slowInspector reports drift for every release after a delay, tracking how
+// many diffs run at once
+type slowInspector struct {
+	mu            sync.Mutex
+	running, peak int
+	sweeps        int
+}
+
+func (s *slowInspector) ReleaseExists(helmstate.Release) (bool, error) {
+	return true, nil
+}
+
+func (s *slowInspector) DiffRelease(release helmstate.Release) (string, error) {
+	s.mu.Lock()
+	s.running++
+	if s.running > s.peak {
+		s.peak = s.running
+	}
+	s.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	s.mu.Lock()
+	s.running--
+	s.mu.Unlock()
+	return "+ replicas: 3 # " + release.Name, nil
+}
+
+func (s *slowInspector) FindOrphans() ([]helmstate.DeployedRelease, error) {
+	return nil, nil
+}
+
+func (s *slowInspector) BeginSweep() error {
+	s.sweeps++
+	return nil
+}
+
+func (s *slowInspector) EndSweep() {}
+
+func TestSweepDiffsConcurrently(t *testing.T) {
+	detector := NewDetector(nil, time.Minute, zap.NewNop())
+	inspector := &slowInspector{}
+	detector.inspector = inspector
+	detector.SetWorkers(3)
+	notifier := &MockNotifier{}
+	detector.AddNotifier(notifier)
+
+	var releases []helmstate.Release
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		releases = append(releases, helmstate.Release{Name: name})
+	}
+	reports := detector.sweep(releases)
+
+	if inspector.peak != 3 {
+		t.Errorf("expected 3 diffs at once, got %d", inspector.peak)
+	}
+	if inspector.sweeps != 1 {
+		t.Errorf("expected the inspector told about 1 sweep, got %d", inspector.sweeps)
+	}
+	if len(reports) != 6 || len(notifier.reports) != 6 {
+		t.Fatalf("expected 6 reports and notifications, got %d and %d", len(reports), len(notifier.reports))
+	}
+	for i, report := range notifier.reports {
+		if report.ReleaseName != releases[i].Name {
+			t.Errorf("expected reports handled in release order, got %s at %d", report.ReleaseName, i)
+		}
+	}
+
+	metrics := detector.Metrics()
+	if metrics.Sweeps != 1 || metrics.Last == nil || metrics.Last.Releases != 6 || metrics.Last.Drifted != 6 || metrics.Last.Workers != 3 {
+		t.Errorf("expected sweep metrics, got %+v", metrics)
+	}
+	if metrics.Last.Duration <= 0 || metrics.TotalDuration != metrics.Last.Duration {
+		t.Errorf("expected the sweep duration recorded, got %+v", metrics.Last)
+	}
+}
+
+func TestSweepsRunOneAtATime(t *testing.T) {
+	detector := NewDetector(nil, time.Minute, zap.NewNop())
+	inspector := &slowInspector{}
+	detector.inspector = inspector
+	detector.SetWorkers(2)
+
+	releases := []helmstate.Release{{Name: "a"}, {Name: "b"}}
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			detector.sweep(releases)
+		}()
+	}
+	wg.Wait()
+
+	if inspector.peak != 2 {
+		t.Errorf("expected the sweeps' diffs not to overlap, got %d at once", inspector.peak)
+	}
+	if metrics := detector.Metrics(); metrics.Sweeps != 2 {
+		t.Errorf("expected 2 sweeps, got %+v", metrics)
+	}
+}
+
+// matchInspector is a fakeInspector whose pre-check finds manifests matching
+type matchInspector struct {
+	fakeInspector
+	match bool
+	diffs int
+}
+
+func (m *matchInspector) ManifestsMatch(helmstate.Release) (bool, error) {
+	return m.match, nil
+}
+
+func (m *matchInspector) DiffRelease(release helmstate.Release) (string, error) {
+	m.diffs++
+	return m.fakeInspector.DiffRelease(release)
+}
+
+func TestSweepSkipsDiffWhenManifestsMatch(t *testing.T) {
+	detector := NewDetector(nil, time.Minute, zap.NewNop())
+	inspector := &matchInspector{fakeInspector: fakeInspector{exists: true, diff: "+ replicas: 3"}, match: true}
+	detector.inspector = inspector
+	detector.SetWorkers(1)
+	releases := []helmstate.Release{{Name: "web"}, {Name: "api"}}
+
+	if reports := detector.sweep(releases); len(reports) != 0 || inspector.diffs != 0 {
+		t.Fatalf("expected matching releases not diffed, got %d diffs and %+v", inspector.diffs, reports)
+	}
+	if last := detector.Metrics().Last; last.Skipped != 2 {
+		t.Errorf("expected 2 skipped diffs, got %+v", last)
+	}
+
+	inspector.match = false
+	if reports := detector.sweep(releases); len(reports) != 2 || inspector.diffs != 2 {
+		t.Errorf("expected differing releases diffed, got %d diffs and %+v", inspector.diffs, reports)
+	}
+
+	inspector.match = true
+	inspector.diffs = 0
+	detector.SetPrecheck(false)
+	detector.sweep(releases)
+	if inspector.diffs != 2 {
+		t.Errorf("expected every release diffed with the pre-check disabled, got %d diffs", inspector.diffs)
+	}
+}
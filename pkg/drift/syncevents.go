@@ -0,0 +1,232 @@
+package drift
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/sync"
+	"go.uber.org/zap"
+)
+
+// SyncPhase is the point in a sync's lifecycle a SyncEvent reports
+type SyncPhase string
+
+const (
+	SyncStarted   SyncPhase = "started"
+	SyncSucceeded SyncPhase = "succeeded"
+	SyncFailed    SyncPhase = "failed"
+)
+
+// SyncEvent announces that a sync run, or the sync of one release in it,
+// started or finished
+type SyncEvent struct {
+	Timestamp time.Time `json:"timestamp"`
+	SyncID    string    `json:"syncId,omitempty"`
+	Trigger   string    `json:"trigger,omitempty"`
+	Phase     SyncPhase `json:"phase"`
+
+	// ReleaseName and Namespace are empty for events of the whole run
+	ReleaseName string `json:"releaseName,omitempty"`
+	Namespace   string `json:"namespace,omitempty"`
+
+	// Revision is the helm revision a release was deployed as
+	Revision int           `json:"revision,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+	Error    string        `json:"error,omitempty"`
+
+	// Releases is how many releases the run syncs, and Failed how many of
+	// them failed or timed out once it finished
+	Releases int `json:"releases,omitempty"`
+	Failed   int `json:"failed,omitempty"`
+
+	// Tests are the smoke tests run after a release synced
+	Tests []sync.TestResult `json:"tests,omitempty"`
+}
+
+// TestsPassed counts the smoke tests that passed
+func (e SyncEvent) TestsPassed() int {
+	passed := 0
+	for _, test := range e.Tests {
+		if test.Passed {
+			passed++
+		}
+	}
+	return passed
+}
+
+// Subject names what the event is about: the release, or the run
+func (e SyncEvent) Subject() string {
+	if e.ReleaseName == "" {
+		return "sync run"
+	}
+	if e.Namespace == "" {
+		return e.ReleaseName
+	}
+	return e.Namespace + "/" + e.ReleaseName
+}
+
+// SyncNotifier is implemented by notifiers that can also announce syncs
+type SyncNotifier interface {
+	NotifySync(event SyncEvent) error
+}
+
+// Events a configured notifier can be sent, chosen with its events option
+const (
+	EventsDrift = "drift"
+	EventsSync  = "sync"
+)
+
+// eventFilter is a configured notifier that opted into sync events, and
+// possibly out of drift reports
+type eventFilter struct {
+	Notifier
+	drift bool
+}
+
+// Notify passes the report on unless the notifier opted out of drift
+func (f eventFilter) Notify(report DriftReport) error {
+	if !f.drift {
+		return nil
+	}
+	return f.Notifier.Notify(report)
+}
+
+// NotifySync passes the event on
+func (f eventFilter) NotifySync(event SyncEvent) error {
+	return f.Notifier.(SyncNotifier).NotifySync(event)
+}
+
+// filterEvents applies the events option of a notifier's configuration.
+// Notifiers are sent drift reports only unless it lists sync.
+func filterEvents(cfg NotifierConfig, n Notifier) (Notifier, error) {
+	events := cfg.StringSlice("events")
+	if len(events) == 0 {
+		return n, nil
+	}
+
+	filter := eventFilter{Notifier: n}
+	syncEvents := false
+	for _, event := range events {
+		switch event {
+		case EventsDrift:
+			filter.drift = true
+		case EventsSync:
+			syncEvents = true
+		default:
+			return nil, fmt.Errorf("unknown event %q (available: %s, %s)", event, EventsDrift, EventsSync)
+		}
+	}
+	if !syncEvents {
+		return n, nil
+	}
+	if _, ok := n.(SyncNotifier); !ok {
+		return nil, fmt.Errorf("%s notifiers can't be sent sync events", cfg.Type)
+	}
+	return filter, nil
+}
+
+// SyncNotifiers returns those of notifiers configured to be sent sync
+// events. Notifiers not made from configuration never are, so the stdout
+// notifier and drift webhook stay about drift.
+func SyncNotifiers(notifiers []Notifier) []SyncNotifier {
+	var selected []SyncNotifier
+	for _, n := range notifiers {
+		if filter, ok := n.(eventFilter); ok {
+			selected = append(selected, filter)
+		}
+	}
+	return selected
+}
+
+// SyncAnnouncer sends the lifecycle events of one sync run to notifiers.
+// Events are sent in order as they happen; a nil announcer sends nothing.
+type SyncAnnouncer struct {
+	notifiers []SyncNotifier
+	syncID    string
+	trigger   string
+	logger    *zap.Logger
+}
+
+// NewSyncAnnouncer creates an announcer of the run of report, or nil when
+// no notifier wants sync events
+func NewSyncAnnouncer(notifiers []SyncNotifier, report *sync.Report, trigger string, logger *zap.Logger) *SyncAnnouncer {
+	if len(notifiers) == 0 {
+		return nil
+	}
+	return &SyncAnnouncer{
+		notifiers: notifiers,
+		syncID:    report.SyncID,
+		trigger:   trigger,
+		logger:    logger,
+	}
+}
+
+// RunStarted announces the run starting to sync releases
+func (a *SyncAnnouncer) RunStarted(releases int) {
+	a.send(SyncEvent{Phase: SyncStarted, Releases: releases})
+}
+
+// ReleaseStarted announces a release starting to sync
+func (a *SyncAnnouncer) ReleaseStarted(name, namespace string) {
+	a.send(SyncEvent{Phase: SyncStarted, ReleaseName: name, Namespace: namespace})
+}
+
+// ReleaseFinished announces the outcome of a release's sync. Skipped
+// releases never started, so nothing is announced for them.
+func (a *SyncAnnouncer) ReleaseFinished(result sync.ReleaseResult) {
+	if result.Status == sync.ReleaseStatusSkipped {
+		return
+	}
+	event := SyncEvent{
+		Phase:       SyncSucceeded,
+		ReleaseName: result.Name,
+		Namespace:   result.Namespace,
+		Duration:    result.Duration,
+		Error:       result.Error,
+	}
+	if result.Status != sync.ReleaseStatusSucceeded {
+		event.Phase = SyncFailed
+	}
+	if result.Helm != nil {
+		event.Revision = result.Helm.Revision
+		event.Tests = result.Helm.Tests
+	}
+	a.send(event)
+}
+
+// RunFinished announces the outcome of the run
+func (a *SyncAnnouncer) RunFinished(report *sync.Report) {
+	event := SyncEvent{
+		Phase:    SyncSucceeded,
+		Duration: report.Duration,
+		Releases: len(report.Results),
+		Failed:   report.Count(sync.ReleaseStatusFailed) + report.Count(sync.ReleaseStatusTimedOut),
+	}
+	if event.Duration == 0 {
+		event.Duration = time.Since(report.StartTime)
+	}
+	if report.Failed() {
+		event.Phase = SyncFailed
+		event.Error = fmt.Sprintf("%d of %d release(s) failed", event.Failed, event.Releases)
+	}
+	a.send(event)
+}
+
+// send stamps the event with the run and sends it to every notifier,
+// logging the failures
+func (a *SyncAnnouncer) send(event SyncEvent) {
+	if a == nil {
+		return
+	}
+	event.Timestamp = time.Now()
+	event.SyncID = a.syncID
+	event.Trigger = a.trigger
+	for _, n := range a.notifiers {
+		if err := n.NotifySync(event); err != nil {
+			a.logger.Warn("failed to send sync notification",
+				zap.String("subject", event.Subject()),
+				zap.String("phase", string(event.Phase)),
+				zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package drift
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/sync"
+	"go.uber.org/zap"
+)
+
+func TestNotifierEvents(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get("X-Helmfire-Event"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	webhook := func(events ...interface{}) NotifierConfig {
+		options := map[string]interface{}{"url": server.URL}
+		if len(events) > 0 {
+			options["events"] = events
+		}
+		return NotifierConfig{Type: "webhook", Options: options}
+	}
+	notifiers, err := NewNotifiers([]NotifierConfig{
+		webhook(),
+		webhook("sync"),
+		webhook("drift", "sync"),
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewNotifiers failed: %v", err)
+	}
+	if _, ok := notifiers[0].(*WebhookNotifier); !ok {
+		t.Errorf("expected a notifier without events to be left as is, got %T", notifiers[0])
+	}
+
+	// Drift only reaches the notifiers that didn't opt out of it, sync
+	// events only those that opted in
+	for _, n := range notifiers {
+		if err := n.Notify(DriftReport{ReleaseName: "web"}); err != nil {
+			t.Fatalf("Notify failed: %v", err)
+		}
+	}
+	syncNotifiers := SyncNotifiers(append(notifiers, NewStdoutNotifier(zap.NewNop())))
+	if len(syncNotifiers) != 2 {
+		t.Fatalf("expected 2 sync notifiers, got %d", len(syncNotifiers))
+	}
+	for _, n := range syncNotifiers {
+		if err := n.NotifySync(SyncEvent{Phase: SyncStarted}); err != nil {
+			t.Fatalf("NotifySync failed: %v", err)
+		}
+	}
+	if strings.Join(received, ",") != "drift,drift,sync,sync" {
+		t.Errorf("unexpected deliveries %v", received)
+	}
+
+	for _, cfg := range []NotifierConfig{
+		{Type: "webhook", Options: map[string]interface{}{"url": server.URL, "events": "deploys"}},
+		{Type: "kube-events", Options: map[string]interface{}{"events": "sync"}},
+	} {
+		if _, err := NewNotifier(cfg, zap.NewNop()); err == nil {
+			t.Errorf("expected an error for %+v", cfg)
+		}
+	}
+}
+
+func TestSyncAnnouncer(t *testing.T) {
+	var events []SyncEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event SyncEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		events = append(events, event)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	report := sync.NewReport()
+	announcer := NewSyncAnnouncer([]SyncNotifier{NewWebhookNotifier(server.URL, zap.NewNop())}, report, "source", zap.NewNop())
+	announcer.RunStarted(2)
+	announcer.ReleaseStarted("web", "apps")
+	report.RecordRelease("web", "apps", time.Second, &sync.HelmRelease{Revision: 4}, nil)
+	announcer.ReleaseFinished(report.Results[0])
+	report.Skip("worker", "apps", "previous release failed")
+	announcer.ReleaseFinished(report.Results[1])
+	report.Finish()
+	announcer.RunFinished(report)
+
+	if len(events) != 4 {
+		t.Fatalf("expected 4 events, got %+v", events)
+	}
+	if events[0].Phase != SyncStarted || events[0].Releases != 2 || events[0].ReleaseName != "" {
+		t.Errorf("unexpected run start %+v", events[0])
+	}
+	if events[2].Phase != SyncSucceeded || events[2].Subject() != "apps/web" || events[2].Revision != 4 {
+		t.Errorf("unexpected release result %+v", events[2])
+	}
+	if events[3].Phase != SyncSucceeded || events[3].Releases != 2 || events[3].Failed != 0 {
+		t.Errorf("unexpected run result %+v", events[3])
+	}
+	for _, event := range events {
+		if event.SyncID != report.SyncID || event.Trigger != "source" {
+			t.Errorf("expected events stamped with the run, got %+v", event)
+		}
+	}
+
+	// Nobody to announce to
+	if a := NewSyncAnnouncer(nil, report, "source", zap.NewNop()); a != nil {
+		t.Errorf("expected a nil announcer, got %+v", a)
+	}
+	var nobody *SyncAnnouncer
+	nobody.RunFinished(report)
+}
+
+func TestSlackSyncMessage(t *testing.T) {
+	message := slackSyncMessage(SyncEvent{
+		SyncID:      "abc123",
+		Trigger:     "cli",
+		Phase:       SyncFailed,
+		ReleaseName: "web",
+		Namespace:   "apps",
+		Duration:    90 * time.Second,
+		Error:       "timed out waiting for the condition",
+	})
+	if message["text"] != "Sync of apps/web failed in 1m30s: timed out waiting for the condition" {
+		t.Errorf("unexpected text %q", message["text"])
+	}
+	data, _ := json.Marshal(message)
+	if !strings.Contains(string(data), ":x:") || !strings.Contains(string(data), "triggered by cli") {
+		t.Errorf("unexpected message %s", data)
+	}
+}
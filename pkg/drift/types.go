@@ -12,6 +12,15 @@ const (
 	DriftTypeResource      DriftType = "resource"
 	DriftTypeImage         DriftType = "image"
 	DriftTypeDeletion      DriftType = "deletion"
+	DriftTypeOrphan        DriftType = "orphan"
+
+	// DriftTypeResolved reports that drift notified earlier is gone
+	// without being healed
+	DriftTypeResolved DriftType = "resolved"
+
+	// DriftTypeAuth reports that the cluster keeps rejecting helmfire's
+	// credentials, so drift can't be detected
+	DriftTypeAuth DriftType = "auth"
 )
 
 // Severity indicates the importance of the drift
@@ -25,14 +34,28 @@ const (
 
 // DriftReport describes detected drift in a release
 type DriftReport struct {
-	Timestamp   time.Time `json:"timestamp"`
-	ReleaseName string    `json:"releaseName"`
-	Namespace   string    `json:"namespace"`
-	DriftType   DriftType `json:"driftType"`
-	Severity    Severity  `json:"severity"`
-	Details     string    `json:"details"`
-	Diff        string    `json:"diff"`
-	Healed      bool      `json:"healed"`
+	ID              string     `json:"id"`
+	Timestamp       time.Time  `json:"timestamp"`
+	ReleaseName     string     `json:"releaseName"`
+	Namespace       string     `json:"namespace"`
+	KubeContext     string     `json:"kubeContext,omitempty"` // of orphans
+	DriftType       DriftType  `json:"driftType"`
+	Severity        Severity   `json:"severity"`
+	Details         string     `json:"details"`
+	Diff            string     `json:"diff"`
+	Hunks           []DiffHunk `json:"hunks,omitempty"`
+	Healed          bool       `json:"healed"`
+	PendingApproval bool       `json:"pendingApproval,omitempty"`
+	HealPreview     string     `json:"healPreview,omitempty"`
+	Fingerprint     string     `json:"fingerprint,omitempty"`
+
+	// ManagedBy are the ArgoCD and Flux objects also managing the release's
+	// resources
+	ManagedBy []GitOpsOwner `json:"managedBy,omitempty"`
+
+	// ValuesDiff are the values that differ between the deployed release
+	// and the helmfile; nil when they couldn't be compared
+	ValuesDiff *ValuesDiff `json:"valuesDiff,omitempty"`
 }
 
 // Notifier defines the interface for drift notification mechanisms
@@ -0,0 +1,180 @@
+package drift
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxValueLength is the longest value a ValueChange shows
+	maxValueLength = 200
+
+	// maxDetailPaths is how many changed values report details name
+	maxDetailPaths = 5
+)
+
+// ValuesDiff explains drift by the helm values of a release: those that
+// differ between the deployed revision and the helmfile. Drift without
+// changed values comes from elsewhere, such as resources edited with
+// kubectl or a new chart version.
+type ValuesDiff struct {
+	Changes []ValueChange `json:"changes"`
+}
+
+// String lists the changed values, one per line
+func (v *ValuesDiff) String() string {
+	if v == nil {
+		return ""
+	}
+	lines := make([]string, len(v.Changes))
+	for i, change := range v.Changes {
+		lines[i] = change.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ValueChange is a value that differs, by its dotted path. Values are
+// JSON; Deployed is empty for values the helmfile adds and Desired for
+// those it no longer sets.
+type ValueChange struct {
+	Path     string `json:"path"`
+	Deployed string `json:"deployed,omitempty"`
+	Desired  string `json:"desired,omitempty"`
+}
+
+func (c ValueChange) String() string {
+	switch {
+	case c.Deployed == "":
+		return fmt.Sprintf("%s: added %s", c.Path, c.Desired)
+	case c.Desired == "":
+		return fmt.Sprintf("%s: removed %s", c.Path, c.Deployed)
+	default:
+		return fmt.Sprintf("%s: %s → %s", c.Path, c.Deployed, c.Desired)
+	}
+}
+
+// valuesInspector is implemented by inspectors that can read the values
+// of a release as deployed and as the helmfile sets them
+type valuesInspector interface {
+	DeployedValues(release helmstate.Release) (map[string]interface{}, error)
+	DesiredValues(release helmstate.Release) (helmstate.ReleaseValues, error)
+}
+
+// DiffValues returns the values that differ between deployed and desired,
+// by path. Maps are compared key by key and anything else as a whole.
+// Secret values can't be compared, and are left out.
+func DiffValues(deployed map[string]interface{}, desired helmstate.ReleaseValues) []ValueChange {
+	secret := make(map[string]bool, len(desired.Secret))
+	for _, path := range desired.Secret {
+		secret[path] = true
+	}
+	var changes []ValueChange
+	diffValues(deployed, desired.Values, "", secret, &changes)
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+func diffValues(deployed, desired map[string]interface{}, prefix string, secret map[string]bool, changes *[]ValueChange) {
+	keys := make(map[string]bool, len(deployed)+len(desired))
+	for key := range deployed {
+		keys[key] = true
+	}
+	for key := range desired {
+		keys[key] = true
+	}
+
+	for key := range keys {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		if secret[path] {
+			continue
+		}
+		before, hadBefore := deployed[key]
+		after, hasAfter := desired[key]
+		beforeMap, beforeIsMap := before.(map[string]interface{})
+		afterMap, afterIsMap := after.(map[string]interface{})
+		switch {
+		case beforeIsMap && afterIsMap:
+			diffValues(beforeMap, afterMap, path, secret, changes)
+		case hadBefore && hasAfter && reflect.DeepEqual(before, after):
+		default:
+			change := ValueChange{Path: path}
+			if hadBefore {
+				change.Deployed = formatValue(before)
+			}
+			if hasAfter {
+				change.Desired = formatValue(after)
+			}
+			*changes = append(*changes, change)
+		}
+	}
+}
+
+// formatValue encodes a value as JSON, shortened when long
+func formatValue(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	s := string(data)
+	if len(s) > maxValueLength {
+		s = s[:maxValueLength] + "…"
+	}
+	return s
+}
+
+// valuesDiff compares the values of a drifted release, nil when they can't
+// be read
+func (d *Detector) valuesDiff(release helmstate.Release) *ValuesDiff {
+	inspector, ok := d.inspector.(valuesInspector)
+	if !ok {
+		return nil
+	}
+	deployed, err := inspector.DeployedValues(release)
+	if err == nil {
+		var desired helmstate.ReleaseValues
+		if desired, err = inspector.DesiredValues(release); err == nil {
+			changes := DiffValues(deployed, desired)
+			for i := range changes {
+				changes[i].Deployed = d.redact(changes[i].Deployed)
+				changes[i].Desired = d.redact(changes[i].Desired)
+			}
+			return &ValuesDiff{Changes: changes}
+		}
+	}
+	d.logger.Debug("failed to read values, not explaining drift by them",
+		zap.String("release", release.Name),
+		zap.Error(err))
+	return nil
+}
+
+// explainByValues sets the values diff of a drift report, and tells values
+// changed in the helmfile apart from changes made in the cluster
+func (d *Detector) explainByValues(release helmstate.Release, report *DriftReport) {
+	if report.ValuesDiff = d.valuesDiff(release); report.ValuesDiff == nil {
+		return
+	}
+	if changes := report.ValuesDiff.Changes; len(changes) > 0 {
+		paths := make([]string, 0, len(changes))
+		for i, change := range changes {
+			if i == maxDetailPaths {
+				paths = append(paths, "…")
+				break
+			}
+			paths = append(paths, change.Path)
+		}
+		report.Details = fmt.Sprintf("Configuration drift detected: %d value(s) differ from the deployed release (%s)",
+			len(changes), strings.Join(paths, ", "))
+		return
+	}
+	report.DriftType = DriftTypeResource
+	report.Details = "Resource drift detected: values match the deployed release, so resources were changed outside helm or the chart changed"
+}
@@ -0,0 +1,91 @@
+package drift
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"go.uber.org/zap"
+)
+
+// valuesFakeInspector is a fakeInspector that also returns release values
+type valuesFakeInspector struct {
+	fakeInspector
+	deployed map[string]interface{}
+	desired  helmstate.ReleaseValues
+}
+
+func (f *valuesFakeInspector) DeployedValues(helmstate.Release) (map[string]interface{}, error) {
+	return f.deployed, nil
+}
+
+func (f *valuesFakeInspector) DesiredValues(helmstate.Release) (helmstate.ReleaseValues, error) {
+	return f.desired, nil
+}
+
+func TestDiffValues(t *testing.T) {
+	deployed := map[string]interface{}{
+		"replicaCount": float64(1),
+		"image":        map[string]interface{}{"tag": "1.0", "pullPolicy": "Always"},
+		"debug":        true,
+		"password":     "hunter2",
+	}
+	desired := helmstate.ReleaseValues{
+		Values: map[string]interface{}{
+			"replicaCount": float64(3),
+			"image":        map[string]interface{}{"tag": "1.0"},
+			"ingress":      map[string]interface{}{"enabled": true},
+			"password":     "vault:secret/web#password",
+		},
+		Secret: []string{"password"},
+	}
+
+	got := DiffValues(deployed, desired)
+	want := []ValueChange{
+		{Path: "debug", Deployed: "true"},
+		{Path: "image.pullPolicy", Deployed: `"Always"`},
+		{Path: "ingress", Desired: `{"enabled":true}`},
+		{Path: "replicaCount", Deployed: "1", Desired: "3"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffValues() = %+v, want %+v", got, want)
+	}
+
+	if got := (&ValuesDiff{Changes: want}).String(); got != "debug: removed true\nimage.pullPolicy: removed \"Always\"\ningress: added {\"enabled\":true}\nreplicaCount: 1 → 3" {
+		t.Errorf("unexpected values diff text:\n%s", got)
+	}
+	if changes := DiffValues(deployed, helmstate.ReleaseValues{Values: deployed}); len(changes) != 0 {
+		t.Errorf("expected equal values not to differ, got %+v", changes)
+	}
+}
+
+func TestCheckReleaseDriftExplainsByValues(t *testing.T) {
+	detector := NewDetector(nil, 0, zap.NewNop())
+	inspector := &valuesFakeInspector{
+		fakeInspector: fakeInspector{exists: true, diff: secretDiff},
+		deployed:      map[string]interface{}{"replicaCount": float64(1)},
+		desired:       helmstate.ReleaseValues{Values: map[string]interface{}{"replicaCount": float64(3)}},
+	}
+	detector.inspector = inspector
+
+	report, err := detector.checkReleaseDrift(helmstate.Release{Name: "web"})
+	if err != nil || report == nil {
+		t.Fatalf("expected drift, got %v %v", report, err)
+	}
+	if report.ValuesDiff == nil || len(report.ValuesDiff.Changes) != 1 || report.ValuesDiff.Changes[0].Path != "replicaCount" {
+		t.Fatalf("expected replicaCount in the values diff, got %+v", report.ValuesDiff)
+	}
+	if report.DriftType != DriftTypeConfiguration || !strings.Contains(report.Details, "1 value(s) differ") {
+		t.Errorf("expected configuration drift explained by values, got %s: %s", report.DriftType, report.Details)
+	}
+
+	inspector.desired = helmstate.ReleaseValues{Values: inspector.deployed}
+	report, err = detector.checkReleaseDrift(helmstate.Release{Name: "web"})
+	if err != nil || report == nil {
+		t.Fatalf("expected drift, got %v %v", report, err)
+	}
+	if report.DriftType != DriftTypeResource || report.ValuesDiff == nil || len(report.ValuesDiff.Changes) != 0 {
+		t.Errorf("expected resource drift when values match, got %s: %+v", report.DriftType, report.ValuesDiff)
+	}
+}
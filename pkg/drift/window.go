@@ -0,0 +1,196 @@
+package drift
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxWindowDuration bounds how long a heal window lasts, which also bounds
+// how far back Contains looks for its start
+const maxWindowDuration = 7 * 24 * time.Hour
+
+// HealWindow is a recurring period starting whenever a cron expression
+// matches, in a time zone, and lasting Duration. Windows restrict when drift
+// may be auto-healed; see HealPolicy.
+type HealWindow struct {
+	Duration time.Duration
+	Location *time.Location
+
+	spec     string
+	schedule cronSchedule
+}
+
+// ParseHealWindow parses a window written as a five-field cron expression
+// (minute hour day-of-month month day-of-week) followed by its duration,
+// optionally prefixed with CRON_TZ=<zone>, such as
+// "CRON_TZ=Europe/Berlin 0 22 * * mon-fri 8h". Times are local without a
+// zone.
+func ParseHealWindow(spec string) (HealWindow, error) {
+	fields := strings.Fields(spec)
+	location := time.Local
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "CRON_TZ=") {
+		zone := strings.TrimPrefix(fields[0], "CRON_TZ=")
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return HealWindow{}, fmt.Errorf("invalid heal window %q: unknown time zone %q", spec, zone)
+		}
+		location = loc
+		fields = fields[1:]
+	}
+	if len(fields) != 6 {
+		return HealWindow{}, fmt.Errorf("invalid heal window %q: expected a cron expression (minute hour day month weekday) and a duration", spec)
+	}
+
+	schedule, err := parseCron(fields[:5])
+	if err != nil {
+		return HealWindow{}, fmt.Errorf("invalid heal window %q: %w", spec, err)
+	}
+	duration, err := time.ParseDuration(fields[5])
+	if err != nil || duration < time.Minute || duration > maxWindowDuration {
+		return HealWindow{}, fmt.Errorf("invalid heal window %q: duration must be between 1m and %s", spec, maxWindowDuration)
+	}
+
+	return HealWindow{Duration: duration, Location: location, spec: spec, schedule: schedule}, nil
+}
+
+// String returns the window as it was parsed
+func (w HealWindow) String() string {
+	return w.spec
+}
+
+// Contains reports whether t falls in the window, that is whether the cron
+// expression matched a minute less than Duration before t
+func (w HealWindow) Contains(t time.Time) bool {
+	location := w.Location
+	if location == nil {
+		location = time.Local
+	}
+	t = t.In(location)
+	minute := t.Truncate(time.Minute)
+	for start := minute; t.Sub(start) < w.Duration; start = start.Add(-time.Minute) {
+		if w.schedule.matches(start) {
+			return true
+		}
+	}
+	return false
+}
+
+// cronSchedule holds the values each cron field matches
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+// matches reports whether the schedule matches the minute of t. As in cron,
+// a time matches either restricted day field when both are restricted.
+func (s cronSchedule) matches(t time.Time) bool {
+	if s.minute&(1<<uint(t.Minute())) == 0 || s.hour&(1<<uint(t.Hour())) == 0 || s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// cronField describes the values of a cron field
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	cronMonths = map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}
+	cronWeekdays = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+	cronFields = []cronField{
+		{name: "minute", min: 0, max: 59},
+		{name: "hour", min: 0, max: 23},
+		{name: "day of month", min: 1, max: 31},
+		{name: "month", min: 1, max: 12, names: cronMonths},
+		{name: "day of week", min: 0, max: 7, names: cronWeekdays}, // 7 is Sunday too
+	}
+)
+
+// parseCron parses the five fields of a cron expression
+func parseCron(fields []string) (cronSchedule, error) {
+	var bits [5]uint64
+	for i, field := range cronFields {
+		b, err := field.parse(fields[i])
+		if err != nil {
+			return cronSchedule{}, err
+		}
+		bits[i] = b
+	}
+	// Sunday is 0 or 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	return cronSchedule{
+		minute: bits[0], hour: bits[1], dom: bits[2], month: bits[3], dow: bits[4],
+		domAny: strings.HasPrefix(fields[2], "*"), dowAny: strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+// parse returns the values matched by a comma-separated list of *, values
+// and ranges, each with an optional /step
+func (f cronField) parse(expr string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(expr, ",") {
+		rangeExpr, stepExpr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepExpr)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q in %s", stepExpr, f.name)
+			}
+			step = n
+		}
+
+		low, high := f.min, f.max
+		if rangeExpr != "*" {
+			lowExpr, highExpr, isRange := strings.Cut(rangeExpr, "-")
+			var err error
+			if low, err = f.value(lowExpr); err != nil {
+				return 0, err
+			}
+			high = low
+			if isRange {
+				if high, err = f.value(highExpr); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				high = f.max
+			}
+			if high < low {
+				return 0, fmt.Errorf("invalid range %q in %s", rangeExpr, f.name)
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// value parses a number or name of the field
+func (f cronField) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s %q (expected %d-%d)", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
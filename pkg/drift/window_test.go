@@ -0,0 +1,71 @@
+package drift
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHealWindowContains(t *testing.T) {
+	// Weeknights from 22:00 Berlin time for 8 hours
+	window, err := ParseHealWindow("CRON_TZ=Europe/Berlin 0 22 * * mon-fri 8h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		time     time.Time
+		expected bool
+	}{
+		{"start", time.Date(2024, 1, 15, 22, 0, 0, 0, berlin), true},         // Monday
+		{"overnight", time.Date(2024, 1, 16, 5, 59, 0, 0, berlin), true},     // Tuesday morning
+		{"end", time.Date(2024, 1, 16, 6, 0, 0, 0, berlin), false},           // 8h after start
+		{"before", time.Date(2024, 1, 15, 21, 59, 0, 0, berlin), false},      // Monday evening
+		{"weekend", time.Date(2024, 1, 13, 23, 0, 0, 0, berlin), false},      // Saturday
+		{"other zone", time.Date(2024, 1, 15, 21, 30, 0, 0, time.UTC), true}, // 22:30 in Berlin
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := window.Contains(tt.time); got != tt.expected {
+				t.Errorf("Contains(%s) = %v, expected %v", tt.time, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	schedule, err := parseCron([]string{"*/15", "9-17", "1,15", "*", "7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Either day field matches when both are restricted
+	if !schedule.matches(time.Date(2024, 3, 1, 9, 45, 0, 0, time.UTC)) { // Friday the 1st
+		t.Error("expected the 1st at 9:45 to match")
+	}
+	if !schedule.matches(time.Date(2024, 3, 3, 17, 0, 0, 0, time.UTC)) { // Sunday
+		t.Error("expected Sunday at 17:00 to match")
+	}
+	if schedule.matches(time.Date(2024, 3, 2, 9, 45, 0, 0, time.UTC)) { // Saturday the 2nd
+		t.Error("expected Saturday the 2nd not to match")
+	}
+	if schedule.matches(time.Date(2024, 3, 1, 9, 50, 0, 0, time.UTC)) {
+		t.Error("expected 9:50 not to match */15")
+	}
+
+	for _, spec := range []string{
+		"0 22 * * mon-fri",
+		"0 22 * * * 0s",
+		"60 22 * * * 1h",
+		"0 22 * * fri-mon 1h",
+		"CRON_TZ=Nowhere/City 0 22 * * * 1h",
+		"0 22 * * * 30d",
+	} {
+		if _, err := ParseHealWindow(spec); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+}
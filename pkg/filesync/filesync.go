@@ -0,0 +1,233 @@
+// Package filesync copies changed local files into the running pods of a
+// release with kubectl, so interpreted apps pick up edits without a new
+// image or a helm upgrade
+package filesync
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/watcher"
+	"go.uber.org/zap"
+)
+
+// InstanceLabel selects the pods of a release when a file sync sets no
+// selector; helm charts following the recommended labels set it
+const InstanceLabel = "app.kubernetes.io/instance"
+
+// Change is the files of one file sync of a release changed by local edits.
+// Paths are relative to the sync's src and slash separated.
+type Change struct {
+	Release   string
+	Namespace string
+	Sync      helmstate.FileSync
+	Updated   []string
+	Removed   []string
+}
+
+// Plan returns the changes events make to the file syncs of a release
+func Plan(release helmstate.Release, namespace string, events []watcher.Event) []Change {
+	var changes []Change
+	for _, fileSync := range release.Sync {
+		change := Change{Release: release.Name, Namespace: namespace, Sync: fileSync}
+		for _, event := range events {
+			rel, ok := relativePath(fileSync.Src, event.Path)
+			if !ok {
+				continue
+			}
+			if event.Removed {
+				change.Removed = append(change.Removed, rel)
+			} else {
+				change.Updated = append(change.Updated, rel)
+			}
+		}
+		if len(change.Updated)+len(change.Removed) > 0 {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// relativePath returns file relative to src, which is either file itself or
+// a directory containing it
+func relativePath(src, file string) (string, bool) {
+	if file == src {
+		return filepath.Base(file), true
+	}
+	rel, err := filepath.Rel(src, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// Syncer applies changes to pods with kubectl exec. The containers need sh
+// and tar, as for kubectl cp.
+type Syncer struct {
+	Kubectl     string
+	KubeContext string
+	Logger      *zap.Logger
+}
+
+// NewSyncer returns a syncer using kubectl from PATH
+func NewSyncer(logger *zap.Logger) *Syncer {
+	return &Syncer{Kubectl: "kubectl", Logger: logger}
+}
+
+// Selector returns the label selector of the pods a file sync copies into
+func Selector(release string, fileSync helmstate.FileSync) string {
+	if fileSync.Selector != "" {
+		return fileSync.Selector
+	}
+	return InstanceLabel + "=" + release
+}
+
+// Apply copies the updated files of change into every running pod of its
+// release and deletes the removed ones, returning the pods updated
+func (s *Syncer) Apply(ctx context.Context, change Change) ([]string, error) {
+	pods, err := s.runningPods(ctx, change.Namespace, Selector(change.Release, change.Sync))
+	if err != nil {
+		return nil, err
+	}
+	if len(pods) == 0 {
+		return nil, fmt.Errorf("no running pods of %s match %s", change.Release, Selector(change.Release, change.Sync))
+	}
+
+	var archive []byte
+	if len(change.Updated) > 0 {
+		if archive, err = tarFiles(change.Sync.Src, change.Updated); err != nil {
+			return nil, fmt.Errorf("failed to archive %s: %w", change.Sync.Src, err)
+		}
+	}
+
+	for _, pod := range pods {
+		s.Logger.Info("syncing files into pod",
+			zap.String("release", change.Release),
+			zap.String("pod", pod),
+			zap.Int("updated", len(change.Updated)),
+			zap.Int("removed", len(change.Removed)))
+
+		if len(change.Updated) > 0 {
+			script := `mkdir -p "$1" && tar -xmf - -C "$1"`
+			if _, err := s.run(ctx, bytes.NewReader(archive), s.execArgs(change, pod, "sh", "-c", script, "--", change.Sync.Dest)...); err != nil {
+				return nil, fmt.Errorf("failed to copy files into %s: %w", pod, err)
+			}
+		}
+		if len(change.Removed) > 0 {
+			args := []string{"rm", "-f", "--"}
+			for _, rel := range change.Removed {
+				args = append(args, path.Join(change.Sync.Dest, rel))
+			}
+			if _, err := s.run(ctx, nil, s.execArgs(change, pod, args...)...); err != nil {
+				return nil, fmt.Errorf("failed to delete files in %s: %w", pod, err)
+			}
+		}
+	}
+	return pods, nil
+}
+
+// runningPods returns the names of the running pods matching selector
+func (s *Syncer) runningPods(ctx context.Context, namespace, selector string) ([]string, error) {
+	out, err := s.run(ctx, nil, s.contextArgs("get", "pods",
+		"--namespace", namespace,
+		"--selector", selector,
+		"--field-selector", "status.phase=Running",
+		"--output", "jsonpath={.items[*].metadata.name}")...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	pods := strings.Fields(out)
+	sort.Strings(pods)
+	return pods, nil
+}
+
+// execArgs builds kubectl exec arguments running command in the container
+// of change in pod
+func (s *Syncer) execArgs(change Change, pod string, command ...string) []string {
+	args := []string{"exec", "--stdin", pod, "--namespace", change.Namespace}
+	if change.Sync.Container != "" {
+		args = append(args, "--container", change.Sync.Container)
+	}
+	args = s.contextArgs(args...)
+	return append(append(args, "--"), command...)
+}
+
+// contextArgs adds the kube context to kubectl arguments
+func (s *Syncer) contextArgs(args ...string) []string {
+	if s.KubeContext != "" {
+		args = append(args, "--context", s.KubeContext)
+	}
+	return args
+}
+
+// run executes kubectl with stdin and returns its stdout
+func (s *Syncer) run(ctx context.Context, stdin io.Reader, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, s.Kubectl, args...)
+	cmd.Stdin = stdin
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	s.Logger.Debug("executing kubectl command", zap.Strings("args", args))
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%w\nstderr: %s", err, stderr.String())
+	}
+	return stdout.String(), nil
+}
+
+// tarFiles archives the files at the slash separated paths relative to src,
+// which may also be a single file. Files removed since are skipped.
+func tarFiles(src string, files []string) ([]byte, error) {
+	info, err := os.Stat(src)
+	single := err == nil && !info.IsDir()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+
+	for _, rel := range files {
+		file := filepath.Join(src, filepath.FromSlash(rel))
+		if single {
+			file = src
+		}
+
+		data, err := os.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+
+		header := &tar.Header{
+			Name:    rel,
+			Mode:    int64(info.Mode().Perm()),
+			Size:    int64(len(data)),
+			ModTime: info.ModTime(),
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,151 @@
+package filesync
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/watcher"
+	"go.uber.org/zap"
+)
+
+func TestPlan(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	config := filepath.Join(filepath.Dir(src), "config.yaml")
+	release := helmstate.Release{
+		Name: "api",
+		Sync: []helmstate.FileSync{
+			{Src: src, Dest: "/app"},
+			{Src: config, Dest: "/etc/api"},
+		},
+	}
+	events := []watcher.Event{
+		{Path: filepath.Join(src, "app.py")},
+		{Path: filepath.Join(src, "lib", "util.py"), Removed: true},
+		{Path: config},
+		{Path: src + "-other/app.py"},
+	}
+
+	changes := Plan(release, "dev", events)
+	want := []Change{
+		{Release: "api", Namespace: "dev", Sync: release.Sync[0], Updated: []string{"app.py"}, Removed: []string{"lib/util.py"}},
+		{Release: "api", Namespace: "dev", Sync: release.Sync[1], Updated: []string{"config.yaml"}},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("expected %+v, got %+v", want, changes)
+	}
+
+	if changes := Plan(release, "dev", []watcher.Event{{Path: "/elsewhere/app.py"}}); len(changes) != 0 {
+		t.Errorf("expected no changes for unrelated files, got %+v", changes)
+	}
+}
+
+func TestSelector(t *testing.T) {
+	if got := Selector("api", helmstate.FileSync{}); got != "app.kubernetes.io/instance=api" {
+		t.Errorf("unexpected default selector %q", got)
+	}
+	if got := Selector("api", helmstate.FileSync{Selector: "app=worker"}); got != "app=worker" {
+		t.Errorf("expected the configured selector, got %q", got)
+	}
+}
+
+func TestApply(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake kubectl script requires a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(filepath.Join(src, "lib"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "lib", "util.py"), []byte("x = 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fake kubectl: two running pods; exec arguments and stdin are logged
+	// per pod
+	kubectl := filepath.Join(dir, "kubectl")
+	script := `#!/bin/sh
+case "$1" in
+get) echo "$@" > ` + dir + `/get; printf 'api-2 api-1' ;;
+exec) echo "$@" >> ` + dir + `/exec-$3; cat >> ` + dir + `/stdin-$3 ;;
+esac
+`
+	if err := os.WriteFile(kubectl, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	syncer := NewSyncer(zap.NewNop())
+	syncer.Kubectl = kubectl
+	syncer.KubeContext = "kind"
+	change := Change{
+		Release:   "api",
+		Namespace: "dev",
+		Sync:      helmstate.FileSync{Src: src, Dest: "/app", Container: "web"},
+		Updated:   []string{"lib/util.py", "gone.py"},
+		Removed:   []string{"old.py"},
+	}
+
+	pods, err := syncer.Apply(context.Background(), change)
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !reflect.DeepEqual(pods, []string{"api-1", "api-2"}) {
+		t.Errorf("unexpected pods %v", pods)
+	}
+
+	get, _ := os.ReadFile(filepath.Join(dir, "get"))
+	if strings.TrimSpace(string(get)) != "get pods --namespace dev --selector app.kubernetes.io/instance=api --field-selector status.phase=Running --output jsonpath={.items[*].metadata.name} --context kind" {
+		t.Errorf("unexpected pod listing: %s", get)
+	}
+
+	exec, _ := os.ReadFile(filepath.Join(dir, "exec-api-1"))
+	want := `exec --stdin api-1 --namespace dev --container web --context kind -- sh -c mkdir -p "$1" && tar -xmf - -C "$1" -- /app
+exec --stdin api-1 --namespace dev --container web --context kind -- rm -f -- /app/old.py
+`
+	if string(exec) != want {
+		t.Errorf("unexpected exec calls:\n%s\nwant:\n%s", exec, want)
+	}
+
+	// Files removed before the copy are left out of the archive
+	archive, _ := os.ReadFile(filepath.Join(dir, "stdin-api-2"))
+	tr := tar.NewReader(bytes.NewReader(archive))
+	header, err := tr.Next()
+	if err != nil {
+		t.Fatalf("expected a file in the archive: %v", err)
+	}
+	content, _ := io.ReadAll(tr)
+	if header.Name != "lib/util.py" || string(content) != "x = 1\n" {
+		t.Errorf("unexpected archive entry %s: %q", header.Name, content)
+	}
+	if _, err := tr.Next(); err != io.EOF {
+		t.Errorf("expected one file in the archive, got %v", err)
+	}
+}
+
+func TestApplyNoPods(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake kubectl script requires a POSIX shell")
+	}
+
+	kubectl := filepath.Join(t.TempDir(), "kubectl")
+	if err := os.WriteFile(kubectl, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	syncer := NewSyncer(zap.NewNop())
+	syncer.Kubectl = kubectl
+
+	_, err := syncer.Apply(context.Background(), Change{Release: "api", Namespace: "dev", Updated: []string{"app.py"}})
+	if err == nil || !strings.Contains(err.Error(), "no running pods of api match app.kubernetes.io/instance=api") {
+		t.Errorf("expected no running pods error, got %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+package gitsource
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// Prefix marks a helmfile reference as a git source
+	Prefix = "git::"
+
+	// DefaultPath is the helmfile loaded when a helmfile URL has no subpath
+	DefaultPath = "helmfile.yaml"
+)
+
+// Source is a path in a git repository, referenced as
+//
+//	git::https://github.com/org/repo//deploy/helmfile.yaml?ref=main
+//
+// The part after "//" is the path within the repository (the repository root
+// when omitted); ref is a branch, tag or commit and defaults to the remote HEAD.
+type Source struct {
+	Repo string
+	Path string
+	Ref  string
+	Git  string
+
+	commit string
+}
+
+// IsGitURL reports whether a helmfile reference is a git source
+func IsGitURL(ref string) bool {
+	return strings.HasPrefix(ref, Prefix)
+}
+
+// ParseHelmfile parses a git:: helmfile reference, defaulting the path to
+// helmfile.yaml at the repository root
+func ParseHelmfile(ref string) (*Source, error) {
+	source, err := Parse(ref)
+	if err != nil {
+		return nil, err
+	}
+	if source.Path == "" {
+		source.Path = DefaultPath
+	}
+	return source, nil
+}
+
+// Parse parses a git:: reference
+func Parse(ref string) (*Source, error) {
+	if !IsGitURL(ref) {
+		return nil, fmt.Errorf("not a git source: %s", ref)
+	}
+	raw := strings.TrimPrefix(ref, Prefix)
+
+	source := &Source{Git: "git"}
+
+	if idx := strings.LastIndex(raw, "?"); idx >= 0 {
+		query, err := url.ParseQuery(raw[idx+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid git source query in %s: %w", ref, err)
+		}
+		source.Ref = query.Get("ref")
+		raw = raw[:idx]
+	}
+
+	// Split the repository from the subpath at the first "//" after the scheme
+	start := 0
+	if idx := strings.Index(raw, "://"); idx >= 0 {
+		start = idx + 3
+	}
+	if idx := strings.Index(raw[start:], "//"); idx >= 0 {
+		source.Repo = raw[:start+idx]
+		source.Path = strings.Trim(raw[start+idx+2:], "/")
+	} else {
+		source.Repo = raw
+	}
+
+	if source.Repo == "" {
+		return nil, fmt.Errorf("invalid git source %s: missing repository", ref)
+	}
+	if filepath.IsAbs(source.Path) || strings.Contains(source.Path, "..") {
+		return nil, fmt.Errorf("invalid git source %s: path must stay within the repository", ref)
+	}
+
+	return source, nil
+}
+
+// String returns the source in git:: form
+func (s *Source) String() string {
+	ref := Prefix + s.Repo
+	if s.Path != "" {
+		ref += "//" + s.Path
+	}
+	if s.Ref != "" {
+		ref += "?ref=" + s.Ref
+	}
+	return ref
+}
+
+// Commit returns the commit checked out by the last Fetch
+func (s *Source) Commit() string {
+	return s.commit
+}
+
+// DefaultCacheRoot returns the directory git sources are cached under
+func DefaultCacheRoot() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "helmfire", "git")
+	}
+	return filepath.Join(home, ".helmfire", "cache", "git")
+}
+
+// CacheDir returns the directory under root used to cache the repository at
+// the source's ref
+func (s *Source) CacheDir(root string) string {
+	sum := sha256.Sum256([]byte(s.Repo + "?ref=" + s.Ref))
+	return filepath.Join(root, hex.EncodeToString(sum[:])[:16])
+}
+
+// Fetch clones or updates the repository in dir, checks out the ref and
+// returns the helmfile path. changed is false when the ref still points to
+// the commit checked out by the previous fetch.
+func (s *Source) Fetch(dir string) (path string, changed bool, err error) {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", false, fmt.Errorf("failed to create git cache: %w", err)
+		}
+		if _, err := s.git(dir, "init", "--quiet"); err != nil {
+			return "", false, err
+		}
+		if _, err := s.git(dir, "remote", "add", "origin", s.Repo); err != nil {
+			return "", false, err
+		}
+	} else if _, err := s.git(dir, "remote", "set-url", "origin", s.Repo); err != nil {
+		return "", false, err
+	}
+
+	ref := s.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if _, err := s.git(dir, "fetch", "--quiet", "--depth", "1", "origin", ref); err != nil {
+		return "", false, fmt.Errorf("failed to fetch %s from %s: %w", ref, s.Repo, err)
+	}
+
+	out, err := s.git(dir, "rev-parse", "FETCH_HEAD")
+	if err != nil {
+		return "", false, err
+	}
+	commit := strings.TrimSpace(out)
+
+	path = filepath.Join(dir, filepath.FromSlash(s.Path))
+	if commit == s.commit {
+		return path, false, nil
+	}
+
+	if _, err := s.git(dir, "checkout", "--quiet", "--force", "--detach", commit); err != nil {
+		return "", false, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", false, fmt.Errorf("%s not found in %s at %s", s.Path, s.Repo, commit)
+	}
+
+	s.commit = commit
+	return path, true, nil
+}
+
+// git runs a git command in dir and returns its stdout
+func (s *Source) git(dir string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, s.Git, append([]string{"-C", dir}, args...)...)
+	// Fail instead of prompting for credentials
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w (stderr: %s)", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,106 @@
+package gitsource
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		ref  string
+		repo string
+		path string
+		gref string
+	}{
+		{"git::https://github.com/org/repo//deploy/helmfile.yaml?ref=main", "https://github.com/org/repo", "deploy/helmfile.yaml", "main"},
+		{"git::https://github.com/org/repo", "https://github.com/org/repo", "", ""},
+		{"git::git@github.com:org/repo.git//helmfile.d/apps.yaml?ref=v1.2.0", "git@github.com:org/repo.git", "helmfile.d/apps.yaml", "v1.2.0"},
+		{"git::file:///srv/git/repo//helmfile.yaml", "file:///srv/git/repo", "helmfile.yaml", ""},
+	}
+
+	for _, tt := range tests {
+		source, err := Parse(tt.ref)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tt.ref, err)
+			continue
+		}
+		if source.Repo != tt.repo || source.Path != tt.path || source.Ref != tt.gref {
+			t.Errorf("Parse(%q) = {%s %s %s}, expected {%s %s %s}", tt.ref, source.Repo, source.Path, source.Ref, tt.repo, tt.path, tt.gref)
+		}
+	}
+
+	for _, ref := range []string{"helmfile.yaml", "git::", "git::https://github.com/org/repo//../etc/passwd"} {
+		if _, err := Parse(ref); err == nil {
+			t.Errorf("expected error for %q", ref)
+		}
+	}
+
+	source, err := ParseHelmfile("git::https://github.com/org/repo?ref=main")
+	if err != nil || source.Path != DefaultPath {
+		t.Errorf("expected helmfile path to default to %s, got %+v (%v)", DefaultPath, source, err)
+	}
+}
+
+// gitRun runs git in dir with a fixed identity, failing the test on error
+func gitRun(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	args = append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+	if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, out)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	// Upstream repository with a helmfile in a subdirectory
+	upstream := t.TempDir()
+	gitRun(t, upstream, "init", "--quiet")
+	if err := os.MkdirAll(filepath.Join(upstream, "deploy"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	helmfile := filepath.Join(upstream, "deploy", "helmfile.yaml")
+	if err := os.WriteFile(helmfile, []byte("releases: []\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitRun(t, upstream, "add", ".")
+	gitRun(t, upstream, "commit", "--quiet", "-m", "initial")
+
+	source, err := ParseHelmfile("git::file://" + upstream + "//deploy/helmfile.yaml")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	cache := source.CacheDir(t.TempDir())
+	path, changed, err := source.Fetch(cache)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if !changed || source.Commit() == "" {
+		t.Errorf("expected first fetch to check out a commit, changed=%v commit=%q", changed, source.Commit())
+	}
+	if data, _ := os.ReadFile(path); string(data) != "releases: []\n" {
+		t.Errorf("unexpected helmfile contents %q", data)
+	}
+
+	if _, changed, err := source.Fetch(cache); err != nil || changed {
+		t.Errorf("expected no change on refetch, changed=%v err=%v", changed, err)
+	}
+
+	// A new upstream commit is picked up
+	if err := os.WriteFile(helmfile, []byte("releases:\n- name: nginx\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitRun(t, upstream, "commit", "--quiet", "-am", "add nginx")
+
+	if _, changed, err := source.Fetch(cache); err != nil || !changed {
+		t.Fatalf("expected change after upstream commit, changed=%v err=%v", changed, err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "releases:\n- name: nginx\n" {
+		t.Errorf("unexpected helmfile contents after update %q", data)
+	}
+}
@@ -0,0 +1,113 @@
+package helmfire
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+	"go.uber.org/zap"
+)
+
+// Canary selects the releases a sync deploys first: one release by name,
+// or a percentage of the releases running workloads. The zero Canary
+// selects none.
+type Canary struct {
+	Release string
+	Percent int
+}
+
+// ParseCanary parses a canary given as a release name or a percentage such
+// as 25%
+func ParseCanary(s string) (Canary, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Canary{}, nil
+	}
+	pct, ok := strings.CutSuffix(s, "%")
+	if !ok {
+		return Canary{Release: s}, nil
+	}
+	n, err := strconv.Atoi(pct)
+	if err != nil || n < 1 || n > 100 {
+		return Canary{}, fmt.Errorf("invalid canary percentage %q: must be between 1%% and 100%%", s)
+	}
+	return Canary{Percent: n}, nil
+}
+
+// Enabled reports whether the canary selects any release
+func (c Canary) Enabled() bool {
+	return c.Release != "" || c.Percent > 0
+}
+
+func (c Canary) String() string {
+	if c.Percent > 0 {
+		return fmt.Sprintf("%d%%", c.Percent)
+	}
+	return c.Release
+}
+
+// canaryReleases returns the installed releases the canary selects. A
+// percentage is of the releases rendering Deployments, StatefulSets or
+// DaemonSets, rounded up and taken in helmfile order.
+func (p *Project) canaryReleases(ctx context.Context, executor *sync.Executor, canary Canary) ([]helmstate.Release, error) {
+	releases := p.Releases()
+	if canary.Release != "" {
+		var selected []helmstate.Release
+		for _, release := range releases {
+			if release.Name == canary.Release {
+				selected = append(selected, release)
+			}
+		}
+		if len(selected) == 0 {
+			return nil, fmt.Errorf("canary release %s not found among the installed releases", canary.Release)
+		}
+		return selected, nil
+	}
+
+	var candidates []helmstate.Release
+	for _, release := range releases {
+		workloads, err := executor.Workloads(ctx, release)
+		if err != nil {
+			return nil, fmt.Errorf("failed to pick canary: release %s: %w", release.Name, err)
+		}
+		if len(workloads) > 0 {
+			candidates = append(candidates, release)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no release runs workloads to pick a %s canary from", canary)
+	}
+	count := (len(candidates)*canary.Percent + 99) / 100
+	p.logger.Debug("picked canary releases",
+		zap.String("canary", canary.String()),
+		zap.Int("candidates", len(candidates)),
+		zap.Int("count", count))
+	return candidates[:count], nil
+}
+
+// withoutReleases returns releases except those in exclude
+func withoutReleases(releases, exclude []helmstate.Release) []helmstate.Release {
+	excluded := make(map[string]bool, len(exclude))
+	for _, release := range exclude {
+		excluded[release.Namespace+"/"+release.Name] = true
+	}
+	var rest []helmstate.Release
+	for _, release := range releases {
+		if !excluded[release.Namespace+"/"+release.Name] {
+			rest = append(rest, release)
+		}
+	}
+	return rest
+}
+
+// releaseNames returns the names of releases
+func releaseNames(releases []helmstate.Release) []string {
+	names := make([]string, len(releases))
+	for i, release := range releases {
+		names[i] = release.Name
+	}
+	return names
+}
@@ -0,0 +1,118 @@
+package helmfire
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/oleksiyp/helmfire/pkg/sync"
+)
+
+func TestParseCanary(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Canary
+		wantErr bool
+	}{
+		{in: "", want: Canary{}},
+		{in: "web", want: Canary{Release: "web"}},
+		{in: "25%", want: Canary{Percent: 25}},
+		{in: "0%", wantErr: true},
+		{in: "150%", wantErr: true},
+		{in: "a%", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseCanary(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseCanary(%q) = %+v, %v; want %+v (error %t)", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestSyncCanary(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	// Fake helm renders a Deployment for every release but settings, and
+	// fails upgrades of the release named in $FAIL
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	helm := filepath.Join(dir, "helm")
+	script := `#!/bin/sh
+case "$1" in
+template)
+  [ "$2" = settings ] && exit 0
+  printf 'apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: %s\n' "$2"
+  ;;
+upgrade)
+  echo "$@" >> ` + log + `
+  [ "$3" = "$FAIL" ] && { echo 'Error: timed out waiting for the condition' >&2; exit 1; }
+  ;;
+esac
+exit 0
+`
+	if err := os.WriteFile(helm, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake helm: %v", err)
+	}
+	helmfile := filepath.Join(dir, "helmfile.yaml")
+	content := `releases:
+  - name: settings
+    chart: ./settings
+  - name: api
+    chart: ./api
+  - name: web
+    chart: ./web
+`
+	if err := os.WriteFile(helmfile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	project, err := LoadProject(ctx, ProjectOptions{Files: []string{helmfile}, HelmBinary: helm})
+	if err != nil {
+		t.Fatalf("LoadProject() failed: %v", err)
+	}
+	upgrades := func() []string {
+		data, _ := os.ReadFile(log)
+		os.Remove(log)
+		return strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+
+	// A named canary goes first and is waited for
+	if _, err := project.Sync(ctx, SyncOptions{Canary: Canary{Release: "web"}}); err != nil {
+		t.Fatalf("Sync() failed: %v", err)
+	}
+	lines := upgrades()
+	if len(lines) != 3 || !strings.Contains(lines[0], "upgrade --install web") || !strings.Contains(lines[0], "--wait") ||
+		!strings.Contains(lines[1], "upgrade --install settings") {
+		t.Errorf("expected web synced and waited for first, got %v", lines)
+	}
+
+	// Half of the releases running workloads, rounded up, is api
+	if _, err := project.Sync(ctx, SyncOptions{Canary: Canary{Percent: 50}}); err != nil {
+		t.Fatalf("Sync() failed: %v", err)
+	}
+	if lines := upgrades(); len(lines) != 3 || !strings.Contains(lines[0], "upgrade --install api") {
+		t.Errorf("expected api synced first, got %v", lines)
+	}
+
+	// A failed canary skips the rest
+	t.Setenv("FAIL", "api")
+	report, err := project.Sync(ctx, SyncOptions{Canary: Canary{Percent: 50}})
+	if err == nil || report == nil {
+		t.Fatalf("expected a failed sync with a report, got %v", err)
+	}
+	if report.Count(sync.ReleaseStatusSkipped) != 2 || report.Results[1].Error != "canary api failed" {
+		t.Errorf("expected the rest skipped after the canary, got %+v", report.Results)
+	}
+	if lines := upgrades(); len(lines) != 1 {
+		t.Errorf("expected only the canary synced, got %v", lines)
+	}
+
+	if _, err := project.Sync(ctx, SyncOptions{Canary: Canary{Release: "missing"}}); err == nil {
+		t.Error("expected an error for an unknown canary release")
+	}
+}
@@ -0,0 +1,135 @@
+package helmfire
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/drift"
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+	"go.uber.org/zap"
+)
+
+// DriftOptions configure Project.Drift
+type DriftOptions struct {
+	// Executor heals and prunes releases; one made with default
+	// ExecutorOptions when nil
+	Executor *sync.Executor
+
+	Interval time.Duration
+	Jitter   float64 // randomizes each interval by up to this fraction
+	Stagger  bool    // spreads the checks of releases across the interval
+
+	// FlapWindow is how long drift must stay gone before it's notified as
+	// resolved; unchanged drift is only notified once
+	FlapWindow time.Duration
+
+	// ContextLines is how many unchanged lines drift diffs show around
+	// changes; whole resources when 0
+	ContextLines int
+
+	// Workers is how many releases are diffed at once;
+	// drift.DefaultWorkers when 0
+	Workers int
+
+	// DisablePrecheck diffs every release, instead of only those whose
+	// manifest stored by helm differs from the one rendered locally
+	DisablePrecheck bool
+
+	Notifiers []drift.Notifier
+
+	// AutoHeal syncs drifted releases the HealPolicy allows; HealPreview
+	// attaches the changes a heal would make to each report first
+	AutoHeal    bool
+	HealPolicy  drift.HealPolicy
+	HealPreview bool
+
+	// Orphans reports releases not defined in the helmfiles, and Prune
+	// uninstalls them
+	Orphans bool
+	Prune   bool
+}
+
+// Drift starts detecting drift between the cluster and the project, until
+// ctx is done or the detector returned is stopped
+func (p *Project) Drift(ctx context.Context, opts DriftOptions) (*drift.Detector, error) {
+	executor := opts.Executor
+	if executor == nil {
+		executor = p.Executor(ExecutorOptions{})
+	}
+
+	p.manager.DiffContext = opts.ContextLines
+	detector := drift.NewDetector(p.manager, opts.Interval, p.logger)
+	detector.SetInspector(sync.NewDriftInspector(p.manager, executor))
+	detector.SetJitter(opts.Jitter)
+	detector.SetStagger(opts.Stagger)
+	detector.SetFlapWindow(opts.FlapWindow)
+	detector.SetWorkers(opts.Workers)
+	detector.SetPrecheck(!opts.DisablePrecheck)
+	for _, notifier := range opts.Notifiers {
+		detector.AddNotifier(notifier)
+	}
+
+	if opts.AutoHeal {
+		detector.EnableAutoHeal(true, func(releaseName string) error {
+			release, ok := p.release(releaseName)
+			if !ok {
+				return fmt.Errorf("release not found: %s", releaseName)
+			}
+			p.logger.Info("healing release", zap.String("name", releaseName))
+			return executor.SyncRelease(release)
+		})
+		detector.SetHealPolicy(opts.HealPolicy)
+
+		if opts.HealPreview {
+			detector.EnableHealPreview(func(releaseName string) (string, error) {
+				release, ok := p.release(releaseName)
+				if !ok {
+					return "", fmt.Errorf("release not found: %s", releaseName)
+				}
+				return executor.PreviewReleaseContext(ctx, release)
+			})
+		}
+	}
+
+	if opts.Orphans || opts.Prune {
+		var pruneFunc func(name, namespace, kubeContext string) error
+		if opts.Prune {
+			pruneFunc = func(name, namespace, kubeContext string) error {
+				return executor.UninstallRelease(ctx, name, namespace, kubeContext)
+			}
+		}
+		detector.EnableOrphanDetection(true, pruneFunc)
+	}
+
+	if err := detector.Start(ctx); err != nil {
+		return nil, fmt.Errorf("failed to start drift detector: %w", err)
+	}
+	return detector, nil
+}
+
+// release returns the release of the project named name
+func (p *Project) release(name string) (helmstate.Release, bool) {
+	for _, release := range p.manager.GetReleases() {
+		if release.Name == name {
+			return release, true
+		}
+	}
+	return helmstate.Release{}, false
+}
+
+// CheckDrift compares the cluster with the project now, for one release or
+// for all of them when release is empty
+func (p *Project) CheckDrift(ctx context.Context, release string) ([]drift.DriftReport, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	detector := drift.NewDetector(p.manager, 0, p.logger)
+	detector.SetInspector(sync.NewDriftInspector(p.manager, p.Executor(ExecutorOptions{})))
+	reports, err := detector.CheckNow(release)
+	if err != nil {
+		return nil, fmt.Errorf("drift check failed: %w", err)
+	}
+	return reports, nil
+}
@@ -0,0 +1,110 @@
+package helmfire
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/oleksiyp/helmfire/pkg/drift"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+)
+
+func TestLoadProjectAndSync(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	// Fake helm logs its arguments and fails upgrades of the broken release
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	helm := filepath.Join(dir, "helm")
+	script := `#!/bin/sh
+echo "$@" >> ` + log + `
+case "$*" in
+*"upgrade --install broken"*) echo 'Error: broken chart' >&2; exit 1 ;;
+esac
+`
+	if err := os.WriteFile(helm, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake helm: %v", err)
+	}
+	helmfile := filepath.Join(dir, "helmfile.yaml")
+	content := `releases:
+  - name: operator
+    chart: ./operator
+    phase: infra
+  - name: web
+    chart: ./web
+  - name: debug
+    chart: ./debug
+    installed: false
+`
+	if err := os.WriteFile(helmfile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	project, err := LoadProject(ctx, ProjectOptions{Files: []string{helmfile}, HelmBinary: helm})
+	if err != nil {
+		t.Fatalf("LoadProject() failed: %v", err)
+	}
+	if got := len(project.Releases()); got != 2 {
+		t.Errorf("expected 2 installed releases, got %d", got)
+	}
+
+	report, err := project.Sync(ctx, SyncOptions{})
+	if err != nil {
+		t.Fatalf("Sync() failed: %v", err)
+	}
+	if report.Count(sync.ReleaseStatusSucceeded) != 2 {
+		t.Errorf("expected both releases synced, got %+v", report.Results)
+	}
+	data, _ := os.ReadFile(log)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "upgrade --install operator") || !strings.Contains(lines[0], "--wait") ||
+		!strings.Contains(lines[1], "upgrade --install web") {
+		t.Errorf("expected operator synced and waited for before web, got:\n%s", data)
+	}
+
+	// A failed infra release skips the apps phase
+	content = strings.Replace(content, "name: operator", "name: broken", 1)
+	if err := os.WriteFile(helmfile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := project.Reload(); err != nil {
+		t.Fatalf("Reload() failed: %v", err)
+	}
+	notifier := &syncRecorder{}
+	report, err = project.Sync(ctx, SyncOptions{Notifiers: []drift.SyncNotifier{notifier}})
+	if err == nil || report == nil {
+		t.Fatalf("expected a failed sync with a report, got %v", err)
+	}
+	if report.Count(sync.ReleaseStatusFailed) != 1 || report.Count(sync.ReleaseStatusSkipped) != 1 {
+		t.Errorf("expected broken failed and web skipped, got %+v", report.Results)
+	}
+
+	// The skipped release is never announced
+	want := []string{"sync run started", "default/broken started", "default/broken failed", "sync run failed"}
+	if strings.Join(notifier.events, ", ") != strings.Join(want, ", ") {
+		t.Errorf("expected events %v, got %v", want, notifier.events)
+	}
+}
+
+// syncRecorder records the sync events it is sent
+type syncRecorder struct {
+	events []string
+}
+
+func (r *syncRecorder) NotifySync(event drift.SyncEvent) error {
+	r.events = append(r.events, event.Subject()+" "+string(event.Phase))
+	return nil
+}
+
+func TestLoadProjectMissingHelmfile(t *testing.T) {
+	_, err := LoadProject(context.Background(), ProjectOptions{Files: []string{filepath.Join(t.TempDir(), "helmfile.yaml")}})
+	if err == nil || !strings.Contains(err.Error(), "failed to load helmfile") {
+		t.Errorf("expected a load error, got %v", err)
+	}
+}
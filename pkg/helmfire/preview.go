@@ -0,0 +1,200 @@
+package helmfire
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+	"go.uber.org/zap"
+)
+
+// DefaultPreviewNamespace is the namespace template of previews
+const DefaultPreviewNamespace = "pr-{{ .PR }}"
+
+// LabelPreview is set on the namespaces of previews to their pull request,
+// so only those are deleted when a preview is destroyed
+const LabelPreview = "helmfire.dev/preview"
+
+// dnsLabel matches the names namespaces may have
+var dnsLabel = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// Preview is the environment of a pull request: the project's releases in
+// a namespace of their own, running the images built for it
+type Preview struct {
+	PR  int
+	SHA string // the pull request's head commit, if known
+
+	// Namespace all releases are synced to
+	Namespace string
+
+	// Images replace the helmfile's images in the preview, original to
+	// replacement
+	Images map[string]string
+}
+
+// previewData is what preview templates are rendered with
+type previewData struct {
+	PR  int
+	SHA string
+}
+
+// NewPreview creates the preview of a pull request. namespace is a template
+// of the namespace name (DefaultPreviewNamespace when empty) and images are
+// original=replacement pairs whose replacement is a template too; both may
+// use {{ .PR }} and {{ .SHA }}.
+func NewPreview(pr int, sha, namespace string, images []string) (Preview, error) {
+	if pr <= 0 {
+		return Preview{}, fmt.Errorf("invalid pull request number %d", pr)
+	}
+	preview := Preview{PR: pr, SHA: sha, Images: make(map[string]string)}
+	data := previewData{PR: pr, SHA: sha}
+
+	if namespace == "" {
+		namespace = DefaultPreviewNamespace
+	}
+	name, err := renderPreviewTemplate("namespace", namespace, data)
+	if err != nil {
+		return Preview{}, err
+	}
+	if len(name) > 63 || !dnsLabel.MatchString(name) {
+		return Preview{}, fmt.Errorf("invalid preview namespace %q: must be a lowercase DNS label of at most 63 characters", name)
+	}
+	preview.Namespace = name
+
+	for _, image := range images {
+		original, replacement, ok := strings.Cut(image, "=")
+		if !ok || original == "" || replacement == "" {
+			return Preview{}, fmt.Errorf("invalid image %q: expected original=replacement", image)
+		}
+		rendered, err := renderPreviewTemplate("image "+original, replacement, data)
+		if err != nil {
+			return Preview{}, err
+		}
+		if err := substitute.ValidateImageReference(rendered); err != nil {
+			return Preview{}, fmt.Errorf("invalid image %q: %w", image, err)
+		}
+		preview.Images[original] = rendered
+	}
+	return preview, nil
+}
+
+// renderPreviewTemplate renders text, failing on missing fields
+func renderPreviewTemplate(name, text string, data previewData) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render %s template: %w", name, err)
+	}
+	return out.String(), nil
+}
+
+// labels are the labels of the preview's namespace
+func (p Preview) labels() map[string]string {
+	return map[string]string{
+		LabelPreview:        strconv.Itoa(p.PR),
+		sync.LabelManagedBy: "helmfire",
+	}
+}
+
+// CreatePreview syncs the project's releases into the preview's namespace
+// with its images. The project must have been loaded with the preview's
+// namespace, so every release is synced there; the namespace is created
+// with LabelPreview, and the images replace the originals in it only.
+func (p *Project) CreatePreview(ctx context.Context, preview Preview, opts SyncOptions) (*sync.Report, error) {
+	if p.manager.Namespace != preview.Namespace {
+		return nil, fmt.Errorf("project is loaded for namespace %q, not preview namespace %q", p.manager.Namespace, preview.Namespace)
+	}
+
+	scope := substitute.Scope{Namespace: preview.Namespace}
+	for original, replacement := range preview.Images {
+		if err := p.substitutor.AddScopedImageSubstitution(original, replacement, scope); err != nil {
+			return nil, fmt.Errorf("failed to substitute image %s: %w", original, err)
+		}
+	}
+
+	executor := opts.Executor
+	if executor == nil {
+		executor = p.Executor(ExecutorOptions{})
+	}
+	// The namespace is declared for the executor as if the helmfile did,
+	// so it is created with the preview's labels
+	executor.SetNamespaceLookup(func(name string) (helmstate.Namespace, bool) {
+		declared, ok := p.manager.GetNamespace(name)
+		if name != preview.Namespace {
+			return declared, ok
+		}
+		labels := make(map[string]string, len(declared.Labels)+2)
+		for key, value := range declared.Labels {
+			labels[key] = value
+		}
+		for key, value := range preview.labels() {
+			labels[key] = value
+		}
+		declared.Labels = labels
+		return declared, true
+	})
+	opts.Executor = executor
+
+	p.logger.Info("creating preview",
+		zap.Int("pr", preview.PR),
+		zap.String("namespace", preview.Namespace),
+		zap.Int("images", len(preview.Images)))
+	return p.Sync(ctx, opts)
+}
+
+// DestroyPreview uninstalls every release deployed in the preview's
+// namespace, the project's in reverse order and then any others, and
+// deletes the namespace when it was created for the preview. It returns
+// the releases uninstalled.
+func (p *Project) DestroyPreview(ctx context.Context, preview Preview, executor *sync.Executor) ([]string, error) {
+	deployed, err := p.manager.ListClusterReleases(preview.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	remaining := make(map[string]bool, len(deployed))
+	for _, release := range deployed {
+		remaining[release.Name] = true
+	}
+
+	var order []string
+	releases := p.manager.GetReleases()
+	for i := len(releases) - 1; i >= 0; i-- {
+		if remaining[releases[i].Name] {
+			order = append(order, releases[i].Name)
+			delete(remaining, releases[i].Name)
+		}
+	}
+	for _, release := range deployed {
+		if remaining[release.Name] {
+			order = append(order, release.Name)
+		}
+	}
+
+	var uninstalled []string
+	for _, name := range order {
+		if err := executor.UninstallRelease(ctx, name, preview.Namespace, ""); err != nil {
+			return uninstalled, fmt.Errorf("failed to uninstall %s: %w", name, err)
+		}
+		uninstalled = append(uninstalled, name)
+	}
+
+	deleted, err := executor.DeleteNamespace(ctx, preview.Namespace, preview.labels())
+	if err != nil {
+		return uninstalled, err
+	}
+	if !deleted {
+		p.logger.Warn("not deleting namespace, which wasn't created for the preview",
+			zap.String("namespace", preview.Namespace))
+	}
+	return uninstalled, nil
+}
@@ -0,0 +1,150 @@
+package helmfire
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestNewPreview(t *testing.T) {
+	preview, err := NewPreview(123, "1a2b3c", "", []string{
+		"ghcr.io/acme/web:latest=ghcr.io/acme/web:pr-{{ .PR }}",
+		"ghcr.io/acme/worker:latest=ghcr.io/acme/worker:{{ .SHA }}",
+	})
+	if err != nil {
+		t.Fatalf("NewPreview failed: %v", err)
+	}
+	if preview.Namespace != "pr-123" {
+		t.Errorf("unexpected namespace %q", preview.Namespace)
+	}
+	if preview.Images["ghcr.io/acme/web:latest"] != "ghcr.io/acme/web:pr-123" || preview.Images["ghcr.io/acme/worker:latest"] != "ghcr.io/acme/worker:1a2b3c" {
+		t.Errorf("unexpected images %v", preview.Images)
+	}
+
+	if preview, err := NewPreview(7, "", "web-preview-{{ .PR }}", nil); err != nil || preview.Namespace != "web-preview-7" {
+		t.Errorf("unexpected templated namespace %q, %v", preview.Namespace, err)
+	}
+
+	for _, tc := range []struct {
+		pr        int
+		namespace string
+		images    []string
+	}{
+		{pr: 0},
+		{pr: 1, namespace: "PR_{{ .PR }}"},
+		{pr: 1, namespace: "pr-{{ .Branch }}"},
+		{pr: 1, images: []string{"ghcr.io/acme/web"}},
+		{pr: 1, images: []string{"web=ghcr.io/acme/web:{{ .PR"}},
+	} {
+		if _, err := NewPreview(tc.pr, "", tc.namespace, tc.images); err == nil {
+			t.Errorf("expected an error for %+v", tc)
+		}
+	}
+}
+
+func TestPreview(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm and kubectl scripts require a POSIX shell")
+	}
+
+	// Fake helm lists web and a release no longer in the helmfile in the
+	// preview; fake kubectl reports the namespace labelled as the preview
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	applied := filepath.Join(dir, "namespace.json")
+	helm := filepath.Join(dir, "helm")
+	helmScript := `#!/bin/sh
+echo "helm $*" >> ` + log + `
+[ "$1" = list ] && echo '[{"name":"web","namespace":"pr-123"},{"name":"stray","namespace":"pr-123"}]'
+exit 0
+`
+	kubectlScript := `#!/bin/sh
+echo "kubectl $*" >> ` + log + `
+case "$1" in
+apply) cat > ` + applied + ` ;;
+get) echo '{"metadata":{"name":"pr-123","labels":{"helmfire.dev/preview":"123","app.kubernetes.io/managed-by":"helmfire"}}}' ;;
+esac
+exit 0
+`
+	if err := os.WriteFile(helm, []byte(helmScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "kubectl"), []byte(kubectlScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	helmfile := filepath.Join(dir, "helmfile.yaml")
+	content := `releases:
+  - name: db
+    namespace: data
+    chart: ./db
+  - name: web
+    namespace: apps
+    chart: ./web
+`
+	if err := os.WriteFile(helmfile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	preview, err := NewPreview(123, "", "", []string{"ghcr.io/acme/web:latest=ghcr.io/acme/web:pr-{{ .PR }}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	project, err := LoadProject(ctx, ProjectOptions{Files: []string{helmfile}, HelmBinary: helm, Namespace: preview.Namespace})
+	if err != nil {
+		t.Fatalf("LoadProject() failed: %v", err)
+	}
+	calls := func() []string {
+		data, _ := os.ReadFile(log)
+		os.Remove(log)
+		return strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+
+	if _, err := project.CreatePreview(ctx, preview, SyncOptions{}); err != nil {
+		t.Fatalf("CreatePreview() failed: %v", err)
+	}
+	var upgrades []string
+	for _, call := range calls() {
+		if strings.HasPrefix(call, "helm upgrade") {
+			upgrades = append(upgrades, call)
+		}
+	}
+	if len(upgrades) != 2 || !strings.Contains(upgrades[0], "upgrade --install db") || !strings.Contains(upgrades[1], "--namespace pr-123") {
+		t.Errorf("expected every release synced to the preview namespace, got %v", upgrades)
+	}
+	if subs := project.substitutor.ImageSubstitutionsFor("web", "pr-123"); len(subs) != 1 || subs[0].Replacement != "ghcr.io/acme/web:pr-123" {
+		t.Errorf("expected the image substituted in the preview, got %+v", subs)
+	}
+	if subs := project.substitutor.ImageSubstitutionsFor("web", "apps"); len(subs) != 0 {
+		t.Errorf("expected no substitution outside the preview, got %+v", subs)
+	}
+	data, _ := os.ReadFile(applied)
+	if !strings.Contains(string(data), `"helmfire.dev/preview":"123"`) {
+		t.Errorf("expected the namespace labelled as the preview, got %s", data)
+	}
+
+	// Destroying uninstalls the helmfile's releases in reverse, then the rest
+	uninstalled, err := project.DestroyPreview(ctx, preview, project.Executor(ExecutorOptions{}))
+	if err != nil {
+		t.Fatalf("DestroyPreview() failed: %v", err)
+	}
+	if strings.Join(uninstalled, ",") != "web,stray" {
+		t.Errorf("unexpected uninstalled releases %v", uninstalled)
+	}
+	if last := calls(); last[len(last)-1] != "kubectl delete namespace pr-123 --wait=false" {
+		t.Errorf("expected the namespace deleted, got %v", last)
+	}
+
+	// A project loaded for another namespace can't create the preview
+	other, err := LoadProject(ctx, ProjectOptions{Files: []string{helmfile}, HelmBinary: helm})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.CreatePreview(ctx, preview, SyncOptions{}); err == nil {
+		t.Error("expected an error for a project outside the preview namespace")
+	}
+}
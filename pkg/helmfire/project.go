@@ -0,0 +1,272 @@
+// Package helmfire is the Go API of helmfire, for tools such as IDE plugins
+// and CI runners that embed it instead of running the binary. A Project is
+// loaded from helmfiles, then synced, watched for changes and checked for
+// drift the way the helmfire commands do.
+package helmfire
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/oleksiyp/helmfire/pkg/gitsource"
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/policy"
+	"github.com/oleksiyp/helmfire/pkg/rendercache"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+	"go.uber.org/zap"
+)
+
+// DefaultHelmfile is loaded when no helmfile is given
+const DefaultHelmfile = "helmfile.yaml"
+
+// ProjectOptions configure LoadProject
+type ProjectOptions struct {
+	// Files are helmfiles, directories of them or git:: references, merged
+	// in order; DefaultHelmfile when empty
+	Files []string
+
+	Environment string
+	HelmBinary  string // helm on PATH when empty
+
+	// Namespace and KubeContext, the --namespace and --kube-context flags,
+	// override the ones releases resolve from the helmfile when set. Sync,
+	// drift detection and diffs all see the overridden releases.
+	Namespace   string
+	KubeContext string
+
+	// NamespaceTemplate rewrites the namespace of every release after the
+	// Namespace override, e.g. "{{ .Namespace }}-dev-alice" so developers
+	// can sync the same helmfile to one cluster; see
+	// helmstate.Manager.NamespaceTemplate
+	NamespaceTemplate string
+
+	// ReleasePrefix is prepended to the name of every release, so copies
+	// of the project can share a namespace; see
+	// helmstate.Manager.ReleasePrefix
+	ReleasePrefix string
+
+	// Strict rejects helmfiles with unknown fields or mistyped values, and
+	// templates using missing keys
+	Strict bool
+
+	// Substitutor holds the chart and image substitutions applied when
+	// syncing; none when nil
+	Substitutor *substitute.Manager
+
+	// OfflineCharts, when set, is the directory remote charts are taken
+	// from instead of their repositories, which aren't synced; see
+	// helmstate.OfflineChart
+	OfflineCharts string
+
+	// RenderCache keeps the manifests rendered for drift prechecks and
+	// syncs, shared by the manager and executors of the project; every
+	// render runs helm when nil
+	RenderCache *rendercache.Cache
+
+	// StateDir holds the project's state, such as the record of the
+	// repositories its executors added to helm, which are the only ones
+	// they prune; nothing is recorded when empty
+	StateDir string
+
+	Logger *zap.Logger // no logging when nil
+}
+
+// ExecutorOptions configure the executor syncing a project's releases
+type ExecutorOptions struct {
+	DryRun      bool
+	Namespace   string // of every release; the project's when empty
+	KubeContext string // of every release; the project's when empty
+
+	Stamp  sync.Stamp
+	Policy policy.Checker // none when its Dir is empty
+
+	// Resources scales down the resources and replicas of workloads, for
+	// laptops and kind clusters; as rendered when nil
+	Resources *sync.ResourceProfile
+
+	// CreateNamespace creates missing release namespaces; true when nil
+	CreateNamespace *bool
+
+	// VerifyNamespaces fails releases whose namespace doesn't exist or
+	// lacks the labels declared in the helmfile
+	VerifyNamespaces bool
+
+	Progress sync.ProgressFunc
+	Logger   *zap.Logger // the project's when nil
+}
+
+// Project is a set of helmfiles loaded and merged into one
+type Project struct {
+	manager     *helmstate.Manager
+	files       []string
+	helmBinary  string
+	substitutor *substitute.Manager
+	renderCache *rendercache.Cache
+	stateDir    string
+	logger      *zap.Logger
+}
+
+// LoadProject fetches the git helmfiles of opts and loads the project
+func LoadProject(ctx context.Context, opts ProjectOptions) (*Project, error) {
+	p := &Project{
+		helmBinary:  opts.HelmBinary,
+		substitutor: opts.Substitutor,
+		renderCache: opts.RenderCache,
+		stateDir:    opts.StateDir,
+		logger:      opts.Logger,
+	}
+	if p.helmBinary == "" {
+		p.helmBinary = "helm"
+	}
+	if p.substitutor == nil {
+		p.substitutor = substitute.NewManager()
+	}
+	if p.logger == nil {
+		p.logger = zap.NewNop()
+	}
+
+	files := opts.Files
+	if len(files) == 0 {
+		files = []string{DefaultHelmfile}
+	}
+	helmfiles, err := ResolveHelmfiles(ctx, files, p.logger)
+	if err != nil {
+		return nil, err
+	}
+	p.files = helmfiles
+
+	p.manager = helmstate.NewManager(helmfiles[0], opts.Environment)
+	p.manager.ExtraPaths = helmfiles[1:]
+	p.manager.HelmBinary = p.helmBinary
+	p.manager.Strict = opts.Strict
+	p.manager.Namespace = opts.Namespace
+	p.manager.KubeContext = opts.KubeContext
+	p.manager.NamespaceTemplate = opts.NamespaceTemplate
+	p.manager.ReleasePrefix = opts.ReleasePrefix
+	p.manager.RenderCache = p.renderCache
+	p.manager.OfflineCharts = opts.OfflineCharts
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ResolveHelmfiles returns a local path for each helmfile reference,
+// fetching git:: sources into the cache first
+func ResolveHelmfiles(ctx context.Context, files []string, logger *zap.Logger) ([]string, error) {
+	helmfiles := make([]string, 0, len(files))
+	for _, file := range files {
+		if !gitsource.IsGitURL(file) {
+			helmfiles = append(helmfiles, file)
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		source, err := gitsource.ParseHelmfile(file)
+		if err != nil {
+			return nil, err
+		}
+		path, _, err := source.Fetch(source.CacheDir(gitsource.DefaultCacheRoot()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch helmfile: %w", err)
+		}
+		logger.Info("using helmfile from git",
+			zap.String("source", source.String()),
+			zap.String("commit", source.Commit()))
+		helmfiles = append(helmfiles, path)
+	}
+	return helmfiles, nil
+}
+
+// Reload loads the project's helmfiles again, reusing the ones unchanged
+func (p *Project) Reload() error {
+	if err := p.manager.Load(); err != nil {
+		return fmt.Errorf("failed to load helmfile: %w", err)
+	}
+	LogMissingFiles(p.logger, p.manager.Missing)
+	return nil
+}
+
+// LogMissingFiles reports the values files a load skipped, at the level
+// their missingFileHandler names
+func LogMissingFiles(logger *zap.Logger, missing []helmstate.MissingFile) {
+	for _, file := range missing {
+		fields := []zap.Field{zap.String("path", file.Path)}
+		if file.Release != "" {
+			fields = append(fields, zap.String("release", file.Release))
+		}
+		switch file.Handler {
+		case helmstate.MissingFileWarn:
+			logger.Warn("skipping missing values file", fields...)
+		case helmstate.MissingFileInfo:
+			logger.Info("skipping missing values file", fields...)
+		default:
+			logger.Debug("skipping missing values file", fields...)
+		}
+	}
+}
+
+// Manager returns the helmfile state of the project
+func (p *Project) Manager() *helmstate.Manager {
+	return p.manager
+}
+
+// Files returns the local paths of the project's helmfiles, as given
+func (p *Project) Files() []string {
+	return p.files
+}
+
+// Releases returns the releases of the project that are installed in its
+// environment
+func (p *Project) Releases() []helmstate.Release {
+	var releases []helmstate.Release
+	for _, release := range p.manager.GetReleases() {
+		if p.manager.IsReleaseInstalled(release) {
+			releases = append(releases, release)
+		}
+	}
+	return releases
+}
+
+// Executor returns an executor syncing the project's releases
+func (p *Project) Executor(opts ExecutorOptions) *sync.Executor {
+	logger := opts.Logger
+	if logger == nil {
+		logger = p.logger
+	}
+
+	executor := sync.NewExecutor(logger, p.substitutor)
+	executor.SetHelmBinary(p.helmBinary)
+	executor.SetDryRun(opts.DryRun)
+	executor.SetStamp(opts.Stamp)
+	executor.SetPolicy(opts.Policy)
+	executor.SetResourceProfile(opts.Resources)
+	if opts.CreateNamespace != nil {
+		executor.SetCreateNamespace(*opts.CreateNamespace)
+	}
+	executor.SetVerifyNamespaces(opts.VerifyNamespaces)
+	executor.SetNamespaceLookup(p.manager.GetNamespace)
+	executor.SetRenderCache(p.renderCache)
+	executor.SetOfflineCharts(p.manager.OfflineCharts)
+	if p.stateDir != "" {
+		executor.SetRepositoryRecord(filepath.Join(p.stateDir, sync.RepositoryRecordFile))
+	}
+	if opts.Progress != nil {
+		executor.SetProgress(opts.Progress)
+	}
+	namespace, kubeContext := opts.Namespace, opts.KubeContext
+	if namespace == "" && p.manager.NamespaceTemplate == "" {
+		// Releases already carry the override, which a template rewrote
+		namespace = p.manager.Namespace
+	}
+	if kubeContext == "" {
+		kubeContext = p.manager.KubeContext
+	}
+	executor.SetNamespace(namespace)
+	executor.SetKubeContext(kubeContext)
+	return executor
+}
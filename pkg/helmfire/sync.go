@@ -0,0 +1,228 @@
+package helmfire
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/drift"
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+	"github.com/oleksiyp/helmfire/pkg/tracing"
+	"go.uber.org/zap"
+)
+
+// SyncOptions configure Project.Sync
+type SyncOptions struct {
+	// Executor syncs the releases; one made with default ExecutorOptions
+	// when nil
+	Executor *sync.Executor
+
+	Timeout time.Duration // deadline of the whole run; none when 0
+
+	// Notes adds the rendered NOTES.txt of each synced release to the
+	// report; leave it off in dry runs, which have no notes
+	Notes bool
+
+	// CheckCluster checks, before syncing, that the cluster runs at least
+	// MinKubeVersion (sync.DefaultMinKubeVersion when empty) and serves
+	// every API version the releases use
+	CheckCluster   bool
+	MinKubeVersion string
+
+	// Canary selects releases synced and waited for before the rest, which
+	// are skipped when a canary fails
+	Canary Canary
+
+	// PruneRepositories removes the helm repositories the project added
+	// that the helmfile no longer declares, after adding those it does
+	PruneRepositories bool
+
+	// Trigger is what started the run, recorded on its trace and sent with
+	// sync events
+	Trigger string
+
+	// Notifiers are sent the run and each release starting and finishing
+	Notifiers []drift.SyncNotifier
+}
+
+// Sync syncs the repositories and then the installed releases of the
+// project, phase by phase. Releases after a failed one are skipped, as are
+// the phases after a phase that timed out. With a canary, the canary
+// releases are synced first. The report is returned with an error when a
+// release failed, and is nil when the run never started.
+func (p *Project) Sync(ctx context.Context, opts SyncOptions) (*sync.Report, error) {
+	executor := opts.Executor
+	if executor == nil {
+		executor = p.Executor(ExecutorOptions{})
+	}
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	ctx, span := tracing.Start(ctx, "helmfire.sync",
+		tracing.String("helmfile", strings.Join(p.files, ",")), tracing.String("sync.trigger", opts.Trigger))
+
+	if repos := p.manager.RepositoriesFor(p.Releases()); len(repos) > 0 {
+		p.logger.Info("syncing repositories", zap.Int("count", len(repos)))
+		if err := executor.SyncRepositoriesContext(ctx, repos); err != nil {
+			span.End(err)
+			return nil, fmt.Errorf("failed to sync repositories: %w", err)
+		}
+	}
+	if opts.PruneRepositories {
+		pruned, err := executor.PruneRepositories(ctx, p.manager.GetRepositories())
+		if err != nil {
+			span.End(err)
+			return nil, fmt.Errorf("failed to prune repositories: %w", err)
+		}
+		if len(pruned) > 0 {
+			p.logger.Info("pruned repositories", zap.Strings("names", pruned))
+		}
+	}
+
+	releases := p.manager.GetReleases()
+	p.logger.Info("found releases", zap.Int("count", len(releases)))
+
+	// Check the cluster serves the APIs the releases need
+	if opts.CheckCluster {
+		minVersion := opts.MinKubeVersion
+		if minVersion == "" {
+			minVersion = sync.DefaultMinKubeVersion
+		}
+		if err := executor.CheckCapabilities(ctx, p.Releases(), minVersion); err != nil {
+			span.End(err)
+			return nil, fmt.Errorf("cluster capability check failed: %w", err)
+		}
+	}
+
+	// Canaries are picked before the run starts, as picking them by
+	// workloads renders the releases
+	var canaries []helmstate.Release
+	if opts.Canary.Enabled() {
+		var err error
+		if canaries, err = p.canaryReleases(ctx, executor, opts.Canary); err != nil {
+			span.End(err)
+			return nil, err
+		}
+		releases = withoutReleases(releases, canaries)
+	}
+
+	report := sync.NewReport()
+	ctx = sync.WithSyncID(ctx, report.SyncID)
+	run := &syncRun{
+		executor:  executor,
+		report:    report,
+		announcer: drift.NewSyncAnnouncer(opts.Notifiers, report, opts.Trigger, p.logger),
+		notes:     opts.Notes,
+	}
+	run.announcer.RunStarted(len(p.Releases()))
+
+	// The canaries are synced and waited for on their own; any failure
+	// leaves the rest of the releases alone
+	skipReason := ""
+	if len(canaries) > 0 {
+		names := releaseNames(canaries)
+		p.logger.Info("syncing canary", zap.Strings("releases", names))
+		phases := p.manager.Phases(canaries)
+		for i := range phases {
+			for j := range phases[i].Releases {
+				phases[i].Releases[j].Wait = true
+			}
+		}
+		p.syncPhases(ctx, run, phases, "")
+		if report.Failed() {
+			skipReason = fmt.Sprintf("canary %s failed", strings.Join(names, ", "))
+			p.logger.Error("canary failed, not syncing the remaining releases", zap.Strings("releases", names))
+		} else {
+			p.logger.Info("canary ready, syncing the remaining releases", zap.Int("releases", len(releases)))
+		}
+	}
+	p.syncPhases(ctx, run, p.manager.Phases(releases), skipReason)
+	report.Finish()
+	run.announcer.RunFinished(report)
+
+	var syncErr error
+	if report.Failed() {
+		syncErr = fmt.Errorf("sync failed: %d failed, %d timed out",
+			report.Count(sync.ReleaseStatusFailed), report.Count(sync.ReleaseStatusTimedOut))
+	}
+	span.SetAttributes(tracing.String("sync.id", report.SyncID), tracing.Int("releases", len(report.Results)))
+	span.End(syncErr)
+	return report, syncErr
+}
+
+// syncRun is the state of one Project.Sync
+type syncRun struct {
+	executor  *sync.Executor
+	report    *sync.Report
+	announcer *drift.SyncAnnouncer
+	notes     bool
+}
+
+// syncPhases syncs the releases of phases in order, recording them in the
+// run's report. Releases after a failed one are skipped, as are the phases
+// after a phase that timed out; all of them when skipReason is set.
+func (p *Project) syncPhases(ctx context.Context, run *syncRun, phases []helmstate.Phase, skipReason string) {
+	executor, report, announcer := run.executor, run.report, run.announcer
+	for _, phase := range phases {
+		if len(phases) > 1 && skipReason == "" {
+			p.logger.Info("syncing phase", zap.String("phase", phase.Name), zap.Int("releases", len(phase.Releases)))
+		}
+		phaseFailed := false
+		for _, release := range phase.Releases {
+			if !p.manager.IsReleaseInstalled(release) {
+				p.logger.Info("skipping release (installed: false)", zap.String("name", release.Name))
+				continue
+			}
+
+			if skipReason != "" {
+				report.Skip(release.Name, executor.ReleaseNamespace(release), skipReason)
+				continue
+			}
+
+			if ctx.Err() != nil {
+				report.Record(release.Name, executor.ReleaseNamespace(release), 0,
+					fmt.Errorf("sync deadline exceeded before release started: %w", sync.ErrTimeout))
+				announcer.ReleaseFinished(report.Results[len(report.Results)-1])
+				continue
+			}
+
+			announcer.ReleaseStarted(release.Name, executor.ReleaseNamespace(release))
+			start := time.Now()
+			helmRelease, err := executor.UpgradeReleaseContext(ctx, release)
+			if err == nil && run.notes && (helmRelease == nil || helmRelease.Notes == "") {
+				helmRelease = p.withReleaseNotes(ctx, executor, release, helmRelease)
+			}
+			report.RecordRelease(release.Name, executor.ReleaseNamespace(release), time.Since(start), helmRelease, err)
+			announcer.ReleaseFinished(report.Results[len(report.Results)-1])
+			if err != nil {
+				phaseFailed = true
+				if !sync.IsTimeout(err) {
+					skipReason = "previous release failed"
+				}
+			}
+		}
+		// Later phases depend on this one being ready
+		if phaseFailed && skipReason == "" {
+			skipReason = fmt.Sprintf("phase %s failed", phase.Name)
+		}
+	}
+}
+
+// withReleaseNotes adds the notes of a synced release to what helm
+// reported, asking helm get notes when the upgrade output had none
+func (p *Project) withReleaseNotes(ctx context.Context, executor *sync.Executor, release helmstate.Release, helmRelease *sync.HelmRelease) *sync.HelmRelease {
+	notes, err := executor.ReleaseNotes(ctx, release)
+	if err != nil {
+		p.logger.Warn("failed to get release notes", zap.String("release", release.Name), zap.Error(err))
+		return helmRelease
+	}
+	if helmRelease == nil {
+		helmRelease = &sync.HelmRelease{Name: release.Name, Namespace: executor.ReleaseNamespace(release)}
+	}
+	helmRelease.Notes = notes
+	return helmRelease
+}
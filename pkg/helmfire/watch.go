@@ -0,0 +1,398 @@
+package helmfire
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/filesync"
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+	"github.com/oleksiyp/helmfire/pkg/watcher"
+	"go.uber.org/zap"
+)
+
+// WatchOptions configure a watch session
+type WatchOptions struct {
+	// Executor syncs the releases; one made with default ExecutorOptions
+	// when nil
+	Executor *sync.Executor
+
+	// Syncer copies file sync sources into pods; one using KubeContext
+	// when nil
+	Syncer      *filesync.Syncer
+	KubeContext string
+
+	Interval time.Duration // how often files are checked; watcher.DefaultInterval when 0
+	DryRun   bool          // reports file syncs instead of copying files
+
+	// Releases limits the session to the named releases; nil watches them
+	// all
+	Releases []string
+
+	// Build rebuilds the dev images of a release before it is synced; the
+	// build contexts of releases aren't watched when nil
+	Build func(ctx context.Context, release helmstate.Release) error
+
+	Reporter WatchReporter // logs what happens when nil
+	Logger   *zap.Logger   // the project's when nil
+}
+
+// WatchSession keeps a project synced while its files are edited
+type WatchSession struct {
+	manager     *helmstate.Manager
+	executor    *sync.Executor
+	syncer      *filesync.Syncer
+	substitutor *substitute.Manager
+	watcher     *watcher.Watcher
+	report      WatchReporter
+	logger      *zap.Logger
+	dryRun      bool
+
+	// releases limits the session to some releases; nil watches them all
+	releases map[string]bool
+
+	// build rebuilds the dev images of a release; nil doesn't watch their
+	// build contexts
+	build func(ctx context.Context, release helmstate.Release) error
+}
+
+// WatchReporter shows what a watch session does
+type WatchReporter interface {
+	Started(paths int)
+	Changed(what string)
+	Building(release string)
+	Syncing(release string)
+	Synced(release string, took time.Duration, err error)
+	FilesSynced(change filesync.Change, pods []string, err error)
+	Failed(err error)
+	Stopped()
+}
+
+// Watch watches the helmfiles, the values files and substituted local
+// charts of their releases and the sources of their file syncs until ctx
+// is done. A helmfile change reloads the project and syncs every release, a
+// values file or chart change syncs the releases using it, and file sync
+// sources are copied into running pods without a sync.
+func (p *Project) Watch(ctx context.Context, opts WatchOptions) error {
+	return p.NewWatchSession(opts).Run(ctx)
+}
+
+// NewWatchSession returns a session watching the project as Watch does, for
+// callers that sync releases themselves before running it
+func (p *Project) NewWatchSession(opts WatchOptions) *WatchSession {
+	s := &WatchSession{
+		manager:     p.manager,
+		executor:    opts.Executor,
+		syncer:      opts.Syncer,
+		substitutor: p.substitutor,
+		report:      opts.Reporter,
+		logger:      opts.Logger,
+		dryRun:      opts.DryRun,
+		build:       opts.Build,
+	}
+	if s.logger == nil {
+		s.logger = p.logger
+	}
+	if s.executor == nil {
+		s.executor = p.Executor(ExecutorOptions{Logger: s.logger})
+	}
+	if s.syncer == nil {
+		s.syncer = filesync.NewSyncer(s.logger)
+		s.syncer.KubeContext = opts.KubeContext
+	}
+	if s.report == nil {
+		s.report = logReporter{logger: s.logger}
+	}
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = watcher.DefaultInterval
+	}
+	s.watcher = watcher.New(interval)
+	if opts.Releases != nil {
+		s.releases = make(map[string]bool, len(opts.Releases))
+		for _, name := range opts.Releases {
+			s.releases[name] = true
+		}
+	}
+	return s
+}
+
+// Run watches until ctx is done
+func (s *WatchSession) Run(ctx context.Context) error {
+	if err := s.addPaths(); err != nil {
+		return err
+	}
+
+	s.report.Started(len(s.watcher.Paths()))
+	s.watcher.Run(ctx, func(events []watcher.Event) {
+		s.handle(ctx, events)
+	})
+	s.report.Stopped()
+	return nil
+}
+
+// watched returns the releases of the session
+func (s *WatchSession) watched() []helmstate.Release {
+	var releases []helmstate.Release
+	for _, release := range s.manager.GetReleases() {
+		if s.releases == nil || s.releases[release.Name] {
+			releases = append(releases, release)
+		}
+	}
+	return releases
+}
+
+// addPaths watches the helmfile and the files its releases refer to
+func (s *WatchSession) addPaths() error {
+	// Directories are watched whole so that helmfiles added to them load
+	paths := append([]string{s.manager.FilePath}, s.manager.ExtraPaths...)
+	paths = append(paths, s.manager.Bases...)
+	for _, release := range s.watched() {
+		paths = append(paths, valuesFiles(release)...)
+		if chart, ok := s.localChart(release); ok {
+			paths = append(paths, chart)
+		}
+		for _, fileSync := range release.Sync {
+			paths = append(paths, fileSync.Src)
+		}
+		if s.build != nil && release.Dev != nil {
+			for _, build := range release.Dev.Build {
+				paths = append(paths, build.Context)
+			}
+		}
+	}
+	for _, path := range paths {
+		if err := s.watcher.Add(path); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// changedHelmfile returns a helmfile among the changed files: one that was
+// loaded or is a base of one, or a *.yaml file directly in a helmfile
+// directory
+func (s *WatchSession) changedHelmfile(events []watcher.Event) (string, bool) {
+	loaded := make(map[string]bool, len(s.manager.Files))
+	for _, file := range s.manager.Files {
+		loaded[file] = true
+	}
+	for _, base := range s.manager.Bases {
+		loaded[base] = true
+	}
+	dirs := make(map[string]bool)
+	for _, path := range append([]string{s.manager.FilePath}, s.manager.ExtraPaths...) {
+		if abs, err := filepath.Abs(path); err == nil {
+			dirs[abs] = true
+		}
+	}
+
+	for _, event := range events {
+		if loaded[event.Path] || (dirs[filepath.Dir(event.Path)] && filepath.Ext(event.Path) == ".yaml") {
+			return event.Path, true
+		}
+	}
+	return "", false
+}
+
+// handle syncs what a burst of changes affects
+func (s *WatchSession) handle(ctx context.Context, events []watcher.Event) {
+	for _, event := range events {
+		s.logger.Debug("file changed", zap.String("path", event.Path), zap.Bool("removed", event.Removed))
+	}
+
+	changed := make(map[string]bool, len(events))
+	for _, event := range events {
+		changed[event.Path] = true
+	}
+
+	if helmfile, ok := s.changedHelmfile(events); ok {
+		s.report.Changed(filepath.Base(helmfile))
+		if err := s.manager.Load(); err != nil {
+			s.report.Failed(err)
+			return
+		}
+		LogMissingFiles(s.logger, s.manager.Missing)
+		stats := s.manager.LastLoad
+		s.logger.Debug("reloaded helmfile",
+			zap.Duration("took", stats.Duration),
+			zap.Int("releases", stats.Releases),
+			zap.Int("files", stats.Files),
+			zap.Int("unchanged", stats.Reused))
+		if err := s.addPaths(); err != nil {
+			s.report.Failed(err)
+		}
+		for _, release := range s.watched() {
+			s.SyncRelease(ctx, release)
+		}
+		return
+	}
+
+	for _, release := range s.watched() {
+		if usesAny(valuesFiles(release), changed) {
+			s.report.Changed("values of " + release.Name)
+			s.SyncRelease(ctx, release)
+			continue
+		}
+		if chart, ok := s.localChart(release); ok && containsAny(chart, events) {
+			s.report.Changed("chart of " + release.Name)
+			s.executor.InvalidateChartPackage(chart)
+			s.SyncRelease(ctx, release)
+			continue
+		}
+		for _, change := range filesync.Plan(release, s.executor.ReleaseNamespace(release), events) {
+			s.syncFiles(ctx, change)
+		}
+		// File syncs update running pods in place, so only changes they
+		// don't cover need a new image
+		if s.build != nil && release.Dev != nil && usesBuild(release, events) {
+			s.report.Changed("sources of " + release.Name)
+			s.Rebuild(ctx, release)
+		}
+	}
+}
+
+// Rebuild builds the dev images of a release and syncs it
+func (s *WatchSession) Rebuild(ctx context.Context, release helmstate.Release) {
+	if !s.manager.IsReleaseInstalled(release) {
+		return
+	}
+	s.report.Building(release.Name)
+	if err := s.build(ctx, release); err != nil {
+		s.report.Synced(release.Name, 0, err)
+		return
+	}
+	s.SyncRelease(ctx, release)
+}
+
+// SyncRelease syncs a release and reports the result
+func (s *WatchSession) SyncRelease(ctx context.Context, release helmstate.Release) {
+	if !s.manager.IsReleaseInstalled(release) {
+		return
+	}
+	s.report.Syncing(release.Name)
+	start := time.Now()
+	err := s.executor.SyncReleaseContext(ctx, release)
+	s.report.Synced(release.Name, time.Since(start), err)
+}
+
+// syncFiles copies a file sync change into the pods of its release
+func (s *WatchSession) syncFiles(ctx context.Context, change filesync.Change) {
+	if s.dryRun {
+		s.report.FilesSynced(change, nil, nil)
+		return
+	}
+	pods, err := s.syncer.Apply(ctx, change)
+	s.report.FilesSynced(change, pods, err)
+}
+
+// localChart returns the local chart substituted for the chart of release
+func (s *WatchSession) localChart(release helmstate.Release) (string, bool) {
+	return s.substitutor.GetChartPathFor(release.Chart, release.Name, s.executor.ReleaseNamespace(release))
+}
+
+// valuesFiles returns the values files of a release
+func valuesFiles(release helmstate.Release) []string {
+	var files []string
+	for _, val := range release.Values {
+		if path, ok := val.(string); ok {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// containsAny reports whether any event is at or below dir
+func containsAny(dir string, events []watcher.Event) bool {
+	for _, event := range events {
+		if rel, err := filepath.Rel(dir, event.Path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// usesBuild reports whether any event is in a build context of release
+// and outside its file syncs
+func usesBuild(release helmstate.Release, events []watcher.Event) bool {
+	for _, event := range events {
+		synced := false
+		for _, fileSync := range release.Sync {
+			if fileSync.Src == event.Path || containsAny(fileSync.Src, []watcher.Event{event}) {
+				synced = true
+				break
+			}
+		}
+		if synced {
+			continue
+		}
+		for _, build := range release.Dev.Build {
+			if containsAny(build.Context, []watcher.Event{event}) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// usesAny reports whether any of paths changed
+func usesAny(paths []string, changed map[string]bool) bool {
+	for _, path := range paths {
+		if changed[path] {
+			return true
+		}
+	}
+	return false
+}
+
+// logReporter logs what a watch session does
+type logReporter struct {
+	logger *zap.Logger
+}
+
+func (r logReporter) Started(paths int) {
+	r.logger.Info("watching for changes", zap.Int("paths", paths))
+}
+
+func (r logReporter) Changed(what string) {
+	r.logger.Info("changed", zap.String("what", what))
+}
+
+func (r logReporter) Building(release string) {
+	r.logger.Info("building", zap.String("release", release))
+}
+
+func (r logReporter) Syncing(release string) {
+	r.logger.Info("syncing", zap.String("release", release))
+}
+
+func (r logReporter) Synced(release string, took time.Duration, err error) {
+	if err != nil {
+		r.logger.Error("sync failed", zap.String("release", release), zap.Error(err))
+		return
+	}
+	r.logger.Info("synced", zap.String("release", release), zap.Duration("took", took))
+}
+
+func (r logReporter) FilesSynced(change filesync.Change, pods []string, err error) {
+	if err != nil {
+		r.logger.Error("file sync failed", zap.String("release", change.Release), zap.Error(err))
+		return
+	}
+	r.logger.Info("synced files",
+		zap.String("release", change.Release),
+		zap.Int("files", len(change.Updated)+len(change.Removed)),
+		zap.Strings("pods", pods))
+}
+
+func (r logReporter) Failed(err error) {
+	r.logger.Error("watch failed", zap.Error(err))
+}
+
+func (r logReporter) Stopped() {
+	r.logger.Info("stopped watching")
+}
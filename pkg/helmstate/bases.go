@@ -0,0 +1,167 @@
+package helmstate
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// baseFile is a base a helmfile was layered over, as of the content with hash
+type baseFile struct {
+	path string
+	hash [sha256.Size]byte
+}
+
+// basesUnchanged reports whether every base still has the content it was
+// layered with
+func basesUnchanged(bases []baseFile) bool {
+	for _, base := range bases {
+		data, err := os.ReadFile(base.path)
+		if err != nil || sha256.Sum256(data) != base.hash {
+			return false
+		}
+	}
+	return true
+}
+
+// layerBases layers spec over its bases, in place, and returns the base
+// files read. Bases are layered in order, each over its own bases first, so
+// later bases and finally the helmfile itself take precedence. stack holds
+// the files being layered, to catch bases that include themselves.
+func (m *Manager) layerBases(path string, spec *HelmfileSpec, stack []string) ([]baseFile, error) {
+	if len(spec.Bases) == 0 {
+		return nil, nil
+	}
+
+	layered := &HelmfileSpec{}
+	var read []baseFile
+	for _, base := range spec.Bases {
+		basePath := base
+		if !filepath.IsAbs(basePath) {
+			basePath = filepath.Join(filepath.Dir(path), basePath)
+		}
+		if contains(stack, basePath) {
+			return nil, fmt.Errorf("base %s of %s includes itself", basePath, path)
+		}
+
+		data, err := os.ReadFile(basePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read base of %s: %w", path, err)
+		}
+		baseSpec, err := m.decode(basePath, data)
+		if err != nil {
+			return nil, err
+		}
+		nested, err := m.layerBases(basePath, baseSpec, append(stack, basePath))
+		if err != nil {
+			return nil, err
+		}
+
+		read = append(read, baseFile{path: basePath, hash: sha256.Sum256(data)})
+		read = append(read, nested...)
+		layerSpec(layered, baseSpec)
+	}
+
+	bases := spec.Bases
+	layerSpec(layered, spec)
+	layered.Bases = bases
+	*spec = *layered
+	return read, nil
+}
+
+// layerSpec layers src over dst. Releases are appended; repositories and
+// namespaces replace those of the same name; environment values are
+// appended, so later layers take precedence in helm's values order; and
+// the helm defaults and phases src sets replace dst's.
+func layerSpec(dst, src *HelmfileSpec) {
+	for _, repo := range src.Repositories {
+		replaced := false
+		for i := range dst.Repositories {
+			if dst.Repositories[i].Name == repo.Name {
+				dst.Repositories[i] = repo
+				replaced = true
+			}
+		}
+		if !replaced {
+			dst.Repositories = append(dst.Repositories, repo)
+		}
+	}
+
+	dst.Releases = append(dst.Releases, src.Releases...)
+
+	for name, env := range src.Environments {
+		if dst.Environments == nil {
+			dst.Environments = make(map[string]Environment)
+		}
+		layered := dst.Environments[name]
+		layered.Values = append(layered.Values, env.Values...)
+		if env.Namespace != "" {
+			layered.Namespace = env.Namespace
+		}
+		if env.KubeContext != "" {
+			layered.KubeContext = env.KubeContext
+		}
+		dst.Environments[name] = layered
+	}
+	for name, ns := range src.Namespaces {
+		if dst.Namespaces == nil {
+			dst.Namespaces = make(map[string]Namespace)
+		}
+		dst.Namespaces[name] = ns
+	}
+
+	if src.HelmDefaults != nil {
+		defaults := HelmDefaults{}
+		if dst.HelmDefaults != nil {
+			defaults = *dst.HelmDefaults
+		}
+		if src.HelmDefaults.Wait != nil {
+			defaults.Wait = src.HelmDefaults.Wait
+		}
+		if src.HelmDefaults.Timeout > 0 {
+			defaults.Timeout = src.HelmDefaults.Timeout
+		}
+		if src.HelmDefaults.CreateNamespace != nil {
+			defaults.CreateNamespace = src.HelmDefaults.CreateNamespace
+		}
+		if src.HelmDefaults.Namespace != "" {
+			defaults.Namespace = src.HelmDefaults.Namespace
+		}
+		if src.HelmDefaults.KubeContext != "" {
+			defaults.KubeContext = src.HelmDefaults.KubeContext
+		}
+		if src.HelmDefaults.MissingFileHandler != "" {
+			defaults.MissingFileHandler = src.HelmDefaults.MissingFileHandler
+		}
+		dst.HelmDefaults = &defaults
+	}
+
+	if len(src.Phases) > 0 {
+		dst.Phases = src.Phases
+	}
+}
+
+// applyHelmDefaults fills in the fields the helmfile's releases leave unset
+// from its helmDefaults. A default of wait: true makes every release wait.
+func applyHelmDefaults(spec *HelmfileSpec) {
+	defaults := spec.HelmDefaults
+	if defaults == nil {
+		return
+	}
+	for i := range spec.Releases {
+		release := &spec.Releases[i]
+		if defaults.Wait != nil && *defaults.Wait {
+			release.Wait = true
+		}
+		if release.Timeout == 0 {
+			release.Timeout = defaults.Timeout
+		}
+		if release.CreateNamespace == nil {
+			release.CreateNamespace = defaults.CreateNamespace
+		}
+		if release.MissingFileHandler == "" {
+			release.MissingFileHandler = defaults.MissingFileHandler
+		}
+	}
+}
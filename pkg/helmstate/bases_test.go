@@ -0,0 +1,112 @@
+package helmstate
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadLayersBases(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"bases/common.yaml": `bases: [defaults.yaml]
+repositories:
+  - name: stable
+    url: https://example.com/stable
+  - name: jetstack
+    url: https://charts.jetstack.io
+environments:
+  prod:
+    values: [common-prod.yaml]
+`,
+		"bases/defaults.yaml": `helmDefaults:
+  wait: true
+  timeout: 300
+`,
+		"helmfile.yaml": `bases: [bases/common.yaml]
+helmDefaults:
+  timeout: 600
+repositories:
+  - name: stable
+    url: https://example.com/mirror
+environments:
+  prod:
+    values: [prod.yaml]
+releases:
+  - name: web
+    chart: stable/web
+  - name: api
+    chart: stable/api
+    timeout: 60
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manager := NewManager(filepath.Join(dir, "helmfile.yaml"), "prod")
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+
+	wantRepos := []Repository{
+		{Name: "stable", URL: "https://example.com/mirror"},
+		{Name: "jetstack", URL: "https://charts.jetstack.io"},
+	}
+	if repos := manager.GetRepositories(); !reflect.DeepEqual(repos, wantRepos) {
+		t.Errorf("expected the helmfile's repository to replace the base's, got %+v", repos)
+	}
+	wantValues := []interface{}{
+		filepath.Join(dir, "bases", "common-prod.yaml"),
+		filepath.Join(dir, "prod.yaml"),
+	}
+	if values := manager.Spec.Environments["prod"].Values; !reflect.DeepEqual(values, wantValues) {
+		t.Errorf("expected base environment values first, got %v", values)
+	}
+
+	releases := manager.GetReleases()
+	if !releases[0].Wait || releases[0].Timeout != 600 {
+		t.Errorf("expected helmDefaults applied to web, got %+v", releases[0])
+	}
+	if releases[1].Timeout != 60 {
+		t.Errorf("expected api to keep its own timeout, got %d", releases[1].Timeout)
+	}
+
+	wantBases := []string{filepath.Join(dir, "bases", "common.yaml"), filepath.Join(dir, "bases", "defaults.yaml")}
+	if !reflect.DeepEqual(manager.Bases, wantBases) {
+		t.Errorf("unexpected bases %v", manager.Bases)
+	}
+
+	// A changed base is picked up on reload even though the helmfile is not
+	if err := os.WriteFile(wantBases[1], []byte("helmDefaults:\n  wait: false\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if manager.LastLoad.Reused != 0 {
+		t.Errorf("expected the helmfile to be parsed again, got %+v", manager.LastLoad)
+	}
+	if manager.GetReleases()[0].Wait {
+		t.Error("expected the changed helmDefaults to apply")
+	}
+}
+
+func TestLoadBaseIncludesItself(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "helmfile.yaml"), []byte("bases: [base.yaml]\nreleases: []\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "base.yaml"), []byte("bases: [helmfile.yaml]\n"), 0644)
+
+	err := NewManager(filepath.Join(dir, "helmfile.yaml"), "").Load()
+	if err == nil || !strings.Contains(err.Error(), "includes itself") {
+		t.Errorf("expected a cycle error, got %v", err)
+	}
+}
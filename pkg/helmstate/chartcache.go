@@ -0,0 +1,140 @@
+package helmstate
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/oleksiyp/helmfire/pkg/httpclient"
+)
+
+// chartCache holds the remote charts pulled during a drift sweep
+type chartCache struct {
+	dir  string
+	refs int // sweeps using the cache
+
+	mu     sync.Mutex
+	charts map[string]*cachedChart // chart@version -> pulled chart
+}
+
+// cachedChart is a chart pulled once for all releases of a sweep
+type cachedChart struct {
+	once sync.Once
+	path string
+	err  error
+}
+
+// BeginSweep makes DiffRelease pull each remote chart once and reuse it for
+// every release of that chart and version, until EndSweep, instead of
+// downloading it for each release. Sweeps running at once share the charts,
+// removed when the last of them ends.
+func (m *Manager) BeginSweep() error {
+	m.sweepMu.Lock()
+	defer m.sweepMu.Unlock()
+	if m.sweep != nil {
+		m.sweep.refs++
+		return nil
+	}
+
+	dir, err := os.MkdirTemp("", "helmfire-charts-*")
+	if err != nil {
+		return fmt.Errorf("failed to create chart cache: %w", err)
+	}
+	m.sweep = &chartCache{dir: dir, refs: 1, charts: make(map[string]*cachedChart)}
+	return nil
+}
+
+// EndSweep ends a sweep BeginSweep began, removing the charts pulled once
+// no other sweep is running
+func (m *Manager) EndSweep() {
+	m.sweepMu.Lock()
+	defer m.sweepMu.Unlock()
+	if m.sweep == nil {
+		return
+	}
+	m.sweep.refs--
+	if m.sweep.refs == 0 {
+		os.RemoveAll(m.sweep.dir)
+		m.sweep = nil
+	}
+}
+
+// SweepChart returns the chart to diff release against: for remote charts,
+// the one in the offline chart directory or the copy pulled for the current
+// sweep, or else the release's chart
+func (m *Manager) SweepChart(release Release) (string, error) {
+	if m.OfflineCharts != "" && IsRemoteChart(release.Chart) {
+		return OfflineChart(m.OfflineCharts, release.Chart, release.Version)
+	}
+
+	m.sweepMu.Lock()
+	cache := m.sweep
+	m.sweepMu.Unlock()
+	if cache == nil || !IsRemoteChart(release.Chart) {
+		return release.Chart, nil
+	}
+
+	key := release.Chart + "@" + release.Version
+	cache.mu.Lock()
+	chart, ok := cache.charts[key]
+	if !ok {
+		chart = &cachedChart{}
+		cache.charts[key] = chart
+	}
+	cache.mu.Unlock()
+
+	chart.once.Do(func() {
+		chart.path, chart.err = m.pullChart(cache.dir, release.Chart, release.Version)
+	})
+	if chart.err != nil {
+		// helm diff downloads the chart itself and reports the failure
+		return release.Chart, nil
+	}
+	return chart.path, nil
+}
+
+// pullChart downloads a chart into a new directory under dir and returns
+// the path of its archive
+func (m *Manager) pullChart(dir, chart, version string) (string, error) {
+	dest, err := os.MkdirTemp(dir, "chart-*")
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"pull", chart, "--destination", dest}
+	if version != "" {
+		args = append(args, "--version", version)
+	}
+	cmd := exec.Command(m.helmBinary(), args...)
+	if env := httpclient.HelmEnv(); len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("helm pull %s failed: %w (stderr: %s)", chart, err, stderr.String())
+	}
+
+	archives, _ := filepath.Glob(filepath.Join(dest, "*.tgz"))
+	if len(archives) != 1 {
+		return "", fmt.Errorf("helm pull %s left %d archives", chart, len(archives))
+	}
+	return archives[0], nil
+}
+
+// IsRemoteChart reports whether chart is pulled from a repository, such as
+// bitnami/nginx or oci://registry/charts/nginx, rather than a local path
+func IsRemoteChart(chart string) bool {
+	if strings.HasPrefix(chart, "oci://") {
+		return true
+	}
+	if chart == "" || strings.HasPrefix(chart, ".") || filepath.IsAbs(chart) || strings.Count(chart, "/") != 1 {
+		return false
+	}
+	_, err := os.Stat(chart)
+	return os.IsNotExist(err)
+}
@@ -0,0 +1,93 @@
+package helmstate
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSweepPullsChartsOnce(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	// Fake helm that pulls a chart archive and logs its commands
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	helm := filepath.Join(dir, "helm")
+	script := `#!/bin/sh
+echo "$@" >> ` + log + `
+if [ "$1" = "pull" ]; then
+  touch "$4/nginx-1.0.0.tgz"
+fi
+`
+	if err := os.WriteFile(helm, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewManager("", "")
+	manager.HelmBinary = helm
+
+	if err := manager.BeginSweep(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"web", "api"} {
+		if _, err := manager.DiffRelease(Release{Name: name, Chart: "bitnami/nginx", Version: "1.0.0"}); err != nil {
+			t.Fatalf("DiffRelease failed: %v", err)
+		}
+	}
+	manager.EndSweep()
+	manager.DiffRelease(Release{Name: "web", Chart: "bitnami/nginx"})
+
+	data, _ := os.ReadFile(log)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "pull bitnami/nginx --destination ") || !strings.HasSuffix(lines[0], "--version 1.0.0") {
+		t.Fatalf("expected one pull and three diffs, got %q", lines)
+	}
+	for _, line := range lines[1:3] {
+		if !strings.Contains(line, "nginx-1.0.0.tgz") {
+			t.Errorf("expected the diff against the pulled chart, got %q", line)
+		}
+	}
+	if !strings.Contains(lines[3], " bitnami/nginx ") {
+		t.Errorf("expected the chart itself diffed after the sweep, got %q", lines[3])
+	}
+}
+
+func TestSweepsShareCharts(t *testing.T) {
+	manager := NewManager("", "")
+
+	for i := 0; i < 2; i++ {
+		if err := manager.BeginSweep(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir := manager.sweep.dir
+
+	// The first sweep to end leaves the charts to the other
+	manager.EndSweep()
+	if _, err := os.Stat(dir); err != nil || manager.sweep == nil {
+		t.Fatalf("expected the chart cache kept for the running sweep, got %v", err)
+	}
+	manager.EndSweep()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) || manager.sweep != nil {
+		t.Errorf("expected the chart cache removed after the last sweep, got %v", err)
+	}
+}
+
+func TestIsRemoteChart(t *testing.T) {
+	for chart, want := range map[string]bool{
+		"bitnami/nginx":                 true,
+		"oci://registry.example.com/ch": true,
+		"./charts/web":                  false,
+		"/srv/charts/web":               false,
+		"charts/web/sub":                false,
+		"":                              false,
+	} {
+		if got := IsRemoteChart(chart); got != want {
+			t.Errorf("IsRemoteChart(%q) = %v, want %v", chart, got, want)
+		}
+	}
+}
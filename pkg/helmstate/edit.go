@@ -0,0 +1,283 @@
+package helmstate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SetReleaseVersion returns helmfile data with the version of the named
+// release set to version, adding the field after the release's chart when
+// missing. Only that value changes, so comments and formatting are kept. It
+// reports false when the helmfile doesn't define the release.
+func SetReleaseVersion(data []byte, release, version string) ([]byte, bool, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return data, false, nil
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to parse helmfile: %w", err)
+		}
+
+		releases := mappingValue(documentRoot(&doc), "releases")
+		if releases == nil || releases.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, node := range releases.Content {
+			if node.Kind != yaml.MappingNode {
+				continue
+			}
+			if name := mappingValue(node, "name"); name == nil || name.Value != release {
+				continue
+			}
+			if node.Style&yaml.FlowStyle != 0 {
+				return nil, false, fmt.Errorf("release %s is written in flow style; update its version by hand", release)
+			}
+			updated, err := setMappingScalar(data, node, "version", version)
+			if err != nil {
+				return nil, false, fmt.Errorf("release %s: %w", release, err)
+			}
+			return updated, true, nil
+		}
+	}
+}
+
+// AddRelease returns helmfile data with release appended to its releases,
+// adding the releases field when missing. The rest of the file, comments
+// included, is kept as is. It fails when the helmfile already defines a
+// release of the same name.
+func AddRelease(data []byte, release Release) ([]byte, error) {
+	var item bytes.Buffer
+	encoder := yaml.NewEncoder(&item)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(release); err != nil {
+		return nil, fmt.Errorf("failed to encode release: %w", err)
+	}
+
+	// The release goes in the first document with releases, or else at the
+	// end of the last one
+	var target, last *yaml.Node
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse helmfile: %w", err)
+		}
+		root := documentRoot(&doc)
+		if root.Kind != yaml.MappingNode {
+			continue
+		}
+		last = root
+		releases := mappingValue(root, "releases")
+		if releases == nil {
+			continue
+		}
+		for _, node := range releases.Content {
+			if name := mappingValue(node, "name"); name != nil && name.Value == release.Name {
+				return nil, fmt.Errorf("release %s is already defined", release.Name)
+			}
+		}
+		if target == nil {
+			target = root
+		}
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		lines[len(lines)-1] += "\n"
+	}
+
+	if target == nil {
+		if last == nil && strings.TrimSpace(stripComments(lines)) != "" {
+			return nil, fmt.Errorf("cannot place the release; add it by hand")
+		}
+		indent := 0
+		if last != nil {
+			indent = last.Column - 1
+		}
+		block := strings.Repeat(" ", indent) + "releases:\n" + sequenceItem(item.String(), indent+2, indent+4)
+		return []byte(strings.Join(lines, "") + block), nil
+	}
+
+	key, releases := mappingKey(target, "releases"), mappingValue(target, "releases")
+	if len(releases.Content) == 0 {
+		// releases: [] or an empty releases: becomes a block sequence
+		at := key.Line - 1
+		m := emptyReleases.FindStringSubmatch(strings.TrimRight(lines[at], "\r\n"))
+		if m == nil {
+			return nil, fmt.Errorf("cannot place the release; add it by hand")
+		}
+		indent := key.Column - 1
+		lines[at] = m[1] + m[2] + "\n"
+		block := sequenceItem(item.String(), indent+2, indent+4)
+		lines = append(lines[:at+1], append([]string{block}, lines[at+1:]...)...)
+		return []byte(strings.Join(lines, "")), nil
+	}
+	if releases.Kind != yaml.SequenceNode || releases.Style&yaml.FlowStyle != 0 {
+		return nil, fmt.Errorf("releases are not a block list; add the release by hand")
+	}
+
+	// Follow the indentation of the existing releases and insert after the
+	// last one, before the comments and blank lines leading to what follows
+	first, lastItem := releases.Content[0], releases.Content[len(releases.Content)-1]
+	end := documentEnd(lines, lastItem.Line)
+	if next := nextMappingKey(target, "releases"); next != nil {
+		end = next.Line - 1
+	}
+	for end > lastItem.Line && isBlankOrComment(lines[end-1]) {
+		end--
+	}
+	block := sequenceItem(item.String(), releases.Column-1, first.Column-1)
+	lines = append(lines[:end], append([]string{block}, lines[end:]...)...)
+	return []byte(strings.Join(lines, "")), nil
+}
+
+// emptyReleases matches a releases field without releases, keeping its
+// indentation and trailing comment
+var emptyReleases = regexp.MustCompile(`^(\s*releases:)\s*(?:\[\s*\]|~|null)?(\s*#.*)?$`)
+
+// sequenceItem formats a block mapping as an item of a block sequence whose
+// dashes are at column dash and items at column content, both 0-based
+func sequenceItem(mapping string, dash, content int) string {
+	var b strings.Builder
+	for i, line := range strings.SplitAfter(strings.TrimRight(mapping, "\n"), "\n") {
+		if i == 0 {
+			b.WriteString(strings.Repeat(" ", dash) + "-" + strings.Repeat(" ", content-dash-1))
+		} else if strings.TrimSpace(line) != "" {
+			b.WriteString(strings.Repeat(" ", content))
+		}
+		b.WriteString(line)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// nextMappingKey returns the key following key in a mapping node, or nil
+func nextMappingKey(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+3 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+2]
+		}
+	}
+	return nil
+}
+
+// documentEnd returns the number of lines up to the end of the document
+// containing the line from, 1-based
+func documentEnd(lines []string, from int) int {
+	for i := from; i < len(lines); i++ {
+		if strings.HasPrefix(lines[i], "---") || strings.HasPrefix(lines[i], "...") {
+			return i
+		}
+	}
+	return len(lines)
+}
+
+// isBlankOrComment reports whether a line holds nothing but a comment
+func isBlankOrComment(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" || strings.HasPrefix(trimmed, "#")
+}
+
+// stripComments returns lines without comment and blank lines
+func stripComments(lines []string) string {
+	var b strings.Builder
+	for _, line := range lines {
+		if !isBlankOrComment(line) {
+			b.WriteString(line)
+		}
+	}
+	return b.String()
+}
+
+// documentRoot returns the top-level node of a document
+func documentRoot(doc *yaml.Node) *yaml.Node {
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		return doc.Content[0]
+	}
+	return doc
+}
+
+// mappingValue returns the value of key in a mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingScalar rewrites the scalar value of key in the block mapping
+// node within data, or inserts key after the mapping's chart field
+func setMappingScalar(data []byte, node *yaml.Node, key, value string) ([]byte, error) {
+	lines := strings.SplitAfter(string(data), "\n")
+
+	existing := mappingValue(node, key)
+	if existing == nil {
+		chartKey, chart := mappingKey(node, "chart"), mappingValue(node, "chart")
+		if chartKey == nil || chart.Kind != yaml.ScalarNode || chart.Line != chartKey.Line {
+			return nil, fmt.Errorf("cannot place a %s field; add it by hand", key)
+		}
+		indent := strings.Repeat(" ", chartKey.Column-1)
+		inserted := indent + key + ": " + value + "\n"
+		at := chart.Line // insert after the chart's line
+		if !strings.HasSuffix(lines[at-1], "\n") {
+			lines[at-1] += "\n"
+		}
+		lines = append(lines[:at], append([]string{inserted}, lines[at:]...)...)
+		return []byte(strings.Join(lines, "")), nil
+	}
+
+	if existing.Kind != yaml.ScalarNode || strings.Contains(existing.Value, "{{") {
+		return nil, fmt.Errorf("%s is not a plain value; update it by hand", key)
+	}
+	raw, replacement := existing.Value, value
+	switch existing.Style {
+	case yaml.DoubleQuotedStyle:
+		raw, replacement = `"`+raw+`"`, `"`+value+`"`
+	case yaml.SingleQuotedStyle:
+		raw, replacement = `'`+raw+`'`, `'`+value+`'`
+	case 0: // plain
+	default:
+		return nil, fmt.Errorf("%s is not a plain value; update it by hand", key)
+	}
+
+	i, col := existing.Line-1, existing.Column-1
+	if i >= len(lines) || col+len(raw) > len(lines[i]) || lines[i][col:col+len(raw)] != raw {
+		return nil, fmt.Errorf("cannot locate %s in the file; update it by hand", key)
+	}
+	lines[i] = lines[i][:col] + replacement + lines[i][col+len(raw):]
+	return []byte(strings.Join(lines, "")), nil
+}
+
+// mappingKey returns the node of key in a mapping node, or nil
+func mappingKey(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i]
+		}
+	}
+	return nil
+}
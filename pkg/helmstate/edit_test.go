@@ -0,0 +1,126 @@
+package helmstate
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetReleaseVersion(t *testing.T) {
+	helmfile := `repositories:
+  - name: bitnami
+    url: https://charts.bitnami.com/bitnami
+
+releases:
+  - name: web # the storefront
+    chart: bitnami/nginx
+    version: 15.0.0   # pinned for the freeze
+  - name: cache
+    chart: bitnami/redis
+    version: "17.1.0"
+  - chart: bitnami/postgresql
+    name: db
+    values:
+      - db.yaml
+`
+
+	tests := []struct {
+		release, version string
+		old, new         string
+	}{
+		{"web", "15.4.2", "version: 15.0.0   #", "version: 15.4.2   #"},
+		{"cache", "18.0.1", `version: "17.1.0"`, `version: "18.0.1"`},
+		{"db", "12.5.6", "postgresql\n", "postgresql\n    version: 12.5.6\n"},
+	}
+	for _, tt := range tests {
+		updated, found, err := SetReleaseVersion([]byte(helmfile), tt.release, tt.version)
+		if err != nil || !found {
+			t.Fatalf("SetReleaseVersion(%s) = %v, %v", tt.release, found, err)
+		}
+		if expected := strings.Replace(helmfile, tt.old, tt.new, 1); string(updated) != expected {
+			t.Errorf("SetReleaseVersion(%s) produced:\n%s\nexpected:\n%s", tt.release, updated, expected)
+		}
+	}
+
+	if _, found, err := SetReleaseVersion([]byte(helmfile), "queue", "1.0.0"); err != nil || found {
+		t.Errorf("expected an unknown release not to be found, got %v, %v", found, err)
+	}
+
+	// Releases in a later document are found too
+	multi := "environments:\n  default: {}\n---\nreleases:\n  - name: web\n    chart: bitnami/nginx\n    version: 1.0.0\n"
+	updated, found, err := SetReleaseVersion([]byte(multi), "web", "1.1.0")
+	if err != nil || !found || string(updated) != strings.Replace(multi, "1.0.0", "1.1.0", 1) {
+		t.Errorf("expected the second document to be updated, got %v, %v:\n%s", found, err, updated)
+	}
+
+	for _, content := range []string{
+		"releases:\n  - name: web\n    chart: bitnami/nginx\n    version: '{{ .Values.nginxVersion }}'\n",
+		"releases:\n  - {name: web, chart: bitnami/nginx, version: 1.0.0}\n",
+	} {
+		if _, _, err := SetReleaseVersion([]byte(content), "web", "1.1.0"); err == nil {
+			t.Errorf("expected %q to be left alone", content)
+		}
+	}
+}
+
+func TestAddRelease(t *testing.T) {
+	release := Release{Name: "queue", Namespace: "messaging", Chart: "bitnami/rabbitmq", Version: "12.0.0", Values: []interface{}{"queue.yaml"}}
+	item := "name: queue\nnamespace: messaging\nchart: bitnami/rabbitmq\nversion: 12.0.0\nvalues:\n  - queue.yaml\n"
+	indented := func(dash, content string) string {
+		lines := strings.SplitAfter(strings.TrimSuffix(item, "\n"), "\n")
+		out := dash + lines[0]
+		for _, line := range lines[1:] {
+			out += content + line
+		}
+		return out + "\n"
+	}
+
+	tests := []struct {
+		name, helmfile, expected string
+	}{
+		{
+			name:     "appended after the last release",
+			helmfile: "releases:\n  - name: web # the storefront\n    chart: bitnami/nginx\n\n# Defaults for every release\nhelmDefaults:\n  wait: true\n",
+			expected: "releases:\n  - name: web # the storefront\n    chart: bitnami/nginx\n" + indented("  - ", "    ") + "\n# Defaults for every release\nhelmDefaults:\n  wait: true\n",
+		},
+		{
+			name:     "indentation of the releases kept",
+			helmfile: "releases:\n- name: web\n  chart: bitnami/nginx\n",
+			expected: "releases:\n- name: web\n  chart: bitnami/nginx\n" + indented("- ", "  "),
+		},
+		{
+			name:     "empty releases",
+			helmfile: "repositories: []\nreleases: [] # none yet\n",
+			expected: "repositories: []\nreleases: # none yet\n" + indented("  - ", "    "),
+		},
+		{
+			name:     "no releases",
+			helmfile: "# Shared settings\nhelmDefaults:\n  wait: true",
+			expected: "# Shared settings\nhelmDefaults:\n  wait: true\nreleases:\n" + indented("  - ", "    "),
+		},
+		{
+			name:     "releases in a later document",
+			helmfile: "environments:\n  default: {}\n---\nreleases:\n  - name: web\n    chart: bitnami/nginx\n",
+			expected: "environments:\n  default: {}\n---\nreleases:\n  - name: web\n    chart: bitnami/nginx\n" + indented("  - ", "    "),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updated, err := AddRelease([]byte(tt.helmfile), release)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(updated) != tt.expected {
+				t.Errorf("AddRelease produced:\n%s\nexpected:\n%s", updated, tt.expected)
+			}
+		})
+	}
+
+	for _, content := range []string{
+		"releases:\n  - name: queue\n    chart: bitnami/redis\n",
+		"releases: [{name: web, chart: bitnami/nginx}]\n",
+	} {
+		if _, err := AddRelease([]byte(content), release); err == nil {
+			t.Errorf("expected an error adding to %q", content)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package helmstate
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// templateData is what installedTemplate is rendered with
+type templateData struct {
+	Environment struct {
+		Name string
+	}
+	Release struct {
+		Name      string
+		Namespace string
+	}
+	Values map[string]interface{}
+}
+
+// applyEnvironment applies the release overrides of environment to spec.
+// values are the environment's values the templates see; with strict, a
+// template using a key missing from them fails instead of rendering empty.
+func applyEnvironment(spec *HelmfileSpec, environment string, values map[string]interface{}, strict bool) error {
+	if environment != "" && len(spec.Environments) > 0 {
+		if _, ok := spec.Environments[environment]; !ok {
+			return fmt.Errorf("environment %q is not defined (environments: %s)", environment, strings.Join(environmentNames(spec), ", "))
+		}
+	}
+
+	for i := range spec.Releases {
+		release := &spec.Releases[i]
+		if release.InstalledTemplate != "" {
+			installed, err := renderInstalled(*release, environment, values, strict)
+			if err != nil {
+				return err
+			}
+			release.Installed = &installed
+		}
+
+		if override, ok := release.Environments[environment]; ok && environment != "" {
+			if override.Version != "" {
+				release.Version = override.Version
+			}
+			if override.Installed != nil {
+				release.Installed = override.Installed
+			}
+			release.Values = append(release.Values, override.Values...)
+		}
+
+		// A release is installed only when its condition holds too
+		if release.Condition != "" {
+			enabled, err := conditionMet(*release, environment, values, strict)
+			if err != nil {
+				return err
+			}
+			if !enabled {
+				release.Installed = &enabled
+			}
+		}
+	}
+	return nil
+}
+
+// usesEnvironmentValues reports whether a release of spec has an
+// installedTemplate or a condition, which read the environment values
+func usesEnvironmentValues(spec *HelmfileSpec) bool {
+	for _, release := range spec.Releases {
+		if release.InstalledTemplate != "" || release.Condition != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// conditionMet looks up the release's condition, a dotted path such as
+// cache.enabled, in the environment values. A condition missing from them
+// is false, or an error with strict.
+func conditionMet(release Release, environment string, values map[string]interface{}, strict bool) (bool, error) {
+	var value interface{} = values
+	for _, key := range strings.Split(release.Condition, ".") {
+		m, ok := value.(map[string]interface{})
+		if ok {
+			value, ok = m[key]
+		}
+		if !ok {
+			if strict {
+				return false, fmt.Errorf("release %s: condition %s is not set in the values of environment %q", release.Name, release.Condition, environment)
+			}
+			return false, nil
+		}
+	}
+	enabled, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("release %s: condition %s is %v, want true or false", release.Name, release.Condition, value)
+	}
+	return enabled, nil
+}
+
+// renderInstalled renders the release's installedTemplate for environment
+func renderInstalled(release Release, environment string, values map[string]interface{}, strict bool) (bool, error) {
+	missingKey := "missingkey=zero"
+	if strict {
+		missingKey = "missingkey=error"
+	}
+	tmpl, err := template.New(release.Name).Option(missingKey).Parse(release.InstalledTemplate)
+	if err != nil {
+		return false, fmt.Errorf("release %s: invalid installedTemplate: %w", release.Name, err)
+	}
+
+	var data templateData
+	data.Environment.Name = environment
+	data.Release.Name = release.Name
+	data.Release.Namespace = release.Namespace
+	data.Values = values
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return false, fmt.Errorf("release %s: failed to render installedTemplate: %w", release.Name, err)
+	}
+	installed, err := strconv.ParseBool(strings.TrimSpace(out.String()))
+	if err != nil {
+		return false, fmt.Errorf("release %s: installedTemplate rendered %q, want true or false", release.Name, out.String())
+	}
+	return installed, nil
+}
+
+// environmentNames returns the environments of the helmfile, sorted
+func environmentNames(spec *HelmfileSpec) []string {
+	names := make([]string, 0, len(spec.Environments))
+	for name := range spec.Environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,179 @@
+package helmstate
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const environmentHelmfile = `environments:
+  dev: {}
+  prod: {}
+
+releases:
+  - name: web
+    chart: ./web
+    version: 1.0.0
+    values:
+      - values.yaml
+    environments:
+      prod:
+        version: 2.0.0
+        values:
+          - prod.yaml
+          - replicaCount: 3
+  - name: debug-tools
+    chart: ./debug
+    installedTemplate: '{{ eq .Environment.Name "dev" }}'
+  - name: legacy
+    chart: ./legacy
+    environments:
+      prod:
+        installed: false
+`
+
+func TestLoadAppliesEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "helmfile.yaml")
+	if err := os.WriteFile(path, []byte(environmentHelmfile), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	load := func(environment string) []Release {
+		t.Helper()
+		manager := NewManager(path, environment)
+		if err := manager.Load(); err != nil {
+			t.Fatalf("Load(%q) failed: %v", environment, err)
+		}
+		return manager.GetReleases()
+	}
+
+	prod := load("prod")
+	web := prod[0]
+	if web.Version != "2.0.0" {
+		t.Errorf("expected prod version 2.0.0, got %s", web.Version)
+	}
+	wantValues := []interface{}{
+		filepath.Join(dir, "values.yaml"),
+		filepath.Join(dir, "prod.yaml"),
+		map[string]interface{}{"replicaCount": 3},
+	}
+	if !reflect.DeepEqual(web.Values, wantValues) {
+		t.Errorf("unexpected prod values %v", web.Values)
+	}
+	if prod[1].Installed == nil || *prod[1].Installed {
+		t.Error("expected debug-tools not to be installed in prod")
+	}
+	if prod[2].Installed == nil || *prod[2].Installed {
+		t.Error("expected legacy not to be installed in prod")
+	}
+
+	dev := load("dev")
+	if dev[0].Version != "1.0.0" || len(dev[0].Values) != 1 {
+		t.Errorf("expected web unchanged in dev, got %+v", dev[0])
+	}
+	if dev[1].Installed == nil || !*dev[1].Installed {
+		t.Error("expected debug-tools to be installed in dev")
+	}
+	if dev[2].Installed != nil {
+		t.Error("expected legacy unchanged in dev")
+	}
+
+	err := NewManager(path, "staging").Load()
+	if err == nil || err.Error() != `environment "staging" is not defined (environments: dev, prod)` {
+		t.Errorf("expected undefined environment error, got %v", err)
+	}
+}
+
+func TestRenderInstalled(t *testing.T) {
+	release := Release{Name: "web", Namespace: "apps", InstalledTemplate: `{{ ne .Release.Namespace "apps" }}`}
+	if installed, err := renderInstalled(release, "", nil, true); err != nil || installed {
+		t.Errorf("expected false, got %v, %v", installed, err)
+	}
+
+	release.InstalledTemplate = "yes please"
+	if _, err := renderInstalled(release, "", nil, true); err == nil {
+		t.Error("expected error for a non-boolean result")
+	}
+	release.InstalledTemplate = "{{ .Release.Chart }}"
+	if _, err := renderInstalled(release, "", nil, false); err == nil {
+		t.Error("expected error for an unknown field")
+	}
+
+	release.InstalledTemplate = "{{ not .Values.debug.enabled }}"
+	values := map[string]interface{}{"debug": map[string]interface{}{"enabled": true}}
+	if installed, err := renderInstalled(release, "", values, true); err != nil || installed {
+		t.Errorf("expected false from the values, got %v, %v", installed, err)
+	}
+	release.InstalledTemplate = "{{ not .Values.enabled }}"
+	if installed, err := renderInstalled(release, "", values, false); err != nil || !installed {
+		t.Errorf("expected a missing key to render empty, got %v, %v", installed, err)
+	}
+	if _, err := renderInstalled(release, "", values, true); err == nil {
+		t.Error("expected error for a missing key in strict mode")
+	}
+}
+
+func TestLoadAppliesConditions(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "helmfile.yaml")
+	spec := `environments:
+  dev:
+    values:
+      - cache:
+          enabled: true
+        metrics:
+          enabled: false
+  prod:
+    values:
+      - cache:
+          enabled: false
+
+releases:
+  - name: cache
+    chart: bitnami/redis
+    condition: cache.enabled
+  - name: metrics
+    chart: ./metrics
+    condition: metrics.enabled
+  - name: legacy
+    chart: ./legacy
+    installed: false
+    condition: cache.enabled
+`
+	if err := os.WriteFile(path, []byte(spec), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	installed := func(environment string, strict bool) ([]bool, error) {
+		t.Helper()
+		manager := NewManager(path, environment)
+		manager.Strict = strict
+		if err := manager.Load(); err != nil {
+			return nil, err
+		}
+		var result []bool
+		for _, release := range manager.GetReleases() {
+			result = append(result, manager.IsReleaseInstalled(release))
+		}
+		return result, nil
+	}
+
+	if dev, err := installed("dev", false); err != nil || !reflect.DeepEqual(dev, []bool{true, false, false}) {
+		t.Errorf("expected only cache in dev, got %v, %v", dev, err)
+	}
+	// metrics.enabled is not set in prod
+	if prod, err := installed("prod", false); err != nil || !reflect.DeepEqual(prod, []bool{false, false, false}) {
+		t.Errorf("expected nothing in prod, got %v, %v", prod, err)
+	}
+	if _, err := installed("prod", true); err == nil {
+		t.Error("expected an error for an unset condition in strict mode")
+	}
+
+	release := Release{Name: "web", Condition: "web.enabled"}
+	values := map[string]interface{}{"web": map[string]interface{}{"enabled": "yes"}}
+	if _, err := conditionMet(release, "dev", values, false); err == nil {
+		t.Error("expected an error for a non-boolean condition")
+	}
+}
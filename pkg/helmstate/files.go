@@ -0,0 +1,107 @@
+package helmstate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+)
+
+// HelmfileFiles expands paths into the absolute paths of the helmfiles to
+// load, in order. A directory, such as helmfile.d, stands for the *.yaml
+// files directly in it in lexical order, as with helmfile.
+func HelmfileFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve path: %w", err)
+		}
+		info, err := os.Stat(abs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read helmfile: %w", err)
+		}
+		if !info.IsDir() {
+			files = append(files, abs)
+			continue
+		}
+
+		matches, err := filepath.Glob(filepath.Join(abs, "*.yaml"))
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no helmfiles (*.yaml) in %s", abs)
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// mergeSpecs merges the specs parsed from files into one. Releases are
+// concatenated, and a release defined twice is an error. Repositories are
+// merged by name, environments and namespaces by key with later files
+// winning, and the phases are the ones declared, which must agree.
+func mergeSpecs(files []string, specs []*HelmfileSpec) (*HelmfileSpec, error) {
+	merged := &HelmfileSpec{}
+	releaseFiles := make(map[string]string)
+	repositoryFiles := make(map[string]string)
+	phasesFile := ""
+
+	for i, spec := range specs {
+		file := files[i]
+		for _, repo := range spec.Repositories {
+			if other, ok := repositoryFiles[repo.Name]; ok {
+				if !containsRepository(merged.Repositories, repo) {
+					return nil, fmt.Errorf("repository %s is defined differently in %s and %s", repo.Name, other, file)
+				}
+				continue
+			}
+			repositoryFiles[repo.Name] = file
+			merged.Repositories = append(merged.Repositories, repo)
+		}
+
+		for _, release := range spec.Releases {
+			key := releaseNamespace(release) + "/" + release.Name
+			if other, ok := releaseFiles[key]; ok {
+				return nil, fmt.Errorf("release %s is defined in both %s and %s", release.Name, other, file)
+			}
+			releaseFiles[key] = file
+			merged.Releases = append(merged.Releases, release)
+		}
+
+		for name, env := range spec.Environments {
+			if merged.Environments == nil {
+				merged.Environments = make(map[string]Environment)
+			}
+			merged.Environments[name] = env
+		}
+		for name, ns := range spec.Namespaces {
+			if merged.Namespaces == nil {
+				merged.Namespaces = make(map[string]Namespace)
+			}
+			merged.Namespaces[name] = ns
+		}
+
+		if len(spec.Phases) > 0 {
+			if phasesFile != "" && !reflect.DeepEqual(merged.Phases, spec.Phases) {
+				return nil, fmt.Errorf("phases declared in %s differ from the ones in %s", file, phasesFile)
+			}
+			merged.Phases = spec.Phases
+			phasesFile = file
+		}
+	}
+	return merged, nil
+}
+
+// containsRepository reports whether repos has exactly repo
+func containsRepository(repos []Repository, repo Repository) bool {
+	for _, r := range repos {
+		if r == repo {
+			return true
+		}
+	}
+	return false
+}
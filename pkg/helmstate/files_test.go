@@ -0,0 +1,121 @@
+package helmstate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadDirectory(t *testing.T) {
+	dir := t.TempDir()
+	helmfiles := filepath.Join(dir, "helmfile.d")
+	if err := os.Mkdir(helmfiles, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"10-infra.yaml": `repositories:
+  - name: jetstack
+    url: https://charts.jetstack.io
+releases:
+  - name: cert-manager
+    chart: jetstack/cert-manager
+    phase: infra
+`,
+		"20-apps.yaml": `repositories:
+  - name: jetstack
+    url: https://charts.jetstack.io
+releases:
+  - name: web
+    chart: ./web
+    values: [web.yaml]
+`,
+		"README.md": "not a helmfile",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(helmfiles, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	extra := filepath.Join(dir, "extra.yaml")
+	if err := os.WriteFile(extra, []byte("releases:\n  - name: debug\n    chart: ./debug\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewManager(helmfiles, "")
+	manager.ExtraPaths = []string{extra}
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+
+	if names := releaseNames(manager.GetReleases()); names != "cert-manager,web,debug" {
+		t.Errorf("unexpected releases %s", names)
+	}
+	if repos := manager.GetRepositories(); len(repos) != 1 {
+		t.Errorf("expected the shared repository once, got %+v", repos)
+	}
+	if got := manager.GetReleases()[1].Values[0]; got != filepath.Join(helmfiles, "web.yaml") {
+		t.Errorf("expected values relative to their helmfile, got %v", got)
+	}
+	want := []string{filepath.Join(helmfiles, "10-infra.yaml"), filepath.Join(helmfiles, "20-apps.yaml"), extra}
+	if strings.Join(manager.Files, ",") != strings.Join(want, ",") {
+		t.Errorf("unexpected files %v", manager.Files)
+	}
+	if stats := manager.LastLoad; stats.Files != 3 || stats.Releases != 3 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	// Unchanged files are reused on reload
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if manager.LastLoad.Reused != 3 {
+		t.Errorf("expected every file to be reused, got %+v", manager.LastLoad)
+	}
+}
+
+func TestLoadMergeConflicts(t *testing.T) {
+	tests := []struct {
+		name    string
+		second  string
+		wantErr string
+	}{
+		{
+			name:    "duplicate release",
+			second:  "releases:\n  - name: web\n    chart: ./other\n",
+			wantErr: "release web is defined in both",
+		},
+		{
+			name:    "conflicting repository",
+			second:  "repositories:\n  - name: stable\n    url: https://example.com/other\n",
+			wantErr: "repository stable is defined differently in",
+		},
+		{
+			name:    "conflicting phases",
+			second:  "phases: [apps]\n",
+			wantErr: "differ from the ones in",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			first := filepath.Join(dir, "a.yaml")
+			second := filepath.Join(dir, "b.yaml")
+			os.WriteFile(first, []byte("phases: [infra, apps]\nrepositories:\n  - name: stable\n    url: https://example.com/stable\nreleases:\n  - name: web\n    chart: ./web\n"), 0644)
+			os.WriteFile(second, []byte(tt.second), 0644)
+
+			err := NewManager(dir, "").Load()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestHelmfileFilesEmptyDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := HelmfileFiles([]string{dir}); err == nil || !strings.Contains(err.Error(), "no helmfiles") {
+		t.Errorf("expected error for a directory without helmfiles, got %v", err)
+	}
+}
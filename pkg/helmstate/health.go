@@ -0,0 +1,108 @@
+package helmstate
+
+import (
+	"fmt"
+	"time"
+)
+
+// Defaults of a health check
+const (
+	DefaultHealthTimeout  = time.Minute
+	DefaultHealthInterval = 5 * time.Second
+)
+
+// HealthCheck is a check a release must pass after helm synced it to count
+// as synced. Exactly one of HTTP, Exec and Condition is set. HTTP and Exec
+// checks are retried every Interval until they pass or Timeout runs out.
+type HealthCheck struct {
+	Name      string          `yaml:"name,omitempty"`
+	HTTP      *HTTPCheck      `yaml:"http,omitempty"`
+	Exec      *ExecCheck      `yaml:"exec,omitempty"`
+	Condition *ConditionCheck `yaml:"condition,omitempty"`
+	Timeout   time.Duration   `yaml:"timeout,omitempty"`  // DefaultHealthTimeout when 0
+	Interval  time.Duration   `yaml:"interval,omitempty"` // DefaultHealthInterval when 0
+}
+
+// HTTPCheck requests Path through a port-forward to Port of Resource, and
+// passes on Status, or any 2xx status when Status is 0
+type HTTPCheck struct {
+	Resource string `yaml:"resource,omitempty"` // default svc/<release>
+	Port     int    `yaml:"port"`
+	Path     string `yaml:"path,omitempty"` // default /
+	Status   int    `yaml:"status,omitempty"`
+}
+
+// ExecCheck runs Command in a container of Resource with kubectl exec, and
+// passes when it exits with 0
+type ExecCheck struct {
+	Resource  string   `yaml:"resource,omitempty"` // default deploy/<release>
+	Container string   `yaml:"container,omitempty"`
+	Command   []string `yaml:"command"`
+}
+
+// ConditionCheck waits with kubectl wait for Resource, such as
+// deployment/web, to have Condition, such as Available
+type ConditionCheck struct {
+	Resource  string `yaml:"resource"`
+	Condition string `yaml:"condition"`
+}
+
+// String names the check for messages: its Name, or what it checks
+func (c HealthCheck) String() string {
+	switch {
+	case c.Name != "":
+		return c.Name
+	case c.HTTP != nil:
+		return fmt.Sprintf("http %s:%d%s", c.HTTP.Resource, c.HTTP.Port, c.HTTP.Path)
+	case c.Exec != nil:
+		return fmt.Sprintf("exec in %s", c.Exec.Resource)
+	case c.Condition != nil:
+		return fmt.Sprintf("condition %s of %s", c.Condition.Condition, c.Condition.Resource)
+	}
+	return "health check"
+}
+
+// Resolved returns the check with the defaults filled in for release
+func (c HealthCheck) Resolved(release string) HealthCheck {
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultHealthTimeout
+	}
+	if c.Interval <= 0 {
+		c.Interval = DefaultHealthInterval
+	}
+	if c.HTTP != nil {
+		http := *c.HTTP
+		if http.Resource == "" {
+			http.Resource = "svc/" + release
+		}
+		if http.Path == "" {
+			http.Path = "/"
+		}
+		c.HTTP = &http
+	}
+	if c.Exec != nil && c.Exec.Resource == "" {
+		exec := *c.Exec
+		exec.Resource = "deploy/" + release
+		c.Exec = &exec
+	}
+	return c
+}
+
+// validateHealthChecks checks that each health check of each release has
+// exactly one kind
+func validateHealthChecks(spec *HelmfileSpec) error {
+	for _, release := range spec.Releases {
+		for i, check := range release.HealthChecks {
+			kinds := 0
+			for _, set := range []bool{check.HTTP != nil, check.Exec != nil, check.Condition != nil} {
+				if set {
+					kinds++
+				}
+			}
+			if kinds != 1 {
+				return fmt.Errorf("release %s: healthChecks[%d] must set exactly one of http, exec and condition", release.Name, i)
+			}
+		}
+	}
+	return nil
+}
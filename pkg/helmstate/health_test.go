@@ -0,0 +1,58 @@
+package helmstate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthChecks(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "helmfile.yaml")
+	content := `releases:
+  - name: web
+    chart: ./web
+    healthChecks:
+      - http:
+          port: 8080
+          path: /healthz
+        timeout: 2m
+      - name: database
+        exec:
+          command: [pg_isready]
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	manager := NewManager(path, "")
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	checks := manager.GetReleases()[0].HealthChecks
+	if len(checks) != 2 || checks[0].Timeout != 2*time.Minute {
+		t.Fatalf("unexpected health checks %+v", checks)
+	}
+
+	http := checks[0].Resolved("web")
+	if http.HTTP.Resource != "svc/web" || http.Interval != DefaultHealthInterval || http.String() != "http svc/web:8080/healthz" {
+		t.Errorf("unexpected resolved check %+v", http)
+	}
+	if checks[0].HTTP.Resource != "" {
+		t.Error("expected the helmfile's check to be left alone")
+	}
+	exec := checks[1].Resolved("web")
+	if exec.Exec.Resource != "deploy/web" || exec.Timeout != DefaultHealthTimeout || exec.String() != "database" {
+		t.Errorf("unexpected resolved check %+v", exec)
+	}
+
+	// Each check is of one kind
+	content = strings.Replace(content, "      - name: database\n", "      - name: database\n        condition: {resource: deployment/web, condition: Available}\n", 1)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Load(); err == nil || !strings.Contains(err.Error(), "healthChecks[1] must set exactly one of http, exec and condition") {
+		t.Errorf("expected a check of two kinds rejected, got %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package helmstate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// LiveObject is the metadata of a resource as it is in the cluster
+type LiveObject struct {
+	Kind        string
+	Namespace   string
+	Name        string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// LiveObjects returns the metadata of the resources of a release's deployed
+// revision as they are in the cluster, leaving out those since deleted.
+// Unlike the stored manifest, it shows what other controllers added, such as
+// their tracking labels.
+func (m *Manager) LiveObjects(release Release) ([]LiveObject, error) {
+	manifest, err := m.StoredManifest(release)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(manifest) == "" {
+		return nil, nil
+	}
+
+	args := []string{"get", "--filename", "-", "--ignore-not-found", "--output", "json",
+		"--namespace", releaseNamespace(release)}
+	if release.KubeContext != "" {
+		args = append(args, "--context", release.KubeContext)
+	}
+	cmd := exec.Command("kubectl", args...)
+	cmd.Stdin = strings.NewReader(manifest)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("kubectl get failed: %w (stderr: %s)", err, stderr.String())
+	}
+	return parseLiveObjects(stdout.Bytes())
+}
+
+// liveObject is the part of a resource or List kubectl prints that
+// LiveObjects reads
+type liveObject struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Namespace   string            `json:"namespace"`
+		Name        string            `json:"name"`
+		Labels      map[string]string `json:"labels"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+	Items []liveObject `json:"items"`
+}
+
+// parseLiveObjects parses the output of kubectl get -o json: a List, a
+// single resource, several of them in a row, or nothing
+func parseLiveObjects(data []byte) ([]LiveObject, error) {
+	var objects []LiveObject
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for decoder.More() {
+		var obj liveObject
+		if err := decoder.Decode(&obj); err != nil {
+			return nil, fmt.Errorf("invalid kubectl output: %w", err)
+		}
+		items := []liveObject{obj}
+		if strings.HasSuffix(obj.Kind, "List") {
+			items = obj.Items
+		}
+		for _, item := range items {
+			objects = append(objects, LiveObject{
+				Kind:        item.Kind,
+				Namespace:   item.Metadata.Namespace,
+				Name:        item.Metadata.Name,
+				Labels:      item.Metadata.Labels,
+				Annotations: item.Metadata.Annotations,
+			})
+		}
+	}
+	return objects, nil
+}
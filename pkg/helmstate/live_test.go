@@ -0,0 +1,37 @@
+package helmstate
+
+import (
+	"testing"
+)
+
+func TestParseLiveObjects(t *testing.T) {
+	list := `{
+  "apiVersion": "v1",
+  "kind": "List",
+  "items": [
+    {"kind": "Deployment", "metadata": {"name": "web", "namespace": "apps", "labels": {"app": "web"}}},
+    {"kind": "Service", "metadata": {"name": "web", "namespace": "apps", "annotations": {"argocd.argoproj.io/tracking-id": "web:/Service:apps/web"}}}
+  ]
+}`
+	objects, err := parseLiveObjects([]byte(list))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 || objects[0].Kind != "Deployment" || objects[0].Labels["app"] != "web" ||
+		objects[1].Annotations["argocd.argoproj.io/tracking-id"] != "web:/Service:apps/web" {
+		t.Errorf("unexpected objects %+v", objects)
+	}
+
+	// One resource, or none found
+	objects, err = parseLiveObjects([]byte(`{"kind": "ConfigMap", "metadata": {"name": "settings"}}`))
+	if err != nil || len(objects) != 1 || objects[0].Name != "settings" {
+		t.Errorf("unexpected objects %+v (err %v)", objects, err)
+	}
+	if objects, err := parseLiveObjects(nil); err != nil || len(objects) != 0 {
+		t.Errorf("expected no objects, got %+v (err %v)", objects, err)
+	}
+
+	if _, err := parseLiveObjects([]byte("error: not json")); err == nil {
+		t.Error("expected an error for invalid output")
+	}
+}
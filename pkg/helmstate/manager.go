@@ -2,19 +2,135 @@ package helmstate
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/oleksiyp/helmfire/pkg/rendercache"
 	"gopkg.in/yaml.v3"
 )
 
-// Manager manages helmfile state
+// Manager manages helmfile state. Load may run while other goroutines read
+// the releases: each load builds a new spec, never modifying the one before,
+// and swaps it in with the fields describing the load under the manager's
+// lock. Goroutines other than the loading one read them through Snapshot
+// and the Get methods.
 type Manager struct {
-	FilePath    string
+	// FilePath is the helmfile, or a directory of helmfiles, to load
+	FilePath string
+
+	// ExtraPaths are more helmfiles or directories of them, merged after
+	// FilePath in order
+	ExtraPaths []string
+
+	// Files are the helmfiles the most recent Load read, in merge order
+	Files []string
+
+	// Bases are the bases the helmfiles in Files were layered over
+	Bases []string
+
+	// Missing are the values files the most recent Load skipped because
+	// they don't exist and their missingFileHandler allows it
+	Missing []MissingFile
+
 	Environment string
+	HelmBinary  string
 	Spec        *HelmfileSpec
+
+	// Namespace and KubeContext, the --namespace and --kube-context flags,
+	// override those of every release when set
+	Namespace   string
+	KubeContext string
+
+	// NamespaceTemplate, the --namespace-template flag, rewrites the
+	// namespace of every release once resolved when set, given
+	// {{ .Namespace }}, {{ .Release }} and {{ .Environment }}
+	NamespaceTemplate string
+
+	// ReleasePrefix, the --release-prefix flag, is prepended to the name of
+	// every release when set, so copies of a helmfile can share a namespace
+	ReleasePrefix string
+
+	// DiffContext is how many unchanged lines DiffRelease shows around
+	// changes; whole resources when 0
+	DiffContext int
+
+	// OfflineCharts, when set, is the directory remote charts are taken
+	// from instead of their repositories; see OfflineChart
+	OfflineCharts string
+
+	// RenderCache keeps the manifests RenderManifest renders, shared with
+	// whatever else renders the same releases; nil renders every time
+	RenderCache *rendercache.Cache
+
+	// Strict rejects helmfiles with unknown fields or values of the wrong
+	// type instead of ignoring them
+	Strict bool
+
+	// LastLoad describes the most recent successful Load
+	LastLoad LoadStats
+
+	// mu guards Spec, Files, Bases, Missing, LastLoad and generation, which
+	// Load replaces together
+	mu         sync.RWMutex
+	generation uint64
+
+	// loadMu serializes loads, which share the parse cache
+	loadMu sync.Mutex
+
+	// parsed caches the spec parsed from each file by content hash, so
+	// reloading an unchanged helmfile skips parsing and validation
+	parsed map[string]parsedFile
+
+	// sweep caches the charts pulled during a drift sweep
+	sweepMu sync.Mutex
+	sweep   *chartCache
+
+	overlays overlays
+}
+
+// Snapshot is the state of a manager as of one Load. Its spec is never
+// modified, so it can be read while the manager loads again.
+type Snapshot struct {
+	// Generation counts the successful loads of the manager, so readers can
+	// tell specs apart; 0 before the first
+	Generation uint64
+
+	Spec    *HelmfileSpec
+	Files   []string
+	Missing []MissingFile
+	Stats   LoadStats
+}
+
+// LoadStats describes a Load
+type LoadStats struct {
+	Duration time.Duration
+	Releases int
+	Files    int // read
+	Reused   int // of Files, unchanged since the previous Load
+}
+
+// parsedFile is a file's spec as of the content with hash and of its bases,
+// with the overrides of environment applied
+type parsedFile struct {
+	hash        [sha256.Size]byte
+	strict      bool
+	environment string
+	targets     target // the manager's Namespace and KubeContext
+	nsTemplate  string // the manager's NamespaceTemplate
+	prefix      string // the manager's ReleasePrefix
+	bases       []baseFile
+	values      []baseFile // environment values files the templates saw
+	missing     []MissingFile
+	spec        *HelmfileSpec
 }
 
 // NewManager creates a new helmstate manager
@@ -22,55 +138,304 @@ func NewManager(filePath, environment string) *Manager {
 	return &Manager{
 		FilePath:    filePath,
 		Environment: environment,
+		HelmBinary:  "helm",
 	}
 }
 
-// Load loads and parses the helmfile
+// Load loads and parses the helmfiles and merges them, applying the release
+// overrides of the manager's environment. Reloading a helmfile whose content
+// did not change reuses the spec parsed before.
 func (m *Manager) Load() error {
+	m.loadMu.Lock()
+	defer m.loadMu.Unlock()
+
+	start := time.Now()
 	absPath, err := filepath.Abs(m.FilePath)
 	if err != nil {
 		return fmt.Errorf("failed to resolve path: %w", err)
 	}
 
-	data, err := os.ReadFile(absPath)
+	files, err := HelmfileFiles(append([]string{absPath}, m.ExtraPaths...))
 	if err != nil {
-		return fmt.Errorf("failed to read helmfile: %w", err)
+		return err
 	}
 
-	spec := &HelmfileSpec{}
-	if err := yaml.Unmarshal(data, spec); err != nil {
-		return fmt.Errorf("failed to parse helmfile: %w", err)
+	stats := LoadStats{Files: len(files)}
+	specs := make([]*HelmfileSpec, len(files))
+	for i, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read helmfile: %w", err)
+		}
+		spec, reused, err := m.parse(file, data)
+		if err != nil {
+			return err
+		}
+		specs[i] = spec
+		if reused {
+			stats.Reused++
+		}
+	}
+	m.forgetRemoved(files)
+
+	spec := specs[0]
+	if len(specs) > 1 {
+		if spec, err = mergeSpecs(files, specs); err != nil {
+			return err
+		}
+	}
+	if err := validatePhases(spec); err != nil {
+		return err
+	}
+	if err := validateHealthChecks(spec); err != nil {
+		return err
+	}
+	if err := validateTests(spec); err != nil {
+		return err
+	}
+	spec, missing, err := skipMissingFiles(spec)
+	if err != nil {
+		return err
 	}
 
+	var bases []string
+	var allMissing []MissingFile
+	for _, file := range files {
+		allMissing = append(allMissing, m.parsed[file].missing...)
+		for _, base := range m.parsed[file].bases {
+			if !contains(bases, base.path) {
+				bases = append(bases, base.path)
+			}
+		}
+	}
+	allMissing = append(allMissing, missing...)
+	stats.Duration = time.Since(start)
+	stats.Releases = len(spec.Releases)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.Spec = spec
-	m.FilePath = absPath
+	// Set only when it changes, so reading the path doesn't race reloads
+	if m.FilePath != absPath {
+		m.FilePath = absPath
+	}
+	m.Files = files
+	m.Bases = bases
+	m.Missing = allMissing
+	m.LastLoad = stats
+	m.generation++
 	return nil
 }
 
-// GetReleases returns all releases
+// LoadPaths loads the helmfiles at filePath and extraPaths in place of the
+// current ones, keeping the current ones when they fail to load
+func (m *Manager) LoadPaths(filePath string, extraPaths []string) error {
+	m.loadMu.Lock()
+	previous, previousExtra := m.FilePath, m.ExtraPaths
+	m.FilePath, m.ExtraPaths = filePath, extraPaths
+	m.loadMu.Unlock()
+
+	err := m.Load()
+	if err != nil {
+		m.loadMu.Lock()
+		m.FilePath, m.ExtraPaths = previous, previousExtra
+		m.loadMu.Unlock()
+	}
+	return err
+}
+
+// Snapshot returns the state of the most recent Load
+func (m *Manager) Snapshot() Snapshot {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return Snapshot{
+		Generation: m.generation,
+		Spec:       m.Spec,
+		Files:      m.Files,
+		Missing:    m.Missing,
+		Stats:      m.LastLoad,
+	}
+}
+
+// Generation returns the number of successful loads so far
+func (m *Manager) Generation() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.generation
+}
+
+// spec returns the current spec, nil before the first Load
+func (m *Manager) spec() *HelmfileSpec {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.Spec
+}
+
+// forgetRemoved drops the parsed specs of files no longer loaded
+func (m *Manager) forgetRemoved(files []string) {
+	for path := range m.parsed {
+		if !contains(files, path) {
+			delete(m.parsed, path)
+		}
+	}
+}
+
+// parse parses the helmfile at path with content data, reusing the spec
+// parsed from it before when neither data nor its bases changed
+func (m *Manager) parse(path string, data []byte) (spec *HelmfileSpec, reused bool, err error) {
+	hash := sha256.Sum256(data)
+	if cached, ok := m.parsed[path]; ok && cached.hash == hash && cached.strict == m.Strict &&
+		cached.environment == m.Environment && cached.targets == m.overrides() &&
+		cached.nsTemplate == m.NamespaceTemplate && cached.prefix == m.ReleasePrefix &&
+		basesUnchanged(cached.bases) && basesUnchanged(cached.values) {
+		return cached.spec, true, nil
+	}
+
+	spec, err = m.decode(path, data)
+	if err != nil {
+		return nil, false, err
+	}
+	bases, err := m.layerBases(path, spec, []string{path})
+	if err != nil {
+		return nil, false, err
+	}
+	applyHelmDefaults(spec)
+
+	// Environment values are only read for the templates and conditions
+	// that use them
+	var values map[string]interface{}
+	var valuesFiles []baseFile
+	var missing []MissingFile
+	if usesEnvironmentValues(spec) {
+		if values, valuesFiles, missing, err = environmentValues(spec, m.Environment); err != nil {
+			return nil, false, err
+		}
+	}
+	if err := applyEnvironment(spec, m.Environment, values, m.Strict); err != nil {
+		return nil, false, err
+	}
+	resolveTargets(spec, m.Environment, m.overrides())
+	if err := rewriteNamespaces(spec, m.Environment, m.NamespaceTemplate); err != nil {
+		return nil, false, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := prefixReleases(spec, m.ReleasePrefix); err != nil {
+		return nil, false, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if m.parsed == nil {
+		m.parsed = make(map[string]parsedFile)
+	}
+	m.parsed[path] = parsedFile{hash: hash, strict: m.Strict, environment: m.Environment, targets: m.overrides(),
+		nsTemplate: m.NamespaceTemplate, prefix: m.ReleasePrefix, bases: bases, values: valuesFiles, missing: missing, spec: spec}
+	return spec, false, nil
+}
+
+// decode parses a helmfile or base, validating it first in strict mode, and
+// gives its releases the fields of the templates they inherit
+func (m *Manager) decode(path string, data []byte) (*HelmfileSpec, error) {
+	spec := &HelmfileSpec{}
+	if m.Strict {
+		if problems := Validate(data); len(problems) > 0 {
+			return nil, &ValidationError{File: path, Problems: problems}
+		}
+	}
+	data, err := expandTemplates(path, data)
+	if err != nil {
+		return nil, err
+	}
+	if m.Strict {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(spec); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to parse helmfile: %w", err)
+		}
+	} else if err := yaml.Unmarshal(data, spec); err != nil {
+		return nil, fmt.Errorf("failed to parse helmfile: %w", err)
+	}
+
+	resolveValuesPaths(spec, filepath.Dir(path))
+	return spec, nil
+}
+
+// resolveValuesPaths makes relative values file, file sync and build context
+// paths relative to the helmfile directory rather than the working directory
+func resolveValuesPaths(spec *HelmfileSpec, dir string) {
+	for name, env := range spec.Environments {
+		for j, val := range env.Values {
+			if path, ok := val.(string); ok && !filepath.IsAbs(path) {
+				env.Values[j] = filepath.Join(dir, path)
+			}
+		}
+		spec.Environments[name] = env
+	}
+	for i := range spec.Releases {
+		for j, val := range spec.Releases[i].Values {
+			if path, ok := val.(string); ok && !filepath.IsAbs(path) {
+				spec.Releases[i].Values[j] = filepath.Join(dir, path)
+			}
+		}
+		for name, override := range spec.Releases[i].Environments {
+			for j, val := range override.Values {
+				if path, ok := val.(string); ok && !filepath.IsAbs(path) {
+					override.Values[j] = filepath.Join(dir, path)
+				}
+			}
+			spec.Releases[i].Environments[name] = override
+		}
+		for j, fileSync := range spec.Releases[i].Sync {
+			if fileSync.Src != "" && !filepath.IsAbs(fileSync.Src) {
+				spec.Releases[i].Sync[j].Src = filepath.Join(dir, fileSync.Src)
+			}
+		}
+		if dev := spec.Releases[i].Dev; dev != nil {
+			for j, build := range dev.Build {
+				if build.Context != "" && !filepath.IsAbs(build.Context) {
+					dev.Build[j].Context = filepath.Join(dir, build.Context)
+				}
+			}
+		}
+	}
+}
+
+// GetReleases returns all releases, with their value overlays applied. The
+// slice is the caller's: a reload doesn't change it and changing it doesn't
+// change the spec.
 func (m *Manager) GetReleases() []Release {
-	if m.Spec == nil {
+	spec := m.spec()
+	if spec == nil {
 		return nil
 	}
-	return m.Spec.Releases
+	return m.withOverlays(append([]Release(nil), spec.Releases...))
+}
+
+// GetNamespace returns the declaration of a namespace in the helmfile
+func (m *Manager) GetNamespace(name string) (Namespace, bool) {
+	spec := m.spec()
+	if spec == nil {
+		return Namespace{}, false
+	}
+	ns, ok := spec.Namespaces[name]
+	return ns, ok
 }
 
 // GetRepositories returns all repositories
 func (m *Manager) GetRepositories() []Repository {
-	if m.Spec == nil {
+	spec := m.spec()
+	if spec == nil {
 		return nil
 	}
-	return m.Spec.Repositories
+	return append([]Repository(nil), spec.Repositories...)
 }
 
 // FilterReleases filters releases by selector
 func (m *Manager) FilterReleases(selector map[string]string) []Release {
-	if m.Spec == nil || len(selector) == 0 {
+	if len(selector) == 0 {
 		return m.GetReleases()
 	}
 
 	var filtered []Release
-	for _, release := range m.Spec.Releases {
+	for _, release := range m.GetReleases() {
 		matches := true
 		for key, value := range selector {
 			if release.Labels[key] != value {
@@ -85,6 +450,14 @@ func (m *Manager) FilterReleases(selector map[string]string) []Release {
 	return filtered
 }
 
+// helmBinary returns the configured helm binary, defaulting to helm on PATH
+func (m *Manager) helmBinary() string {
+	if m.HelmBinary == "" {
+		return "helm"
+	}
+	return m.HelmBinary
+}
+
 // IsReleaseInstalled checks if a release should be installed
 func (m *Manager) IsReleaseInstalled(release Release) bool {
 	if release.Installed == nil {
@@ -93,38 +466,167 @@ func (m *Manager) IsReleaseInstalled(release Release) bool {
 	return *release.Installed
 }
 
-// DiffRelease runs helm diff for a release to detect drift
-func (m *Manager) DiffRelease(release Release) (string, error) {
-	namespace := release.Namespace
-	if namespace == "" {
-		namespace = "default"
+// releaseNamespace returns the namespace a release is deployed to
+func releaseNamespace(release Release) string {
+	if release.Namespace == "" {
+		return "default"
 	}
+	return release.Namespace
+}
 
-	// Build helm diff command
-	args := []string{
-		"diff",
-		"upgrade",
-		release.Name,
-		release.Chart,
-		"--namespace", namespace,
-		"--allow-unreleased",
+// targetArgs returns the helm flags selecting the namespace and kubeconfig
+// context of a release
+func targetArgs(release Release) []string {
+	args := []string{"--namespace", releaseNamespace(release)}
+	if release.KubeContext != "" {
+		args = append(args, "--kube-context", release.KubeContext)
 	}
+	return args
+}
 
-	// Add values files
-	for _, valuesFile := range release.Values {
-		if strVal, ok := valuesFile.(string); ok {
-			args = append(args, "--values", strVal)
+// ReleaseExists checks whether a release is deployed in the cluster
+func (m *Manager) ReleaseExists(release Release) (bool, error) {
+	cmd := exec.Command(m.helmBinary(), append([]string{"status", release.Name}, targetArgs(release)...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if strings.Contains(stderr.String(), "not found") {
+			return false, nil
 		}
+		return false, fmt.Errorf("helm status failed: %w (stderr: %s)", err, stderr.String())
 	}
 
-	// Execute helm diff
-	cmd := exec.Command("helm", args...)
+	return true, nil
+}
+
+// ListClusterReleases lists the releases deployed in a namespace of the
+// manager's kubeconfig context
+func (m *Manager) ListClusterReleases(namespace string) ([]DeployedRelease, error) {
+	return m.listClusterReleases(m.KubeContext, namespace)
+}
+
+// listClusterReleases lists the releases deployed in a namespace of a
+// kubeconfig context, the current one when empty
+func (m *Manager) listClusterReleases(kubeContext, namespace string) ([]DeployedRelease, error) {
+	args := []string{"list", "--namespace", namespace, "--output", "json"}
+	if kubeContext != "" {
+		args = append(args, "--kube-context", kubeContext)
+	}
+	cmd := exec.Command(m.helmBinary(), args...)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	err := cmd.Run()
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("helm list failed: %w (stderr: %s)", err, stderr.String())
+	}
+
+	var releases []DeployedRelease
+	if err := json.Unmarshal(stdout.Bytes(), &releases); err != nil {
+		return nil, fmt.Errorf("failed to parse helm list output: %w", err)
+	}
+	for i := range releases {
+		releases[i].KubeContext = kubeContext
+	}
+
+	return releases, nil
+}
+
+// ReleaseTarget is a namespace of a kubeconfig context releases are
+// deployed to
+type ReleaseTarget struct {
+	KubeContext string // the current one when empty
+	Namespace   string
+}
+
+// ReleaseTargets returns the distinct namespaces releases are deployed to,
+// with the kubeconfig context each release resolved to
+func (m *Manager) ReleaseTargets() []ReleaseTarget {
+	seen := make(map[ReleaseTarget]bool)
+	var targets []ReleaseTarget
+	for _, release := range m.GetReleases() {
+		target := ReleaseTarget{KubeContext: release.KubeContext, Namespace: releaseNamespace(release)}
+		if !seen[target] {
+			seen[target] = true
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// TargetNamespaces returns the distinct namespaces releases are deployed
+// to, in any kubeconfig context
+func (m *Manager) TargetNamespaces() []string {
+	seen := make(map[string]bool)
+	var namespaces []string
+	for _, target := range m.ReleaseTargets() {
+		if !seen[target.Namespace] {
+			seen[target.Namespace] = true
+			namespaces = append(namespaces, target.Namespace)
+		}
+	}
+	return namespaces
+}
+
+// FindOrphans returns releases deployed in the target namespaces that are not
+// defined in the helmfile, each listed in the kubeconfig context the
+// helmfile's releases of its namespace resolved to, and with a
+// ReleasePrefix only releases named with it.
+func (m *Manager) FindOrphans() ([]DeployedRelease, error) {
+	defined := make(map[ReleaseTarget]map[string]bool)
+	for _, release := range m.GetReleases() {
+		target := ReleaseTarget{KubeContext: release.KubeContext, Namespace: releaseNamespace(release)}
+		if defined[target] == nil {
+			defined[target] = make(map[string]bool)
+		}
+		defined[target][release.Name] = true
+	}
+
+	var orphans []DeployedRelease
+	for _, target := range m.ReleaseTargets() {
+		deployed, err := m.listClusterReleases(target.KubeContext, target.Namespace)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list releases in namespace %s: %w", target.Namespace, err)
+		}
+
+		for _, release := range deployed {
+			if release.Namespace == "" {
+				release.Namespace = target.Namespace
+			}
+			names := defined[ReleaseTarget{KubeContext: target.KubeContext, Namespace: release.Namespace}]
+			if !names[release.Name] && ownsRelease(release.Name, m.ReleasePrefix) {
+				orphans = append(orphans, release)
+			}
+		}
+	}
+
+	return orphans, nil
+}
+
+// DiffRelease runs helm diff for a release to detect drift
+func (m *Manager) DiffRelease(release Release) (string, error) {
+	// Build helm diff command
+	chart, err := m.SweepChart(release)
 	if err != nil {
+		return "", err
+	}
+	args := append([]string{"diff", "upgrade", release.Name, chart}, targetArgs(release)...)
+	args = append(args, "--allow-unreleased")
+	if m.DiffContext > 0 {
+		args = append(args, "--context", strconv.Itoa(m.DiffContext))
+	}
+
+	// Add values files
+	args = append(args, valuesArgs(release)...)
+
+	// Execute helm diff
+	cmd := exec.Command(m.helmBinary(), args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
 		// Exit code 2 means there are differences (which is what we want to detect)
 		// Exit code 0 means no differences
 		// Other exit codes are actual errors
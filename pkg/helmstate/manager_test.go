@@ -3,6 +3,8 @@ package helmstate
 import (
 	"os"
 	"path/filepath"
+	"runtime"
+	"sync"
 	"testing"
 )
 
@@ -41,6 +43,9 @@ releases:
     set:
       - name: replicaCount
         value: "3"
+    sync:
+      - src: src
+        dest: /app
 `
 
 	if err := os.WriteFile(helmfilePath, []byte(helmfileContent), 0644); err != nil {
@@ -76,6 +81,14 @@ releases:
 	if releases[0].Chart != "bitnami/nginx" {
 		t.Errorf("expected chart bitnami/nginx, got %s", releases[0].Chart)
 	}
+
+	// Values files resolve relative to the helmfile, not the working directory
+	if values := releases[0].Values; len(values) != 1 || values[0] != filepath.Join(tmpDir, "values.yaml") {
+		t.Errorf("expected values path relative to helmfile, got %v", values)
+	}
+	if sync := releases[0].Sync; len(sync) != 1 || sync[0].Src != filepath.Join(tmpDir, "src") || sync[0].Dest != "/app" {
+		t.Errorf("expected file sync source relative to helmfile, got %+v", sync)
+	}
 }
 
 func TestLoadNonexistentFile(t *testing.T) {
@@ -241,6 +254,265 @@ func TestGetRepositoriesWithNilSpec(t *testing.T) {
 	}
 }
 
+func TestReleaseExists(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	// Fake helm that only knows about the "nginx" release
+	helm := filepath.Join(t.TempDir(), "helm")
+	script := `#!/bin/sh
+if [ "$2" = "nginx" ]; then
+  echo "STATUS: deployed"
+  exit 0
+fi
+echo "Error: release: not found" >&2
+exit 1
+`
+	if err := os.WriteFile(helm, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake helm: %v", err)
+	}
+
+	manager := NewManager("", "")
+	manager.HelmBinary = helm
+
+	exists, err := manager.ReleaseExists(Release{Name: "nginx"})
+	if err != nil {
+		t.Fatalf("ReleaseExists failed: %v", err)
+	}
+	if !exists {
+		t.Error("expected nginx to exist")
+	}
+
+	exists, err = manager.ReleaseExists(Release{Name: "postgres"})
+	if err != nil {
+		t.Fatalf("ReleaseExists failed: %v", err)
+	}
+	if exists {
+		t.Error("expected postgres to be missing")
+	}
+}
+
+func TestFindOrphans(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	tmpDir := t.TempDir()
+	helm := filepath.Join(tmpDir, "helm")
+	script := `#!/bin/sh
+case "$3" in
+  web) echo '[{"name":"nginx","namespace":"web","status":"deployed"},{"name":"old-nginx","namespace":"web","status":"deployed"}]' ;;
+  *) echo '[]' ;;
+esac
+`
+	if err := os.WriteFile(helm, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake helm: %v", err)
+	}
+
+	helmfilePath := filepath.Join(tmpDir, "helmfile.yaml")
+	helmfileContent := `
+releases:
+  - name: nginx
+    namespace: web
+    chart: bitnami/nginx
+  - name: redis
+    chart: bitnami/redis
+`
+	if err := os.WriteFile(helmfilePath, []byte(helmfileContent), 0644); err != nil {
+		t.Fatalf("failed to write test helmfile: %v", err)
+	}
+
+	manager := NewManager(helmfilePath, "")
+	manager.HelmBinary = helm
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+
+	namespaces := manager.TargetNamespaces()
+	if len(namespaces) != 2 || namespaces[0] != "web" || namespaces[1] != "default" {
+		t.Errorf("unexpected target namespaces: %v", namespaces)
+	}
+
+	orphans, err := manager.FindOrphans()
+	if err != nil {
+		t.Fatalf("FindOrphans failed: %v", err)
+	}
+	if len(orphans) != 1 || orphans[0].Name != "old-nginx" {
+		t.Errorf("expected old-nginx orphan, got %+v", orphans)
+	}
+}
+
+func TestFindOrphansHelmDefaultsContext(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	tmpDir := t.TempDir()
+	helm := filepath.Join(tmpDir, "helm")
+	script := `#!/bin/sh
+case "$*" in
+  *"--namespace web"*"--kube-context staging"*) echo '[{"name":"nginx","namespace":"web","status":"deployed"},{"name":"old-nginx","namespace":"web","status":"deployed"}]' ;;
+  *"--namespace jobs"*"--kube-context batch"*) echo '[{"name":"cron","namespace":"jobs","status":"deployed"}]' ;;
+  *) echo '[]' ;;
+esac
+`
+	if err := os.WriteFile(helm, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake helm: %v", err)
+	}
+
+	helmfilePath := filepath.Join(tmpDir, "helmfile.yaml")
+	helmfileContent := `
+helmDefaults:
+  kubeContext: staging
+releases:
+  - name: nginx
+    namespace: web
+    chart: bitnami/nginx
+  - name: cron
+    namespace: jobs
+    kubeContext: batch
+    chart: ./charts/cron
+`
+	if err := os.WriteFile(helmfilePath, []byte(helmfileContent), 0644); err != nil {
+		t.Fatalf("failed to write test helmfile: %v", err)
+	}
+
+	manager := NewManager(helmfilePath, "")
+	manager.HelmBinary = helm
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+
+	targets := manager.ReleaseTargets()
+	want := []ReleaseTarget{{KubeContext: "staging", Namespace: "web"}, {KubeContext: "batch", Namespace: "jobs"}}
+	if len(targets) != len(want) || targets[0] != want[0] || targets[1] != want[1] {
+		t.Errorf("expected targets %v, got %v", want, targets)
+	}
+
+	orphans, err := manager.FindOrphans()
+	if err != nil {
+		t.Fatalf("FindOrphans failed: %v", err)
+	}
+	if len(orphans) != 1 || orphans[0].Name != "old-nginx" || orphans[0].KubeContext != "staging" {
+		t.Errorf("expected old-nginx orphan in staging, got %+v", orphans)
+	}
+}
+
+func TestReloadReusesUnchangedSpec(t *testing.T) {
+	helmfilePath := filepath.Join(t.TempDir(), "helmfile.yaml")
+	write := func(content string) {
+		if err := os.WriteFile(helmfilePath, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write test helmfile: %v", err)
+		}
+	}
+	write("releases:\n  - name: nginx\n    chart: bitnami/nginx\n")
+
+	manager := NewManager(helmfilePath, "")
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	first := manager.Spec
+	if stats := manager.LastLoad; stats.Files != 1 || stats.Reused != 0 || stats.Releases != 1 {
+		t.Errorf("unexpected stats of first load: %+v", stats)
+	}
+
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if manager.Spec != first || manager.LastLoad.Reused != 1 {
+		t.Errorf("expected unchanged helmfile to reuse its spec, stats %+v", manager.LastLoad)
+	}
+
+	// Strict parsing is not skipped for a spec parsed leniently
+	manager.Strict = true
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if manager.Spec == first || manager.LastLoad.Reused != 0 {
+		t.Error("expected strict load to parse again")
+	}
+
+	write("releases:\n  - name: nginx\n    chart: bitnami/nginx\n  - name: redis\n    chart: bitnami/redis\n")
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if len(manager.GetReleases()) != 2 || manager.LastLoad.Reused != 0 {
+		t.Errorf("expected changed helmfile to be parsed again, stats %+v", manager.LastLoad)
+	}
+
+	// A failed load keeps the last good spec
+	write("releases: [")
+	if err := manager.Load(); err == nil {
+		t.Fatal("expected invalid helmfile to fail")
+	}
+	if len(manager.GetReleases()) != 2 {
+		t.Error("expected the last good spec to be kept")
+	}
+}
+
+func TestLoadSwapsSnapshots(t *testing.T) {
+	helmfilePath := filepath.Join(t.TempDir(), "helmfile.yaml")
+	write := func(content string) {
+		if err := os.WriteFile(helmfilePath, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write test helmfile: %v", err)
+		}
+	}
+	write("releases:\n  - name: nginx\n    chart: bitnami/nginx\n")
+
+	manager := NewManager(helmfilePath, "")
+	if manager.Generation() != 0 {
+		t.Errorf("expected generation 0 before loading, got %d", manager.Generation())
+	}
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	before := manager.Snapshot()
+	releases := manager.GetReleases()
+	releases[0].Name = "changed"
+	if before.Generation != 1 || manager.GetReleases()[0].Name != "nginx" {
+		t.Errorf("expected generation 1 and releases unchanged by callers, got %d", before.Generation)
+	}
+
+	// Readers keep iterating over the releases while the helmfile reloads
+	write("releases:\n  - name: nginx\n    chart: bitnami/nginx\n  - name: redis\n    chart: bitnami/redis\n")
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				for _, release := range manager.GetReleases() {
+					_ = manager.IsReleaseInstalled(release)
+				}
+				manager.GetPhases()
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		if err := manager.Load(); err != nil {
+			t.Errorf("Load() failed: %v", err)
+		}
+	}
+	wg.Wait()
+
+	after := manager.Snapshot()
+	if after.Generation != 11 || len(after.Spec.Releases) != 2 {
+		t.Errorf("expected generation 11 with 2 releases, got %d with %d", after.Generation, len(after.Spec.Releases))
+	}
+	if len(before.Spec.Releases) != 1 {
+		t.Error("expected the earlier snapshot to be left as it was")
+	}
+
+	// A failed load keeps the generation and the helmfile paths
+	if err := manager.LoadPaths(filepath.Join(filepath.Dir(helmfilePath), "missing.yaml"), nil); err == nil {
+		t.Fatal("expected a missing helmfile to fail")
+	}
+	if manager.Generation() != 11 || manager.FilePath != helmfilePath {
+		t.Errorf("expected a failed load to keep generation and paths, got %d, %s", manager.Generation(), manager.FilePath)
+	}
+}
+
 // Helper function to create bool pointer
 func boolPtr(b bool) *bool {
 	return &b
@@ -0,0 +1,149 @@
+package helmstate
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Missing file handlers, as with helmfile's missingFileHandler: Error fails
+// the load, the others skip the file and report it at their log level
+const (
+	MissingFileError = "Error"
+	MissingFileWarn  = "Warn"
+	MissingFileInfo  = "Info"
+	MissingFileDebug = "Debug"
+)
+
+// MissingFile is a values file that doesn't exist and was skipped
+type MissingFile struct {
+	Release string // empty for environment values
+	Path    string
+	Handler string // Warn, Info or Debug
+}
+
+// checkMissingHandler rejects an unknown missingFileHandler
+func checkMissingHandler(handler string) error {
+	switch handler {
+	case "", MissingFileError, MissingFileWarn, MissingFileInfo, MissingFileDebug:
+		return nil
+	}
+	return fmt.Errorf("unknown missingFileHandler %q (want Error, Warn, Info or Debug)", handler)
+}
+
+// skipMissingFiles returns spec without the release values files that don't
+// exist, and the files skipped. Releases without a missingFileHandler are
+// left to helm, which fails on the missing file when syncing them. spec
+// itself is left as is, since it may be cached and the files may appear
+// later.
+func skipMissingFiles(spec *HelmfileSpec) (*HelmfileSpec, []MissingFile, error) {
+	var missing []MissingFile
+	var releases []Release
+	for i, release := range spec.Releases {
+		if err := checkMissingHandler(release.MissingFileHandler); err != nil {
+			return nil, nil, fmt.Errorf("release %s: %w", release.Name, err)
+		}
+		if release.MissingFileHandler == "" {
+			continue
+		}
+
+		var values []interface{}
+		skipped := false
+		for _, val := range release.Values {
+			path, ok := val.(string)
+			if !ok || fileExists(path) {
+				values = append(values, val)
+				continue
+			}
+			if release.MissingFileHandler == MissingFileError {
+				return nil, nil, fmt.Errorf("release %s: values file %s does not exist", release.Name, path)
+			}
+			missing = append(missing, MissingFile{Release: release.Name, Path: path, Handler: release.MissingFileHandler})
+			skipped = true
+		}
+		if !skipped {
+			continue
+		}
+
+		if releases == nil {
+			releases = append([]Release(nil), spec.Releases...)
+		}
+		release.Values = values
+		releases[i] = release
+	}
+
+	if releases == nil {
+		return spec, missing, nil
+	}
+	skipped := *spec
+	skipped.Releases = releases
+	return &skipped, missing, nil
+}
+
+// environmentValues merges the values of environment for the helmfile's
+// templates, and returns the values files read. Missing files are handled
+// as helmDefaults' missingFileHandler says.
+func environmentValues(spec *HelmfileSpec, environment string) (map[string]interface{}, []baseFile, []MissingFile, error) {
+	handler := ""
+	if spec.HelmDefaults != nil {
+		handler = spec.HelmDefaults.MissingFileHandler
+	}
+	if err := checkMissingHandler(handler); err != nil {
+		return nil, nil, nil, fmt.Errorf("helmDefaults: %w", err)
+	}
+
+	values := make(map[string]interface{})
+	var read []baseFile
+	var missing []MissingFile
+	for _, val := range spec.Environments[environment].Values {
+		layer, ok := val.(map[string]interface{})
+		if path, isPath := val.(string); isPath {
+			data, err := os.ReadFile(path)
+			if os.IsNotExist(err) && handler != "" && handler != MissingFileError {
+				// Recorded so that the helmfile is parsed again when it appears
+				read = append(read, baseFile{path: path})
+				missing = append(missing, MissingFile{Path: path, Handler: handler})
+				continue
+			}
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("environment %s: failed to read values file: %w", environment, err)
+			}
+			read = append(read, baseFile{path: path, hash: sha256.Sum256(data)})
+			layer = nil
+			if err := yaml.Unmarshal(data, &layer); err != nil {
+				return nil, nil, nil, fmt.Errorf("environment %s: failed to parse values file %s: %w", environment, path, err)
+			}
+			ok = true
+		}
+		if ok {
+			mergeValues(values, layer)
+		}
+	}
+	return values, read, missing, nil
+}
+
+// mergeValues merges src into dst, recursing into maps as helm does. Maps
+// of src are copied, so merging later layers leaves src as is.
+func mergeValues(dst, src map[string]interface{}) {
+	for key, val := range src {
+		srcMap, srcIsMap := val.(map[string]interface{})
+		if !srcIsMap {
+			dst[key] = val
+			continue
+		}
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+		if !dstIsMap {
+			dstMap = make(map[string]interface{})
+			dst[key] = dstMap
+		}
+		mergeValues(dstMap, srcMap)
+	}
+}
+
+// fileExists reports whether path exists
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,124 @@
+package helmstate
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadMissingFileHandler(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "helmfile.yaml")
+	if err := os.WriteFile(filepath.Join(dir, "values.yaml"), []byte("replicaCount: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	helmfile := `helmDefaults:
+  missingFileHandler: Warn
+releases:
+  - name: web
+    chart: ./web
+    values: [values.yaml, secrets.yaml]
+  - name: api
+    chart: ./api
+    values: [secrets.yaml]
+    missingFileHandler: Info
+  - name: legacy
+    chart: ./legacy
+    values: [secrets.yaml]
+    missingFileHandler: %s
+`
+	write := func(handler string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(strings.Replace(helmfile, "%s", handler, 1)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("Debug")
+	manager := NewManager(path, "")
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	secrets := filepath.Join(dir, "secrets.yaml")
+	want := []MissingFile{
+		{Release: "web", Path: secrets, Handler: MissingFileWarn},
+		{Release: "api", Path: secrets, Handler: MissingFileInfo},
+		{Release: "legacy", Path: secrets, Handler: MissingFileDebug},
+	}
+	if !reflect.DeepEqual(manager.Missing, want) {
+		t.Errorf("unexpected missing files %+v", manager.Missing)
+	}
+	if values := manager.GetReleases()[0].Values; !reflect.DeepEqual(values, []interface{}{filepath.Join(dir, "values.yaml")}) {
+		t.Errorf("expected the missing file skipped, got %v", values)
+	}
+
+	// The file is picked up once it exists, though the helmfile is unchanged
+	if err := os.WriteFile(secrets, []byte("password: x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if len(manager.Missing) != 0 || len(manager.GetReleases()[0].Values) != 2 {
+		t.Errorf("expected the new file to be used, got %+v", manager.GetReleases()[0])
+	}
+	os.Remove(secrets)
+
+	write("Error")
+	err := NewManager(path, "").Load()
+	if err == nil || !strings.Contains(err.Error(), "release legacy: values file") {
+		t.Errorf("expected a missing file error, got %v", err)
+	}
+
+	write("Ignore")
+	err = NewManager(path, "").Load()
+	if err == nil || !strings.Contains(err.Error(), `unknown missingFileHandler "Ignore"`) {
+		t.Errorf("expected an unknown handler error, got %v", err)
+	}
+}
+
+func TestLoadTemplateValues(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "helmfile.yaml")
+	files := map[string]string{
+		"helmfile.yaml": `environments:
+  dev:
+    values:
+      - dev.yaml
+      - debug:
+          enabled: true
+releases:
+  - name: debug-tools
+    chart: ./debug
+    installedTemplate: '{{ .Values.debug.enabled }}'
+  - name: tracing
+    chart: ./tracing
+    installedTemplate: '{{ .Values.tracing | not | not }}'
+`,
+		"dev.yaml": "debug:\n  enabled: false\n  level: 2\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manager := NewManager(path, "dev")
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	releases := manager.GetReleases()
+	if releases[0].Installed == nil || !*releases[0].Installed {
+		t.Error("expected the later inline values to win")
+	}
+	if releases[1].Installed == nil || *releases[1].Installed {
+		t.Error("expected a missing key to render empty")
+	}
+
+	manager.Strict = true
+	if err := manager.Load(); err == nil || !strings.Contains(err.Error(), "tracing") {
+		t.Errorf("expected a missing key error in strict mode, got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package helmstate
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+)
+
+// ChartNotCachedError is returned in offline mode for a remote chart
+// missing from the offline chart directory
+type ChartNotCachedError struct {
+	Chart   string
+	Version string
+	Dir     string
+}
+
+func (e *ChartNotCachedError) Error() string {
+	what := e.Chart
+	if e.Version != "" {
+		what += " " + e.Version
+	}
+	return fmt.Sprintf("chart %s is not in the offline chart directory %s; run helmfire mirror while online to download it", what, e.Dir)
+}
+
+// OfflineChart returns the archive of a remote chart in the offline chart
+// directory dir, where helm pull --destination dir leaves it:
+// <name>-<version>.tgz, named after the last element of the chart. An exact
+// version must be cached as is; otherwise the highest cached version
+// satisfying the constraint, or the highest of all without one, is used.
+// Charts missing are reported as a *ChartNotCachedError.
+func OfflineChart(dir, chart, version string) (string, error) {
+	name := path.Base(strings.TrimPrefix(chart, "oci://"))
+	notCached := &ChartNotCachedError{Chart: chart, Version: version, Dir: dir}
+
+	if substitute.IsVersion(version) {
+		archive := filepath.Join(dir, name+"-"+strings.TrimPrefix(version, "v")+".tgz")
+		if _, err := os.Stat(archive); err != nil {
+			return "", notCached
+		}
+		return archive, nil
+	}
+
+	archives, err := filepath.Glob(filepath.Join(dir, name+"-*.tgz"))
+	if err != nil {
+		return "", err
+	}
+	best, bestVersion := "", ""
+	for _, archive := range archives {
+		v := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(archive), name+"-"), ".tgz")
+		// Skips charts whose names extend this one, such as nginx-ingress
+		if !substitute.IsVersion(v) {
+			continue
+		}
+		// Like helm, only a constraint selects prereleases
+		if version == "" && strings.Contains(v, "-") {
+			continue
+		}
+		if version != "" {
+			if ok, err := substitute.SatisfiesConstraint(v, version); err != nil {
+				return "", fmt.Errorf("chart %s: %w", chart, err)
+			} else if !ok {
+				continue
+			}
+		}
+		if cmp, _ := substitute.CompareVersions(v, bestVersion); best == "" || cmp > 0 {
+			best, bestVersion = archive, v
+		}
+	}
+	if best == "" {
+		return "", notCached
+	}
+	return best, nil
+}
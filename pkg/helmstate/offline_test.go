@@ -0,0 +1,63 @@
+package helmstate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOfflineChart(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"nginx-15.4.2.tgz", "nginx-15.5.0.tgz", "nginx-16.0.0-rc.1.tgz", "nginx-ingress-20.0.0.tgz", "redis-18.0.4.tgz"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		chart, version, want string
+	}{
+		{"bitnami/nginx", "15.4.2", "nginx-15.4.2.tgz"},
+		{"bitnami/nginx", "v15.4.2", "nginx-15.4.2.tgz"},
+		{"bitnami/nginx", "~15.4", "nginx-15.4.2.tgz"},
+		{"bitnami/nginx", ">=15.0.0", "nginx-16.0.0-rc.1.tgz"},
+		{"bitnami/nginx", "", "nginx-15.5.0.tgz"}, // neither the prerelease nor nginx-ingress
+		{"oci://registry.example.com/charts/redis", "18.0.4", "redis-18.0.4.tgz"},
+	}
+	for _, tt := range tests {
+		got, err := OfflineChart(dir, tt.chart, tt.version)
+		if err != nil {
+			t.Errorf("OfflineChart(%s, %q) failed: %v", tt.chart, tt.version, err)
+			continue
+		}
+		if filepath.Base(got) != tt.want {
+			t.Errorf("OfflineChart(%s, %q) = %s, want %s", tt.chart, tt.version, filepath.Base(got), tt.want)
+		}
+	}
+
+	for _, missing := range []struct{ chart, version string }{
+		{"bitnami/nginx", "15.4.3"},
+		{"bitnami/nginx", "~14"},
+		{"bitnami/postgresql", ""},
+	} {
+		_, err := OfflineChart(dir, missing.chart, missing.version)
+		var notCached *ChartNotCachedError
+		if !errors.As(err, &notCached) {
+			t.Errorf("OfflineChart(%s, %q) error = %v, want ChartNotCachedError", missing.chart, missing.version, err)
+		}
+	}
+}
+
+func TestRenderManifestOffline(t *testing.T) {
+	dir := t.TempDir()
+	manager := NewManager("", "")
+	manager.OfflineCharts = dir
+	manager.HelmBinary = filepath.Join(dir, "missing-helm")
+
+	_, err := manager.RenderManifest(Release{Name: "web", Namespace: "web", Chart: "bitnami/nginx", Version: "15.4.2"})
+	want := "chart bitnami/nginx 15.4.2 is not in the offline chart directory " + dir + "; run helmfire mirror while online to download it"
+	if err == nil || err.Error() != want {
+		t.Errorf("RenderManifest() error = %v, want %q", err, want)
+	}
+}
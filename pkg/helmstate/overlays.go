@@ -0,0 +1,112 @@
+package helmstate
+
+import (
+	"sort"
+	"sync"
+)
+
+// overlays holds temporary --set values per release, added on top of the
+// helmfile's own values until they are cleared
+type overlays struct {
+	mu     sync.Mutex
+	values map[string]map[string]string
+}
+
+// SetOverlay merges values, as --set name=value pairs, into the overlay of
+// a release. GetReleases adds the overlay after the release's own set
+// entries, so it takes precedence until ClearOverlay; it outlives reloads
+// of the helmfile.
+func (m *Manager) SetOverlay(release string, values map[string]string) {
+	m.overlays.mu.Lock()
+	defer m.overlays.mu.Unlock()
+
+	if m.overlays.values == nil {
+		m.overlays.values = make(map[string]map[string]string)
+	}
+	overlay := m.overlays.values[release]
+	if overlay == nil {
+		overlay = make(map[string]string, len(values))
+		m.overlays.values[release] = overlay
+	}
+	for name, value := range values {
+		overlay[name] = value
+	}
+}
+
+// ClearOverlay removes the overlay of a release, reporting whether it had
+// one
+func (m *Manager) ClearOverlay(release string) bool {
+	m.overlays.mu.Lock()
+	defer m.overlays.mu.Unlock()
+
+	_, ok := m.overlays.values[release]
+	delete(m.overlays.values, release)
+	return ok
+}
+
+// Overlay returns a copy of the overlay of a release, nil without one
+func (m *Manager) Overlay(release string) map[string]string {
+	m.overlays.mu.Lock()
+	defer m.overlays.mu.Unlock()
+
+	return copyOverlay(m.overlays.values[release])
+}
+
+// Overlays returns a copy of the overlays of every release
+func (m *Manager) Overlays() map[string]map[string]string {
+	m.overlays.mu.Lock()
+	defer m.overlays.mu.Unlock()
+
+	if len(m.overlays.values) == 0 {
+		return nil
+	}
+	all := make(map[string]map[string]string, len(m.overlays.values))
+	for release, overlay := range m.overlays.values {
+		all[release] = copyOverlay(overlay)
+	}
+	return all
+}
+
+// withOverlays returns releases with their overlays appended to Set, sorted
+// by name so helm gets the same arguments every time. releases is returned
+// as is when no release has an overlay.
+func (m *Manager) withOverlays(releases []Release) []Release {
+	m.overlays.mu.Lock()
+	defer m.overlays.mu.Unlock()
+
+	if len(m.overlays.values) == 0 {
+		return releases
+	}
+
+	result := make([]Release, len(releases))
+	for i, release := range releases {
+		overlay := m.overlays.values[release.Name]
+		if len(overlay) > 0 {
+			names := make([]string, 0, len(overlay))
+			for name := range overlay {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			set := make([]SetValue, len(release.Set), len(release.Set)+len(names))
+			copy(set, release.Set)
+			for _, name := range names {
+				set = append(set, SetValue{Name: name, Value: overlay[name]})
+			}
+			release.Set = set
+		}
+		result[i] = release
+	}
+	return result
+}
+
+func copyOverlay(overlay map[string]string) map[string]string {
+	if overlay == nil {
+		return nil
+	}
+	c := make(map[string]string, len(overlay))
+	for name, value := range overlay {
+		c[name] = value
+	}
+	return c
+}
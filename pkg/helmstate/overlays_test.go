@@ -0,0 +1,49 @@
+package helmstate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOverlaysAddSetValuesUntilCleared(t *testing.T) {
+	manager := NewManager("", "")
+	manager.Spec = &HelmfileSpec{Releases: []Release{
+		{Name: "web", Set: []SetValue{{Name: "replicas", Value: "2"}}},
+		{Name: "api"},
+	}}
+
+	manager.SetOverlay("web", map[string]string{"features.beta": "true", "replicas": "1"})
+	manager.SetOverlay("web", map[string]string{"features.beta": "false"})
+
+	releases := manager.GetReleases()
+	want := []SetValue{
+		{Name: "replicas", Value: "2"},
+		{Name: "features.beta", Value: "false"},
+		{Name: "replicas", Value: "1"},
+	}
+	if !reflect.DeepEqual(releases[0].Set, want) {
+		t.Errorf("expected overlay after the release's set entries, got %+v", releases[0].Set)
+	}
+	if len(releases[1].Set) != 0 {
+		t.Errorf("expected api without overlay to be unchanged, got %+v", releases[1].Set)
+	}
+	if len(manager.Spec.Releases[0].Set) != 1 {
+		t.Errorf("expected the loaded spec to be left alone, got %+v", manager.Spec.Releases[0].Set)
+	}
+
+	overlay := manager.Overlay("web")
+	overlay["replicas"] = "5"
+	if manager.Overlay("web")["replicas"] != "1" {
+		t.Error("expected Overlay to return a copy")
+	}
+
+	if !manager.ClearOverlay("web") {
+		t.Error("expected web to have had an overlay")
+	}
+	if manager.ClearOverlay("web") {
+		t.Error("expected the overlay to be gone")
+	}
+	if set := manager.GetReleases()[0].Set; len(set) != 1 {
+		t.Errorf("expected only the release's own set entries after clearing, got %+v", set)
+	}
+}
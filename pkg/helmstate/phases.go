@@ -0,0 +1,83 @@
+package helmstate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultPhases are the sync phases of a helmfile that declares none:
+// infrastructure such as CRDs and operators, then the apps using it
+var DefaultPhases = []string{"infra", "apps"}
+
+// Phase is a group of releases synced together. A phase starts once every
+// release of the phase before it is synced and ready.
+type Phase struct {
+	Name     string
+	Releases []Release
+}
+
+// GetPhases returns the names of the helmfile's sync phases in order
+func (m *Manager) GetPhases() []string {
+	spec := m.spec()
+	if spec == nil || len(spec.Phases) == 0 {
+		return DefaultPhases
+	}
+	return spec.Phases
+}
+
+// Phases groups releases by phase, in phase order and keeping the order of
+// releases within a phase. Phases without releases are left out. Releases
+// of every phase but the last are returned with Wait set, so helm waits for
+// them to be ready before the next phase starts.
+func (m *Manager) Phases(releases []Release) []Phase {
+	names := m.GetPhases()
+	byName := make(map[string][]Release, len(names))
+	for _, release := range releases {
+		name := releasePhase(release, names)
+		byName[name] = append(byName[name], release)
+	}
+
+	var phases []Phase
+	for _, name := range names {
+		if len(byName[name]) > 0 {
+			phases = append(phases, Phase{Name: name, Releases: byName[name]})
+		}
+	}
+	for i := 0; i < len(phases)-1; i++ {
+		for j := range phases[i].Releases {
+			phases[i].Releases[j].Wait = true
+		}
+	}
+	return phases
+}
+
+// releasePhase returns the phase of a release; releases without one are in
+// the last phase
+func releasePhase(release Release, phases []string) string {
+	if release.Phase == "" {
+		return phases[len(phases)-1]
+	}
+	return release.Phase
+}
+
+// validatePhases checks that every release's phase is declared
+func validatePhases(spec *HelmfileSpec) error {
+	phases := spec.Phases
+	if len(phases) == 0 {
+		phases = DefaultPhases
+	}
+
+	declared := make(map[string]bool, len(phases))
+	for _, name := range phases {
+		if declared[name] {
+			return fmt.Errorf("phase %s is declared twice", name)
+		}
+		declared[name] = true
+	}
+	for _, release := range spec.Releases {
+		if release.Phase != "" && !declared[release.Phase] {
+			return fmt.Errorf("release %s: unknown phase %q (phases: %s)", release.Name, release.Phase, strings.Join(phases, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package helmstate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPhases(t *testing.T) {
+	manager := NewManager("helmfile.yaml", "")
+	manager.Spec = &HelmfileSpec{Releases: []Release{
+		{Name: "web"},
+		{Name: "cert-manager", Phase: "infra"},
+		{Name: "api", Phase: "apps"},
+		{Name: "prometheus-operator", Phase: "infra"},
+	}}
+
+	phases := manager.Phases(manager.GetReleases())
+	if len(phases) != 2 || phases[0].Name != "infra" || phases[1].Name != "apps" {
+		t.Fatalf("unexpected phases %+v", phases)
+	}
+	if names := releaseNames(phases[0].Releases); names != "cert-manager,prometheus-operator" {
+		t.Errorf("unexpected infra releases %s", names)
+	}
+	if names := releaseNames(phases[1].Releases); names != "web,api" {
+		t.Errorf("unexpected apps releases %s", names)
+	}
+
+	// Only releases gating a later phase wait, and the spec is left alone
+	if !phases[0].Releases[0].Wait || phases[1].Releases[0].Wait {
+		t.Error("expected only infra releases to wait")
+	}
+	if manager.Spec.Releases[1].Wait {
+		t.Error("expected the spec to be unchanged")
+	}
+
+	// A single phase doesn't wait on anything
+	phases = manager.Phases(manager.GetReleases()[:1])
+	if len(phases) != 1 || phases[0].Releases[0].Wait {
+		t.Errorf("expected a single phase without waiting, got %+v", phases)
+	}
+}
+
+func TestLoadValidatesPhases(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name: "declared phases",
+			content: `phases: [crds, operators, apps]
+releases:
+  - name: operator
+    chart: ./operator
+    phase: operators
+`,
+		},
+		{
+			name: "unknown phase",
+			content: `releases:
+  - name: operator
+    chart: ./operator
+    phase: operators
+`,
+			wantErr: `release operator: unknown phase "operators" (phases: infra, apps)`,
+		},
+		{
+			name: "duplicate phase",
+			content: `phases: [infra, infra]
+releases: []
+`,
+			wantErr: "phase infra is declared twice",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "helmfile.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			err := NewManager(path, "").Load()
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("expected %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func releaseNames(releases []Release) string {
+	names := ""
+	for i, release := range releases {
+		if i > 0 {
+			names += ","
+		}
+		names += release.Name
+	}
+	return names
+}
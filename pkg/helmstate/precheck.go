@@ -0,0 +1,87 @@
+package helmstate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ManifestsMatch reports whether the manifest helm stored for a deployed
+// release hashes the same as the release rendered locally, in which case
+// DiffRelease would find nothing. It is much cheaper than a diff, as it
+// neither queries the cluster's resources nor compares them.
+func (m *Manager) ManifestsMatch(release Release) (bool, error) {
+	stored, err := m.StoredManifest(release)
+	if err != nil {
+		return false, err
+	}
+	rendered, err := m.RenderManifest(release)
+	if err != nil {
+		return false, err
+	}
+	return ManifestHash(stored) == ManifestHash(rendered), nil
+}
+
+// StoredManifest returns the manifest of the deployed revision of a release,
+// as kept in helm's release storage
+func (m *Manager) StoredManifest(release Release) (string, error) {
+	return m.helmOutput(append([]string{"get", "manifest", release.Name}, targetArgs(release)...)...)
+}
+
+// RenderManifest renders a release with helm template as an upgrade would,
+// without hooks and tests, which helm stores apart from the manifest
+func (m *Manager) RenderManifest(release Release) (string, error) {
+	chart, err := m.SweepChart(release)
+	if err != nil {
+		return "", err
+	}
+	args := append([]string{"template", release.Name, chart}, targetArgs(release)...)
+	args = append(args, "--is-upgrade", "--no-hooks", "--skip-tests")
+	args = append(args, valuesArgs(release)...)
+	key := m.RenderCache.Key(args[2], release.Version, args, nil)
+	return m.RenderCache.Render(key, func() (string, error) {
+		return m.helmOutput(args...)
+	})
+}
+
+// ManifestHash returns a checksum of YAML manifests that ignores blank
+// documents and whitespace around documents
+func ManifestHash(manifest string) string {
+	h := sha256.New()
+	for _, doc := range strings.Split(manifest, "\n---") {
+		doc = strings.TrimSpace(strings.TrimPrefix(doc, "---"))
+		if doc == "" {
+			continue
+		}
+		h.Write([]byte(doc))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// helmOutput runs helm and returns its output
+func (m *Manager) helmOutput(args ...string) (string, error) {
+	cmd := exec.Command(m.helmBinary(), args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("helm %s failed: %w (stderr: %s)", args[0], err, stderr.String())
+	}
+	return stdout.String(), nil
+}
+
+// valuesArgs returns the --values flags of a release's values files
+func valuesArgs(release Release) []string {
+	var args []string
+	for _, valuesFile := range release.Values {
+		if strVal, ok := valuesFile.(string); ok {
+			args = append(args, "--values", strVal)
+		}
+	}
+	return args
+}
@@ -0,0 +1,117 @@
+package helmstate
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/oleksiyp/helmfire/pkg/rendercache"
+)
+
+func TestManifestsMatch(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	// Fake helm storing one manifest and rendering the one in $RENDERED
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	helm := filepath.Join(dir, "helm")
+	script := `#!/bin/sh
+echo "$@" >> ` + log + `
+case "$1" in
+  get) printf -- '---\n# Source: web/templates/cm.yaml\nkind: ConfigMap\ndata:\n  a: "1"\n' ;;
+  template) printf -- "$RENDERED" ;;
+esac
+`
+	if err := os.WriteFile(helm, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewManager("", "")
+	manager.HelmBinary = helm
+	release := Release{Name: "web", Namespace: "prod", Chart: "./charts/web", Values: []interface{}{"values.yaml"}}
+
+	t.Setenv("RENDERED", "---\n# Source: web/templates/cm.yaml\nkind: ConfigMap\ndata:\n  a: \"1\"\n\n---\n")
+	match, err := manager.ManifestsMatch(release)
+	if err != nil || !match {
+		t.Fatalf("expected manifests differing in whitespace only to match, got %v, %v", match, err)
+	}
+
+	t.Setenv("RENDERED", "---\nkind: ConfigMap\ndata:\n  a: \"2\"\n")
+	if match, err := manager.ManifestsMatch(release); err != nil || match {
+		t.Errorf("expected changed manifests not to match, got %v, %v", match, err)
+	}
+
+	data, _ := os.ReadFile(log)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if lines[0] != "get manifest web --namespace prod" {
+		t.Errorf("unexpected helm get: %q", lines[0])
+	}
+	if lines[1] != "template web ./charts/web --namespace prod --is-upgrade --no-hooks --skip-tests --values values.yaml" {
+		t.Errorf("unexpected helm template: %q", lines[1])
+	}
+}
+
+func TestRenderManifestCached(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	// Fake helm rendering the values file it is given last
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	helm := filepath.Join(dir, "helm")
+	script := `#!/bin/sh
+echo "$@" >> ` + log + `
+for last; do :; done
+cat "$last"
+`
+	if err := os.WriteFile(helm, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	chart := filepath.Join(dir, "chart")
+	if err := os.MkdirAll(chart, 0755); err != nil {
+		t.Fatal(err)
+	}
+	values := filepath.Join(dir, "values.yaml")
+	if err := os.WriteFile(values, []byte("a: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewManager("", "")
+	manager.HelmBinary = helm
+	manager.RenderCache = rendercache.New(4)
+	release := Release{Name: "web", Namespace: "prod", Chart: chart, Values: []interface{}{values}}
+
+	render := func(want string) {
+		t.Helper()
+		manifest, err := manager.RenderManifest(release)
+		if err != nil || manifest != want {
+			t.Fatalf("RenderManifest() = %q, %v; want %q", manifest, err, want)
+		}
+	}
+	render("a: 1\n")
+	render("a: 1\n")
+	if err := os.WriteFile(values, []byte("a: 22\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	render("a: 22\n")
+
+	data, _ := os.ReadFile(log)
+	if renders := strings.Count(string(data), "template"); renders != 2 {
+		t.Errorf("helm template ran %d times, want 2: the unchanged release rendered once", renders)
+	}
+}
+
+func TestManifestHash(t *testing.T) {
+	a := ManifestHash("kind: A\n---\nkind: B\n")
+	if b := ManifestHash("---\nkind: A\n---\n\n---\nkind: B"); a != b {
+		t.Errorf("expected blank documents ignored")
+	}
+	if b := ManifestHash("kind: B\n---\nkind: A\n"); a == b {
+		t.Errorf("expected reordered documents to hash differently")
+	}
+}
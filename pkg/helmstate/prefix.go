@@ -0,0 +1,41 @@
+package helmstate
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// maxReleaseName is the longest release name helm accepts
+const maxReleaseName = 53
+
+// releasePrefix matches the prefixes release names may be given
+var releasePrefix = regexp.MustCompile(`^[a-z0-9][-a-z0-9.]*$`)
+
+// prefixReleases prepends prefix to the name of every release of spec, so
+// several copies of a helmfile can be synced to one namespace side by side.
+// Everything reading the manager's releases, from sync to drift detection
+// and status, sees the prefixed names.
+func prefixReleases(spec *HelmfileSpec, prefix string) error {
+	if prefix == "" {
+		return nil
+	}
+	if !releasePrefix.MatchString(prefix) {
+		return fmt.Errorf("invalid release prefix %q: must start with a lowercase letter or digit and contain only those, '-' and '.'", prefix)
+	}
+	for i := range spec.Releases {
+		release := &spec.Releases[i]
+		name := prefix + release.Name
+		if len(name) > maxReleaseName {
+			return fmt.Errorf("release %s: prefixed name %s is longer than %d characters", release.Name, name, maxReleaseName)
+		}
+		release.Name = name
+	}
+	return nil
+}
+
+// ownsRelease reports whether a deployed release may belong to a helmfile
+// loaded with prefix: releases of other copies are never its orphans
+func ownsRelease(name, prefix string) bool {
+	return strings.HasPrefix(name, prefix)
+}
@@ -0,0 +1,63 @@
+package helmstate
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestLoadPrefixesReleases(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	// Fake helm lists alice's and bob's copies of the stack side by side
+	tmpDir := t.TempDir()
+	helm := filepath.Join(tmpDir, "helm")
+	script := `#!/bin/sh
+echo '[{"name":"alice-web","namespace":"apps"},{"name":"alice-old","namespace":"apps"},{"name":"bob-web","namespace":"apps"}]'
+`
+	if err := os.WriteFile(helm, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake helm: %v", err)
+	}
+	helmfilePath := filepath.Join(tmpDir, "helmfile.yaml")
+	if err := os.WriteFile(helmfilePath, []byte("releases:\n  - name: web\n    namespace: apps\n    chart: ./web\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewManager(helmfilePath, "")
+	manager.HelmBinary = helm
+	manager.ReleasePrefix = "alice-"
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if releases := manager.GetReleases(); len(releases) != 1 || releases[0].Name != "alice-web" {
+		t.Fatalf("expected the release prefixed, got %+v", releases)
+	}
+
+	orphans, err := manager.FindOrphans()
+	if err != nil {
+		t.Fatalf("FindOrphans failed: %v", err)
+	}
+	if len(orphans) != 1 || orphans[0].Name != "alice-old" {
+		t.Errorf("expected only alice-old orphaned, got %+v", orphans)
+	}
+
+	// The cache follows the prefix
+	manager.ReleasePrefix = "bob-"
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if releases := manager.GetReleases(); releases[0].Name != "bob-web" {
+		t.Errorf("expected bob-web, got %s", releases[0].Name)
+	}
+
+	for _, prefix := range []string{"Alice-", "-alice", "alice_", strings.Repeat("a", 51)} {
+		manager.ReleasePrefix = prefix
+		if err := manager.Load(); err == nil {
+			t.Errorf("expected an error for release prefix %q", prefix)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package helmstate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/oleksiyp/helmfire/pkg/registryauth"
+	"gopkg.in/yaml.v3"
+)
+
+// chartDependencies is the subset of Chart.yaml naming where a chart's
+// dependencies come from
+type chartDependencies struct {
+	Dependencies []struct {
+		Repository string `yaml:"repository"`
+	} `yaml:"dependencies"`
+}
+
+// RepositoriesFor returns the repositories releases pull charts from: those
+// named by their charts, such as bitnami in bitnami/nginx, those the
+// dependencies of their local charts refer to by @name, alias:name or URL,
+// and the OCI registries of oci:// charts. Repositories no release uses
+// needn't be added, nor updated.
+func (m *Manager) RepositoriesFor(releases []Release) []Repository {
+	used := make(map[string]bool)
+	registries := make(map[string]bool)
+	var urls []string
+	for _, release := range releases {
+		if strings.HasPrefix(release.Chart, "oci://") {
+			registries[registryauth.Host(release.Chart)] = true
+			continue
+		}
+		if IsRemoteChart(release.Chart) {
+			name, _, _ := strings.Cut(release.Chart, "/")
+			used[name] = true
+			continue
+		}
+		for _, repository := range localChartRepositories(release.Chart) {
+			switch {
+			case strings.HasPrefix(repository, "@"):
+				used[strings.TrimPrefix(repository, "@")] = true
+			case strings.HasPrefix(repository, "alias:"):
+				used[strings.TrimPrefix(repository, "alias:")] = true
+			case strings.HasPrefix(repository, "oci://"):
+				registries[registryauth.Host(repository)] = true
+			default:
+				urls = append(urls, strings.TrimSuffix(repository, "/"))
+			}
+		}
+	}
+
+	var repos []Repository
+	for _, repo := range m.GetRepositories() {
+		if used[repo.Name] || contains(urls, strings.TrimSuffix(repo.URL, "/")) || (repo.OCI && registries[registryauth.Host(repo.URL)]) {
+			repos = append(repos, repo)
+		}
+	}
+	return repos
+}
+
+// localChartRepositories returns the repositories of the dependencies of a
+// chart directory; archives bundle theirs
+func localChartRepositories(chart string) []string {
+	data, err := os.ReadFile(filepath.Join(chart, "Chart.yaml"))
+	if err != nil {
+		return nil
+	}
+	var meta chartDependencies
+	if err := yaml.Unmarshal(data, &meta); err != nil {
+		return nil
+	}
+	var repositories []string
+	for _, dependency := range meta.Dependencies {
+		if dependency.Repository != "" && !strings.HasPrefix(dependency.Repository, "file://") {
+			repositories = append(repositories, dependency.Repository)
+		}
+	}
+	return repositories
+}
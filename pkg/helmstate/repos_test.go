@@ -0,0 +1,57 @@
+package helmstate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRepositoriesFor(t *testing.T) {
+	dir := t.TempDir()
+	chart := filepath.Join(dir, "app")
+	if err := os.MkdirAll(chart, 0755); err != nil {
+		t.Fatal(err)
+	}
+	chartYAML := `apiVersion: v2
+name: app
+version: 1.0.0
+dependencies:
+  - name: redis
+    repository: "@bitnami"
+  - name: common
+    repository: https://charts.example.com/stable/
+  - name: lib
+    repository: file://../lib
+`
+	if err := os.WriteFile(filepath.Join(chart, "Chart.yaml"), []byte(chartYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewManager("", "")
+	manager.Spec = &HelmfileSpec{Repositories: []Repository{
+		{Name: "bitnami", URL: "https://charts.bitnami.com/bitnami"},
+		{Name: "stable", URL: "https://charts.example.com/stable"},
+		{Name: "grafana", URL: "https://grafana.github.io/helm-charts"},
+		{Name: "ghcr", URL: "ghcr.io/acme/charts", OCI: true},
+		{Name: "unused", URL: "https://unused.example.com"},
+	}}
+
+	names := func(repos []Repository) string {
+		var names []string
+		for _, repo := range repos {
+			names = append(names, repo.Name)
+		}
+		return strings.Join(names, ",")
+	}
+
+	if got := names(manager.RepositoriesFor([]Release{{Name: "app", Chart: chart}})); got != "bitnami,stable" {
+		t.Errorf("expected the repositories of the local chart's dependencies, got %s", got)
+	}
+	if got := names(manager.RepositoriesFor([]Release{{Name: "grafana", Chart: "grafana/grafana"}, {Name: "oci", Chart: "oci://ghcr.io/acme/charts/web"}})); got != "grafana,ghcr" {
+		t.Errorf("expected the repository and registry of the charts, got %s", got)
+	}
+	if got := manager.RepositoriesFor(nil); len(got) != 0 {
+		t.Errorf("expected no repositories without releases, got %+v", got)
+	}
+}
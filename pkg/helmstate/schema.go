@@ -0,0 +1,370 @@
+package helmstate
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Schema is the JSON schema of the helmfile subset helmfire understands
+//
+//go:embed helmfile.schema.json
+var Schema []byte
+
+// Problem is a schema violation found in a helmfile
+type Problem struct {
+	File    string `json:"file,omitempty"` // empty from Validate, which sees only data
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	if p.Path == "" {
+		return fmt.Sprintf("%d:%d: %s", p.Line, p.Column, p.Message)
+	}
+	return fmt.Sprintf("%d:%d: %s: %s", p.Line, p.Column, p.Path, p.Message)
+}
+
+// ValidationError lists the problems that made a helmfile invalid
+type ValidationError struct {
+	File     string
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		lines[i] = e.File + ":" + p.String()
+	}
+	return fmt.Sprintf("invalid helmfile (%d problem(s)):\n  %s", len(e.Problems), strings.Join(lines, "\n  "))
+}
+
+// schema is the subset of JSON schema the validator supports
+type schema struct {
+	Type                 schemaTypes        `json:"type"`
+	Properties           map[string]*schema `json:"properties"`
+	AdditionalProperties *additional        `json:"additionalProperties"`
+	Required             []string           `json:"required"`
+	Items                *schema            `json:"items"`
+	Enum                 []string           `json:"enum"`
+	Minimum              *float64           `json:"minimum"`
+	Pattern              string             `json:"pattern"`
+	AllOf                []*schema          `json:"allOf"`
+	Ref                  string             `json:"$ref"` // #/definitions/<name>
+	Definitions          map[string]*schema `json:"definitions"`
+
+	pattern *regexp.Regexp
+	ref     *schema
+}
+
+// schemaTypes is a JSON schema type: a single name or a list of names
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*t = schemaTypes{name}
+		return nil
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return err
+	}
+	*t = names
+	return nil
+}
+
+// additional is additionalProperties: either false or a schema. It is
+// allowed when absent or true.
+type additional struct {
+	Forbidden bool
+	Schema    *schema
+}
+
+func (a *additional) UnmarshalJSON(data []byte) error {
+	var allowed bool
+	if err := json.Unmarshal(data, &allowed); err == nil {
+		a.Forbidden = !allowed
+		return nil
+	}
+	return json.Unmarshal(data, &a.Schema)
+}
+
+var rootSchema = mustParseSchema(Schema)
+
+func mustParseSchema(data []byte) *schema {
+	s := &schema{}
+	if err := json.Unmarshal(data, s); err != nil {
+		panic(fmt.Sprintf("invalid helmfile schema: %v", err))
+	}
+	s.compile(s)
+	return s
+}
+
+// compile compiles the patterns of s and its subschemas and resolves their
+// references to the definitions of root
+func (s *schema) compile(root *schema) {
+	if s == nil {
+		return
+	}
+	if s.Pattern != "" {
+		s.pattern = regexp.MustCompile(s.Pattern)
+	}
+	if s.Ref != "" {
+		name, ok := strings.CutPrefix(s.Ref, "#/definitions/")
+		if s.ref = root.Definitions[name]; !ok || s.ref == nil {
+			panic(fmt.Sprintf("invalid helmfile schema: unknown reference %s", s.Ref))
+		}
+	}
+	for _, def := range s.Definitions {
+		def.compile(root)
+	}
+	for _, prop := range s.Properties {
+		prop.compile(root)
+	}
+	if s.AdditionalProperties != nil {
+		s.AdditionalProperties.Schema.compile(root)
+	}
+	for _, sub := range s.AllOf {
+		sub.compile(root)
+	}
+	s.Items.compile(root)
+}
+
+var yamlErrorLine = regexp.MustCompile(`line (\d+): (.*)`)
+
+// Validate checks a helmfile against Schema, returning every problem with
+// the line and column it was found at. YAML syntax errors are reported as
+// problems too.
+func Validate(data []byte) []Problem {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return syntaxProblems(err)
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+
+	// Releases are checked with the fields they inherit from templates
+	root := doc.Content[0]
+	_, problems := inheritTemplates(root)
+	rootSchema.validate(root, "", &problems)
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].Line != problems[j].Line {
+			return problems[i].Line < problems[j].Line
+		}
+		return problems[i].Column < problems[j].Column
+	})
+
+	// A template's problems are found again in each release inheriting it
+	var unique []Problem
+	for _, p := range problems {
+		if n := len(unique); n > 0 && p.Line == unique[n-1].Line && p.Column == unique[n-1].Column && p.Message == unique[n-1].Message {
+			continue
+		}
+		unique = append(unique, p)
+	}
+	return unique
+}
+
+// syntaxProblems turns a YAML parse error into problems; the parser reports
+// lines but not columns
+func syntaxProblems(err error) []Problem {
+	var problems []Problem
+	for _, match := range yamlErrorLine.FindAllStringSubmatch(err.Error(), -1) {
+		line, _ := strconv.Atoi(match[1])
+		problems = append(problems, Problem{Line: line, Column: 1, Message: match[2]})
+	}
+	if len(problems) == 0 {
+		problems = append(problems, Problem{Line: 1, Column: 1, Message: strings.TrimPrefix(err.Error(), "yaml: ")})
+	}
+	return problems
+}
+
+func (s *schema) validate(node *yaml.Node, path string, problems *[]Problem) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if s.ref != nil {
+		s = s.ref
+	}
+	for _, sub := range s.AllOf {
+		sub.validate(node, path, problems)
+	}
+	report := func(n *yaml.Node, path, format string, args ...interface{}) {
+		*problems = append(*problems, Problem{
+			Line:    n.Line,
+			Column:  n.Column,
+			Path:    path,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	kind := nodeType(node)
+	if len(s.Type) > 0 && !s.allows(kind) {
+		report(node, path, "expected %s, got %s", strings.Join(s.Type, " or "), kind)
+		return
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		seen := make(map[string]bool)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Value == "<<" {
+				// Merged fields count as set
+				for _, merged := range mergedMappings(value) {
+					for j := 0; j < len(merged.Content); j += 2 {
+						seen[merged.Content[j].Value] = true
+					}
+				}
+				continue
+			}
+			seen[key.Value] = true
+			keyPath := joinPath(path, key.Value)
+			if prop, ok := s.Properties[key.Value]; ok {
+				prop.validate(value, keyPath, problems)
+				continue
+			}
+			switch {
+			case s.AdditionalProperties == nil:
+			case s.AdditionalProperties.Forbidden:
+				report(key, keyPath, "unknown field %q%s", key.Value, s.suggest(key.Value))
+			case s.AdditionalProperties.Schema != nil:
+				s.AdditionalProperties.Schema.validate(value, keyPath, problems)
+			}
+		}
+		for _, name := range s.Required {
+			if !seen[name] {
+				report(node, path, "missing required field %q", name)
+			}
+		}
+	case yaml.SequenceNode:
+		if s.Items != nil {
+			for i, item := range node.Content {
+				s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+	case yaml.ScalarNode:
+		if len(s.Enum) > 0 && !contains(s.Enum, node.Value) {
+			report(node, path, "must be one of %s, got %q", strings.Join(s.Enum, ", "), node.Value)
+		}
+		if s.Minimum != nil {
+			if n, err := strconv.ParseFloat(node.Value, 64); err == nil && n < *s.Minimum {
+				report(node, path, "must be at least %g, got %s", *s.Minimum, node.Value)
+			}
+		}
+		if s.pattern != nil && kind == "string" && !s.pattern.MatchString(node.Value) {
+			report(node, path, "invalid value %q", node.Value)
+		}
+	}
+}
+
+// mergedMappings returns the mappings a << merge key takes fields from
+func mergedMappings(node *yaml.Node) []*yaml.Node {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		return []*yaml.Node{node}
+	case yaml.SequenceNode:
+		var mappings []*yaml.Node
+		for _, item := range node.Content {
+			mappings = append(mappings, mergedMappings(item)...)
+		}
+		return mappings
+	}
+	return nil
+}
+
+// allows reports whether a node of the given type satisfies s.Type
+func (s *schema) allows(kind string) bool {
+	for _, t := range s.Type {
+		if t == kind || (t == "number" && kind == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// suggest returns a hint naming the known property closest to name
+func (s *schema) suggest(name string) string {
+	best, bestDistance := "", math.MaxInt
+	for prop := range s.Properties {
+		if d := editDistance(strings.ToLower(name), strings.ToLower(prop)); d < bestDistance || (d == bestDistance && prop < best) {
+			best, bestDistance = prop, d
+		}
+	}
+	if best == "" || bestDistance > 2 {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean %q?)", best)
+}
+
+// nodeType returns the JSON schema type of a YAML node
+func nodeType(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "object"
+	case yaml.SequenceNode:
+		return "array"
+	}
+	switch node.ShortTag() {
+	case "!!int":
+		return "integer"
+	case "!!float":
+		return "number"
+	case "!!bool":
+		return "boolean"
+	case "!!null":
+		return "null"
+	}
+	return "string"
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
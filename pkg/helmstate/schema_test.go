@@ -0,0 +1,176 @@
+package helmstate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		want []string
+	}{
+		{
+			name: "valid",
+			spec: `repositories:
+- name: bitnami
+  url: https://charts.bitnami.com/bitnami
+releases:
+- name: web
+  namespace: web
+  chart: bitnami/nginx
+  wait: true
+  timeout: 300
+  values:
+  - values.yaml
+  - replicaCount: 2
+  set:
+  - name: replicaCount
+    value: 3
+  createNamespace: false
+  drift:
+    interval: 1m30s
+  sync:
+  - src: ./src
+    dest: /app
+    container: web
+    selector: app=web
+  dev:
+    build:
+    - image: myorg/web:1.0
+      context: ./web
+      args:
+        VERSION: dev
+    portForward:
+    - ports: ["8080:80"]
+    logs: false
+namespaces:
+  web:
+    labels:
+      team: web
+    annotations:
+      owner: web-team
+environments:
+  dev:
+    values:
+    - dev.yaml
+`,
+		},
+		{
+			name: "empty",
+			spec: "",
+		},
+		{
+			name: "unknown field",
+			spec: `releases:
+- name: web
+  namspace: web
+  chart: bitnami/nginx
+`,
+			want: []string{`3:3: releases[0].namspace: unknown field "namspace" (did you mean "namespace"?)`},
+		},
+		{
+			name: "wrong types",
+			spec: `releases:
+- name: web
+  chart: bitnami/nginx
+  wait: "yes"
+  timeout: -1
+  values: values.yaml
+`,
+			want: []string{
+				"4:9: releases[0].wait: expected boolean, got string",
+				"5:12: releases[0].timeout: must be at least 0, got -1",
+				"6:11: releases[0].values: expected array, got string",
+			},
+		},
+		{
+			name: "missing required fields",
+			spec: `repositories:
+- name: bitnami
+releases:
+- namespace: web
+`,
+			want: []string{
+				`2:3: repositories[0]: missing required field "url"`,
+				`4:3: releases[0]: missing required field "name"`,
+				`4:3: releases[0]: missing required field "chart"`,
+			},
+		},
+		{
+			name: "invalid duration",
+			spec: `releases:
+- name: web
+  chart: bitnami/nginx
+  drift:
+    interval: 5 minutes
+`,
+			want: []string{`5:15: releases[0].drift.interval: invalid value "5 minutes"`},
+		},
+		{
+			name: "environment values",
+			spec: `environments:
+  dev:
+    vals: []
+  prod: []
+`,
+			want: []string{
+				`3:5: environments.dev.vals: unknown field "vals" (did you mean "values"?)`,
+				"4:9: environments.prod: expected object, got array",
+			},
+		},
+		{
+			name: "syntax error",
+			spec: "releases:\n- name: [\n",
+			want: []string{"2:1: did not find expected node content"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, p := range Validate([]byte(tt.spec)) {
+				got = append(got, p.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("expected problems:\n%s\ngot:\n%s", strings.Join(tt.want, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestLoadStrict(t *testing.T) {
+	helmfilePath := filepath.Join(t.TempDir(), "helmfile.yaml")
+	spec := `releases:
+- name: web
+  chart: bitnami/nginx
+  namspace: web
+`
+	if err := os.WriteFile(helmfilePath, []byte(spec), 0644); err != nil {
+		t.Fatalf("failed to write test helmfile: %v", err)
+	}
+
+	// Unknown fields are ignored by default
+	manager := NewManager(helmfilePath, "")
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+
+	manager = NewManager(helmfilePath, "")
+	manager.Strict = true
+	err := manager.Load()
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	if len(validationErr.Problems) != 1 || validationErr.Problems[0].Line != 4 {
+		t.Errorf("expected one problem on line 4, got %+v", validationErr.Problems)
+	}
+	if !strings.Contains(err.Error(), helmfilePath+":4:3:") {
+		t.Errorf("expected the error to name file, line and column, got %q", err)
+	}
+}
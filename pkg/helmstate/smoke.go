@@ -0,0 +1,60 @@
+package helmstate
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultTestTimeout is how long a smoke test may run when it sets no
+// timeout
+const DefaultTestTimeout = 5 * time.Minute
+
+// ReleaseTest is a smoke test run after the release synced and passed its
+// health checks. Exactly one of Helm and Job is set.
+type ReleaseTest struct {
+	Name    string        `yaml:"name,omitempty"`
+	Helm    *HelmTest     `yaml:"helm,omitempty"`
+	Job     *TestJob      `yaml:"job,omitempty"`
+	Timeout time.Duration `yaml:"timeout,omitempty"` // DefaultTestTimeout when 0
+}
+
+// HelmTest runs the chart's test hooks with helm test
+type HelmTest struct {
+	// Filter selects the tests run, as helm test --filter does, such as
+	// name=smoke or !name=slow
+	Filter []string `yaml:"filter,omitempty"`
+}
+
+// TestJob runs a container to completion as a Job in the release namespace,
+// passing when it exits with 0
+type TestJob struct {
+	Image   string            `yaml:"image"`
+	Command []string          `yaml:"command,omitempty"`
+	Args    []string          `yaml:"args,omitempty"`
+	Env     map[string]string `yaml:"env,omitempty"`
+}
+
+// String names the test for messages: its Name, or what it runs
+func (t ReleaseTest) String() string {
+	switch {
+	case t.Name != "":
+		return t.Name
+	case t.Helm != nil:
+		return "helm test"
+	case t.Job != nil:
+		return "job " + t.Job.Image
+	}
+	return "test"
+}
+
+// validateTests checks that each test of each release has exactly one kind
+func validateTests(spec *HelmfileSpec) error {
+	for _, release := range spec.Releases {
+		for i, test := range release.Tests {
+			if (test.Helm != nil) == (test.Job != nil) {
+				return fmt.Errorf("release %s: tests[%d] must set exactly one of helm and job", release.Name, i)
+			}
+		}
+	}
+	return nil
+}
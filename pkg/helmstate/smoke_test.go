@@ -0,0 +1,51 @@
+package helmstate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReleaseTests(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "helmfile.yaml")
+	content := `releases:
+  - name: web
+    chart: ./web
+    tests:
+      - helm:
+          filter: [name=web-test-connection]
+        timeout: 2m
+      - name: api
+        job:
+          image: curlimages/curl
+          args: [--fail, http://web/api]
+          env:
+            RETRIES: "3"
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	manager := NewManager(path, "")
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	tests := manager.GetReleases()[0].Tests
+	if len(tests) != 2 || tests[0].Timeout != 2*time.Minute || tests[0].String() != "helm test" {
+		t.Fatalf("unexpected tests %+v", tests)
+	}
+	if tests[1].String() != "api" || tests[1].Job.Image != "curlimages/curl" || tests[1].Job.Env["RETRIES"] != "3" {
+		t.Errorf("unexpected job test %+v", tests[1])
+	}
+
+	// Each test is of one kind
+	content = strings.Replace(content, "      - name: api\n", "      - name: api\n        helm: {}\n", 1)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Load(); err == nil || !strings.Contains(err.Error(), "tests[1] must set exactly one of helm and job") {
+		t.Errorf("expected a test of two kinds rejected, got %v", err)
+	}
+}
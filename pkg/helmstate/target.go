@@ -0,0 +1,103 @@
+package helmstate
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"text/template"
+)
+
+// target is where a release is synced: its namespace and kubeconfig context
+type target struct {
+	namespace   string
+	kubeContext string
+}
+
+// overrides returns the namespace and context that override every release's
+func (m *Manager) overrides() target {
+	return target{namespace: m.Namespace, kubeContext: m.KubeContext}
+}
+
+// resolveTargets sets the namespace and kubeconfig context of each release
+// of spec, from the first layer setting them among overrides, the release,
+// environment and helmDefaults. Executor, drift detector and diffs all read
+// the resolved values, so they agree on where a release lives.
+func resolveTargets(spec *HelmfileSpec, environment string, overrides target) {
+	layers := []target{overrides, {}}
+	if env, ok := spec.Environments[environment]; ok && environment != "" {
+		layers = append(layers, target{namespace: env.Namespace, kubeContext: env.KubeContext})
+	}
+	if defaults := spec.HelmDefaults; defaults != nil {
+		layers = append(layers, target{namespace: defaults.Namespace, kubeContext: defaults.KubeContext})
+	}
+
+	for i := range spec.Releases {
+		release := &spec.Releases[i]
+		layers[1] = target{namespace: release.Namespace, kubeContext: release.KubeContext}
+		release.Namespace, release.KubeContext = "", ""
+		for _, layer := range layers {
+			if release.Namespace == "" {
+				release.Namespace = layer.namespace
+			}
+			if release.KubeContext == "" {
+				release.KubeContext = layer.kubeContext
+			}
+		}
+	}
+}
+
+// NamespaceSuffixTemplate is the namespace template appending suffix to
+// every release's namespace, as --namespace-suffix does
+func NamespaceSuffixTemplate(suffix string) string {
+	return "{{ .Namespace }}-" + suffix
+}
+
+// dnsLabel matches the names namespaces may have
+var dnsLabel = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// namespaceData is what namespace templates are rendered with
+type namespaceData struct {
+	Namespace   string // resolved from the helmfile and flags
+	Release     string
+	Environment string
+}
+
+// rewriteNamespaces renders the namespace of each release of spec with the
+// template text, so several copies of a helmfile can be synced to one
+// cluster side by side. A declared namespace is declared for the namespaces
+// its releases are rewritten to instead, keeping its labels and annotations.
+func rewriteNamespaces(spec *HelmfileSpec, environment, text string) error {
+	if text == "" {
+		return nil
+	}
+	tmpl, err := template.New("namespace").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return fmt.Errorf("invalid namespace template: %w", err)
+	}
+
+	var renamed map[string]Namespace
+	for i := range spec.Releases {
+		release := &spec.Releases[i]
+		namespace := releaseNamespace(*release)
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, namespaceData{Namespace: namespace, Release: release.Name, Environment: environment}); err != nil {
+			return fmt.Errorf("failed to render namespace template of release %s: %w", release.Name, err)
+		}
+		name := out.String()
+		if len(name) > 63 || !dnsLabel.MatchString(name) {
+			return fmt.Errorf("namespace template rendered %q for release %s: must be a lowercase DNS label of at most 63 characters", name, release.Name)
+		}
+		release.Namespace = name
+
+		if declared, ok := spec.Namespaces[namespace]; ok {
+			if renamed == nil {
+				renamed = make(map[string]Namespace)
+			}
+			renamed[name] = declared
+		}
+	}
+	if spec.Namespaces != nil {
+		spec.Namespaces = renamed
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package helmstate
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const targetHelmfile = `helmDefaults:
+  namespace: apps
+  kubeContext: local
+
+environments:
+  dev: {}
+  prod:
+    kubeContext: prod-cluster
+
+releases:
+  - name: web
+    chart: ./web
+  - name: db
+    chart: ./db
+    namespace: data
+  - name: metrics
+    chart: ./metrics
+    kubeContext: monitoring
+`
+
+func TestLoadResolvesTargets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "helmfile.yaml")
+	if err := os.WriteFile(path, []byte(targetHelmfile), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		environment string
+		namespace   string // --namespace
+		kubeContext string // --kube-context
+		expected    map[string]string
+	}{
+		{name: "helmDefaults", environment: "dev",
+			expected: map[string]string{"web": "apps@local", "db": "data@local", "metrics": "apps@monitoring"}},
+		{name: "environment", environment: "prod",
+			expected: map[string]string{"web": "apps@prod-cluster", "db": "data@prod-cluster", "metrics": "apps@monitoring"}},
+		{name: "flags", environment: "prod", namespace: "ci", kubeContext: "kind",
+			expected: map[string]string{"web": "ci@kind", "db": "ci@kind", "metrics": "ci@kind"}},
+	}
+
+	manager := NewManager(path, "")
+	manager.Strict = true
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The same manager is reused to check the cache follows the flags
+			manager.Environment, manager.Namespace, manager.KubeContext = tt.environment, tt.namespace, tt.kubeContext
+			if err := manager.Load(); err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			for _, release := range manager.GetReleases() {
+				if got := release.Namespace + "@" + release.KubeContext; got != tt.expected[release.Name] {
+					t.Errorf("%s: expected %s, got %s", release.Name, tt.expected[release.Name], got)
+				}
+			}
+		})
+	}
+}
+
+func TestTargetArgs(t *testing.T) {
+	args := targetArgs(Release{Name: "web"})
+	if len(args) != 2 || args[1] != "default" {
+		t.Errorf("expected the default namespace and no context, got %v", args)
+	}
+	args = targetArgs(Release{Name: "web", Namespace: "apps", KubeContext: "prod"})
+	if len(args) != 4 || args[3] != "prod" {
+		t.Errorf("expected --kube-context prod, got %v", args)
+	}
+}
+
+func TestLoadRewritesNamespaces(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "helmfile.yaml")
+	content := targetHelmfile + `  - name: cache
+    chart: ./cache
+    namespace: ""
+
+namespaces:
+  data:
+    labels:
+      team: storage
+`
+	content = strings.Replace(content, "helmDefaults:\n  namespace: apps\n", "helmDefaults:\n", 1)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewManager(path, "dev")
+	manager.NamespaceTemplate = NamespaceSuffixTemplate("dev-alice")
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	expected := map[string]string{"web": "default-dev-alice", "db": "data-dev-alice", "metrics": "default-dev-alice", "cache": "default-dev-alice"}
+	for _, release := range manager.GetReleases() {
+		if release.Namespace != expected[release.Name] {
+			t.Errorf("%s: expected namespace %s, got %s", release.Name, expected[release.Name], release.Namespace)
+		}
+	}
+	if declared, ok := manager.GetNamespace("data-dev-alice"); !ok || declared.Labels["team"] != "storage" {
+		t.Errorf("expected the declared namespace renamed, got %+v, %v", declared, ok)
+	}
+
+	// The template sees --namespace, and the cache follows the template
+	manager.Namespace = "ci"
+	manager.NamespaceTemplate = "{{ .Release }}-{{ .Namespace }}"
+	if err := manager.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	for _, release := range manager.GetReleases() {
+		if release.Namespace != release.Name+"-ci" {
+			t.Errorf("%s: expected namespace %s-ci, got %s", release.Name, release.Name, release.Namespace)
+		}
+	}
+
+	for _, text := range []string{"{{ .Namespace", "{{ .Team }}", "{{ .Namespace }}_Alice"} {
+		manager.NamespaceTemplate = text
+		if err := manager.Load(); err == nil {
+			t.Errorf("expected an error for namespace template %q", text)
+		}
+	}
+}
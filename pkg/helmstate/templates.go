@@ -0,0 +1,154 @@
+package helmstate
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// expandTemplates gives each release of a helmfile that inherits templates
+// their fields, returning data unchanged when no release does. Releases
+// taking fields from YAML anchors with << need nothing more: the YAML
+// decoder merges them.
+func expandTemplates(path string, data []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		// Syntax errors are reported by the decoding that follows
+		return data, nil
+	}
+	expanded, problems := inheritTemplates(documentRoot(&doc))
+	if len(problems) > 0 {
+		return nil, &ValidationError{File: path, Problems: problems}
+	}
+	if !expanded {
+		return data, nil
+	}
+	out, err := yaml.Marshal(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand release templates: %w", err)
+	}
+	return out, nil
+}
+
+// inheritTemplates replaces the inherit field of each release under root
+// with the fields of the templates it names, in order, followed by the
+// release's own fields, which win. It reports whether any release inherits
+// and the problems with the inherit fields.
+func inheritTemplates(root *yaml.Node) (bool, []Problem) {
+	releases := resolveAlias(mappingValue(root, "releases"))
+	if releases == nil || releases.Kind != yaml.SequenceNode {
+		return false, nil
+	}
+	templates := resolveAlias(mappingValue(root, "templates"))
+
+	expanded := false
+	var problems []Problem
+	for i, release := range releases.Content {
+		release = resolveAlias(release)
+		inherit := mappingValue(release, "inherit")
+		if inherit == nil {
+			continue
+		}
+		expanded = true
+
+		fields, found := inheritedFields(templates, inherit, fmt.Sprintf("releases[%d].inherit", i))
+		problems = append(problems, found...)
+		for j := 0; j+1 < len(release.Content); j += 2 {
+			if key := release.Content[j]; key.Value != "inherit" {
+				fields = setField(fields, key, release.Content[j+1])
+			}
+		}
+		release.Content = fields
+	}
+	return expanded, problems
+}
+
+// inheritedFields returns the key and value nodes a release takes from the
+// templates listed in its inherit field
+func inheritedFields(templates, inherit *yaml.Node, path string) ([]*yaml.Node, []Problem) {
+	var problems []Problem
+	report := func(n *yaml.Node, path, format string, args ...interface{}) {
+		problems = append(problems, Problem{Line: n.Line, Column: n.Column, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	inherit = resolveAlias(inherit)
+	if inherit.Kind != yaml.SequenceNode {
+		report(inherit, path, "expected array, got %s", nodeType(inherit))
+		return nil, problems
+	}
+
+	var fields []*yaml.Node
+	for i, entry := range inherit.Content {
+		entryPath := fmt.Sprintf("%s[%d]", path, i)
+		entry = resolveAlias(entry)
+		if entry.Kind != yaml.MappingNode {
+			report(entry, entryPath, "expected object, got %s", nodeType(entry))
+			continue
+		}
+
+		var name *yaml.Node
+		except := make(map[string]bool)
+		for j := 0; j+1 < len(entry.Content); j += 2 {
+			key, value := entry.Content[j], resolveAlias(entry.Content[j+1])
+			switch key.Value {
+			case "template":
+				name = value
+			case "except":
+				if value.Kind != yaml.SequenceNode {
+					report(value, joinPath(entryPath, "except"), "expected array, got %s", nodeType(value))
+					continue
+				}
+				for _, field := range value.Content {
+					except[field.Value] = true
+				}
+			default:
+				report(key, joinPath(entryPath, key.Value), "unknown field %q", key.Value)
+			}
+		}
+		if name == nil || name.Kind != yaml.ScalarNode {
+			report(entry, entryPath, "missing required field %q", "template")
+			continue
+		}
+
+		template := resolveAlias(mappingValue(templates, name.Value))
+		switch {
+		case template == nil:
+			report(name, joinPath(entryPath, "template"), "unknown template %q", name.Value)
+			continue
+		case template.Kind != yaml.MappingNode:
+			report(template, "templates."+name.Value, "expected object, got %s", nodeType(template))
+			continue
+		case mappingValue(template, "inherit") != nil:
+			report(mappingKey(template, "inherit"), "templates."+name.Value+".inherit", "templates cannot inherit other templates")
+			continue
+		}
+		for j := 0; j+1 < len(template.Content); j += 2 {
+			if key := template.Content[j]; !except[key.Value] {
+				fields = setField(fields, key, template.Content[j+1])
+			}
+		}
+	}
+	return fields, problems
+}
+
+// setField sets key to value in the key and value nodes of a mapping,
+// replacing the value of the same key. Merge keys are kept side by side.
+func setField(fields []*yaml.Node, key, value *yaml.Node) []*yaml.Node {
+	if key.Value != "<<" {
+		for i := 0; i+1 < len(fields); i += 2 {
+			if fields[i].Value == key.Value {
+				fields[i+1] = value
+				return fields
+			}
+		}
+	}
+	return append(fields, key, value)
+}
+
+// resolveAlias returns the node an alias node refers to, or node itself
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	if node != nil && node.Kind == yaml.AliasNode {
+		return node.Alias
+	}
+	return node
+}
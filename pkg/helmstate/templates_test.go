@@ -0,0 +1,129 @@
+package helmstate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadReleaseTemplates(t *testing.T) {
+	dir := t.TempDir()
+	helmfilePath := filepath.Join(dir, "helmfile.yaml")
+	spec := `templates:
+  default: &default
+    namespace: apps
+    wait: true
+    timeout: 300
+    values:
+      - common.yaml
+  redis:
+    chart: bitnami/redis
+    version: 18.0.4
+
+releases:
+  - name: web
+    chart: bitnami/nginx
+    inherit:
+      - template: default
+    wait: false
+  - name: cache
+    inherit:
+      - template: default
+        except: [values]
+      - template: redis
+  - name: api
+    <<: *default
+    chart: ./api
+    namespace: api
+`
+	if err := os.WriteFile(helmfilePath, []byte(spec), 0644); err != nil {
+		t.Fatalf("failed to write test helmfile: %v", err)
+	}
+
+	for _, strict := range []bool{false, true} {
+		manager := NewManager(helmfilePath, "")
+		manager.Strict = strict
+		if err := manager.Load(); err != nil {
+			t.Fatalf("Load(strict=%v) failed: %v", strict, err)
+		}
+		releases := manager.Spec.Releases
+		if len(releases) != 3 {
+			t.Fatalf("expected 3 releases, got %d", len(releases))
+		}
+
+		web, cache, api := releases[0], releases[1], releases[2]
+		if web.Namespace != "apps" || web.Wait || web.Timeout != 300 || len(web.Values) != 1 || web.Values[0] != filepath.Join(dir, "common.yaml") {
+			t.Errorf("expected web to inherit the default template and override wait, got %+v", web)
+		}
+		if cache.Chart != "bitnami/redis" || cache.Version != "18.0.4" || cache.Namespace != "apps" || len(cache.Values) != 0 {
+			t.Errorf("expected cache to inherit both templates except values, got %+v", cache)
+		}
+		if api.Chart != "./api" || api.Namespace != "api" || !api.Wait || len(api.Values) != 1 {
+			t.Errorf("expected api to merge the anchor, got %+v", api)
+		}
+	}
+}
+
+func TestLoadReleaseTemplatesInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		line int
+	}{
+		{
+			name: "unknown template",
+			spec: "templates:\n  default:\n    namespace: apps\nreleases:\n  - name: web\n    chart: bitnami/nginx\n    inherit:\n      - template: defualt\n",
+			line: 8,
+		},
+		{
+			name: "unknown inherit field",
+			spec: "templates:\n  default:\n    namespace: apps\nreleases:\n  - name: web\n    chart: bitnami/nginx\n    inherit:\n      - template: default\n        only: [namespace]\n",
+			line: 9,
+		},
+		{
+			name: "nested inherit",
+			spec: "templates:\n  base:\n    wait: true\n  default:\n    inherit:\n      - template: base\nreleases:\n  - name: web\n    chart: bitnami/nginx\n    inherit:\n      - template: default\n",
+			line: 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			helmfilePath := filepath.Join(t.TempDir(), "helmfile.yaml")
+			if err := os.WriteFile(helmfilePath, []byte(tt.spec), 0644); err != nil {
+				t.Fatalf("failed to write test helmfile: %v", err)
+			}
+			err := NewManager(helmfilePath, "").Load()
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("expected a ValidationError, got %v", err)
+			}
+			if len(validationErr.Problems) != 1 || validationErr.Problems[0].Line != tt.line {
+				t.Errorf("expected one problem on line %d, got %+v", tt.line, validationErr.Problems)
+			}
+		})
+	}
+}
+
+func TestValidateReleaseTemplates(t *testing.T) {
+	// The chart comes from the template, and the template's unknown field
+	// is reported once however many releases inherit it
+	spec := `templates:
+  default: &default
+    chart: bitnami/nginx
+    namspace: apps
+releases:
+  - name: web
+    inherit:
+      - template: default
+  - name: api
+    inherit:
+      - template: default
+  - name: worker
+    <<: *default
+`
+	problems := Validate([]byte(spec))
+	if len(problems) != 1 || problems[0].Line != 4 {
+		t.Errorf("expected one problem on line 4, got %+v", problems)
+	}
+}
@@ -1,10 +1,45 @@
 package helmstate
 
+import (
+	"time"
+)
+
 // HelmfileSpec represents a simplified helmfile.yaml structure
 type HelmfileSpec struct {
-	Repositories []Repository `yaml:"repositories,omitempty"`
-	Releases     []Release    `yaml:"releases"`
+	// Bases are helmfiles layered under this one, in order, before it is
+	// applied; paths are relative to this helmfile
+	Bases []string `yaml:"bases,omitempty"`
+
+	HelmDefaults *HelmDefaults `yaml:"helmDefaults,omitempty"`
+	Repositories []Repository  `yaml:"repositories,omitempty"`
+
+	// Templates hold release fields shared by releases, which take them
+	// with inherit when the helmfile is loaded
+	Templates map[string]Release `yaml:"templates,omitempty"`
+
+	Releases     []Release              `yaml:"releases"`
 	Environments map[string]Environment `yaml:"environments,omitempty"`
+	Namespaces   map[string]Namespace   `yaml:"namespaces,omitempty"`
+
+	// Phases orders the sync of releases by their phase; DefaultPhases
+	// when empty
+	Phases []string `yaml:"phases,omitempty"`
+}
+
+// HelmDefaults are the defaults of the helmfile's releases
+type HelmDefaults struct {
+	Wait            *bool `yaml:"wait,omitempty"`
+	Timeout         int   `yaml:"timeout,omitempty"` // seconds
+	CreateNamespace *bool `yaml:"createNamespace,omitempty"`
+
+	// Namespace and KubeContext are those of releases that set neither
+	// themselves nor through their environment
+	Namespace   string `yaml:"namespace,omitempty"`
+	KubeContext string `yaml:"kubeContext,omitempty"`
+
+	// MissingFileHandler is the releases' missingFileHandler, and handles
+	// missing environment values files
+	MissingFileHandler string `yaml:"missingFileHandler,omitempty"`
 }
 
 // Repository represents a helm repository
@@ -14,28 +49,183 @@ type Repository struct {
 	Username string `yaml:"username,omitempty"`
 	Password string `yaml:"password,omitempty"`
 	OCI      bool   `yaml:"oci,omitempty"`
+
+	// CAFile is the PEM bundle the repository's certificate is checked
+	// against, the --ca-file one when unset. SkipTLSVerify accepts any.
+	CAFile        string `yaml:"caFile,omitempty"`
+	SkipTLSVerify bool   `yaml:"skipTLSVerify,omitempty"`
+
+	// CredentialHelper is the docker-credential-<helper> asked for the
+	// credentials of a repository without a username or password, over the
+	// one the docker config names for its registry; "none" doesn't look
+	// them up
+	CredentialHelper string `yaml:"credentialHelper,omitempty"`
 }
 
 // Release represents a helm release
 type Release struct {
-	Name      string                 `yaml:"name"`
-	Namespace string                 `yaml:"namespace,omitempty"`
-	Chart     string                 `yaml:"chart"`
-	Version   string                 `yaml:"version,omitempty"`
-	Values    []interface{}          `yaml:"values,omitempty"`
-	Set       []SetValue             `yaml:"set,omitempty"`
-	Wait      bool                   `yaml:"wait,omitempty"`
-	Installed *bool                  `yaml:"installed,omitempty"`
-	Labels    map[string]string      `yaml:"labels,omitempty"`
-}
-
-// SetValue represents a --set style value
+	Name      string            `yaml:"name"`
+	Namespace string            `yaml:"namespace,omitempty"`
+	Chart     string            `yaml:"chart"`
+	Version   string            `yaml:"version,omitempty"`
+	Values    []interface{}     `yaml:"values,omitempty"`
+	Set       []SetValue        `yaml:"set,omitempty"`
+	Wait      bool              `yaml:"wait,omitempty"`
+	Timeout   int               `yaml:"timeout,omitempty"` // seconds, passed to helm --timeout
+	Installed *bool             `yaml:"installed,omitempty"`
+	Labels    map[string]string `yaml:"labels,omitempty"`
+	Drift     *ReleaseDrift     `yaml:"drift,omitempty"`
+
+	// KubeContext is the kubeconfig context the release is synced to; the
+	// current context when empty
+	KubeContext string `yaml:"kubeContext,omitempty"`
+
+	// CreateNamespace overrides whether the release namespace is created
+	// when missing
+	CreateNamespace *bool `yaml:"createNamespace,omitempty"`
+
+	// Adopt patches helm's ownership metadata onto existing resources the
+	// release renders, so it can take over resources applied by hand
+	Adopt bool `yaml:"adopt,omitempty"`
+
+	// CRDs chooses how the CRDs in the chart's crds/ directory are handled;
+	// empty leaves it to helm, which installs them once and never upgrades
+	// them
+	CRDs string `yaml:"crds,omitempty"`
+
+	// Phase is the sync phase of the release, one of the helmfile's phases;
+	// the last phase when empty
+	Phase string `yaml:"phase,omitempty"`
+
+	// InstalledTemplate decides Installed per environment with a Go
+	// template rendering true or false, such as
+	// {{ ne .Environment.Name "dev" }}
+	InstalledTemplate string `yaml:"installedTemplate,omitempty"`
+
+	// Condition names a boolean in the environment values, such as
+	// cache.enabled; a release whose condition is false or unset is not
+	// installed
+	Condition string `yaml:"condition,omitempty"`
+
+	// MissingFileHandler decides what a values file that doesn't exist
+	// does: Error fails the load, while Warn, Info and Debug skip the file.
+	// When empty, the file is passed to helm as is.
+	MissingFileHandler string `yaml:"missingFileHandler,omitempty"`
+
+	// Environments overrides fields of the release in the environment
+	// selected with -e
+	Environments map[string]ReleaseEnvironment `yaml:"environments,omitempty"`
+
+	// Sync copies local files into the running pods of the release when
+	// they change in watch mode
+	Sync []FileSync `yaml:"sync,omitempty"`
+
+	// Dev configures the release in helmfire dev sessions
+	Dev *ReleaseDev `yaml:"dev,omitempty"`
+
+	// HealthChecks must pass after helm synced the release for the sync to
+	// count it as succeeded
+	HealthChecks []HealthCheck `yaml:"healthChecks,omitempty"`
+
+	// Tests are smoke tests run once the release is healthy; a failed test
+	// fails the release in the sync report
+	Tests []ReleaseTest `yaml:"tests,omitempty"`
+}
+
+// ReleaseEnvironment overrides fields of a release in one environment.
+// Values are added after the release's own, so they take precedence.
+type ReleaseEnvironment struct {
+	Values    []interface{} `yaml:"values,omitempty"`
+	Version   string        `yaml:"version,omitempty"`
+	Installed *bool         `yaml:"installed,omitempty"`
+}
+
+// ReleaseDev holds the images helmfire dev builds for a release, the ports
+// it forwards and whether it streams the release's logs
+type ReleaseDev struct {
+	Build       []ImageBuild  `yaml:"build,omitempty"`
+	PortForward []PortForward `yaml:"portForward,omitempty"`
+	Logs        *bool         `yaml:"logs,omitempty"`     // default true
+	Selector    string        `yaml:"selector,omitempty"` // pods whose logs are streamed
+}
+
+// ImageBuild builds an image from local sources and substitutes it for
+// Image, the reference used by the release's manifests
+type ImageBuild struct {
+	Image      string            `yaml:"image"`
+	Context    string            `yaml:"context"`
+	Dockerfile string            `yaml:"dockerfile,omitempty"`
+	Args       map[string]string `yaml:"args,omitempty"`
+}
+
+// PortForward forwards local ports to a resource of the release, such as
+// svc/web or deploy/web, as LOCAL:REMOTE pairs
+type PortForward struct {
+	Resource string   `yaml:"resource,omitempty"` // default svc/<release>
+	Ports    []string `yaml:"ports"`
+}
+
+// FileSync maps a local file or directory to a directory in the containers
+// of a release, for interpreted apps that reload without a new image
+type FileSync struct {
+	Src       string `yaml:"src"`
+	Dest      string `yaml:"dest"`
+	Container string `yaml:"container,omitempty"`
+	Selector  string `yaml:"selector,omitempty"` // pod label selector
+}
+
+// ReleaseDrift holds per-release drift detection settings
+type ReleaseDrift struct {
+	Interval time.Duration `yaml:"interval,omitempty"` // overrides the detector interval
+}
+
+// CRD strategies of a release
+const (
+	CRDsSkip  = "skip"  // never install or upgrade the chart's CRDs
+	CRDsApply = "apply" // server-side apply the chart's CRDs before every sync
+	CRDsFail  = "fail"  // fail the sync when the chart's CRDs differ from the cluster's
+)
+
+// SetValue represents a --set style value, or a --set-file one when File
+// is set. A Value of vault:path#key is read from Vault at sync time.
 type SetValue struct {
 	Name  string `yaml:"name"`
 	Value string `yaml:"value"`
+	File  string `yaml:"file,omitempty"`
+
+	// Sensitive masks Value in logs, reports and API responses
+	Sensitive bool `yaml:"sensitive,omitempty"`
+}
+
+// Namespace declares the labels and annotations of a namespace releases are
+// synced to. They are applied when helmfire creates namespaces and required
+// when it verifies them.
+type Namespace struct {
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
 }
 
 // Environment represents an environment configuration
 type Environment struct {
 	Values []interface{} `yaml:"values,omitempty"`
+
+	// Namespace and KubeContext are those of the environment's releases
+	// that don't set them, over the helmDefaults
+	Namespace   string `yaml:"namespace,omitempty"`
+	KubeContext string `yaml:"kubeContext,omitempty"`
+}
+
+// DeployedRelease is a release as reported by helm list
+type DeployedRelease struct {
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace"`
+	Revision   string `json:"revision"`
+	Updated    string `json:"updated"`
+	Status     string `json:"status"`
+	Chart      string `json:"chart"`
+	AppVersion string `json:"app_version"`
+
+	// KubeContext is the kubeconfig context the release was listed in, the
+	// current one when empty
+	KubeContext string `json:"kubeContext,omitempty"`
 }
@@ -0,0 +1,165 @@
+package helmstate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/oleksiyp/helmfire/pkg/secretref"
+	"gopkg.in/yaml.v3"
+)
+
+// ReleaseValues are the values a release is synced with, merged the way
+// helm merges its values files and --set flags
+type ReleaseValues struct {
+	Values map[string]interface{}
+
+	// Secret are the dotted paths of values that are secret references,
+	// resolved only at sync time, or set as sensitive; they can't be
+	// compared with the deployed values and are never shown
+	Secret []string
+}
+
+// DeployedValues returns the values the deployed revision of a release was
+// installed with, as helm recorded them: those given on top of the chart's
+// defaults
+func (m *Manager) DeployedValues(release Release) (map[string]interface{}, error) {
+	out, err := m.helmOutput(append([]string{"get", "values", release.Name, "--output", "json"}, targetArgs(release)...)...)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &values); err != nil {
+		return nil, fmt.Errorf("failed to parse values of release %s: %w", release.Name, err)
+	}
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+	return values, nil
+}
+
+// DesiredValues returns the values a sync gives a release: its values files
+// merged in order, then its --set values. Values files that don't exist
+// are skipped, as a sync would fail on them anyway.
+func (m *Manager) DesiredValues(release Release) (ReleaseValues, error) {
+	result := ReleaseValues{Values: map[string]interface{}{}}
+	for _, value := range release.Values {
+		path, ok := value.(string)
+		if !ok {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return ReleaseValues{}, err
+		}
+		var values map[string]interface{}
+		if err := yaml.Unmarshal(data, &values); err != nil {
+			return ReleaseValues{}, fmt.Errorf("failed to parse values file %s: %w", path, err)
+		}
+		mergeValues(result.Values, values)
+	}
+
+	for _, set := range release.Set {
+		var value interface{} = parseSetValue(set.Value)
+		if set.File != "" {
+			data, err := os.ReadFile(set.File)
+			if err != nil {
+				return ReleaseValues{}, err
+			}
+			value = string(data)
+		}
+		keys := splitValuePath(set.Name)
+		setValuePath(result.Values, keys, value)
+		if set.Sensitive || secretref.IsRef(set.Value) {
+			result.Secret = append(result.Secret, strings.Join(keys, "."))
+		}
+	}
+
+	// Values files may reference secrets too
+	walkValues(result.Values, "", func(path string, value interface{}) {
+		if s, ok := value.(string); ok && secretref.IsRef(s) {
+			result.Secret = append(result.Secret, path)
+		}
+	})
+
+	// Compare as JSON, the way helm records values
+	data, err := json.Marshal(result.Values)
+	if err != nil {
+		return ReleaseValues{}, fmt.Errorf("failed to encode values of release %s: %w", release.Name, err)
+	}
+	result.Values = map[string]interface{}{}
+	if err := json.Unmarshal(data, &result.Values); err != nil {
+		return ReleaseValues{}, err
+	}
+	return result, nil
+}
+
+// splitValuePath splits a --set name such as a.b\.c into its keys, dots
+// escaped with a backslash being part of a key
+func splitValuePath(name string) []string {
+	var keys []string
+	var key strings.Builder
+	for i := 0; i < len(name); i++ {
+		switch {
+		case name[i] == '\\' && i+1 < len(name) && name[i+1] == '.':
+			key.WriteByte('.')
+			i++
+		case name[i] == '.':
+			keys = append(keys, key.String())
+			key.Reset()
+		default:
+			key.WriteByte(name[i])
+		}
+	}
+	return append(keys, key.String())
+}
+
+// setValuePath sets the value at a path of keys, creating maps on the way
+func setValuePath(values map[string]interface{}, keys []string, value interface{}) {
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := values[key].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			values[key] = next
+		}
+		values = next
+	}
+	values[keys[len(keys)-1]] = value
+}
+
+// parseSetValue types a --set value as helm does: booleans, null and
+// integers, and strings otherwise
+func parseSetValue(value string) interface{} {
+	switch value {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil && (value == "0" || !strings.HasPrefix(value, "0")) {
+		return n
+	}
+	return value
+}
+
+// walkValues calls fn with the dotted path of every value that isn't a map
+func walkValues(values map[string]interface{}, prefix string, fn func(path string, value interface{})) {
+	for key, value := range values {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok && len(nested) > 0 {
+			walkValues(nested, path, fn)
+			continue
+		}
+		fn(path, value)
+	}
+}
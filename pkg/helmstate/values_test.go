@@ -0,0 +1,98 @@
+package helmstate
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+)
+
+func TestDesiredValues(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.yaml")
+	prod := filepath.Join(dir, "prod.yaml")
+	cert := filepath.Join(dir, "cert.pem")
+	files := map[string]string{
+		base: "replicaCount: 1\nimage:\n  repository: nginx\n  tag: \"1.0\"\ndb:\n  password: vault:secret/db#password\n",
+		prod: "replicaCount: 2\nimage:\n  tag: \"1.1\"\n",
+		cert: "CERT",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manager := NewManager("", "")
+	values, err := manager.DesiredValues(Release{
+		Name:   "web",
+		Values: []interface{}{base, prod, filepath.Join(dir, "missing.yaml")},
+		Set: []SetValue{
+			{Name: "replicaCount", Value: "3"},
+			{Name: "ingress.enabled", Value: "true"},
+			{Name: `annotations.example\.com/team`, Value: "web"},
+			{Name: "tls.cert", File: cert},
+			{Name: "apiKey", Value: "abc", Sensitive: true},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"replicaCount": float64(3),
+		"image":        map[string]interface{}{"repository": "nginx", "tag": "1.1"},
+		"db":           map[string]interface{}{"password": "vault:secret/db#password"},
+		"ingress":      map[string]interface{}{"enabled": true},
+		"annotations":  map[string]interface{}{"example.com/team": "web"},
+		"tls":          map[string]interface{}{"cert": "CERT"},
+		"apiKey":       "abc",
+	}
+	if !reflect.DeepEqual(values.Values, want) {
+		t.Errorf("DesiredValues() = %+v, want %+v", values.Values, want)
+	}
+	sort.Strings(values.Secret)
+	if !reflect.DeepEqual(values.Secret, []string{"apiKey", "db.password"}) {
+		t.Errorf("unexpected secret paths %v", values.Secret)
+	}
+}
+
+func TestDeployedValues(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	helm := filepath.Join(dir, "helm")
+	script := `#!/bin/sh
+echo "$@" > ` + log + `
+printf '%s' "$VALUES"
+`
+	if err := os.WriteFile(helm, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := NewManager("", "")
+	manager.HelmBinary = helm
+	release := Release{Name: "web", Namespace: "prod"}
+
+	t.Setenv("VALUES", `{"replicaCount":3}`)
+	values, err := manager.DeployedValues(release)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, map[string]interface{}{"replicaCount": float64(3)}) {
+		t.Errorf("unexpected deployed values %+v", values)
+	}
+	if data, _ := os.ReadFile(log); string(data) != "get values web --output json --namespace prod\n" {
+		t.Errorf("unexpected helm call %q", data)
+	}
+
+	t.Setenv("VALUES", "null")
+	if values, err := manager.DeployedValues(release); err != nil || values == nil || len(values) != 0 {
+		t.Errorf("expected no values as an empty map, got %+v, %v", values, err)
+	}
+}
@@ -0,0 +1,158 @@
+// Package httpclient builds the HTTP clients helmfire reaches outside
+// services with: webhook and Slack notifiers, chart downloads, Vault, the
+// trace exporter and repository checks. They share process-wide defaults
+// set from the --proxy and --ca-file flags, which endpoints can override.
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// Options configure how an HTTP client reaches its endpoint
+type Options struct {
+	// Proxy is the URL of the proxy every request goes through; the
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables decide
+	// when empty
+	Proxy string
+
+	// CAFile is a PEM bundle of certificate authorities trusted besides
+	// the system's, such as a corporate CA
+	CAFile string
+
+	// InsecureSkipVerify accepts any server certificate. Only for
+	// endpoints with self-signed certificates on trusted networks.
+	InsecureSkipVerify bool
+}
+
+// Override returns the options with the fields set in o replaced
+func (opts Options) Override(o Options) Options {
+	if o.Proxy != "" {
+		opts.Proxy = o.Proxy
+	}
+	if o.CAFile != "" {
+		opts.CAFile = o.CAFile
+	}
+	if o.InsecureSkipVerify {
+		opts.InsecureSkipVerify = true
+	}
+	return opts
+}
+
+var (
+	mu       sync.RWMutex
+	defaults Options
+)
+
+// SetDefaults sets the options of every client, checking that the proxy
+// URL parses and the CA bundle loads
+func SetDefaults(opts Options) error {
+	if _, err := transport(opts); err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	defaults = opts
+	return nil
+}
+
+// Defaults returns the options of every client
+func Defaults() Options {
+	mu.RLock()
+	defer mu.RUnlock()
+	return defaults
+}
+
+// New returns a client with the default options and timeout. The defaults
+// were checked when set, so they are only reported when the CA bundle
+// became unreadable since, with a client that trusts the system's CAs.
+func New(timeout time.Duration) *http.Client {
+	client, err := NewWith(Options{}, timeout)
+	if err != nil {
+		return &http.Client{Timeout: timeout}
+	}
+	return client
+}
+
+// NewWith returns a client with the default options overridden by opts
+func NewWith(opts Options, timeout time.Duration) (*http.Client, error) {
+	t, err := transport(Defaults().Override(opts))
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: t, Timeout: timeout}, nil
+}
+
+// transport returns the transport of a client with opts
+func transport(opts Options) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.Proxy != "" {
+		proxy, err := url.Parse(opts.Proxy)
+		if err != nil || proxy.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", opts.Proxy)
+		}
+		t.Proxy = http.ProxyURL(proxy)
+	}
+
+	if opts.CAFile == "" && !opts.InsecureSkipVerify {
+		return t, nil
+	}
+	config, err := tlsConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	t.TLSClientConfig = config
+	return t, nil
+}
+
+// TLSConfig returns the TLS configuration of clients with the default
+// options overridden by opts, for protocols besides HTTP
+func TLSConfig(opts Options) (*tls.Config, error) {
+	return tlsConfig(Defaults().Override(opts))
+}
+
+// tlsConfig returns the TLS configuration trusting the CA bundle of opts
+func tlsConfig(opts Options) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: opts.InsecureSkipVerify}
+	if opts.CAFile != "" {
+		pool, err := certPool(opts.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+// certPool returns the system's certificate authorities and those in the
+// PEM bundle at path
+func certPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", path)
+	}
+	return pool, nil
+}
+
+// HelmEnv returns the environment variables passing the default proxy to
+// helm and the tools it runs, or nil when none is set
+func HelmEnv() []string {
+	proxy := Defaults().Proxy
+	if proxy == "" {
+		return nil
+	}
+	return []string{"HTTP_PROXY=" + proxy, "HTTPS_PROXY=" + proxy, "http_proxy=" + proxy, "https_proxy=" + proxy}
+}
@@ -0,0 +1,110 @@
+package httpclient
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCA writes the certificate of a TLS test server as a PEM bundle
+func writeCA(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCustomCA(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	if _, err := New(5 * time.Second).Get(server.URL); err == nil {
+		t.Fatal("expected the test server's certificate rejected by default")
+	}
+
+	client, err := NewWith(Options{CAFile: writeCA(t, server)}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("expected the CA bundle trusted, got %v", err)
+	}
+	resp.Body.Close()
+
+	client, err = NewWith(Options{InsecureSkipVerify: true}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("expected any certificate accepted, got %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestDefaults(t *testing.T) {
+	defer SetDefaults(Options{})
+
+	// The proxy answers every request itself
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	if err := SetDefaults(Options{Proxy: proxy.URL}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := New(5 * time.Second).Get("http://charts.example.com/index.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if proxied != "http://charts.example.com/index.yaml" {
+		t.Errorf("expected the request sent through the proxy, got %q", proxied)
+	}
+
+	if env := strings.Join(HelmEnv(), " "); !strings.Contains(env, "HTTPS_PROXY="+proxy.URL) {
+		t.Errorf("expected the proxy passed to helm, got %q", env)
+	}
+}
+
+func TestSetDefaultsErrors(t *testing.T) {
+	defer SetDefaults(Options{})
+
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(empty, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range []Options{
+		{Proxy: "proxy.example.com:3128"},
+		{CAFile: filepath.Join(t.TempDir(), "missing.pem")},
+		{CAFile: empty},
+	} {
+		if err := SetDefaults(opts); err == nil {
+			t.Errorf("SetDefaults(%+v) succeeded, want error", opts)
+		}
+	}
+	if Defaults() != (Options{}) {
+		t.Errorf("expected the defaults unchanged, got %+v", Defaults())
+	}
+}
+
+func TestOverride(t *testing.T) {
+	defaults := Options{Proxy: "http://proxy:3128", CAFile: "/etc/ssl/corp.pem"}
+	got := defaults.Override(Options{CAFile: "/etc/ssl/hooks.pem", InsecureSkipVerify: true})
+	want := Options{Proxy: "http://proxy:3128", CAFile: "/etc/ssl/hooks.pem", InsecureSkipVerify: true}
+	if got != want {
+		t.Errorf("Override() = %+v, want %+v", got, want)
+	}
+}
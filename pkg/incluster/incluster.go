@@ -0,0 +1,170 @@
+package incluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// ServiceAccountDir holds the credentials mounted into every pod
+	ServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	// DefaultHelmfileKey is the ConfigMap key read when none is given
+	DefaultHelmfileKey = "helmfile.yaml"
+
+	// DefaultAPIAddr exposes the daemon API to a Service in in-cluster mode
+	DefaultAPIAddr = ":8080"
+)
+
+// Detect reports whether helmfire is running inside a Kubernetes pod with a
+// service account. helm and kubectl use the service account automatically
+// when no kubeconfig is present.
+func Detect() bool {
+	if os.Getenv("KUBERNETES_SERVICE_HOST") == "" {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(ServiceAccountDir, "token"))
+	return err == nil
+}
+
+// Namespace returns the namespace of the pod helmfire runs in
+func Namespace() string {
+	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
+		return ns
+	}
+	if data, err := os.ReadFile(filepath.Join(ServiceAccountDir, "namespace")); err == nil {
+		if ns := strings.TrimSpace(string(data)); ns != "" {
+			return ns
+		}
+	}
+	return "default"
+}
+
+// ConfigMapSource loads a helmfile from a ConfigMap. Every key is written to
+// the target directory so values files referenced by relative path resolve.
+type ConfigMapSource struct {
+	Namespace string
+	Name      string
+	Key       string
+	Kubectl   string
+
+	lastData map[string]string
+}
+
+// ParseConfigMapRef parses a ConfigMap reference of the form
+// [namespace/]name[:key]. Without a namespace, defaultNamespace is used.
+func ParseConfigMapRef(ref, defaultNamespace string) (*ConfigMapSource, error) {
+	original := ref
+	source := &ConfigMapSource{
+		Namespace: defaultNamespace,
+		Key:       DefaultHelmfileKey,
+		Kubectl:   "kubectl",
+	}
+
+	if idx := strings.LastIndex(ref, ":"); idx >= 0 {
+		source.Key = ref[idx+1:]
+		ref = ref[:idx]
+	}
+	if idx := strings.Index(ref, "/"); idx >= 0 {
+		source.Namespace = ref[:idx]
+		ref = ref[idx+1:]
+	}
+	source.Name = ref
+
+	if source.Name == "" || source.Namespace == "" || source.Key == "" {
+		return nil, fmt.Errorf("invalid ConfigMap reference %q (expected [namespace/]name[:key])", original)
+	}
+
+	return source, nil
+}
+
+// String returns the reference in [namespace/]name[:key] form
+func (s *ConfigMapSource) String() string {
+	return fmt.Sprintf("%s/%s:%s", s.Namespace, s.Name, s.Key)
+}
+
+// Fetch writes the ConfigMap contents to dir and returns the helmfile path.
+// changed is false when the contents are the same as the previous fetch.
+func (s *ConfigMapSource) Fetch(dir string) (path string, changed bool, err error) {
+	data, err := s.get()
+	if err != nil {
+		return "", false, err
+	}
+
+	if _, ok := data[s.Key]; !ok {
+		return "", false, fmt.Errorf("ConfigMap %s/%s has no key %q", s.Namespace, s.Name, s.Key)
+	}
+
+	path = filepath.Join(dir, s.Key)
+	if s.lastData != nil && equalData(s.lastData, data) {
+		return path, false, nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", false, fmt.Errorf("failed to create helmfile directory: %w", err)
+	}
+
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		// ConfigMap keys can't contain path separators, but don't trust that
+		if filepath.Base(key) != key {
+			return "", false, fmt.Errorf("invalid ConfigMap key %q", key)
+		}
+		if err := os.WriteFile(filepath.Join(dir, key), []byte(data[key]), 0644); err != nil {
+			return "", false, fmt.Errorf("failed to write %s: %w", key, err)
+		}
+	}
+
+	s.lastData = data
+	return path, true, nil
+}
+
+// get reads the ConfigMap data with kubectl
+func (s *ConfigMapSource) get() (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, s.Kubectl, "get", "configmap", s.Name, "--namespace", s.Namespace, "-o", "json")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to get ConfigMap %s/%s: %w (stderr: %s)", s.Namespace, s.Name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var cm struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &cm); err != nil {
+		return nil, fmt.Errorf("failed to parse ConfigMap %s/%s: %w", s.Namespace, s.Name, err)
+	}
+
+	return cm.Data, nil
+}
+
+// equalData compares two ConfigMap data maps
+func equalData(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package incluster
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestParseConfigMapRef(t *testing.T) {
+	tests := []struct {
+		ref       string
+		namespace string
+		name      string
+		key       string
+	}{
+		{"helmfile", "helmfire", "helmfile", DefaultHelmfileKey},
+		{"apps/helmfile", "apps", "helmfile", DefaultHelmfileKey},
+		{"apps/helmfile:prod.yaml", "apps", "helmfile", "prod.yaml"},
+	}
+
+	for _, tt := range tests {
+		source, err := ParseConfigMapRef(tt.ref, "helmfire")
+		if err != nil {
+			t.Errorf("ParseConfigMapRef(%q) failed: %v", tt.ref, err)
+			continue
+		}
+		if source.Namespace != tt.namespace || source.Name != tt.name || source.Key != tt.key {
+			t.Errorf("ParseConfigMapRef(%q) = %s, expected %s/%s:%s", tt.ref, source, tt.namespace, tt.name, tt.key)
+		}
+	}
+
+	for _, ref := range []string{"", "apps/", "helmfile:"} {
+		if _, err := ParseConfigMapRef(ref, "helmfire"); err == nil {
+			t.Errorf("expected error for %q", ref)
+		}
+	}
+}
+
+func TestConfigMapSourceFetch(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake kubectl script requires a POSIX shell")
+	}
+
+	// Fake kubectl prints whatever configmap.json currently contains
+	bin := t.TempDir()
+	cmFile := filepath.Join(bin, "configmap.json")
+	kubectl := filepath.Join(bin, "kubectl")
+	if err := os.WriteFile(kubectl, []byte("#!/bin/sh\ncat \""+cmFile+"\"\n"), 0755); err != nil {
+		t.Fatalf("failed to write fake kubectl: %v", err)
+	}
+
+	writeConfigMap := func(helmfile string) {
+		data, _ := json.Marshal(map[string]interface{}{
+			"data": map[string]string{"helmfile.yaml": helmfile, "values.yaml": "replicas: 2\n"},
+		})
+		if err := os.WriteFile(cmFile, data, 0644); err != nil {
+			t.Fatalf("failed to write ConfigMap: %v", err)
+		}
+	}
+
+	source, _ := ParseConfigMapRef("helmfire/helmfile", "")
+	source.Kubectl = kubectl
+	dir := t.TempDir()
+
+	writeConfigMap("releases: []\n")
+	path, changed, err := source.Fetch(dir)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if !changed || path != filepath.Join(dir, "helmfile.yaml") {
+		t.Errorf("expected first fetch to write %s, got %s (changed=%v)", filepath.Join(dir, "helmfile.yaml"), path, changed)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "values.yaml")); err != nil {
+		t.Errorf("expected other keys to be written: %v", err)
+	}
+
+	if _, changed, _ := source.Fetch(dir); changed {
+		t.Error("expected unchanged ConfigMap not to be reported as changed")
+	}
+
+	writeConfigMap("releases:\n- name: nginx\n")
+	if _, changed, _ := source.Fetch(dir); !changed {
+		t.Error("expected updated ConfigMap to be reported as changed")
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "releases:\n- name: nginx\n" {
+		t.Errorf("unexpected helmfile contents %q", data)
+	}
+}
+
+func TestNamespaceFromEnv(t *testing.T) {
+	t.Setenv("POD_NAMESPACE", "platform")
+	if ns := Namespace(); ns != "platform" {
+		t.Errorf("expected platform, got %s", ns)
+	}
+}
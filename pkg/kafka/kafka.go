@@ -0,0 +1,375 @@
+// Package kafka produces messages to Kafka topics over the Kafka protocol:
+// the metadata, record batches and SASL/PLAIN authentication a notifier
+// needs, without consumers, compression or transactions.
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/httpclient"
+)
+
+// DefaultPort is the port of brokers whose address names none
+const DefaultPort = "9092"
+
+// DefaultTimeout bounds producing a message, from connecting to the
+// acknowledgement
+const DefaultTimeout = 10 * time.Second
+
+// clientID identifies helmfire to brokers
+const clientID = "helmfire"
+
+// metadataRetries is how often topic metadata is asked for again while a
+// topic being created has no leader yet
+const metadataRetries = 3
+
+// Producer appends messages to topics, waiting for every in-sync replica to
+// acknowledge them. Each Produce connects to the brokers anew, which suits
+// infrequent messages such as drift reports.
+type Producer struct {
+	brokers []string // host:port
+	timeout time.Duration
+	// tls, when set, connects to brokers over TLS with these options
+	tls *httpclient.Options
+	// username and password authenticate with SASL/PLAIN when username is
+	// set
+	username, password string
+}
+
+// NewProducer creates a producer bootstrapping from brokers, host:port
+// addresses of which the first reachable is asked where topics live
+func NewProducer(brokers []string) (*Producer, error) {
+	p := &Producer{timeout: DefaultTimeout}
+	for _, broker := range brokers {
+		for _, address := range strings.Split(broker, ",") {
+			address = strings.TrimSpace(address)
+			if address == "" {
+				continue
+			}
+			if _, _, err := net.SplitHostPort(address); err != nil {
+				address = net.JoinHostPort(address, DefaultPort)
+			}
+			if host, _, _ := net.SplitHostPort(address); host == "" || strings.Contains(address, "/") {
+				return nil, fmt.Errorf("invalid Kafka broker address %q", address)
+			}
+			p.brokers = append(p.brokers, address)
+		}
+	}
+	if len(p.brokers) == 0 {
+		return nil, fmt.Errorf("no Kafka broker given")
+	}
+	return p, nil
+}
+
+// SetTimeout bounds producing a message; DefaultTimeout when not positive
+func (p *Producer) SetTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	p.timeout = timeout
+}
+
+// SetTLS connects to brokers over TLS, with opts overriding the default CA
+// bundle of package httpclient
+func (p *Producer) SetTLS(opts httpclient.Options) {
+	p.tls = &opts
+}
+
+// SetSASLPlain authenticates to brokers with SASL/PLAIN, which should only
+// be used over TLS
+func (p *Producer) SetSASLPlain(username, password string) {
+	p.username, p.password = username, password
+}
+
+// Produce appends a message to topic, on the partition its key hashes to
+// so that messages with the same key stay in order
+func (p *Producer) Produce(ctx context.Context, topic string, key, value []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	bootstrap, err := p.connectAny(ctx)
+	if err != nil {
+		return err
+	}
+	defer bootstrap.Close()
+
+	leader, partition, err := p.leader(ctx, bootstrap, topic, key)
+	if err != nil {
+		return err
+	}
+
+	c := bootstrap
+	if leader != bootstrap.address {
+		if c, err = p.connect(ctx, leader); err != nil {
+			return fmt.Errorf("failed to connect to the leader of %s: %w", topic, err)
+		}
+		defer c.Close()
+	}
+	return c.produce(topic, partition, key, value, p.timeout)
+}
+
+// leader returns the address of the broker leading the partition of topic
+// that key hashes to, and the partition
+func (p *Producer) leader(ctx context.Context, c *conn, topic string, key []byte) (string, int32, error) {
+	for attempt := 1; ; attempt++ {
+		meta, err := c.metadata(topic)
+		if err != nil {
+			return "", 0, err
+		}
+		var kerr *Error
+		if meta.err == nil {
+			partition := meta.partitions[partitionOf(key, len(meta.partitions))]
+			address, ok := meta.brokers[partition.leader]
+			if ok {
+				return address, partition.index, nil
+			}
+			meta.err = &Error{Code: errLeaderNotAvailable}
+		}
+		// Topics being created have no leader for a moment
+		if !errors.As(meta.err, &kerr) || kerr.Code != errLeaderNotAvailable || attempt == metadataRetries {
+			return "", 0, fmt.Errorf("topic %s: %w", topic, meta.err)
+		}
+		select {
+		case <-ctx.Done():
+			return "", 0, ctx.Err()
+		case <-time.After(time.Duration(attempt) * 200 * time.Millisecond):
+		}
+	}
+}
+
+// partitionOf returns the index of the partition of key among n
+func partitionOf(key []byte, n int) int {
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32() % uint32(n))
+}
+
+// connectAny connects to the first reachable broker
+func (p *Producer) connectAny(ctx context.Context) (*conn, error) {
+	var errs []error
+	for _, broker := range p.brokers {
+		c, err := p.connect(ctx, broker)
+		if err == nil {
+			return c, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", broker, err))
+		var kerr *Error
+		if errors.As(err, &kerr) {
+			// Authentication fails the same way on every broker
+			break
+		}
+	}
+	return nil, fmt.Errorf("failed to connect to Kafka: %w", errors.Join(errs...))
+}
+
+// connect opens an authenticated connection to a broker
+func (p *Producer) connect(ctx context.Context, address string) (*conn, error) {
+	dialer := net.Dialer{Timeout: p.timeout}
+	nc, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		nc.SetDeadline(deadline)
+	}
+
+	if p.tls != nil {
+		config, err := httpclient.TLSConfig(*p.tls)
+		if err != nil {
+			nc.Close()
+			return nil, err
+		}
+		config.ServerName, _, _ = net.SplitHostPort(address)
+		tlsConn := tls.Client(nc, config)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			nc.Close()
+			return nil, err
+		}
+		nc = tlsConn
+	}
+
+	c := &conn{Conn: nc, address: address}
+	if p.username != "" {
+		if err := c.saslPlain(p.username, p.password); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// conn is a connection to a broker
+type conn struct {
+	net.Conn
+	address     string
+	correlation int32
+}
+
+// roundTrip sends a request and returns the body of its response
+func (c *conn) roundTrip(apiKey, version int16, body []byte) (*decoder, error) {
+	c.correlation++
+	var req encoder
+	req.int32(0) // size, set below
+	req.int16(apiKey)
+	req.int16(version)
+	req.int32(c.correlation)
+	req.string(clientID)
+	req.b = append(req.b, body...)
+	binary.BigEndian.PutUint32(req.b, uint32(len(req.b)-4))
+	if _, err := c.Write(req.b); err != nil {
+		return nil, err
+	}
+
+	var size [4]byte
+	if _, err := io.ReadFull(c, size[:]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err := io.ReadFull(c, resp); err != nil {
+		return nil, err
+	}
+	d := &decoder{b: resp}
+	if id := d.int32(); d.err == nil && id != c.correlation {
+		return nil, fmt.Errorf("kafka: response %d to request %d", id, c.correlation)
+	}
+	return d, d.err
+}
+
+// saslPlain authenticates with SASL/PLAIN
+func (c *conn) saslPlain(username, password string) error {
+	var handshake encoder
+	handshake.string("PLAIN")
+	d, err := c.roundTrip(apiSaslHandshake, saslHandshakeVersion, handshake.b)
+	if err != nil {
+		return fmt.Errorf("SASL handshake failed: %w", err)
+	}
+	if code := d.int16(); code != errNone {
+		return &Error{Code: code, Message: "the broker doesn't accept SASL/PLAIN"}
+	}
+
+	var auth encoder
+	auth.bytes([]byte("\x00" + username + "\x00" + password))
+	if d, err = c.roundTrip(apiSaslAuthenticate, saslAuthenticateVersion, auth.b); err != nil {
+		return fmt.Errorf("SASL authentication failed: %w", err)
+	}
+	code, message := d.int16(), d.string()
+	if d.err != nil {
+		return d.err
+	}
+	if code != errNone {
+		return &Error{Code: code, Message: message}
+	}
+	return nil
+}
+
+// topicMetadata is where the partitions of a topic live
+type topicMetadata struct {
+	brokers    map[int32]string // node ID to host:port
+	partitions []partitionMetadata
+	err        error // the topic's error
+}
+
+type partitionMetadata struct {
+	index  int32
+	leader int32
+}
+
+// metadata asks where the partitions of topic live, creating the topic
+// when brokers allow it
+func (c *conn) metadata(topic string) (topicMetadata, error) {
+	var req encoder
+	req.int32(1)
+	req.string(topic)
+	req.bool(true) // allow auto topic creation
+	d, err := c.roundTrip(apiMetadata, metadataVersion, req.b)
+	if err != nil {
+		return topicMetadata{}, fmt.Errorf("failed to get metadata of %s: %w", topic, err)
+	}
+
+	meta := topicMetadata{brokers: make(map[int32]string)}
+	d.int32() // throttle time
+	for i, n := 0, d.array(); i < n; i++ {
+		id, host, port := d.int32(), d.string(), d.int32()
+		d.string() // rack
+		meta.brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.string() // cluster ID
+	d.int32()  // controller ID
+	for i, n := 0, d.array(); i < n; i++ {
+		code, name := d.int16(), d.string()
+		d.bool() // internal
+		var partitions []partitionMetadata
+		for j, m := 0, d.array(); j < m; j++ {
+			d.int16() // partition error
+			partition := partitionMetadata{index: d.int32(), leader: d.int32()}
+			for k, r := 0, d.array(); k < r; k++ {
+				d.int32() // replicas
+			}
+			for k, r := 0, d.array(); k < r; k++ {
+				d.int32() // in-sync replicas
+			}
+			partitions = append(partitions, partition)
+		}
+		if name != topic {
+			continue
+		}
+		if code != errNone {
+			meta.err = &Error{Code: code}
+		}
+		sort.Slice(partitions, func(a, b int) bool { return partitions[a].index < partitions[b].index })
+		meta.partitions = partitions
+	}
+	if d.err != nil {
+		return topicMetadata{}, fmt.Errorf("invalid metadata of %s: %w", topic, d.err)
+	}
+	if meta.err == nil && len(meta.partitions) == 0 {
+		meta.err = &Error{Code: errUnknownTopic}
+	}
+	return meta, nil
+}
+
+// produce appends a record batch of one message to a partition this
+// broker leads
+func (c *conn) produce(topic string, partition int32, key, value []byte, timeout time.Duration) error {
+	var req encoder
+	req.nullString() // transactional ID
+	req.int16(-1)    // acks: all in-sync replicas
+	req.int32(int32(timeout.Milliseconds()))
+	req.int32(1)
+	req.string(topic)
+	req.int32(1)
+	req.int32(partition)
+	req.bytes(recordBatch(key, value, time.Now()))
+
+	d, err := c.roundTrip(apiProduce, produceVersion, req.b)
+	if err != nil {
+		return fmt.Errorf("failed to produce to %s: %w", topic, err)
+	}
+	for i, n := 0, d.array(); i < n; i++ {
+		d.string() // topic
+		for j, m := 0, d.array(); j < m; j++ {
+			d.int32() // partition
+			code := d.int16()
+			d.int64() // base offset
+			d.int64() // log append time
+			if d.err == nil && code != errNone {
+				return fmt.Errorf("failed to produce to %s: %w", topic, &Error{Code: code})
+			}
+		}
+	}
+	if d.err != nil {
+		return fmt.Errorf("invalid produce response from %s: %w", c.address, d.err)
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// message is a record a fake broker received
+type message struct {
+	topic     string
+	partition int32
+	key       string
+	value     string
+}
+
+// fakeBroker answers the requests a producer sends, leading every
+// partition of its topics itself
+type fakeBroker struct {
+	listener   net.Listener
+	topics     map[string]int32 // partitions per topic
+	credential string           // SASL/PLAIN message required, if set
+
+	mu       sync.Mutex
+	messages []message
+}
+
+func newFakeBroker(t *testing.T, topics map[string]int32, credential string) *fakeBroker {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBroker{listener: listener, topics: topics, credential: credential}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(t, conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return b
+}
+
+func (b *fakeBroker) serve(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+	authenticated := b.credential == ""
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+		d := &decoder{b: req}
+		apiKey, _, correlation := d.int16(), d.int16(), d.int32()
+		d.string() // client ID
+
+		var resp encoder
+		resp.int32(correlation)
+		switch {
+		case apiKey == apiSaslHandshake:
+			resp.int16(errNone)
+			resp.int32(1)
+			resp.string("PLAIN")
+		case apiKey == apiSaslAuthenticate:
+			if string(d.bytes()) == b.credential {
+				authenticated = true
+				resp.int16(errNone)
+				resp.nullString()
+			} else {
+				resp.int16(58)
+				resp.string("Authentication failed: Invalid username or password")
+			}
+			resp.bytes(nil)
+		case !authenticated:
+			return
+		case apiKey == apiMetadata:
+			d.int32()
+			topic := d.string()
+			host, port, _ := net.SplitHostPort(b.listener.Addr().String())
+			portNum, _ := strconv.Atoi(port)
+			resp.int32(0) // throttle
+			resp.int32(1)
+			resp.int32(7) // node ID
+			resp.string(host)
+			resp.int32(int32(portNum))
+			resp.nullString()
+			resp.nullString() // cluster ID
+			resp.int32(7)     // controller
+			resp.int32(1)
+			partitions, ok := b.topics[topic]
+			if ok {
+				resp.int16(errNone)
+			} else {
+				resp.int16(errUnknownTopic)
+			}
+			resp.string(topic)
+			resp.bool(false)
+			resp.int32(partitions)
+			for i := int32(0); i < partitions; i++ {
+				resp.int16(errNone)
+				resp.int32(i)
+				resp.int32(7) // leader
+				resp.int32(0) // replicas
+				resp.int32(0) // in-sync replicas
+			}
+		case apiKey == apiProduce:
+			d.string() // transactional ID
+			d.int16()  // acks
+			d.int32()  // timeout
+			d.int32()
+			topic := d.string()
+			d.int32()
+			partition := d.int32()
+			key, value, err := decodeBatch(d.bytes())
+			if err != nil {
+				t.Errorf("invalid record batch: %v", err)
+				return
+			}
+			b.mu.Lock()
+			b.messages = append(b.messages, message{topic, partition, key, value})
+			b.mu.Unlock()
+
+			resp.int32(1)
+			resp.string(topic)
+			resp.int32(1)
+			resp.int32(partition)
+			resp.int16(errNone)
+			resp.int64(0)
+			resp.int64(-1)
+			resp.int32(0) // throttle
+		default:
+			t.Errorf("unexpected API key %d", apiKey)
+			return
+		}
+
+		out := binary.BigEndian.AppendUint32(nil, uint32(len(resp.b)))
+		conn.Write(append(out, resp.b...))
+	}
+}
+
+// decodeBatch checks a record batch of one record and returns its key and
+// value
+func decodeBatch(batch []byte) (string, string, error) {
+	d := &decoder{b: batch}
+	d.int64() // base offset
+	if length := d.int32(); int(length) != len(d.b) {
+		return "", "", errors.New("wrong batch length")
+	}
+	d.int32() // leader epoch
+	if d.int8() != 2 {
+		return "", "", errors.New("wrong magic")
+	}
+	crc := uint32(d.int32())
+	if crc32.Checksum(d.b, castagnoli) != crc {
+		return "", "", errors.New("wrong CRC")
+	}
+	d.take(2 + 4 + 8 + 8 + 8 + 2 + 4)
+	if d.int32() != 1 {
+		return "", "", errors.New("expected one record")
+	}
+	if length := d.varint(); int(length) != len(d.b) {
+		return "", "", errors.New("wrong record length")
+	}
+	d.int8()
+	d.varint()
+	d.varint()
+	key := d.take(int(d.varint()))
+	value := d.take(int(d.varint()))
+	if d.varint() != 0 || d.err != nil {
+		return "", "", errors.New("invalid record")
+	}
+	return string(key), string(value), nil
+}
+
+func TestProduce(t *testing.T) {
+	broker := newFakeBroker(t, map[string]int32{"drift": 3}, "")
+
+	producer, err := NewProducer([]string{broker.listener.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"apps/web", "apps/api", "apps/web"} {
+		if err := producer.Produce(context.Background(), "drift", []byte(key), []byte(`{"release":"`+key+`"}`)); err != nil {
+			t.Fatalf("Produce() failed: %v", err)
+		}
+	}
+
+	if len(broker.messages) != 3 {
+		t.Fatalf("expected 3 messages, got %+v", broker.messages)
+	}
+	if m := broker.messages[0]; m.topic != "drift" || m.key != "apps/web" || m.value != `{"release":"apps/web"}` {
+		t.Errorf("unexpected message %+v", m)
+	}
+	if broker.messages[0].partition != broker.messages[2].partition {
+		t.Errorf("expected messages with the same key on one partition, got %+v", broker.messages)
+	}
+
+	var kerr *Error
+	err = producer.Produce(context.Background(), "missing", nil, []byte("{}"))
+	if !errors.As(err, &kerr) || kerr.Code != errUnknownTopic {
+		t.Errorf("expected an unknown topic error, got %v", err)
+	}
+}
+
+func TestProduceSASL(t *testing.T) {
+	broker := newFakeBroker(t, map[string]int32{"drift": 1}, "\x00helmfire\x00s3cr3t")
+
+	// Unreachable brokers are skipped
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closed.Close()
+	producer, err := NewProducer([]string{closed.Addr().String(), broker.listener.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	producer.SetSASLPlain("helmfire", "s3cr3t")
+	if err := producer.Produce(context.Background(), "drift", []byte("k"), []byte("v")); err != nil {
+		t.Fatalf("Produce() failed: %v", err)
+	}
+
+	producer.SetSASLPlain("helmfire", "wrong")
+	var kerr *Error
+	err = producer.Produce(context.Background(), "drift", []byte("k"), []byte("v"))
+	if !errors.As(err, &kerr) || kerr.Code != 58 {
+		t.Errorf("expected an authentication error, got %v", err)
+	}
+}
+
+func TestNewProducer(t *testing.T) {
+	producer, err := NewProducer([]string{"kafka-1,kafka-2:9093", " kafka-3:9094 "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"kafka-1:9092", "kafka-2:9093", "kafka-3:9094"}
+	if len(producer.brokers) != 3 || producer.brokers[0] != want[0] || producer.brokers[1] != want[1] || producer.brokers[2] != want[2] {
+		t.Errorf("brokers = %v, want %v", producer.brokers, want)
+	}
+
+	for _, brokers := range [][]string{nil, {""}, {"kafka://broker:9092"}} {
+		if _, err := NewProducer(brokers); err == nil {
+			t.Errorf("NewProducer(%q) succeeded, want error", brokers)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"time"
+)
+
+// API keys and the versions of them the producer speaks. These are the
+// oldest versions Kafka 4 still accepts, which brokers since 1.0 support.
+const (
+	apiProduce          int16 = 0
+	apiMetadata         int16 = 3
+	apiSaslHandshake    int16 = 17
+	apiSaslAuthenticate int16 = 36
+
+	produceVersion          int16 = 3
+	metadataVersion         int16 = 4
+	saslHandshakeVersion    int16 = 1
+	saslAuthenticateVersion int16 = 0
+)
+
+// Error codes the producer handles
+const (
+	errNone               int16 = 0
+	errUnknownTopic       int16 = 3
+	errLeaderNotAvailable int16 = 5
+)
+
+// errorNames names the error codes a producer is likely to meet
+var errorNames = map[int16]string{
+	2:  "CORRUPT_MESSAGE",
+	3:  "UNKNOWN_TOPIC_OR_PARTITION",
+	5:  "LEADER_NOT_AVAILABLE",
+	6:  "NOT_LEADER_OR_FOLLOWER",
+	7:  "REQUEST_TIMED_OUT",
+	10: "MESSAGE_TOO_LARGE",
+	19: "NOT_ENOUGH_REPLICAS",
+	29: "TOPIC_AUTHORIZATION_FAILED",
+	31: "CLUSTER_AUTHORIZATION_FAILED",
+	33: "UNSUPPORTED_SASL_MECHANISM",
+	34: "ILLEGAL_SASL_STATE",
+	35: "UNSUPPORTED_VERSION",
+	58: "SASL_AUTHENTICATION_FAILED",
+}
+
+// Error is an error code a broker answered with
+type Error struct {
+	Code    int16
+	Message string // the broker's message, if any
+}
+
+func (e *Error) Error() string {
+	name := errorNames[e.Code]
+	if name == "" {
+		name = "error"
+	}
+	if e.Message != "" {
+		return fmt.Sprintf("kafka: %s (code %d): %s", name, e.Code, e.Message)
+	}
+	return fmt.Sprintf("kafka: %s (code %d)", name, e.Code)
+}
+
+// encoder appends the protocol's primitive types to a buffer
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) int8(v int8)   { e.b = append(e.b, byte(v)) }
+func (e *encoder) int16(v int16) { e.b = binary.BigEndian.AppendUint16(e.b, uint16(v)) }
+func (e *encoder) int32(v int32) { e.b = binary.BigEndian.AppendUint32(e.b, uint32(v)) }
+func (e *encoder) int64(v int64) { e.b = binary.BigEndian.AppendUint64(e.b, uint64(v)) }
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.int8(1)
+	} else {
+		e.int8(0)
+	}
+}
+
+func (e *encoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.b = append(e.b, s...)
+}
+
+// nullString encodes a nullable string that is null
+func (e *encoder) nullString() { e.int16(-1) }
+
+func (e *encoder) bytes(b []byte) {
+	e.int32(int32(len(b)))
+	e.b = append(e.b, b...)
+}
+
+// varint encodes a zigzag varint, as records do
+func (e *encoder) varint(v int64) { e.b = binary.AppendVarint(e.b, v) }
+
+// varbytes encodes bytes prefixed by their varint length, -1 for nil
+func (e *encoder) varbytes(b []byte) {
+	if b == nil {
+		e.varint(-1)
+		return
+	}
+	e.varint(int64(len(b)))
+	e.b = append(e.b, b...)
+}
+
+// errShort is returned when a response ends early
+var errShort = errors.New("kafka: response too short")
+
+// decoder reads the protocol's primitive types, remembering the first
+// error so callers check it once
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.b) < n {
+		d.err = errShort
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) int8() int8 {
+	if b := d.take(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (d *decoder) int16() int16 {
+	if b := d.take(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *decoder) int32() int32 {
+	if b := d.take(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *decoder) int64() int64 {
+	if b := d.take(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (d *decoder) bool() bool { return d.int8() != 0 }
+
+// string reads a string, "" when null
+func (d *decoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.take(int(n)))
+}
+
+// bytes reads bytes, nil when null
+func (d *decoder) bytes() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+	return d.take(int(n))
+}
+
+// array reads an array length, 0 when null
+func (d *decoder) array() int {
+	n := d.int32()
+	if n < 0 || d.err != nil {
+		return 0
+	}
+	if int(n) > len(d.b) {
+		d.err = errShort
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = errShort
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+// castagnoli is the CRC-32C table record batches are checksummed with
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// recordBatch encodes a record batch (magic 2) of one record
+func recordBatch(key, value []byte, at time.Time) []byte {
+	var record encoder
+	record.int8(0)   // attributes
+	record.varint(0) // timestamp delta
+	record.varint(0) // offset delta
+	record.varbytes(key)
+	record.varbytes(value)
+	record.varint(0) // headers
+
+	// The checksummed part, from the attributes on
+	var body encoder
+	body.int16(0) // attributes: no compression, create time
+	body.int32(0) // last offset delta
+	timestamp := at.UnixMilli()
+	body.int64(timestamp) // base timestamp
+	body.int64(timestamp) // max timestamp
+	body.int64(-1)        // producer ID: not idempotent
+	body.int16(-1)        // producer epoch
+	body.int32(-1)        // base sequence
+	body.int32(1)         // records
+	body.varint(int64(len(record.b)))
+	body.b = append(body.b, record.b...)
+
+	var batch encoder
+	batch.int64(0)                              // base offset, assigned by the broker
+	batch.int32(int32(4 + 1 + 4 + len(body.b))) // length after this field
+	batch.int32(-1)                             // partition leader epoch
+	batch.int8(2)                               // magic
+	batch.b = binary.BigEndian.AppendUint32(batch.b, crc32.Checksum(body.b, castagnoli))
+	batch.b = append(batch.b, body.b...)
+	return batch.b
+}
@@ -0,0 +1,174 @@
+// Package kubeauth recognizes Kubernetes authentication failures in the
+// output of helm and kubectl, and refreshes expired credentials, such as
+// OIDC tokens, by running the exec credential plugin of the kubeconfig
+package kubeauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// authMessages are what helm, kubectl and credential plugins report when
+// the API server rejects or can't get credentials
+var authMessages = []string{
+	"unauthorized",
+	"you must be logged in to the server",
+	"the server has asked for the client to provide credentials",
+	"token is expired",
+	"token has expired",
+	"refresh token is invalid",
+	"getting credentials: exec:",
+	"failed to refresh token",
+}
+
+// IsAuthError reports whether err says the cluster rejected or couldn't be
+// sent credentials
+func IsAuthError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, m := range authMessages {
+		if strings.Contains(msg, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrNoExecPlugin is returned by Refresh when the kubeconfig user doesn't
+// get credentials from an exec plugin
+var ErrNoExecPlugin = errors.New("kubeconfig user has no exec credential plugin")
+
+// execInfoEnv passes the ExecCredential request to a plugin
+const execInfoEnv = "KUBERNETES_EXEC_INFO"
+
+// Credential describes the credential a plugin returned
+type Credential struct {
+	ExpiresAt time.Time // zero when the plugin didn't say
+}
+
+// Refresher runs the exec credential plugin of a kubeconfig context
+type Refresher struct {
+	kubectl     string
+	kubeContext string
+	timeout     time.Duration
+}
+
+// NewRefresher creates a refresher for the current context, reading the
+// kubeconfig with kubectl on PATH
+func NewRefresher() *Refresher {
+	return &Refresher{kubectl: "kubectl", timeout: time.Minute}
+}
+
+// SetKubectl sets the kubectl binary used to read the kubeconfig
+func (r *Refresher) SetKubectl(binary string) {
+	r.kubectl = binary
+}
+
+// SetKubeContext selects the kubeconfig context; the current one when empty
+func (r *Refresher) SetKubeContext(kubeContext string) {
+	r.kubeContext = kubeContext
+}
+
+// execConfig is the exec section of a kubeconfig user
+type execConfig struct {
+	APIVersion string   `json:"apiVersion"`
+	Command    string   `json:"command"`
+	Args       []string `json:"args"`
+	Env        []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"env"`
+}
+
+// Refresh runs the exec plugin of the context's user non-interactively, so
+// that plugins caching tokens, such as kubelogin, renew them, and checks
+// that it returned an unexpired credential
+func (r *Refresher) Refresh(ctx context.Context) (Credential, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	plugin, err := r.execPlugin(ctx)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	apiVersion := plugin.APIVersion
+	if apiVersion == "" {
+		apiVersion = "client.authentication.k8s.io/v1"
+	}
+	info, err := json.Marshal(map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       "ExecCredential",
+		"spec":       map[string]interface{}{"interactive": false},
+	})
+	if err != nil {
+		return Credential{}, err
+	}
+
+	cmd := exec.CommandContext(ctx, plugin.Command, plugin.Args...)
+	cmd.Env = append(os.Environ(), execInfoEnv+"="+string(info))
+	for _, env := range plugin.Env {
+		cmd.Env = append(cmd.Env, env.Name+"="+env.Value)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return Credential{}, fmt.Errorf("credential plugin %s failed: %w (stderr: %s)", plugin.Command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var credential struct {
+		Status struct {
+			Token                 string    `json:"token"`
+			ClientCertificateData string    `json:"clientCertificateData"`
+			ExpirationTimestamp   time.Time `json:"expirationTimestamp"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &credential); err != nil {
+		return Credential{}, fmt.Errorf("credential plugin %s returned an invalid ExecCredential: %w", plugin.Command, err)
+	}
+	status := credential.Status
+	if status.Token == "" && status.ClientCertificateData == "" {
+		return Credential{}, fmt.Errorf("credential plugin %s returned no credential", plugin.Command)
+	}
+	if !status.ExpirationTimestamp.IsZero() && status.ExpirationTimestamp.Before(time.Now()) {
+		return Credential{}, fmt.Errorf("credential plugin %s returned a credential that expired at %s", plugin.Command, status.ExpirationTimestamp.Format(time.RFC3339))
+	}
+	return Credential{ExpiresAt: status.ExpirationTimestamp}, nil
+}
+
+// execPlugin returns the exec plugin of the context's user
+func (r *Refresher) execPlugin(ctx context.Context) (execConfig, error) {
+	args := []string{"config", "view", "--minify", "--raw", "-o", "json"}
+	if r.kubeContext != "" {
+		args = append(args, "--context", r.kubeContext)
+	}
+	out, err := exec.CommandContext(ctx, r.kubectl, args...).Output()
+	if err != nil {
+		return execConfig{}, fmt.Errorf("failed to read kubeconfig: %w", err)
+	}
+
+	var config struct {
+		Users []struct {
+			User struct {
+				Exec *execConfig `json:"exec"`
+			} `json:"user"`
+		} `json:"users"`
+	}
+	if err := json.Unmarshal(out, &config); err != nil {
+		return execConfig{}, fmt.Errorf("failed to parse kubeconfig: %w", err)
+	}
+	if len(config.Users) == 0 || config.Users[0].User.Exec == nil || config.Users[0].User.Exec.Command == "" {
+		return execConfig{}, ErrNoExecPlugin
+	}
+	return *config.Users[0].User.Exec, nil
+}
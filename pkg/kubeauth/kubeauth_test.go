@@ -0,0 +1,83 @@
+package kubeauth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsAuthError(t *testing.T) {
+	for msg, want := range map[string]bool{
+		"error: You must be logged in to the server (Unauthorized)":                                  true,
+		"Kubernetes cluster unreachable: the server has asked for the client to provide credentials": true,
+		"getting credentials: exec: executable kubelogin failed with exit code 1":                    true,
+		"oidc: token is expired": true,
+		"Error: release web failed: timed out waiting for the condition": false,
+		"pods is forbidden: User \"dev\" cannot list resource \"pods\"":  false,
+	} {
+		if got := IsAuthError(errors.New(msg)); got != want {
+			t.Errorf("IsAuthError(%q) = %v, want %v", msg, got, want)
+		}
+	}
+	if IsAuthError(nil) {
+		t.Error("expected nil not to be an auth error")
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake kubectl script requires a POSIX shell")
+	}
+
+	// Fake kubectl prints a kubeconfig whose user runs the fake plugin,
+	// which echoes its exec info and returns a token expiring at $EXPIRY
+	dir := t.TempDir()
+	plugin := filepath.Join(dir, "kubelogin")
+	info := filepath.Join(dir, "info")
+	pluginScript := `#!/bin/sh
+echo "$KUBERNETES_EXEC_INFO $OIDC_ISSUER $*" > ` + info + `
+echo '{"apiVersion":"client.authentication.k8s.io/v1","kind":"ExecCredential","status":{"token":"t","expirationTimestamp":"'$EXPIRY'"}}'
+`
+	if err := os.WriteFile(plugin, []byte(pluginScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+	kubectl := filepath.Join(dir, "kubectl")
+	kubectlScript := `#!/bin/sh
+echo '{"users":[{"name":"oidc","user":{"exec":{"apiVersion":"client.authentication.k8s.io/v1","command":"` + plugin + `","args":["get-token"],"env":[{"name":"OIDC_ISSUER","value":"https://issuer"}]}}}]}'
+`
+	if err := os.WriteFile(kubectl, []byte(kubectlScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRefresher()
+	r.SetKubectl(kubectl)
+
+	expiry := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	t.Setenv("EXPIRY", expiry.Format(time.RFC3339))
+	credential, err := r.Refresh(context.Background())
+	if err != nil || !credential.ExpiresAt.Equal(expiry) {
+		t.Fatalf("expected a credential expiring at %s, got %+v %v", expiry, credential, err)
+	}
+	data, _ := os.ReadFile(info)
+	if !strings.Contains(string(data), `"interactive":false`) || !strings.Contains(string(data), "https://issuer get-token") {
+		t.Errorf("expected the plugin run non-interactively with its env and args, got %s", data)
+	}
+
+	t.Setenv("EXPIRY", time.Now().Add(-time.Hour).UTC().Format(time.RFC3339))
+	if _, err := r.Refresh(context.Background()); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("expected an expired credential error, got %v", err)
+	}
+
+	// A user without an exec plugin can't be refreshed
+	if err := os.WriteFile(kubectl, []byte("#!/bin/sh\necho '{\"users\":[{\"name\":\"admin\",\"user\":{\"token\":\"x\"}}]}'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Refresh(context.Background()); !errors.Is(err, ErrNoExecPlugin) {
+		t.Errorf("expected ErrNoExecPlugin, got %v", err)
+	}
+}
@@ -0,0 +1,366 @@
+package leader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultLeaseName is the Lease object used when none is configured
+	DefaultLeaseName = "helmfire"
+
+	// DefaultLeaseDuration is how long a lease is valid without renewal
+	DefaultLeaseDuration = 15 * time.Second
+
+	// DefaultRetryPeriod is how often the lease is acquired or renewed
+	DefaultRetryPeriod = 2 * time.Second
+)
+
+// microTime is the Kubernetes MicroTime wire format
+const microTime = "2006-01-02T15:04:05.000000Z07:00"
+
+// errLeaseNotFound is returned by a leaseClient when the lease does not exist
+var errLeaseNotFound = errors.New("lease not found")
+
+// errConflict is returned by a leaseClient when the lease changed since it was read
+var errConflict = errors.New("lease was modified")
+
+// Config configures leader election
+type Config struct {
+	LeaseName     string
+	Namespace     string
+	Identity      string
+	KubeContext   string
+	Kubectl       string
+	LeaseDuration time.Duration
+	RetryPeriod   time.Duration
+
+	// OnStartedLeading runs when this instance becomes the leader. ctx is
+	// cancelled when leadership is lost.
+	OnStartedLeading func(ctx context.Context)
+	// OnStoppedLeading runs when this instance loses leadership
+	OnStoppedLeading func()
+}
+
+// Elector runs lease-based leader election against a coordination.k8s.io
+// Lease. Only the instance holding the lease should perform writes.
+type Elector struct {
+	config Config
+	client leaseClient
+	logger *zap.Logger
+
+	mu      sync.RWMutex
+	leader  bool
+	cancel  context.CancelFunc
+	renewed time.Time
+}
+
+// NewElector creates a leader elector, applying defaults to config
+func NewElector(config Config, logger *zap.Logger) (*Elector, error) {
+	if config.Identity == "" {
+		return nil, fmt.Errorf("leader election requires an identity")
+	}
+	if config.Namespace == "" {
+		return nil, fmt.Errorf("leader election requires a namespace")
+	}
+	if config.LeaseName == "" {
+		config.LeaseName = DefaultLeaseName
+	}
+	if config.Kubectl == "" {
+		config.Kubectl = "kubectl"
+	}
+	if config.LeaseDuration <= 0 {
+		config.LeaseDuration = DefaultLeaseDuration
+	}
+	if config.RetryPeriod <= 0 {
+		config.RetryPeriod = DefaultRetryPeriod
+	}
+	if config.RetryPeriod >= config.LeaseDuration {
+		return nil, fmt.Errorf("retry period %s must be shorter than lease duration %s", config.RetryPeriod, config.LeaseDuration)
+	}
+
+	return &Elector{
+		config: config,
+		client: &kubectlLeaseClient{
+			kubectl:     config.Kubectl,
+			kubeContext: config.KubeContext,
+			namespace:   config.Namespace,
+		},
+		logger: logger,
+	}, nil
+}
+
+// IsLeader reports whether this instance currently holds the lease
+func (e *Elector) IsLeader() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.leader
+}
+
+// Identity returns the identity this instance holds the lease as
+func (e *Elector) Identity() string {
+	return e.config.Identity
+}
+
+// Run acquires and renews the lease until ctx is done. On return, leadership
+// is given up and the lease is released so another instance can take over
+// without waiting for it to expire.
+func (e *Elector) Run(ctx context.Context) {
+	e.logger.Info("starting leader election",
+		zap.String("lease", e.config.Namespace+"/"+e.config.LeaseName),
+		zap.String("identity", e.config.Identity))
+
+	ticker := time.NewTicker(e.config.RetryPeriod)
+	defer ticker.Stop()
+
+	for {
+		e.tryAcquireOrRenew(ctx)
+
+		select {
+		case <-ctx.Done():
+			if e.IsLeader() {
+				e.release()
+				e.setLeader(ctx, false)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tryAcquireOrRenew updates the lease and leadership state once
+func (e *Elector) tryAcquireOrRenew(ctx context.Context) {
+	now := time.Now()
+	acquired, err := e.acquireOrRenew(now)
+	if err != nil {
+		e.logger.Warn("leader election attempt failed", zap.Error(err))
+
+		// Ride out transient errors while the lease is still ours, stepping
+		// down one retry period before another instance could take it over
+		if e.IsLeader() && now.Sub(e.renewed) < e.config.LeaseDuration-e.config.RetryPeriod {
+			return
+		}
+	}
+
+	if acquired {
+		e.renewed = now
+	}
+	e.setLeader(ctx, acquired)
+}
+
+// acquireOrRenew takes the lease if it is free, expired or already ours
+func (e *Elector) acquireOrRenew(now time.Time) (bool, error) {
+	l, err := e.client.Get(e.config.LeaseName)
+	if errors.Is(err, errLeaseNotFound) {
+		l = newLease(e.config.LeaseName, e.config.Namespace)
+		e.take(l, now)
+		if err := e.client.Create(l); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	holder := l.Spec.HolderIdentity
+	if holder != "" && holder != e.config.Identity && !l.expired(now) {
+		return false, nil
+	}
+
+	if holder == e.config.Identity {
+		l.Spec.RenewTime = now.UTC().Format(microTime)
+		l.Spec.LeaseDurationSeconds = int(e.config.LeaseDuration.Seconds())
+	} else {
+		e.take(l, now)
+		l.Spec.LeaseTransitions++
+	}
+
+	if err := e.client.Update(l); err != nil {
+		if errors.Is(err, errConflict) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// take sets this instance as the lease holder
+func (e *Elector) take(l *lease, now time.Time) {
+	ts := now.UTC().Format(microTime)
+	l.Spec.HolderIdentity = e.config.Identity
+	l.Spec.LeaseDurationSeconds = int(e.config.LeaseDuration.Seconds())
+	l.Spec.AcquireTime = ts
+	l.Spec.RenewTime = ts
+}
+
+// release clears the holder so another instance can acquire the lease immediately
+func (e *Elector) release() {
+	l, err := e.client.Get(e.config.LeaseName)
+	if err != nil || l.Spec.HolderIdentity != e.config.Identity {
+		return
+	}
+
+	l.Spec.HolderIdentity = ""
+	if err := e.client.Update(l); err != nil {
+		e.logger.Warn("failed to release lease", zap.Error(err))
+	}
+}
+
+// setLeader records the leadership state and runs callbacks on transitions
+func (e *Elector) setLeader(ctx context.Context, leader bool) {
+	e.mu.Lock()
+	if e.leader == leader {
+		e.mu.Unlock()
+		return
+	}
+	e.leader = leader
+
+	var leadCtx context.Context
+	if leader {
+		leadCtx, e.cancel = context.WithCancel(ctx)
+	} else if e.cancel != nil {
+		e.cancel()
+		e.cancel = nil
+	}
+	e.mu.Unlock()
+
+	if leader {
+		e.logger.Info("acquired leadership", zap.String("identity", e.config.Identity))
+		if e.config.OnStartedLeading != nil {
+			e.config.OnStartedLeading(leadCtx)
+		}
+		return
+	}
+
+	e.logger.Info("lost leadership", zap.String("identity", e.config.Identity))
+	if e.config.OnStoppedLeading != nil {
+		e.config.OnStoppedLeading()
+	}
+}
+
+// lease is the subset of a coordination.k8s.io/v1 Lease used for election
+type lease struct {
+	APIVersion string        `json:"apiVersion"`
+	Kind       string        `json:"kind"`
+	Metadata   leaseMetadata `json:"metadata"`
+	Spec       leaseSpec     `json:"spec"`
+}
+
+type leaseMetadata struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+}
+
+// newLease creates an empty lease object
+func newLease(name, namespace string) *lease {
+	return &lease{
+		APIVersion: "coordination.k8s.io/v1",
+		Kind:       "Lease",
+		Metadata:   leaseMetadata{Name: name, Namespace: namespace},
+	}
+}
+
+// expired reports whether the holder failed to renew the lease in time
+func (l *lease) expired(now time.Time) bool {
+	renewed, err := time.Parse(time.RFC3339Nano, l.Spec.RenewTime)
+	if err != nil {
+		return true
+	}
+	return now.After(renewed.Add(time.Duration(l.Spec.LeaseDurationSeconds) * time.Second))
+}
+
+// leaseClient reads and writes Lease objects
+type leaseClient interface {
+	Get(name string) (*lease, error)
+	Create(l *lease) error
+	Update(l *lease) error
+}
+
+// kubectlLeaseClient manages leases with kubectl
+type kubectlLeaseClient struct {
+	kubectl     string
+	kubeContext string
+	namespace   string
+}
+
+func (c *kubectlLeaseClient) Get(name string) (*lease, error) {
+	out, err := c.run(nil, "get", "lease", name, "--namespace", c.namespace, "-o", "json")
+	if err != nil {
+		if strings.Contains(err.Error(), "NotFound") {
+			return nil, errLeaseNotFound
+		}
+		return nil, err
+	}
+
+	var l lease
+	if err := json.Unmarshal(out, &l); err != nil {
+		return nil, fmt.Errorf("failed to parse lease: %w", err)
+	}
+	return &l, nil
+}
+
+func (c *kubectlLeaseClient) Create(l *lease) error {
+	_, err := c.apply("create", l)
+	return err
+}
+
+// Update replaces the lease. The resourceVersion from Get makes this fail with
+// a conflict when another instance updated the lease first.
+func (c *kubectlLeaseClient) Update(l *lease) error {
+	_, err := c.apply("replace", l)
+	if err != nil && strings.Contains(err.Error(), "Conflict") {
+		return errConflict
+	}
+	return err
+}
+
+func (c *kubectlLeaseClient) apply(verb string, l *lease) ([]byte, error) {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal lease: %w", err)
+	}
+	return c.run(data, verb, "-f", "-")
+}
+
+func (c *kubectlLeaseClient) run(stdin []byte, args ...string) ([]byte, error) {
+	verb := args[0]
+	if c.kubeContext != "" {
+		args = append([]string{"--context", c.kubeContext}, args...)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, c.kubectl, args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("kubectl %s: %w (stderr: %s)", verb, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
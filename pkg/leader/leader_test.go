@@ -0,0 +1,169 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// memoryLeaseClient stores a single lease in memory, mimicking resourceVersion conflicts
+type memoryLeaseClient struct {
+	lease   *lease
+	version int
+	err     error
+}
+
+func (c *memoryLeaseClient) Get(name string) (*lease, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	if c.lease == nil {
+		return nil, errLeaseNotFound
+	}
+	copied := *c.lease
+	return &copied, nil
+}
+
+func (c *memoryLeaseClient) Create(l *lease) error {
+	if c.lease != nil {
+		return errors.New("already exists")
+	}
+	return c.store(l)
+}
+
+func (c *memoryLeaseClient) Update(l *lease) error {
+	if c.err != nil {
+		return c.err
+	}
+	if c.lease == nil || l.Metadata.ResourceVersion != c.lease.Metadata.ResourceVersion {
+		return errConflict
+	}
+	return c.store(l)
+}
+
+func (c *memoryLeaseClient) store(l *lease) error {
+	c.version++
+	copied := *l
+	copied.Metadata.ResourceVersion = strconv.Itoa(c.version)
+	c.lease = &copied
+	return nil
+}
+
+func newTestElector(t *testing.T, identity string, client leaseClient) *Elector {
+	t.Helper()
+
+	e, err := NewElector(Config{Identity: identity, Namespace: "helmfire"}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewElector failed: %v", err)
+	}
+	e.client = client
+	return e
+}
+
+func TestAcquireOrRenew(t *testing.T) {
+	client := &memoryLeaseClient{}
+	a := newTestElector(t, "pod-a", client)
+	b := newTestElector(t, "pod-b", client)
+	now := time.Now()
+
+	if ok, err := a.acquireOrRenew(now); !ok || err != nil {
+		t.Fatalf("expected pod-a to create and acquire lease, got %v %v", ok, err)
+	}
+	if ok, _ := b.acquireOrRenew(now.Add(time.Second)); ok {
+		t.Fatal("expected pod-b not to acquire a held lease")
+	}
+	if ok, _ := a.acquireOrRenew(now.Add(5 * time.Second)); !ok {
+		t.Fatal("expected pod-a to renew its lease")
+	}
+
+	// pod-a stops renewing; pod-b takes over once the lease expires
+	if ok, _ := b.acquireOrRenew(now.Add(5*time.Second + DefaultLeaseDuration + time.Second)); !ok {
+		t.Fatal("expected pod-b to acquire expired lease")
+	}
+	if client.lease.Spec.HolderIdentity != "pod-b" || client.lease.Spec.LeaseTransitions != 1 {
+		t.Errorf("unexpected lease state: %+v", client.lease.Spec)
+	}
+}
+
+func TestAcquireOrRenewConflict(t *testing.T) {
+	client := &memoryLeaseClient{}
+	a := newTestElector(t, "pod-a", client)
+	a.acquireOrRenew(time.Now())
+
+	// Another writer bumps the resource version between get and update
+	stale, _ := client.Get(DefaultLeaseName)
+	client.store(client.lease)
+	stale.Spec.HolderIdentity = "pod-b"
+	if err := client.Update(stale); !errors.Is(err, errConflict) {
+		t.Fatalf("expected conflict, got %v", err)
+	}
+}
+
+func TestLeadershipCallbacks(t *testing.T) {
+	client := &memoryLeaseClient{}
+	a := newTestElector(t, "pod-a", client)
+
+	var started, stopped int
+	var leadCtx context.Context
+	a.config.OnStartedLeading = func(ctx context.Context) {
+		started++
+		leadCtx = ctx
+	}
+	a.config.OnStoppedLeading = func() { stopped++ }
+
+	ctx := context.Background()
+	a.tryAcquireOrRenew(ctx)
+	a.tryAcquireOrRenew(ctx)
+	if !a.IsLeader() || started != 1 {
+		t.Fatalf("expected a single leadership start, got leader=%v started=%d", a.IsLeader(), started)
+	}
+
+	// Transient errors don't drop leadership while the lease is valid
+	client.err = errors.New("connection refused")
+	a.tryAcquireOrRenew(ctx)
+	if !a.IsLeader() {
+		t.Fatal("expected leadership to survive a transient error")
+	}
+
+	// Once renewal has been failing for too long, step down
+	a.renewed = time.Now().Add(-DefaultLeaseDuration)
+	a.tryAcquireOrRenew(ctx)
+	if a.IsLeader() || stopped != 1 {
+		t.Fatalf("expected to step down, got leader=%v stopped=%d", a.IsLeader(), stopped)
+	}
+	if leadCtx.Err() == nil {
+		t.Error("expected leadership context to be cancelled")
+	}
+}
+
+func TestRunReleasesLease(t *testing.T) {
+	client := &memoryLeaseClient{}
+	a := newTestElector(t, "pod-a", client)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.config.OnStartedLeading = func(context.Context) { cancel() }
+	a.Run(ctx)
+
+	if a.IsLeader() {
+		t.Error("expected leadership to end when Run returns")
+	}
+	if client.lease.Spec.HolderIdentity != "" {
+		t.Errorf("expected lease to be released, held by %q", client.lease.Spec.HolderIdentity)
+	}
+}
+
+func TestNewElectorValidation(t *testing.T) {
+	if _, err := NewElector(Config{Namespace: "helmfire"}, zap.NewNop()); err == nil {
+		t.Error("expected error without identity")
+	}
+	if _, err := NewElector(Config{Identity: "pod-a"}, zap.NewNop()); err == nil {
+		t.Error("expected error without namespace")
+	}
+	if _, err := NewElector(Config{Identity: "pod-a", Namespace: "helmfire", RetryPeriod: time.Minute}, zap.NewNop()); err == nil {
+		t.Error("expected error when retry period exceeds lease duration")
+	}
+}
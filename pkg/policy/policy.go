@@ -0,0 +1,208 @@
+// Package policy evaluates Rego policies against rendered manifests with the
+// opa CLI before they are applied
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Package is the Rego package policies are written in. Its deny and warn
+// rules are evaluated once per resource, with the resource as input, and
+// each produce a set of messages.
+const Package = "helmfire"
+
+// DefaultBinary is the opa executable used when none is configured
+const DefaultBinary = "opa"
+
+// Mode decides what deny rules do
+type Mode string
+
+const (
+	// ModeEnforce blocks the sync of a release that violates a deny rule
+	ModeEnforce Mode = "enforce"
+	// ModeWarn reports deny violations like warnings and syncs anyway
+	ModeWarn Mode = "warn"
+)
+
+// ParseMode parses enforce or warn
+func ParseMode(s string) (Mode, error) {
+	switch mode := Mode(s); mode {
+	case ModeEnforce, ModeWarn:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid policy mode %q: must be enforce or warn", s)
+}
+
+// Checker evaluates the policies in Dir. The zero value checks nothing.
+type Checker struct {
+	Dir    string
+	Mode   Mode
+	Binary string
+}
+
+// Enabled reports whether any policies are configured
+func (c Checker) Enabled() bool {
+	return c.Dir != ""
+}
+
+// Violation is a message from a deny or warn rule about one resource
+type Violation struct {
+	Resource string `json:"resource"`
+	Message  string `json:"message"`
+}
+
+func (v Violation) String() string {
+	return v.Resource + ": " + v.Message
+}
+
+// Result holds the violations found in a set of manifests
+type Result struct {
+	Denied   []Violation `json:"denied,omitempty"`
+	Warnings []Violation `json:"warnings,omitempty"`
+}
+
+// Blocked reports whether the result blocks a sync in mode
+func (r *Result) Blocked(mode Mode) bool {
+	return mode != ModeWarn && len(r.Denied) > 0
+}
+
+// ViolationError is returned when policies block the sync of a release
+type ViolationError struct {
+	Release    string
+	Violations []Violation
+}
+
+func (e *ViolationError) Error() string {
+	lines := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		lines[i] = v.String()
+	}
+	return fmt.Sprintf("release %s violates %d policy rule(s):\n  %s", e.Release, len(e.Violations), strings.Join(lines, "\n  "))
+}
+
+// query evaluates the deny and warn rules against each resource of the
+// input array
+const query = `[{"index": i, "deny": d, "warn": w} |
+	some i
+	resource := input[i]
+	d := object.get(data.` + Package + `, "deny", set()) with input as resource
+	w := object.get(data.` + Package + `, "warn", set()) with input as resource
+]`
+
+// evaluation is one element of the query result
+type evaluation struct {
+	Index int      `json:"index"`
+	Deny  []string `json:"deny"`
+	Warn  []string `json:"warn"`
+}
+
+// Check evaluates the policies against manifests, a stream of YAML documents
+func (c Checker) Check(ctx context.Context, manifests string) (*Result, error) {
+	resources, err := decodeManifests(manifests)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{}
+	if len(resources) == 0 {
+		return result, nil
+	}
+
+	input, err := json.Marshal(resources)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifests: %w", err)
+	}
+
+	binary := c.Binary
+	if binary == "" {
+		binary = DefaultBinary
+	}
+	cmd := exec.CommandContext(ctx, binary, "eval", "--format", "json", "--stdin-input", "--data", c.Dir, query)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("opa not found (%s): install it from https://www.openpolicyagent.org/docs/latest/#running-opa", binary)
+		}
+		return nil, fmt.Errorf("policy evaluation failed: %w\n%s", err, strings.TrimSpace(stderr.String()+stdout.String()))
+	}
+
+	evaluations, err := parseEval(stdout.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range evaluations {
+		if e.Index < 0 || e.Index >= len(resources) {
+			continue
+		}
+		resource := resourceName(resources[e.Index])
+		for _, msg := range e.Deny {
+			result.Denied = append(result.Denied, Violation{Resource: resource, Message: msg})
+		}
+		for _, msg := range e.Warn {
+			result.Warnings = append(result.Warnings, Violation{Resource: resource, Message: msg})
+		}
+	}
+	return result, nil
+}
+
+// parseEval extracts the query value from opa eval --format json output
+func parseEval(out []byte) ([]evaluation, error) {
+	var output struct {
+		Result []struct {
+			Expressions []struct {
+				Value []evaluation `json:"value"`
+			} `json:"expressions"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(out, &output); err != nil {
+		return nil, fmt.Errorf("failed to parse opa output: %w", err)
+	}
+	if len(output.Result) == 0 || len(output.Result[0].Expressions) == 0 {
+		return nil, nil
+	}
+	return output.Result[0].Expressions[0].Value, nil
+}
+
+// decodeManifests decodes the non-empty documents of a YAML stream
+func decodeManifests(manifests string) ([]map[string]interface{}, error) {
+	var resources []map[string]interface{}
+	dec := yaml.NewDecoder(strings.NewReader(manifests))
+	for {
+		var resource map[string]interface{}
+		err := dec.Decode(&resource)
+		if errors.Is(err, io.EOF) {
+			return resources, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse manifests: %w", err)
+		}
+		if len(resource) > 0 {
+			resources = append(resources, resource)
+		}
+	}
+}
+
+// resourceName returns kind/name of a resource
+func resourceName(resource map[string]interface{}) string {
+	kind, _ := resource["kind"].(string)
+	name := ""
+	if metadata, ok := resource["metadata"].(map[string]interface{}); ok {
+		name, _ = metadata["name"].(string)
+	}
+	if name == "" {
+		return kind
+	}
+	return kind + "/" + name
+}
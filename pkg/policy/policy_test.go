@@ -0,0 +1,116 @@
+package policy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const manifests = `---
+# Source: web/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: nginx
+        image: nginx:latest
+`
+
+func TestParseMode(t *testing.T) {
+	for _, s := range []string{"enforce", "warn"} {
+		if mode, err := ParseMode(s); err != nil || string(mode) != s {
+			t.Errorf("ParseMode(%q) = %q, %v", s, mode, err)
+		}
+	}
+	if _, err := ParseMode("block"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
+
+func TestDecodeManifests(t *testing.T) {
+	resources, err := decodeManifests(manifests + "---\n# empty\n")
+	if err != nil {
+		t.Fatalf("decodeManifests failed: %v", err)
+	}
+	if len(resources) != 2 {
+		t.Fatalf("expected 2 resources, got %d", len(resources))
+	}
+	if resourceName(resources[0]) != "Service/web" || resourceName(resources[1]) != "Deployment/web" {
+		t.Errorf("unexpected resources: %s, %s", resourceName(resources[0]), resourceName(resources[1]))
+	}
+}
+
+func TestCheck(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake opa requires a POSIX shell")
+	}
+
+	// Fake opa: records its arguments and input, denies the deployment and
+	// warns about the service
+	dir := t.TempDir()
+	opa := filepath.Join(dir, "opa")
+	script := `#!/bin/sh
+echo "$@" > ` + dir + `/args
+cat > ` + dir + `/input
+echo '{"result":[{"expressions":[{"value":[{"index":0,"deny":[],"warn":["no owner label"]},{"index":1,"deny":["container nginx uses the latest tag"],"warn":[]}]}]}]}'
+`
+	if err := os.WriteFile(opa, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake opa: %v", err)
+	}
+
+	checker := Checker{Dir: "/policies", Mode: ModeEnforce, Binary: opa}
+	result, err := checker.Check(context.Background(), manifests)
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+
+	if len(result.Denied) != 1 || result.Denied[0] != (Violation{Resource: "Deployment/web", Message: "container nginx uses the latest tag"}) {
+		t.Errorf("unexpected denials: %+v", result.Denied)
+	}
+	if len(result.Warnings) != 1 || result.Warnings[0].Resource != "Service/web" {
+		t.Errorf("unexpected warnings: %+v", result.Warnings)
+	}
+	if !result.Blocked(ModeEnforce) || result.Blocked(ModeWarn) {
+		t.Error("expected the denial to block in enforce mode only")
+	}
+
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	if !strings.HasPrefix(string(args), "eval --format json --stdin-input --data /policies ") {
+		t.Errorf("unexpected opa arguments: %s", args)
+	}
+	input, _ := os.ReadFile(filepath.Join(dir, "input"))
+	if !strings.HasPrefix(string(input), `[{"apiVersion":"v1","kind":"Service"`) {
+		t.Errorf("expected the resources as a JSON array, got %s", input)
+	}
+
+	err = &ViolationError{Release: "web", Violations: result.Denied}
+	if !strings.Contains(err.Error(), "Deployment/web: container nginx uses the latest tag") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestCheckWithoutOPA(t *testing.T) {
+	checker := Checker{Dir: "/policies", Binary: filepath.Join(t.TempDir(), "missing-opa")}
+	_, err := checker.Check(context.Background(), manifests)
+	if err == nil || !strings.Contains(err.Error(), "opa not found") {
+		t.Errorf("expected opa not found, got %v", err)
+	}
+
+	// Nothing to check without resources
+	result, err := checker.Check(context.Background(), "---\n")
+	if err != nil || len(result.Denied) != 0 {
+		t.Errorf("expected an empty result, got %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,234 @@
+package preflight
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const (
+	// EnvHelmBinary overrides the helm binary when no flag is given
+	EnvHelmBinary = "HELMFIRE_HELM"
+
+	// DefaultHelmBinary is looked up on PATH when nothing else is configured
+	DefaultHelmBinary = "helm"
+
+	// DefaultKubectlBinary is looked up on PATH when no kubectl is configured
+	DefaultKubectlBinary = "kubectl"
+
+	// MinHelmVersion is the oldest helm release helmfire is tested against
+	MinHelmVersion = "3.8.0"
+
+	// PluginDiff is the helm-diff plugin used for drift detection
+	PluginDiff = "diff"
+)
+
+// pluginSources maps plugin names to their install URLs for error messages
+var pluginSources = map[string]string{
+	PluginDiff: "https://github.com/databus23/helm-diff",
+}
+
+// Options configures the preflight check
+type Options struct {
+	HelmBinary      string // explicit binary (flag); falls back to HELMFIRE_HELM, then helm on PATH
+	MinVersion      string // minimum helm version; defaults to MinHelmVersion
+	RequiredPlugins []string
+}
+
+// Result describes the helm installation found by the preflight check
+type Result struct {
+	HelmBinary  string
+	HelmVersion string
+	Plugins     map[string]string // plugin name -> version
+}
+
+// Run locates helm, verifies its version and checks required plugins.
+// Errors describe how to fix the problem.
+func Run(opts Options) (*Result, error) {
+	binary, err := ResolveHelmBinary(opts.HelmBinary)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := HelmVersion(binary)
+	if err != nil {
+		return nil, err
+	}
+
+	minVersion := opts.MinVersion
+	if minVersion == "" {
+		minVersion = MinHelmVersion
+	}
+	if CompareVersions(version, minVersion) < 0 {
+		return nil, fmt.Errorf("helm %s is older than the required %s: upgrade helm (https://helm.sh/docs/intro/install/)", version, minVersion)
+	}
+
+	result := &Result{
+		HelmBinary:  binary,
+		HelmVersion: version,
+	}
+
+	if len(opts.RequiredPlugins) == 0 {
+		return result, nil
+	}
+
+	plugins, err := InstalledPlugins(binary)
+	if err != nil {
+		return nil, err
+	}
+	result.Plugins = plugins
+
+	for _, name := range opts.RequiredPlugins {
+		if _, ok := plugins[name]; !ok {
+			return nil, missingPluginError(binary, name)
+		}
+	}
+
+	return result, nil
+}
+
+// ResolveHelmBinary returns the absolute path of the helm binary to use.
+// Precedence: explicit value, HELMFIRE_HELM, helm on PATH.
+func ResolveHelmBinary(binary string) (string, error) {
+	source := "--helm-binary"
+	if binary == "" {
+		binary = os.Getenv(EnvHelmBinary)
+		source = EnvHelmBinary
+	}
+	if binary == "" {
+		binary = DefaultHelmBinary
+		source = "PATH"
+	}
+
+	path, err := exec.LookPath(binary)
+	if err != nil {
+		if source == "PATH" {
+			return "", fmt.Errorf("helm binary not found on PATH: install helm (https://helm.sh/docs/intro/install/) or set --helm-binary / %s", EnvHelmBinary)
+		}
+		return "", fmt.Errorf("helm binary %q (from %s) not found or not executable: %w", binary, source, err)
+	}
+
+	return path, nil
+}
+
+// ResolveKubectlBinary returns the absolute path of the kubectl binary, the
+// one on PATH when binary is empty, for features that run kubectl such as
+// Kubernetes Event notifications
+func ResolveKubectlBinary(binary string) (string, error) {
+	if binary == "" {
+		binary = DefaultKubectlBinary
+	}
+
+	path, err := exec.LookPath(binary)
+	if err != nil {
+		return "", fmt.Errorf("kubectl binary %q not found or not executable: install kubectl (https://kubernetes.io/docs/tasks/tools/): %w", binary, err)
+	}
+
+	return path, nil
+}
+
+// HelmVersion returns the version reported by the helm binary (e.g. "v3.14.0")
+func HelmVersion(binary string) (string, error) {
+	out, err := runBinary(binary, "version", "--template", "{{.Version}}")
+	if err != nil {
+		return "", fmt.Errorf("failed to determine helm version: %w", err)
+	}
+
+	version := strings.TrimSpace(out)
+	if version == "" {
+		return "", fmt.Errorf("failed to determine helm version: empty output from %s version", binary)
+	}
+
+	return version, nil
+}
+
+// InstalledPlugins returns the helm plugins installed for the binary
+func InstalledPlugins(binary string) (map[string]string, error) {
+	out, err := runBinary(binary, "plugin", "list")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list helm plugins: %w", err)
+	}
+
+	return parsePluginList(out), nil
+}
+
+// parsePluginList parses the tabular output of helm plugin list
+func parsePluginList(output string) map[string]string {
+	plugins := make(map[string]string)
+	for i, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if i == 0 && fields[0] == "NAME" {
+			continue
+		}
+
+		version := ""
+		if len(fields) > 1 {
+			version = fields[1]
+		}
+		plugins[fields[0]] = version
+	}
+	return plugins
+}
+
+// missingPluginError builds an actionable error for a missing plugin
+func missingPluginError(binary, name string) error {
+	if source, ok := pluginSources[name]; ok {
+		return fmt.Errorf("helm plugin %q is not installed: run '%s plugin install %s'", name, binary, source)
+	}
+	return fmt.Errorf("helm plugin %q is not installed", name)
+}
+
+// CompareVersions compares two semantic versions, ignoring a leading "v" and
+// any pre-release or build suffix. It returns -1, 0 or 1.
+func CompareVersions(a, b string) int {
+	pa := parseVersion(a)
+	pb := parseVersion(b)
+	for i := 0; i < 3; i++ {
+		if pa[i] < pb[i] {
+			return -1
+		}
+		if pa[i] > pb[i] {
+			return 1
+		}
+	}
+	return 0
+}
+
+// parseVersion splits a version into major, minor and patch numbers
+func parseVersion(version string) [3]int {
+	var parts [3]int
+
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if idx := strings.IndexAny(version, "-+"); idx >= 0 {
+		version = version[:idx]
+	}
+
+	for i, part := range strings.SplitN(version, ".", 3) {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			break
+		}
+		parts[i] = n
+	}
+	return parts
+}
+
+// runBinary runs a binary and returns its stdout
+func runBinary(binary string, args ...string) (string, error) {
+	cmd := exec.Command(binary, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s %s: %w (stderr: %s)", binary, strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
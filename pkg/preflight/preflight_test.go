@@ -0,0 +1,151 @@
+package preflight
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// writeFakeHelm creates a shell script that mimics helm version and plugin list
+func writeFakeHelm(t *testing.T, version, plugins string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	path := filepath.Join(t.TempDir(), "helm")
+	script := `#!/bin/sh
+case "$1" in
+  version) printf '%s' '` + version + `' ;;
+  plugin) printf '%s\n' 'NAME	VERSION	DESCRIPTION' ` + plugins + ` ;;
+esac
+`
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake helm: %v", err)
+	}
+	return path
+}
+
+func TestRun(t *testing.T) {
+	helm := writeFakeHelm(t, "v3.14.2", `'diff	3.9.4	Preview helm upgrade changes as a diff'`)
+
+	result, err := Run(Options{
+		HelmBinary:      helm,
+		RequiredPlugins: []string{PluginDiff},
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if result.HelmBinary != helm {
+		t.Errorf("expected binary %s, got %s", helm, result.HelmBinary)
+	}
+	if result.HelmVersion != "v3.14.2" {
+		t.Errorf("expected version v3.14.2, got %s", result.HelmVersion)
+	}
+	if result.Plugins[PluginDiff] != "3.9.4" {
+		t.Errorf("expected diff plugin 3.9.4, got %q", result.Plugins[PluginDiff])
+	}
+}
+
+func TestRunOldVersion(t *testing.T) {
+	helm := writeFakeHelm(t, "v3.2.0", "")
+
+	_, err := Run(Options{HelmBinary: helm})
+	if err == nil {
+		t.Fatal("expected error for old helm version")
+	}
+	if !strings.Contains(err.Error(), "upgrade helm") {
+		t.Errorf("expected actionable message, got %v", err)
+	}
+}
+
+func TestRunMissingPlugin(t *testing.T) {
+	helm := writeFakeHelm(t, "v3.14.2", "")
+
+	_, err := Run(Options{
+		HelmBinary:      helm,
+		RequiredPlugins: []string{PluginDiff},
+	})
+	if err == nil {
+		t.Fatal("expected error for missing plugin")
+	}
+	if !strings.Contains(err.Error(), "plugin install https://github.com/databus23/helm-diff") {
+		t.Errorf("expected install hint, got %v", err)
+	}
+}
+
+func TestResolveHelmBinaryFromEnv(t *testing.T) {
+	helm := writeFakeHelm(t, "v3.14.2", "")
+	t.Setenv(EnvHelmBinary, helm)
+
+	path, err := ResolveHelmBinary("")
+	if err != nil {
+		t.Fatalf("ResolveHelmBinary failed: %v", err)
+	}
+	if path != helm {
+		t.Errorf("expected %s, got %s", helm, path)
+	}
+}
+
+func TestResolveHelmBinaryMissing(t *testing.T) {
+	_, err := ResolveHelmBinary("/nonexistent/helm")
+	if err == nil {
+		t.Fatal("expected error for missing binary")
+	}
+}
+
+func TestResolveKubectlBinary(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake kubectl script requires a POSIX shell")
+	}
+	kubectl := filepath.Join(t.TempDir(), "kubectl")
+	if err := os.WriteFile(kubectl, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := ResolveKubectlBinary(kubectl)
+	if err != nil {
+		t.Fatalf("ResolveKubectlBinary failed: %v", err)
+	}
+	if path != kubectl {
+		t.Errorf("expected %s, got %s", kubectl, path)
+	}
+
+	if _, err := ResolveKubectlBinary("/nonexistent/kubectl"); err == nil || !strings.Contains(err.Error(), "install kubectl") {
+		t.Errorf("expected an error for missing kubectl, got %v", err)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"v3.14.0", "3.8.0", 1},
+		{"3.8.0", "v3.8.0", 0},
+		{"v3.7.2", "3.8.0", -1},
+		{"v3.8.0-rc.1", "3.8.0", 0},
+		{"v4.0.0+g1234", "3.8.0", 1},
+	}
+
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.expected {
+			t.Errorf("CompareVersions(%s, %s) = %d, expected %d", tt.a, tt.b, got, tt.expected)
+		}
+	}
+}
+
+func TestParsePluginList(t *testing.T) {
+	output := "NAME\tVERSION\tDESCRIPTION\ndiff\t3.9.4\tPreview helm upgrade changes as a diff\nsecrets\t4.5.1\tThis plugin provides secrets values encryption\n"
+
+	plugins := parsePluginList(output)
+	if len(plugins) != 2 {
+		t.Fatalf("expected 2 plugins, got %d", len(plugins))
+	}
+	if plugins["secrets"] != "4.5.1" {
+		t.Errorf("expected secrets 4.5.1, got %q", plugins["secrets"])
+	}
+}
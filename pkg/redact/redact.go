@@ -0,0 +1,192 @@
+// Package redact masks secrets in what helmfire logs, reports and serves:
+// values known to be secret, credentials in command arguments and the data
+// of Secret manifests
+package redact
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Mask replaces redacted secrets
+const Mask = "[redacted]"
+
+// minLength is the length below which values aren't masked, as they would
+// mask unrelated text
+const minLength = 4
+
+// credentialFlags are the command flags whose value is a credential
+var credentialFlags = map[string]bool{
+	"--password": true,
+	"--token":    true,
+}
+
+// Redactor masks the secret values added to it. The nil Redactor masks
+// nothing but credential flags and Secret data.
+type Redactor struct {
+	mu     sync.RWMutex
+	values []string // longest first, so values containing others are masked whole
+}
+
+// New creates a redactor knowing no secrets
+func New() *Redactor {
+	return &Redactor{}
+}
+
+// Add makes the redactor mask values, also when they appear JSON-escaped
+func (r *Redactor) Add(values ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, value := range values {
+		if len(value) < minLength {
+			continue
+		}
+		r.add(value)
+		if quoted, err := json.Marshal(value); err == nil {
+			r.add(string(quoted[1 : len(quoted)-1]))
+		}
+	}
+	sort.SliceStable(r.values, func(i, j int) bool {
+		return len(r.values[i]) > len(r.values[j])
+	})
+}
+
+// add appends value unless known; r.mu must be held
+func (r *Redactor) add(value string) {
+	for _, known := range r.values {
+		if known == value {
+			return
+		}
+	}
+	r.values = append(r.values, value)
+}
+
+// String masks the known secret values in s
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, value := range r.values {
+		s = strings.ReplaceAll(s, value, Mask)
+	}
+	return s
+}
+
+// Bytes masks the known secret values in b
+func (r *Redactor) Bytes(b []byte) []byte {
+	if r == nil {
+		return b
+	}
+	r.mu.RLock()
+	n := len(r.values)
+	r.mu.RUnlock()
+	if n == 0 {
+		return b
+	}
+	return []byte(r.String(string(b)))
+}
+
+// Args returns a copy of command arguments with the values of credential
+// flags, such as --password, and the known secret values masked
+func (r *Redactor) Args(args []string) []string {
+	masked := make([]string, len(args))
+	for i, arg := range args {
+		name, _, inline := strings.Cut(arg, "=")
+		switch {
+		case inline && credentialFlags[name]:
+			masked[i] = name + "=" + Mask
+		case i > 0 && credentialFlags[args[i-1]]:
+			masked[i] = Mask
+		default:
+			masked[i] = r.String(arg)
+		}
+	}
+	return masked
+}
+
+// Manifests masks the data of the Secrets in YAML documents, such as the
+// output of helm template
+func Manifests(s string) string {
+	if !strings.Contains(s, "Secret") {
+		return s
+	}
+
+	lines := strings.Split(s, "\n")
+	start := 0
+	for i := 0; i <= len(lines); i++ {
+		if i < len(lines) && !strings.HasPrefix(lines[i], "---") {
+			continue
+		}
+		doc := lines[start:i]
+		if isSecret(doc) {
+			copy(doc, secretData(doc, 0))
+		}
+		start = i + 1
+	}
+	return strings.Join(lines, "\n")
+}
+
+// isSecret reports whether the lines of a YAML document are a Secret
+func isSecret(doc []string) bool {
+	for _, line := range doc {
+		if strings.TrimRight(line, " \r") == "kind: Secret" {
+			return true
+		}
+	}
+	return false
+}
+
+// DiffLines masks the data in the diff lines of a Secret, each a change
+// marker (+, - or space) followed by YAML
+func DiffLines(lines []string) []string {
+	return secretData(lines, 1)
+}
+
+// secretData masks the values nested under data and stringData in YAML
+// lines, each starting with a marker of width characters
+func secretData(lines []string, width int) []string {
+	out := make([]string, len(lines))
+	dataIndent := -1
+	for i, line := range lines {
+		out[i] = line
+		if len(line) < width {
+			continue
+		}
+		marker, content := line[:width], line[width:]
+		trimmed := strings.TrimLeft(content, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(content) - len(trimmed)
+
+		if dataIndent >= 0 && indent <= dataIndent {
+			dataIndent = -1
+		}
+		if dataIndent < 0 {
+			key, value, _ := strings.Cut(trimmed, ":")
+			if key != "data" && key != "stringData" {
+				continue
+			}
+			if value = strings.TrimSpace(value); value == "" {
+				dataIndent = indent
+			} else if value != "{}" {
+				// Flow style, such as data: {password: c2VjcmV0}
+				out[i] = marker + content[:indent] + key + ": " + Mask
+			}
+			continue
+		}
+
+		key, _, found := strings.Cut(trimmed, ":")
+		if !found {
+			// A continuation of a multi-line value
+			out[i] = marker + content[:indent] + Mask
+			continue
+		}
+		out[i] = marker + content[:indent] + key + ": " + Mask
+	}
+	return out
+}
@@ -0,0 +1,70 @@
+package redact
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactorString(t *testing.T) {
+	r := New()
+	r.Add("hunter2", `pa"ss`+"word", "abc")
+
+	got := r.String(`login failed: hunter2, {"password": "pa\"ssword"}, abc`)
+	want := `login failed: [redacted], {"password": "[redacted]"}, abc`
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	var nilRedactor *Redactor
+	if nilRedactor.String("hunter2") != "hunter2" {
+		t.Error("expected the nil redactor to mask nothing")
+	}
+}
+
+func TestRedactorArgs(t *testing.T) {
+	r := New()
+	r.Add("s3cr3t-token")
+
+	args := []string{"repo", "add", "private", "https://charts.example.com", "--username", "ci", "--password", "p4ss",
+		"--set", "api.key=s3cr3t-token", "--token=abcd"}
+	got := strings.Join(r.Args(args), " ")
+	want := "repo add private https://charts.example.com --username ci --password [redacted] --set api.key=[redacted] --token=[redacted]"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if args[7] != "p4ss" {
+		t.Error("expected the arguments left unchanged")
+	}
+}
+
+func TestManifests(t *testing.T) {
+	manifests := `---
+# Source: web/templates/secret.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: web
+data:
+  password: aHVudGVyMg==
+  tls.crt: |
+    LS0tLS1CRUdJTi
+stringData: {token: abc}
+type: Opaque
+---
+apiVersion: v1
+kind: ConfigMap
+data:
+  password: visible
+`
+	got := Manifests(manifests)
+	for _, secret := range []string{"aHVudGVyMg==", "LS0tLS1CRUdJTi", "abc}"} {
+		if strings.Contains(got, secret) {
+			t.Errorf("expected %s masked, got:\n%s", secret, got)
+		}
+	}
+	for _, line := range []string{"  password: [redacted]", "stringData: [redacted]", "type: Opaque", "  name: web", "  password: visible"} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("expected line %q, got:\n%s", line, got)
+		}
+	}
+}
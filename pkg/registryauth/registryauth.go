@@ -0,0 +1,200 @@
+// Package registryauth finds the credentials of chart repositories and OCI
+// registries where docker keeps them: in the docker config written by
+// docker login, or with the credential helpers it names, such as
+// docker-credential-ecr-login or docker-credential-gcloud
+package registryauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// EnvDockerConfig is the directory of the docker config, ~/.docker when
+// unset, as for docker
+const EnvDockerConfig = "DOCKER_CONFIG"
+
+// HelperNone as a repository's credential helper keeps its credentials
+// from being looked up in the docker config
+const HelperNone = "none"
+
+// dockerHub is the key docker login stores Docker Hub credentials under
+const dockerHub = "https://index.docker.io/v1/"
+
+// notFound is what credential helpers report when they have no
+// credentials for a registry
+const notFound = "credentials not found"
+
+// Credentials authenticate to a registry or repository
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// config is the subset of the docker config naming credentials
+type config struct {
+	Auths       map[string]authEntry `json:"auths"`
+	CredsStore  string               `json:"credsStore"`
+	CredHelpers map[string]string    `json:"credHelpers"`
+}
+
+// authEntry is the credentials docker login stores for a registry in the
+// config itself, base64 user:password in Auth
+type authEntry struct {
+	Auth     string `json:"auth"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// ConfigPath returns the docker config file
+func ConfigPath() string {
+	if dir := os.Getenv(EnvDockerConfig); dir != "" {
+		return filepath.Join(dir, "config.json")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".docker", "config.json")
+}
+
+// Host returns the registry host of a repository or registry URL, such as
+// ghcr.io for oci://ghcr.io/acme/charts
+func Host(url string) string {
+	if _, rest, ok := strings.Cut(url, "://"); ok {
+		url = rest
+	}
+	host, _, _ := strings.Cut(url, "/")
+	host = strings.ToLower(host)
+	switch host {
+	case "docker.io", "index.docker.io", "registry-1.docker.io":
+		return "docker.io"
+	}
+	return host
+}
+
+// Lookup returns the credentials of the registry of url. helper, when
+// set, is the credential helper asked for them over those the docker config
+// names, or HelperNone to not look them up. Like docker, the config's
+// credHelpers entry for the registry is asked first, then its credsStore,
+// then its auths. ok is false when there are none.
+func Lookup(ctx context.Context, url, helper string) (creds Credentials, ok bool, err error) {
+	host := Host(url)
+	if helper == HelperNone || host == "" {
+		return Credentials{}, false, nil
+	}
+	if helper != "" {
+		return fromHelper(ctx, helper, host)
+	}
+
+	cfg, err := loadConfig(ConfigPath())
+	if err != nil || cfg == nil {
+		return Credentials{}, false, err
+	}
+	for key, name := range cfg.CredHelpers {
+		if Host(key) == host {
+			return fromHelper(ctx, name, serverURL(key, host))
+		}
+	}
+	if cfg.CredsStore != "" {
+		creds, ok, err := fromHelper(ctx, cfg.CredsStore, serverURL("", host))
+		if err != nil || ok {
+			return creds, ok, err
+		}
+	}
+	for key, entry := range cfg.Auths {
+		if Host(key) == host {
+			return entry.credentials(key)
+		}
+	}
+	return Credentials{}, false, nil
+}
+
+// loadConfig reads the docker config at path; nil when there is none
+func loadConfig(path string) (*config, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cfg config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse docker config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// serverURL is what a credential helper is asked about host: the key the
+// docker config names it by, or the host itself, Docker Hub's being a URL
+func serverURL(key, host string) string {
+	switch {
+	case key != "":
+		return key
+	case host == "docker.io":
+		return dockerHub
+	}
+	return host
+}
+
+// credentials decodes an auths entry of the registry keyed key
+func (a authEntry) credentials(key string) (Credentials, bool, error) {
+	if a.Auth != "" {
+		decoded, err := base64.StdEncoding.DecodeString(a.Auth)
+		if err != nil {
+			return Credentials{}, false, fmt.Errorf("invalid auth of %s in docker config: %w", key, err)
+		}
+		username, password, ok := strings.Cut(string(decoded), ":")
+		if !ok {
+			return Credentials{}, false, fmt.Errorf("invalid auth of %s in docker config: expected user:password", key)
+		}
+		return Credentials{Username: username, Password: password}, true, nil
+	}
+	if a.Username != "" {
+		return Credentials{Username: a.Username, Password: a.Password}, true, nil
+	}
+	return Credentials{}, false, nil
+}
+
+// helperResponse is what docker-credential-<helper> get prints
+type helperResponse struct {
+	Username string `json:"Username"`
+	Secret   string `json:"Secret"`
+}
+
+// fromHelper asks docker-credential-<helper> for the credentials of server
+func fromHelper(ctx context.Context, helper, server string) (Credentials, bool, error) {
+	command := "docker-credential-" + helper
+	cmd := exec.CommandContext(ctx, command, "get")
+	cmd.Stdin = strings.NewReader(server)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// Helpers print their error on stdout
+		message := strings.TrimSpace(stdout.String() + " " + stderr.String())
+		if strings.Contains(strings.ToLower(message), notFound) {
+			return Credentials{}, false, nil
+		}
+		return Credentials{}, false, fmt.Errorf("%s failed for %s: %w (%s)", command, server, err, message)
+	}
+
+	var response helperResponse
+	if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		return Credentials{}, false, fmt.Errorf("failed to parse the output of %s: %w", command, err)
+	}
+	if response.Secret == "" {
+		return Credentials{}, false, nil
+	}
+	return Credentials{Username: response.Username, Password: response.Secret}, true, nil
+}
@@ -0,0 +1,92 @@
+package registryauth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestHost(t *testing.T) {
+	tests := map[string]string{
+		"oci://ghcr.io/acme/charts":   "ghcr.io",
+		"https://charts.example.com/": "charts.example.com",
+		"registry.example.com:5000":   "registry.example.com:5000",
+		"https://index.docker.io/v1/": "docker.io",
+		"docker.io/acme":              "docker.io",
+	}
+	for url, want := range tests {
+		if got := Host(url); got != want {
+			t.Errorf("Host(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake credential helper requires a POSIX shell")
+	}
+
+	// Fake helpers: ecr-login knows the registries it is asked for, store
+	// knows none
+	dir := t.TempDir()
+	helpers := map[string]string{
+		"docker-credential-ecr-login": `#!/bin/sh
+read server
+echo "{\"ServerURL\":\"$server\",\"Username\":\"AWS\",\"Secret\":\"token-for-$server\"}"
+`,
+		"docker-credential-store": `#!/bin/sh
+echo "credentials not found in native keychain"
+exit 1
+`,
+	}
+	for name, script := range helpers {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	config := `{
+  "auths": {
+    "https://index.docker.io/v1/": {"auth": "YWxpY2U6aHVudGVyMg=="},
+    "charts.example.com": {"username": "bob", "password": "pass"}
+  },
+  "credsStore": "store",
+  "credHelpers": {"123.dkr.ecr.eu-west-1.amazonaws.com": "ecr-login"}
+}`
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(EnvDockerConfig, dir)
+
+	tests := []struct {
+		url    string
+		helper string
+		want   Credentials
+		ok     bool
+	}{
+		{"oci://123.dkr.ecr.eu-west-1.amazonaws.com/charts", "", Credentials{"AWS", "token-for-123.dkr.ecr.eu-west-1.amazonaws.com"}, true},
+		{"docker.io/acme", "", Credentials{"alice", "hunter2"}, true},
+		{"https://charts.example.com", "", Credentials{"bob", "pass"}, true},
+		{"https://charts.example.com", "ecr-login", Credentials{"AWS", "token-for-charts.example.com"}, true},
+		{"https://charts.example.com", HelperNone, Credentials{}, false},
+		{"https://public.example.com", "", Credentials{}, false},
+	}
+	for _, tt := range tests {
+		got, ok, err := Lookup(context.Background(), tt.url, tt.helper)
+		if err != nil || ok != tt.ok || got != tt.want {
+			t.Errorf("Lookup(%q, %q) = %+v, %v, %v, want %+v, %v", tt.url, tt.helper, got, ok, err, tt.want, tt.ok)
+		}
+	}
+
+	if _, _, err := Lookup(context.Background(), "https://charts.example.com", "missing"); err == nil {
+		t.Error("expected a missing credential helper to fail")
+	}
+
+	t.Setenv(EnvDockerConfig, t.TempDir())
+	if _, ok, err := Lookup(context.Background(), "docker.io/acme", ""); ok || err != nil {
+		t.Errorf("expected no credentials without a docker config, got %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,247 @@
+// Package rendercache caches the manifests helm template renders, so the
+// drift checks and syncs of a long-running helmfire don't render the same
+// chart with the same values again.
+package rendercache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+)
+
+// DefaultSize is how many renders a cache keeps by default
+const DefaultSize = 128
+
+// Cache keeps the most recently used renders, up to its size. A nil Cache
+// caches nothing.
+type Cache struct {
+	size int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // most recently used first
+	stats   Stats
+
+	// digests remembers the checksums of the files keys name
+	digests map[string]fileDigest
+}
+
+// Stats counts the lookups of a cache
+type Stats struct {
+	Hits    int `json:"hits"`
+	Misses  int `json:"misses"`
+	Entries int `json:"entries"`
+}
+
+type entry struct {
+	key      string
+	manifest string
+}
+
+type fileDigest struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+// New creates a cache keeping up to size renders; nil when size is not
+// positive
+func New(size int) *Cache {
+	if size <= 0 {
+		return nil
+	}
+	return &Cache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		digests: make(map[string]fileDigest),
+	}
+}
+
+// Render returns the manifest cached for key, or renders it with render and
+// caches it on success. An empty key is rendered without caching.
+func (c *Cache) Render(key string, render func() (string, error)) (string, error) {
+	if c == nil || key == "" {
+		return render()
+	}
+	if manifest, ok := c.get(key); ok {
+		return manifest, nil
+	}
+	manifest, err := render()
+	if err != nil {
+		return "", err
+	}
+	c.put(key, manifest)
+	return manifest, nil
+}
+
+// Stats returns the hits and misses so far and the renders kept
+func (c *Cache) Stats() Stats {
+	if c == nil {
+		return Stats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.order.Len()
+	return stats
+}
+
+func (c *Cache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return "", false
+	}
+	c.stats.Hits++
+	c.order.MoveToFront(elem)
+	return elem.Value.(*entry).manifest, true
+}
+
+func (c *Cache) put(key, manifest string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*entry).manifest = manifest
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&entry{key: key, manifest: manifest})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*entry).key)
+	}
+}
+
+// Key returns the cache key of rendering chart at version with the helm
+// arguments args and environment env, or "" when the render can't be cached:
+// a repository chart without an exact version may render differently once a
+// newer one is published. Arguments and environment values naming files or
+// directories, such as local charts and values files, count by their
+// content too. Files in the temporary directory are per-render copies, so
+// only their content counts.
+func (c *Cache) Key(chart, version string, args, env []string) string {
+	if c == nil {
+		return ""
+	}
+	if _, err := os.Stat(chart); err != nil && !substitute.IsVersion(version) {
+		return ""
+	}
+
+	h := sha256.New()
+	io.WriteString(h, version+"\x00")
+	for _, values := range [][]string{args, env} {
+		for _, value := range values {
+			if err := c.writeToken(h, value); err != nil {
+				return ""
+			}
+			h.Write([]byte{0})
+		}
+		h.Write([]byte{1})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeToken writes an argument to h, followed by the digest of the file
+// or directory it names, alone or after name=
+func (c *Cache) writeToken(h io.Writer, token string) error {
+	path := token
+	if _, err := os.Stat(path); err != nil {
+		name, value, ok := strings.Cut(token, "=")
+		if !ok || value == "" {
+			io.WriteString(h, token)
+			return nil
+		}
+		if _, err := os.Stat(value); err != nil {
+			io.WriteString(h, token)
+			return nil
+		}
+		io.WriteString(h, name+"=")
+		path = value
+	}
+
+	if !isTemp(path) {
+		io.WriteString(h, path)
+	}
+	return filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(path, file)
+		if err != nil {
+			return err
+		}
+		digest, err := c.fileDigest(file)
+		if err != nil {
+			return err
+		}
+		io.WriteString(h, rel+"\x00"+digest)
+		return nil
+	})
+}
+
+// fileDigest returns the checksum of a file's content, remembered while its
+// size and modification time stay the same: arguments such as the
+// post-renderer name large binaries. Files in the temporary directory are
+// per-render copies, so theirs aren't remembered.
+func (c *Cache) fileDigest(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	temp := isTemp(path)
+	if !temp {
+		c.mu.Lock()
+		digest, ok := c.digests[path]
+		c.mu.Unlock()
+		if ok && digest.size == info.Size() && digest.modTime.Equal(info.ModTime()) {
+			return digest.sum, nil
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	if !temp {
+		c.mu.Lock()
+		c.digests[path] = fileDigest{size: info.Size(), modTime: info.ModTime(), sum: sum}
+		c.mu.Unlock()
+	}
+	return sum, nil
+}
+
+// isTemp reports whether path is in the temporary directory
+func isTemp(path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(os.TempDir(), abs)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
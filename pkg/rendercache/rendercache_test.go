@@ -0,0 +1,141 @@
+package rendercache
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRenderEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New(2)
+	renders := 0
+	render := func(manifest string) func() (string, error) {
+		return func() (string, error) {
+			renders++
+			return manifest, nil
+		}
+	}
+
+	c.Render("a", render("A"))
+	c.Render("b", render("B"))
+	if got, _ := c.Render("a", render("stale")); got != "A" {
+		t.Errorf("Render(a) = %q, want the cached A", got)
+	}
+	c.Render("c", render("C")) // evicts b, used least recently
+	if got, _ := c.Render("b", render("B2")); got != "B2" {
+		t.Errorf("Render(b) = %q, want a new render after eviction", got)
+	}
+
+	if renders != 4 {
+		t.Errorf("rendered %d times, want 4", renders)
+	}
+	if stats := c.Stats(); stats != (Stats{Hits: 1, Misses: 4, Entries: 2}) {
+		t.Errorf("Stats() = %+v", stats)
+	}
+}
+
+func TestRenderSkipsFailuresAndEmptyKeys(t *testing.T) {
+	c := New(4)
+	failed := errors.New("helm failed")
+	if _, err := c.Render("a", func() (string, error) { return "", failed }); err != failed {
+		t.Fatalf("Render() error = %v, want %v", err, failed)
+	}
+	if got, _ := c.Render("a", func() (string, error) { return "A", nil }); got != "A" {
+		t.Errorf("Render(a) = %q, want a render after the failed one", got)
+	}
+
+	renders := 0
+	for i := 0; i < 2; i++ {
+		c.Render("", func() (string, error) { renders++; return "", nil })
+	}
+	if renders != 2 {
+		t.Errorf("rendered %d times with no key, want 2", renders)
+	}
+
+	var none *Cache
+	if got, _ := none.Render("a", func() (string, error) { return "A", nil }); got != "A" {
+		t.Errorf("nil cache Render() = %q, want A", got)
+	}
+	if New(0) != nil {
+		t.Error("New(0) should disable caching")
+	}
+}
+
+func TestKey(t *testing.T) {
+	c := New(4)
+	dir := t.TempDir()
+	chart := filepath.Join(dir, "chart")
+	writeFile(t, filepath.Join(chart, "Chart.yaml"), "name: api")
+	values := filepath.Join(dir, "values.yaml")
+	writeFile(t, values, "replicas: 1")
+
+	args := []string{"template", "api", chart, "--values", values}
+	key := c.Key(chart, "", args, nil)
+	if key == "" {
+		t.Fatal("Key() of a local chart is empty")
+	}
+	if again := c.Key(chart, "", args, nil); again != key {
+		t.Errorf("Key() changed without changes: %s, then %s", key, again)
+	}
+
+	writeFile(t, values, "replicas: 2")
+	changed := c.Key(chart, "", args, nil)
+	if changed == key {
+		t.Error("Key() didn't change with the values file")
+	}
+	writeFile(t, filepath.Join(chart, "templates", "deployment.yaml"), "kind: Deployment")
+	if c.Key(chart, "", args, nil) == changed {
+		t.Error("Key() didn't change with the chart")
+	}
+
+	if got := c.Key("bitnami/redis", "18.0.4", []string{"template", "cache", "bitnami/redis"}, nil); got == "" {
+		t.Error("Key() of a pinned repository chart is empty")
+	}
+	for _, version := range []string{"", "~18.0"} {
+		if got := c.Key("bitnami/redis", version, []string{"template", "cache", "bitnami/redis"}, nil); got != "" {
+			t.Errorf("Key() of version %q = %s, want no caching", version, got)
+		}
+	}
+
+	var none *Cache
+	if got := none.Key(chart, "", args, nil); got != "" {
+		t.Errorf("nil cache Key() = %s, want empty", got)
+	}
+}
+
+func TestKeyIgnoresTempFileNames(t *testing.T) {
+	c := New(4)
+	chart := t.TempDir()
+	writeFile(t, filepath.Join(chart, "Chart.yaml"), "name: api")
+
+	// Secrets and post-render configs are written to new temp files per render
+	key := func(config string) string {
+		file, err := os.CreateTemp("", "post-render-*.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(file.Name())
+		file.WriteString(config)
+		file.Close()
+		return c.Key(chart, "", []string{"template", "api", chart}, []string{"POST_RENDER=" + file.Name()})
+	}
+
+	first := key(`{"images":[]}`)
+	if second := key(`{"images":[]}`); second != first {
+		t.Errorf("Key() changed with the temp file name: %s, then %s", first, second)
+	}
+	if third := key(`{"images":[{"original":"nginx"}]}`); third == first {
+		t.Error("Key() didn't change with the temp file content")
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,138 @@
+package reportformat
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/sync"
+)
+
+// junitSuites is the root of a JUnit XML report
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Time     float64      `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Skipped   int         `xml:"skipped,attr"`
+	Time      float64     `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr,omitempty"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// add appends a test case, counting it in the suite
+func (s *junitSuite) add(c junitCase) {
+	s.Cases = append(s.Cases, c)
+	s.Tests++
+	switch {
+	case c.Failure != nil:
+		s.Failures++
+	case c.Skipped != nil:
+		s.Skipped++
+	}
+}
+
+// writeJUnit writes a suite of the synced releases, each with its smoke
+// tests, and a suite of the drifted releases. Every release is a test
+// case, failing when it failed to sync or drifted without being healed.
+func writeJUnit(w io.Writer, results Results) error {
+	root := junitSuites{Name: "helmfire"}
+
+	if report := results.Sync; report != nil {
+		suite := junitSuite{
+			Name:      "sync",
+			Time:      report.Duration.Seconds(),
+			Timestamp: report.StartTime.UTC().Format(time.RFC3339),
+		}
+		for _, result := range report.Results {
+			id := releaseID(result.Name, result.Namespace)
+			c := junitCase{Name: id, ClassName: "sync", Time: result.Duration.Seconds()}
+			switch result.Status {
+			case sync.ReleaseStatusSkipped:
+				c.Skipped = &junitSkipped{Message: result.Error}
+			case sync.ReleaseStatusFailed, sync.ReleaseStatusTimedOut:
+				c.Failure = &junitFailure{Message: result.Error, Type: string(result.Status), Text: result.Error}
+			}
+			if result.Helm == nil {
+				suite.add(c)
+				continue
+			}
+
+			if result.Helm.Revision > 0 {
+				c.SystemOut = fmt.Sprintf("revision %d, %s", result.Helm.Revision, result.Helm.Status)
+			}
+			suite.add(c)
+			for _, test := range result.Helm.Tests {
+				tc := junitCase{Name: id + " " + test.Name, ClassName: "sync." + id, Time: test.Duration.Seconds(), SystemOut: test.Logs}
+				if !test.Passed {
+					tc.Failure = &junitFailure{Message: test.Error, Type: "smoke-test", Text: test.Logs}
+				}
+				suite.add(tc)
+			}
+		}
+		root.Suites = append(root.Suites, suite)
+	}
+
+	if results.Drift != nil {
+		suite := junitSuite{Name: "drift"}
+		for _, report := range results.Drift {
+			c := junitCase{Name: releaseID(report.ReleaseName, report.Namespace), ClassName: "drift", SystemOut: report.Details}
+			if driftFailed(report) {
+				c.Failure = &junitFailure{
+					Message: fmt.Sprintf("%s drift (%s severity): %s", report.DriftType, report.Severity, report.Details),
+					Type:    string(report.DriftType),
+					Text:    report.Diff,
+				}
+			}
+			suite.add(c)
+		}
+		root.Suites = append(root.Suites, suite)
+	}
+
+	for _, suite := range root.Suites {
+		root.Tests += suite.Tests
+		root.Failures += suite.Failures
+		root.Skipped += suite.Skipped
+		root.Time += suite.Time
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(root); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
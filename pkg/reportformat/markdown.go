@@ -0,0 +1,134 @@
+package reportformat
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/sync"
+)
+
+// statusIcons mark the outcome of a release in Markdown tables
+var statusIcons = map[sync.ReleaseStatus]string{
+	sync.ReleaseStatusSucceeded: "✅",
+	sync.ReleaseStatusFailed:    "❌",
+	sync.ReleaseStatusTimedOut:  "⏱️",
+	sync.ReleaseStatusSkipped:   "⏭️",
+}
+
+// writeMarkdown writes a summary fit for a pull request comment or a CI
+// job summary: a table of the releases, with errors, failed smoke tests and
+// drift diffs in collapsed sections
+func writeMarkdown(w io.Writer, results Results) error {
+	var b strings.Builder
+
+	if report := results.Sync; report != nil {
+		b.WriteString("## helmfire sync\n\n")
+		fmt.Fprintf(&b, "%d succeeded, %d failed, %d timed out, %d skipped in %s",
+			report.Count(sync.ReleaseStatusSucceeded), report.Count(sync.ReleaseStatusFailed),
+			report.Count(sync.ReleaseStatusTimedOut), report.Count(sync.ReleaseStatusSkipped),
+			report.Duration.Round(time.Millisecond))
+		if report.SyncID != "" {
+			fmt.Fprintf(&b, " (sync `%s`)", report.SyncID)
+		}
+		b.WriteString("\n\n")
+
+		if len(report.Results) > 0 {
+			b.WriteString("| Release | Namespace | Status | Revision | Tests | Duration |\n")
+			b.WriteString("|---|---|---|---|---|---|\n")
+			for _, result := range report.Results {
+				revision, tests := "", ""
+				if helm := result.Helm; helm != nil {
+					if helm.Revision > 0 {
+						revision = fmt.Sprint(helm.Revision)
+					}
+					if len(helm.Tests) > 0 {
+						passed := 0
+						for _, test := range helm.Tests {
+							if test.Passed {
+								passed++
+							}
+						}
+						tests = fmt.Sprintf("%d/%d", passed, len(helm.Tests))
+					}
+				}
+				fmt.Fprintf(&b, "| %s | %s | %s %s | %s | %s | %s |\n",
+					markdownCell(result.Name), markdownCell(result.Namespace), statusIcons[result.Status], result.Status,
+					revision, tests, result.Duration.Round(time.Millisecond))
+			}
+			b.WriteString("\n")
+		}
+
+		for _, result := range report.Results {
+			if result.Status == sync.ReleaseStatusFailed || result.Status == sync.ReleaseStatusTimedOut {
+				markdownDetails(&b, fmt.Sprintf("❌ %s %s", releaseID(result.Name, result.Namespace), result.Status), result.Error)
+			}
+			if result.Helm == nil {
+				continue
+			}
+			for _, test := range result.Helm.Tests {
+				if !test.Passed {
+					markdownDetails(&b, fmt.Sprintf("❌ smoke test %s of %s: %s", test.Name, releaseID(result.Name, result.Namespace), test.Error), test.Logs)
+				}
+			}
+		}
+	}
+
+	if results.Drift != nil {
+		if results.Sync != nil {
+			b.WriteString("\n")
+		}
+		b.WriteString("## helmfire drift\n\n")
+		if len(results.Drift) == 0 {
+			b.WriteString("✅ No drift detected\n")
+		} else {
+			b.WriteString("| Release | Namespace | Drift | Severity | Healed | Details |\n")
+			b.WriteString("|---|---|---|---|---|---|\n")
+			for _, report := range results.Drift {
+				healed := ""
+				if report.Healed {
+					healed = "✅"
+				}
+				fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %s |\n",
+					markdownCell(report.ReleaseName), markdownCell(report.Namespace), report.DriftType, report.Severity,
+					healed, markdownCell(report.Details))
+			}
+			b.WriteString("\n")
+			for _, report := range results.Drift {
+				if values := report.ValuesDiff.String(); values != "" {
+					markdownDetails(&b, fmt.Sprintf("Values diff of %s", releaseID(report.ReleaseName, report.Namespace)), values)
+				}
+				if report.Diff != "" {
+					markdownDetails(&b, fmt.Sprintf("Diff of %s", releaseID(report.ReleaseName, report.Namespace)), report.Diff)
+				}
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// markdownDetails writes a collapsed section showing body as a code block
+func markdownDetails(b *strings.Builder, summary, body string) {
+	summary = html.EscapeString(strings.ReplaceAll(strings.TrimSpace(summary), "\n", " "))
+	fmt.Fprintf(b, "<details><summary>%s</summary>\n\n", summary)
+	if body = strings.TrimRight(body, "\n"); body != "" {
+		// A fence longer than any backtick run in body can't be closed by it
+		fence := "```"
+		for strings.Contains(body, fence) {
+			fence += "`"
+		}
+		fmt.Fprintf(b, "%s\n%s\n%s\n\n", fence, body, fence)
+	}
+	b.WriteString("</details>\n\n")
+}
+
+// markdownCell makes text safe to put in a table cell: on one line, with
+// pipes and angle brackets escaped
+func markdownCell(text string) string {
+	text = strings.ReplaceAll(strings.TrimSpace(text), "\n", " ")
+	return strings.NewReplacer("|", `\|`, "<", "&lt;", ">", "&gt;").Replace(text)
+}
@@ -0,0 +1,110 @@
+// Package reportformat exports the results of syncs and drift checks in
+// formats other tools read: JUnit XML for CI test views, SARIF for code
+// scanning, Markdown for pull request comments and job summaries, and JSON.
+package reportformat
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/oleksiyp/helmfire/pkg/drift"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+)
+
+// Format is a format results are exported in
+type Format string
+
+const (
+	JSON     Format = "json"
+	JUnit    Format = "junit"
+	SARIF    Format = "sarif"
+	Markdown Format = "markdown"
+)
+
+// Formats are the formats results can be exported in
+var Formats = []Format{JSON, JUnit, SARIF, Markdown}
+
+// ParseFormat parses a format name. An empty name picks the format from
+// the extension of file: .xml is JUnit, .sarif SARIF, .md Markdown and
+// anything else JSON.
+func ParseFormat(name, file string) (Format, error) {
+	switch Format(strings.ToLower(name)) {
+	case JSON, JUnit, SARIF, Markdown:
+		return Format(strings.ToLower(name)), nil
+	case "md":
+		return Markdown, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unknown report format %q (available: json, junit, sarif, markdown)", name)
+	}
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".xml":
+		return JUnit, nil
+	case ".sarif":
+		return SARIF, nil
+	case ".md", ".markdown":
+		return Markdown, nil
+	}
+	return JSON, nil
+}
+
+// Results are what a command exports: a sync run, drift reports, or both
+type Results struct {
+	// Helmfile is the helmfile the results are of, which SARIF locations
+	// point at
+	Helmfile string `json:"helmfile,omitempty"`
+
+	Sync  *sync.Report        `json:"sync,omitempty"`
+	Drift []drift.DriftReport `json:"drift,omitempty"`
+}
+
+// Write writes results to w in format
+func Write(w io.Writer, format Format, results Results) error {
+	switch format {
+	case JSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	case JUnit:
+		return writeJUnit(w, results)
+	case SARIF:
+		return writeSARIF(w, results)
+	case Markdown:
+		return writeMarkdown(w, results)
+	}
+	return fmt.Errorf("unknown report format %q", format)
+}
+
+// WriteFile writes results in format to path, or to stdout when path is -
+func WriteFile(path string, format Format, results Results) error {
+	if path == "-" {
+		return Write(os.Stdout, format, results)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create report file: %w", err)
+	}
+	if err := Write(f, format, results); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return f.Close()
+}
+
+// releaseID names a release in exported results, as namespace/name
+func releaseID(name, namespace string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+// driftFailed reports whether a drift report is still unresolved
+func driftFailed(report drift.DriftReport) bool {
+	return !report.Healed && report.DriftType != drift.DriftTypeResolved
+}
@@ -0,0 +1,166 @@
+package reportformat
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/drift"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+)
+
+func testResults() Results {
+	report := &sync.Report{SyncID: "abc123", StartTime: time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC), Duration: 20 * time.Second}
+	report.RecordRelease("web", "apps", 12*time.Second, &sync.HelmRelease{Revision: 4, Status: "deployed", Tests: []sync.TestResult{
+		{Name: "helm test", Passed: true, Duration: time.Second},
+		{Name: "api", Error: "job.batch/web-test-api-x7k2p failed", Logs: "GET /api 503 | retrying"},
+	}}, errors.New("smoke tests failed: api"))
+	report.RecordRelease("db", "data", 5*time.Second, &sync.HelmRelease{Revision: 2, Status: "deployed"}, nil)
+	report.Skip("worker", "apps", "previous release failed")
+
+	return Results{
+		Helmfile: "deploy/helmfile.yaml",
+		Sync:     report,
+		Drift: []drift.DriftReport{
+			{ReleaseName: "cache", Namespace: "data", DriftType: drift.DriftTypeImage, Severity: drift.SeverityHigh, Details: "image changed", Diff: "- image: redis:7\n+ image: redis:6"},
+			{ReleaseName: "web", Namespace: "apps", DriftType: drift.DriftTypeConfiguration, Severity: drift.SeverityLow, Healed: true},
+		},
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, tc := range []struct {
+		name, file string
+		want       Format
+	}{
+		{"junit", "", JUnit},
+		{"MD", "", Markdown},
+		{"", "results.xml", JUnit},
+		{"", "helmfire.sarif", SARIF},
+		{"", "/tmp/step_summary.md", Markdown},
+		{"", "/home/runner/_work/_temp/_runner_file_commands/step_summary_1", JSON},
+		{"json", "report.xml", JSON},
+	} {
+		if got, err := ParseFormat(tc.name, tc.file); err != nil || got != tc.want {
+			t.Errorf("ParseFormat(%q, %q) = %q, %v, want %q", tc.name, tc.file, got, err, tc.want)
+		}
+	}
+	if _, err := ParseFormat("html", ""); err == nil {
+		t.Error("expected an unknown format rejected")
+	}
+}
+
+func TestJUnit(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, JUnit, testResults()); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	var suites junitSuites
+	if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+		t.Fatalf("invalid XML: %v\n%s", err, buf.String())
+	}
+	if suites.Tests != 7 || suites.Failures != 3 || suites.Skipped != 1 || len(suites.Suites) != 2 {
+		t.Fatalf("unexpected totals %+v\n%s", suites, buf.String())
+	}
+	sync := suites.Suites[0]
+	if sync.Name != "sync" || sync.Timestamp != "2024-01-15T10:00:00Z" || len(sync.Cases) != 5 {
+		t.Fatalf("unexpected sync suite %+v", sync)
+	}
+	if c := sync.Cases[0]; c.Name != "apps/web" || c.Failure == nil || c.Failure.Type != "failed" || c.SystemOut != "revision 4, deployed" {
+		t.Errorf("unexpected release case %+v", c)
+	}
+	if c := sync.Cases[2]; c.Name != "apps/web api" || c.ClassName != "sync.apps/web" || c.Failure == nil || c.Failure.Text != "GET /api 503 | retrying" {
+		t.Errorf("unexpected smoke test case %+v", c)
+	}
+	if c := sync.Cases[4]; c.Skipped == nil || c.Skipped.Message != "previous release failed" {
+		t.Errorf("unexpected skipped case %+v", c)
+	}
+	drift := suites.Suites[1]
+	if drift.Tests != 2 || drift.Failures != 1 || drift.Cases[0].Failure.Text != "- image: redis:7\n+ image: redis:6" {
+		t.Errorf("unexpected drift suite %+v", drift)
+	}
+}
+
+func TestSARIF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, SARIF, testResults()); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("unexpected log %s", buf.String())
+	}
+	var rules []string
+	for _, result := range log.Runs[0].Results {
+		rules = append(rules, result.RuleID+":"+result.Level)
+	}
+	if strings.Join(rules, ",") != "sync-failed:error,smoke-test-failed:error,drift:error" {
+		t.Errorf("unexpected results %v", rules)
+	}
+	loc := log.Runs[0].Results[0].Locations[0]
+	if loc.Physical.Artifact.URI != "deploy/helmfile.yaml" || loc.Logical[0].FullyQualifiedName != "apps/web" {
+		t.Errorf("unexpected location %+v", loc)
+	}
+
+	// Nothing failed: an empty list of results, as code scanning expects
+	buf.Reset()
+	if err := Write(&buf, SARIF, Results{Sync: sync.NewReport()}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"results": []`) {
+		t.Errorf("expected empty results, got %s", buf.String())
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, Markdown, testResults()); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"## helmfire sync\n\n1 succeeded, 1 failed, 0 timed out, 1 skipped in 20s (sync `abc123`)\n",
+		"| web | apps | ❌ failed | 4 | 1/2 | 12s |\n",
+		"| worker | apps | ⏭️ skipped |  |  | 0s |\n",
+		"<details><summary>❌ smoke test api of apps/web: job.batch/web-test-api-x7k2p failed</summary>\n\n```\nGET /api 503 | retrying\n```\n",
+		"## helmfire drift\n\n",
+		"| cache | data | image | high |  | image changed |\n",
+		"<details><summary>Diff of data/cache</summary>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in:\n%s", want, out)
+		}
+	}
+
+	buf.Reset()
+	if err := Write(&buf, Markdown, Results{Drift: []drift.DriftReport{}}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "## helmfire drift\n\n✅ No drift detected\n" {
+		t.Errorf("unexpected report without drift %q", buf.String())
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := WriteFile(path, JSON, testResults()); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	var results Results
+	if err := json.Unmarshal(data, &results); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if results.Sync == nil || results.Sync.SyncID != "abc123" || len(results.Drift) != 2 {
+		t.Errorf("unexpected results %s", data)
+	}
+}
@@ -0,0 +1,156 @@
+package reportformat
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/oleksiyp/helmfire/pkg/drift"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+)
+
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+// Rules of the results in SARIF reports
+const (
+	ruleSyncFailed   = "sync-failed"
+	ruleSyncTimedOut = "sync-timed-out"
+	ruleSmokeTest    = "smoke-test-failed"
+	ruleDrift        = "drift"
+)
+
+var sarifRules = []sarifRule{
+	{ID: ruleSyncFailed, Description: sarifText{"A release failed to sync"}},
+	{ID: ruleSyncTimedOut, Description: sarifText{"A release did not become ready before the sync timed out"}},
+	{ID: ruleSmokeTest, Description: sarifText{"A smoke test of a synced release failed"}},
+	{ID: ruleDrift, Description: sarifText{"A release's resources in the cluster differ from the helmfile"}},
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver struct {
+		Name           string      `json:"name"`
+		InformationURI string      `json:"informationUri"`
+		Rules          []sarifRule `json:"rules"`
+	} `json:"driver"`
+}
+
+type sarifRule struct {
+	ID          string    `json:"id"`
+	Description sarifText `json:"shortDescription"`
+}
+
+type sarifText struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifText       `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifLocation struct {
+	Physical *sarifPhysical `json:"physicalLocation,omitempty"`
+	Logical  []sarifLogical `json:"logicalLocations"`
+}
+
+type sarifPhysical struct {
+	Artifact struct {
+		URI string `json:"uri"`
+	} `json:"artifactLocation"`
+}
+
+type sarifLogical struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// writeSARIF writes the failed releases and smoke tests as errors, and
+// unhealed drift as warnings or, at high severity, errors. Results point
+// at the helmfile and name the release.
+func writeSARIF(w io.Writer, results Results) error {
+	run := sarifRun{Results: []sarifResult{}}
+	run.Tool.Driver.Name = "helmfire"
+	run.Tool.Driver.InformationURI = "https://github.com/oleksiyp/helmfire"
+	run.Tool.Driver.Rules = sarifRules
+
+	location := func(name, namespace string) []sarifLocation {
+		loc := sarifLocation{Logical: []sarifLogical{{Name: name, FullyQualifiedName: releaseID(name, namespace), Kind: "release"}}}
+		if results.Helmfile != "" {
+			loc.Physical = &sarifPhysical{}
+			loc.Physical.Artifact.URI = filepath.ToSlash(results.Helmfile)
+		}
+		return []sarifLocation{loc}
+	}
+
+	if report := results.Sync; report != nil {
+		for _, result := range report.Results {
+			id := releaseID(result.Name, result.Namespace)
+			switch result.Status {
+			case sync.ReleaseStatusFailed:
+				run.Results = append(run.Results, sarifResult{
+					RuleID:    ruleSyncFailed,
+					Level:     "error",
+					Message:   sarifText{fmt.Sprintf("%s failed to sync: %s", id, result.Error)},
+					Locations: location(result.Name, result.Namespace),
+				})
+			case sync.ReleaseStatusTimedOut:
+				run.Results = append(run.Results, sarifResult{
+					RuleID:    ruleSyncTimedOut,
+					Level:     "error",
+					Message:   sarifText{fmt.Sprintf("%s timed out after %s: %s", id, result.Duration, result.Error)},
+					Locations: location(result.Name, result.Namespace),
+				})
+			}
+			if result.Helm == nil {
+				continue
+			}
+			for _, test := range result.Helm.Tests {
+				if test.Passed {
+					continue
+				}
+				run.Results = append(run.Results, sarifResult{
+					RuleID:    ruleSmokeTest,
+					Level:     "error",
+					Message:   sarifText{fmt.Sprintf("smoke test %s of %s failed: %s", test.Name, id, test.Error)},
+					Locations: location(result.Name, result.Namespace),
+				})
+			}
+		}
+	}
+
+	for _, report := range results.Drift {
+		if !driftFailed(report) {
+			continue
+		}
+		level := "warning"
+		if report.Severity == drift.SeverityHigh {
+			level = "error"
+		}
+		run.Results = append(run.Results, sarifResult{
+			RuleID: ruleDrift,
+			Level:  level,
+			Message: sarifText{fmt.Sprintf("%s has %s drift (%s severity): %s",
+				releaseID(report.ReleaseName, report.Namespace), report.DriftType, report.Severity, report.Details)},
+			Locations: location(report.ReleaseName, report.Namespace),
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{Schema: sarifSchema, Version: "2.1.0", Runs: []sarifRun{run}})
+}
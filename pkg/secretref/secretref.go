@@ -0,0 +1,278 @@
+// Package secretref resolves references to secrets kept outside helmfiles:
+// vault:path#key for HashiCorp Vault, and the vals-style
+// ref+awssecrets://, ref+gcpsecrets:// and ref+azurekeyvault:// for the
+// secret managers of the clouds, read with their CLIs
+package secretref
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/oleksiyp/helmfire/pkg/vault"
+	"gopkg.in/yaml.v3"
+)
+
+// Schemes of cloud secret references
+const (
+	SchemeAWS   = "ref+awssecrets"
+	SchemeGCP   = "ref+gcpsecrets"
+	SchemeAzure = "ref+azurekeyvault"
+)
+
+// Redacted replaces secrets in redacted text
+const Redacted = "[redacted]"
+
+// minRedacted is the length below which secrets aren't redacted, as they
+// would mask unrelated text
+const minRedacted = 4
+
+// defaultCommands are the CLIs reading each scheme
+var defaultCommands = map[string]string{
+	SchemeAWS:   "aws",
+	SchemeGCP:   "gcloud",
+	SchemeAzure: "az",
+}
+
+// IsRef reports whether value is a secret reference
+func IsRef(value string) bool {
+	if vault.IsRef(value) {
+		return true
+	}
+	for scheme := range defaultCommands {
+		if strings.HasPrefix(value, scheme+"://") {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains reports whether data may hold a secret reference
+func Contains(data []byte) bool {
+	return bytes.Contains(data, []byte(vault.RefPrefix)) || bytes.Contains(data, []byte("ref+"))
+}
+
+// Resolver reads the secrets references name. Secrets are cached until the
+// scope given to Begin changes, and remembered so that Redact can mask them.
+type Resolver struct {
+	mu       sync.Mutex
+	vault    *vault.Client
+	commands map[string]string
+	scope    string
+	cache    map[string]string
+	known    map[string]bool
+}
+
+// NewResolver creates a resolver using the CLIs on PATH and a Vault client
+// configured by the environment
+func NewResolver() *Resolver {
+	commands := make(map[string]string, len(defaultCommands))
+	for scheme, command := range defaultCommands {
+		commands[scheme] = command
+	}
+	return &Resolver{
+		commands: commands,
+		cache:    make(map[string]string),
+		known:    make(map[string]bool),
+	}
+}
+
+// SetVault sets the client vault: references are read with
+func (r *Resolver) SetVault(client *vault.Client) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.vault = client
+}
+
+// SetCommand sets the CLI reading references of scheme
+func (r *Resolver) SetCommand(scheme, command string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands[scheme] = command
+}
+
+// Begin starts resolving for scope, such as a sync run, dropping the
+// secrets cached for another scope. An empty scope never reuses them.
+func (r *Resolver) Begin(scope string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if scope == "" || scope != r.scope {
+		r.cache = make(map[string]string)
+	}
+	r.scope = scope
+}
+
+// Resolve returns the secret a reference names
+func (r *Resolver) Resolve(ctx context.Context, ref string) (string, error) {
+	r.mu.Lock()
+	secret, ok := r.cache[ref]
+	r.mu.Unlock()
+	if ok {
+		return secret, nil
+	}
+
+	secret, err := r.fetch(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	r.cache[ref] = secret
+	if len(secret) >= minRedacted {
+		r.known[secret] = true
+	}
+	r.mu.Unlock()
+	return secret, nil
+}
+
+// Redact masks the secrets resolved so far in s
+func (r *Resolver) Redact(s string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for secret := range r.known {
+		s = strings.ReplaceAll(s, secret, Redacted)
+	}
+	return s
+}
+
+// fetch reads a secret from its backend
+func (r *Resolver) fetch(ctx context.Context, ref string) (string, error) {
+	if vault.IsRef(ref) {
+		parsed, err := vault.ParseRef(ref)
+		if err != nil {
+			return "", err
+		}
+		client, err := r.vaultClient()
+		if err != nil {
+			return "", err
+		}
+		return client.Get(ctx, parsed)
+	}
+
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid secret reference %s: %w", redactRef(ref), err)
+	}
+	args, err := cliArgs(u)
+	if err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	command := r.commands[u.Scheme]
+	r.mu.Unlock()
+
+	cmd := exec.CommandContext(ctx, command, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to read secret %s with %s: %w (stderr: %s)", redactRef(ref), command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	secret := strings.TrimRight(stdout.String(), "\r\n")
+	if u.Fragment == "" {
+		return secret, nil
+	}
+	return extract(secret, u.Fragment)
+}
+
+// vaultClient returns the client set with SetVault, or one configured by
+// the environment
+func (r *Resolver) vaultClient() (*vault.Client, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.vault == nil {
+		client, err := vault.NewClient(vault.ConfigFromEnv())
+		if err != nil {
+			return nil, err
+		}
+		r.vault = client
+	}
+	return r.vault, nil
+}
+
+// cliArgs returns the arguments of the CLI reading a cloud reference:
+//
+//	ref+awssecrets://NAME[?region=R&profile=P&version_stage=S&version_id=I][#/json/key]
+//	ref+gcpsecrets://PROJECT/SECRET[?version=V][#/json/key]
+//	ref+azurekeyvault://VAULT/SECRET[/VERSION][#/json/key]
+func cliArgs(u *url.URL) ([]string, error) {
+	query := u.Query()
+	path := strings.Trim(u.Path, "/")
+
+	switch u.Scheme {
+	case SchemeAWS:
+		id := strings.TrimSuffix(u.Host+"/"+path, "/")
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid secret reference %s (want %s://NAME)", redactRef(u.String()), SchemeAWS)
+		}
+		args := []string{"secretsmanager", "get-secret-value", "--secret-id", id, "--query", "SecretString", "--output", "text"}
+		for _, param := range []string{"region", "profile", "version_stage", "version_id"} {
+			if value := query.Get(param); value != "" {
+				args = append(args, "--"+strings.ReplaceAll(param, "_", "-"), value)
+			}
+		}
+		return args, nil
+
+	case SchemeGCP:
+		if u.Host == "" || path == "" || strings.Contains(path, "/") {
+			return nil, fmt.Errorf("invalid secret reference %s (want %s://PROJECT/SECRET)", redactRef(u.String()), SchemeGCP)
+		}
+		version := query.Get("version")
+		if version == "" {
+			version = "latest"
+		}
+		return []string{"secrets", "versions", "access", version, "--secret", path, "--project", u.Host}, nil
+
+	case SchemeAzure:
+		name, version, _ := strings.Cut(path, "/")
+		if u.Host == "" || name == "" {
+			return nil, fmt.Errorf("invalid secret reference %s (want %s://VAULT/SECRET)", redactRef(u.String()), SchemeAzure)
+		}
+		args := []string{"keyvault", "secret", "show", "--vault-name", u.Host, "--name", name, "--query", "value", "--output", "tsv"}
+		if version != "" {
+			args = append(args, "--version", version)
+		}
+		return args, nil
+	}
+	return nil, fmt.Errorf("unsupported secret reference %s", redactRef(u.String()))
+}
+
+// extract returns the value at the /-separated path of fragment in a JSON
+// or YAML secret; values that aren't strings are returned as JSON
+func extract(secret, fragment string) (string, error) {
+	var value interface{}
+	if err := yaml.Unmarshal([]byte(secret), &value); err != nil {
+		return "", fmt.Errorf("secret is not JSON or YAML, so #%s can't be read from it", fragment)
+	}
+	for _, key := range strings.Split(strings.Trim(fragment, "/"), "/") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("secret has no key %s", fragment)
+		}
+		if value, ok = object[key]; !ok {
+			return "", fmt.Errorf("secret has no key %s", fragment)
+		}
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// redactRef drops the query of a reference in messages, as it may hold
+// credentials
+func redactRef(ref string) string {
+	ref, _, _ = strings.Cut(ref, "?")
+	return ref
+}
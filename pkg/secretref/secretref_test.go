@@ -0,0 +1,125 @@
+package secretref
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestIsRef(t *testing.T) {
+	for value, want := range map[string]bool{
+		"vault:secret/db#password":               true,
+		"ref+awssecrets://prod/db":               true,
+		"ref+gcpsecrets://project/db":            true,
+		"ref+azurekeyvault://vault/db":           true,
+		"ref+sops://secrets.yaml":                false,
+		"https://charts.example.com":             false,
+		"password with ref+awssecrets:// inside": false,
+	} {
+		if got := IsRef(value); got != want {
+			t.Errorf("IsRef(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestCliArgs(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"ref+awssecrets://prod/db?region=eu-west-1&version_stage=AWSPREVIOUS#/password",
+			"secretsmanager get-secret-value --secret-id prod/db --query SecretString --output text --region eu-west-1 --version-stage AWSPREVIOUS"},
+		{"ref+gcpsecrets://my-project/db-password",
+			"secrets versions access latest --secret db-password --project my-project"},
+		{"ref+gcpsecrets://my-project/db-password?version=3",
+			"secrets versions access 3 --secret db-password --project my-project"},
+		{"ref+azurekeyvault://my-vault/db-password/abc123",
+			"keyvault secret show --vault-name my-vault --name db-password --query value --output tsv --version abc123"},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		args, err := cliArgs(u)
+		if err != nil || strings.Join(args, " ") != tt.want {
+			t.Errorf("cliArgs(%s) = %v %v, want %s", tt.ref, args, err, tt.want)
+		}
+	}
+
+	for _, ref := range []string{"ref+gcpsecrets://my-project", "ref+azurekeyvault://my-vault"} {
+		u, _ := url.Parse(ref)
+		if _, err := cliArgs(u); err == nil {
+			t.Errorf("expected %s rejected", ref)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	secret := `{"db": {"password": "hunter2", "port": 5432}}`
+	if got, err := extract(secret, "/db/password"); err != nil || got != "hunter2" {
+		t.Errorf("expected hunter2, got %q %v", got, err)
+	}
+	if got, err := extract(secret, "/db/port"); err != nil || got != "5432" {
+		t.Errorf("expected 5432, got %q %v", got, err)
+	}
+	if _, err := extract(secret, "/db/user"); err == nil {
+		t.Error("expected a missing key error")
+	}
+	if _, err := extract("plain", "/db"); err == nil {
+		t.Error("expected a plain secret to have no keys")
+	}
+}
+
+func TestResolveCachesAndRedacts(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake CLI script requires a POSIX shell")
+	}
+
+	// The fake aws CLI counts its calls
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	aws := filepath.Join(dir, "aws")
+	script := `#!/bin/sh
+echo x >> ` + calls + `
+case "$*" in
+*"--secret-id prod/db "*) echo '{"username": "app", "password": "hunter2"}' ;;
+*) echo 'ResourceNotFoundException' >&2; exit 254 ;;
+esac
+`
+	if err := os.WriteFile(aws, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewResolver()
+	r.SetCommand(SchemeAWS, aws)
+	ctx := context.Background()
+
+	r.Begin("sync-1")
+	for i := 0; i < 2; i++ {
+		if got, err := r.Resolve(ctx, "ref+awssecrets://prod/db#/password"); err != nil || got != "hunter2" {
+			t.Fatalf("expected hunter2, got %q %v", got, err)
+		}
+	}
+	if data, _ := os.ReadFile(calls); strings.Count(string(data), "x") != 1 {
+		t.Errorf("expected the secret read once per sync, read %d times", strings.Count(string(data), "x"))
+	}
+	r.Begin("sync-2")
+	r.Resolve(ctx, "ref+awssecrets://prod/db#/password")
+	if data, _ := os.ReadFile(calls); strings.Count(string(data), "x") != 2 {
+		t.Error("expected the secret read again by the next sync")
+	}
+
+	if got := r.Redact("Error: login failed with hunter2"); got != "Error: login failed with "+Redacted {
+		t.Errorf("expected the secret redacted, got %q", got)
+	}
+
+	_, err := r.Resolve(ctx, "ref+awssecrets://prod/missing?profile=ops")
+	if err == nil || !strings.Contains(err.Error(), "ResourceNotFoundException") || strings.Contains(err.Error(), "profile=ops") {
+		t.Errorf("expected the CLI error without the query, got %v", err)
+	}
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+)
+
+const (
+	// SystemdUnitName is the name of the installed systemd unit
+	SystemdUnitName = "helmfire.service"
+
+	// LaunchdLabel identifies the installed launchd job
+	LaunchdLabel = "io.helmfire.daemon"
+)
+
+// Config describes how the daemon service runs
+type Config struct {
+	Executable string   // absolute path of the helmfire binary
+	Args       []string // arguments, such as daemon start and its flags
+	WorkingDir string   // directory relative paths in Args resolve against
+	LogFile    string   // where launchd writes stdout and stderr
+	Env        map[string]string
+
+	// System installs a system-wide service instead of one for the
+	// current user
+	System bool
+}
+
+// Service is a rendered service definition for the current platform
+type Service struct {
+	Manager string // systemd or launchd
+	Path    string
+	Content string
+
+	system bool
+}
+
+// New renders the service definition for goos: a systemd unit on Linux or
+// a launchd plist on macOS
+func New(goos string, config Config) (*Service, error) {
+	path, err := Path(goos, config.System)
+	if err != nil {
+		return nil, err
+	}
+
+	svc := &Service{Path: path, system: config.System}
+	switch goos {
+	case "linux":
+		svc.Manager = "systemd"
+		svc.Content, err = render(systemdTemplate, config)
+	case "darwin":
+		svc.Manager = "launchd"
+		svc.Content, err = render(launchdTemplate, config)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return svc, nil
+}
+
+// Path returns where the service definition is installed on goos
+func Path(goos string, system bool) (string, error) {
+	switch goos {
+	case "linux":
+		if system {
+			return filepath.Join("/etc/systemd/system", SystemdUnitName), nil
+		}
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, "systemd", "user", SystemdUnitName), nil
+	case "darwin":
+		if system {
+			return filepath.Join("/Library/LaunchDaemons", LaunchdLabel+".plist"), nil
+		}
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, "Library", "LaunchAgents", LaunchdLabel+".plist"), nil
+	}
+	return "", fmt.Errorf("service installation is not supported on %s: only systemd (linux) and launchd (darwin) are", goos)
+}
+
+// Install writes the service definition and enables and starts the service
+func (s *Service) Install() error {
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.Path, []byte(s.Content), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", s.Path, err)
+	}
+
+	if s.Manager == "launchd" {
+		return run("launchctl", "load", "-w", s.Path)
+	}
+	if err := run("systemctl", s.systemctlArgs("daemon-reload")...); err != nil {
+		return err
+	}
+	return run("systemctl", s.systemctlArgs("enable", "--now", SystemdUnitName)...)
+}
+
+// Uninstall stops and disables the service and removes its definition
+func (s *Service) Uninstall() error {
+	if _, err := os.Stat(s.Path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("service not installed: %s not found", s.Path)
+		}
+		return err
+	}
+
+	if s.Manager == "launchd" {
+		if err := run("launchctl", "unload", "-w", s.Path); err != nil {
+			return err
+		}
+		return os.Remove(s.Path)
+	}
+
+	if err := run("systemctl", s.systemctlArgs("disable", "--now", SystemdUnitName)...); err != nil {
+		return err
+	}
+	if err := os.Remove(s.Path); err != nil {
+		return err
+	}
+	return run("systemctl", s.systemctlArgs("daemon-reload")...)
+}
+
+// Current renders the service definition for the running platform
+func Current(config Config) (*Service, error) {
+	return New(runtime.GOOS, config)
+}
+
+func (s *Service) systemctlArgs(args ...string) []string {
+	if s.system {
+		return args
+	}
+	return append([]string{"--user"}, args...)
+}
+
+// run runs a service manager command, including its output in errors
+func run(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func render(tmpl *template.Template, config Config) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, config); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+var funcs = template.FuncMap{
+	"systemdQuote": systemdQuote,
+	"systemdPath":  systemdPath,
+	"xml":          xmlEscape,
+}
+
+// systemdQuote quotes a word of an ExecStart= line when needed
+func systemdQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\$%;") {
+		return s
+	}
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `$$`, `%`, `%%`).Replace(s)
+	return `"` + s + `"`
+}
+
+// systemdPath escapes specifiers in a path setting, which systemd doesn't
+// unquote
+func systemdPath(s string) string {
+	return strings.ReplaceAll(s, "%", "%%")
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+var systemdTemplate = template.Must(template.New("systemd").Funcs(funcs).Parse(`[Unit]
+Description=helmfire daemon
+Documentation=https://github.com/oleksiyp/helmfire
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=simple
+ExecStart={{systemdQuote .Executable}}{{range .Args}} {{systemdQuote .}}{{end}}
+{{- if .WorkingDir}}
+WorkingDirectory={{systemdPath .WorkingDir}}
+{{- end}}
+{{- range $name, $value := .Env}}
+Environment={{systemdQuote (printf "%s=%s" $name $value)}}
+{{- end}}
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy={{if .System}}multi-user.target{{else}}default.target{{end}}
+`))
+
+var launchdTemplate = template.Must(template.New("launchd").Funcs(funcs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>` + LaunchdLabel + `</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>{{xml .Executable}}</string>
+{{- range .Args}}
+		<string>{{xml .}}</string>
+{{- end}}
+	</array>
+{{- if .WorkingDir}}
+	<key>WorkingDirectory</key>
+	<string>{{xml .WorkingDir}}</string>
+{{- end}}
+{{- if .Env}}
+	<key>EnvironmentVariables</key>
+	<dict>
+{{- range $name, $value := .Env}}
+		<key>{{xml $name}}</key>
+		<string>{{xml $value}}</string>
+{{- end}}
+	</dict>
+{{- end}}
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+{{- if .LogFile}}
+	<key>StandardOutPath</key>
+	<string>{{xml .LogFile}}</string>
+	<key>StandardErrorPath</key>
+	<string>{{xml .LogFile}}</string>
+{{- end}}
+</dict>
+</plist>
+`))
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestNewSystemd(t *testing.T) {
+	svc, err := New("linux", Config{
+		Executable: "/usr/local/bin/helmfire",
+		Args:       []string{"daemon", "start", "-f", "my helmfile.yaml", "--drift-interval=5m"},
+		WorkingDir: "/srv/deploy",
+		Env:        map[string]string{"KUBECONFIG": "/home/dev/.kube/config"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if svc.Manager != "systemd" || !strings.HasSuffix(svc.Path, "/systemd/user/"+SystemdUnitName) {
+		t.Errorf("unexpected user unit %s at %s", svc.Manager, svc.Path)
+	}
+	for _, want := range []string{
+		`ExecStart=/usr/local/bin/helmfire daemon start -f "my helmfile.yaml" --drift-interval=5m`,
+		"WorkingDirectory=/srv/deploy",
+		"Environment=KUBECONFIG=/home/dev/.kube/config",
+		"WantedBy=default.target",
+	} {
+		if !strings.Contains(svc.Content, want) {
+			t.Errorf("expected unit to contain %q:\n%s", want, svc.Content)
+		}
+	}
+
+	svc, err = New("linux", Config{Executable: "/usr/local/bin/helmfire", System: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if svc.Path != "/etc/systemd/system/"+SystemdUnitName || !strings.Contains(svc.Content, "WantedBy=multi-user.target") {
+		t.Errorf("unexpected system unit at %s:\n%s", svc.Path, svc.Content)
+	}
+}
+
+func TestNewLaunchd(t *testing.T) {
+	svc, err := New("darwin", Config{
+		Executable: "/opt/homebrew/bin/helmfire",
+		Args:       []string{"daemon", "start", "-f", "a&b.yaml"},
+		LogFile:    "/tmp/helmfire.log",
+		Env:        map[string]string{"PATH": "/usr/bin:/bin"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if svc.Manager != "launchd" || !strings.HasSuffix(svc.Path, "/Library/LaunchAgents/"+LaunchdLabel+".plist") {
+		t.Errorf("unexpected agent %s at %s", svc.Manager, svc.Path)
+	}
+
+	// The plist must be well-formed XML despite special characters
+	decoder := xml.NewDecoder(strings.NewReader(svc.Content))
+	decoder.Strict = true
+	for {
+		if _, err := decoder.Token(); err != nil {
+			if err != io.EOF {
+				t.Fatalf("invalid plist: %v\n%s", err, svc.Content)
+			}
+			break
+		}
+	}
+	for _, want := range []string{"<string>a&amp;b.yaml</string>", "<key>PATH</key>", "<string>/tmp/helmfire.log</string>"} {
+		if !strings.Contains(svc.Content, want) {
+			t.Errorf("expected plist to contain %q:\n%s", want, svc.Content)
+		}
+	}
+}
+
+func TestNewUnsupported(t *testing.T) {
+	if _, err := New("windows", Config{}); err == nil {
+		t.Error("expected an error for an unsupported platform")
+	}
+}
+
+func TestSystemdQuote(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "plain", want: "plain"},
+		{in: "", want: `""`},
+		{in: "with space", want: `"with space"`},
+		{in: `say "hi"`, want: `"say \"hi\""`},
+		{in: "$HOME/100%", want: `"$$HOME/100%%"`},
+	}
+
+	for _, tt := range tests {
+		if got := systemdQuote(tt.in); got != tt.want {
+			t.Errorf("systemdQuote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package substitute
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/httpclient"
+)
+
+// chartDownloadTimeout bounds downloading a chart archive
+const chartDownloadTimeout = 5 * time.Minute
+
+// isChartURL reports whether a substitution target is a chart archive URL
+func isChartURL(target string) bool {
+	return strings.HasPrefix(target, "https://") || strings.HasPrefix(target, "http://")
+}
+
+// isChartArchive reports whether a substitution target is a packaged chart
+func isChartArchive(target string) bool {
+	return strings.HasSuffix(target, ".tgz") || strings.HasSuffix(target, ".tar.gz")
+}
+
+// localChartArchive validates a packaged chart file and returns its absolute path
+func localChartArchive(archive string) (string, error) {
+	absPath, err := filepath.Abs(archive)
+	if err != nil {
+		return "", fmt.Errorf("invalid local path: %w", err)
+	}
+
+	if err := validateChartArchive(absPath); err != nil {
+		return "", err
+	}
+	return absPath, nil
+}
+
+// downloadChartArchive downloads a packaged chart into the cache and returns
+// the downloaded file
+func (m *Manager) downloadChartArchive(url string) (string, error) {
+	m.mu.RLock()
+	dir := filepath.Join(m.cacheRoot, "charts")
+	m.mu.RUnlock()
+
+	archive, err := downloadChart(url, dir)
+	if err != nil {
+		return "", err
+	}
+	if err := validateChartArchive(archive); err != nil {
+		os.Remove(archive)
+		return "", fmt.Errorf("invalid chart archive at %s: %w", url, err)
+	}
+	return archive, nil
+}
+
+// downloadChart fetches a chart archive into dir and returns the file path.
+// The file name is derived from the URL, so re-adding a URL replaces the
+// previous download.
+func downloadChart(url, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create chart cache: %w", err)
+	}
+
+	client := httpclient.New(chartDownloadTimeout)
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("failed to download chart: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download chart from %s: %s", url, resp.Status)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".download-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create chart file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to download chart from %s: %w", url, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write chart file: %w", err)
+	}
+
+	sum := sha256.Sum256([]byte(url))
+	name := hex.EncodeToString(sum[:])[:16] + "-" + strings.TrimSuffix(path.Base(strings.SplitN(url, "?", 2)[0]), ".tar.gz")
+	if !strings.HasSuffix(name, ".tgz") {
+		name += ".tgz"
+	}
+
+	archive := filepath.Join(dir, name)
+	if err := os.Rename(tmp.Name(), archive); err != nil {
+		return "", fmt.Errorf("failed to store chart file: %w", err)
+	}
+	return archive, nil
+}
+
+// validateChartArchive checks that a file is a gzipped tarball containing a
+// chart, i.e. a <name>/Chart.yaml entry, as produced by helm package
+func validateChartArchive(archive string) error {
+	_, err := readArchiveChartYAML(archive)
+	return err
+}
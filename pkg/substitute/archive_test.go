@@ -0,0 +1,111 @@
+package substitute
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// packageChart builds a chart archive in the layout helm package produces
+func packageChart(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestChartArchiveSubstitution(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "nginx-1.0.0.tgz")
+	if err := os.WriteFile(valid, packageChart(t, map[string]string{
+		"nginx/Chart.yaml":  "name: nginx\nversion: 1.0.0\n",
+		"nginx/values.yaml": "",
+	}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	noChart := filepath.Join(dir, "empty-1.0.0.tgz")
+	if err := os.WriteFile(noChart, packageChart(t, map[string]string{"empty/values.yaml": ""}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	notGzip := filepath.Join(dir, "broken.tgz")
+	if err := os.WriteFile(notGzip, []byte("not a chart"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager()
+	if err := m.AddChartSubstitution("bitnami/nginx", valid); err != nil {
+		t.Fatalf("AddChartSubstitution failed: %v", err)
+	}
+	if path, ok := m.GetChartPath("bitnami/nginx"); !ok || path != valid {
+		t.Errorf("expected archive path %s, got %s", valid, path)
+	}
+
+	for _, archive := range []string{noChart, notGzip, filepath.Join(dir, "missing.tgz")} {
+		if err := m.AddChartSubstitution("bitnami/other", archive); err == nil {
+			t.Errorf("expected error for %s", archive)
+		}
+	}
+}
+
+func TestChartURLSubstitution(t *testing.T) {
+	archive := packageChart(t, map[string]string{"nginx/Chart.yaml": "name: nginx\nversion: 1.0.0\n"})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/charts/nginx-1.0.0.tgz":
+			w.Write(archive)
+		case "/charts/broken.tgz":
+			w.Write([]byte("<html>login</html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	m := NewManager()
+	m.SetCacheRoot(t.TempDir())
+
+	if err := m.AddChartSubstitution("bitnami/nginx", server.URL+"/charts/nginx-1.0.0.tgz"); err != nil {
+		t.Fatalf("AddChartSubstitution failed: %v", err)
+	}
+	path, ok := m.GetChartPath("bitnami/nginx")
+	if !ok {
+		t.Fatal("Chart substitution not found")
+	}
+	if filepath.Ext(path) != ".tgz" {
+		t.Errorf("expected downloaded archive, got %s", path)
+	}
+	if err := validateChartArchive(path); err != nil {
+		t.Errorf("downloaded archive invalid: %v", err)
+	}
+
+	for _, url := range []string{server.URL + "/charts/broken.tgz", server.URL + "/charts/missing.tgz"} {
+		if err := m.AddChartSubstitution("bitnami/other", url); err == nil {
+			t.Errorf("expected error for %s", url)
+		}
+	}
+}
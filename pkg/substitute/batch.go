@@ -0,0 +1,106 @@
+package substitute
+
+import (
+	"fmt"
+	"time"
+)
+
+// Ref identifies a substitution by its original and scope
+type Ref struct {
+	Original string
+	Scope    Scope
+}
+
+// Batch is a set of substitution changes applied all-or-nothing by
+// ApplyBatch. Removals are applied before additions.
+type Batch struct {
+	Add          Snapshot
+	RemoveCharts []Ref
+	RemoveImages []Ref
+}
+
+// ApplyBatch applies a batch of changes. Every chart is fetched and every
+// removal checked before anything changes, so on error the substitutions
+// are left as they were.
+func (m *Manager) ApplyBatch(b Batch) error {
+	type resolvedChart struct {
+		path string
+		git  *gitChart
+	}
+
+	// Fetch charts without holding the lock; git clones and downloads are slow
+	charts := make([]resolvedChart, len(b.Add.Charts))
+	for i, c := range b.Add.Charts {
+		if c.Original == "" {
+			return fmt.Errorf("chart substitution %d: original is required", i+1)
+		}
+		path, git, err := m.resolveChart(c.Path)
+		if err != nil {
+			return fmt.Errorf("chart substitution %s: %w", c.Original, err)
+		}
+		charts[i] = resolvedChart{path: path, git: git}
+	}
+	for i, img := range b.Add.Images {
+		if img.Original == "" || img.Replacement == "" {
+			return fmt.Errorf("image substitution %d: image references cannot be empty", i+1)
+		}
+		if err := ValidateImageReference(img.Original); err != nil {
+			return fmt.Errorf("image substitution %d: %w", i+1, err)
+		}
+		if err := ValidateImageReference(img.Replacement); err != nil {
+			return fmt.Errorf("image substitution %d: %w", i+1, err)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range b.RemoveCharts {
+		if _, ok := m.charts[key{r.Scope, r.Original}]; !ok {
+			return fmt.Errorf("chart substitution not found: %s%s", r.Original, scopeSuffix(r.Scope))
+		}
+	}
+	for _, r := range b.RemoveImages {
+		if _, ok := m.images[key{r.Scope, r.Original}]; !ok {
+			return fmt.Errorf("image substitution not found: %s%s", r.Original, scopeSuffix(r.Scope))
+		}
+	}
+
+	for _, r := range b.RemoveCharts {
+		k := key{r.Scope, r.Original}
+		delete(m.charts, k)
+		delete(m.gitCharts, k)
+		delete(m.chartExpiry, k)
+	}
+	for _, r := range b.RemoveImages {
+		k := key{r.Scope, r.Original}
+		delete(m.images, k)
+		delete(m.imageExpiry, k)
+	}
+
+	for i, c := range b.Add.Charts {
+		k := key{c.Scope(), c.Original}
+		m.charts[k] = charts[i].path
+		if charts[i].git != nil {
+			m.gitCharts[k] = charts[i].git
+		} else {
+			delete(m.gitCharts, k)
+		}
+		setExpiryAt(m.chartExpiry, k, c.ExpiresAt)
+	}
+	for _, img := range b.Add.Images {
+		k := key{img.Scope(), img.Original}
+		m.images[k] = img.Replacement
+		setExpiryAt(m.imageExpiry, k, img.ExpiresAt)
+	}
+	return nil
+}
+
+// setExpiryAt records when a substitution expires, or clears it for nil
+func setExpiryAt(expiry map[key]time.Time, k key, at *time.Time) {
+	if at == nil {
+		delete(expiry, k)
+		return
+	}
+	expiry[k] = *at
+}
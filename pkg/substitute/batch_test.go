@@ -0,0 +1,101 @@
+package substitute
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestApplyBatch(t *testing.T) {
+	chartDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte("apiVersion: v2\nname: nginx\nversion: 1.0.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager()
+	m.AddImageSubstitution("redis:7", "local/redis:old")
+	m.AddScopedImageSubstitution("postgres:15", "local/pg:mine", Scope{Release: "my-db"})
+
+	expiresAt := time.Now().Add(time.Hour)
+	err := m.ApplyBatch(Batch{
+		Add: Snapshot{
+			Charts: []SnapshotChart{{Original: "bitnami/nginx", Path: chartDir, Namespace: "web"}},
+			Images: []SnapshotImage{{Original: "nginx:1.21", Replacement: "local/nginx:dev", ExpiresAt: &expiresAt}},
+		},
+		RemoveImages: []Ref{{Original: "postgres:15", Scope: Scope{Release: "my-db"}}},
+	})
+	if err != nil {
+		t.Fatalf("ApplyBatch failed: %v", err)
+	}
+
+	if path, ok := m.GetChartPathFor("bitnami/nginx", "any", "web"); !ok || path != chartDir {
+		t.Errorf("expected scoped chart substitution, got %q", path)
+	}
+	if _, ok := m.GetChartPath("bitnami/nginx"); ok {
+		t.Error("expected chart substitution to be scoped to the web namespace")
+	}
+	if len(m.ListImageSubstitutions()) != 2 {
+		t.Errorf("expected redis and nginx image substitutions, got %+v", m.ListImageSubstitutions())
+	}
+	for _, img := range m.ListImageSubstitutions() {
+		if img.Original == "nginx:1.21" && !img.ExpiresAt.Equal(expiresAt) {
+			t.Errorf("expected nginx substitution to expire at %s, got %s", expiresAt, img.ExpiresAt)
+		}
+	}
+}
+
+func TestApplyBatchAllOrNothing(t *testing.T) {
+	chartDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte("apiVersion: v2\nname: nginx\nversion: 1.0.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		batch Batch
+	}{
+		{
+			name: "missing chart",
+			batch: Batch{
+				Add: Snapshot{
+					Images: []SnapshotImage{{Original: "nginx:1.21", Replacement: "local/nginx:dev"}},
+					Charts: []SnapshotChart{{Original: "bitnami/nginx", Path: filepath.Join(chartDir, "missing")}},
+				},
+				RemoveImages: []Ref{{Original: "redis:7"}},
+			},
+		},
+		{
+			name: "unknown removal",
+			batch: Batch{
+				Add:          Snapshot{Charts: []SnapshotChart{{Original: "bitnami/nginx", Path: chartDir}}},
+				RemoveImages: []Ref{{Original: "redis:7"}, {Original: "redis:7", Scope: Scope{Release: "cache"}}},
+			},
+		},
+		{
+			name: "empty image",
+			batch: Batch{
+				Add:          Snapshot{Images: []SnapshotImage{{Original: "nginx:1.21"}}},
+				RemoveImages: []Ref{{Original: "redis:7"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager()
+			m.AddImageSubstitution("redis:7", "local/redis:dev")
+
+			if err := m.ApplyBatch(tt.batch); err == nil {
+				t.Fatal("expected ApplyBatch to fail")
+			}
+
+			if _, ok := m.GetImageReplacement("redis:7"); !ok {
+				t.Error("expected removal not to be applied")
+			}
+			if len(m.ListChartSubstitutions()) != 0 || len(m.ListImageSubstitutions()) != 1 {
+				t.Error("expected no additions to be applied")
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package substitute
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ChartMetadata is the subset of Chart.yaml used to check substitutions
+type ChartMetadata struct {
+	APIVersion string `yaml:"apiVersion"`
+	Name       string `yaml:"name"`
+	Version    string `yaml:"version"`
+}
+
+// VersionConstraint is a release's version: constraint on a chart
+type VersionConstraint struct {
+	Release    string
+	Constraint string
+}
+
+// ParseChartMetadata parses Chart.yaml contents
+func ParseChartMetadata(data []byte) (*ChartMetadata, error) {
+	var meta ChartMetadata
+	if err := yaml.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("failed to parse Chart.yaml: %w", err)
+	}
+	return &meta, nil
+}
+
+// LoadChartMetadata reads Chart.yaml from a chart directory or archive
+func LoadChartMetadata(chartPath string) (*ChartMetadata, error) {
+	if isChartArchive(chartPath) {
+		data, err := readArchiveChartYAML(chartPath)
+		if err != nil {
+			return nil, err
+		}
+		return ParseChartMetadata(data)
+	}
+
+	data, err := os.ReadFile(filepath.Join(chartPath, "Chart.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Chart.yaml: %w", err)
+	}
+	return ParseChartMetadata(data)
+}
+
+// ChartMetadata returns the Chart.yaml of the chart substituted for original in scope
+func (m *Manager) ChartMetadata(original string, scope Scope) (*ChartMetadata, error) {
+	m.mu.RLock()
+	localPath, ok := m.charts[key{scope, original}]
+	m.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("chart substitution not found: %s%s", original, scopeSuffix(scope))
+	}
+	return LoadChartMetadata(localPath)
+}
+
+// CheckCompatibility compares a substituted chart with the chart it replaces
+// and returns a warning for each likely mistake: a different chart name, a
+// different apiVersion (when the original's metadata is known) or a version
+// outside a release's constraint.
+func CheckCompatibility(original string, originalMeta, local *ChartMetadata, constraints []VersionConstraint) []string {
+	var warnings []string
+
+	if name := chartName(original); name != "" && local.Name != name {
+		warnings = append(warnings, fmt.Sprintf("chart name %q does not match %q", local.Name, name))
+	}
+
+	if originalMeta != nil && originalMeta.APIVersion != "" && local.APIVersion != originalMeta.APIVersion {
+		warnings = append(warnings, fmt.Sprintf("chart apiVersion %s differs from %s of %s", local.APIVersion, originalMeta.APIVersion, original))
+	}
+
+	for _, c := range constraints {
+		if c.Constraint == "" {
+			continue
+		}
+		ok, err := SatisfiesConstraint(local.Version, c.Constraint)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("cannot check version %q against release %s constraint %q: %v", local.Version, c.Release, c.Constraint, err))
+			continue
+		}
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("chart version %s does not satisfy release %s constraint %q", local.Version, c.Release, c.Constraint))
+		}
+	}
+
+	return warnings
+}
+
+// chartName returns the chart name of a reference such as bitnami/nginx or
+// oci://registry.example.com/charts/nginx
+func chartName(ref string) string {
+	ref = strings.TrimSuffix(ref, "/")
+	if idx := strings.Index(ref, "://"); idx >= 0 {
+		ref = ref[idx+3:]
+	}
+	return path.Base(ref)
+}
+
+// readArchiveChartYAML returns the top-level Chart.yaml of a chart archive
+func readArchiveChartYAML(archive string) ([]byte, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, fmt.Errorf("chart archive does not exist: %w", err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("not a valid chart archive (not gzip compressed): %s", archive)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("not a valid chart archive (missing Chart.yaml): %s", archive)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("not a valid chart archive: %s: %w", archive, err)
+		}
+
+		parts := strings.Split(strings.TrimPrefix(header.Name, "./"), "/")
+		if len(parts) == 2 && parts[1] == "Chart.yaml" {
+			return io.ReadAll(tr)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package substitute
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadChartMetadata(t *testing.T) {
+	dir := t.TempDir()
+	chartYAML := "apiVersion: v2\nname: nginx\nversion: 15.0.0\n"
+
+	if err := os.WriteFile(filepath.Join(dir, "Chart.yaml"), []byte(chartYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(t.TempDir(), "nginx-15.0.0.tgz")
+	if err := os.WriteFile(archive, packageChart(t, map[string]string{"nginx/Chart.yaml": chartYAML}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{dir, archive} {
+		meta, err := LoadChartMetadata(path)
+		if err != nil {
+			t.Fatalf("LoadChartMetadata(%s) failed: %v", path, err)
+		}
+		if meta.APIVersion != "v2" || meta.Name != "nginx" || meta.Version != "15.0.0" {
+			t.Errorf("unexpected metadata from %s: %+v", path, meta)
+		}
+	}
+}
+
+func TestCheckCompatibility(t *testing.T) {
+	local := &ChartMetadata{APIVersion: "v2", Name: "nginx", Version: "15.0.0"}
+
+	tests := []struct {
+		name        string
+		original    string
+		meta        *ChartMetadata
+		constraints []VersionConstraint
+		expected    []string
+	}{
+		{"compatible", "bitnami/nginx", &ChartMetadata{APIVersion: "v2", Name: "nginx"}, []VersionConstraint{{"web", "^15.0.0"}, {"api", ""}}, nil},
+		{"oci reference", "oci://registry.example.com/charts/nginx", nil, nil, nil},
+		{"name mismatch", "bitnami/postgresql", nil, nil, []string{"does not match"}},
+		{"apiVersion mismatch", "bitnami/nginx", &ChartMetadata{APIVersion: "v1", Name: "nginx"}, nil, []string{"apiVersion"}},
+		{"version outside constraint", "bitnami/nginx", nil, []VersionConstraint{{"web", "~14.2.0"}}, []string{"release web constraint"}},
+		{"unparsable constraint", "bitnami/nginx", nil, []VersionConstraint{{"web", ">=abc"}}, []string{"cannot check"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings := CheckCompatibility(tt.original, tt.meta, local, tt.constraints)
+			if len(warnings) != len(tt.expected) {
+				t.Fatalf("expected %d warning(s), got %v", len(tt.expected), warnings)
+			}
+			for i, want := range tt.expected {
+				if !strings.Contains(warnings[i], want) {
+					t.Errorf("warning %q does not mention %q", warnings[i], want)
+				}
+			}
+		})
+	}
+}
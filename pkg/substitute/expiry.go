@@ -0,0 +1,73 @@
+package substitute
+
+import (
+	"fmt"
+	"time"
+)
+
+// SetChartTTL makes a chart substitution expire after ttl. A ttl of zero
+// keeps the substitution until it is removed.
+func (m *Manager) SetChartTTL(original string, scope Scope, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := key{scope, original}
+	if _, ok := m.charts[k]; !ok {
+		return fmt.Errorf("chart substitution not found: %s%s", original, scopeSuffix(scope))
+	}
+	setExpiry(m.chartExpiry, k, ttl)
+	return nil
+}
+
+// SetImageTTL makes an image substitution expire after ttl. A ttl of zero
+// keeps the substitution until it is removed.
+func (m *Manager) SetImageTTL(original string, scope Scope, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := key{scope, original}
+	if _, ok := m.images[k]; !ok {
+		return fmt.Errorf("image substitution not found: %s%s", original, scopeSuffix(scope))
+	}
+	setExpiry(m.imageExpiry, k, ttl)
+	return nil
+}
+
+// setExpiry records when a substitution expires, or clears it for ttl <= 0
+func setExpiry(expiry map[key]time.Time, k key, ttl time.Duration) {
+	if ttl <= 0 {
+		delete(expiry, k)
+		return
+	}
+	expiry[k] = time.Now().Add(ttl)
+}
+
+// ExpireSubstitutions removes substitutions whose TTL has passed at now and
+// returns them
+func (m *Manager) ExpireSubstitutions(now time.Time) ([]ChartSubstitution, []ImageSubstitution) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var charts []ChartSubstitution
+	for k, expiresAt := range m.chartExpiry {
+		if now.Before(expiresAt) {
+			continue
+		}
+		charts = append(charts, m.chartSubstitution(k))
+		delete(m.charts, k)
+		delete(m.gitCharts, k)
+		delete(m.chartExpiry, k)
+	}
+
+	var images []ImageSubstitution
+	for k, expiresAt := range m.imageExpiry {
+		if now.Before(expiresAt) {
+			continue
+		}
+		images = append(images, m.imageSubstitution(k))
+		delete(m.images, k)
+		delete(m.imageExpiry, k)
+	}
+
+	return charts, images
+}
@@ -0,0 +1,54 @@
+package substitute
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpireSubstitutions(t *testing.T) {
+	m := NewManager()
+
+	m.AddImageSubstitution("nginx:1.21", "nginx:dev")
+	m.AddImageSubstitution("postgres:15", "local/pg:dev")
+	m.AddScopedImageSubstitution("postgres:15", "local/pg:mine", Scope{Release: "my-db"})
+
+	if err := m.SetImageTTL("postgres:15", Scope{}, time.Hour); err != nil {
+		t.Fatalf("SetImageTTL failed: %v", err)
+	}
+	if err := m.SetImageTTL("postgres:15", Scope{Release: "my-db"}, 2*time.Hour); err != nil {
+		t.Fatalf("SetImageTTL failed: %v", err)
+	}
+	if err := m.SetImageTTL("redis:7", Scope{}, time.Hour); err == nil {
+		t.Error("expected error setting TTL on unknown substitution")
+	}
+
+	for _, sub := range m.ListImageSubstitutions() {
+		if sub.Original == "nginx:1.21" && !sub.ExpiresAt.IsZero() {
+			t.Errorf("expected no expiry for %s, got %s", sub.Original, sub.ExpiresAt)
+		}
+		if sub.Original == "postgres:15" && sub.ExpiresAt.IsZero() {
+			t.Errorf("expected expiry for %s%s", sub.Original, scopeSuffix(sub.Scope))
+		}
+	}
+
+	if _, images := m.ExpireSubstitutions(time.Now()); len(images) != 0 {
+		t.Errorf("expected nothing to expire yet, got %v", images)
+	}
+
+	_, images := m.ExpireSubstitutions(time.Now().Add(90 * time.Minute))
+	if len(images) != 1 || images[0].Original != "postgres:15" || !images[0].Scope.IsGlobal() {
+		t.Fatalf("expected the global postgres substitution to expire, got %v", images)
+	}
+	if _, ok := m.GetImageReplacement("postgres:15"); ok {
+		t.Error("expected expired substitution to be removed")
+	}
+	if len(m.ListImageSubstitutions()) != 2 {
+		t.Errorf("expected 2 remaining substitutions, got %v", m.ListImageSubstitutions())
+	}
+
+	// Re-adding a substitution clears its TTL
+	m.AddScopedImageSubstitution("postgres:15", "local/pg:mine", Scope{Release: "my-db"})
+	if _, images := m.ExpireSubstitutions(time.Now().Add(3 * time.Hour)); len(images) != 0 {
+		t.Errorf("expected re-added substitution to no longer expire, got %v", images)
+	}
+}
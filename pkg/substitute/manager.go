@@ -4,117 +4,353 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/gitsource"
 )
 
 // Manager handles chart and image substitutions
 type Manager struct {
-	charts map[string]string // original chart -> local path
-	images map[string]string // original image -> replacement
-	mu     sync.RWMutex
+	charts    map[key]string    // original chart -> local path
+	gitCharts map[key]*gitChart // original chart -> git checkout of the local path
+	images    map[key]string    // original image -> replacement
+	cacheRoot string
+
+	chartExpiry map[key]time.Time
+	imageExpiry map[key]time.Time
+
+	providers []Provider
+
+	mu sync.RWMutex
+}
+
+// Scope limits a substitution to a release, a namespace or both. The zero
+// Scope applies to all releases.
+type Scope struct {
+	Release   string
+	Namespace string
+}
+
+// IsGlobal reports whether the scope applies to all releases
+func (s Scope) IsGlobal() bool {
+	return s.Release == "" && s.Namespace == ""
+}
+
+// String returns the scope as release, namespace/release or namespace/*
+func (s Scope) String() string {
+	switch {
+	case s.IsGlobal():
+		return "*"
+	case s.Namespace == "":
+		return s.Release
+	case s.Release == "":
+		return s.Namespace + "/*"
+	}
+	return s.Namespace + "/" + s.Release
+}
+
+// Matches reports whether the scope applies to a release in namespace
+func (s Scope) Matches(release, namespace string) bool {
+	return (s.Release == "" || s.Release == release) && (s.Namespace == "" || s.Namespace == namespace)
 }
 
-// ChartSubstitution represents a chart override
+// candidates returns the scopes that apply to a release, most specific first
+func candidates(release, namespace string) []Scope {
+	return []Scope{
+		{Release: release, Namespace: namespace},
+		{Release: release},
+		{Namespace: namespace},
+		{},
+	}
+}
+
+// key identifies a substitution of original within a scope
+type key struct {
+	Scope
+	original string
+}
+
+// gitChart is a chart checked out from git into a cache directory
+type gitChart struct {
+	source *gitsource.Source
+	dir    string
+	mu     sync.Mutex // serializes fetches into dir
+}
+
+// ChartSubstitution represents a chart override. Source is the git:: URL
+// the local path is checked out from, if any. ExpiresAt is zero for
+// substitutions without a TTL.
 type ChartSubstitution struct {
 	Original  string
 	LocalPath string
+	Source    string
+	Scope     Scope
+	ExpiresAt time.Time
 }
 
-// ImageSubstitution represents an image override
+// ImageSubstitution represents an image override. ExpiresAt is zero for
+// substitutions without a TTL.
 type ImageSubstitution struct {
 	Original    string
 	Replacement string
+	Scope       Scope
+	ExpiresAt   time.Time
+	Provider    string // the provider that supplied it; empty when added by hand
 }
 
 // NewManager creates a new substitution manager
 func NewManager() *Manager {
 	return &Manager{
-		charts: make(map[string]string),
-		images: make(map[string]string),
+		charts:    make(map[key]string),
+		gitCharts: make(map[key]*gitChart),
+		images:    make(map[key]string),
+		cacheRoot: filepath.Dir(gitsource.DefaultCacheRoot()),
+
+		chartExpiry: make(map[key]time.Time),
+		imageExpiry: make(map[key]time.Time),
 	}
 }
 
-// AddChartSubstitution registers a chart substitution
+// SetCacheRoot sets the directory git checkouts and downloaded chart
+// archives are cached under
+func (m *Manager) SetCacheRoot(root string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cacheRoot = root
+}
+
+// AddChartSubstitution registers a chart substitution for all releases
 func (m *Manager) AddChartSubstitution(original, localPath string) error {
+	return m.AddScopedChartSubstitution(original, localPath, Scope{})
+}
+
+// AddScopedChartSubstitution registers a chart substitution for the releases
+// in scope. localPath is a chart directory, a packaged chart (.tgz), an
+// http(s) URL of a packaged chart, which is downloaded into the cache, or a
+// git:: URL, which is cloned into the cache:
+//
+//	git::https://github.com/org/charts//charts/nginx?ref=feature-x
+func (m *Manager) AddScopedChartSubstitution(original, localPath string, scope Scope) error {
+	path, git, err := m.resolveChart(localPath)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := key{scope, original}
+	m.charts[k] = path
+	delete(m.chartExpiry, k)
+	if git != nil {
+		m.gitCharts[k] = git
+	} else {
+		delete(m.gitCharts, k)
+	}
+	return nil
+}
+
+// resolveChart fetches or validates the chart a substitution points at and
+// returns its local path, and its checkout for git charts
+func (m *Manager) resolveChart(localPath string) (string, *gitChart, error) {
+	switch {
+	case gitsource.IsGitURL(localPath):
+		return m.fetchGitChart(localPath)
+	case isChartURL(localPath):
+		path, err := m.downloadChartArchive(localPath)
+		return path, nil, err
+	case isChartArchive(localPath):
+		path, err := localChartArchive(localPath)
+		return path, nil, err
+	}
+	path, err := localChartDir(localPath)
+	return path, nil, err
+}
+
+// localChartDir validates a chart directory and returns its absolute path
+func localChartDir(localPath string) (string, error) {
 	// Validate local path exists
 	absPath, err := filepath.Abs(localPath)
 	if err != nil {
-		return fmt.Errorf("invalid local path: %w", err)
+		return "", fmt.Errorf("invalid local path: %w", err)
 	}
 
 	if _, err := os.Stat(absPath); err != nil {
-		return fmt.Errorf("local path does not exist: %w", err)
+		return "", fmt.Errorf("local path does not exist: %w", err)
 	}
 
 	// Check if it's a valid chart directory
 	chartYAML := filepath.Join(absPath, "Chart.yaml")
 	if _, err := os.Stat(chartYAML); err != nil {
-		return fmt.Errorf("not a valid chart directory (missing Chart.yaml): %s", absPath)
+		return "", fmt.Errorf("not a valid chart directory (missing Chart.yaml): %s", absPath)
 	}
 
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	return absPath, nil
+}
 
-	m.charts[original] = absPath
-	return nil
+// fetchGitChart clones a chart from git and returns its checkout
+func (m *Manager) fetchGitChart(ref string) (string, *gitChart, error) {
+	source, err := gitsource.Parse(ref)
+	if err != nil {
+		return "", nil, err
+	}
+
+	m.mu.RLock()
+	dir := source.CacheDir(filepath.Join(m.cacheRoot, "git"))
+	m.mu.RUnlock()
+
+	chart := &gitChart{source: source, dir: dir}
+	chart.mu.Lock()
+	path, _, err := source.Fetch(dir)
+	chart.mu.Unlock()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to fetch chart: %w", err)
+	}
+	if _, err := os.Stat(filepath.Join(path, "Chart.yaml")); err != nil {
+		return "", nil, fmt.Errorf("not a valid chart directory (missing Chart.yaml): %s", source)
+	}
+
+	return path, chart, nil
+}
+
+// RefreshChart updates a git-backed chart substitution to the latest commit
+// of its ref. changed reports whether a new commit was checked out; it is
+// always false for local directory substitutions.
+func (m *Manager) RefreshChart(original string) (changed bool, err error) {
+	return m.RefreshChartFor(original, "", "")
 }
 
-// AddImageSubstitution registers an image substitution
+// RefreshChartFor refreshes the git-backed chart substitution that applies
+// to a release, like RefreshChart
+func (m *Manager) RefreshChartFor(original, release, namespace string) (changed bool, err error) {
+	m.mu.RLock()
+	k, ok := lookup(m.charts, original, release, namespace)
+	chart, isGit := m.gitCharts[k]
+	m.mu.RUnlock()
+
+	if !ok || !isGit {
+		return false, nil
+	}
+
+	chart.mu.Lock()
+	defer chart.mu.Unlock()
+
+	if _, changed, err = chart.source.Fetch(chart.dir); err != nil {
+		return false, fmt.Errorf("failed to refresh chart %s from %s: %w", original, chart.source, err)
+	}
+	return changed, nil
+}
+
+// AddImageSubstitution registers an image substitution for all releases
 func (m *Manager) AddImageSubstitution(original, replacement string) error {
-	// TODO: Validate image references
+	return m.AddScopedImageSubstitution(original, replacement, Scope{})
+}
+
+// AddScopedImageSubstitution registers an image substitution for the releases in scope
+func (m *Manager) AddScopedImageSubstitution(original, replacement string, scope Scope) error {
 	if original == "" || replacement == "" {
 		return fmt.Errorf("image references cannot be empty")
 	}
+	if err := ValidateImageReference(original); err != nil {
+		return err
+	}
+	if err := ValidateImageReference(replacement); err != nil {
+		return err
+	}
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.images[original] = replacement
+	k := key{scope, original}
+	m.images[k] = replacement
+	delete(m.imageExpiry, k)
 	return nil
 }
 
-// RemoveChartSubstitution removes a chart substitution
+// RemoveChartSubstitution removes a chart substitution for all releases
 func (m *Manager) RemoveChartSubstitution(original string) error {
+	return m.RemoveScopedChartSubstitution(original, Scope{})
+}
+
+// RemoveScopedChartSubstitution removes a chart substitution registered for scope
+func (m *Manager) RemoveScopedChartSubstitution(original string, scope Scope) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if _, ok := m.charts[original]; !ok {
-		return fmt.Errorf("chart substitution not found: %s", original)
+	k := key{scope, original}
+	if _, ok := m.charts[k]; !ok {
+		return fmt.Errorf("chart substitution not found: %s%s", original, scopeSuffix(scope))
 	}
 
-	delete(m.charts, original)
+	delete(m.charts, k)
+	delete(m.gitCharts, k)
+	delete(m.chartExpiry, k)
 	return nil
 }
 
-// RemoveImageSubstitution removes an image substitution
+// RemoveImageSubstitution removes an image substitution for all releases
 func (m *Manager) RemoveImageSubstitution(original string) error {
+	return m.RemoveScopedImageSubstitution(original, Scope{})
+}
+
+// RemoveScopedImageSubstitution removes an image substitution registered for scope
+func (m *Manager) RemoveScopedImageSubstitution(original string, scope Scope) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if _, ok := m.images[original]; !ok {
-		return fmt.Errorf("image substitution not found: %s", original)
+	k := key{scope, original}
+	if _, ok := m.images[k]; !ok {
+		return fmt.Errorf("image substitution not found: %s%s", original, scopeSuffix(scope))
 	}
 
-	delete(m.images, original)
+	delete(m.images, k)
+	delete(m.imageExpiry, k)
 	return nil
 }
 
-// GetChartPath returns the local path for a chart, if substituted
+// scopeSuffix describes a non-global scope in error messages
+func scopeSuffix(scope Scope) string {
+	if scope.IsGlobal() {
+		return ""
+	}
+	return " (scope " + scope.String() + ")"
+}
+
+// GetChartPath returns the local path for a chart, if substituted for all releases
 func (m *Manager) GetChartPath(original string) (string, bool) {
+	return m.GetChartPathFor(original, "", "")
+}
+
+// GetChartPathFor returns the local path for a chart in a release, using the
+// most specific substitution that applies to it
+func (m *Manager) GetChartPathFor(original, release, namespace string) (string, bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	path, ok := m.charts[original]
-	return path, ok
+	k, ok := lookup(m.charts, original, release, namespace)
+	return m.charts[k], ok
 }
 
-// GetImageReplacement returns the replacement image, if substituted
+// GetImageReplacement returns the replacement image, if substituted for all releases
 func (m *Manager) GetImageReplacement(original string) (string, bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	replacement, ok := m.images[original]
-	return replacement, ok
+	k, ok := lookup(m.images, original, "", "")
+	return m.images[k], ok
+}
+
+// lookup finds the most specific substitution of original that applies to a release
+func lookup(table map[key]string, original, release, namespace string) (key, bool) {
+	for _, scope := range candidates(release, namespace) {
+		k := key{scope, original}
+		if _, ok := table[k]; ok {
+			return k, true
+		}
+	}
+	return key{}, false
 }
 
 // ListChartSubstitutions returns all chart substitutions
@@ -123,37 +359,76 @@ func (m *Manager) ListChartSubstitutions() []ChartSubstitution {
 	defer m.mu.RUnlock()
 
 	result := make([]ChartSubstitution, 0, len(m.charts))
-	for original, localPath := range m.charts {
-		result = append(result, ChartSubstitution{
-			Original:  original,
-			LocalPath: localPath,
-		})
+	for k := range m.charts {
+		result = append(result, m.chartSubstitution(k))
 	}
 	return result
 }
 
+// chartSubstitution describes the chart substitution stored under k
+func (m *Manager) chartSubstitution(k key) ChartSubstitution {
+	sub := ChartSubstitution{
+		Original:  k.original,
+		LocalPath: m.charts[k],
+		Scope:     k.Scope,
+		ExpiresAt: m.chartExpiry[k],
+	}
+	if chart, ok := m.gitCharts[k]; ok {
+		sub.Source = chart.source.String()
+	}
+	return sub
+}
+
 // ListImageSubstitutions returns all image substitutions
 func (m *Manager) ListImageSubstitutions() []ImageSubstitution {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	result := make([]ImageSubstitution, 0, len(m.images))
-	for original, replacement := range m.images {
-		result = append(result, ImageSubstitution{
-			Original:    original,
-			Replacement: replacement,
-		})
+	for k := range m.images {
+		result = append(result, m.imageSubstitution(k))
 	}
 	return result
 }
 
-// ApplyChartSubstitutions applies chart substitutions to a chart reference
-// Returns the substituted path and true if a substitution was applied
-func (m *Manager) ApplyChartSubstitutions(chart string) (string, bool) {
+// imageSubstitution describes the image substitution stored under k
+func (m *Manager) imageSubstitution(k key) ImageSubstitution {
+	return ImageSubstitution{
+		Original:    k.original,
+		Replacement: m.images[k],
+		Scope:       k.Scope,
+		ExpiresAt:   m.imageExpiry[k],
+	}
+}
+
+// ImageSubstitutionsFor returns the image substitutions that apply to a
+// release, sorted by original image. When an image is substituted in several
+// matching scopes, the most specific substitution wins.
+func (m *Manager) ImageSubstitutionsFor(release, namespace string) []ImageSubstitution {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	if localPath, ok := m.charts[chart]; ok {
+	seen := make(map[string]bool)
+	var result []ImageSubstitution
+	for k := range m.images {
+		if seen[k.original] {
+			continue
+		}
+		seen[k.original] = true
+
+		if best, ok := lookup(m.images, k.original, release, namespace); ok {
+			result = append(result, m.imageSubstitution(best))
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Original < result[j].Original })
+	return result
+}
+
+// ApplyChartSubstitutions applies chart substitutions to a chart reference
+// Returns the substituted path and true if a substitution was applied
+func (m *Manager) ApplyChartSubstitutions(chart string) (string, bool) {
+	if localPath, ok := m.GetChartPath(chart); ok {
 		return localPath, true
 	}
 	return chart, false
@@ -162,10 +437,7 @@ func (m *Manager) ApplyChartSubstitutions(chart string) (string, bool) {
 // ApplyImageSubstitutions applies image substitutions to an image reference
 // Returns the substituted image and true if a substitution was applied
 func (m *Manager) ApplyImageSubstitutions(image string) (string, bool) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	if replacement, ok := m.images[image]; ok {
+	if replacement, ok := m.GetImageReplacement(image); ok {
 		return replacement, true
 	}
 	return image, false
@@ -2,7 +2,9 @@ package substitute
 
 import (
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -247,3 +249,153 @@ func TestConcurrency(t *testing.T) {
 
 	// Should not have panicked
 }
+
+// gitRun runs git in dir with a fixed identity, failing the test on error
+func gitRun(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	args = append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+	if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, out)
+	}
+}
+
+func TestGitChartSubstitution(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	// Upstream repository with a chart in a subdirectory
+	upstream := t.TempDir()
+	gitRun(t, upstream, "init", "--quiet")
+	chartDir := filepath.Join(upstream, "charts", "nginx")
+	if err := os.MkdirAll(chartDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte("name: nginx\nversion: 1.0.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitRun(t, upstream, "add", ".")
+	gitRun(t, upstream, "commit", "--quiet", "-m", "initial")
+
+	m := NewManager()
+	m.SetCacheRoot(t.TempDir())
+
+	ref := "git::file://" + upstream + "//charts/nginx"
+	if err := m.AddChartSubstitution("bitnami/nginx", ref); err != nil {
+		t.Fatalf("AddChartSubstitution failed: %v", err)
+	}
+
+	path, ok := m.GetChartPath("bitnami/nginx")
+	if !ok {
+		t.Fatal("Chart substitution not found")
+	}
+	if _, err := os.Stat(filepath.Join(path, "Chart.yaml")); err != nil {
+		t.Errorf("expected checked out chart at %s: %v", path, err)
+	}
+
+	subs := m.ListChartSubstitutions()
+	if len(subs) != 1 || subs[0].Source != ref {
+		t.Errorf("expected source %s in listing, got %+v", ref, subs)
+	}
+
+	changed, err := m.RefreshChart("bitnami/nginx")
+	if err != nil || changed {
+		t.Errorf("expected unchanged refresh, got changed=%v err=%v", changed, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte("name: nginx\nversion: 1.1.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitRun(t, upstream, "commit", "--quiet", "-am", "bump")
+
+	changed, err = m.RefreshChart("bitnami/nginx")
+	if err != nil || !changed {
+		t.Fatalf("expected refresh to pick up new commit, got changed=%v err=%v", changed, err)
+	}
+	data, err := os.ReadFile(filepath.Join(path, "Chart.yaml"))
+	if err != nil || !strings.Contains(string(data), "1.1.0") {
+		t.Errorf("expected updated Chart.yaml, got %q (%v)", data, err)
+	}
+
+	// Paths without a Chart.yaml are rejected
+	if err := m.AddChartSubstitution("bitnami/other", "git::file://"+upstream+"//charts"); err == nil {
+		t.Error("expected error for git path without Chart.yaml")
+	}
+
+	// Local directory substitutions are never refreshed
+	if changed, err := m.RefreshChart("unknown/chart"); err != nil || changed {
+		t.Errorf("expected no-op refresh, got changed=%v err=%v", changed, err)
+	}
+}
+
+func TestScopedSubstitutions(t *testing.T) {
+	m := NewManager()
+
+	m.AddImageSubstitution("postgres:15", "registry.example.com/postgres:15")
+	m.AddScopedImageSubstitution("postgres:15", "local/pg:ns", Scope{Namespace: "data"})
+	m.AddScopedImageSubstitution("postgres:15", "local/pg:dev", Scope{Release: "my-db"})
+	m.AddScopedImageSubstitution("postgres:15", "local/pg:both", Scope{Release: "my-db", Namespace: "staging"})
+	m.AddScopedImageSubstitution("redis:7", "local/redis:dev", Scope{Release: "cache"})
+
+	tests := []struct {
+		release   string
+		namespace string
+		expected  map[string]string
+	}{
+		{"web", "default", map[string]string{"postgres:15": "registry.example.com/postgres:15"}},
+		{"other-db", "data", map[string]string{"postgres:15": "local/pg:ns"}},
+		{"my-db", "data", map[string]string{"postgres:15": "local/pg:dev"}},
+		{"my-db", "staging", map[string]string{"postgres:15": "local/pg:both"}},
+		{"cache", "default", map[string]string{"postgres:15": "registry.example.com/postgres:15", "redis:7": "local/redis:dev"}},
+	}
+
+	for _, tt := range tests {
+		subs := m.ImageSubstitutionsFor(tt.release, tt.namespace)
+		got := make(map[string]string, len(subs))
+		for _, s := range subs {
+			got[s.Original] = s.Replacement
+		}
+		if len(got) != len(tt.expected) {
+			t.Errorf("%s/%s: expected %v, got %v", tt.namespace, tt.release, tt.expected, got)
+			continue
+		}
+		for original, replacement := range tt.expected {
+			if got[original] != replacement {
+				t.Errorf("%s/%s: expected %s → %s, got %s", tt.namespace, tt.release, original, replacement, got[original])
+			}
+		}
+	}
+
+	// Global lookups ignore scoped substitutions
+	if replacement, _ := m.GetImageReplacement("postgres:15"); replacement != "registry.example.com/postgres:15" {
+		t.Errorf("expected global replacement, got %s", replacement)
+	}
+	if _, ok := m.GetImageReplacement("redis:7"); ok {
+		t.Error("expected scoped-only image to have no global replacement")
+	}
+
+	// Removal needs the scope the substitution was added with
+	if err := m.RemoveImageSubstitution("redis:7"); err == nil {
+		t.Error("expected error removing scoped substitution without its scope")
+	}
+	if err := m.RemoveScopedImageSubstitution("redis:7", Scope{Release: "cache"}); err != nil {
+		t.Errorf("RemoveScopedImageSubstitution failed: %v", err)
+	}
+	if len(m.ListImageSubstitutions()) != 4 {
+		t.Errorf("expected 4 image substitutions, got %d", len(m.ListImageSubstitutions()))
+	}
+
+	chartDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte("name: postgresql\nversion: 1.0.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddScopedChartSubstitution("bitnami/postgresql", chartDir, Scope{Release: "my-db"}); err != nil {
+		t.Fatalf("AddScopedChartSubstitution failed: %v", err)
+	}
+	if _, ok := m.GetChartPathFor("bitnami/postgresql", "my-db", "data"); !ok {
+		t.Error("expected scoped chart substitution for my-db")
+	}
+	if _, ok := m.GetChartPathFor("bitnami/postgresql", "other-db", "data"); ok {
+		t.Error("expected no chart substitution for other-db")
+	}
+}
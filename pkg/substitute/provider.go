@@ -0,0 +1,262 @@
+package substitute
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultProviderTimeout bounds each query to an exec provider
+const DefaultProviderTimeout = 30 * time.Second
+
+// Provider supplies substitutions the Manager asks for at sync time, for
+// charts and images that weren't substituted by hand: images built by an
+// internal build service, say. Providers are asked in the order they were
+// added; the first to substitute a chart or image wins.
+type Provider interface {
+	// Name identifies the provider in errors and listings
+	Name() string
+
+	// Chart returns the chart, a local path or a chart reference, to sync
+	// the release of query with instead of query.Chart; ok is false when
+	// the provider has none
+	Chart(ctx context.Context, query Query) (chart string, ok bool, err error)
+
+	// Images returns the replacements of images in the release of query,
+	// keyed by original image
+	Images(ctx context.Context, query Query) (map[string]string, error)
+}
+
+// Query describes the release a provider is asked about
+type Query struct {
+	Release   string `json:"release"`
+	Namespace string `json:"namespace"`
+	Chart     string `json:"chart"`
+	Version   string `json:"version,omitempty"`
+}
+
+// AddProvider adds a provider asked after the substitutions added by hand
+// and the providers added before it
+func (m *Manager) AddProvider(provider Provider) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.providers = append(m.providers, provider)
+}
+
+// Providers returns the names of the providers, in the order they're asked
+func (m *Manager) Providers() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	names := make([]string, len(m.providers))
+	for i, provider := range m.providers {
+		names[i] = provider.Name()
+	}
+	return names
+}
+
+// providerList returns the providers to ask, so that they're asked without
+// holding the lock
+func (m *Manager) providerList() []Provider {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]Provider(nil), m.providers...)
+}
+
+// ResolveChart returns the chart to sync the release of query with: the
+// chart substituted for it by hand, or else the first a provider gives.
+// ok is false when neither substitutes it.
+func (m *Manager) ResolveChart(ctx context.Context, query Query) (chart string, ok bool, err error) {
+	if path, ok := m.GetChartPathFor(query.Chart, query.Release, query.Namespace); ok {
+		return path, true, nil
+	}
+	for _, provider := range m.providerList() {
+		chart, ok, err := provider.Chart(ctx, query)
+		if err != nil {
+			return "", false, fmt.Errorf("substitution provider %s: %w", provider.Name(), err)
+		}
+		if ok && chart != "" {
+			return chart, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// ResolveImages returns the image substitutions that apply to the release
+// of query: ImageSubstitutionsFor, plus those of the providers for images
+// not substituted by hand, sorted by original image
+func (m *Manager) ResolveImages(ctx context.Context, query Query) ([]ImageSubstitution, error) {
+	result := m.ImageSubstitutionsFor(query.Release, query.Namespace)
+	seen := make(map[string]bool, len(result))
+	for _, sub := range result {
+		seen[sub.Original] = true
+	}
+
+	for _, provider := range m.providerList() {
+		images, err := provider.Images(ctx, query)
+		if err != nil {
+			return nil, fmt.Errorf("substitution provider %s: %w", provider.Name(), err)
+		}
+		for original, replacement := range images {
+			if seen[original] || replacement == "" {
+				continue
+			}
+			seen[original] = true
+			result = append(result, ImageSubstitution{
+				Original:    original,
+				Replacement: replacement,
+				Scope:       Scope{Release: query.Release, Namespace: query.Namespace},
+				Provider:    provider.Name(),
+			})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Original < result[j].Original })
+	return result, nil
+}
+
+// ExecProvider is a Provider run as an external command. Each query runs
+// the command with a JSON request on stdin:
+//
+//	{"kind": "chart", "release": "web", "namespace": "apps", "chart": "stable/web", "version": "1.2.0"}
+//
+// and "kind": "images" for images. The command answers on stdout with
+// {"chart": "./charts/web"} or {"images": {"nginx:1.25": "registry.internal/nginx:pr-42"}};
+// empty output, or an empty chart, declines. A non-zero exit is an error.
+type ExecProvider struct {
+	name    string
+	command string
+	args    []string
+	timeout time.Duration
+}
+
+// execRequest is what an exec provider reads on stdin
+type execRequest struct {
+	Kind string `json:"kind"`
+	Query
+}
+
+// execResponse is what an exec provider writes on stdout
+type execResponse struct {
+	Chart  string            `json:"chart,omitempty"`
+	Images map[string]string `json:"images,omitempty"`
+}
+
+// NewExecProvider creates a provider running command with args
+func NewExecProvider(name, command string, args []string) *ExecProvider {
+	return &ExecProvider{
+		name:    name,
+		command: command,
+		args:    args,
+		timeout: DefaultProviderTimeout,
+	}
+}
+
+// SetTimeout bounds each query
+func (p *ExecProvider) SetTimeout(timeout time.Duration) {
+	p.timeout = timeout
+}
+
+// Name returns the provider's name
+func (p *ExecProvider) Name() string {
+	return p.name
+}
+
+// Chart asks the command for the chart of a release
+func (p *ExecProvider) Chart(ctx context.Context, query Query) (string, bool, error) {
+	resp, err := p.run(ctx, execRequest{Kind: "chart", Query: query})
+	if err != nil {
+		return "", false, err
+	}
+	return resp.Chart, resp.Chart != "", nil
+}
+
+// Images asks the command for the images of a release
+func (p *ExecProvider) Images(ctx context.Context, query Query) (map[string]string, error) {
+	resp, err := p.run(ctx, execRequest{Kind: "images", Query: query})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Images, nil
+}
+
+// run runs the command with req on stdin and parses its answer
+func (p *ExecProvider) run(ctx context.Context, req execRequest) (execResponse, error) {
+	var resp execResponse
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return resp, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, p.command, p.args...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(os.Environ(),
+		"HELMFIRE_PROVIDER_KIND="+req.Kind,
+		"HELMFIRE_RELEASE="+req.Release,
+		"HELMFIRE_NAMESPACE="+req.Namespace)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return resp, fmt.Errorf("command %s failed: %w (stderr: %s)", p.command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	if len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		return resp, nil
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return resp, fmt.Errorf("command %s answered with invalid JSON: %w", p.command, err)
+	}
+	return resp, nil
+}
+
+// ProviderConfig declares an exec provider in configuration
+//
+//	substitutionProviders:
+//	  - name: build-service
+//	    command: /usr/local/bin/build-service-images
+//	    args: ["--branch", "main"]
+//	    timeout: 10s
+type ProviderConfig struct {
+	Name    string   `yaml:"name" json:"name"`
+	Command string   `yaml:"command" json:"command"`
+	Args    []string `yaml:"args,omitempty" json:"args,omitempty"`
+	Timeout string   `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+// NewProviders creates the configured providers, failing on the first
+// invalid entry
+func NewProviders(cfgs []ProviderConfig) ([]Provider, error) {
+	providers := make([]Provider, 0, len(cfgs))
+	names := make(map[string]bool, len(cfgs))
+	for i, cfg := range cfgs {
+		if cfg.Name == "" || cfg.Command == "" {
+			return nil, fmt.Errorf("substitutionProviders[%d]: name and command are required", i)
+		}
+		if names[cfg.Name] {
+			return nil, fmt.Errorf("substitutionProviders[%d]: provider %s is declared twice", i, cfg.Name)
+		}
+		names[cfg.Name] = true
+
+		provider := NewExecProvider(cfg.Name, cfg.Command, cfg.Args)
+		if cfg.Timeout != "" {
+			timeout, err := time.ParseDuration(cfg.Timeout)
+			if err != nil || timeout <= 0 {
+				return nil, fmt.Errorf("substitutionProviders[%d]: invalid timeout %q", i, cfg.Timeout)
+			}
+			provider.SetTimeout(timeout)
+		}
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
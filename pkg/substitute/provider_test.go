@@ -0,0 +1,197 @@
+package substitute
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeProvider answers from fixed tables
+type fakeProvider struct {
+	name   string
+	charts map[string]string // release -> chart
+	images map[string]string
+	err    error
+}
+
+func (p *fakeProvider) Name() string { return p.name }
+
+func (p *fakeProvider) Chart(ctx context.Context, query Query) (string, bool, error) {
+	chart, ok := p.charts[query.Release]
+	return chart, ok, p.err
+}
+
+func (p *fakeProvider) Images(ctx context.Context, query Query) (map[string]string, error) {
+	return p.images, p.err
+}
+
+func TestResolveChart(t *testing.T) {
+	m := NewManager()
+	m.AddProvider(&fakeProvider{name: "first", charts: map[string]string{"web": "./charts/web"}})
+	m.AddProvider(&fakeProvider{name: "second", charts: map[string]string{"web": "./other", "api": "./charts/api"}})
+	ctx := context.Background()
+
+	if chart, ok, err := m.ResolveChart(ctx, Query{Release: "web", Chart: "stable/web"}); err != nil || !ok || chart != "./charts/web" {
+		t.Errorf("expected the first provider's chart, got %q %v %v", chart, ok, err)
+	}
+	if chart, ok, err := m.ResolveChart(ctx, Query{Release: "api", Chart: "stable/api"}); err != nil || !ok || chart != "./charts/api" {
+		t.Errorf("expected the second provider's chart, got %q %v %v", chart, ok, err)
+	}
+	if _, ok, err := m.ResolveChart(ctx, Query{Release: "db", Chart: "stable/db"}); err != nil || ok {
+		t.Errorf("expected no substitution for db, got %v %v", ok, err)
+	}
+
+	// Substitutions added by hand win
+	local := t.TempDir()
+	if err := os.WriteFile(filepath.Join(local, "Chart.yaml"), []byte("apiVersion: v2\nname: web\nversion: 1.0.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddChartSubstitution("stable/web", local); err != nil {
+		t.Fatal(err)
+	}
+	if chart, _, _ := m.ResolveChart(ctx, Query{Release: "web", Chart: "stable/web"}); chart != local {
+		t.Errorf("expected the chart added by hand, got %q", chart)
+	}
+
+	if got := strings.Join(m.Providers(), ","); got != "first,second" {
+		t.Errorf("expected providers first,second, got %s", got)
+	}
+}
+
+func TestResolveImages(t *testing.T) {
+	m := NewManager()
+	if err := m.AddImageSubstitution("nginx:1.25", "local/nginx:dev"); err != nil {
+		t.Fatal(err)
+	}
+	m.AddProvider(&fakeProvider{name: "builds", images: map[string]string{
+		"nginx:1.25": "registry.internal/nginx:pr-1",
+		"api:1.0":    "registry.internal/api:pr-1",
+	}})
+
+	subs, err := m.ResolveImages(context.Background(), Query{Release: "web", Namespace: "apps"})
+	if err != nil {
+		t.Fatalf("ResolveImages() failed: %v", err)
+	}
+	if len(subs) != 2 {
+		t.Fatalf("expected 2 substitutions, got %+v", subs)
+	}
+	if subs[0].Original != "api:1.0" || subs[0].Provider != "builds" || subs[0].Scope.Release != "web" {
+		t.Errorf("expected api:1.0 from builds scoped to web, got %+v", subs[0])
+	}
+	if subs[1].Replacement != "local/nginx:dev" || subs[1].Provider != "" {
+		t.Errorf("expected the image added by hand to win, got %+v", subs[1])
+	}
+
+	m.AddProvider(&fakeProvider{name: "broken", err: errors.New("unreachable")})
+	if _, err := m.ResolveImages(context.Background(), Query{Release: "web"}); err == nil || !strings.Contains(err.Error(), "substitution provider broken") {
+		t.Errorf("expected the provider error, got %v", err)
+	}
+}
+
+func TestExecProvider(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake provider script requires a POSIX shell")
+	}
+
+	// The script answers charts for web only, logging each request
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	script := filepath.Join(dir, "provider")
+	content := `#!/bin/sh
+cat >> ` + log + `
+echo >> ` + log + `
+case "$HELMFIRE_PROVIDER_KIND/$HELMFIRE_RELEASE" in
+chart/web) echo '{"chart": "./charts/web"}' ;;
+images/*) echo '{"images": {"nginx:1.25": "registry.internal/nginx:'$HELMFIRE_RELEASE'"}}' ;;
+esac
+`
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewExecProvider("builds", script, nil)
+	ctx := context.Background()
+	query := Query{Release: "web", Namespace: "apps", Chart: "stable/web", Version: "1.2.0"}
+
+	chart, ok, err := p.Chart(ctx, query)
+	if err != nil || !ok || chart != "./charts/web" {
+		t.Errorf("expected ./charts/web, got %q %v %v", chart, ok, err)
+	}
+	if _, ok, err := p.Chart(ctx, Query{Release: "api"}); err != nil || ok {
+		t.Errorf("expected api declined, got %v %v", ok, err)
+	}
+	images, err := p.Images(ctx, query)
+	if err != nil || images["nginx:1.25"] != "registry.internal/nginx:web" {
+		t.Errorf("expected the web image, got %v %v", images, err)
+	}
+
+	data, _ := os.ReadFile(log)
+	if !strings.Contains(string(data), `"kind":"chart","release":"web","namespace":"apps","chart":"stable/web","version":"1.2.0"`) {
+		t.Errorf("expected the query on stdin, got:\n%s", data)
+	}
+}
+
+func TestExecProviderFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake provider script requires a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	failing := filepath.Join(dir, "failing")
+	if err := os.WriteFile(failing, []byte("#!/bin/sh\necho 'build service down' >&2\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid")
+	if err := os.WriteFile(invalid, []byte("#!/bin/sh\necho 'not json'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	slow := filepath.Join(dir, "slow")
+	if err := os.WriteFile(slow, []byte("#!/bin/sh\nexec sleep 5\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, _, err := NewExecProvider("failing", failing, nil).Chart(ctx, Query{}); err == nil || !strings.Contains(err.Error(), "build service down") {
+		t.Errorf("expected the stderr of the failing command, got %v", err)
+	}
+	if _, err := NewExecProvider("invalid", invalid, nil).Images(ctx, Query{}); err == nil || !strings.Contains(err.Error(), "invalid JSON") {
+		t.Errorf("expected an invalid JSON error, got %v", err)
+	}
+
+	p := NewExecProvider("slow", slow, nil)
+	p.SetTimeout(100 * time.Millisecond)
+	start := time.Now()
+	if _, _, err := p.Chart(ctx, Query{}); err == nil {
+		t.Error("expected the slow command to time out")
+	}
+	if took := time.Since(start); took > 3*time.Second {
+		t.Errorf("expected the timeout to kill the command, took %v", took)
+	}
+}
+
+func TestNewProviders(t *testing.T) {
+	providers, err := NewProviders([]ProviderConfig{
+		{Name: "builds", Command: "build-images", Args: []string{"--branch", "main"}, Timeout: "10s"},
+	})
+	if err != nil || len(providers) != 1 || providers[0].Name() != "builds" {
+		t.Fatalf("expected the builds provider, got %v %v", providers, err)
+	}
+	if p := providers[0].(*ExecProvider); p.timeout != 10*time.Second {
+		t.Errorf("expected a 10s timeout, got %v", p.timeout)
+	}
+
+	for _, cfgs := range [][]ProviderConfig{
+		{{Name: "builds"}},
+		{{Name: "builds", Command: "a"}, {Name: "builds", Command: "b"}},
+		{{Name: "builds", Command: "a", Timeout: "soon"}},
+	} {
+		if _, err := NewProviders(cfgs); err == nil {
+			t.Errorf("expected %+v rejected", cfgs)
+		}
+	}
+}
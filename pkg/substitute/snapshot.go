@@ -0,0 +1,179 @@
+package substitute
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Snapshot is a portable copy of a substitution set, used to share a local
+// dev setup. Chart paths are git:: URLs for git charts and local paths
+// otherwise.
+type Snapshot struct {
+	Charts []SnapshotChart `yaml:"charts,omitempty" json:"charts"`
+	Images []SnapshotImage `yaml:"images,omitempty" json:"images"`
+}
+
+// SnapshotChart is a chart substitution in a snapshot
+type SnapshotChart struct {
+	Original  string     `yaml:"original" json:"original"`
+	Path      string     `yaml:"path" json:"path"`
+	Release   string     `yaml:"release,omitempty" json:"release,omitempty"`
+	Namespace string     `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	ExpiresAt *time.Time `yaml:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+}
+
+// SnapshotImage is an image substitution in a snapshot
+type SnapshotImage struct {
+	Original    string     `yaml:"original" json:"original"`
+	Replacement string     `yaml:"replacement" json:"replacement"`
+	Release     string     `yaml:"release,omitempty" json:"release,omitempty"`
+	Namespace   string     `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	ExpiresAt   *time.Time `yaml:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+}
+
+// Scope returns the scope of the chart substitution
+func (c SnapshotChart) Scope() Scope {
+	return Scope{Release: c.Release, Namespace: c.Namespace}
+}
+
+// Scope returns the scope of the image substitution
+func (i SnapshotImage) Scope() Scope {
+	return Scope{Release: i.Release, Namespace: i.Namespace}
+}
+
+// ParseSnapshot parses a YAML or JSON snapshot
+func ParseSnapshot(data []byte) (Snapshot, error) {
+	var s Snapshot
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return Snapshot{}, fmt.Errorf("failed to parse substitutions: %w", err)
+	}
+
+	for i, c := range s.Charts {
+		if c.Original == "" || c.Path == "" {
+			return Snapshot{}, fmt.Errorf("chart substitution %d: original and path are required", i+1)
+		}
+	}
+	for i, img := range s.Images {
+		if img.Original == "" || img.Replacement == "" {
+			return Snapshot{}, fmt.Errorf("image substitution %d: original and replacement are required", i+1)
+		}
+	}
+	return s, nil
+}
+
+// Export returns a snapshot of all substitutions, sorted by original
+func (m *Manager) Export() Snapshot {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.snapshot()
+}
+
+// snapshot builds a snapshot of all substitutions; m.mu must be held
+func (m *Manager) snapshot() Snapshot {
+	var s Snapshot
+	for k := range m.charts {
+		c := m.chartSubstitution(k)
+		path := c.LocalPath
+		if c.Source != "" {
+			path = c.Source
+		}
+		s.Charts = append(s.Charts, SnapshotChart{
+			Original:  c.Original,
+			Path:      path,
+			Release:   c.Scope.Release,
+			Namespace: c.Scope.Namespace,
+			ExpiresAt: snapshotExpiry(c.ExpiresAt),
+		})
+	}
+	for k := range m.images {
+		img := m.imageSubstitution(k)
+		s.Images = append(s.Images, SnapshotImage{
+			Original:    img.Original,
+			Replacement: img.Replacement,
+			Release:     img.Scope.Release,
+			Namespace:   img.Scope.Namespace,
+			ExpiresAt:   snapshotExpiry(img.ExpiresAt),
+		})
+	}
+
+	s.Sort()
+	return s
+}
+
+// Sort orders the substitutions of a snapshot as Export does: by original,
+// then global before scoped
+func (s *Snapshot) Sort() {
+	sort.Slice(s.Charts, func(i, j int) bool {
+		return snapshotLess(s.Charts[i].Original, s.Charts[i].Scope(), s.Charts[j].Original, s.Charts[j].Scope())
+	})
+	sort.Slice(s.Images, func(i, j int) bool {
+		return snapshotLess(s.Images[i].Original, s.Images[i].Scope(), s.Images[j].Original, s.Images[j].Scope())
+	})
+}
+
+// Import adds the substitutions of a snapshot, replacing substitutions of
+// the same original and scope, and returns what was imported. Substitutions
+// that expired before now are skipped; the rest keep their expiry time.
+func (m *Manager) Import(s Snapshot, now time.Time) (Snapshot, error) {
+	var imported Snapshot
+	for _, c := range s.Charts {
+		if c.ExpiresAt != nil && !now.Before(*c.ExpiresAt) {
+			continue
+		}
+		if err := m.AddScopedChartSubstitution(c.Original, c.Path, c.Scope()); err != nil {
+			return imported, fmt.Errorf("failed to import chart substitution %s: %w", c.Original, err)
+		}
+		if c.ExpiresAt != nil {
+			m.SetChartTTL(c.Original, c.Scope(), c.ExpiresAt.Sub(now))
+		}
+		imported.Charts = append(imported.Charts, c)
+	}
+
+	for _, img := range s.Images {
+		if img.ExpiresAt != nil && !now.Before(*img.ExpiresAt) {
+			continue
+		}
+		if err := m.AddScopedImageSubstitution(img.Original, img.Replacement, img.Scope()); err != nil {
+			return imported, fmt.Errorf("failed to import image substitution %s: %w", img.Original, err)
+		}
+		if img.ExpiresAt != nil {
+			m.SetImageTTL(img.Original, img.Scope(), img.ExpiresAt.Sub(now))
+		}
+		imported.Images = append(imported.Images, img)
+	}
+	return imported, nil
+}
+
+// Clear removes all substitutions and returns a snapshot of what was removed
+func (m *Manager) Clear() Snapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	removed := m.snapshot()
+
+	m.charts = make(map[key]string)
+	m.gitCharts = make(map[key]*gitChart)
+	m.images = make(map[key]string)
+	m.chartExpiry = make(map[key]time.Time)
+	m.imageExpiry = make(map[key]time.Time)
+	return removed
+}
+
+// snapshotExpiry returns nil for substitutions that never expire
+func snapshotExpiry(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// snapshotLess orders substitutions by original, then global before scoped
+func snapshotLess(a string, aScope Scope, b string, bScope Scope) bool {
+	if a != b {
+		return a < b
+	}
+	return aScope.String() < bScope.String()
+}
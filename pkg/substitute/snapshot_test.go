@@ -0,0 +1,142 @@
+package substitute
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestExportImport(t *testing.T) {
+	chartDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte("apiVersion: v2\nname: nginx\nversion: 1.0.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	src := NewManager()
+	src.AddChartSubstitution("bitnami/nginx", chartDir)
+	src.AddImageSubstitution("redis:7", "local/redis:dev")
+	src.AddScopedImageSubstitution("postgres:15", "local/pg:mine", Scope{Release: "my-db"})
+	src.AddImageSubstitution("postgres:15", "local/pg:dev")
+	src.SetImageTTL("redis:7", Scope{}, time.Hour)
+
+	data, err := yaml.Marshal(src.Export())
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := ParseSnapshot(data)
+	if err != nil {
+		t.Fatalf("ParseSnapshot failed: %v", err)
+	}
+
+	if len(snapshot.Charts) != 1 || snapshot.Charts[0].Path != chartDir {
+		t.Fatalf("unexpected charts: %+v", snapshot.Charts)
+	}
+	wantImages := []string{"postgres:15 *", "postgres:15 my-db", "redis:7 *"}
+	if len(snapshot.Images) != len(wantImages) {
+		t.Fatalf("expected %d images, got %+v", len(wantImages), snapshot.Images)
+	}
+	for i, img := range snapshot.Images {
+		if got := img.Original + " " + img.Scope().String(); got != wantImages[i] {
+			t.Errorf("image %d: got %s, want %s", i, got, wantImages[i])
+		}
+	}
+
+	dst := NewManager()
+	dst.AddImageSubstitution("postgres:15", "other/pg:old")
+	imported, err := dst.Import(snapshot, time.Now())
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if len(imported.Charts) != 1 || len(imported.Images) != 3 {
+		t.Errorf("expected 1 chart and 3 images imported, got %+v", imported)
+	}
+
+	if path, ok := dst.GetChartPath("bitnami/nginx"); !ok || path != chartDir {
+		t.Errorf("expected chart substitution to be imported, got %q", path)
+	}
+	if img, _ := dst.GetImageReplacement("postgres:15"); img != "local/pg:dev" {
+		t.Errorf("expected imported image to replace existing one, got %q", img)
+	}
+	for _, img := range dst.ListImageSubstitutions() {
+		if img.Original == "redis:7" && img.ExpiresAt.IsZero() {
+			t.Error("expected imported TTL to be kept")
+		}
+	}
+}
+
+func TestSnapshotSort(t *testing.T) {
+	snapshot := Snapshot{
+		Images: []SnapshotImage{
+			{Original: "redis:7", Replacement: "local/redis:dev"},
+			{Original: "postgres:15", Replacement: "local/pg:mine", Release: "my-db"},
+			{Original: "postgres:15", Replacement: "local/pg:dev"},
+		},
+	}
+	snapshot.Sort()
+
+	wantImages := []string{"postgres:15 *", "postgres:15 my-db", "redis:7 *"}
+	for i, img := range snapshot.Images {
+		if got := img.Original + " " + img.Scope().String(); got != wantImages[i] {
+			t.Errorf("image %d: got %s, want %s", i, got, wantImages[i])
+		}
+	}
+}
+
+func TestImportSkipsExpired(t *testing.T) {
+	expired := time.Now().Add(-time.Minute)
+	m := NewManager()
+
+	imported, err := m.Import(Snapshot{Images: []SnapshotImage{
+		{Original: "redis:7", Replacement: "local/redis:dev", ExpiresAt: &expired},
+		{Original: "nginx:1.21", Replacement: "local/nginx:dev"},
+	}}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(imported.Images) != 1 || imported.Images[0].Original != "nginx:1.21" {
+		t.Errorf("expected only the unexpired image to be imported, got %+v", imported.Images)
+	}
+	if _, ok := m.GetImageReplacement("redis:7"); ok {
+		t.Error("expected expired substitution to be skipped")
+	}
+}
+
+func TestImportInvalidChart(t *testing.T) {
+	m := NewManager()
+	_, err := m.Import(Snapshot{Charts: []SnapshotChart{{Original: "bitnami/nginx", Path: filepath.Join(t.TempDir(), "missing")}}}, time.Now())
+	if err == nil {
+		t.Fatal("expected error importing a missing chart")
+	}
+}
+
+func TestParseSnapshotRequiresFields(t *testing.T) {
+	tests := []string{
+		"charts:\n  - original: bitnami/nginx\n",
+		"images:\n  - replacement: local/nginx:dev\n",
+		"charts: [",
+	}
+
+	for _, data := range tests {
+		if _, err := ParseSnapshot([]byte(data)); err == nil {
+			t.Errorf("expected error parsing %q", data)
+		}
+	}
+}
+
+func TestClear(t *testing.T) {
+	m := NewManager()
+	m.AddImageSubstitution("nginx:1.21", "local/nginx:dev")
+	m.AddScopedImageSubstitution("redis:7", "local/redis:dev", Scope{Namespace: "cache"})
+
+	removed := m.Clear()
+	if len(removed.Images) != 2 {
+		t.Errorf("expected 2 removed images, got %+v", removed.Images)
+	}
+	if len(m.ListImageSubstitutions()) != 0 {
+		t.Error("expected no substitutions after Clear")
+	}
+}
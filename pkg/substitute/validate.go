@@ -0,0 +1,83 @@
+package substitute
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+
+	"github.com/oleksiyp/helmfire/pkg/gitsource"
+)
+
+// Image reference grammar, following the docker distribution reference
+// format: [registry[:port]/]path[:tag][@digest]
+var (
+	imageDomainComponent = `(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])`
+	imageDomain          = imageDomainComponent + `(?:\.` + imageDomainComponent + `)*(?::[0-9]+)?`
+	imagePathComponent   = `[a-z0-9]+(?:(?:[._]|__|[-]+)[a-z0-9]+)*`
+	imageName            = `(?:` + imageDomain + `/)?` + imagePathComponent + `(?:/` + imagePathComponent + `)*`
+	imageTag             = `[\w][\w.-]{0,127}`
+	imageDigest          = `[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9a-fA-F]{32,}`
+
+	imageReferenceRegexp = regexp.MustCompile(`^` + imageName + `(?::` + imageTag + `)?(?:@` + imageDigest + `)?$`)
+)
+
+// maxImageNameLength is the longest repository name registries accept
+const maxImageNameLength = 255
+
+// Kubernetes name rules for scopes: namespaces are DNS-1123 labels, release
+// names are DNS-1123 subdomains limited to 53 characters by helm
+var (
+	dns1123LabelRegexp     = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+	dns1123SubdomainRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+)
+
+const (
+	maxNamespaceLength   = 63
+	maxReleaseNameLength = 53
+)
+
+// ValidateImageReference checks that ref is a valid image reference such as
+// nginx:1.21, localhost:5000/team/app:dev or app@sha256:<digest>
+func ValidateImageReference(ref string) error {
+	if ref == "" {
+		return fmt.Errorf("image reference cannot be empty")
+	}
+	if !imageReferenceRegexp.MatchString(ref) {
+		return fmt.Errorf("invalid image reference %q", ref)
+	}
+	if len(ref) > maxImageNameLength {
+		return fmt.Errorf("image reference %q is longer than %d characters", ref, maxImageNameLength)
+	}
+	return nil
+}
+
+// ValidateReleaseName checks that name is a valid helm release name
+func ValidateReleaseName(name string) error {
+	if len(name) > maxReleaseNameLength || !dns1123SubdomainRegexp.MatchString(name) {
+		return fmt.Errorf("invalid release name %q: must be lowercase alphanumeric, '-' or '.', at most %d characters", name, maxReleaseNameLength)
+	}
+	return nil
+}
+
+// ValidateNamespace checks that namespace is a valid Kubernetes namespace
+func ValidateNamespace(namespace string) error {
+	if len(namespace) > maxNamespaceLength || !dns1123LabelRegexp.MatchString(namespace) {
+		return fmt.Errorf("invalid namespace %q: must be lowercase alphanumeric or '-', at most %d characters", namespace, maxNamespaceLength)
+	}
+	return nil
+}
+
+// IsLocalChartPath reports whether a chart substitution target is a path on
+// the local filesystem rather than a chart URL or git:: URL
+func IsLocalChartPath(target string) bool {
+	return !gitsource.IsGitURL(target) && !isChartURL(target)
+}
+
+// AbsChartPath makes a local chart substitution target absolute, so it can be
+// handed to a daemon running in another directory. URLs are returned as is.
+func AbsChartPath(target string) (string, error) {
+	if !IsLocalChartPath(target) || filepath.IsAbs(target) {
+		return target, nil
+	}
+	return filepath.Abs(target)
+}
@@ -0,0 +1,76 @@
+package substitute
+
+import "testing"
+
+func TestValidateImageReference(t *testing.T) {
+	tests := []struct {
+		ref   string
+		valid bool
+	}{
+		{"nginx", true},
+		{"nginx:1.21", true},
+		{"library/nginx:1.21-alpine", true},
+		{"localhost:5000/postgres:dev", true},
+		{"registry.example.com/team/app_name:v1.2.3", true},
+		{"app@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", true},
+		{"app:dev@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", true},
+		{"", false},
+		{"Nginx:1.21", false},
+		{"nginx:", false},
+		{"nginx::1.21", false},
+		{"nginx 1.21", false},
+		{"-nginx", false},
+		{"nginx@sha256:short", false},
+		{"https://registry/app", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			err := ValidateImageReference(tt.ref)
+			if tt.valid && err != nil {
+				t.Errorf("expected %q to be valid, got %v", tt.ref, err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("expected %q to be invalid", tt.ref)
+			}
+		})
+	}
+}
+
+func TestValidateScopeNames(t *testing.T) {
+	for _, name := range []string{"web", "my-db", "api.v2"} {
+		if err := ValidateReleaseName(name); err != nil {
+			t.Errorf("expected release %q to be valid, got %v", name, err)
+		}
+	}
+	for _, name := range []string{"Web", "my_db", "-web", "a123456789012345678901234567890123456789012345678901234"} {
+		if err := ValidateReleaseName(name); err == nil {
+			t.Errorf("expected release %q to be invalid", name)
+		}
+	}
+
+	if err := ValidateNamespace("kube-system"); err != nil {
+		t.Errorf("expected namespace to be valid, got %v", err)
+	}
+	for _, ns := range []string{"Kube", "kube.system", "kube-"} {
+		if err := ValidateNamespace(ns); err == nil {
+			t.Errorf("expected namespace %q to be invalid", ns)
+		}
+	}
+}
+
+func TestAbsChartPath(t *testing.T) {
+	for _, target := range []string{"/charts/nginx", "https://ci.example.com/nginx.tgz", "git::https://github.com/org/charts//nginx"} {
+		if got, err := AbsChartPath(target); err != nil || got != target {
+			t.Errorf("expected %q to be kept, got %q (%v)", target, got, err)
+		}
+	}
+
+	got, err := AbsChartPath("charts/nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == "charts/nginx" || got[0] != '/' {
+		t.Errorf("expected an absolute path, got %q", got)
+	}
+}
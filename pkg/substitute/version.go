@@ -0,0 +1,194 @@
+package substitute
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// version is a parsed semantic version
+type version struct {
+	major, minor, patch int
+	pre                 string
+}
+
+// parseVersion parses a semantic version, allowing a leading "v" and
+// missing minor or patch components
+func parseVersion(s string) (version, error) {
+	var v version
+	raw := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if idx := strings.Index(raw, "+"); idx >= 0 {
+		raw = raw[:idx]
+	}
+	if idx := strings.Index(raw, "-"); idx >= 0 {
+		v.pre = raw[idx+1:]
+		raw = raw[:idx]
+	}
+
+	parts := strings.Split(raw, ".")
+	if len(parts) > 3 || raw == "" {
+		return v, fmt.Errorf("invalid version %q", s)
+	}
+	nums := []*int{&v.major, &v.minor, &v.patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("invalid version %q", s)
+		}
+		*nums[i] = n
+	}
+	return v, nil
+}
+
+// compare returns -1, 0 or 1 as v is lower than, equal to or higher than o.
+// Pre-release versions sort before the release.
+func (v version) compare(o version) int {
+	for _, d := range []int{v.major - o.major, v.minor - o.minor, v.patch - o.patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+	switch {
+	case v.pre == o.pre:
+		return 0
+	case v.pre == "":
+		return 1
+	case o.pre == "":
+		return -1
+	case v.pre < o.pre:
+		return -1
+	}
+	return 1
+}
+
+// IsVersion reports whether s is a semantic version rather than a
+// constraint
+func IsVersion(s string) bool {
+	_, err := parseVersion(s)
+	return err == nil
+}
+
+// CompareVersions returns -1, 0 or 1 as the semantic version a is lower
+// than, equal to or higher than b
+func CompareVersions(a, b string) (int, error) {
+	va, err := parseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := parseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	return va.compare(vb), nil
+}
+
+// SatisfiesConstraint reports whether ver satisfies a helm-style version
+// constraint such as ">=1.2.0 <2.0.0", "~1.4", "^2" or "1.x || 3.x"
+func SatisfiesConstraint(ver, constraint string) (bool, error) {
+	v, err := parseVersion(ver)
+	if err != nil {
+		return false, err
+	}
+
+	for _, group := range strings.Split(constraint, "||") {
+		ok := true
+		op := ""
+		for _, term := range strings.FieldsFunc(group, func(r rune) bool { return r == ',' || r == ' ' }) {
+			// Rejoin operators separated from their version, as in ">= 1.2"
+			if strings.Trim(term, "=!<>~^") == "" {
+				op += term
+				continue
+			}
+			term, op = op+term, ""
+
+			match, err := matchTerm(v, term)
+			if err != nil {
+				return false, err
+			}
+			if !match {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// matchTerm checks a single comparison such as ">=1.2", "~1.4" or "1.x"
+func matchTerm(v version, term string) (bool, error) {
+	i := 0
+	for i < len(term) && strings.ContainsRune("=!<>~^", rune(term[i])) {
+		i++
+	}
+	op, raw := term[:i], term[i:]
+	if raw == "" {
+		return false, fmt.Errorf("invalid version constraint %q", term)
+	}
+
+	// Wildcards: 1.x matches any 1 version, * matches everything
+	parts := strings.Split(strings.TrimPrefix(raw, "v"), ".")
+	wildcard := -1
+	for i, part := range parts {
+		if part == "x" || part == "X" || part == "*" {
+			wildcard = i
+			break
+		}
+	}
+	if wildcard >= 0 {
+		parts = parts[:wildcard]
+		if op == "" || op == "=" {
+			op = "~"
+			if len(parts) <= 1 {
+				op = "^"
+			}
+		}
+		if len(parts) == 0 {
+			return op != "!=", nil
+		}
+	}
+
+	c, err := parseVersion(strings.Join(parts, "."))
+	if err != nil {
+		return false, fmt.Errorf("invalid version constraint %q", term)
+	}
+
+	cmp := v.compare(c)
+	switch op {
+	case "", "=":
+		return cmp == 0, nil
+	case "!=":
+		return cmp != 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=", "=>":
+		return cmp >= 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=", "=<":
+		return cmp <= 0, nil
+	case "~", "~>":
+		// ~1.2.3 allows patch changes, ~1 allows minor changes
+		upper := version{major: c.major, minor: c.minor + 1}
+		if len(parts) == 1 {
+			upper = version{major: c.major + 1}
+		}
+		return cmp >= 0 && v.compare(upper) < 0, nil
+	case "^":
+		// ^1.2.3 allows changes that do not modify the left-most non-zero component
+		upper := version{major: c.major + 1}
+		if c.major == 0 && len(parts) > 1 {
+			upper = version{minor: c.minor + 1}
+			if c.minor == 0 && len(parts) > 2 {
+				upper = version{patch: c.patch + 1}
+			}
+		}
+		return cmp >= 0 && v.compare(upper) < 0, nil
+	}
+	return false, fmt.Errorf("unsupported version constraint operator %q", op)
+}
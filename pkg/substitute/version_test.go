@@ -0,0 +1,73 @@
+package substitute
+
+import "testing"
+
+func TestSatisfiesConstraint(t *testing.T) {
+	tests := []struct {
+		version    string
+		constraint string
+		expected   bool
+	}{
+		{"1.2.3", "1.2.3", true},
+		{"1.2.3", "=1.2.4", false},
+		{"1.2.3", ">=1.2.0", true},
+		{"1.2.3", ">= 1.2.0, <1.3.0", true},
+		{"1.3.0", ">=1.2.0 <1.3.0", false},
+		{"1.2.3", "!=1.2.3", false},
+		{"1.2.9", "~1.2.0", true},
+		{"1.3.0", "~1.2.0", false},
+		{"1.9.0", "~1", true},
+		{"1.9.0", "^1.2.0", true},
+		{"2.0.0", "^1.2.0", false},
+		{"0.2.5", "^0.2.1", true},
+		{"0.3.0", "^0.2.1", false},
+		{"1.4.0", "1.x", true},
+		{"2.0.0", "1.x", false},
+		{"1.2.7", "1.2.x", true},
+		{"1.3.0", "1.2.x", false},
+		{"5.0.0", "*", true},
+		{"3.1.0", "1.x || 3.x", true},
+		{"2.1.0", "1.x || 3.x", false},
+		{"v15.0.0", ">=15.0.0", true},
+		{"15.0.0-dev", ">=15.0.0", false},
+		{"15.0.0+build.1", "15.0.0", true},
+	}
+
+	for _, tt := range tests {
+		got, err := SatisfiesConstraint(tt.version, tt.constraint)
+		if err != nil {
+			t.Errorf("SatisfiesConstraint(%q, %q) failed: %v", tt.version, tt.constraint, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("SatisfiesConstraint(%q, %q) = %v, expected %v", tt.version, tt.constraint, got, tt.expected)
+		}
+	}
+
+	for _, tt := range [][2]string{{"latest", ">=1.0.0"}, {"1.0.0", ">=abc"}, {"1.0.0", "%1.0"}} {
+		if _, err := SatisfiesConstraint(tt[0], tt[1]); err == nil {
+			t.Errorf("expected error for %q against %q", tt[0], tt[1])
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"1.10.0", "1.9.9", 1},
+		{"v2", "2.0.1", -1},
+		{"2.0.0-rc.1", "2.0.0", -1},
+	}
+	for _, tt := range tests {
+		got, err := CompareVersions(tt.a, tt.b)
+		if err != nil || got != tt.expected {
+			t.Errorf("CompareVersions(%q, %q) = %d, %v, expected %d", tt.a, tt.b, got, err, tt.expected)
+		}
+	}
+	if _, err := CompareVersions("1.2.3", "~1.2"); err == nil || IsVersion("~1.2") {
+		t.Error("expected a constraint not to be a version")
+	}
+}
@@ -0,0 +1,155 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/tracing"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// Metadata helm requires on a resource before a release may manage it
+const (
+	LabelManagedBy                 = "app.kubernetes.io/managed-by"
+	AnnotationHelmReleaseName      = "meta.helm.sh/release-name"
+	AnnotationHelmReleaseNamespace = "meta.helm.sh/release-namespace"
+)
+
+// renderedResource identifies a resource in rendered manifests
+type renderedResource struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+}
+
+// ref returns the resource as kubectl addresses it, qualified by API group
+// so kinds that exist in several groups are not confused
+func (r renderedResource) ref() string {
+	group, version, ok := strings.Cut(r.APIVersion, "/")
+	if !ok {
+		return r.Kind + "/" + r.Metadata.Name
+	}
+	return r.Kind + "." + version + "." + group + "/" + r.Metadata.Name
+}
+
+// clusterMetadata is the metadata of a resource as found in the cluster
+type clusterMetadata struct {
+	Metadata struct {
+		Labels      map[string]string `json:"labels"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+}
+
+// adoptResources adds helm's ownership metadata to the existing resources
+// a release renders, so helm installs over them instead of failing. It
+// refuses resources that belong to another release.
+func (e *Executor) adoptResources(ctx context.Context, release helmstate.Release, chart, namespace string) (err error) {
+	ctx, span := tracing.Start(ctx, "release.adopt")
+	defer func() { span.End(err) }()
+
+	manifests, err := e.renderManifests(ctx, release, chart, namespace)
+	if err != nil {
+		return err
+	}
+	resources, err := parseRenderedResources(manifests)
+	if err != nil {
+		return err
+	}
+
+	adopted := 0
+	for _, resource := range resources {
+		ok, err := e.adoptResource(ctx, release.Name, namespace, e.ReleaseKubeContext(release), resource)
+		if err != nil {
+			return err
+		}
+		if ok {
+			adopted++
+		}
+	}
+	span.SetAttributes(tracing.Int("resources.adopted", adopted))
+	return nil
+}
+
+// adoptResource adopts a single resource in kubeContext, reporting whether
+// it had to
+func (e *Executor) adoptResource(ctx context.Context, release, namespace, kubeContext string, resource renderedResource) (bool, error) {
+	resourceNamespace := resource.Metadata.Namespace
+	if resourceNamespace == "" {
+		resourceNamespace = namespace
+	}
+	ref := resource.ref()
+
+	stdout, stderr, err := e.runTool(ctx, e.kubectl, nil, nil,
+		kubectlArgs(kubeContext, "get", ref, "--namespace", resourceNamespace, "--ignore-not-found", "--output", "json")...)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up %s: %w\nstderr: %s", ref, err, stderr)
+	}
+	if strings.TrimSpace(stdout) == "" {
+		return false, nil
+	}
+
+	var existing clusterMetadata
+	if err := json.Unmarshal([]byte(stdout), &existing); err != nil {
+		return false, fmt.Errorf("failed to parse %s: %w", ref, err)
+	}
+	owner := existing.Metadata.Annotations[AnnotationHelmReleaseName]
+	ownerNamespace := existing.Metadata.Annotations[AnnotationHelmReleaseNamespace]
+	if owner != "" && (owner != release || ownerNamespace != namespace) {
+		return false, fmt.Errorf("cannot adopt %s: it belongs to release %s in namespace %s", ref, owner, ownerNamespace)
+	}
+	if owner == release && existing.Metadata.Labels[LabelManagedBy] == "Helm" {
+		return false, nil
+	}
+
+	if e.dryRun {
+		e.logger.Info("dry run: not adopting resource", zap.String("release", release), zap.String("resource", ref))
+		return true, nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]string{LabelManagedBy: "Helm"},
+			"annotations": map[string]string{
+				AnnotationHelmReleaseName:      release,
+				AnnotationHelmReleaseNamespace: namespace,
+			},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	if _, stderr, err := e.runTool(ctx, e.kubectl, nil, nil,
+		kubectlArgs(kubeContext, "patch", ref, "--namespace", resourceNamespace, "--type", "merge", "--patch", string(patch))...); err != nil {
+		return false, fmt.Errorf("failed to adopt %s: %w\nstderr: %s", ref, err, stderr)
+	}
+	e.logger.Info("adopted resource", zap.String("release", release), zap.String("resource", ref))
+	return true, nil
+}
+
+// parseRenderedResources returns the resources of rendered manifests
+func parseRenderedResources(manifests string) ([]renderedResource, error) {
+	var resources []renderedResource
+	dec := yaml.NewDecoder(strings.NewReader(manifests))
+	for {
+		var resource renderedResource
+		err := dec.Decode(&resource)
+		if errors.Is(err, io.EOF) {
+			return resources, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse manifests: %w", err)
+		}
+		if resource.Kind != "" && resource.Metadata.Name != "" {
+			resources = append(resources, resource)
+		}
+	}
+}
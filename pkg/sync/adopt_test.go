@@ -0,0 +1,134 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"go.uber.org/zap"
+)
+
+func TestParseRenderedResources(t *testing.T) {
+	manifests := `---
+# Source: web/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: edge
+---
+# empty document from a disabled template
+`
+	resources, err := parseRenderedResources(manifests)
+	if err != nil {
+		t.Fatalf("parseRenderedResources failed: %v", err)
+	}
+	if len(resources) != 2 {
+		t.Fatalf("expected 2 resources, got %+v", resources)
+	}
+	if got := resources[0].ref(); got != "Deployment.v1.apps/web" {
+		t.Errorf("unexpected ref %q", got)
+	}
+	if got := resources[1].ref(); got != "Service/web" {
+		t.Errorf("unexpected ref %q", got)
+	}
+	if resources[1].Metadata.Namespace != "edge" {
+		t.Errorf("expected namespace edge, got %q", resources[1].Metadata.Namespace)
+	}
+}
+
+func TestAdoptResources(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	// Fake helm renders a deployment, a service and a config map; fake
+	// kubectl finds an unowned deployment, no service and a config map
+	// owned by the release named in $OWNER
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	helm := filepath.Join(dir, "helm")
+	helmScript := `#!/bin/sh
+cat <<'YAML'
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: web-config
+YAML
+`
+	kubectl := filepath.Join(dir, "kubectl")
+	kubectlScript := `#!/bin/sh
+echo "$@" >> ` + log + `
+case "$1 $2" in
+"get Deployment.v1.apps/web") echo '{"metadata":{"name":"web","labels":{"app":"web"}}}' ;;
+"get ConfigMap/web-config") echo '{"metadata":{"name":"web-config","labels":{"app.kubernetes.io/managed-by":"Helm"},"annotations":{"meta.helm.sh/release-name":"'$OWNER'","meta.helm.sh/release-namespace":"apps"}}}' ;;
+esac
+`
+	if err := os.WriteFile(helm, []byte(helmScript), 0755); err != nil {
+		t.Fatalf("failed to write fake helm: %v", err)
+	}
+	if err := os.WriteFile(kubectl, []byte(kubectlScript), 0755); err != nil {
+		t.Fatalf("failed to write fake kubectl: %v", err)
+	}
+
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	executor.SetHelmBinary(helm)
+	executor.SetKubectl(kubectl)
+	release := helmstate.Release{Name: "web", Chart: "./chart", Adopt: true}
+	ctx := context.Background()
+
+	// Only the unowned deployment is patched; the config map is already ours
+	t.Setenv("OWNER", "web")
+	if err := executor.adoptResources(ctx, release, "./chart", "apps"); err != nil {
+		t.Fatalf("adoptResources failed: %v", err)
+	}
+	data, _ := os.ReadFile(log)
+	var patches []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if strings.HasPrefix(line, "patch ") {
+			patches = append(patches, line)
+		}
+	}
+	want := `patch Deployment.v1.apps/web --namespace apps --type merge --patch {"metadata":{"annotations":{"meta.helm.sh/release-name":"web","meta.helm.sh/release-namespace":"apps"},"labels":{"app.kubernetes.io/managed-by":"Helm"}}}`
+	if len(patches) != 1 || patches[0] != want {
+		t.Errorf("unexpected patches:\n%s\nwant:\n%s", strings.Join(patches, "\n"), want)
+	}
+	os.Remove(log)
+
+	// A dry run looks but doesn't patch
+	executor.SetDryRun(true)
+	if err := executor.adoptResources(ctx, release, "./chart", "apps"); err != nil {
+		t.Fatalf("adoptResources failed: %v", err)
+	}
+	if data, _ := os.ReadFile(log); strings.Contains(string(data), "patch ") {
+		t.Errorf("expected no patch in dry run, got:\n%s", data)
+	}
+	executor.SetDryRun(false)
+
+	// Resources of another release are never taken over
+	t.Setenv("OWNER", "legacy")
+	err := executor.adoptResources(ctx, release, "./chart", "apps")
+	if err == nil || err.Error() != "cannot adopt ConfigMap/web-config: it belongs to release legacy in namespace apps" {
+		t.Errorf("expected ownership error, got %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/preflight"
+	"github.com/oleksiyp/helmfire/pkg/tracing"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultMinKubeVersion is the oldest Kubernetes API server the capability
+// check accepts unless configured otherwise
+const DefaultMinKubeVersion = "1.23.0"
+
+// crdSources maps the API groups of well-known CRDs to how to get them
+var crdSources = map[string]string{
+	"cert-manager.io":           "install cert-manager CRDs first (https://cert-manager.io/docs/installation/)",
+	"acme.cert-manager.io":      "install cert-manager CRDs first (https://cert-manager.io/docs/installation/)",
+	"monitoring.coreos.com":     "install the prometheus-operator CRDs first (https://github.com/prometheus-operator/prometheus-operator)",
+	"networking.istio.io":       "install Istio CRDs first (https://istio.io/latest/docs/setup/install/)",
+	"security.istio.io":         "install Istio CRDs first (https://istio.io/latest/docs/setup/install/)",
+	"gateway.networking.k8s.io": "install the Gateway API CRDs first (https://gateway-api.sigs.k8s.io/guides/)",
+	"external-secrets.io":       "install External Secrets Operator CRDs first (https://external-secrets.io/)",
+	"snapshot.storage.k8s.io":   "install the volume snapshot CRDs first (https://github.com/kubernetes-csi/external-snapshotter)",
+	"keda.sh":                   "install KEDA CRDs first (https://keda.sh/docs/latest/deploy/)",
+}
+
+// Capabilities describes what the Kubernetes API server offers
+type Capabilities struct {
+	ServerVersion string          // e.g. "v1.29.2"
+	APIVersions   map[string]bool // served group/versions, e.g. "apps/v1" and "v1"
+}
+
+// ClusterCapabilities asks the API server for its version and the API
+// versions it serves
+func (e *Executor) ClusterCapabilities(ctx context.Context) (*Capabilities, error) {
+	stdout, stderr, err := e.runTool(ctx, e.kubectl, nil, nil, kubectlArgs(e.kubeContext, "version", "--output", "json")...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the Kubernetes server version: %w\nstderr: %s", err, stderr)
+	}
+	var version struct {
+		ServerVersion *struct {
+			GitVersion string `json:"gitVersion"`
+		} `json:"serverVersion"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &version); err != nil || version.ServerVersion == nil {
+		return nil, fmt.Errorf("failed to get the Kubernetes server version: no server version reported")
+	}
+
+	stdout, stderr, err = e.runTool(ctx, e.kubectl, nil, nil, kubectlArgs(e.kubeContext, "api-versions")...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list served API versions: %w\nstderr: %s", err, stderr)
+	}
+	caps := &Capabilities{ServerVersion: version.ServerVersion.GitVersion, APIVersions: make(map[string]bool)}
+	for _, line := range strings.Split(stdout, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			caps.APIVersions[line] = true
+		}
+	}
+	return caps, nil
+}
+
+// missingAPI is an API version releases use that the cluster doesn't serve
+type missingAPI struct {
+	apiVersion string
+	users      []string // "release (Kind)"
+}
+
+// CheckCapabilities verifies before a sync that the API server is at least
+// minVersion (DefaultMinKubeVersion when empty) and serves every API version
+// the rendered manifests of releases use, so that missing CRDs are reported
+// up front instead of failing helm midway through the sync. API versions of
+// CRDs rendered by the releases themselves count as served.
+func (e *Executor) CheckCapabilities(ctx context.Context, releases []helmstate.Release, minVersion string) (err error) {
+	ctx, span := tracing.Start(ctx, "sync.capabilities", tracing.Int("releases", len(releases)))
+	defer func() { span.End(err) }()
+
+	caps, err := e.ClusterCapabilities(ctx)
+	if err != nil {
+		return err
+	}
+	span.SetAttributes(tracing.String("kubernetes.version", caps.ServerVersion))
+
+	if minVersion == "" {
+		minVersion = DefaultMinKubeVersion
+	}
+	if preflight.CompareVersions(caps.ServerVersion, minVersion) < 0 {
+		return fmt.Errorf("cluster runs Kubernetes %s, older than the required %s: upgrade the cluster or lower --min-kube-version", caps.ServerVersion, minVersion)
+	}
+
+	provided := make(map[string]bool)
+	used := make(map[string][]string)
+	for _, release := range releases {
+		chart, namespace, err := e.resolveReleaseContext(ctx, release)
+		if err != nil {
+			return err
+		}
+		manifests, err := e.renderManifestsArgs(ctx, release, chart, namespace, "--include-crds")
+		if err != nil {
+			return fmt.Errorf("release %s: %w", release.Name, err)
+		}
+		resources, crds, err := parseAPIUsage(manifests)
+		if err != nil {
+			return fmt.Errorf("release %s: %w", release.Name, err)
+		}
+		for _, apiVersion := range crds {
+			provided[apiVersion] = true
+		}
+		for _, resource := range resources {
+			user := fmt.Sprintf("%s (%s)", release.Name, resource.Kind)
+			if !containsString(used[resource.APIVersion], user) {
+				used[resource.APIVersion] = append(used[resource.APIVersion], user)
+			}
+		}
+	}
+
+	var missing []missingAPI
+	for apiVersion, users := range used {
+		if !caps.APIVersions[apiVersion] && !provided[apiVersion] {
+			missing = append(missing, missingAPI{apiVersion: apiVersion, users: users})
+		}
+	}
+	if len(missing) == 0 {
+		e.logger.Debug("cluster capabilities verified",
+			zap.String("kubernetesVersion", caps.ServerVersion),
+			zap.Int("apiVersions", len(used)))
+		return nil
+	}
+
+	sort.Slice(missing, func(i, j int) bool { return missing[i].apiVersion < missing[j].apiVersion })
+	lines := make([]string, 0, len(missing))
+	for _, m := range missing {
+		line := fmt.Sprintf("%s is not served by the cluster, needed by %s", m.apiVersion, strings.Join(m.users, ", "))
+		if hint := missingAPIHint(m.apiVersion); hint != "" {
+			line += ": " + hint
+		}
+		lines = append(lines, line)
+	}
+	return fmt.Errorf("cluster is missing required APIs:\n  %s", strings.Join(lines, "\n  "))
+}
+
+// missingAPIHint suggests how to get an API version the cluster lacks
+func missingAPIHint(apiVersion string) string {
+	group, _, ok := strings.Cut(apiVersion, "/")
+	if !ok {
+		return ""
+	}
+	if hint, ok := crdSources[group]; ok {
+		return hint
+	}
+	if strings.HasSuffix(group, ".k8s.io") || !strings.Contains(group, ".") {
+		return "the API may be removed or not yet enabled in this Kubernetes version"
+	}
+	return "install the CRDs or operator that provide " + group + " first"
+}
+
+// crdDocument is the part of a CustomResourceDefinition that names the API
+// versions it serves
+type crdDocument struct {
+	Spec struct {
+		Group    string `yaml:"group"`
+		Versions []struct {
+			Name   string `yaml:"name"`
+			Served *bool  `yaml:"served"`
+		} `yaml:"versions"`
+	} `yaml:"spec"`
+}
+
+// parseAPIUsage returns the resources of rendered manifests and the API
+// versions the CustomResourceDefinitions among them serve
+func parseAPIUsage(manifests string) (resources []renderedResource, crds []string, err error) {
+	dec := yaml.NewDecoder(strings.NewReader(manifests))
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return resources, crds, nil
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse manifests: %w", err)
+		}
+
+		var resource renderedResource
+		if err := doc.Decode(&resource); err != nil || resource.APIVersion == "" || resource.Kind == "" {
+			continue
+		}
+		resources = append(resources, resource)
+
+		if resource.Kind != "CustomResourceDefinition" {
+			continue
+		}
+		var crd crdDocument
+		if err := doc.Decode(&crd); err != nil {
+			continue
+		}
+		for _, version := range crd.Spec.Versions {
+			if version.Served == nil || *version.Served {
+				crds = append(crds, crd.Spec.Group+"/"+version.Name)
+			}
+		}
+	}
+}
+
+// containsString reports whether values contains s
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
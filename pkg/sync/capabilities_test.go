@@ -0,0 +1,145 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"go.uber.org/zap"
+)
+
+func TestParseAPIUsage(t *testing.T) {
+	manifests := `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  versions:
+    - name: v1
+    - name: v1alpha1
+      served: false
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: w
+---
+# comment only
+`
+	resources, crds, err := parseAPIUsage(manifests)
+	if err != nil {
+		t.Fatalf("parseAPIUsage failed: %v", err)
+	}
+	if len(resources) != 2 || resources[1].Kind != "Widget" {
+		t.Errorf("unexpected resources %+v", resources)
+	}
+	if len(crds) != 1 || crds[0] != "example.com/v1" {
+		t.Errorf("expected only served CRD versions, got %v", crds)
+	}
+}
+
+func TestMissingAPIHint(t *testing.T) {
+	tests := map[string]string{
+		"cert-manager.io/v1":                   "install cert-manager CRDs first (https://cert-manager.io/docs/installation/)",
+		"policy/v1beta1":                       "the API may be removed or not yet enabled in this Kubernetes version",
+		"flowcontrol.apiserver.k8s.io/v1beta1": "the API may be removed or not yet enabled in this Kubernetes version",
+		"widgets.example.com/v1":               "install the CRDs or operator that provide widgets.example.com first",
+		"v1":                                   "",
+	}
+	for apiVersion, want := range tests {
+		if got := missingAPIHint(apiVersion); got != want {
+			t.Errorf("missingAPIHint(%q) = %q, want %q", apiVersion, got, want)
+		}
+	}
+}
+
+func TestCheckCapabilities(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	// Fake helm renders a certificate for web and a CRD with its custom
+	// resource for operator; fake kubectl reports the version in $KUBE_VERSION
+	dir := t.TempDir()
+	helm := filepath.Join(dir, "helm")
+	helmScript := `#!/bin/sh
+echo "$@" >> ` + filepath.Join(dir, "log") + `
+case "$2" in
+web) cat <<'YAML'
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+apiVersion: cert-manager.io/v1
+kind: Certificate
+metadata:
+  name: web
+YAML
+;;
+operator) cat <<'YAML'
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  versions:
+    - name: v1
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: default
+YAML
+;;
+esac
+`
+	kubectl := filepath.Join(dir, "kubectl")
+	kubectlScript := `#!/bin/sh
+case "$1" in
+version) echo '{"clientVersion":{"gitVersion":"v1.29.0"},"serverVersion":{"gitVersion":"'$KUBE_VERSION'"}}' ;;
+api-versions) printf 'apiextensions.k8s.io/v1\napps/v1\nv1\n' ;;
+esac
+`
+	if err := os.WriteFile(helm, []byte(helmScript), 0755); err != nil {
+		t.Fatalf("failed to write fake helm: %v", err)
+	}
+	if err := os.WriteFile(kubectl, []byte(kubectlScript), 0755); err != nil {
+		t.Fatalf("failed to write fake kubectl: %v", err)
+	}
+
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	executor.SetHelmBinary(helm)
+	executor.SetKubectl(kubectl)
+	ctx := context.Background()
+	t.Setenv("KUBE_VERSION", "v1.28.3-eks-1")
+
+	// The operator's custom resource is served by the CRD it installs
+	operator := helmstate.Release{Name: "operator", Chart: "./operator"}
+	if err := executor.CheckCapabilities(ctx, []helmstate.Release{operator}, ""); err != nil {
+		t.Errorf("expected operator to pass, got %v", err)
+	}
+	log, _ := os.ReadFile(filepath.Join(dir, "log"))
+	if !strings.Contains(string(log), "--include-crds") {
+		t.Errorf("expected CRDs to be rendered, got %s", log)
+	}
+
+	web := helmstate.Release{Name: "web", Chart: "./web"}
+	err := executor.CheckCapabilities(ctx, []helmstate.Release{operator, web}, "")
+	want := "cluster is missing required APIs:\n  cert-manager.io/v1 is not served by the cluster, needed by web (Certificate): install cert-manager CRDs first (https://cert-manager.io/docs/installation/)"
+	if err == nil || err.Error() != want {
+		t.Errorf("unexpected error:\n%v\nwant:\n%s", err, want)
+	}
+
+	err = executor.CheckCapabilities(ctx, []helmstate.Release{operator}, "1.29.0")
+	if err == nil || !strings.Contains(err.Error(), "cluster runs Kubernetes v1.28.3-eks-1, older than the required 1.29.0") {
+		t.Errorf("expected version error, got %v", err)
+	}
+}
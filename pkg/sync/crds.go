@@ -0,0 +1,98 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/tracing"
+	"go.uber.org/zap"
+)
+
+// CRDFieldManager is the field manager CRDs are server-side applied with
+const CRDFieldManager = "helmfire"
+
+// CRDChangeError reports that the CRDs of a release's chart differ from the
+// ones in the cluster while the release's CRD strategy is fail
+type CRDChangeError struct {
+	Release string
+	Diff    string // kubectl diff output
+}
+
+func (e *CRDChangeError) Error() string {
+	return fmt.Sprintf("release %s: chart CRDs differ from the cluster, refusing to sync (crds: fail):\n%s", e.Release, e.Diff)
+}
+
+// prepareCRDs handles the CRDs of the release's chart according to its CRD
+// strategy before it is synced
+func (e *Executor) prepareCRDs(ctx context.Context, release helmstate.Release, chart string) (err error) {
+	switch release.CRDs {
+	case "", helmstate.CRDsSkip:
+		return nil
+	case helmstate.CRDsApply, helmstate.CRDsFail:
+	default:
+		return fmt.Errorf("release %s: unknown crds strategy %q (want %s, %s or %s)",
+			release.Name, release.CRDs, helmstate.CRDsSkip, helmstate.CRDsApply, helmstate.CRDsFail)
+	}
+
+	ctx, span := tracing.Start(ctx, "release.crds", tracing.String("crds.strategy", release.CRDs))
+	defer func() { span.End(err) }()
+
+	crds, err := e.chartCRDs(ctx, release, chart)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(crds) == "" {
+		return nil
+	}
+
+	if release.CRDs == helmstate.CRDsFail {
+		return e.diffCRDs(ctx, release, crds)
+	}
+
+	if e.dryRun {
+		e.logger.Info("dry run: not applying CRDs", zap.String("release", release.Name))
+		return nil
+	}
+	stdout, stderr, err := e.runTool(ctx, e.kubectl, strings.NewReader(crds), nil,
+		kubectlArgs(e.ReleaseKubeContext(release), "apply", "--server-side", "--force-conflicts", "--field-manager", CRDFieldManager, "--filename", "-")...)
+	if err != nil {
+		return fmt.Errorf("failed to apply CRDs of release %s: %w\nstderr: %s", release.Name, err, stderr)
+	}
+	e.logger.Info("applied CRDs",
+		zap.String("release", release.Name),
+		zap.Strings("crds", strings.Fields(stdout)))
+	return nil
+}
+
+// chartCRDs returns the CRDs of the crds/ directory of a chart
+func (e *Executor) chartCRDs(ctx context.Context, release helmstate.Release, chart string) (string, error) {
+	args := []string{"show", "crds", chart}
+	if release.Version != "" {
+		args = append(args, "--version", release.Version)
+	}
+	out, err := e.runHelmOutput(ctx, args...)
+	if err != nil {
+		return "", fmt.Errorf("failed to read CRDs of chart %s: %w", chart, err)
+	}
+	return out, nil
+}
+
+// diffCRDs fails with a *CRDChangeError when applying crds would change the
+// cluster. kubectl diff exits 1 when it found differences.
+func (e *Executor) diffCRDs(ctx context.Context, release helmstate.Release, crds string) error {
+	stdout, stderr, err := e.runTool(ctx, e.kubectl, strings.NewReader(crds), nil,
+		kubectlArgs(e.ReleaseKubeContext(release), "diff", "--server-side", "--field-manager", CRDFieldManager, "--filename", "-")...)
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		return &CRDChangeError{Release: release.Name, Diff: strings.TrimSpace(stdout)}
+	default:
+		return fmt.Errorf("failed to diff CRDs of release %s: %w\nstderr: %s", release.Name, err, stderr)
+	}
+}
@@ -0,0 +1,124 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"go.uber.org/zap"
+)
+
+func TestUpgradeArgsSkipCRDs(t *testing.T) {
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	release := helmstate.Release{Name: "certs", Chart: "jetstack/cert-manager"}
+
+	if containsArg(executor.upgradeArgs(release, release.Chart, "certs"), "--skip-crds") {
+		t.Error("expected helm to handle CRDs by default")
+	}
+	for _, strategy := range []string{helmstate.CRDsSkip, helmstate.CRDsApply, helmstate.CRDsFail} {
+		release.CRDs = strategy
+		if !containsArg(executor.upgradeArgs(release, release.Chart, "certs"), "--skip-crds") {
+			t.Errorf("expected --skip-crds with crds: %s", strategy)
+		}
+	}
+}
+
+func TestPrepareCRDs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	// Fake helm shows one CRD; fake kubectl logs what it applies and exits
+	// diff with $DIFF_EXIT
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	helm := filepath.Join(dir, "helm")
+	helmScript := `#!/bin/sh
+echo "$@" >> ` + log + `
+echo 'kind: CustomResourceDefinition'
+`
+	kubectl := filepath.Join(dir, "kubectl")
+	kubectlScript := `#!/bin/sh
+cat >> ` + log + `
+echo "$@" >> ` + log + `
+case "$1" in
+apply) echo 'customresourcedefinition.apiextensions.k8s.io/widgets.example.com serverside-applied' ;;
+diff) echo '+  version: v2'; exit $DIFF_EXIT ;;
+esac
+`
+	if err := os.WriteFile(helm, []byte(helmScript), 0755); err != nil {
+		t.Fatalf("failed to write fake helm: %v", err)
+	}
+	if err := os.WriteFile(kubectl, []byte(kubectlScript), 0755); err != nil {
+		t.Fatalf("failed to write fake kubectl: %v", err)
+	}
+
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	executor.SetHelmBinary(helm)
+	executor.SetKubectl(kubectl)
+	executor.SetKubeContext("kind")
+	ctx := context.Background()
+	readLog := func() string {
+		data, _ := os.ReadFile(log)
+		os.Remove(log)
+		return strings.TrimSpace(string(data))
+	}
+
+	// Skipped and helm-managed CRDs need nothing up front
+	for _, strategy := range []string{"", helmstate.CRDsSkip} {
+		if err := executor.prepareCRDs(ctx, helmstate.Release{Name: "widgets", CRDs: strategy}, "./chart"); err != nil {
+			t.Errorf("prepareCRDs(%q) failed: %v", strategy, err)
+		}
+	}
+	if got := readLog(); got != "" {
+		t.Errorf("expected no commands, got:\n%s", got)
+	}
+
+	release := helmstate.Release{Name: "widgets", Version: "1.2.0", CRDs: helmstate.CRDsApply}
+	if err := executor.prepareCRDs(ctx, release, "./chart"); err != nil {
+		t.Fatalf("prepareCRDs failed: %v", err)
+	}
+	want := `show crds ./chart --version 1.2.0
+kind: CustomResourceDefinition
+apply --server-side --force-conflicts --field-manager helmfire --filename - --context kind`
+	if got := readLog(); got != want {
+		t.Errorf("unexpected commands:\n%s\nwant:\n%s", got, want)
+	}
+
+	executor.SetDryRun(true)
+	if err := executor.prepareCRDs(ctx, release, "./chart"); err != nil {
+		t.Fatalf("prepareCRDs failed: %v", err)
+	}
+	if got := readLog(); strings.Contains(got, "apply") {
+		t.Errorf("expected no apply in dry run, got:\n%s", got)
+	}
+	executor.SetDryRun(false)
+
+	// fail passes while the cluster matches and reports the diff otherwise
+	release.CRDs = helmstate.CRDsFail
+	t.Setenv("DIFF_EXIT", "0")
+	if err := executor.prepareCRDs(ctx, release, "./chart"); err != nil {
+		t.Errorf("expected unchanged CRDs to pass, got %v", err)
+	}
+	t.Setenv("DIFF_EXIT", "1")
+	err := executor.prepareCRDs(ctx, release, "./chart")
+	var changed *CRDChangeError
+	if !errors.As(err, &changed) || changed.Diff != "+  version: v2" {
+		t.Errorf("expected CRD change error, got %v", err)
+	}
+	t.Setenv("DIFF_EXIT", "2")
+	if err := executor.prepareCRDs(ctx, release, "./chart"); err == nil || errors.As(err, &changed) {
+		t.Errorf("expected kubectl failure, got %v", err)
+	}
+
+	err = executor.prepareCRDs(ctx, helmstate.Release{Name: "widgets", CRDs: "upgrade"}, "./chart")
+	if err == nil || err.Error() != `release widgets: unknown crds strategy "upgrade" (want skip, apply or fail)` {
+		t.Errorf("expected unknown strategy error, got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package sync
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+)
+
+// syncIDRegexp matches the AnnotationSyncID of a manifest, capturing its value
+var syncIDRegexp = regexp.MustCompile(`(?m)^[ \t]*` + regexp.QuoteMeta(AnnotationSyncID) + `:[ \t]*["']?([^"'\s]+)["']?[ \t]*\n?`)
+
+// DriftInspector compares releases with the cluster as the executor syncs
+// them: from the substituted chart, with their set values and through the
+// post-renderer, so a release just synced shows no drift. Its other methods
+// are the manager's.
+type DriftInspector struct {
+	*helmstate.Manager
+	executor *Executor
+}
+
+// NewDriftInspector returns an inspector of the manager's releases as
+// executor syncs them
+func NewDriftInspector(manager *helmstate.Manager, executor *Executor) *DriftInspector {
+	return &DriftInspector{Manager: manager, executor: executor}
+}
+
+// ManifestsMatch reports whether the manifest helm stored for a deployed
+// release hashes the same as the release rendered as a sync would. The
+// AnnotationSyncID of stamped resources differs between syncs, so it isn't
+// hashed.
+func (i *DriftInspector) ManifestsMatch(release helmstate.Release) (bool, error) {
+	stored, err := i.StoredManifest(release)
+	if err != nil {
+		return false, err
+	}
+	rendered, err := i.RenderManifest(release)
+	if err != nil {
+		return false, err
+	}
+	return helmstate.ManifestHash(withoutSyncIDAnnotation(stored)) == helmstate.ManifestHash(withoutSyncIDAnnotation(rendered)), nil
+}
+
+// RenderManifest renders a release with helm template as a sync would,
+// without hooks and tests, which helm stores apart from the manifest
+func (i *DriftInspector) RenderManifest(release helmstate.Release) (string, error) {
+	ctx := context.Background()
+	chart, namespace, err := i.chart(ctx, release)
+	if err != nil {
+		return "", err
+	}
+	extra := []string{"--is-upgrade", "--no-hooks", "--skip-tests"}
+	if kubeContext := i.executor.ReleaseKubeContext(release); kubeContext != "" {
+		extra = append(extra, "--kube-context", kubeContext)
+	}
+	return i.executor.renderManifestsArgs(ctx, release, chart, namespace, extra...)
+}
+
+// DiffRelease returns the changes a sync of the release would apply to the
+// cluster, as helm diff upgrade prints them; empty when there are none.
+// Stamped releases are rendered with the sync ID they were deployed with,
+// so it doesn't show as a change.
+func (i *DriftInspector) DiffRelease(release helmstate.Release) (string, error) {
+	ctx := context.Background()
+	if i.executor.stamp.Managed {
+		if stored, err := i.StoredManifest(release); err == nil {
+			if m := syncIDRegexp.FindStringSubmatch(stored); m != nil {
+				ctx = WithSyncID(ctx, m[1])
+			}
+		}
+	}
+	chart, namespace, err := i.chart(ctx, release)
+	if err != nil {
+		return "", err
+	}
+
+	release, cleanupSecrets, err := i.executor.withSecrets(ctx, release)
+	if err != nil {
+		return "", err
+	}
+	defer cleanupSecrets()
+
+	args := i.executor.diffArgs(release, chart, namespace)
+	if i.DiffContext > 0 {
+		args = append(args, "--context", strconv.Itoa(i.DiffContext))
+	}
+
+	args, env, cleanup, err := i.executor.withPostRenderer(ctx, args, release, namespace)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	return i.executor.runHelmOutputEnv(ctx, env, args...)
+}
+
+// chart returns the chart and namespace a sync of release would use, with
+// a remote chart that isn't substituted pulled once per sweep
+func (i *DriftInspector) chart(ctx context.Context, release helmstate.Release) (string, string, error) {
+	chart, namespace, err := i.executor.resolveRelease(ctx, release)
+	if err != nil || chart != release.Chart {
+		return chart, namespace, err
+	}
+	chart, err = i.SweepChart(release)
+	return chart, namespace, err
+}
+
+// withoutSyncIDAnnotation returns manifest without its AnnotationSyncID lines
+func withoutSyncIDAnnotation(manifest string) string {
+	if !strings.Contains(manifest, AnnotationSyncID) {
+		return manifest
+	}
+	return syncIDRegexp.ReplaceAllString(manifest, "")
+}
@@ -0,0 +1,197 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/rendercache"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"go.uber.org/zap"
+)
+
+// writeRenderingHelm writes a fake helm that renders a release's values
+// files, set values, and the config and sync ID passed to the post-renderer
+// into its manifest, keeping the manifest of the last upgrade for helm get manifest,
+// and returns its path. Its diff reports a sync ID other than the deployed
+// one.
+func writeRenderingHelm(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	stored := filepath.Join(dir, "manifest")
+	helm := filepath.Join(dir, "helm")
+	script := `#!/bin/sh
+command=$1
+manifest="kind: ConfigMap"
+if [ -n "$HELMFIRE_SYNC_ID" ]; then
+  manifest="$manifest
+metadata:
+  annotations:
+    helmfire.dev/sync-id: $HELMFIRE_SYNC_ID"
+fi
+if [ -n "$HELMFIRE_POST_RENDER_CONFIG" ]; then
+  manifest="$manifest
+# post-render $HELMFIRE_POST_RENDER_CONFIG"
+fi
+while [ $# -gt 0 ]; do
+  case "$1" in
+    -f|--values) manifest="$manifest
+# values $2"; shift ;;
+    --set|--set-file) manifest="$manifest
+# $1 $2"; shift ;;
+  esac
+  shift
+done
+case "$command" in
+  upgrade) echo "$manifest" > ` + stored + `; echo '{"name":"web","namespace":"frontend","version":1,"info":{"status":"deployed"}}' ;;
+  template) echo "$manifest" ;;
+  get) cat ` + stored + ` ;;
+  diff) [ -z "$HELMFIRE_SYNC_ID" ] || grep -q "sync-id: $HELMFIRE_SYNC_ID" ` + stored + ` || echo "sync-id changed" ;;
+esac
+`
+	if err := os.WriteFile(helm, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake helm: %v", err)
+	}
+	return helm
+}
+
+func TestDriftInspectorRendersSetValues(t *testing.T) {
+	helm := writeRenderingHelm(t)
+
+	dir := t.TempDir()
+	values := filepath.Join(dir, "values.yaml")
+	if err := os.WriteFile(values, []byte("replicas: 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(config, []byte("{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	executor.SetHelmBinary(helm)
+	executor.SetCreateNamespace(false)
+	manager := helmstate.NewManager("", "")
+	manager.HelmBinary = helm
+
+	release := helmstate.Release{
+		Name:      "web",
+		Chart:     "./charts/web",
+		Namespace: "frontend",
+		Values:    []interface{}{values},
+		Set: []helmstate.SetValue{
+			{Name: "image.tag", Value: "1.2.3"},
+			{Name: "config", File: config},
+		},
+	}
+	if _, err := executor.UpgradeReleaseContext(context.Background(), release); err != nil {
+		t.Fatalf("UpgradeReleaseContext failed: %v", err)
+	}
+
+	inspector := NewDriftInspector(manager, executor)
+	rendered, err := inspector.RenderManifest(release)
+	if err != nil {
+		t.Fatalf("RenderManifest failed: %v", err)
+	}
+	if !strings.Contains(rendered, "--set image.tag=1.2.3") || !strings.Contains(rendered, "--set-file config="+config) {
+		t.Errorf("expected set values rendered, got %q", rendered)
+	}
+	match, err := inspector.ManifestsMatch(release)
+	if err != nil {
+		t.Fatalf("ManifestsMatch failed: %v", err)
+	}
+	if !match {
+		t.Error("expected the synced manifest to match the render")
+	}
+
+	release.Set[0].Value = "1.2.4"
+	if match, err := inspector.ManifestsMatch(release); err != nil || match {
+		t.Errorf("expected a changed set value not to match, got %v, %v", match, err)
+	}
+}
+
+func TestDriftInspectorIgnoresSyncID(t *testing.T) {
+	helm := writeRenderingHelm(t)
+
+	cache := rendercache.New(8)
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	executor.SetHelmBinary(helm)
+	executor.SetCreateNamespace(false)
+	executor.SetStamp(Stamp{Managed: true})
+	executor.SetRenderCache(cache)
+	manager := helmstate.NewManager("", "")
+	manager.HelmBinary = helm
+
+	release := helmstate.Release{Name: "web", Chart: t.TempDir(), Namespace: "frontend"}
+	if _, err := executor.UpgradeReleaseContext(WithSyncID(context.Background(), "sync-1"), release); err != nil {
+		t.Fatalf("UpgradeReleaseContext failed: %v", err)
+	}
+
+	// Each check renders with a new sync ID
+	inspector := NewDriftInspector(manager, executor)
+	for i := 0; i < 2; i++ {
+		match, err := inspector.ManifestsMatch(release)
+		if err != nil {
+			t.Fatalf("ManifestsMatch failed: %v", err)
+		}
+		if !match {
+			t.Error("expected the stamped manifest to match the render")
+		}
+	}
+	if stats := cache.Stats(); stats.Hits != 1 {
+		t.Errorf("expected the second render to be cached, got %+v", stats)
+	}
+
+	diff, err := inspector.DiffRelease(release)
+	if err != nil {
+		t.Fatalf("DiffRelease failed: %v", err)
+	}
+	if diff != "" {
+		t.Errorf("expected no diff with the deployed sync ID, got %q", diff)
+	}
+}
+
+func TestDriftInspectorRendersResourceProfile(t *testing.T) {
+	helm := writeRenderingHelm(t)
+
+	profile, err := ParseResourceProfile("dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	executor.SetHelmBinary(helm)
+	executor.SetCreateNamespace(false)
+	executor.SetResourceProfile(profile)
+	manager := helmstate.NewManager("", "")
+	manager.HelmBinary = helm
+
+	release := helmstate.Release{Name: "web", Chart: "./charts/web", Namespace: "frontend"}
+	if _, err := executor.UpgradeReleaseContext(context.Background(), release); err != nil {
+		t.Fatalf("UpgradeReleaseContext failed: %v", err)
+	}
+
+	// The profile scales the render as it scaled the sync
+	rendered, err := NewDriftInspector(manager, executor).RenderManifest(release)
+	if err != nil {
+		t.Fatalf("RenderManifest failed: %v", err)
+	}
+	if !strings.Contains(rendered, "# post-render ") {
+		t.Errorf("expected the render post-rendered, got %q", rendered)
+	}
+	if match, err := NewDriftInspector(manager, executor).ManifestsMatch(release); err != nil || !match {
+		t.Errorf("expected the scaled manifest to match the render, got %v, %v", match, err)
+	}
+
+	executor.SetResourceProfile(nil)
+	if match, err := NewDriftInspector(manager, executor).ManifestsMatch(release); err != nil || match {
+		t.Errorf("expected the render without the profile not to match, got %v, %v", match, err)
+	}
+}
@@ -2,34 +2,82 @@ package sync
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/httpclient"
+	"github.com/oleksiyp/helmfire/pkg/policy"
+	"github.com/oleksiyp/helmfire/pkg/redact"
+	"github.com/oleksiyp/helmfire/pkg/registryauth"
+	"github.com/oleksiyp/helmfire/pkg/rendercache"
+	"github.com/oleksiyp/helmfire/pkg/secretref"
 	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"github.com/oleksiyp/helmfire/pkg/tracing"
 	"go.uber.org/zap"
 	"gopkg.in/yaml.v3"
 )
 
+// ErrTimeout is returned when a helm operation exceeds its deadline, either the
+// release timeout enforced by helm or the overall sync deadline
+var ErrTimeout = errors.New("timed out")
+
+// IsTimeout reports whether err was caused by a timeout
+func IsTimeout(err error) bool {
+	return errors.Is(err, ErrTimeout) || errors.Is(err, context.DeadlineExceeded)
+}
+
 // Executor handles release synchronization
 type Executor struct {
-	helmBinary  string
-	namespace   string
-	kubeContext string
-	logger      *zap.Logger
-	substitutor *substitute.Manager
-	dryRun      bool
+	helmBinary   string
+	postRenderer string
+	namespace    string
+	kubeContext  string
+	logger       *zap.Logger
+	substitutor  *substitute.Manager
+	stamp        Stamp
+	resources    *ResourceProfile
+	policy       policy.Checker
+	dryRun       bool
+
+	kubectl          string
+	createNamespace  bool
+	verifyNamespaces bool
+	namespaceLookup  NamespaceLookup
+
+	progress         ProgressFunc
+	progressInterval time.Duration
+
+	secrets  *secretref.Resolver
+	redactor *redact.Redactor
+
+	renderCache   *rendercache.Cache
+	packages      *chartPackages
+	offlineCharts string
+
+	// repositoryRecord lists the repositories the executor added to helm
+	repositoryRecord string
 }
 
 // NewExecutor creates a new sync executor
 func NewExecutor(logger *zap.Logger, substitutor *substitute.Manager) *Executor {
+	postRenderer, _ := os.Executable()
 	return &Executor{
-		helmBinary:  "helm",
-		logger:      logger,
-		substitutor: substitutor,
+		helmBinary:      "helm",
+		postRenderer:    postRenderer,
+		logger:          logger,
+		substitutor:     substitutor,
+		kubectl:         "kubectl",
+		createNamespace: true,
+		secrets:         secretref.NewResolver(),
+		redactor:        redact.New(),
+		packages:        newChartPackages(DefaultChartPackageDir()),
 	}
 }
 
@@ -38,80 +86,536 @@ func (e *Executor) SetDryRun(dryRun bool) {
 	e.dryRun = dryRun
 }
 
-// SetNamespace sets the default namespace
+// SetHelmBinary sets the helm binary used for all commands
+func (e *Executor) SetHelmBinary(binary string) {
+	e.helmBinary = binary
+}
+
+// SetPostRenderer sets the binary helm runs as the image substitution
+// post-renderer. It defaults to the running executable, which must call
+// RunPostRendererFromEnv when PostRenderRequested, as helmfire does.
+func (e *Executor) SetPostRenderer(binary string) {
+	e.postRenderer = binary
+}
+
+// SetStamp sets the labels and annotations stamped on the resources of
+// synced releases
+func (e *Executor) SetStamp(stamp Stamp) {
+	e.stamp = stamp
+}
+
+// SetResourceProfile scales down the resources and replicas of the
+// workloads of synced releases; nil leaves them as rendered
+func (e *Executor) SetResourceProfile(profile *ResourceProfile) {
+	e.resources = profile
+}
+
+// SetPolicy sets the policies rendered manifests are checked against
+// before each sync
+func (e *Executor) SetPolicy(checker policy.Checker) {
+	e.policy = checker
+}
+
+// SetRenderCache sets the cache of the manifests helm template renders for
+// policy checks and capability detection; nil renders every time
+func (e *Executor) SetRenderCache(cache *rendercache.Cache) {
+	e.renderCache = cache
+}
+
+// SetRepositoryRecord sets the file recording the repositories the executor
+// added to helm, the only ones PruneRepositories removes; none are recorded
+// or pruned when empty
+func (e *Executor) SetRepositoryRecord(path string) {
+	e.repositoryRecord = path
+}
+
+// SetNamespace sets the namespace of every release, the --namespace flag,
+// overriding the one the helmfile resolved
 func (e *Executor) SetNamespace(namespace string) {
 	e.namespace = namespace
 }
 
-// SetKubeContext sets the kubectl context
+// SetKubeContext sets the kubeconfig context of every release, the
+// --kube-context flag, overriding the one the helmfile resolved
 func (e *Executor) SetKubeContext(context string) {
 	e.kubeContext = context
 }
 
 // SyncRepositories adds/updates helm repositories
 func (e *Executor) SyncRepositories(repos []helmstate.Repository) error {
-	for _, repo := range repos {
-		e.logger.Info("syncing repository", zap.String("name", repo.Name), zap.String("url", repo.URL))
+	return e.SyncRepositoriesContext(context.Background(), repos)
+}
 
-		args := []string{"repo", "add", repo.Name, repo.URL}
-		if repo.Username != "" {
-			args = append(args, "--username", repo.Username)
-		}
-		if repo.Password != "" {
-			args = append(args, "--password", repo.Password)
+// SyncRepositoriesContext adds/updates helm repositories, aborting when ctx is done
+func (e *Executor) SyncRepositoriesContext(ctx context.Context, repos []helmstate.Repository) (err error) {
+	ctx, span := tracing.Start(ctx, "sync.repositories", tracing.Int("repositories", len(repos)))
+	defer func() { span.End(err) }()
+
+	if e.offlineCharts != "" {
+		e.logger.Info("offline: not syncing repositories", zap.Int("count", len(repos)))
+		return nil
+	}
+
+	// Repositories helm knows already weren't added by helmfire, unless
+	// recorded before
+	var known []string
+	if e.repositoryRecord != "" {
+		if known, err = e.listRepositories(ctx); err != nil {
+			return err
 		}
+	}
 
-		if err := e.runHelm(args...); err != nil {
+	e.secrets.Begin(syncIDFrom(ctx))
+	var names []string
+	for _, repo := range repos {
+		e.logger.Info("syncing repository", zap.String("name", repo.Name), zap.String("url", repo.URL))
+		if err := e.addRepository(ctx, repo); err != nil {
 			return fmt.Errorf("failed to add repository %s: %w", repo.Name, err)
 		}
+		if !repo.OCI {
+			names = append(names, repo.Name)
+		}
 	}
 
-	// Update all repositories
-	if len(repos) > 0 {
+	// Update only these repositories, not every one helm knows; OCI
+	// registries have no index
+	if len(names) > 0 {
 		e.logger.Info("updating repositories")
-		if err := e.runHelm("repo", "update"); err != nil {
+		if err := e.runHelm(ctx, append([]string{"repo", "update"}, names...)...); err != nil {
 			return fmt.Errorf("failed to update repositories: %w", err)
 		}
 	}
 
-	return nil
+	return e.recordRepositories(names, known)
+}
+
+// addRepository adds a chart repository to helm, or logs in to an OCI
+// registry. A repository without a username or password takes those the
+// docker config holds for its registry.
+func (e *Executor) addRepository(ctx context.Context, repo helmstate.Repository) error {
+	username, err := e.repoCredential(ctx, repo.Username)
+	if err != nil {
+		return fmt.Errorf("username: %w", err)
+	}
+	// Passwords read from secret managers or docker are kept out of the
+	// arguments
+	password, passwordStdin := repo.Password, true
+	switch {
+	case secretref.IsRef(repo.Password):
+		if password, err = e.repoCredential(ctx, repo.Password); err != nil {
+			return fmt.Errorf("password: %w", err)
+		}
+	case repo.Password != "":
+		passwordStdin = false
+	case username == "":
+		creds, ok, err := e.dockerCredentials(ctx, repo)
+		if err != nil {
+			return err
+		}
+		username, password = creds.Username, creds.Password
+		if ok {
+			e.logger.Debug("using credentials from the docker config", zap.String("repository", repo.Name))
+		}
+	}
+
+	// A repository whose URL changed is replaced rather than failing
+	args := []string{"repo", "add", repo.Name, repo.URL, "--force-update"}
+	insecure := "--insecure-skip-tls-verify"
+	if repo.OCI {
+		// OCI registries aren't added, only logged in to when they need
+		// credentials
+		if username == "" && password == "" {
+			return nil
+		}
+		args = []string{"registry", "login", registryauth.Host(repo.URL)}
+		insecure = "--insecure"
+	}
+	if username != "" {
+		args = append(args, "--username", username)
+	}
+	if caFile := repoCAFile(repo); caFile != "" {
+		args = append(args, "--ca-file", caFile)
+	}
+	if repo.SkipTLSVerify {
+		args = append(args, insecure)
+	}
+
+	var stdin io.Reader
+	if password != "" {
+		e.redactor.Add(password)
+		if passwordStdin {
+			args = append(args, "--password-stdin")
+			stdin = strings.NewReader(password)
+		} else {
+			args = append(args, "--password", password)
+		}
+	}
+
+	_, err = e.runHelmInput(ctx, nil, stdin, args...)
+	return err
+}
+
+// dockerCredentials returns the credentials the docker config, or the
+// repository's credential helper, holds for its registry. When the docker
+// config can't be read the repository is added without, unless it names
+// its credential helper.
+func (e *Executor) dockerCredentials(ctx context.Context, repo helmstate.Repository) (registryauth.Credentials, bool, error) {
+	creds, ok, err := registryauth.Lookup(ctx, repo.URL, repo.CredentialHelper)
+	if err != nil {
+		if repo.CredentialHelper != "" {
+			return registryauth.Credentials{}, false, fmt.Errorf("credentials: %w", err)
+		}
+		e.logger.Warn("failed to read credentials from the docker config",
+			zap.String("repository", repo.Name),
+			zap.Error(err))
+		return registryauth.Credentials{}, false, nil
+	}
+	return creds, ok, nil
+}
+
+// repoCAFile returns the CA bundle a repository's certificate is checked
+// against, defaulting to the one every HTTP client trusts
+func repoCAFile(repo helmstate.Repository) string {
+	if repo.CAFile != "" {
+		return repo.CAFile
+	}
+	return httpclient.Defaults().CAFile
+}
+
+// repoCredential returns a repository credential, reading it from its
+// secret manager when it is a reference
+func (e *Executor) repoCredential(ctx context.Context, value string) (string, error) {
+	if !secretref.IsRef(value) {
+		return value, nil
+	}
+	return e.resolveSecret(ctx, value)
 }
 
 // SyncRelease synchronizes a single release
 func (e *Executor) SyncRelease(release helmstate.Release) error {
+	return e.SyncReleaseContext(context.Background(), release)
+}
+
+// SyncReleaseContext synchronizes a single release, aborting when ctx is done.
+// Errors caused by the release timeout or ctx deadline satisfy IsTimeout.
+func (e *Executor) SyncReleaseContext(ctx context.Context, release helmstate.Release) error {
+	_, err := e.UpgradeReleaseContext(ctx, release)
+	return err
+}
+
+// UpgradeReleaseContext synchronizes a single release like
+// SyncReleaseContext and returns the release as helm reports it, or nil when
+// helm reported nothing. A release failing its health checks is returned
+// with the error.
+func (e *Executor) UpgradeReleaseContext(ctx context.Context, release helmstate.Release) (_ *HelmRelease, err error) {
+	ctx, span := tracing.Start(ctx, "sync.release", tracing.String("release.name", release.Name))
+	defer func() { span.End(err) }()
+
+	chart, namespace, err := e.resolveReleaseContext(ctx, release)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(tracing.String("release.namespace", namespace), tracing.String("release.chart", chart))
+
+	release, cleanupSecrets, err := e.withSecrets(ctx, release)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanupSecrets()
+
+	e.logger.Info("syncing release",
+		zap.String("name", release.Name),
+		zap.String("namespace", namespace),
+		zap.String("chart", chart))
+
+	if err := e.checkPolicy(ctx, release, chart, namespace); err != nil {
+		return nil, err
+	}
+	if err := e.prepareNamespace(ctx, release, namespace); err != nil {
+		return nil, err
+	}
+	if release.Adopt {
+		if err := e.adoptResources(ctx, release, chart, namespace); err != nil {
+			return nil, err
+		}
+	}
+	if err := e.prepareCRDs(ctx, release, chart); err != nil {
+		return nil, err
+	}
+
+	// Substituted local charts are upgraded from an archive packaged once
+	// per content, rather than packaged by helm on every upgrade
+	upgradeChart := chart
+	if chart != release.Chart {
+		upgradeChart = e.packagedChart(ctx, chart)
+	}
+	args := e.upgradeArgs(release, upgradeChart, namespace)
+
+	args, env, cleanup, err := e.withPostRenderer(ctx, args, release, namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	finish := e.watchRollout(ctx, release, namespace)
+	out, err := e.runHelmOutputEnv(ctx, env, args...)
+	if err = finish(err); err != nil {
+		return nil, err
+	}
+
+	result, err := parseHelmRelease(out)
+	if err != nil {
+		// The release was synced; only its report is incomplete
+		e.logger.Warn("failed to parse helm output", zap.String("release", release.Name), zap.Error(err))
+		result = nil
+	}
+	if result != nil {
+		// Charts may print credentials in their notes
+		result.Notes = e.redact(result.Notes)
+		e.logger.Info("release synced",
+			zap.String("name", result.Name),
+			zap.String("namespace", result.Namespace),
+			zap.Int("revision", result.Revision),
+			zap.String("status", result.Status))
+		span.SetAttributes(tracing.Int("release.revision", result.Revision), tracing.String("release.status", result.Status))
+	}
+
+	// Helm synced the release, but it isn't synced until it is healthy
+	if err := e.checkHealth(ctx, release, namespace); err != nil {
+		return result, err
+	}
+
+	tests, err := e.runTests(ctx, release, namespace)
+	if len(tests) > 0 {
+		if result == nil {
+			result = &HelmRelease{Name: release.Name, Namespace: namespace}
+		}
+		result.Tests = tests
+	}
+	return result, err
+}
+
+// checkPolicy renders the release and checks the manifests against the
+// policies, logging warnings. Deny violations return a
+// *policy.ViolationError unless the policy mode is warn.
+func (e *Executor) checkPolicy(ctx context.Context, release helmstate.Release, chart, namespace string) (err error) {
+	if !e.policy.Enabled() {
+		return nil
+	}
+	ctx, span := tracing.Start(ctx, "release.policy")
+	defer func() { span.End(err) }()
+
+	manifests, err := e.renderManifests(ctx, release, chart, namespace)
+	if err != nil {
+		return err
+	}
+	result, err := e.policy.Check(ctx, manifests)
+	if err != nil {
+		return fmt.Errorf("failed to check policies: %w", err)
+	}
+
+	for _, v := range result.Warnings {
+		e.logger.Warn("policy warning",
+			zap.String("release", release.Name),
+			zap.String("resource", v.Resource),
+			zap.String("message", v.Message))
+	}
+	if !result.Blocked(e.policy.Mode) {
+		for _, v := range result.Denied {
+			e.logger.Warn("policy violation (not enforced)",
+				zap.String("release", release.Name),
+				zap.String("resource", v.Resource),
+				zap.String("message", v.Message))
+		}
+		return nil
+	}
+	return &policy.ViolationError{Release: release.Name, Violations: result.Denied}
+}
+
+// renderManifests renders a release with helm template as a sync would,
+// post-renderer included
+func (e *Executor) renderManifests(ctx context.Context, release helmstate.Release, chart, namespace string) (string, error) {
+	return e.renderManifestsArgs(ctx, release, chart, namespace)
+}
+
+// renderManifestsArgs is renderManifests with extra helm template flags
+func (e *Executor) renderManifestsArgs(ctx context.Context, release helmstate.Release, chart, namespace string, extra ...string) (string, error) {
+	args := []string{"template", release.Name, chart, "--namespace", namespace}
+	args = append(args, extra...)
+	if release.Version != "" {
+		args = append(args, "--version", release.Version)
+	}
+	release, cleanupSecrets, err := e.withSecrets(ctx, release)
+	if err != nil {
+		return "", err
+	}
+	defer cleanupSecrets()
+	args = append(args, valuesArgs(release)...)
+
+	args, env, cleanup, err := e.withPostRenderer(ctx, args, release, namespace)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	// Renders of different syncs differ only by the sync ID they are stamped with
+	key := e.renderCache.Key(chart, release.Version, args, withoutSyncID(env))
+	manifests, err := e.renderCache.Render(key, func() (string, error) {
+		return e.runHelmOutputEnv(ctx, env, args...)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to render manifests: %w", err)
+	}
+	return manifests, nil
+}
+
+// PreviewReleaseContext returns the changes a sync of the release would apply
+// without applying them. It runs helm diff upgrade with the same chart, values
+// and substitutions as SyncReleaseContext, so it requires the helm-diff plugin.
+func (e *Executor) PreviewReleaseContext(ctx context.Context, release helmstate.Release) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "sync.preview", tracing.String("release.name", release.Name))
+	defer func() { span.End(err) }()
+
+	chart, namespace, err := e.resolveReleaseContext(ctx, release)
+	if err != nil {
+		return "", err
+	}
+	span.SetAttributes(tracing.String("release.namespace", namespace), tracing.String("release.chart", chart))
+
+	release, cleanupSecrets, err := e.withSecrets(ctx, release)
+	if err != nil {
+		return "", err
+	}
+	defer cleanupSecrets()
+
+	e.logger.Info("previewing release",
+		zap.String("name", release.Name),
+		zap.String("namespace", namespace),
+		zap.String("chart", chart))
+
+	args := e.diffArgs(release, chart, namespace)
+
+	args, env, cleanup, err := e.withPostRenderer(ctx, args, release, namespace)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	return e.runHelmOutputEnv(ctx, env, args...)
+}
+
+// resolveReleaseContext is resolveRelease traced as a stage of the sync of ctx
+func (e *Executor) resolveReleaseContext(ctx context.Context, release helmstate.Release) (chart, namespace string, err error) {
+	ctx, span := tracing.Start(ctx, "release.resolve")
+	chart, namespace, err = e.resolveRelease(ctx, release)
+	span.SetAttributes(tracing.Bool("chart.substituted", chart != release.Chart))
+	span.End(err)
+	return chart, namespace, err
+}
+
+// resolveRelease returns the chart (after substitution) and namespace to
+// sync a release with, asking the substitution providers when the chart
+// wasn't substituted by hand
+func (e *Executor) resolveRelease(ctx context.Context, release helmstate.Release) (chart, namespace string, err error) {
+	namespace = e.ReleaseNamespace(release)
+
 	// Apply chart substitution
-	chart := release.Chart
-	if localPath, ok := e.substitutor.GetChartPath(chart); ok {
+	chart = release.Chart
+	// Pick up new commits for charts substituted from git, falling back to
+	// the cached checkout when the remote is unreachable
+	if changed, err := e.substitutor.RefreshChartFor(chart, release.Name, namespace); err != nil {
+		e.logger.Warn("failed to refresh git chart, using cached checkout",
+			zap.String("chart", chart), zap.Error(err))
+	} else if changed {
+		e.logger.Info("updated git chart", zap.String("chart", chart))
+	}
+	localPath, ok, err := e.substitutor.ResolveChart(ctx, releaseQuery(release, namespace))
+	if err != nil {
+		return "", "", fmt.Errorf("release %s: %w", release.Name, err)
+	}
+	if ok {
 		e.logger.Info("using local chart",
 			zap.String("original", chart),
 			zap.String("local", localPath))
 		chart = localPath
+	} else if e.offlineCharts != "" && helmstate.IsRemoteChart(chart) {
+		if chart, err = helmstate.OfflineChart(e.offlineCharts, chart, release.Version); err != nil {
+			return "", "", fmt.Errorf("release %s: %w", release.Name, err)
+		}
+	}
+
+	return chart, namespace, nil
+}
+
+// releaseQuery describes a release to the substitution providers
+func releaseQuery(release helmstate.Release, namespace string) substitute.Query {
+	return substitute.Query{
+		Release:   release.Name,
+		Namespace: namespace,
+		Chart:     release.Chart,
+		Version:   release.Version,
 	}
+}
 
-	// Determine namespace
-	namespace := release.Namespace
+// ReleaseNamespace returns the namespace a release is synced to
+func (e *Executor) ReleaseNamespace(release helmstate.Release) string {
+	namespace := e.namespace
 	if namespace == "" {
-		namespace = e.namespace
+		namespace = release.Namespace
 	}
 	if namespace == "" {
 		namespace = "default"
 	}
+	return namespace
+}
+
+// ReleaseKubeContext returns the kubeconfig context a release is synced
+// to; the current context when empty
+func (e *Executor) ReleaseKubeContext(release helmstate.Release) string {
+	if e.kubeContext != "" {
+		return e.kubeContext
+	}
+	return release.KubeContext
+}
 
-	e.logger.Info("syncing release",
-		zap.String("name", release.Name),
-		zap.String("namespace", namespace),
-		zap.String("chart", chart))
+// withPostRenderer adds the post-renderer to args when image substitutions
+// apply to the release or its resources are stamped or scaled, returning the
+// environment helm needs to pass it its config. The returned cleanup removes
+// the config file, if one was needed. Resources are stamped with the sync ID of ctx.
+func (e *Executor) withPostRenderer(ctx context.Context, args []string, release helmstate.Release, namespace string) ([]string, []string, func(), error) {
+	substitutions, err := e.substitutor.ResolveImages(ctx, releaseQuery(release, namespace))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("release %s: %w", release.Name, err)
+	}
+	if len(substitutions) == 0 && !e.stamp.Enabled() && e.resources == nil {
+		return args, nil, func() {}, nil
+	}
+	if e.postRenderer == "" {
+		return nil, nil, nil, fmt.Errorf("failed to create post-renderer: helmfire executable not found")
+	}
+
+	_, span := tracing.Start(ctx, "release.substitute", tracing.Int("substitutions", len(substitutions)))
+	env, cleanup, err := postRenderEnv(substitutions, e.stamp, e.resources, release.Name, syncIDFrom(ctx))
+	span.End(err)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create post-renderer: %w", err)
+	}
+	return append(args, "--post-renderer", e.postRenderer), env, cleanup, nil
+}
 
-	// Build helm upgrade --install command
-	args := []string{"upgrade", "--install", release.Name, chart}
+// upgradeArgs builds the helm upgrade --install arguments for a release
+func (e *Executor) upgradeArgs(release helmstate.Release, chart, namespace string) []string {
+	args := []string{"upgrade", "--install", release.Name, chart, "--description", SyncDescription}
 
 	if namespace != "" {
 		args = append(args, "--namespace", namespace)
-		args = append(args, "--create-namespace")
+		if e.createNamespaceFor(release) {
+			args = append(args, "--create-namespace")
+		}
 	}
 
-	if e.kubeContext != "" {
-		args = append(args, "--kube-context", e.kubeContext)
+	if kubeContext := e.ReleaseKubeContext(release); kubeContext != "" {
+		args = append(args, "--kube-context", kubeContext)
 	}
 
 	if release.Version != "" {
@@ -122,92 +626,198 @@ func (e *Executor) SyncRelease(release helmstate.Release) error {
 		args = append(args, "--wait")
 	}
 
-	// Add values files
+	if release.Timeout > 0 {
+		args = append(args, "--timeout", (time.Duration(release.Timeout) * time.Second).String())
+	}
+
+	// CRDs are helm's only with the default strategy
+	if release.CRDs != "" {
+		args = append(args, "--skip-crds")
+	}
+
+	args = append(args, valuesArgs(release)...)
+
+	if e.dryRun {
+		args = append(args, "--dry-run")
+	}
+
+	// The release helm reports is parsed rather than logged
+	return append(args, "--output", "json")
+}
+
+// diffArgs builds the helm diff upgrade arguments matching upgradeArgs
+func (e *Executor) diffArgs(release helmstate.Release, chart, namespace string) []string {
+	args := []string{"diff", "upgrade", release.Name, chart, "--namespace", namespace, "--allow-unreleased"}
+
+	if kubeContext := e.ReleaseKubeContext(release); kubeContext != "" {
+		args = append(args, "--kube-context", kubeContext)
+	}
+
+	if release.Version != "" {
+		args = append(args, "--version", release.Version)
+	}
+
+	return append(args, valuesArgs(release)...)
+}
+
+// valuesArgs builds the values file and --set arguments of a release
+func valuesArgs(release helmstate.Release) []string {
+	var args []string
 	for _, val := range release.Values {
 		if valStr, ok := val.(string); ok {
 			args = append(args, "-f", valStr)
 		}
 	}
-
-	// Add --set values
 	for _, set := range release.Set {
+		if set.File != "" {
+			args = append(args, "--set-file", fmt.Sprintf("%s=%s", set.Name, set.File))
+			continue
+		}
 		args = append(args, "--set", fmt.Sprintf("%s=%s", set.Name, set.Value))
 	}
+	return args
+}
+
+// UninstallRelease removes a release from a namespace of a kubeconfig
+// context, the executor's when empty
+func (e *Executor) UninstallRelease(ctx context.Context, name, namespace, kubeContext string) error {
+	e.logger.Info("uninstalling release",
+		zap.String("name", name),
+		zap.String("namespace", namespace))
 
+	if kubeContext == "" {
+		kubeContext = e.kubeContext
+	}
+	args := []string{"uninstall", name, "--namespace", namespace}
+	if kubeContext != "" {
+		args = append(args, "--kube-context", kubeContext)
+	}
 	if e.dryRun {
 		args = append(args, "--dry-run")
 	}
 
-	// Check if we have image substitutions - if so, use post-renderer
-	if len(e.substitutor.ListImageSubstitutions()) > 0 {
-		// Create temporary post-renderer script
-		postRenderer, err := e.createImagePostRenderer()
-		if err != nil {
-			return fmt.Errorf("failed to create post-renderer: %w", err)
-		}
-		defer os.Remove(postRenderer)
+	return e.runHelm(ctx, args...)
+}
 
-		args = append(args, "--post-renderer", postRenderer)
-	}
+// createImagePostRenderer writes the image substitutions for the
+// post-renderer to a temporary file and returns its path
+func (e *Executor) createImagePostRenderer(substitutions []substitute.ImageSubstitution) (string, error) {
+	return writePostRenderConfig(substitutions, Stamp{}, "", "")
+}
 
-	return e.runHelm(args...)
+// CreateImagePostRendererForBenchmark is a public wrapper for benchmarking
+func (e *Executor) CreateImagePostRendererForBenchmark() (string, error) {
+	return e.createImagePostRenderer(e.substitutor.ImageSubstitutionsFor("", ""))
 }
 
-// createImagePostRenderer creates a temporary script for image substitution
-func (e *Executor) createImagePostRenderer() (string, error) {
-	tmpDir := os.TempDir()
-	scriptPath := filepath.Join(tmpDir, "helmfire-post-renderer.sh")
+// runHelm executes a helm command, killing it when ctx is done
+func (e *Executor) runHelm(ctx context.Context, args ...string) error {
+	_, err := e.runHelmOutput(ctx, args...)
+	return err
+}
 
-	// Build substitution map
-	substitutions := e.substitutor.ListImageSubstitutions()
-	sedCommands := make([]string, 0, len(substitutions))
+// runHelmOutput executes a helm command and returns its stdout
+func (e *Executor) runHelmOutput(ctx context.Context, args ...string) (string, error) {
+	return e.runHelmOutputEnv(ctx, nil, args...)
+}
 
-	for _, sub := range substitutions {
-		// Escape special characters for sed
-		original := strings.ReplaceAll(sub.Original, "/", "\\/")
-		replacement := strings.ReplaceAll(sub.Replacement, "/", "\\/")
-		sedCommands = append(sedCommands, fmt.Sprintf("s/image: %s/image: %s/g", original, replacement))
-	}
+// runHelmOutputEnv executes a helm command with env added to the environment
+// and returns its stdout
+func (e *Executor) runHelmOutputEnv(ctx context.Context, env []string, args ...string) (string, error) {
+	return e.runHelmInput(ctx, env, nil, args...)
+}
 
-	script := fmt.Sprintf(`#!/bin/bash
-cat <&0 | sed '%s'
-`, strings.Join(sedCommands, ";"))
+// runHelmInput executes a helm command with env added to the environment
+// and stdin as its input, and returns its stdout
+func (e *Executor) runHelmInput(ctx context.Context, env []string, stdin io.Reader, args ...string) (string, error) {
+	// Only the subcommand is recorded; arguments may hold credentials
+	command := helmCommand(args)
+	ctx, span := tracing.Start(ctx, "helm "+command, tracing.String("helm.command", command))
+	out, err := e.execHelm(ctx, env, stdin, args...)
+	span.End(err)
+	return out, err
+}
 
-	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
-		return "", err
+// helmCommand returns the subcommand of helm args, e.g. "upgrade" or
+// "repo add"
+func helmCommand(args []string) string {
+	if len(args) == 0 {
+		return ""
 	}
-
-	return scriptPath, nil
+	switch args[0] {
+	case "repo", "diff", "dependency", "plugin", "get", "search", "registry":
+		if len(args) > 1 {
+			return args[0] + " " + args[1]
+		}
+	}
+	return args[0]
 }
 
-// CreateImagePostRendererForBenchmark is a public wrapper for benchmarking
-func (e *Executor) CreateImagePostRendererForBenchmark() (string, error) {
-	return e.createImagePostRenderer()
-}
+// execHelm runs helm for runHelmOutputEnv, passing the trace of ctx on to
+// the post-renderer
+func (e *Executor) execHelm(ctx context.Context, env []string, stdin io.Reader, args ...string) (string, error) {
+	if trace := tracing.Environ(ctx); len(trace) > 0 {
+		env = append(append([]string(nil), env...), trace...)
+	}
+	// Only commands reaching chart repositories go through the proxy, not
+	// those talking to the cluster
+	if fetchesCharts(args) {
+		env = append(append([]string(nil), env...), httpclient.HelmEnv()...)
+	}
 
-// runHelm executes a helm command
-func (e *Executor) runHelm(args ...string) error {
-	cmd := exec.Command(e.helmBinary, args...)
+	cmd := exec.CommandContext(ctx, e.helmBinary, args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Stdin = stdin
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
-	e.logger.Debug("executing helm command", zap.Strings("args", args))
+	// Secrets are masked in what is logged or returned
+	e.logger.Debug("executing helm command", zap.Strings("args", e.redactArgs(args)))
 
 	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			e.logger.Error("helm command aborted", zap.Error(ctxErr))
+			if errors.Is(ctxErr, context.DeadlineExceeded) {
+				return "", fmt.Errorf("helm command %w: %v", ErrTimeout, ctxErr)
+			}
+			return "", fmt.Errorf("helm command aborted: %w", ctxErr)
+		}
+		errOut := e.redact(stderr.String())
+		if isHelmTimeout(errOut) {
+			e.logger.Error("helm command timed out", zap.String("stderr", errOut))
+			return "", fmt.Errorf("helm command %w\nstderr: %s", ErrTimeout, errOut)
+		}
 		e.logger.Error("helm command failed",
 			zap.Error(err),
-			zap.String("stdout", stdout.String()),
-			zap.String("stderr", stderr.String()))
-		return fmt.Errorf("helm command failed: %w\nstderr: %s", err, stderr.String())
+			zap.String("stdout", e.redact(stdout.String())),
+			zap.String("stderr", errOut))
+		return "", fmt.Errorf("helm command failed: %w\nstderr: %s", err, errOut)
 	}
 
 	if stdout.Len() > 0 {
-		e.logger.Info("helm output", zap.String("output", stdout.String()))
+		e.logger.Debug("helm output", zap.String("output", e.redact(stdout.String())))
+	}
+
+	return stdout.String(), nil
+}
+
+// fetchesCharts reports whether helm args download from chart repositories
+func fetchesCharts(args []string) bool {
+	switch helmCommand(args) {
+	case "repo add", "repo update", "registry login", "pull", "dependency build", "dependency update":
+		return true
 	}
+	return false
+}
 
-	return nil
+// isHelmTimeout reports whether helm's stderr indicates that its own --timeout expired
+func isHelmTimeout(stderr string) bool {
+	return strings.Contains(stderr, "timed out waiting for the condition") ||
+		strings.Contains(stderr, "context deadline exceeded")
 }
 
 // LoadValuesFile loads and merges a values file
@@ -224,3 +834,52 @@ func LoadValuesFile(path string) (map[string]interface{}, error) {
 
 	return values, nil
 }
+
+// CheckChartSubstitution compares the chart substituted for original in scope
+// with the chart it replaces and the version constraints of releases using it.
+// The original chart's metadata is looked up with helm show chart when the
+// chart is available; otherwise only the name and versions are checked.
+func (e *Executor) CheckChartSubstitution(ctx context.Context, original string, scope substitute.Scope, releases []helmstate.Release) ([]string, error) {
+	local, err := e.substitutor.ChartMetadata(original, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	var constraints []substitute.VersionConstraint
+	version := ""
+	for _, release := range releases {
+		if release.Chart != original || !scope.Matches(release.Name, e.ReleaseNamespace(release)) {
+			continue
+		}
+		constraints = append(constraints, substitute.VersionConstraint{Release: release.Name, Constraint: release.Version})
+		if version == "" {
+			version = release.Version
+		}
+	}
+
+	originalMeta, err := e.showChart(ctx, original, version)
+	if err != nil {
+		e.logger.Debug("original chart metadata unavailable",
+			zap.String("chart", original), zap.Error(err))
+	}
+
+	return substitute.CheckCompatibility(original, originalMeta, local, constraints), nil
+}
+
+// showChart returns the Chart.yaml of a chart reference with helm show chart
+func (e *Executor) showChart(ctx context.Context, chart, version string) (*substitute.ChartMetadata, error) {
+	args := []string{"show", "chart", chart}
+	if version != "" {
+		args = append(args, "--version", version)
+	}
+
+	cmd := exec.CommandContext(ctx, e.helmBinary, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("helm show chart failed: %w (stderr: %s)", err, strings.TrimSpace(stderr.String()))
+	}
+	return substitute.ParseChartMetadata(stdout.Bytes())
+}
@@ -1,11 +1,19 @@
 package sync
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/policy"
 	"github.com/oleksiyp/helmfire/pkg/substitute"
 	"go.uber.org/zap"
 )
@@ -77,42 +85,21 @@ func TestCreateImagePostRenderer(t *testing.T) {
 		t.Fatalf("failed to add image substitution: %v", err)
 	}
 
-	// Create post-renderer script
-	scriptPath, err := executor.createImagePostRenderer()
+	// Write the substitutions for the post-renderer
+	path, err := executor.createImagePostRenderer(sub.ImageSubstitutionsFor("", ""))
 	if err != nil {
 		t.Fatalf("createImagePostRenderer failed: %v", err)
 	}
-	defer os.Remove(scriptPath)
+	defer os.Remove(path)
 
-	// Verify script exists and is executable
-	info, err := os.Stat(scriptPath)
-	if err != nil {
-		t.Fatalf("script not created: %v", err)
-	}
-
-	if info.Mode()&0111 == 0 {
-		t.Error("script is not executable")
-	}
-
-	// Read script content
-	content, err := os.ReadFile(scriptPath)
-	if err != nil {
-		t.Fatalf("failed to read script: %v", err)
-	}
-
-	scriptContent := string(content)
-
-	// Verify it's a bash script
-	if scriptContent[:11] != "#!/bin/bash" {
-		t.Error("script doesn't start with shebang")
+	// The post-renderer applies them to rendered manifests
+	var out bytes.Buffer
+	manifest := "containers:\n- image: nginx:1.21\n- image: \"postgres:15\"\n"
+	if err := RunPostRenderer(strings.NewReader(manifest), &out, path); err != nil {
+		t.Fatalf("RunPostRenderer failed: %v", err)
 	}
-
-	// Verify it contains substitution commands
-	if !contains(scriptContent, "nginx") {
-		t.Error("script doesn't contain nginx substitution")
-	}
-	if !contains(scriptContent, "postgres") {
-		t.Error("script doesn't contain postgres substitution")
+	if want := "containers:\n- image: nginx:1.22\n- image: \"postgres:16\"\n"; out.String() != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, out.String())
 	}
 }
 
@@ -252,8 +239,337 @@ func TestSyncRepositories(t *testing.T) {
 	_ = err
 }
 
+func TestUpgradeArgsTimeout(t *testing.T) {
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+
+	release := helmstate.Release{
+		Name:    "nginx",
+		Chart:   "bitnami/nginx",
+		Timeout: 90,
+	}
+
+	args := executor.upgradeArgs(release, release.Chart, "default")
+	if !hasArgPair(args, "--timeout", "1m30s") {
+		t.Errorf("expected --timeout 1m30s in args, got %v", args)
+	}
+
+	release.Timeout = 0
+	args = executor.upgradeArgs(release, release.Chart, "default")
+	for _, arg := range args {
+		if arg == "--timeout" {
+			t.Errorf("expected no --timeout without release timeout, got %v", args)
+		}
+	}
+}
+
+func TestReleaseTarget(t *testing.T) {
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	release := helmstate.Release{Name: "web", Chart: "bitnami/nginx", Namespace: "web", KubeContext: "staging"}
+
+	if ns := executor.ReleaseNamespace(release); ns != "web" {
+		t.Errorf("expected the release namespace, got %s", ns)
+	}
+	for _, args := range [][]string{
+		executor.upgradeArgs(release, release.Chart, "web"),
+		executor.diffArgs(release, release.Chart, "web"),
+	} {
+		if !hasArgPair(args, "--kube-context", "staging") {
+			t.Errorf("expected the release context, got %v", args)
+		}
+	}
+
+	// The flags override what the helmfile resolved
+	executor.SetNamespace("apps")
+	executor.SetKubeContext("prod")
+	if ns := executor.ReleaseNamespace(release); ns != "apps" {
+		t.Errorf("expected the --namespace flag to win, got %s", ns)
+	}
+	if args := executor.upgradeArgs(release, release.Chart, "apps"); !hasArgPair(args, "--kube-context", "prod") {
+		t.Errorf("expected the --kube-context flag to win, got %v", args)
+	}
+	if args := kubectlArgs(executor.ReleaseKubeContext(release), "get", "namespace", "apps"); !hasArgPair(args, "--context", "prod") {
+		t.Errorf("expected kubectl to use the same context, got %v", args)
+	}
+}
+
+func TestRunHelmDeadline(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep binary not available")
+	}
+
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	executor.helmBinary = "sleep"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := executor.runHelm(ctx, "5")
+	if err == nil {
+		t.Fatal("expected error when deadline exceeded")
+	}
+	if !IsTimeout(err) {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+}
+
+func TestIsHelmTimeout(t *testing.T) {
+	if !isHelmTimeout("Error: UPGRADE FAILED: timed out waiting for the condition") {
+		t.Error("expected helm wait timeout to be detected")
+	}
+	if isHelmTimeout("Error: chart not found") {
+		t.Error("expected unrelated error not to be a timeout")
+	}
+}
+
+func TestPreviewReleaseContext(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	// Fake helm prints its arguments as the diff
+	helm := filepath.Join(t.TempDir(), "helm")
+	if err := os.WriteFile(helm, []byte("#!/bin/sh\necho \"$@\"\n"), 0755); err != nil {
+		t.Fatalf("failed to write fake helm: %v", err)
+	}
+
+	sub := substitute.NewManager()
+	localChart := t.TempDir()
+	if err := os.WriteFile(filepath.Join(localChart, "Chart.yaml"), []byte("apiVersion: v2\nname: nginx\nversion: 1.0.0\n"), 0644); err != nil {
+		t.Fatalf("failed to write Chart.yaml: %v", err)
+	}
+	if err := sub.AddChartSubstitution("bitnami/nginx", localChart); err != nil {
+		t.Fatalf("failed to add chart substitution: %v", err)
+	}
+
+	executor := NewExecutor(zap.NewNop(), sub)
+	executor.SetHelmBinary(helm)
+
+	out, err := executor.PreviewReleaseContext(context.Background(), helmstate.Release{
+		Name:      "web",
+		Chart:     "bitnami/nginx",
+		Namespace: "frontend",
+		Version:   "15.0.0",
+	})
+	if err != nil {
+		t.Fatalf("PreviewReleaseContext failed: %v", err)
+	}
+
+	args := strings.Fields(out)
+	if len(args) < 4 || args[0] != "diff" || args[1] != "upgrade" || args[2] != "web" || args[3] != localChart {
+		t.Errorf("expected diff upgrade of substituted chart, got %q", out)
+	}
+	if !hasArgPair(args, "--namespace", "frontend") || !hasArgPair(args, "--version", "15.0.0") {
+		t.Errorf("expected namespace and version flags, got %q", out)
+	}
+}
+
+func TestScopedSubstitutions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	// Fake helm prints its arguments as the diff
+	helm := filepath.Join(t.TempDir(), "helm")
+	if err := os.WriteFile(helm, []byte("#!/bin/sh\necho \"$@\"\n"), 0755); err != nil {
+		t.Fatalf("failed to write fake helm: %v", err)
+	}
+
+	sub := substitute.NewManager()
+	localChart := t.TempDir()
+	if err := os.WriteFile(filepath.Join(localChart, "Chart.yaml"), []byte("apiVersion: v2\nname: postgresql\nversion: 1.0.0\n"), 0644); err != nil {
+		t.Fatalf("failed to write Chart.yaml: %v", err)
+	}
+	if err := sub.AddScopedChartSubstitution("bitnami/postgresql", localChart, substitute.Scope{Release: "my-db"}); err != nil {
+		t.Fatalf("failed to add chart substitution: %v", err)
+	}
+	if err := sub.AddScopedImageSubstitution("postgres:15", "local/pg:dev", substitute.Scope{Release: "my-db"}); err != nil {
+		t.Fatalf("failed to add image substitution: %v", err)
+	}
+
+	executor := NewExecutor(zap.NewNop(), sub)
+	executor.SetHelmBinary(helm)
+
+	preview := func(name string) []string {
+		out, err := executor.PreviewReleaseContext(context.Background(), helmstate.Release{
+			Name:  name,
+			Chart: "bitnami/postgresql",
+		})
+		if err != nil {
+			t.Fatalf("PreviewReleaseContext failed: %v", err)
+		}
+		return strings.Fields(out)
+	}
+
+	args := preview("my-db")
+	if args[3] != localChart {
+		t.Errorf("expected my-db to use the scoped chart, got %v", args)
+	}
+	if !contains(strings.Join(args, " "), "--post-renderer") {
+		t.Errorf("expected my-db to use the image post-renderer, got %v", args)
+	}
+
+	args = preview("other-db")
+	if args[3] != "bitnami/postgresql" {
+		t.Errorf("expected other-db to use the original chart, got %v", args)
+	}
+	if contains(strings.Join(args, " "), "--post-renderer") {
+		t.Errorf("expected no post-renderer for other-db, got %v", args)
+	}
+}
+
+func TestSubstitutionProviders(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	// Fake helm prints its arguments as the diff; the provider substitutes
+	// charts for web and fails for broken
+	dir := t.TempDir()
+	helm := filepath.Join(dir, "helm")
+	if err := os.WriteFile(helm, []byte("#!/bin/sh\necho \"$@\"\n"), 0755); err != nil {
+		t.Fatalf("failed to write fake helm: %v", err)
+	}
+	provider := filepath.Join(dir, "provider")
+	script := `#!/bin/sh
+case "$HELMFIRE_PROVIDER_KIND/$HELMFIRE_RELEASE" in
+*/broken) echo 'no build' >&2; exit 1 ;;
+chart/web) echo '{"chart": "./builds/web"}' ;;
+images/web) echo '{"images": {"nginx:1.25": "registry.internal/nginx:pr-7"}}' ;;
+esac
+`
+	if err := os.WriteFile(provider, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake provider: %v", err)
+	}
+
+	sub := substitute.NewManager()
+	sub.AddProvider(substitute.NewExecProvider("builds", provider, nil))
+	executor := NewExecutor(zap.NewNop(), sub)
+	executor.SetHelmBinary(helm)
+	ctx := context.Background()
+
+	out, err := executor.PreviewReleaseContext(ctx, helmstate.Release{Name: "web", Chart: "bitnami/nginx"})
+	if err != nil {
+		t.Fatalf("PreviewReleaseContext failed: %v", err)
+	}
+	args := strings.Fields(out)
+	if args[3] != "./builds/web" || !contains(out, "--post-renderer") {
+		t.Errorf("expected the provider's chart and images for web, got %v", args)
+	}
+
+	out, err = executor.PreviewReleaseContext(ctx, helmstate.Release{Name: "api", Chart: "bitnami/api"})
+	if err != nil {
+		t.Fatalf("PreviewReleaseContext failed: %v", err)
+	}
+	if args := strings.Fields(out); args[3] != "bitnami/api" || contains(out, "--post-renderer") {
+		t.Errorf("expected api unsubstituted, got %v", args)
+	}
+
+	if _, err := executor.PreviewReleaseContext(ctx, helmstate.Release{Name: "broken", Chart: "bitnami/broken"}); err == nil || !contains(err.Error(), "no build") {
+		t.Errorf("expected the provider failure to fail the release, got %v", err)
+	}
+}
+
+func TestSyncReleasePolicy(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	// Fake helm logs upgrades and renders a deployment; fake opa denies it
+	dir := t.TempDir()
+	log := filepath.Join(dir, "upgrades")
+	helm := filepath.Join(dir, "helm")
+	script := `#!/bin/sh
+case "$1" in
+template) printf 'kind: Deployment\nmetadata:\n  name: web\n' ;;
+upgrade) echo "$@" >> ` + log + ` ;;
+esac
+`
+	if err := os.WriteFile(helm, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake helm: %v", err)
+	}
+	opa := filepath.Join(dir, "opa")
+	script = `#!/bin/sh
+cat > /dev/null
+echo '{"result":[{"expressions":[{"value":[{"index":0,"deny":["image uses the latest tag"],"warn":[]}]}]}]}'
+`
+	if err := os.WriteFile(opa, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake opa: %v", err)
+	}
+
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	executor.SetHelmBinary(helm)
+	release := helmstate.Release{Name: "web", Chart: "bitnami/nginx"}
+
+	executor.SetPolicy(policy.Checker{Dir: dir, Mode: policy.ModeEnforce, Binary: opa})
+	err := executor.SyncReleaseContext(context.Background(), release)
+	var violationErr *policy.ViolationError
+	if !errors.As(err, &violationErr) {
+		t.Fatalf("expected a policy violation, got %v", err)
+	}
+	if len(violationErr.Violations) != 1 || violationErr.Violations[0].Resource != "Deployment/web" {
+		t.Errorf("unexpected violations: %+v", violationErr.Violations)
+	}
+	if _, err := os.Stat(log); err == nil {
+		t.Error("expected the blocked release not to be upgraded")
+	}
+
+	// In warn mode the release is synced anyway
+	executor.SetPolicy(policy.Checker{Dir: dir, Mode: policy.ModeWarn, Binary: opa})
+	if err := executor.SyncReleaseContext(context.Background(), release); err != nil {
+		t.Fatalf("SyncReleaseContext failed: %v", err)
+	}
+	if _, err := os.Stat(log); err != nil {
+		t.Error("expected the release to be upgraded in warn mode")
+	}
+}
+
+func TestUpgradeReleaseReportsHelmRelease(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	log := filepath.Join(dir, "args")
+	helm := filepath.Join(dir, "helm")
+	script := `#!/bin/sh
+echo "$@" >> ` + log + `
+echo '{"name":"web","namespace":"default","version":2,"info":{"status":"deployed","notes":"hello"},"chart":{"metadata":{"name":"nginx","version":"1.0.0"}}}'
+`
+	if err := os.WriteFile(helm, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake helm: %v", err)
+	}
+
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	executor.SetHelmBinary(helm)
+	executor.SetCreateNamespace(false)
+	release, err := executor.UpgradeReleaseContext(context.Background(), helmstate.Release{Name: "web", Chart: "bitnami/nginx"})
+	if err != nil {
+		t.Fatalf("UpgradeReleaseContext failed: %v", err)
+	}
+	if release == nil || release.Revision != 2 || release.Status != "deployed" || release.Notes != "hello" || release.ChartVersion != "1.0.0" {
+		t.Errorf("unexpected helm release %+v", release)
+	}
+
+	args, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(args), "upgrade --install web") || !strings.Contains(string(args), "--output json") {
+		t.Errorf("expected upgrade with JSON output, got %q", args)
+	}
+}
+
 // Helper functions
 
+func hasArgPair(args []string, flag, value string) bool {
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == flag && args[i+1] == value {
+			return true
+		}
+	}
+	return false
+}
+
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(s) > len(substr) && containsHelper(s, substr))
 }
@@ -275,3 +591,17 @@ func isHelmAvailable() bool {
 	_, err = os.Stat("/usr/local/bin/helm")
 	return err == nil
 }
+
+func TestHelmCommand(t *testing.T) {
+	tests := map[string][]string{
+		"upgrade":  {"upgrade", "--install", "web", "./chart"},
+		"repo add": {"repo", "add", "stable", "https://charts.example.com", "--password", "secret"},
+		"repo":     {"repo"},
+		"":         nil,
+	}
+	for want, args := range tests {
+		if got := helmCommand(args); got != want {
+			t.Errorf("helmCommand(%v) = %q, want %q", args, got, want)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package sync
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/tracing"
+	"go.uber.org/zap"
+)
+
+// portForwardReady is how long kubectl port-forward may take to start
+// forwarding
+const portForwardReady = 10 * time.Second
+
+// forwardingFrom matches the line kubectl port-forward prints once it
+// listens, such as "Forwarding from 127.0.0.1:43567 -> 8080"
+var forwardingFrom = regexp.MustCompile(`Forwarding from 127\.0\.0\.1:(\d+) ->`)
+
+// checkHealth runs the health checks of a synced release in order,
+// failing on the first that doesn't pass
+func (e *Executor) checkHealth(ctx context.Context, release helmstate.Release, namespace string) (err error) {
+	if len(release.HealthChecks) == 0 || e.dryRun {
+		return nil
+	}
+	ctx, span := tracing.Start(ctx, "release.health", tracing.Int("checks", len(release.HealthChecks)))
+	defer func() { span.End(err) }()
+
+	kubeContext := e.ReleaseKubeContext(release)
+	for _, check := range release.HealthChecks {
+		check = check.Resolved(release.Name)
+		start := time.Now()
+		if err := e.runHealthCheck(ctx, check, namespace, kubeContext); err != nil {
+			return fmt.Errorf("health check %s failed: %w", check, err)
+		}
+		e.logger.Info("health check passed",
+			zap.String("release", release.Name),
+			zap.String("check", check.String()),
+			zap.Duration("duration", time.Since(start)))
+	}
+	return nil
+}
+
+// runHealthCheck runs one check, retrying HTTP and exec checks until they
+// pass or the check times out
+func (e *Executor) runHealthCheck(ctx context.Context, check helmstate.HealthCheck, namespace, kubeContext string) error {
+	if check.Condition != nil {
+		_, stderr, err := e.runTool(ctx, e.kubectl, nil, nil, kubectlArgs(kubeContext, "wait",
+			"--for", "condition="+check.Condition.Condition, check.Condition.Resource,
+			"--namespace", namespace, "--timeout", check.Timeout.String())...)
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr))
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, check.Timeout)
+	defer cancel()
+	var lastErr error
+	for {
+		var err error
+		if check.HTTP != nil {
+			err = e.probeHTTP(ctx, *check.HTTP, namespace, kubeContext)
+		} else {
+			err = e.probeExec(ctx, *check.Exec, namespace, kubeContext)
+		}
+		if err == nil {
+			return nil
+		}
+		// An attempt cut short by the timeout tells less than the one before
+		if ctx.Err() == nil || lastErr == nil {
+			lastErr = err
+		}
+		e.logger.Debug("health check not passing yet", zap.String("check", check.String()), zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("still failing after %s: %w", check.Timeout, lastErr)
+		case <-time.After(check.Interval):
+		}
+	}
+}
+
+// probeExec runs the command of an exec check once
+func (e *Executor) probeExec(ctx context.Context, check helmstate.ExecCheck, namespace, kubeContext string) error {
+	args := []string{"exec", "--namespace", namespace, check.Resource}
+	if check.Container != "" {
+		args = append(args, "--container", check.Container)
+	}
+	if kubeContext != "" {
+		args = append(args, "--context", kubeContext)
+	}
+	args = append(append(args, "--"), check.Command...)
+
+	_, stderr, err := e.runTool(ctx, e.kubectl, nil, nil, args...)
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr))
+	}
+	return nil
+}
+
+// probeHTTP requests the path of an HTTP check once, through a port-forward
+// started for the request
+func (e *Executor) probeHTTP(ctx context.Context, check helmstate.HTTPCheck, namespace, kubeContext string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, e.kubectl, kubectlArgs(kubeContext, "port-forward",
+		"--namespace", namespace, check.Resource, ":"+strconv.Itoa(check.Port))...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = time.Second
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start port-forward: %w", err)
+	}
+	stop := func() {
+		cancel()
+		cmd.Wait()
+	}
+
+	localPort, err := waitForwarding(stdout, portForwardReady)
+	if err != nil {
+		stop()
+		return fmt.Errorf("port-forward to %s %w: %s", check.Resource, err, strings.TrimSpace(stderr.String()))
+	}
+	defer stop()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://127.0.0.1:"+localPort+check.Path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := (&http.Client{Timeout: 10 * time.Second}).Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if check.Status != 0 && resp.StatusCode != check.Status {
+		return fmt.Errorf("status %d, want %d", resp.StatusCode, check.Status)
+	}
+	if check.Status == 0 && (resp.StatusCode < 200 || resp.StatusCode >= 300) {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// waitForwarding reads kubectl port-forward output until it forwards,
+// returning the local port it listens on
+func waitForwarding(stdout io.Reader, timeout time.Duration) (string, error) {
+	port := make(chan string, 1)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			if m := forwardingFrom.FindStringSubmatch(scanner.Text()); m != nil {
+				port <- m[1]
+				break
+			}
+		}
+		close(port)
+		io.Copy(io.Discard, stdout)
+	}()
+
+	select {
+	case p, ok := <-port:
+		if !ok {
+			return "", errors.New("exited before forwarding")
+		}
+		return p, nil
+	case <-time.After(timeout):
+		return "", fmt.Errorf("not forwarding after %s", timeout)
+	}
+}
@@ -0,0 +1,110 @@
+package sync
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"go.uber.org/zap"
+)
+
+func TestHealthChecks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake kubectl script requires a POSIX shell")
+	}
+
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+
+	// Fake kubectl forwards to the test server, passes exec checks from the
+	// second attempt and waits for conditions unless $WAIT_FAIL is set
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	helm := filepath.Join(dir, "helm")
+	kubectl := filepath.Join(dir, "kubectl")
+	helmScript := `#!/bin/sh
+echo '{"name":"web","namespace":"apps","version":3,"info":{"status":"deployed"}}'
+`
+	kubectlScript := `#!/bin/sh
+echo "$@" >> ` + log + `
+case "$1" in
+port-forward) echo "Forwarding from 127.0.0.1:` + serverURL.Port() + ` -> 8080"; exec sleep 30 ;;
+exec) [ -f ` + filepath.Join(dir, "exec-once") + ` ] && exit 0; touch ` + filepath.Join(dir, "exec-once") + `; exit 1 ;;
+wait) [ -z "$WAIT_FAIL" ] || { echo 'error: timed out waiting for the condition' >&2; exit 1; } ;;
+esac
+`
+	if err := os.WriteFile(helm, []byte(helmScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(kubectl, []byte(kubectlScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	executor.SetHelmBinary(helm)
+	executor.SetKubectl(kubectl)
+	executor.SetCreateNamespace(false)
+	release := helmstate.Release{Name: "web", Namespace: "apps", Chart: "./web", HealthChecks: []helmstate.HealthCheck{
+		{HTTP: &helmstate.HTTPCheck{Port: 8080, Path: "/healthz"}},
+		{Exec: &helmstate.ExecCheck{Container: "app", Command: []string{"pg_isready"}}, Interval: 10 * time.Millisecond},
+		{Condition: &helmstate.ConditionCheck{Resource: "deployment/web", Condition: "Available"}, Timeout: 30 * time.Second},
+	}}
+
+	helmRelease, err := executor.UpgradeReleaseContext(context.Background(), release)
+	if err != nil {
+		t.Fatalf("UpgradeReleaseContext failed: %v", err)
+	}
+	if helmRelease == nil || helmRelease.Revision != 3 {
+		t.Errorf("unexpected helm release %+v", helmRelease)
+	}
+	data, _ := os.ReadFile(log)
+	calls := strings.Split(strings.TrimSpace(string(data)), "\n")
+	want := []string{
+		"port-forward --namespace apps svc/web :8080",
+		"exec --namespace apps deploy/web --container app -- pg_isready",
+		"exec --namespace apps deploy/web --container app -- pg_isready",
+		"wait --for condition=Available deployment/web --namespace apps --timeout 30s",
+	}
+	if strings.Join(calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected kubectl calls:\n%s", data)
+	}
+	if len(requests) != 1 || requests[0] != "/healthz" {
+		t.Errorf("unexpected requests %v", requests)
+	}
+
+	// A failing check fails the release, which helm did deploy
+	t.Setenv("WAIT_FAIL", "1")
+	helmRelease, err = executor.UpgradeReleaseContext(context.Background(), release)
+	if err == nil || !strings.Contains(err.Error(), "health check condition Available of deployment/web failed") {
+		t.Fatalf("expected the condition check to fail, got %v", err)
+	}
+	if helmRelease == nil {
+		t.Error("expected the deployed release returned with the error")
+	}
+
+	release.HealthChecks = []helmstate.HealthCheck{{
+		Name:     "api",
+		HTTP:     &helmstate.HTTPCheck{Port: 8080, Path: "/broken"},
+		Timeout:  50 * time.Millisecond,
+		Interval: 10 * time.Millisecond,
+	}}
+	if _, err := executor.UpgradeReleaseContext(context.Background(), release); err == nil || !strings.Contains(err.Error(), "health check api failed: still failing after 50ms: status 503") {
+		t.Errorf("expected the http check to fail, got %v", err)
+	}
+}
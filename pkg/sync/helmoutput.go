@@ -0,0 +1,119 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+)
+
+// HelmRelease is a release as helm reports it after installing or upgrading
+// it with --output json
+type HelmRelease struct {
+	Name         string    `json:"name"`
+	Namespace    string    `json:"namespace,omitempty"`
+	Revision     int       `json:"revision"`
+	Status       string    `json:"status"`
+	Description  string    `json:"description,omitempty"`
+	Chart        string    `json:"chart,omitempty"`
+	ChartVersion string    `json:"chartVersion,omitempty"`
+	AppVersion   string    `json:"appVersion,omitempty"`
+	LastDeployed time.Time `json:"lastDeployed,omitempty"`
+	Notes        string    `json:"notes,omitempty"`
+
+	// Tests are the smoke tests run once the release synced
+	Tests []TestResult `json:"tests,omitempty"`
+}
+
+// helmReleaseJSON is the part of helm's JSON encoding of a release that
+// HelmRelease keeps; the manifest and values are left out
+type helmReleaseJSON struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Version   int    `json:"version"`
+	Info      struct {
+		LastDeployed time.Time `json:"last_deployed"`
+		Description  string    `json:"description"`
+		Status       string    `json:"status"`
+		Notes        string    `json:"notes"`
+	} `json:"info"`
+	Chart struct {
+		Metadata struct {
+			Name       string `json:"name"`
+			Version    string `json:"version"`
+			AppVersion string `json:"appVersion"`
+		} `json:"metadata"`
+	} `json:"chart"`
+}
+
+// parseHelmRelease parses the output of helm install or upgrade with
+// --output json. Output without a release, as from helm versions that
+// ignore --output, yields nil.
+func parseHelmRelease(out string) (*HelmRelease, error) {
+	out = strings.TrimSpace(out)
+	if !strings.HasPrefix(out, "{") {
+		return nil, nil
+	}
+
+	var r helmReleaseJSON
+	if err := json.Unmarshal([]byte(out), &r); err != nil {
+		return nil, fmt.Errorf("failed to parse helm output: %w", err)
+	}
+	return &HelmRelease{
+		Name:         r.Name,
+		Namespace:    r.Namespace,
+		Revision:     r.Version,
+		Status:       r.Info.Status,
+		Description:  r.Info.Description,
+		Chart:        r.Chart.Metadata.Name,
+		ChartVersion: r.Chart.Metadata.Version,
+		AppVersion:   r.Chart.Metadata.AppVersion,
+		LastDeployed: r.Info.LastDeployed,
+		Notes:        strings.TrimSpace(r.Info.Notes),
+	}, nil
+}
+
+// ReleaseNotes returns the rendered NOTES.txt of the deployed revision of a
+// release, as helm get notes prints it
+func (e *Executor) ReleaseNotes(ctx context.Context, release helmstate.Release) (string, error) {
+	args := []string{"get", "notes", release.Name, "--namespace", e.ReleaseNamespace(release)}
+	if kubeContext := e.ReleaseKubeContext(release); kubeContext != "" {
+		args = append(args, "--kube-context", kubeContext)
+	}
+
+	out, err := e.runHelmOutput(ctx, args...)
+	if err != nil {
+		return "", err
+	}
+	return e.redact(strings.TrimSpace(strings.TrimPrefix(out, "NOTES:"))), nil
+}
+
+// RevisionChanged reports whether a revision of a release deployed other
+// manifests than the revision before it, not counting the sync ID stamped
+// on them; a first revision always does
+func (e *Executor) RevisionChanged(ctx context.Context, release helmstate.Release, revision int) (bool, error) {
+	if revision <= 1 {
+		return true, nil
+	}
+	manifest := func(revision int) (string, error) {
+		args := []string{"get", "manifest", release.Name, "--namespace", e.ReleaseNamespace(release), "--revision", strconv.Itoa(revision)}
+		if kubeContext := e.ReleaseKubeContext(release); kubeContext != "" {
+			args = append(args, "--kube-context", kubeContext)
+		}
+		return e.runHelmOutput(ctx, args...)
+	}
+
+	current, err := manifest(revision)
+	if err != nil {
+		return false, err
+	}
+	previous, err := manifest(revision - 1)
+	if err != nil {
+		return false, err
+	}
+	return helmstate.ManifestHash(withoutSyncIDAnnotation(current)) != helmstate.ManifestHash(withoutSyncIDAnnotation(previous)), nil
+}
@@ -0,0 +1,116 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"go.uber.org/zap"
+)
+
+func TestParseHelmRelease(t *testing.T) {
+	out := `{"name":"web","info":{"first_deployed":"2024-01-15T10:00:00Z","last_deployed":"2024-01-15T10:30:00Z","deleted":"","description":"Upgrade complete","status":"deployed","notes":"Visit http://web\n"},"chart":{"metadata":{"name":"nginx","version":"13.2.0","appVersion":"1.25.0"},"values":{}},"manifest":"kind: Deployment\n","version":3,"namespace":"apps"}`
+
+	release, err := parseHelmRelease(out)
+	if err != nil {
+		t.Fatalf("parseHelmRelease failed: %v", err)
+	}
+	want := HelmRelease{
+		Name:         "web",
+		Namespace:    "apps",
+		Revision:     3,
+		Status:       "deployed",
+		Description:  "Upgrade complete",
+		Chart:        "nginx",
+		ChartVersion: "13.2.0",
+		AppVersion:   "1.25.0",
+		LastDeployed: time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC),
+		Notes:        "Visit http://web",
+	}
+	if !reflect.DeepEqual(*release, want) {
+		t.Errorf("expected %+v, got %+v", want, *release)
+	}
+}
+
+func TestParseHelmReleaseWithoutJSON(t *testing.T) {
+	for _, out := range []string{"", "Release \"web\" has been upgraded. Happy Helming!\n"} {
+		release, err := parseHelmRelease(out)
+		if err != nil || release != nil {
+			t.Errorf("expected no release from %q, got %+v, %v", out, release, err)
+		}
+	}
+
+	if _, err := parseHelmRelease(`{"name": `); err == nil {
+		t.Error("expected truncated JSON to fail")
+	}
+}
+
+func TestReleaseNotes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	log := filepath.Join(dir, "args")
+	helm := filepath.Join(dir, "helm")
+	script := `#!/bin/sh
+echo "$@" >> ` + log + `
+printf 'NOTES:\nVisit http://web.apps\n'
+`
+	if err := os.WriteFile(helm, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake helm: %v", err)
+	}
+
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	executor.SetHelmBinary(helm)
+	notes, err := executor.ReleaseNotes(context.Background(), helmstate.Release{Name: "web", Namespace: "apps"})
+	if err != nil {
+		t.Fatalf("ReleaseNotes failed: %v", err)
+	}
+	if notes != "Visit http://web.apps" {
+		t.Errorf("unexpected notes %q", notes)
+	}
+	if args, _ := os.ReadFile(log); string(args) != "get notes web --namespace apps\n" {
+		t.Errorf("unexpected helm args %q", args)
+	}
+}
+
+func TestRevisionChanged(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	// Revisions 1 and 2 differ only by their sync ID, 3 by its replicas
+	dir := t.TempDir()
+	helm := filepath.Join(dir, "helm")
+	script := `#!/bin/sh
+case "$*" in
+*"--revision 1"*) printf 'kind: Deployment\nmetadata:\n  annotations:\n    helmfire.dev/sync-id: a\nspec:\n  replicas: 1\n' ;;
+*"--revision 2"*) printf 'kind: Deployment\nmetadata:\n  annotations:\n    helmfire.dev/sync-id: b\nspec:\n  replicas: 1\n' ;;
+*"--revision 3"*) printf 'kind: Deployment\nmetadata:\n  annotations:\n    helmfire.dev/sync-id: c\nspec:\n  replicas: 2\n' ;;
+*) exit 1 ;;
+esac
+`
+	if err := os.WriteFile(helm, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake helm: %v", err)
+	}
+
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	executor.SetHelmBinary(helm)
+	release := helmstate.Release{Name: "web", Namespace: "apps"}
+	for revision, want := range map[int]bool{1: true, 2: false, 3: true} {
+		changed, err := executor.RevisionChanged(context.Background(), release, revision)
+		if err != nil {
+			t.Fatalf("RevisionChanged(%d) failed: %v", revision, err)
+		}
+		if changed != want {
+			t.Errorf("expected revision %d changed %v, got %v", revision, want, changed)
+		}
+	}
+}
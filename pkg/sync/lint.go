@@ -0,0 +1,358 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"go.uber.org/zap"
+)
+
+// Severity ranks lint findings
+type Severity string
+
+const (
+	SeverityInfo    Severity = "info"
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+)
+
+var severityRank = map[Severity]int{SeverityInfo: 0, SeverityWarning: 1, SeverityError: 2}
+
+// ParseSeverity parses info, warning or error
+func ParseSeverity(s string) (Severity, error) {
+	severity := Severity(strings.ToLower(s))
+	if _, ok := severityRank[severity]; !ok {
+		return "", fmt.Errorf("invalid severity %q: must be info, warning or error", s)
+	}
+	return severity, nil
+}
+
+// AtLeast reports whether s is as severe as min
+func (s Severity) AtLeast(min Severity) bool {
+	return severityRank[s] >= severityRank[min]
+}
+
+// Manifest validators run on rendered manifests
+const (
+	ValidatorKubeconform = "kubeconform"
+	ValidatorKubeval     = "kubeval"
+)
+
+// LintOptions configures how releases are linted
+type LintOptions struct {
+	// Validator validates the rendered manifests when set to
+	// ValidatorKubeconform or ValidatorKubeval
+	Validator string
+	// ValidatorBinary is the validator executable (default: Validator)
+	ValidatorBinary string
+	// ValidatorArgs are passed to the validator, e.g. the Kubernetes version
+	ValidatorArgs []string
+	// MinSeverity drops less severe findings (default: info)
+	MinSeverity Severity
+}
+
+// LintFinding is a problem found in a release's chart or manifests
+type LintFinding struct {
+	Source   string   `json:"source"`
+	Severity Severity `json:"severity"`
+	Resource string   `json:"resource,omitempty"`
+	Message  string   `json:"message"`
+}
+
+// LintResult holds the findings for one release. Error is set when the
+// release couldn't be linted at all.
+type LintResult struct {
+	Release   string        `json:"release"`
+	Namespace string        `json:"namespace"`
+	Chart     string        `json:"chart"`
+	Findings  []LintFinding `json:"findings"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// Failed reports whether the release couldn't be linted or has errors
+func (r LintResult) Failed() bool {
+	if r.Error != "" {
+		return true
+	}
+	for _, finding := range r.Findings {
+		if finding.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Lint lints each release, continuing past failures
+func (e *Executor) Lint(ctx context.Context, releases []helmstate.Release, opts LintOptions) []LintResult {
+	results := make([]LintResult, 0, len(releases))
+	for _, release := range releases {
+		results = append(results, e.LintRelease(ctx, release, opts))
+	}
+	return results
+}
+
+// LintRelease runs helm lint on the release's chart with its values and
+// substitutions applied, then the validator of opts and the policies set
+// with SetPolicy on the manifests the release renders to
+func (e *Executor) LintRelease(ctx context.Context, release helmstate.Release, opts LintOptions) LintResult {
+	chart, namespace, err := e.resolveRelease(ctx, release)
+	result := LintResult{Release: release.Name, Namespace: namespace, Chart: chart, Findings: []LintFinding{}}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	e.logger.Info("linting release",
+		zap.String("name", release.Name),
+		zap.String("namespace", namespace),
+		zap.String("chart", chart))
+
+	findings, err := e.helmLint(ctx, release, chart, namespace)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if opts.Validator != "" || e.policy.Enabled() {
+		checked, err := e.checkManifests(ctx, release, chart, namespace, opts)
+		if err != nil {
+			result.Error = err.Error()
+		}
+		findings = append(findings, checked...)
+	}
+
+	minSeverity := opts.MinSeverity
+	if minSeverity == "" {
+		minSeverity = SeverityInfo
+	}
+	for _, finding := range findings {
+		if finding.Severity.AtLeast(minSeverity) {
+			result.Findings = append(result.Findings, finding)
+		}
+	}
+	return result
+}
+
+// helmLint runs helm lint on chart, pulling it first when it isn't local
+func (e *Executor) helmLint(ctx context.Context, release helmstate.Release, chart, namespace string) ([]LintFinding, error) {
+	if _, err := os.Stat(chart); err != nil {
+		dir, err := os.MkdirTemp("", "helmfire-lint-*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create chart directory: %w", err)
+		}
+		defer os.RemoveAll(dir)
+
+		if chart, err = e.pullChart(ctx, chart, release.Version, dir); err != nil {
+			return nil, err
+		}
+	}
+
+	release, cleanupSecrets, err := e.withSecrets(ctx, release)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanupSecrets()
+
+	args := append([]string{"lint", chart, "--namespace", namespace}, valuesArgs(release)...)
+	stdout, stderr, err := e.runTool(ctx, e.helmBinary, nil, nil, args...)
+	findings := parseHelmLint(stdout)
+	if err != nil && len(findings) == 0 {
+		return nil, fmt.Errorf("helm lint failed: %w\nstderr: %s", err, stderr)
+	}
+	return findings, nil
+}
+
+// pullChart downloads and unpacks chart into dir, returning its path
+func (e *Executor) pullChart(ctx context.Context, chart, version, dir string) (string, error) {
+	args := []string{"pull", chart, "--untar", "--untardir", dir}
+	if version != "" {
+		args = append(args, "--version", version)
+	}
+	if _, stderr, err := e.runTool(ctx, e.helmBinary, nil, nil, args...); err != nil {
+		return "", fmt.Errorf("failed to pull chart %s: %w\nstderr: %s", chart, err, stderr)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read pulled chart: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			return filepath.Join(dir, entry.Name()), nil
+		}
+	}
+	return "", fmt.Errorf("failed to pull chart %s: nothing unpacked", chart)
+}
+
+var helmLintLine = regexp.MustCompile(`^\[(INFO|WARNING|ERROR)\]\s+(.*)$`)
+
+// parseHelmLint extracts the findings from helm lint output
+func parseHelmLint(out string) []LintFinding {
+	var findings []LintFinding
+	for _, line := range strings.Split(out, "\n") {
+		match := helmLintLine.FindStringSubmatch(strings.TrimSpace(line))
+		if match == nil {
+			continue
+		}
+		findings = append(findings, LintFinding{
+			Source:   "helm lint",
+			Severity: Severity(strings.ToLower(match[1])),
+			Message:  match[2],
+		})
+	}
+	return findings
+}
+
+// checkManifests renders the release as a sync would and checks the result
+// with the validator of opts and the policies
+func (e *Executor) checkManifests(ctx context.Context, release helmstate.Release, chart, namespace string, opts LintOptions) ([]LintFinding, error) {
+	manifests, err := e.renderManifests(ctx, release, chart, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []LintFinding
+	if opts.Validator != "" {
+		validated, err := e.validateManifests(ctx, manifests, opts)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, validated...)
+	}
+
+	if e.policy.Enabled() {
+		result, err := e.policy.Check(ctx, manifests)
+		if err != nil {
+			return findings, fmt.Errorf("failed to check policies: %w", err)
+		}
+		denySeverity := SeverityError
+		if !result.Blocked(e.policy.Mode) {
+			denySeverity = SeverityWarning
+		}
+		for _, v := range result.Denied {
+			findings = append(findings, LintFinding{Source: "policy", Severity: denySeverity, Resource: v.Resource, Message: v.Message})
+		}
+		for _, v := range result.Warnings {
+			findings = append(findings, LintFinding{Source: "policy", Severity: SeverityWarning, Resource: v.Resource, Message: v.Message})
+		}
+	}
+	return findings, nil
+}
+
+// validateManifests runs the validator of opts on rendered manifests
+func (e *Executor) validateManifests(ctx context.Context, manifests string, opts LintOptions) ([]LintFinding, error) {
+	binary := opts.ValidatorBinary
+	if binary == "" {
+		binary = opts.Validator
+	}
+	var validatorArgs []string
+	var parse func(string) ([]LintFinding, error)
+	switch opts.Validator {
+	case ValidatorKubeconform:
+		validatorArgs, parse = []string{"-output", "json"}, parseKubeconform
+	case ValidatorKubeval:
+		validatorArgs, parse = []string{"--output", "json"}, parseKubeval
+	default:
+		return nil, fmt.Errorf("unknown validator %q: must be %s or %s", opts.Validator, ValidatorKubeconform, ValidatorKubeval)
+	}
+
+	// Validators exit non-zero when manifests are invalid; their output
+	// tells whether they ran at all
+	stdout, stderr, runErr := e.runTool(ctx, binary, strings.NewReader(manifests), nil, append(validatorArgs, opts.ValidatorArgs...)...)
+	findings, err := parse(stdout)
+	if err != nil {
+		if runErr != nil {
+			return nil, fmt.Errorf("%s failed: %w\nstderr: %s", opts.Validator, runErr, stderr)
+		}
+		return nil, fmt.Errorf("failed to parse %s output: %w", opts.Validator, err)
+	}
+	return findings, nil
+}
+
+// parseKubeconform extracts the invalid resources from kubeconform's JSON output
+func parseKubeconform(out string) ([]LintFinding, error) {
+	var output struct {
+		Resources []struct {
+			Kind    string `json:"kind"`
+			Name    string `json:"name"`
+			Status  string `json:"status"`
+			Message string `json:"msg"`
+		} `json:"resources"`
+	}
+	if err := json.Unmarshal([]byte(out), &output); err != nil {
+		return nil, err
+	}
+
+	var findings []LintFinding
+	for _, r := range output.Resources {
+		if r.Status != "statusInvalid" && r.Status != "statusError" {
+			continue
+		}
+		resource := r.Kind
+		if r.Name != "" {
+			resource += "/" + r.Name
+		}
+		findings = append(findings, LintFinding{
+			Source:   ValidatorKubeconform,
+			Severity: SeverityError,
+			Resource: resource,
+			Message:  r.Message,
+		})
+	}
+	return findings, nil
+}
+
+// parseKubeval extracts the invalid resources from kubeval's JSON output
+func parseKubeval(out string) ([]LintFinding, error) {
+	var output []struct {
+		Kind   string   `json:"kind"`
+		Status string   `json:"status"`
+		Errors []string `json:"errors"`
+	}
+	if err := json.Unmarshal([]byte(out), &output); err != nil {
+		return nil, err
+	}
+
+	var findings []LintFinding
+	for _, r := range output {
+		if r.Status != "invalid" {
+			continue
+		}
+		for _, msg := range r.Errors {
+			findings = append(findings, LintFinding{
+				Source:   ValidatorKubeval,
+				Severity: SeverityError,
+				Resource: r.Kind,
+				Message:  msg,
+			})
+		}
+	}
+	return findings, nil
+}
+
+// runTool runs a command with stdin and env added to the environment,
+// returning its stdout and stderr also when it fails
+func (e *Executor) runTool(ctx context.Context, binary string, stdin io.Reader, env []string, args ...string) (string, string, error) {
+	cmd := exec.CommandContext(ctx, binary, args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	cmd.Stdin = stdin
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	e.logger.Debug("executing command", zap.String("binary", binary), zap.Strings("args", e.redactArgs(args)))
+
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
@@ -0,0 +1,166 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"go.uber.org/zap"
+)
+
+func TestParseHelmLint(t *testing.T) {
+	out := `==> Linting ./nginx
+[INFO] Chart.yaml: icon is recommended
+[WARNING] templates/: directory not found
+[ERROR] templates/deployment.yaml: unable to parse YAML
+
+Error: 1 chart(s) linted, 1 chart(s) failed
+`
+	findings := parseHelmLint(out)
+	if len(findings) != 3 {
+		t.Fatalf("expected 3 findings, got %+v", findings)
+	}
+	if findings[0].Severity != SeverityInfo || findings[1].Severity != SeverityWarning || findings[2].Severity != SeverityError {
+		t.Errorf("unexpected severities: %+v", findings)
+	}
+	if findings[2].Message != "templates/deployment.yaml: unable to parse YAML" {
+		t.Errorf("unexpected message: %q", findings[2].Message)
+	}
+}
+
+func TestParseValidators(t *testing.T) {
+	findings, err := parseKubeconform(`{"resources":[
+{"filename":"stdin","kind":"Deployment","name":"web","version":"apps/v1","status":"statusInvalid","msg":"spec.replicas: expected integer"},
+{"filename":"stdin","kind":"Service","name":"web","version":"v1","status":"statusValid","msg":""}]}`)
+	if err != nil {
+		t.Fatalf("parseKubeconform failed: %v", err)
+	}
+	if len(findings) != 1 || findings[0].Resource != "Deployment/web" || findings[0].Severity != SeverityError {
+		t.Errorf("unexpected kubeconform findings: %+v", findings)
+	}
+
+	findings, err = parseKubeval(`[{"filename":"stdin","kind":"Deployment","status":"invalid","errors":["spec.replicas: Invalid type","spec.foo: Additional property"]},
+{"filename":"stdin","kind":"Service","status":"valid","errors":[]}]`)
+	if err != nil {
+		t.Fatalf("parseKubeval failed: %v", err)
+	}
+	if len(findings) != 2 || findings[0].Resource != "Deployment" {
+		t.Errorf("unexpected kubeval findings: %+v", findings)
+	}
+
+	if _, err := parseKubeconform("not json"); err == nil {
+		t.Error("expected an error for invalid output")
+	}
+}
+
+func TestParseSeverity(t *testing.T) {
+	severity, err := ParseSeverity("WARNING")
+	if err != nil || severity != SeverityWarning {
+		t.Errorf("expected warning, got %q (%v)", severity, err)
+	}
+	if _, err := ParseSeverity("fatal"); err == nil {
+		t.Error("expected an error for an unknown severity")
+	}
+	if !SeverityError.AtLeast(SeverityWarning) || SeverityInfo.AtLeast(SeverityWarning) {
+		t.Error("unexpected severity order")
+	}
+}
+
+func TestLintRelease(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	// Fake helm: pull unpacks an empty chart, lint reports an error for
+	// the substituted chart only, template renders a deployment. The fake
+	// kubeconform rejects every resource.
+	dir := t.TempDir()
+	log := filepath.Join(dir, "calls")
+	helm := filepath.Join(dir, "helm")
+	script := `#!/bin/sh
+echo "$@" >> ` + log + `
+case "$1" in
+pull) mkdir -p "$5/nginx" ;;
+lint)
+  echo "==> Linting $2"
+  echo "[INFO] Chart.yaml: icon is recommended"
+  case "$2" in
+  */local) echo "[ERROR] templates/: parse error"; exit 1 ;;
+  esac ;;
+template) printf 'kind: Deployment\nmetadata:\n  name: web\n' ;;
+esac
+`
+	if err := os.WriteFile(helm, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake helm: %v", err)
+	}
+	kubeconform := filepath.Join(dir, "kubeconform")
+	script = `#!/bin/sh
+cat > /dev/null
+echo '{"resources":[{"kind":"Deployment","name":"web","status":"statusInvalid","msg":"replicas: expected integer"}]}'
+exit 1
+`
+	if err := os.WriteFile(kubeconform, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake kubeconform: %v", err)
+	}
+
+	local := filepath.Join(dir, "local")
+	if err := os.Mkdir(local, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(local, "Chart.yaml"), []byte("name: redis\nversion: 1.0.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	substitutor := substitute.NewManager()
+	if err := substitutor.AddChartSubstitution("bitnami/redis", local); err != nil {
+		t.Fatalf("failed to substitute chart: %v", err)
+	}
+
+	executor := NewExecutor(zap.NewNop(), substitutor)
+	executor.SetHelmBinary(helm)
+
+	releases := []helmstate.Release{
+		{Name: "web", Namespace: "web", Chart: "bitnami/nginx", Version: "15.0.0", Values: []interface{}{"values.yaml"}},
+		{Name: "cache", Namespace: "db", Chart: "bitnami/redis"},
+	}
+	results := executor.Lint(context.Background(), releases, LintOptions{
+		Validator:       ValidatorKubeconform,
+		ValidatorBinary: kubeconform,
+		MinSeverity:     SeverityWarning,
+	})
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %+v", results)
+	}
+
+	web := results[0]
+	if web.Error != "" || len(web.Findings) != 1 || web.Findings[0].Source != ValidatorKubeconform || web.Findings[0].Resource != "Deployment/web" {
+		t.Errorf("expected only the kubeconform error for web, got %+v", web)
+	}
+
+	cache := results[1]
+	if cache.Chart != local || !cache.Failed() {
+		t.Errorf("expected the substituted chart to fail, got %+v", cache)
+	}
+	if len(cache.Findings) != 2 || cache.Findings[0].Message != "templates/: parse error" {
+		t.Errorf("expected the helm lint error and the kubeconform error, got %+v", cache.Findings)
+	}
+
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := string(data)
+	if !strings.Contains(calls, "pull bitnami/nginx --untar --untardir ") || !strings.Contains(calls, "--version 15.0.0") {
+		t.Errorf("expected the remote chart to be pulled, got:\n%s", calls)
+	}
+	if !strings.Contains(calls, "/nginx --namespace web -f values.yaml") {
+		t.Errorf("expected the pulled chart to be linted with its values, got:\n%s", calls)
+	}
+	if strings.Contains(calls, "pull bitnami/redis") {
+		t.Errorf("expected the substituted chart not to be pulled, got:\n%s", calls)
+	}
+}
@@ -0,0 +1,113 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/oleksiyp/helmfire/pkg/gitsource"
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"go.uber.org/zap"
+)
+
+// DefaultMirrorDir returns the directory helmfire mirror downloads charts
+// into by default
+func DefaultMirrorDir() string {
+	return filepath.Join(filepath.Dir(gitsource.DefaultCacheRoot()), "mirror")
+}
+
+// MirroredChart reports the chart of a release downloaded into the offline
+// chart directory
+type MirroredChart struct {
+	Release string `json:"release"`
+	Chart   string `json:"chart"`
+	Version string `json:"version,omitempty"` // as the release pins it
+	Archive string `json:"archive,omitempty"`
+	// Cached is set when the archive was in the directory already
+	Cached bool `json:"cached,omitempty"`
+	// Local charts aren't downloaded
+	Local bool   `json:"local,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// SetOfflineCharts makes the executor take remote charts from the archives
+// in dir instead of their repositories, and skip syncing repositories, so
+// that syncs need no network besides the cluster; "" syncs online. Charts
+// missing from dir fail their releases with a *helmstate.ChartNotCachedError.
+func (e *Executor) SetOfflineCharts(dir string) {
+	e.offlineCharts = dir
+}
+
+// MirrorCharts downloads the remote chart of each release into dir, where
+// SetOfflineCharts finds them. Repositories must be synced first. Charts
+// pinned to a version already in dir aren't downloaded again; constraints
+// are resolved by helm to the latest matching version. Downloads that fail
+// are reported in the release's Error.
+func (e *Executor) MirrorCharts(ctx context.Context, releases []helmstate.Release, dir string) []MirroredChart {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		mirrored := make([]MirroredChart, 0, len(releases))
+		for _, release := range releases {
+			mirrored = append(mirrored, MirroredChart{Release: release.Name, Chart: release.Chart, Version: release.Version, Error: err.Error()})
+		}
+		return mirrored
+	}
+
+	type download struct {
+		archive string
+		cached  bool
+		err     error
+	}
+	// Releases often share a chart; download each one once
+	downloads := make(map[string]download)
+
+	mirrored := make([]MirroredChart, 0, len(releases))
+	for _, release := range releases {
+		m := MirroredChart{Release: release.Name, Chart: release.Chart, Version: release.Version}
+		if !helmstate.IsRemoteChart(release.Chart) {
+			m.Local = true
+			mirrored = append(mirrored, m)
+			continue
+		}
+
+		key := release.Chart + "@" + release.Version
+		d, ok := downloads[key]
+		if !ok {
+			d.archive, d.cached, d.err = e.mirrorChart(ctx, release.Chart, release.Version, dir)
+			downloads[key] = d
+		}
+		m.Archive, m.Cached = d.archive, d.cached
+		if d.err != nil {
+			m.Error = d.err.Error()
+		}
+		mirrored = append(mirrored, m)
+	}
+	return mirrored
+}
+
+// mirrorChart downloads a chart into dir unless its exact version is there
+// already, and returns its archive
+func (e *Executor) mirrorChart(ctx context.Context, chart, version, dir string) (string, bool, error) {
+	if substitute.IsVersion(version) {
+		if archive, err := helmstate.OfflineChart(dir, chart, version); err == nil {
+			return archive, true, nil
+		}
+	}
+
+	e.logger.Info("downloading chart", zap.String("chart", chart), zap.String("version", version))
+	args := []string{"pull", chart, "--destination", dir}
+	if version != "" {
+		args = append(args, "--version", version)
+	}
+	if err := e.runHelm(ctx, args...); err != nil {
+		return "", false, fmt.Errorf("failed to download chart %s: %w", chart, err)
+	}
+	archive, err := helmstate.OfflineChart(dir, chart, version)
+	if err != nil {
+		// Archives are named after the chart, which may differ from the
+		// last element of its reference
+		return "", false, fmt.Errorf("chart %s was downloaded, but its archive isn't named after the reference", chart)
+	}
+	return archive, false, nil
+}
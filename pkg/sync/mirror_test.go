@@ -0,0 +1,96 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"go.uber.org/zap"
+)
+
+func TestMirrorCharts(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	// Fake helm pulling nginx 15.4.9 into the destination
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	helm := filepath.Join(dir, "helm")
+	script := `#!/bin/sh
+echo "$@" >> ` + log + `
+touch "$4/nginx-15.4.9.tgz"
+`
+	if err := os.WriteFile(helm, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	mirror := filepath.Join(dir, "mirror")
+	if err := os.MkdirAll(mirror, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(mirror, "redis-18.0.4.tgz"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	executor.SetHelmBinary(helm)
+	mirrored := executor.MirrorCharts(context.Background(), []helmstate.Release{
+		{Name: "web", Chart: "bitnami/nginx", Version: "~15.4"},
+		{Name: "web-canary", Chart: "bitnami/nginx", Version: "~15.4"},
+		{Name: "cache", Chart: "bitnami/redis", Version: "18.0.4"},
+		{Name: "api", Chart: "./charts/api"},
+	}, mirror)
+
+	if len(mirrored) != 4 {
+		t.Fatalf("expected 4 results, got %+v", mirrored)
+	}
+	for _, m := range mirrored[:2] {
+		if m.Error != "" || m.Cached || filepath.Base(m.Archive) != "nginx-15.4.9.tgz" {
+			t.Errorf("expected nginx downloaded, got %+v", m)
+		}
+	}
+	if m := mirrored[2]; !m.Cached || filepath.Base(m.Archive) != "redis-18.0.4.tgz" {
+		t.Errorf("expected redis already mirrored, got %+v", m)
+	}
+	if m := mirrored[3]; !m.Local {
+		t.Errorf("expected the local chart skipped, got %+v", m)
+	}
+
+	data, _ := os.ReadFile(log)
+	if calls := strings.TrimSpace(string(data)); calls != "pull bitnami/nginx --destination "+mirror+" --version ~15.4" {
+		t.Errorf("expected one download of nginx, got %q", calls)
+	}
+}
+
+func TestOfflineExecutor(t *testing.T) {
+	mirror := t.TempDir()
+	if err := os.WriteFile(filepath.Join(mirror, "nginx-15.4.2.tgz"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	executor.SetHelmBinary(filepath.Join(t.TempDir(), "missing-helm"))
+	executor.SetOfflineCharts(mirror)
+
+	repos := []helmstate.Repository{{Name: "bitnami", URL: "https://charts.bitnami.com/bitnami"}}
+	if err := executor.SyncRepositoriesContext(context.Background(), repos); err != nil {
+		t.Errorf("expected repositories skipped offline, got %v", err)
+	}
+
+	chart, _, err := executor.resolveRelease(context.Background(), helmstate.Release{Name: "web", Chart: "bitnami/nginx", Version: "15.4.2"})
+	if err != nil || chart != filepath.Join(mirror, "nginx-15.4.2.tgz") {
+		t.Errorf("expected the mirrored chart, got %s, %v", chart, err)
+	}
+
+	_, _, err = executor.resolveRelease(context.Background(), helmstate.Release{Name: "cache", Chart: "bitnami/redis", Version: "18.0.4"})
+	var notCached *helmstate.ChartNotCachedError
+	if !errors.As(err, &notCached) || !strings.HasPrefix(err.Error(), "release cache: chart bitnami/redis 18.0.4 is not in the offline chart directory") {
+		t.Errorf("expected a missing chart error, got %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"go.uber.org/zap"
+)
+
+// NamespaceLookup returns the helmfile declaration of a namespace
+type NamespaceLookup func(name string) (helmstate.Namespace, bool)
+
+// kubeNamespace is the subset of a core/v1 Namespace helmfire reads and applies
+type kubeNamespace struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   kubeNamespaceMeta `json:"metadata"`
+}
+
+type kubeNamespaceMeta struct {
+	Name        string            `json:"name"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// SetCreateNamespace sets whether release namespaces are created when
+// missing. Releases override it with createNamespace.
+func (e *Executor) SetCreateNamespace(create bool) {
+	e.createNamespace = create
+}
+
+// SetVerifyNamespaces makes syncs fail for releases whose namespace doesn't
+// exist or lacks the labels declared in the helmfile
+func (e *Executor) SetVerifyNamespaces(verify bool) {
+	e.verifyNamespaces = verify
+}
+
+// SetNamespaceLookup sets where namespace declarations come from, usually
+// helmstate.Manager.GetNamespace so reloads are picked up
+func (e *Executor) SetNamespaceLookup(lookup NamespaceLookup) {
+	e.namespaceLookup = lookup
+}
+
+// SetKubectl sets the kubectl binary used to verify and apply namespaces
+func (e *Executor) SetKubectl(binary string) {
+	e.kubectl = binary
+}
+
+// createNamespaceFor reports whether the namespace of release is created
+// when missing
+func (e *Executor) createNamespaceFor(release helmstate.Release) bool {
+	if release.CreateNamespace != nil {
+		return *release.CreateNamespace
+	}
+	return e.createNamespace
+}
+
+// declaredNamespace returns the helmfile declaration of namespace
+func (e *Executor) declaredNamespace(namespace string) (helmstate.Namespace, bool) {
+	if e.namespaceLookup == nil {
+		return helmstate.Namespace{}, false
+	}
+	return e.namespaceLookup(namespace)
+}
+
+// prepareNamespace verifies the release namespace when verification is on,
+// then applies its declared labels and annotations when the release may
+// create it
+func (e *Executor) prepareNamespace(ctx context.Context, release helmstate.Release, namespace string) error {
+	declared, ok := e.declaredNamespace(namespace)
+
+	if e.verifyNamespaces {
+		if err := e.verifyNamespace(ctx, e.ReleaseKubeContext(release), namespace, declared.Labels); err != nil {
+			return err
+		}
+	}
+
+	if !ok || !e.createNamespaceFor(release) || len(declared.Labels)+len(declared.Annotations) == 0 {
+		return nil
+	}
+	if e.dryRun {
+		e.logger.Info("dry run: not applying namespace", zap.String("namespace", namespace))
+		return nil
+	}
+	return e.applyNamespace(ctx, e.ReleaseKubeContext(release), namespace, declared)
+}
+
+// verifyNamespace checks that namespace exists in kubeContext and carries
+// labels
+func (e *Executor) verifyNamespace(ctx context.Context, kubeContext, namespace string, labels map[string]string) error {
+	stdout, stderr, err := e.runTool(ctx, e.kubectl, nil, nil, kubectlArgs(kubeContext, "get", "namespace", namespace, "--output", "json")...)
+	if err != nil {
+		if strings.Contains(stderr, "NotFound") || strings.Contains(stderr, "not found") {
+			return fmt.Errorf("namespace %s does not exist", namespace)
+		}
+		return fmt.Errorf("failed to verify namespace %s: %w\nstderr: %s", namespace, err, stderr)
+	}
+
+	var ns kubeNamespace
+	if err := json.Unmarshal([]byte(stdout), &ns); err != nil {
+		return fmt.Errorf("failed to parse namespace %s: %w", namespace, err)
+	}
+
+	var missing []string
+	for key, value := range labels {
+		if ns.Metadata.Labels[key] != value {
+			missing = append(missing, key+"="+value)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("namespace %s is missing required label(s) %s", namespace, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// applyNamespace creates namespace or updates it with the declared labels
+// and annotations, leaving other keys alone
+func (e *Executor) applyNamespace(ctx context.Context, kubeContext, namespace string, declared helmstate.Namespace) error {
+	e.logger.Info("applying namespace",
+		zap.String("namespace", namespace),
+		zap.Any("labels", declared.Labels),
+		zap.Any("annotations", declared.Annotations))
+
+	manifest, err := json.Marshal(kubeNamespace{
+		APIVersion: "v1",
+		Kind:       "Namespace",
+		Metadata: kubeNamespaceMeta{
+			Name:        namespace,
+			Labels:      declared.Labels,
+			Annotations: declared.Annotations,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode namespace %s: %w", namespace, err)
+	}
+
+	if _, stderr, err := e.runTool(ctx, e.kubectl, strings.NewReader(string(manifest)), nil, kubectlArgs(kubeContext, "apply", "--filename", "-")...); err != nil {
+		return fmt.Errorf("failed to apply namespace %s: %w\nstderr: %s", namespace, err, stderr)
+	}
+	return nil
+}
+
+// DeleteNamespace deletes namespace, without waiting for its resources to
+// be finalized, if it carries labels. It reports whether the namespace was
+// deleted; one that doesn't exist or lacks a label is left alone.
+func (e *Executor) DeleteNamespace(ctx context.Context, namespace string, labels map[string]string) (bool, error) {
+	if err := e.verifyNamespace(ctx, e.kubeContext, namespace, labels); err != nil {
+		e.logger.Info("not deleting namespace", zap.String("namespace", namespace), zap.Error(err))
+		return false, nil
+	}
+	if e.dryRun {
+		e.logger.Info("dry run: not deleting namespace", zap.String("namespace", namespace))
+		return true, nil
+	}
+
+	e.logger.Info("deleting namespace", zap.String("namespace", namespace))
+	if _, stderr, err := e.runTool(ctx, e.kubectl, nil, nil, kubectlArgs(e.kubeContext, "delete", "namespace", namespace, "--wait=false")...); err != nil {
+		return false, fmt.Errorf("failed to delete namespace %s: %w\nstderr: %s", namespace, err, stderr)
+	}
+	return true, nil
+}
+
+// kubectlArgs adds a kubeconfig context to kubectl arguments
+func kubectlArgs(kubeContext string, args ...string) []string {
+	if kubeContext != "" {
+		args = append(args, "--context", kubeContext)
+	}
+	return args
+}
@@ -0,0 +1,125 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"go.uber.org/zap"
+)
+
+func TestUpgradeArgsCreateNamespace(t *testing.T) {
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	release := helmstate.Release{Name: "web", Chart: "bitnami/nginx"}
+
+	if !containsArg(executor.upgradeArgs(release, release.Chart, "web"), "--create-namespace") {
+		t.Error("expected namespaces to be created by default")
+	}
+
+	executor.SetCreateNamespace(false)
+	if containsArg(executor.upgradeArgs(release, release.Chart, "web"), "--create-namespace") {
+		t.Error("expected no --create-namespace when disabled")
+	}
+
+	// The release setting wins over the executor's
+	create := true
+	release.CreateNamespace = &create
+	if !containsArg(executor.upgradeArgs(release, release.Chart, "web"), "--create-namespace") {
+		t.Error("expected the release to override the executor")
+	}
+}
+
+func TestPrepareNamespace(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake kubectl script requires a POSIX shell")
+	}
+
+	// Fake kubectl: apps exists with team=apps, anything else is missing;
+	// applied manifests are logged
+	dir := t.TempDir()
+	applied := filepath.Join(dir, "applied")
+	kubectl := filepath.Join(dir, "kubectl")
+	script := `#!/bin/sh
+case "$1 $3" in
+"get apps") echo '{"apiVersion":"v1","kind":"Namespace","metadata":{"name":"apps","labels":{"team":"apps"}}}' ;;
+"get "*) echo "Error from server (NotFound): namespaces \"$3\" not found" >&2; exit 1 ;;
+"apply "*) cat >> ` + applied + `; echo "$@" >> ` + applied + ` ;;
+esac
+`
+	if err := os.WriteFile(kubectl, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake kubectl: %v", err)
+	}
+
+	declared := map[string]helmstate.Namespace{
+		"apps": {Labels: map[string]string{"team": "apps"}},
+		"db":   {Labels: map[string]string{"team": "db", "tier": "data"}, Annotations: map[string]string{"owner": "dba"}},
+	}
+	lookup := func(name string) (helmstate.Namespace, bool) {
+		ns, ok := declared[name]
+		return ns, ok
+	}
+
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	executor.SetKubectl(kubectl)
+	executor.SetKubeContext("staging")
+	executor.SetNamespaceLookup(lookup)
+	ctx := context.Background()
+
+	// Creation applies the declared labels and annotations
+	if err := executor.prepareNamespace(ctx, helmstate.Release{Name: "pg"}, "db"); err != nil {
+		t.Fatalf("prepareNamespace failed: %v", err)
+	}
+	data, err := os.ReadFile(applied)
+	if err != nil {
+		t.Fatalf("expected db to be applied: %v", err)
+	}
+	got := string(data)
+	want := `{"apiVersion":"v1","kind":"Namespace","metadata":{"name":"db","labels":{"team":"db","tier":"data"},"annotations":{"owner":"dba"}}}apply --filename - --context staging`
+	if strings.TrimSpace(got) != want {
+		t.Errorf("unexpected apply:\n%s\nwant:\n%s", got, want)
+	}
+	os.Remove(applied)
+
+	// Undeclared namespaces and releases that don't create theirs are left to helm
+	create := false
+	if err := executor.prepareNamespace(ctx, helmstate.Release{Name: "pg", CreateNamespace: &create}, "db"); err != nil {
+		t.Fatalf("prepareNamespace failed: %v", err)
+	}
+	if err := executor.prepareNamespace(ctx, helmstate.Release{Name: "web"}, "other"); err != nil {
+		t.Fatalf("prepareNamespace failed: %v", err)
+	}
+	if _, err := os.Stat(applied); err == nil {
+		t.Error("expected nothing to be applied")
+	}
+
+	// Verification requires the namespace and its declared labels
+	executor.SetCreateNamespace(false)
+	executor.SetVerifyNamespaces(true)
+	if err := executor.prepareNamespace(ctx, helmstate.Release{Name: "web"}, "apps"); err != nil {
+		t.Errorf("expected apps to verify, got %v", err)
+	}
+	err = executor.prepareNamespace(ctx, helmstate.Release{Name: "cache"}, "missing")
+	if err == nil || err.Error() != "namespace missing does not exist" {
+		t.Errorf("expected missing namespace error, got %v", err)
+	}
+
+	declared["apps"] = helmstate.Namespace{Labels: map[string]string{"team": "apps", "env": "prod"}}
+	err = executor.prepareNamespace(ctx, helmstate.Release{Name: "web"}, "apps")
+	if err == nil || !strings.Contains(err.Error(), "missing required label(s) env=prod") {
+		t.Errorf("expected missing label error, got %v", err)
+	}
+}
+
+func containsArg(args []string, arg string) bool {
+	for _, a := range args {
+		if a == arg {
+			return true
+		}
+	}
+	return false
+}
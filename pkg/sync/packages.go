@@ -0,0 +1,215 @@
+package sync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/oleksiyp/helmfire/pkg/gitsource"
+	"go.uber.org/zap"
+)
+
+// DefaultChartPackageDir returns the directory substituted local charts are
+// packaged into
+func DefaultChartPackageDir() string {
+	return filepath.Join(filepath.Dir(gitsource.DefaultCacheRoot()), "charts")
+}
+
+// chartPackages keeps the archives substituted local charts are packaged
+// into, one per content hash, so releases sharing a chart and syncs of an
+// unchanged one reuse it
+type chartPackages struct {
+	dir string
+
+	mu       sync.Mutex
+	packages map[string]*chartPackage // content hash -> archive
+	sources  map[string]string        // chart directory -> hash of its latest archive
+}
+
+// chartPackage is a chart packaged once for every release using it
+type chartPackage struct {
+	once sync.Once
+	path string
+	err  error
+}
+
+func newChartPackages(dir string) *chartPackages {
+	return &chartPackages{
+		dir:      dir,
+		packages: make(map[string]*chartPackage),
+		sources:  make(map[string]string),
+	}
+}
+
+// SetChartPackageDir sets the directory substituted local charts are
+// packaged into before upgrades; "" leaves packaging the chart to helm on
+// every upgrade
+func (e *Executor) SetChartPackageDir(dir string) {
+	if dir == "" {
+		e.packages = nil
+		return
+	}
+	e.packages = newChartPackages(dir)
+}
+
+// InvalidateChartPackage removes the archive a local chart directory was
+// packaged into, as when the chart is edited. Archives are looked up by
+// content hash, so an edited chart is packaged again regardless; this frees
+// the stale one right away.
+func (e *Executor) InvalidateChartPackage(chart string) {
+	if e.packages == nil {
+		return
+	}
+	abs, err := filepath.Abs(chart)
+	if err != nil {
+		return
+	}
+
+	p := e.packages
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if hash, ok := p.sources[abs]; ok {
+		delete(p.sources, abs)
+		p.remove(hash)
+	}
+}
+
+// packagedChart returns the archive of the local chart directory chart,
+// packaging it when its content wasn't packaged before. It returns chart
+// itself when it isn't a directory, packaging is disabled or fails; helm
+// then packages the directory and reports its problems.
+func (e *Executor) packagedChart(ctx context.Context, chart string) string {
+	if e.packages == nil {
+		return chart
+	}
+	abs, err := filepath.Abs(chart)
+	if err != nil {
+		return chart
+	}
+	if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+		return chart
+	}
+	hash, err := chartHash(abs)
+	if err != nil {
+		e.logger.Warn("failed to hash local chart", zap.String("chart", chart), zap.Error(err))
+		return chart
+	}
+
+	p := e.packages
+	p.mu.Lock()
+	if previous, ok := p.sources[abs]; ok && previous != hash {
+		p.remove(previous)
+	}
+	p.sources[abs] = hash
+	pkg, ok := p.packages[hash]
+	if !ok {
+		pkg = &chartPackage{}
+		p.packages[hash] = pkg
+	}
+	p.mu.Unlock()
+
+	pkg.once.Do(func() {
+		pkg.path, pkg.err = e.packageChart(ctx, abs, filepath.Join(p.dir, hash))
+	})
+	if pkg.err != nil {
+		e.logger.Warn("failed to package local chart", zap.String("chart", chart), zap.Error(pkg.err))
+		p.mu.Lock()
+		if p.packages[hash] == pkg {
+			delete(p.packages, hash)
+		}
+		p.mu.Unlock()
+		return chart
+	}
+	return pkg.path
+}
+
+// remove drops the archive of hash unless another chart directory has the
+// same content; p.mu must be held
+func (p *chartPackages) remove(hash string) {
+	for _, other := range p.sources {
+		if other == hash {
+			return
+		}
+	}
+	delete(p.packages, hash)
+	os.RemoveAll(filepath.Join(p.dir, hash))
+}
+
+// packageChart packages the chart directory chart into dest, reusing the
+// archive there when another run packaged it already, and returns its path
+func (e *Executor) packageChart(ctx context.Context, chart, dest string) (string, error) {
+	if archive, ok := chartArchive(dest); ok {
+		return archive, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", err
+	}
+	// Package next to dest and move it in place, so that concurrent runs
+	// never see a partial archive
+	tmp, err := os.MkdirTemp(filepath.Dir(dest), ".package-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	if _, err := e.runHelmOutput(ctx, "package", chart, "--destination", tmp); err != nil {
+		return "", err
+	}
+	if _, ok := chartArchive(tmp); !ok {
+		return "", fmt.Errorf("helm package %s left no single archive", chart)
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		// Another run packaged the same content first
+		if archive, ok := chartArchive(dest); ok {
+			return archive, nil
+		}
+		return "", err
+	}
+	archive, _ := chartArchive(dest)
+	return archive, nil
+}
+
+// chartArchive returns the only archive in dir
+func chartArchive(dir string) (string, bool) {
+	archives, _ := filepath.Glob(filepath.Join(dir, "*.tgz"))
+	if len(archives) != 1 {
+		return "", false
+	}
+	return archives[0], true
+}
+
+// chartHash returns a checksum of the files of a chart directory and their
+// paths within it
+func chartHash(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		io.WriteString(h, filepath.ToSlash(rel)+"\x00")
+		if _, err := io.Copy(h, f); err != nil {
+			return err
+		}
+		h.Write([]byte{0})
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
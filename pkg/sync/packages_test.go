@@ -0,0 +1,127 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"go.uber.org/zap"
+)
+
+func TestUpgradePackagesSubstitutedChartOnce(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	// Fake helm packaging charts into the destination and logging its calls
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	helm := filepath.Join(dir, "helm")
+	script := `#!/bin/sh
+echo "$@" >> ` + log + `
+if [ "$1" = package ]; then
+  touch "$4/web-1.0.0.tgz"
+fi
+`
+	if err := os.WriteFile(helm, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	chart := filepath.Join(dir, "web")
+	if err := os.MkdirAll(chart, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeChart := func(version string) {
+		data := "apiVersion: v2\nname: web\nversion: " + version + "\n"
+		if err := os.WriteFile(filepath.Join(chart, "Chart.yaml"), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeChart("1.0.0")
+
+	sub := substitute.NewManager()
+	if err := sub.AddChartSubstitution("bitnami/nginx", chart); err != nil {
+		t.Fatal(err)
+	}
+	packages := filepath.Join(dir, "packages")
+	executor := NewExecutor(zap.NewNop(), sub)
+	executor.SetHelmBinary(helm)
+	executor.SetCreateNamespace(false)
+	executor.SetChartPackageDir(packages)
+
+	upgrade := func(name string) {
+		t.Helper()
+		release := helmstate.Release{Name: name, Namespace: "default", Chart: "bitnami/nginx"}
+		if _, err := executor.UpgradeReleaseContext(context.Background(), release); err != nil {
+			t.Fatalf("UpgradeReleaseContext(%s) failed: %v", name, err)
+		}
+	}
+	calls := func(command string) []string {
+		data, _ := os.ReadFile(log)
+		var found []string
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			if strings.HasPrefix(line, command+" ") {
+				found = append(found, line)
+			}
+		}
+		return found
+	}
+
+	upgrade("web")
+	upgrade("web-canary")
+	if packaged := calls("package"); len(packaged) != 1 {
+		t.Fatalf("expected the shared chart packaged once, got %q", packaged)
+	}
+	first, ok := chartArchive(filepath.Join(packages, mustHash(t, chart)))
+	if !ok {
+		t.Fatal("expected the chart archive in the package directory")
+	}
+	for _, call := range calls("upgrade") {
+		if !strings.Contains(call, " "+first+" ") {
+			t.Errorf("expected upgrade from %s, got %q", first, call)
+		}
+	}
+
+	writeChart("1.0.1")
+	executor.InvalidateChartPackage(chart)
+	if _, err := os.Stat(first); !os.IsNotExist(err) {
+		t.Errorf("expected the stale archive removed, got %v", err)
+	}
+	upgrade("web")
+	if packaged := calls("package"); len(packaged) != 2 {
+		t.Errorf("expected the edited chart packaged again, got %q", packaged)
+	}
+}
+
+func TestPackagedChartFallsBack(t *testing.T) {
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	executor.SetHelmBinary(filepath.Join(t.TempDir(), "missing-helm"))
+	executor.SetChartPackageDir(t.TempDir())
+
+	chart := t.TempDir()
+	if got := executor.packagedChart(context.Background(), chart); got != chart {
+		t.Errorf("expected the directory when packaging fails, got %s", got)
+	}
+	if got := executor.packagedChart(context.Background(), "bitnami/nginx"); got != "bitnami/nginx" {
+		t.Errorf("expected repository charts unchanged, got %s", got)
+	}
+
+	executor.SetChartPackageDir("")
+	if got := executor.packagedChart(context.Background(), chart); got != chart {
+		t.Errorf("expected the directory with packaging disabled, got %s", got)
+	}
+}
+
+func mustHash(t *testing.T, dir string) string {
+	t.Helper()
+	hash, err := chartHash(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
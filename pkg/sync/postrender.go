@@ -0,0 +1,340 @@
+package sync
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+)
+
+// EnvPostRender names the post-render config file when helm runs the
+// helmfire binary as its --post-renderer
+const EnvPostRender = "HELMFIRE_POST_RENDER"
+
+// EnvPostRenderConfig holds the base64-encoded post-render config itself,
+// so most syncs need no config file
+const EnvPostRenderConfig = "HELMFIRE_POST_RENDER_CONFIG"
+
+// EnvSyncID holds the sync ID the post-renderer stamps in AnnotationSyncID.
+// It is kept out of the config so that renders of different syncs share
+// their config, and so their render cache entries.
+const EnvSyncID = "HELMFIRE_SYNC_ID"
+
+const (
+	// maxInlineConfig is the largest encoded config passed in
+	// EnvPostRenderConfig; larger ones, beyond what Windows allows in a
+	// variable, go to a file
+	maxInlineConfig = 16 << 10
+
+	// postRenderFilePattern names config files in the temp directory
+	postRenderFilePattern = "helmfire-post-render-*.json"
+
+	// stalePostRenderFile is how old a config file left behind by a crashed
+	// sync is before it is removed
+	stalePostRenderFile = 24 * time.Hour
+)
+
+// imageLineRegexp matches an image: key in rendered manifests, capturing the
+// prefix, the optionally quoted reference and the rest of the line
+var imageLineRegexp = regexp.MustCompile(`^(\s*(?:-\s+)?image:\s*)(["']?)([^"'\s#]+)(["']?)(.*)$`)
+
+// postRenderSubstitution is an image substitution as written for the
+// post-renderer
+type postRenderSubstitution struct {
+	Original    string `json:"original"`
+	Replacement string `json:"replacement"`
+}
+
+// postRenderConfig is what the post-renderer applies to a release's
+// manifests, as written to the file named by EnvPostRender
+type postRenderConfig struct {
+	Images      []postRenderSubstitution `json:"images,omitempty"`
+	Labels      map[string]string        `json:"labels,omitempty"`
+	Annotations map[string]string        `json:"annotations,omitempty"`
+
+	// PodAnnotations are added to the pod templates of workloads
+	PodAnnotations map[string]string `json:"podAnnotations,omitempty"`
+
+	// MarkImages annotates resources whose images were substituted with
+	// AnnotationSubstitutedImages
+	MarkImages bool `json:"markImages,omitempty"`
+
+	// Resources scales down the resources and replicas of workloads
+	Resources *ResourceProfile `json:"resources,omitempty"`
+
+	// SyncID annotates resources with AnnotationSyncID, set to syncID,
+	// the value of EnvSyncID
+	SyncID bool `json:"syncId,omitempty"`
+	syncID string
+}
+
+func (c postRenderConfig) stamps() bool {
+	return len(c.Labels) > 0 || len(c.Annotations) > 0 || len(c.PodAnnotations) > 0 || c.MarkImages || c.SyncID
+}
+
+// RenderImages replaces the image references of substitutions in rendered
+// manifests read from in, writing the result to out. Only whole references
+// are replaced, so nginx:1.21 doesn't match nginx:1.21-alpine.
+func RenderImages(in io.Reader, out io.Writer, substitutions map[string]string) error {
+	images := make([]postRenderSubstitution, 0, len(substitutions))
+	for original, replacement := range substitutions {
+		images = append(images, postRenderSubstitution{Original: original, Replacement: replacement})
+	}
+	return postRender(in, out, postRenderConfig{Images: images})
+}
+
+// postRender applies config to the manifests read from in, writing the
+// result to out. Image references are replaced line by line, preserving the
+// manifests as rendered; only stamping and scaling re-encode a resource.
+func postRender(in io.Reader, out io.Writer, config postRenderConfig) error {
+	substitutions := make(map[string]string, len(config.Images))
+	for _, sub := range config.Images {
+		substitutions[sub.Original] = sub.Replacement
+	}
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	w := bufio.NewWriter(out)
+
+	var doc bytes.Buffer
+	replaced := make(map[string]bool)
+	flush := func() error {
+		if doc.Len() == 0 {
+			return nil
+		}
+		data := doc.Bytes()
+		if config.Resources != nil {
+			scaled, err := scaleDocument(data, *config.Resources)
+			if err != nil {
+				return fmt.Errorf("failed to scale manifest: %w", err)
+			}
+			data = scaled
+		}
+		if config.stamps() {
+			annotations := config.Annotations
+			if config.SyncID {
+				annotations = withAnnotation(annotations, AnnotationSyncID, config.syncID)
+			}
+			if config.MarkImages && len(replaced) > 0 {
+				annotations = withSubstitutedImages(annotations, replaced, substitutions)
+			}
+			stamped, err := stampDocument(data, config.Labels, annotations, config.PodAnnotations)
+			if err != nil {
+				return fmt.Errorf("failed to stamp manifest: %w", err)
+			}
+			data = stamped
+		}
+		w.Write(data)
+		doc.Reset()
+		clear(replaced)
+		return nil
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "---" || strings.HasPrefix(line, "--- ") {
+			if err := flush(); err != nil {
+				return err
+			}
+			w.WriteString(line)
+			w.WriteByte('\n')
+			continue
+		}
+		if m := imageLineRegexp.FindStringSubmatch(line); m != nil {
+			if replacement, ok := substitutions[m[3]]; ok {
+				line = m[1] + m[2] + replacement + m[4] + m[5]
+				replaced[m[3]] = true
+			}
+		}
+		doc.WriteString(line)
+		doc.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// withAnnotation returns a copy of annotations with key set to value
+func withAnnotation(annotations map[string]string, key, value string) map[string]string {
+	result := make(map[string]string, len(annotations)+1)
+	for k, v := range annotations {
+		result[k] = v
+	}
+	result[key] = value
+	return result
+}
+
+// withSubstitutedImages returns annotations plus AnnotationSubstitutedImages
+// listing the replaced images as original=replacement
+func withSubstitutedImages(annotations map[string]string, replaced map[string]bool, substitutions map[string]string) map[string]string {
+	marks := make([]string, 0, len(replaced))
+	for original := range replaced {
+		marks = append(marks, original+"="+substitutions[original])
+	}
+	sort.Strings(marks)
+
+	result := make(map[string]string, len(annotations)+1)
+	for k, v := range annotations {
+		result[k] = v
+	}
+	result[AnnotationSubstitutedImages] = strings.Join(marks, ",")
+	return result
+}
+
+// PostRenderRequested reports whether helm started this process as the
+// post-renderer
+func PostRenderRequested() bool {
+	return os.Getenv(EnvPostRenderConfig) != "" || os.Getenv(EnvPostRender) != ""
+}
+
+// RunPostRendererFromEnv applies the post-render config helm passed in
+// EnvPostRenderConfig or EnvPostRender to the manifests read from in
+func RunPostRendererFromEnv(in io.Reader, out io.Writer) error {
+	encoded := os.Getenv(EnvPostRenderConfig)
+	if encoded == "" {
+		return RunPostRenderer(in, out, os.Getenv(EnvPostRender))
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("failed to decode post-render config: %w", err)
+	}
+	return runPostRenderConfig(in, out, data)
+}
+
+// RunPostRenderer applies the post-render config in file to the manifests
+// read from in. helmfire runs it when started by helm with EnvPostRender set.
+func RunPostRenderer(in io.Reader, out io.Writer, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read post-render config: %w", err)
+	}
+	return runPostRenderConfig(in, out, data)
+}
+
+// runPostRenderConfig applies the encoded post-render config data
+func runPostRenderConfig(in io.Reader, out io.Writer, data []byte) error {
+	var err error
+
+	var config postRenderConfig
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		// Written by an older helmfire: only image substitutions
+		err = json.Unmarshal(data, &config.Images)
+	} else {
+		err = json.Unmarshal(data, &config)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse post-render config: %w", err)
+	}
+	config.syncID = os.Getenv(EnvSyncID)
+	return postRender(in, out, config)
+}
+
+// postRenderEnv returns the environment passing the image substitutions,
+// stamp and resources profile for a release to the post-renderer, and the
+// sync ID in EnvSyncID. Configs too large for a variable are written to a
+// temporary file, which cleanup removes.
+func postRenderEnv(substitutions []substitute.ImageSubstitution, stamp Stamp, resources *ResourceProfile, release, syncID string) (env []string, cleanup func(), err error) {
+	config := newPostRenderConfig(substitutions, stamp, release, syncID)
+	config.Resources = resources
+	if stamp.Managed {
+		delete(config.Annotations, AnnotationSyncID)
+		config.SyncID = true
+		env = append(env, EnvSyncID+"="+syncID)
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	if encoded := base64.StdEncoding.EncodeToString(data); len(encoded) <= maxInlineConfig {
+		return append(env, EnvPostRenderConfig+"="+encoded), func() {}, nil
+	}
+
+	removeStalePostRenderFiles(time.Now())
+	file, err := writePostRenderFile(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(env, EnvPostRender+"="+file), func() { os.Remove(file) }, nil
+}
+
+// withoutSyncID returns post-render env without EnvSyncID, which doesn't
+// change what a release renders to but the sync ID stamped on it
+func withoutSyncID(env []string) []string {
+	var result []string
+	for _, entry := range env {
+		if !strings.HasPrefix(entry, EnvSyncID+"=") {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// removeStalePostRenderFiles removes config files that syncs which
+// crashed before cleaning up left in the temp directory
+func removeStalePostRenderFiles(now time.Time) {
+	files, _ := filepath.Glob(filepath.Join(os.TempDir(), postRenderFilePattern))
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil && now.Sub(info.ModTime()) > stalePostRenderFile {
+			os.Remove(file)
+		}
+	}
+}
+
+// writePostRenderConfig writes the image substitutions and stamp for a
+// release to a new temporary file for the post-renderer and returns its path
+func writePostRenderConfig(substitutions []substitute.ImageSubstitution, stamp Stamp, release, syncID string) (string, error) {
+	data, err := json.Marshal(newPostRenderConfig(substitutions, stamp, release, syncID))
+	if err != nil {
+		return "", err
+	}
+	return writePostRenderFile(data)
+}
+
+// newPostRenderConfig returns the post-render config of the image
+// substitutions and stamp for a release
+func newPostRenderConfig(substitutions []substitute.ImageSubstitution, stamp Stamp, release, syncID string) postRenderConfig {
+	config := postRenderConfig{MarkImages: stamp.Managed}
+	for _, sub := range substitutions {
+		config.Images = append(config.Images, postRenderSubstitution{Original: sub.Original, Replacement: sub.Replacement})
+	}
+	if stamp.Enabled() {
+		config.Labels, config.Annotations = stamp.releaseStamp(release, syncID)
+	}
+	if stamp.RestartOnSubstitution && len(substitutions) > 0 {
+		config.PodAnnotations = map[string]string{AnnotationSubstitutionsChecksum: substitutionsChecksum(substitutions)}
+	}
+	return config
+}
+
+// writePostRenderFile writes an encoded post-render config to a new
+// temporary file and returns its path
+func writePostRenderFile(data []byte) (string, error) {
+	f, err := os.CreateTemp("", postRenderFilePattern)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
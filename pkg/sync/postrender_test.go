@@ -0,0 +1,325 @@
+package sync
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+)
+
+func TestRenderImages(t *testing.T) {
+	substitutions := map[string]string{
+		"nginx:1.21":     "localhost:5000/nginx:dev",
+		"docker.io/a/b":  "local/b:test",
+		"redis@sha256:1": "local/redis:dev",
+	}
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "plain", in: "image: nginx:1.21", want: "image: localhost:5000/nginx:dev"},
+		{name: "list item", in: "  - image: nginx:1.21", want: "  - image: localhost:5000/nginx:dev"},
+		{name: "double quoted", in: `    image: "nginx:1.21"`, want: `    image: "localhost:5000/nginx:dev"`},
+		{name: "single quoted with comment", in: "image: 'docker.io/a/b' # app", want: "image: 'local/b:test' # app"},
+		{name: "digest", in: "image: redis@sha256:1", want: "image: local/redis:dev"},
+		{name: "longer tag untouched", in: "image: nginx:1.21-alpine", want: "image: nginx:1.21-alpine"},
+		{name: "other keys untouched", in: "name: nginx:1.21", want: "name: nginx:1.21"},
+		{name: "unknown image", in: "image: postgres:15", want: "image: postgres:15"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := RenderImages(strings.NewReader(tt.in+"\n"), &out, substitutions); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSuffix(out.String(), "\n"); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunPostRendererMissingFile(t *testing.T) {
+	var out bytes.Buffer
+	if err := RunPostRenderer(strings.NewReader("image: nginx\n"), &out, "/nonexistent/images.json"); err == nil {
+		t.Error("expected an error for a missing substitutions file")
+	}
+}
+
+func TestPostRenderStamp(t *testing.T) {
+	manifests := `---
+# Source: web/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels:
+    app: web
+spec:
+  template:
+    spec:
+      containers:
+      - image: nginx:1.21
+---
+# Source: web/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+---
+# Source: web/templates/empty.yaml
+`
+
+	stamp := Stamp{Managed: true, Labels: map[string]string{"team": "web"}}
+	labels, annotations := stamp.releaseStamp("web", "sync-1")
+	config := postRenderConfig{
+		Images:      []postRenderSubstitution{{Original: "nginx:1.21", Replacement: "nginx:dev"}},
+		Labels:      labels,
+		Annotations: annotations,
+		MarkImages:  true,
+	}
+
+	var out bytes.Buffer
+	if err := postRender(strings.NewReader(manifests), &out, config); err != nil {
+		t.Fatalf("postRender failed: %v", err)
+	}
+
+	docs := strings.Split(out.String(), "---\n")
+	if len(docs) != 4 {
+		t.Fatalf("expected 3 documents, got %q", out.String())
+	}
+	deployment, service, empty := docs[1], docs[2], docs[3]
+
+	for _, want := range []string{
+		"# Source: web/templates/deployment.yaml",
+		"app: web",
+		`helmfire.dev/managed: "true"`,
+		"helmfire.dev/release: web",
+		"team: web",
+		"helmfire.dev/sync-id: sync-1",
+		"helmfire.dev/substituted-images: nginx:1.21=nginx:dev",
+		"- image: nginx:dev",
+	} {
+		if !strings.Contains(deployment, want) {
+			t.Errorf("expected %q in deployment:\n%s", want, deployment)
+		}
+	}
+	if !strings.Contains(service, `helmfire.dev/managed: "true"`) || strings.Contains(service, AnnotationSubstitutedImages) {
+		t.Errorf("expected service stamped without image marker:\n%s", service)
+	}
+	if empty != "# Source: web/templates/empty.yaml\n" {
+		t.Errorf("expected empty document unchanged, got %q", empty)
+	}
+}
+
+func TestPostRenderRestartOnSubstitution(t *testing.T) {
+	manifests := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    metadata:
+      labels:
+        app: web
+    spec:
+      containers:
+      - image: nginx:1.21
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+`
+	substitutions := []substitute.ImageSubstitution{
+		{Original: "nginx:1.21", Replacement: "nginx:dev"},
+		{Original: "redis:7", Replacement: "redis:dev"},
+	}
+	file, err := writePostRenderConfig(substitutions, Stamp{RestartOnSubstitution: true}, "web", "sync-1")
+	if err != nil {
+		t.Fatalf("writePostRenderConfig failed: %v", err)
+	}
+	defer os.Remove(file)
+
+	var out bytes.Buffer
+	if err := RunPostRenderer(strings.NewReader(manifests), &out, file); err != nil {
+		t.Fatalf("RunPostRenderer failed: %v", err)
+	}
+	docs := strings.Split(out.String(), "---\n")
+	deployment, service := docs[0], docs[1]
+
+	checksum := substitutionsChecksum(substitutions)
+	want := "    metadata:\n      labels:\n        app: web\n      annotations:\n        " + AnnotationSubstitutionsChecksum + ": " + checksum + "\n"
+	if !strings.Contains(deployment, want) {
+		t.Errorf("expected the checksum on the pod template:\n%s", deployment)
+	}
+	if strings.Contains(service, AnnotationSubstitutionsChecksum) || strings.Contains(deployment, "helmfire.dev/managed") {
+		t.Errorf("expected only the pod template annotated:\n%s", out.String())
+	}
+
+	// The checksum follows the substitutions, not their order
+	if substitutionsChecksum([]substitute.ImageSubstitution{substitutions[1], substitutions[0]}) != checksum {
+		t.Error("expected the checksum to ignore order")
+	}
+	if substitutionsChecksum(substitutions[:1]) == checksum {
+		t.Error("expected the checksum to change with the substitutions")
+	}
+}
+
+func TestRunPostRendererLegacyConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "images.json")
+	if err := os.WriteFile(file, []byte(`[{"original":"nginx:1.21","replacement":"nginx:dev"}]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := RunPostRenderer(strings.NewReader("image: nginx:1.21\n"), &out, file); err != nil {
+		t.Fatalf("RunPostRenderer failed: %v", err)
+	}
+	if out.String() != "image: nginx:dev\n" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+func TestPostRenderEnvInline(t *testing.T) {
+	substitutions := []substitute.ImageSubstitution{{Original: "nginx:1.21", Replacement: "nginx:dev"}}
+	env, cleanup, err := postRenderEnv(substitutions, Stamp{}, nil, "web", "sync-1")
+	if err != nil {
+		t.Fatalf("postRenderEnv failed: %v", err)
+	}
+	defer cleanup()
+
+	name, value, _ := strings.Cut(env[0], "=")
+	if len(env) != 1 || name != EnvPostRenderConfig {
+		t.Fatalf("expected the config inline, got %v", env)
+	}
+	t.Setenv(EnvPostRenderConfig, value)
+	t.Setenv(EnvPostRender, "")
+	if !PostRenderRequested() {
+		t.Error("expected the post-renderer to be requested")
+	}
+
+	var out bytes.Buffer
+	if err := RunPostRendererFromEnv(strings.NewReader("image: nginx:1.21\n"), &out); err != nil {
+		t.Fatalf("RunPostRendererFromEnv failed: %v", err)
+	}
+	if out.String() != "image: nginx:dev\n" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+func TestPostRenderEnvSyncID(t *testing.T) {
+	render := func(syncID string) []string {
+		env, cleanup, err := postRenderEnv(nil, Stamp{Managed: true}, nil, "web", syncID)
+		if err != nil {
+			t.Fatalf("postRenderEnv failed: %v", err)
+		}
+		defer cleanup()
+		return env
+	}
+
+	first, second := render("sync-1"), render("sync-2")
+	if strings.Join(withoutSyncID(first), " ") != strings.Join(withoutSyncID(second), " ") {
+		t.Errorf("expected syncs to share the config, got %v and %v", first, second)
+	}
+
+	t.Setenv(EnvPostRender, "")
+	for _, entry := range first {
+		name, value, _ := strings.Cut(entry, "=")
+		t.Setenv(name, value)
+	}
+	var out bytes.Buffer
+	if err := RunPostRendererFromEnv(strings.NewReader("kind: Service\nmetadata:\n  name: web\n"), &out); err != nil {
+		t.Fatalf("RunPostRendererFromEnv failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "helmfire.dev/sync-id: sync-1") {
+		t.Errorf("expected the sync ID stamped, got %q", out.String())
+	}
+}
+
+func TestPostRenderEnvLargeConfigUsesFile(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	t.Setenv("TMP", tmp)
+
+	var substitutions []substitute.ImageSubstitution
+	for i := 0; len(substitutions)*60 < maxInlineConfig; i++ {
+		substitutions = append(substitutions, substitute.ImageSubstitution{
+			Original:    fmt.Sprintf("registry.example.com/team/service-%d:1.0.0", i),
+			Replacement: fmt.Sprintf("localhost:5000/service-%d:dev", i),
+		})
+	}
+	env, cleanup, err := postRenderEnv(substitutions, Stamp{}, nil, "web", "sync-1")
+	if err != nil {
+		t.Fatalf("postRenderEnv failed: %v", err)
+	}
+
+	name, file, _ := strings.Cut(env[0], "=")
+	if name != EnvPostRender || filepath.Dir(file) != tmp {
+		t.Fatalf("expected a config file in %s, got %v", tmp, env)
+	}
+	t.Setenv(EnvPostRenderConfig, "")
+	t.Setenv(EnvPostRender, file)
+	var out bytes.Buffer
+	if err := RunPostRendererFromEnv(strings.NewReader("image: registry.example.com/team/service-3:1.0.0\n"), &out); err != nil {
+		t.Fatalf("RunPostRendererFromEnv failed: %v", err)
+	}
+	if out.String() != "image: localhost:5000/service-3:dev\n" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+
+	cleanup()
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("expected cleanup to remove %s", file)
+	}
+}
+
+func TestRemoveStalePostRenderFiles(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	t.Setenv("TMP", tmp)
+
+	stale, err := writePostRenderFile([]byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := writePostRenderFile([]byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(tmp, "other.json")
+	if err := os.WriteFile(other, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * stalePostRenderFile)
+	for _, file := range []string{stale, other} {
+		if err := os.Chtimes(file, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removeStalePostRenderFiles(time.Now())
+	for file, kept := range map[string]bool{stale: false, fresh: true, other: true} {
+		if _, err := os.Stat(file); (err == nil) != kept {
+			t.Errorf("expected %s kept=%t, stat error %v", file, kept, err)
+		}
+	}
+}
+
+func TestParseStampValues(t *testing.T) {
+	values, err := ParseStampValues([]string{"team=web", "empty="})
+	if err != nil || values["team"] != "web" || values["empty"] != "" || len(values) != 2 {
+		t.Errorf("unexpected values %v, %v", values, err)
+	}
+	if _, err := ParseStampValues([]string{"team"}); err == nil {
+		t.Error("expected an error without =")
+	}
+}
@@ -0,0 +1,301 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"go.uber.org/zap"
+)
+
+// DefaultProgressInterval is how often workloads are polled while helm waits
+// for a release to become ready
+const DefaultProgressInterval = 2 * time.Second
+
+// releaseNameAnnotation is set by helm on every resource of a release
+const releaseNameAnnotation = "meta.helm.sh/release-name"
+
+// RolloutStatus is the readiness of one workload of a release
+type RolloutStatus struct {
+	Resource string `json:"resource"` // Kind/name
+	Ready    bool   `json:"ready"`
+	Message  string `json:"message"`
+}
+
+// Progress reports a change in the rollout status of a workload while helm
+// waits for a release
+type Progress struct {
+	Release   string    `json:"release"`
+	Namespace string    `json:"namespace"`
+	Time      time.Time `json:"time"`
+	RolloutStatus
+}
+
+// ProgressFunc receives rollout progress. It is called from the goroutine
+// watching the release and must not block.
+type ProgressFunc func(Progress)
+
+// SetProgress sets where rollout progress of releases with wait: true is
+// reported. Workloads are only watched while fn is set.
+func (e *Executor) SetProgress(fn ProgressFunc) {
+	e.progress = fn
+}
+
+// SetProgressInterval sets how often workloads are polled for progress
+func (e *Executor) SetProgressInterval(interval time.Duration) {
+	e.progressInterval = interval
+}
+
+// rolloutWatcher polls the Deployments, StatefulSets and Jobs of a release
+// and reports their status changes
+type rolloutWatcher struct {
+	executor    *Executor
+	release     string
+	namespace   string
+	kubeContext string
+
+	mu     sync.Mutex
+	status map[string]RolloutStatus
+	done   chan struct{}
+}
+
+// watchRollout starts watching the workloads of release when it waits for
+// readiness. The returned function stops the watcher and annotates timeout
+// errors with the workloads that weren't ready.
+func (e *Executor) watchRollout(ctx context.Context, release helmstate.Release, namespace string) func(error) error {
+	if e.progress == nil || !release.Wait || e.dryRun {
+		return func(err error) error { return err }
+	}
+
+	w := &rolloutWatcher{
+		executor:    e,
+		release:     release.Name,
+		namespace:   namespace,
+		kubeContext: e.ReleaseKubeContext(release),
+		status:      make(map[string]RolloutStatus),
+		done:        make(chan struct{}),
+	}
+	watchCtx, cancel := context.WithCancel(ctx)
+	go w.run(watchCtx)
+
+	return func(err error) error {
+		cancel()
+		<-w.done
+		if err != nil && IsTimeout(err) {
+			if pending := w.notReady(); len(pending) > 0 {
+				return fmt.Errorf("%w\nnot ready: %s", err, strings.Join(pending, "; "))
+			}
+		}
+		return err
+	}
+}
+
+func (w *rolloutWatcher) run(ctx context.Context) {
+	defer close(w.done)
+
+	interval := w.executor.progressInterval
+	if interval <= 0 {
+		interval = DefaultProgressInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		w.poll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll fetches the workloads of the release and reports those whose status
+// changed since the last poll
+func (w *rolloutWatcher) poll(ctx context.Context) {
+	e := w.executor
+	stdout, stderr, err := e.runTool(ctx, e.kubectl, nil, nil,
+		kubectlArgs(w.kubeContext, "get", "deployments,statefulsets,jobs", "--namespace", w.namespace, "--output", "json")...)
+	if err != nil {
+		if ctx.Err() == nil {
+			e.logger.Debug("failed to poll rollout status",
+				zap.String("release", w.release),
+				zap.Error(err),
+				zap.String("stderr", stderr))
+		}
+		return
+	}
+
+	statuses, err := parseWorkloads(stdout, w.release)
+	if err != nil {
+		e.logger.Debug("failed to parse rollout status", zap.String("release", w.release), zap.Error(err))
+		return
+	}
+
+	w.mu.Lock()
+	var changed []RolloutStatus
+	for _, status := range statuses {
+		if w.status[status.Resource] != status {
+			w.status[status.Resource] = status
+			changed = append(changed, status)
+		}
+	}
+	w.mu.Unlock()
+
+	for _, status := range changed {
+		e.progress(Progress{
+			Release:       w.release,
+			Namespace:     w.namespace,
+			Time:          time.Now(),
+			RolloutStatus: status,
+		})
+	}
+}
+
+// notReady lists the workloads last seen not ready, with their status
+func (w *rolloutWatcher) notReady() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var pending []string
+	for _, status := range w.status {
+		if !status.Ready {
+			pending = append(pending, status.Resource+": "+status.Message)
+		}
+	}
+	sort.Strings(pending)
+	return pending
+}
+
+// workloadList is the subset of a kubectl get -o json list helmfire reads
+type workloadList struct {
+	Items []workload `json:"items"`
+}
+
+type workload struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name        string            `json:"name"`
+		Generation  int64             `json:"generation"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+	Spec struct {
+		Replicas    *int32 `json:"replicas"`
+		Completions *int32 `json:"completions"`
+	} `json:"spec"`
+	Status struct {
+		ObservedGeneration int64               `json:"observedGeneration"`
+		Replicas           int32               `json:"replicas"`
+		UpdatedReplicas    int32               `json:"updatedReplicas"`
+		ReadyReplicas      int32               `json:"readyReplicas"`
+		AvailableReplicas  int32               `json:"availableReplicas"`
+		Succeeded          int32               `json:"succeeded"`
+		Failed             int32               `json:"failed"`
+		Conditions         []workloadCondition `json:"conditions"`
+	} `json:"status"`
+}
+
+type workloadCondition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// parseWorkloads returns the rollout status of the workloads of release in
+// a kubectl list, sorted by resource
+func parseWorkloads(data, release string) ([]RolloutStatus, error) {
+	var list workloadList
+	if err := json.Unmarshal([]byte(data), &list); err != nil {
+		return nil, err
+	}
+
+	var statuses []RolloutStatus
+	for _, item := range list.Items {
+		if item.Metadata.Annotations[releaseNameAnnotation] != release {
+			continue
+		}
+		if status, ok := rolloutStatus(item); ok {
+			statuses = append(statuses, status)
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Resource < statuses[j].Resource })
+	return statuses, nil
+}
+
+// rolloutStatus computes the readiness of a workload the way kubectl rollout
+// status does
+func rolloutStatus(w workload) (RolloutStatus, bool) {
+	status := RolloutStatus{Resource: w.Kind + "/" + w.Metadata.Name}
+	desired := int32(1)
+	if w.Spec.Replicas != nil {
+		desired = *w.Spec.Replicas
+	}
+
+	switch w.Kind {
+	case "Deployment":
+		if cond := findCondition(w.Status.Conditions, "Progressing"); cond != nil && cond.Reason == "ProgressDeadlineExceeded" {
+			status.Message = "progress deadline exceeded"
+			return status, true
+		}
+		switch {
+		case w.Status.ObservedGeneration < w.Metadata.Generation:
+			status.Message = "waiting for the deployment spec update to be observed"
+		case w.Status.UpdatedReplicas < desired:
+			status.Message = fmt.Sprintf("%d of %d updated replicas", w.Status.UpdatedReplicas, desired)
+		case w.Status.Replicas > w.Status.UpdatedReplicas:
+			status.Message = fmt.Sprintf("%d old replicas pending termination", w.Status.Replicas-w.Status.UpdatedReplicas)
+		case w.Status.AvailableReplicas < w.Status.UpdatedReplicas:
+			status.Message = fmt.Sprintf("%d of %d updated replicas available", w.Status.AvailableReplicas, w.Status.UpdatedReplicas)
+		default:
+			status.Ready = true
+			status.Message = fmt.Sprintf("%d of %d replicas available", w.Status.AvailableReplicas, desired)
+		}
+
+	case "StatefulSet":
+		switch {
+		case w.Status.ObservedGeneration < w.Metadata.Generation:
+			status.Message = "waiting for the statefulset spec update to be observed"
+		case w.Status.UpdatedReplicas < desired:
+			status.Message = fmt.Sprintf("%d of %d updated replicas", w.Status.UpdatedReplicas, desired)
+		case w.Status.ReadyReplicas < desired:
+			status.Message = fmt.Sprintf("%d of %d replicas ready", w.Status.ReadyReplicas, desired)
+		default:
+			status.Ready = true
+			status.Message = fmt.Sprintf("%d of %d replicas ready", w.Status.ReadyReplicas, desired)
+		}
+
+	case "Job":
+		completions := int32(1)
+		if w.Spec.Completions != nil {
+			completions = *w.Spec.Completions
+		}
+		if cond := findCondition(w.Status.Conditions, "Failed"); cond != nil && cond.Status == "True" {
+			status.Message = "failed: " + cond.Reason
+			if cond.Message != "" {
+				status.Message += ": " + cond.Message
+			}
+			return status, true
+		}
+		status.Ready = w.Status.Succeeded >= completions
+		status.Message = fmt.Sprintf("%d of %d completions", w.Status.Succeeded, completions)
+
+	default:
+		return status, false
+	}
+	return status, true
+}
+
+func findCondition(conditions []workloadCondition, conditionType string) *workloadCondition {
+	for i := range conditions {
+		if conditions[i].Type == conditionType {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
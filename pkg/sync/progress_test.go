@@ -0,0 +1,214 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"go.uber.org/zap"
+)
+
+const workloads = `{"items":[
+{"kind":"Deployment","metadata":{"name":"web","generation":2,"annotations":{"meta.helm.sh/release-name":"web"}},
+ "spec":{"replicas":3},"status":{"observedGeneration":2,"replicas":3,"updatedReplicas":3,"availableReplicas":1}},
+{"kind":"Deployment","metadata":{"name":"other","generation":1,"annotations":{"meta.helm.sh/release-name":"other"}},
+ "spec":{"replicas":1},"status":{"observedGeneration":1,"replicas":1,"updatedReplicas":1,"availableReplicas":1}},
+{"kind":"StatefulSet","metadata":{"name":"db","generation":1,"annotations":{"meta.helm.sh/release-name":"web"}},
+ "spec":{"replicas":2},"status":{"observedGeneration":1,"updatedReplicas":2,"readyReplicas":2}},
+{"kind":"Job","metadata":{"name":"migrate","generation":1,"annotations":{"meta.helm.sh/release-name":"web"}},
+ "spec":{"completions":1},"status":{"failed":1,"conditions":[{"type":"Failed","status":"True","reason":"BackoffLimitExceeded","message":"Job has reached the specified backoff limit"}]}}
+]}`
+
+func TestParseWorkloads(t *testing.T) {
+	statuses, err := parseWorkloads(workloads, "web")
+	if err != nil {
+		t.Fatalf("parseWorkloads failed: %v", err)
+	}
+
+	want := []RolloutStatus{
+		{Resource: "Deployment/web", Message: "1 of 3 updated replicas available"},
+		{Resource: "Job/migrate", Message: "failed: BackoffLimitExceeded: Job has reached the specified backoff limit"},
+		{Resource: "StatefulSet/db", Ready: true, Message: "2 of 2 replicas ready"},
+	}
+	if len(statuses) != len(want) {
+		t.Fatalf("expected %d statuses, got %+v", len(want), statuses)
+	}
+	for i := range want {
+		if statuses[i] != want[i] {
+			t.Errorf("status %d: expected %+v, got %+v", i, want[i], statuses[i])
+		}
+	}
+}
+
+func TestRolloutStatus(t *testing.T) {
+	replicas := func(n int32) *int32 { return &n }
+
+	tests := []struct {
+		name    string
+		build   func(w *workload)
+		ready   bool
+		message string
+	}{
+		{
+			name: "deployment not observed",
+			build: func(w *workload) {
+				w.Kind = "Deployment"
+				w.Metadata.Generation = 3
+				w.Status.ObservedGeneration = 2
+			},
+			message: "waiting for the deployment spec update to be observed",
+		},
+		{
+			name: "deployment updating",
+			build: func(w *workload) {
+				w.Kind = "Deployment"
+				w.Spec.Replicas = replicas(3)
+				w.Status.Replicas = 3
+				w.Status.UpdatedReplicas = 1
+			},
+			message: "1 of 3 updated replicas",
+		},
+		{
+			name: "deployment terminating old replicas",
+			build: func(w *workload) {
+				w.Kind = "Deployment"
+				w.Spec.Replicas = replicas(2)
+				w.Status.Replicas = 3
+				w.Status.UpdatedReplicas = 2
+			},
+			message: "1 old replicas pending termination",
+		},
+		{
+			name: "deployment deadline exceeded",
+			build: func(w *workload) {
+				w.Kind = "Deployment"
+				w.Status.Conditions = []workloadCondition{{Type: "Progressing", Status: "False", Reason: "ProgressDeadlineExceeded"}}
+			},
+			message: "progress deadline exceeded",
+		},
+		{
+			name: "deployment ready",
+			build: func(w *workload) {
+				w.Kind = "Deployment"
+				w.Spec.Replicas = replicas(2)
+				w.Status.Replicas = 2
+				w.Status.UpdatedReplicas = 2
+				w.Status.AvailableReplicas = 2
+			},
+			ready:   true,
+			message: "2 of 2 replicas available",
+		},
+		{
+			name: "statefulset not ready",
+			build: func(w *workload) {
+				w.Kind = "StatefulSet"
+				w.Spec.Replicas = replicas(3)
+				w.Status.UpdatedReplicas = 3
+				w.Status.ReadyReplicas = 1
+			},
+			message: "1 of 3 replicas ready",
+		},
+		{
+			name: "job running",
+			build: func(w *workload) {
+				w.Kind = "Job"
+				w.Spec.Completions = replicas(2)
+				w.Status.Succeeded = 1
+			},
+			message: "1 of 2 completions",
+		},
+		{
+			name: "job complete",
+			build: func(w *workload) {
+				w.Kind = "Job"
+				w.Status.Succeeded = 1
+			},
+			ready:   true,
+			message: "1 of 1 completions",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var w workload
+			w.Metadata.Name = "x"
+			tt.build(&w)
+			status, ok := rolloutStatus(w)
+			if !ok {
+				t.Fatal("expected a status")
+			}
+			if status.Ready != tt.ready || status.Message != tt.message {
+				t.Errorf("expected ready=%v %q, got ready=%v %q", tt.ready, tt.message, status.Ready, status.Message)
+			}
+		})
+	}
+
+	var cm workload
+	cm.Kind = "ConfigMap"
+	if _, ok := rolloutStatus(cm); ok {
+		t.Error("expected no status for a ConfigMap")
+	}
+}
+
+func TestSyncReleaseProgress(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm and kubectl scripts require a POSIX shell")
+	}
+
+	// Fake helm waits and times out; fake kubectl reports the workloads
+	dir := t.TempDir()
+	helm := filepath.Join(dir, "helm")
+	if err := os.WriteFile(helm, []byte("#!/bin/sh\nsleep 0.3\necho 'Error: timed out waiting for the condition' >&2\nexit 1\n"), 0755); err != nil {
+		t.Fatalf("failed to write fake helm: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "workloads.json"), []byte(workloads), 0644); err != nil {
+		t.Fatalf("failed to write workloads: %v", err)
+	}
+	kubectl := filepath.Join(dir, "kubectl")
+	if err := os.WriteFile(kubectl, []byte("#!/bin/sh\necho \"$@\" >> "+dir+"/args\ncat "+dir+"/workloads.json\n"), 0755); err != nil {
+		t.Fatalf("failed to write fake kubectl: %v", err)
+	}
+
+	var mu sync.Mutex
+	var events []Progress
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	executor.SetHelmBinary(helm)
+	executor.SetKubectl(kubectl)
+	executor.SetProgressInterval(20 * time.Millisecond)
+	executor.SetProgress(func(p Progress) {
+		mu.Lock()
+		events = append(events, p)
+		mu.Unlock()
+	})
+
+	release := helmstate.Release{Name: "web", Namespace: "apps", Chart: "bitnami/nginx", Wait: true}
+	err := executor.SyncReleaseContext(context.Background(), release)
+	if !IsTimeout(err) {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "not ready: Deployment/web: 1 of 3 updated replicas available; Job/migrate: failed") {
+		t.Errorf("expected the not ready workloads in the error, got %v", err)
+	}
+
+	// Each status is reported once, unchanged polls are not
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 3 {
+		t.Fatalf("expected 3 progress events, got %+v", events)
+	}
+	if events[0].Release != "web" || events[0].Namespace != "apps" || events[0].Resource != "Deployment/web" {
+		t.Errorf("unexpected event: %+v", events[0])
+	}
+
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	if !strings.HasPrefix(string(args), "get deployments,statefulsets,jobs --namespace apps --output json\n") {
+		t.Errorf("unexpected kubectl arguments: %s", args)
+	}
+}
@@ -0,0 +1,102 @@
+package sync
+
+import (
+	"time"
+)
+
+// ReleaseStatus describes the outcome of syncing a single release
+type ReleaseStatus string
+
+const (
+	ReleaseStatusSucceeded ReleaseStatus = "succeeded"
+	ReleaseStatusFailed    ReleaseStatus = "failed"
+	ReleaseStatusTimedOut  ReleaseStatus = "timed-out"
+	ReleaseStatusSkipped   ReleaseStatus = "skipped"
+)
+
+// ReleaseResult records the outcome of syncing a single release
+type ReleaseResult struct {
+	Name      string        `json:"name"`
+	Namespace string        `json:"namespace,omitempty"`
+	Status    ReleaseStatus `json:"status"`
+	Duration  time.Duration `json:"duration"`
+	Error     string        `json:"error,omitempty"`
+
+	// Helm is the release as helm reported it after a successful sync
+	Helm *HelmRelease `json:"helm,omitempty"`
+}
+
+// Report summarizes a sync run. Resources stamped by the run carry its
+// SyncID in AnnotationSyncID.
+type Report struct {
+	SyncID    string          `json:"syncId,omitempty"`
+	StartTime time.Time       `json:"startTime"`
+	Duration  time.Duration   `json:"duration"`
+	Results   []ReleaseResult `json:"results"`
+}
+
+// NewReport creates an empty report starting now
+func NewReport() *Report {
+	return &Report{
+		SyncID:    newSyncID(),
+		StartTime: time.Now(),
+	}
+}
+
+// Record adds the outcome of a release sync to the report, classifying err
+func (r *Report) Record(name, namespace string, duration time.Duration, err error) {
+	r.RecordRelease(name, namespace, duration, nil, err)
+}
+
+// RecordRelease adds the outcome of a release sync to the report like
+// Record, along with the release helm reported
+func (r *Report) RecordRelease(name, namespace string, duration time.Duration, helm *HelmRelease, err error) {
+	result := ReleaseResult{
+		Name:      name,
+		Namespace: namespace,
+		Status:    ReleaseStatusSucceeded,
+		Duration:  duration,
+		Helm:      helm,
+	}
+
+	if err != nil {
+		result.Status = ReleaseStatusFailed
+		if IsTimeout(err) {
+			result.Status = ReleaseStatusTimedOut
+		}
+		result.Error = err.Error()
+	}
+
+	r.Results = append(r.Results, result)
+}
+
+// Skip records a release that was not synced
+func (r *Report) Skip(name, namespace, reason string) {
+	r.Results = append(r.Results, ReleaseResult{
+		Name:      name,
+		Namespace: namespace,
+		Status:    ReleaseStatusSkipped,
+		Error:     reason,
+	})
+}
+
+// Finish records the total duration of the run
+func (r *Report) Finish() {
+	r.Duration = time.Since(r.StartTime)
+}
+
+// Count returns the number of releases with the given status
+func (r *Report) Count(status ReleaseStatus) int {
+	count := 0
+	for _, result := range r.Results {
+		if result.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// Failed reports whether any release failed or timed out
+func (r *Report) Failed() bool {
+	return r.Count(ReleaseStatusFailed) > 0 || r.Count(ReleaseStatusTimedOut) > 0
+}
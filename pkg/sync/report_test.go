@@ -0,0 +1,55 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestReportRecord(t *testing.T) {
+	report := NewReport()
+
+	report.RecordRelease("nginx", "default", time.Second, &HelmRelease{Name: "nginx", Revision: 4, Status: "deployed"}, nil)
+	report.Record("postgres", "db", 2*time.Second, errors.New("chart not found"))
+	report.Record("redis", "cache", 3*time.Second, fmt.Errorf("helm command %w", ErrTimeout))
+	report.Skip("mongodb", "db", "previous release failed")
+	report.Finish()
+
+	tests := []struct {
+		status   ReleaseStatus
+		expected int
+	}{
+		{ReleaseStatusSucceeded, 1},
+		{ReleaseStatusFailed, 1},
+		{ReleaseStatusTimedOut, 1},
+		{ReleaseStatusSkipped, 1},
+	}
+
+	for _, tt := range tests {
+		if got := report.Count(tt.status); got != tt.expected {
+			t.Errorf("expected %d %s releases, got %d", tt.expected, tt.status, got)
+		}
+	}
+
+	if !report.Failed() {
+		t.Error("expected report to be failed")
+	}
+
+	if report.Results[2].Error == "" {
+		t.Error("expected error message for timed-out release")
+	}
+	if helm := report.Results[0].Helm; helm == nil || helm.Revision != 4 {
+		t.Errorf("expected the helm release of nginx, got %+v", helm)
+	}
+}
+
+func TestReportSucceeded(t *testing.T) {
+	report := NewReport()
+	report.Record("nginx", "default", time.Second, nil)
+	report.Skip("postgres", "db", "installed: false")
+
+	if report.Failed() {
+		t.Error("expected report not to be failed")
+	}
+}
@@ -0,0 +1,156 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/tracing"
+	"go.uber.org/zap"
+)
+
+// RepositoryRecordFile names the record of the repositories helmfire added
+// to helm in a project's state directory
+const RepositoryRecordFile = "repositories.json"
+
+// PruneRepositories removes the helm repositories the executor added that
+// aren't among keep, those of the helmfile, and returns their names.
+// Repositories helm knew before, such as those added by hand or by other
+// tools, are never removed. In dry-run mode nothing is removed.
+func (e *Executor) PruneRepositories(ctx context.Context, keep []helmstate.Repository) (pruned []string, err error) {
+	ctx, span := tracing.Start(ctx, "sync.prune_repositories")
+	defer func() { span.End(err) }()
+
+	if e.offlineCharts != "" || e.repositoryRecord == "" {
+		return nil, nil
+	}
+	added, err := readRepositoryRecord(e.repositoryRecord)
+	if err != nil || len(added) == 0 {
+		return nil, err
+	}
+	listed, err := e.listRepositories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	declared := make(map[string]bool, len(keep))
+	for _, repo := range keep {
+		declared[repo.Name] = true
+	}
+	var remaining []string
+	for _, name := range added {
+		switch {
+		case !slices.Contains(listed, name):
+			// Removed since, by hand
+			continue
+		case declared[name]:
+			remaining = append(remaining, name)
+			continue
+		}
+		if e.dryRun {
+			e.logger.Info("dry run: would remove repository", zap.String("name", name))
+			pruned = append(pruned, name)
+			continue
+		}
+		e.logger.Info("removing repository", zap.String("name", name))
+		if err := e.runHelm(ctx, "repo", "remove", name); err != nil {
+			return pruned, fmt.Errorf("failed to remove repository %s: %w", name, err)
+		}
+		pruned = append(pruned, name)
+	}
+	if e.dryRun {
+		return pruned, nil
+	}
+	return pruned, writeRepositoryRecord(e.repositoryRecord, remaining)
+}
+
+// listRepositories returns the names of the repositories helm knows
+func (e *Executor) listRepositories(ctx context.Context) ([]string, error) {
+	out, err := e.runHelmOutput(ctx, "repo", "list", "--output", "json")
+	if err != nil {
+		// helm fails listing when it has no repositories
+		if strings.Contains(err.Error(), "no repositories") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list repositories: %w", err)
+	}
+	var listed []struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal([]byte(out), &listed); err != nil {
+		return nil, fmt.Errorf("failed to parse repositories: %w", err)
+	}
+	names := make([]string, 0, len(listed))
+	for _, repo := range listed {
+		names = append(names, repo.Name)
+	}
+	return names, nil
+}
+
+// recordRepositories adds to the repository record those of synced that
+// weren't among known, the repositories helm knew before the sync
+func (e *Executor) recordRepositories(synced, known []string) error {
+	if e.repositoryRecord == "" {
+		return nil
+	}
+	var added []string
+	for _, name := range synced {
+		if !slices.Contains(known, name) {
+			added = append(added, name)
+		}
+	}
+	if len(added) == 0 {
+		return nil
+	}
+
+	recorded, err := readRepositoryRecord(e.repositoryRecord)
+	if err != nil {
+		return err
+	}
+	for _, name := range added {
+		if !slices.Contains(recorded, name) {
+			recorded = append(recorded, name)
+		}
+	}
+	return writeRepositoryRecord(e.repositoryRecord, recorded)
+}
+
+// readRepositoryRecord reads the repository names recorded in path; none
+// when it doesn't exist
+func readRepositoryRecord(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repository record: %w", err)
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return nil, fmt.Errorf("failed to parse repository record %s: %w", path, err)
+	}
+	return names, nil
+}
+
+// writeRepositoryRecord records names in path, sorted
+func writeRepositoryRecord(path string, names []string) error {
+	names = append([]string{}, names...)
+	sort.Strings(names)
+	data, err := json.Marshal(names)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to record repositories: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to record repositories: %w", err)
+	}
+	return nil
+}
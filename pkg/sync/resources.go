@@ -0,0 +1,258 @@
+package sync
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ResourceProfile scales down the resources workloads request and the
+// replicas they run, so charts sized for production fit on a laptop or a
+// kind cluster
+type ResourceProfile struct {
+	// Factor multiplies CPU and memory requests and limits and replica
+	// counts, which stay at least 1
+	Factor float64 `json:"factor"`
+
+	// MaxReplicas caps replica counts once scaled; no cap when 0
+	MaxReplicas int `json:"maxReplicas,omitempty"`
+}
+
+// ResourceProfiles are the profiles --resources-profile accepts by name
+var ResourceProfiles = map[string]ResourceProfile{
+	"dev":   {Factor: 0.1, MaxReplicas: 1},
+	"small": {Factor: 0.5},
+}
+
+// ParseResourceProfile returns the profile of a name in ResourceProfiles,
+// or one scaling by a factor such as 0.25
+func ParseResourceProfile(name string) (*ResourceProfile, error) {
+	if profile, ok := ResourceProfiles[name]; ok {
+		return &profile, nil
+	}
+	factor, err := strconv.ParseFloat(name, 64)
+	if err != nil || factor <= 0 || factor > 1 || math.IsNaN(factor) {
+		names := make([]string, 0, len(ResourceProfiles))
+		for name := range ResourceProfiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("invalid resources profile %q: must be one of %s or a factor in (0, 1]", name, strings.Join(names, ", "))
+	}
+	return &ResourceProfile{Factor: factor}, nil
+}
+
+// scaledResources are the resources of containers and quotas that are
+// scaled; others, such as GPUs, are counted in whole devices
+var scaledResources = map[string]bool{
+	"cpu":             true,
+	"memory":          true,
+	"requests.cpu":    true,
+	"requests.memory": true,
+	"limits.cpu":      true,
+	"limits.memory":   true,
+}
+
+// replicaKinds are the kinds whose spec.replicas is scaled
+var replicaKinds = map[string]bool{
+	"Deployment":  true,
+	"StatefulSet": true,
+	"ReplicaSet":  true,
+}
+
+// scaleDocument applies profile to the resource in a rendered YAML
+// document: the requests and limits of the containers of pods and pod
+// templates, replica counts, the bounds of HorizontalPodAutoscalers and
+// ResourceQuotas. Documents it doesn't change are returned as they were.
+func scaleDocument(doc []byte, profile ResourceProfile) ([]byte, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(doc, &node); err != nil {
+		return nil, err
+	}
+	if node.Kind != yaml.DocumentNode || len(node.Content) == 0 || node.Content[0].Kind != yaml.MappingNode {
+		return doc, nil
+	}
+	resource := node.Content[0]
+	kind := mappingValue(resource, "kind")
+	spec := mappingValue(resource, "spec")
+	if kind == nil || spec == nil || spec.Kind != yaml.MappingNode {
+		return doc, nil
+	}
+
+	changed := false
+	switch kind.Value {
+	case "Pod":
+		changed = scalePodSpec(spec, profile)
+	case "CronJob":
+		if job := mappingPath(spec, "jobTemplate", "spec", "template", "spec"); job != nil {
+			changed = scalePodSpec(job, profile)
+		}
+	case "HorizontalPodAutoscaler":
+		for _, key := range []string{"minReplicas", "maxReplicas"} {
+			changed = scaleReplicas(mappingValue(spec, key), profile) || changed
+		}
+	case "ResourceQuota":
+		changed = scaleQuantities(mappingValue(spec, "hard"), profile.Factor)
+	default:
+		if pod := mappingPath(spec, "template", "spec"); pod != nil {
+			changed = scalePodSpec(pod, profile)
+		}
+		if replicaKinds[kind.Value] {
+			changed = scaleReplicas(mappingValue(spec, "replicas"), profile) || changed
+		}
+	}
+	if !changed {
+		return doc, nil
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// mappingPath returns the mapping under a path of keys, or nil
+func mappingPath(mapping *yaml.Node, keys ...string) *yaml.Node {
+	for _, key := range keys {
+		if mapping = mappingValue(mapping, key); mapping == nil || mapping.Kind != yaml.MappingNode {
+			return nil
+		}
+	}
+	return mapping
+}
+
+// scalePodSpec scales the requests and limits of the containers and init
+// containers of a pod spec
+func scalePodSpec(pod *yaml.Node, profile ResourceProfile) bool {
+	changed := false
+	for _, key := range []string{"initContainers", "containers"} {
+		containers := mappingValue(pod, key)
+		if containers == nil || containers.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, container := range containers.Content {
+			if container.Kind != yaml.MappingNode {
+				continue
+			}
+			for _, bound := range []string{"requests", "limits"} {
+				if quantities := mappingPath(container, "resources", bound); quantities != nil {
+					changed = scaleQuantities(quantities, profile.Factor) || changed
+				}
+			}
+		}
+	}
+	return changed
+}
+
+// scaleQuantities scales the CPU and memory quantities of a mapping
+func scaleQuantities(quantities *yaml.Node, factor float64) bool {
+	if quantities == nil || quantities.Kind != yaml.MappingNode {
+		return false
+	}
+	changed := false
+	for i := 0; i+1 < len(quantities.Content); i += 2 {
+		value := quantities.Content[i+1]
+		if !scaledResources[quantities.Content[i].Value] || value.Kind != yaml.ScalarNode {
+			continue
+		}
+		if scaled, ok := scaleQuantity(value.Value, factor); ok && scaled != value.Value {
+			*value = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: scaled}
+			changed = true
+		}
+	}
+	return changed
+}
+
+// scaleReplicas scales a replica count, keeping at least one replica
+func scaleReplicas(replicas *yaml.Node, profile ResourceProfile) bool {
+	if replicas == nil || replicas.Kind != yaml.ScalarNode {
+		return false
+	}
+	count, err := strconv.Atoi(replicas.Value)
+	if err != nil || count <= 1 {
+		return false
+	}
+	scaled := int(math.Ceil(float64(count) * profile.Factor))
+	if profile.MaxReplicas > 0 && scaled > profile.MaxReplicas {
+		scaled = profile.MaxReplicas
+	}
+	if scaled < 1 {
+		scaled = 1
+	}
+	if scaled == count {
+		return false
+	}
+	replicas.Value = strconv.Itoa(scaled)
+	return true
+}
+
+// quantityRegexp splits a Kubernetes quantity into its number and suffix
+var quantityRegexp = regexp.MustCompile(`^([0-9]+(?:\.[0-9]*)?|\.[0-9]+)([a-zA-Z]*)$`)
+
+// quantityUnit is a suffix of quantities and what it multiplies by
+type quantityUnit struct {
+	suffix string
+	scale  float64
+}
+
+// binaryUnits and decimalUnits are the suffixes of quantities, largest
+// first; a scaled quantity keeps its family of suffixes
+var (
+	binaryUnits = []quantityUnit{
+		{"Ei", 1 << 60}, {"Pi", 1 << 50}, {"Ti", 1 << 40}, {"Gi", 1 << 30}, {"Mi", 1 << 20}, {"Ki", 1 << 10}, {"", 1},
+	}
+	decimalUnits = []quantityUnit{
+		{"E", 1e18}, {"P", 1e15}, {"T", 1e12}, {"G", 1e9}, {"M", 1e6}, {"k", 1e3}, {"", 1}, {"m", 1e-3},
+	}
+)
+
+// scaleQuantity multiplies a quantity such as 500m or 2Gi by factor,
+// rounding up in the largest unit it still has 10 of, so 2Gi scaled by 0.1
+// becomes 205Mi rather than 1Gi. Quantities it can't parse aren't ok.
+func scaleQuantity(quantity string, factor float64) (string, bool) {
+	m := quantityRegexp.FindStringSubmatch(quantity)
+	if m == nil {
+		return "", false
+	}
+	number, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return "", false
+	}
+
+	units := decimalUnits
+	if strings.HasSuffix(m[2], "i") {
+		units = binaryUnits
+	}
+	var value float64
+	found := false
+	for _, unit := range units {
+		if unit.suffix == m[2] {
+			value, found = number*unit.scale*factor, true
+			break
+		}
+	}
+	if !found {
+		return "", false
+	}
+
+	for i, unit := range units {
+		if value/unit.scale >= 10 || i == len(units)-1 {
+			// Round off float error before rounding up
+			scaled := math.Ceil(math.Round(value/unit.scale*1e6) / 1e6)
+			return strconv.FormatFloat(math.Max(scaled, 1), 'f', 0, 64) + unit.suffix, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,140 @@
+package sync
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestScaleQuantity(t *testing.T) {
+	tests := []struct {
+		quantity string
+		factor   float64
+		want     string
+	}{
+		{quantity: "500m", factor: 0.1, want: "50m"},
+		{quantity: "2", factor: 0.1, want: "200m"},
+		{quantity: "1.5", factor: 0.5, want: "750m"},
+		{quantity: "4", factor: 0.5, want: "2000m"},
+		{quantity: "5m", factor: 0.1, want: "1m"},
+		{quantity: "2Gi", factor: 0.1, want: "205Mi"},
+		{quantity: "512Mi", factor: 0.5, want: "256Mi"},
+		{quantity: "64Mi", factor: 0.1, want: "6554Ki"},
+		{quantity: "1G", factor: 0.1, want: "100M"},
+		{quantity: "1000000000", factor: 0.25, want: "250M"},
+	}
+	for _, tt := range tests {
+		if got, ok := scaleQuantity(tt.quantity, tt.factor); !ok || got != tt.want {
+			t.Errorf("scaleQuantity(%s, %g) = %s, %v; want %s", tt.quantity, tt.factor, got, ok, tt.want)
+		}
+	}
+	for _, quantity := range []string{"", "lots", "1e3", "2Gb"} {
+		if _, ok := scaleQuantity(quantity, 0.5); ok {
+			t.Errorf("expected %q not to scale", quantity)
+		}
+	}
+}
+
+func TestParseResourceProfile(t *testing.T) {
+	if profile, err := ParseResourceProfile("dev"); err != nil || profile.Factor != 0.1 || profile.MaxReplicas != 1 {
+		t.Errorf("unexpected dev profile %+v, %v", profile, err)
+	}
+	if profile, err := ParseResourceProfile("0.25"); err != nil || profile.Factor != 0.25 || profile.MaxReplicas != 0 {
+		t.Errorf("unexpected factor profile %+v, %v", profile, err)
+	}
+	for _, name := range []string{"prod", "0", "2", "-0.5", "NaN"} {
+		if _, err := ParseResourceProfile(name); err == nil {
+			t.Errorf("expected an error for %q", name)
+		}
+	}
+}
+
+func TestPostRenderResources(t *testing.T) {
+	manifests := `---
+# Source: web/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 3
+  template:
+    spec:
+      initContainers:
+        - name: migrate
+          image: web:1.0
+          resources:
+            requests:
+              cpu: 1
+      containers:
+        - name: web
+          image: web:1.0
+          resources:
+            requests:
+              cpu: 500m
+              memory: 1Gi
+              nvidia.com/gpu: 1
+            limits:
+              memory: 2Gi
+---
+# Source: web/templates/hpa.yaml
+apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: web
+spec:
+  minReplicas: 2
+  maxReplicas: 10
+---
+# Source: web/templates/quota.yaml
+apiVersion: v1
+kind: ResourceQuota
+metadata:
+  name: web
+spec:
+  hard:
+    requests.cpu: "8"
+    pods: "20"
+---
+# Source: web/templates/cronjob.yaml
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: report
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+            - name: report
+              resources:
+                limits:
+                  cpu: 2
+---
+# Source: web/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  ports:
+    - port: 80 # http
+`
+	var out bytes.Buffer
+	if err := postRender(strings.NewReader(manifests), &out, postRenderConfig{Resources: &ResourceProfile{Factor: 0.1, MaxReplicas: 1}}); err != nil {
+		t.Fatalf("postRender failed: %v", err)
+	}
+	got := out.String()
+
+	for _, want := range []string{
+		"replicas: 1\n", "cpu: 100m\n", "cpu: 50m\n", "memory: 103Mi\n", "memory: 205Mi\n", "nvidia.com/gpu: 1\n",
+		"minReplicas: 1\n", "maxReplicas: 1\n", "requests.cpu: 800m\n", `pods: "20"`, "cpu: 200m\n",
+		// Resources it doesn't scale are left as rendered
+		"    - port: 80 # http\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"go.uber.org/zap"
+)
+
+// SyncDescription is the description of the helm revisions a helmfire sync
+// creates, which marks them in the release history
+const SyncDescription = "helmfire sync"
+
+// Revision is one entry of a release's helm history
+type Revision struct {
+	Revision    int    `json:"revision"`
+	Updated     string `json:"updated"`
+	Status      string `json:"status"`
+	Chart       string `json:"chart"`
+	AppVersion  string `json:"app_version"`
+	Description string `json:"description"`
+}
+
+// RollbackStep is a release and the revision it is rolled back to. A step
+// with a Skip reason is not rolled back.
+type RollbackStep struct {
+	Release   string `json:"release"`
+	Namespace string `json:"namespace"`
+	Revision  int    `json:"revision,omitempty"`
+	Skip      string `json:"skip,omitempty"`
+
+	// KubeContext is the kubeconfig context of the release; the current
+	// context when empty
+	KubeContext string `json:"kubeContext,omitempty"`
+}
+
+// ReleaseHistory returns the helm history of a release, oldest first
+func (e *Executor) ReleaseHistory(ctx context.Context, release helmstate.Release) ([]Revision, error) {
+	args := []string{"history", release.Name, "--namespace", e.ReleaseNamespace(release), "--output", "json"}
+	if kubeContext := e.ReleaseKubeContext(release); kubeContext != "" {
+		args = append(args, "--kube-context", kubeContext)
+	}
+
+	out, err := e.runHelmOutput(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var history []Revision
+	if err := json.Unmarshal([]byte(out), &history); err != nil {
+		return nil, fmt.Errorf("failed to parse helm history: %w", err)
+	}
+	return history, nil
+}
+
+// RevisionBeforeSync returns the revision a release had before the last
+// helmfire sync in its history
+func RevisionBeforeSync(history []Revision) (int, error) {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Description != SyncDescription {
+			continue
+		}
+		if history[i].Revision <= 1 {
+			return 0, fmt.Errorf("installed by the last helmfire sync, no earlier revision")
+		}
+		return history[i].Revision - 1, nil
+	}
+	return 0, fmt.Errorf("not synced by helmfire")
+}
+
+// PlanRollback works out the revision each release is rolled back to:
+// revision when it is set, otherwise the one before the last helmfire sync.
+// Releases without such a revision are skipped.
+func (e *Executor) PlanRollback(ctx context.Context, releases []helmstate.Release, revision int) ([]RollbackStep, error) {
+	steps := make([]RollbackStep, 0, len(releases))
+	for _, release := range releases {
+		step := RollbackStep{Release: release.Name, Namespace: e.ReleaseNamespace(release),
+			KubeContext: e.ReleaseKubeContext(release), Revision: revision}
+		if revision == 0 {
+			history, err := e.ReleaseHistory(ctx, release)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get history of %s: %w", release.Name, err)
+			}
+			if step.Revision, err = RevisionBeforeSync(history); err != nil {
+				step.Skip = err.Error()
+			}
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// Rollback rolls back releases as planned, continuing past failures
+func (e *Executor) Rollback(ctx context.Context, steps []RollbackStep) *Report {
+	report := NewReport()
+	for _, step := range steps {
+		if step.Skip != "" {
+			report.Skip(step.Release, step.Namespace, step.Skip)
+			continue
+		}
+		start := time.Now()
+		err := e.RollbackRelease(ctx, step)
+		report.Record(step.Release, step.Namespace, time.Since(start), err)
+	}
+	report.Finish()
+	return report
+}
+
+// RollbackRelease rolls a release back to the step's revision
+func (e *Executor) RollbackRelease(ctx context.Context, step RollbackStep) error {
+	e.logger.Info("rolling back release",
+		zap.String("name", step.Release),
+		zap.String("namespace", step.Namespace),
+		zap.Int("revision", step.Revision))
+
+	return e.runHelm(ctx, e.rollbackArgs(step)...)
+}
+
+// rollbackArgs builds the helm rollback arguments for a step
+func (e *Executor) rollbackArgs(step RollbackStep) []string {
+	args := []string{"rollback", step.Release}
+	if step.Revision > 0 {
+		args = append(args, strconv.Itoa(step.Revision))
+	}
+	args = append(args, "--namespace", step.Namespace)
+
+	if step.KubeContext != "" {
+		args = append(args, "--kube-context", step.KubeContext)
+	}
+	if e.dryRun {
+		args = append(args, "--dry-run")
+	}
+	return args
+}
@@ -0,0 +1,150 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"go.uber.org/zap"
+)
+
+func TestRevisionBeforeSync(t *testing.T) {
+	tests := []struct {
+		name     string
+		history  []Revision
+		expected int
+		wantErr  bool
+	}{
+		{
+			name: "last sync",
+			history: []Revision{
+				{Revision: 1, Description: "Install complete"},
+				{Revision: 2, Description: SyncDescription},
+				{Revision: 3, Description: SyncDescription},
+				{Revision: 4, Description: "Upgrade complete"},
+			},
+			expected: 2,
+		},
+		{
+			name:    "installed by sync",
+			history: []Revision{{Revision: 1, Description: SyncDescription}},
+			wantErr: true,
+		},
+		{
+			name:    "never synced",
+			history: []Revision{{Revision: 1, Description: "Install complete"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revision, err := RevisionBeforeSync(tt.history)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got revision %d", revision)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RevisionBeforeSync failed: %v", err)
+			}
+			if revision != tt.expected {
+				t.Errorf("expected revision %d, got %d", tt.expected, revision)
+			}
+		})
+	}
+}
+
+func TestRollbackArgs(t *testing.T) {
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+
+	args := executor.rollbackArgs(RollbackStep{Release: "web", Namespace: "frontend", KubeContext: "staging", Revision: 3})
+	if strings.Join(args[:3], " ") != "rollback web 3" {
+		t.Errorf("expected rollback web 3, got %v", args)
+	}
+	if !hasArgPair(args, "--namespace", "frontend") || !hasArgPair(args, "--kube-context", "staging") {
+		t.Errorf("expected namespace and kube context flags, got %v", args)
+	}
+
+	// Without a revision helm rolls back to the previous one
+	args = executor.rollbackArgs(RollbackStep{Release: "web", Namespace: "frontend"})
+	if args[2] != "--namespace" {
+		t.Errorf("expected no revision, got %v", args)
+	}
+}
+
+func TestPlanAndRollback(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	// Fake helm: web was synced twice by helmfire, api never; rollbacks of
+	// web are logged and rollbacks of anything else fail
+	dir := t.TempDir()
+	log := filepath.Join(dir, "rollbacks")
+	helm := filepath.Join(dir, "helm")
+	script := `#!/bin/sh
+case "$1 $2" in
+"history web")
+  echo '[{"revision":1,"description":"Install complete"},{"revision":2,"description":"helmfire sync"},{"revision":3,"description":"helmfire sync"}]' ;;
+"history api")
+  echo '[{"revision":1,"description":"Install complete"}]' ;;
+"rollback web")
+  echo "$@" >> ` + log + ` ;;
+*)
+  echo "release not found" >&2; exit 1 ;;
+esac
+`
+	if err := os.WriteFile(helm, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake helm: %v", err)
+	}
+
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	executor.SetHelmBinary(helm)
+	executor.SetNamespace("apps")
+	executor.SetKubeContext("staging")
+
+	// The namespace and context set on the executor override the releases'
+	releases := []helmstate.Release{{Name: "web"}, {Name: "api", Namespace: "backend", KubeContext: "prod"}}
+	steps, err := executor.PlanRollback(context.Background(), releases, 0)
+	if err != nil {
+		t.Fatalf("PlanRollback failed: %v", err)
+	}
+	if len(steps) != 2 {
+		t.Fatalf("expected 2 steps, got %+v", steps)
+	}
+	if steps[0] != (RollbackStep{Release: "web", Namespace: "apps", KubeContext: "staging", Revision: 2}) {
+		t.Errorf("expected web to roll back to revision 2 in apps, got %+v", steps[0])
+	}
+	if steps[1].Release != "api" || steps[1].Namespace != "apps" || steps[1].KubeContext != "staging" || steps[1].Skip == "" {
+		t.Errorf("expected api to be skipped, got %+v", steps[1])
+	}
+
+	report := executor.Rollback(context.Background(), steps)
+	if report.Count(ReleaseStatusSucceeded) != 1 || report.Count(ReleaseStatusSkipped) != 1 {
+		t.Errorf("expected 1 succeeded and 1 skipped, got %+v", report.Results)
+	}
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatalf("expected web to be rolled back: %v", err)
+	}
+	if got := strings.TrimSpace(string(data)); got != "rollback web 2 --namespace apps --kube-context staging" {
+		t.Errorf("unexpected rollback: %q", got)
+	}
+
+	// An explicit revision is used as is, without reading the history
+	steps, err = executor.PlanRollback(context.Background(), releases[1:], 1)
+	if err != nil {
+		t.Fatalf("PlanRollback failed: %v", err)
+	}
+	report = executor.Rollback(context.Background(), steps)
+	if !report.Failed() {
+		t.Errorf("expected rollback of api to fail, got %+v", report.Results)
+	}
+}
@@ -0,0 +1,238 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/redact"
+	"github.com/oleksiyp/helmfire/pkg/secretref"
+	"github.com/oleksiyp/helmfire/pkg/vault"
+	"gopkg.in/yaml.v3"
+)
+
+// secretsDirPattern names the private directories resolved secrets are
+// written to for helm
+const secretsDirPattern = "helmfire-secrets-*"
+
+// staleSecretsDir is how old a secrets directory must be before it is
+// treated as left behind by a sync that crashed
+const staleSecretsDir = time.Hour
+
+// SetVault sets the client vault: references in values are read with. When
+// unset, one configured by the VAULT_* environment variables is created the
+// first time a release refers to Vault.
+func (e *Executor) SetVault(client *vault.Client) {
+	e.secrets.SetVault(client)
+}
+
+// SetSecretCommand sets the CLI reading secret references of scheme, such
+// as secretref.SchemeAWS; the cloud's own CLI on PATH by default
+func (e *Executor) SetSecretCommand(scheme, command string) {
+	e.secrets.SetCommand(scheme, command)
+}
+
+// SetRedactor sets the redactor masking secrets in what the executor logs
+// and returns, so that others, such as the drift detector, can share it
+func (e *Executor) SetRedactor(r *redact.Redactor) {
+	e.redactor = r
+}
+
+// Redactor returns the redactor masking secrets in what the executor logs
+// and returns. It learns the secrets resolved for releases, sensitive set
+// values and repository passwords as they are used.
+func (e *Executor) Redactor() *redact.Redactor {
+	return e.redactor
+}
+
+// redact masks the secrets known so far and the data of Secret manifests
+// in s
+func (e *Executor) redact(s string) string {
+	return redact.Manifests(e.redactor.String(s))
+}
+
+// redactArgs masks credentials and known secrets in command arguments
+func (e *Executor) redactArgs(args []string) []string {
+	return e.redactor.Args(args)
+}
+
+// resolveSecret reads the secret a reference names and masks it from then on
+func (e *Executor) resolveSecret(ctx context.Context, ref string) (string, error) {
+	secret, err := e.secrets.Resolve(ctx, ref)
+	if err == nil {
+		e.redactor.Add(secret)
+	}
+	return secret, err
+}
+
+// withSecrets returns release with the secret references of its set values
+// and values files resolved, reading each secret once per sync of ctx.
+// Secrets only reach helm through files in a private temporary directory,
+// never its arguments; the returned cleanup shreds them. Releases without
+// references are returned unchanged.
+func (e *Executor) withSecrets(ctx context.Context, release helmstate.Release) (helmstate.Release, func(), error) {
+	noop := func() {}
+
+	for _, set := range release.Set {
+		if set.Sensitive {
+			e.redactor.Add(set.Value)
+		}
+	}
+
+	files := make(map[int][]byte)
+	for i, val := range release.Values {
+		if path, ok := val.(string); ok {
+			if data, err := os.ReadFile(path); err == nil && secretref.Contains(data) {
+				files[i] = data
+			}
+		}
+	}
+	sets := false
+	for _, set := range release.Set {
+		sets = sets || secretref.IsRef(set.Value)
+	}
+	if len(files) == 0 && !sets {
+		return release, noop, nil
+	}
+
+	removeStaleSecrets(time.Now())
+	dir, err := os.MkdirTemp("", secretsDirPattern)
+	if err != nil {
+		return release, noop, fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+	cleanup := func() { shredDir(dir) }
+
+	e.secrets.Begin(syncIDFrom(ctx))
+	get := func(ref string) (string, error) {
+		return e.resolveSecret(ctx, ref)
+	}
+
+	resolved, err := resolveSecrets(release, files, dir, get)
+	if err != nil {
+		cleanup()
+		return release, noop, fmt.Errorf("release %s: %w", release.Name, err)
+	}
+	return resolved, cleanup, nil
+}
+
+// resolveSecrets returns a copy of release whose secret set values are
+// --set-file values and whose values files in files, by index, are
+// rewritten with their references resolved, writing both to dir
+func resolveSecrets(release helmstate.Release, files map[int][]byte, dir string, get func(string) (string, error)) (helmstate.Release, error) {
+	release.Set = append([]helmstate.SetValue(nil), release.Set...)
+	for i, set := range release.Set {
+		if !secretref.IsRef(set.Value) {
+			continue
+		}
+		secret, err := get(set.Value)
+		if err != nil {
+			return release, err
+		}
+		path, err := writeSecretFile(dir, "set-*", []byte(secret))
+		if err != nil {
+			return release, err
+		}
+		release.Set[i] = helmstate.SetValue{Name: set.Name, File: path}
+	}
+
+	release.Values = append([]interface{}(nil), release.Values...)
+	for i, data := range files {
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			// helm reports the invalid file
+			continue
+		}
+		changed, err := resolveNode(&doc, get)
+		if err != nil {
+			return release, fmt.Errorf("values file %s: %w", release.Values[i], err)
+		}
+		if !changed {
+			continue
+		}
+		out, err := yaml.Marshal(&doc)
+		if err != nil {
+			return release, err
+		}
+		path, err := writeSecretFile(dir, "values-*.yaml", out)
+		if err != nil {
+			return release, err
+		}
+		release.Values[i] = path
+	}
+	return release, nil
+}
+
+// resolveNode replaces the secret references under node with their
+// secrets, reporting whether any were
+func resolveNode(node *yaml.Node, get func(string) (string, error)) (bool, error) {
+	if node.Kind == yaml.ScalarNode {
+		if !secretref.IsRef(node.Value) {
+			return false, nil
+		}
+		secret, err := get(node.Value)
+		if err != nil {
+			return false, err
+		}
+		node.Value, node.Tag, node.Style = secret, "!!str", 0
+		return true, nil
+	}
+
+	changed := false
+	for i, child := range node.Content {
+		// Keys of mappings are left alone
+		if node.Kind == yaml.MappingNode && i%2 == 0 {
+			continue
+		}
+		c, err := resolveNode(child, get)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || c
+	}
+	return changed, nil
+}
+
+// writeSecretFile writes data to a new file in dir readable only by its
+// owner and returns its path
+func writeSecretFile(dir, pattern string, data []byte) (string, error) {
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return "", fmt.Errorf("failed to write secret: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		return "", fmt.Errorf("failed to write secret: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// shredDir overwrites the files in dir with zeros before removing it, so
+// secrets don't linger on disk
+func shredDir(dir string) {
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if f, err := os.OpenFile(path, os.O_WRONLY, 0); err == nil {
+			if info, err := f.Stat(); err == nil {
+				f.Write(make([]byte, info.Size()))
+				f.Sync()
+			}
+			f.Close()
+		}
+	}
+	os.RemoveAll(dir)
+}
+
+// removeStaleSecrets shreds the secrets directories that syncs which
+// crashed before cleaning up left in the temp directory
+func removeStaleSecrets(now time.Time) {
+	dirs, _ := filepath.Glob(filepath.Join(os.TempDir(), secretsDirPattern))
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err == nil && now.Sub(info.ModTime()) > staleSecretsDir {
+			shredDir(dir)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package sync
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/httpclient"
+	"github.com/oleksiyp/helmfire/pkg/registryauth"
+	"github.com/oleksiyp/helmfire/pkg/secretref"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"github.com/oleksiyp/helmfire/pkg/vault"
+	"go.uber.org/zap"
+)
+
+func TestSyncReleaseVaultSecrets(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/secret/data/db" || r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"data":{"data":{"password":"hunter2","user":"app"},"metadata":{}}}`))
+	}))
+	defer server.Close()
+
+	// Fake helm logs its arguments, then the files they name
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	helm := filepath.Join(dir, "helm")
+	script := `#!/bin/sh
+echo "$@" >> ` + log + `
+for arg in "$@"; do
+  case "$arg" in
+  *helmfire-secrets-*) cat "${arg#*=}" >> ` + log + `; echo >> ` + log + ` ;;
+  esac
+done
+`
+	if err := os.WriteFile(helm, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake helm: %v", err)
+	}
+	values := filepath.Join(dir, "values.yaml")
+	if err := os.WriteFile(values, []byte("db:\n  user: vault:secret/db#user\n  host: db\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := vault.NewClient(vault.Config{Address: server.URL, Token: "root"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	executor.SetHelmBinary(helm)
+	executor.SetVault(client)
+
+	release := helmstate.Release{
+		Name:   "api",
+		Chart:  "./api",
+		Values: []interface{}{values},
+		Set:    []helmstate.SetValue{{Name: "db.password", Value: "vault:secret/db#password"}, {Name: "replicas", Value: "2"}},
+	}
+	if err := executor.SyncRelease(release); err != nil {
+		t.Fatalf("SyncRelease failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(log)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	args := lines[0]
+	if strings.Contains(args, "hunter2") || strings.Contains(args, values) {
+		t.Errorf("expected secrets kept out of the arguments and the values file replaced, got %s", args)
+	}
+	if !strings.Contains(args, "--set-file db.password=") || !strings.Contains(args, "--set replicas=2") {
+		t.Errorf("expected the secret passed as --set-file, got %s", args)
+	}
+	if !strings.Contains(string(data), "hunter2") || !strings.Contains(string(data), "user: app") || !strings.Contains(string(data), "host: db") {
+		t.Errorf("expected helm to read the resolved secrets, got:\n%s", data)
+	}
+	for _, arg := range strings.Fields(args) {
+		if strings.HasPrefix(arg, "db.password=") {
+			if _, err := os.Stat(filepath.Dir(strings.TrimPrefix(arg, "db.password="))); !os.IsNotExist(err) {
+				t.Errorf("expected the secrets directory removed after the sync, got %v", err)
+			}
+		}
+	}
+
+	// A missing secret fails the release before helm runs
+	os.Remove(log)
+	release.Set[0].Value = "vault:secret/db#missing"
+	if err := executor.SyncRelease(release); err == nil || !strings.Contains(err.Error(), "no key missing") {
+		t.Errorf("expected a missing key error, got %v", err)
+	}
+	if _, err := os.Stat(log); err == nil {
+		t.Error("expected helm not to run")
+	}
+}
+
+func TestWithSecretsUnchanged(t *testing.T) {
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	release := helmstate.Release{Name: "web", Set: []helmstate.SetValue{{Name: "a", Value: "b"}}}
+
+	// No Vault client is needed without references
+	t.Setenv(vault.EnvAddress, "")
+	got, cleanup, err := executor.withSecrets(context.Background(), release)
+	defer cleanup()
+	if err != nil || got.Set[0].Value != "b" || got.Set[0].File != "" {
+		t.Errorf("expected the release unchanged, got %+v %v", got, err)
+	}
+
+	release.Set[0].Value = "vault:secret/db#password"
+	if _, _, err := executor.withSecrets(context.Background(), release); err == nil || !strings.Contains(err.Error(), vault.EnvAddress) {
+		t.Errorf("expected a missing address error, got %v", err)
+	}
+}
+
+func TestSyncRepositoriesSecretCredentials(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	// Fake gcloud prints the password; fake helm logs its arguments and
+	// stdin, then fails echoing the password
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	gcloud := filepath.Join(dir, "gcloud")
+	if err := os.WriteFile(gcloud, []byte("#!/bin/sh\necho 's3cr3t-pass'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	helm := filepath.Join(dir, "helm")
+	script := `#!/bin/sh
+echo "$@" >> ` + log + `
+case "$*" in
+*--password-stdin*) cat >> ` + log + `; echo 'Error: 401 for s3cr3t-pass' >&2; exit 1 ;;
+esac
+`
+	if err := os.WriteFile(helm, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	executor.SetHelmBinary(helm)
+	executor.SetSecretCommand(secretref.SchemeGCP, gcloud)
+
+	err := executor.SyncRepositoriesContext(context.Background(), []helmstate.Repository{
+		{Name: "private", URL: "https://charts.example.com", Username: "ci", Password: "ref+gcpsecrets://my-project/charts-password"},
+	})
+	if err == nil || strings.Contains(err.Error(), "s3cr3t-pass") || !strings.Contains(err.Error(), secretref.Redacted) {
+		t.Errorf("expected the failure with the password redacted, got %v", err)
+	}
+
+	data, _ := os.ReadFile(log)
+	lines := strings.Split(string(data), "\n")
+	if !strings.Contains(lines[0], "--username ci --password-stdin") || strings.Contains(lines[0], "s3cr3t-pass") {
+		t.Errorf("expected the password passed on stdin, got %s", lines[0])
+	}
+	if !strings.Contains(lines[1], "s3cr3t-pass") {
+		t.Errorf("expected helm to read the password, got:\n%s", data)
+	}
+}
+
+func TestSyncRepositoriesTLS(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	// Fake helm logs its arguments and proxy
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	helm := filepath.Join(dir, "helm")
+	script := `#!/bin/sh
+echo "$@ proxy=$HTTPS_PROXY" >> ` + log + `
+`
+	if err := os.WriteFile(helm, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	defer httpclient.SetDefaults(httpclient.Options{})
+	if err := httpclient.SetDefaults(httpclient.Options{Proxy: "http://proxy.example.com:3128"}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(registryauth.EnvDockerConfig, dir)
+
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	executor.SetHelmBinary(helm)
+	err := executor.SyncRepositoriesContext(context.Background(), []helmstate.Repository{
+		{Name: "internal", URL: "https://charts.corp.example.com", CAFile: "/etc/ssl/corp.pem"},
+		{Name: "lab", URL: "https://charts.lab.example.com", SkipTLSVerify: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(log)
+	want := "repo add internal https://charts.corp.example.com --force-update --ca-file /etc/ssl/corp.pem proxy=http://proxy.example.com:3128\n" +
+		"repo add lab https://charts.lab.example.com --force-update --insecure-skip-tls-verify proxy=http://proxy.example.com:3128\n" +
+		"repo update internal lab proxy=http://proxy.example.com:3128\n"
+	if string(data) != want {
+		t.Errorf("unexpected helm calls:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestSyncRepositoriesDockerCredentials(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	// Fake helm logs its arguments and stdin; the docker config holds
+	// credentials of ghcr.io and charts.example.com
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	helm := filepath.Join(dir, "helm")
+	script := `#!/bin/sh
+echo "$@" >> ` + log + `
+case "$*" in
+*--password-stdin*) cat >> ` + log + `; echo >> ` + log + ` ;;
+esac
+`
+	if err := os.WriteFile(helm, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	config := `{"auths": {
+  "ghcr.io": {"auth": "` + base64.StdEncoding.EncodeToString([]byte("ci:ghcr-token")) + `"},
+  "charts.example.com": {"auth": "` + base64.StdEncoding.EncodeToString([]byte("bob:chart-pass")) + `"}
+}}`
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(registryauth.EnvDockerConfig, dir)
+
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	executor.SetHelmBinary(helm)
+	err := executor.SyncRepositoriesContext(context.Background(), []helmstate.Repository{
+		{Name: "acme", URL: "oci://ghcr.io/acme/charts", OCI: true},
+		{Name: "public", URL: "oci://registry.example.com/charts", OCI: true},
+		{Name: "private", URL: "https://charts.example.com"},
+		{Name: "own", URL: "https://charts.example.com/own", Username: "alice", Password: "alice-pass"},
+		{Name: "skipped", URL: "https://charts.example.com/skipped", CredentialHelper: registryauth.HelperNone},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(log)
+	want := "registry login ghcr.io --username ci --password-stdin\nghcr-token\n" +
+		"repo add private https://charts.example.com --force-update --username bob --password-stdin\nchart-pass\n" +
+		"repo add own https://charts.example.com/own --force-update --username alice --password alice-pass\n" +
+		"repo add skipped https://charts.example.com/skipped --force-update\n" +
+		"repo update private own skipped\n"
+	if string(data) != want {
+		t.Errorf("unexpected helm calls:\n%s\nwant:\n%s", data, want)
+	}
+
+	err = executor.SyncRepositoriesContext(context.Background(), []helmstate.Repository{
+		{Name: "ecr", URL: "oci://123.dkr.ecr.eu-west-1.amazonaws.com", OCI: true, CredentialHelper: "missing-helper"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "docker-credential-missing-helper") {
+		t.Errorf("expected the repository's own credential helper to fail it, got %v", err)
+	}
+}
+
+func TestPruneRepositories(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	// Fake helm listing three repositories, logging the others calls
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	helm := filepath.Join(dir, "helm")
+	script := `#!/bin/sh
+case "$*" in
+"repo list --output json") echo '[{"name":"bitnami","url":"https://charts.bitnami.com/bitnami"},{"name":"old","url":"https://old.example.com"},{"name":"stale","url":"https://stale.example.com"}]' ;;
+*) echo "$@" >> ` + log + ` ;;
+esac
+`
+	if err := os.WriteFile(helm, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	executor.SetHelmBinary(helm)
+	record := filepath.Join(dir, "state", RepositoryRecordFile)
+	executor.SetRepositoryRecord(record)
+
+	// stale was known to helm before, so it isn't recorded as added
+	repos := []helmstate.Repository{
+		{Name: "fresh", URL: "https://fresh.example.com"},
+		{Name: "stale", URL: "https://stale.example.com"},
+	}
+	if err := executor.SyncRepositoriesContext(context.Background(), repos); err != nil {
+		t.Fatalf("SyncRepositoriesContext failed: %v", err)
+	}
+	if added, err := readRepositoryRecord(record); err != nil || strings.Join(added, ",") != "fresh" {
+		t.Fatalf("expected fresh recorded, got %v, %v", added, err)
+	}
+	if err := writeRepositoryRecord(record, []string{"bitnami", "gone", "old"}); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(log)
+
+	keep := []helmstate.Repository{{Name: "bitnami", URL: "https://charts.bitnami.com/bitnami"}}
+	executor.SetDryRun(true)
+	pruned, err := executor.PruneRepositories(context.Background(), keep)
+	if err != nil || strings.Join(pruned, ",") != "old" {
+		t.Fatalf("expected only old pruned, got %v, %v", pruned, err)
+	}
+	if _, err := os.Stat(log); !os.IsNotExist(err) {
+		t.Errorf("expected nothing removed in a dry run")
+	}
+
+	executor.SetDryRun(false)
+	if _, err := executor.PruneRepositories(context.Background(), keep); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(log)
+	if string(data) != "repo remove old\n" {
+		t.Errorf("unexpected helm calls:\n%s", data)
+	}
+	if added, err := readRepositoryRecord(record); err != nil || strings.Join(added, ",") != "bitnami" {
+		t.Errorf("expected only bitnami left recorded, got %v, %v", added, err)
+	}
+
+	// Without a record nothing is pruned
+	executor.SetRepositoryRecord("")
+	if pruned, err := executor.PruneRepositories(context.Background(), nil); err != nil || len(pruned) != 0 {
+		t.Errorf("expected nothing pruned without a record, got %v, %v", pruned, err)
+	}
+}
+
+func TestWithSecretsSensitiveSet(t *testing.T) {
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	release := helmstate.Release{Name: "web", Set: []helmstate.SetValue{
+		{Name: "api.key", Value: "s3cr3t-key", Sensitive: true},
+		{Name: "replicas", Value: "3"},
+	}}
+
+	got, cleanup, err := executor.withSecrets(context.Background(), release)
+	defer cleanup()
+	if err != nil || got.Set[0].Value != "s3cr3t-key" {
+		t.Fatalf("expected sensitive values passed on unchanged, got %+v %v", got, err)
+	}
+
+	args := strings.Join(executor.redactArgs(valuesArgs(got)), " ")
+	if args != "--set api.key=[redacted] --set replicas=3" {
+		t.Errorf("expected the sensitive value masked in logged args, got %q", args)
+	}
+	if msg := executor.redact("Error: invalid key s3cr3t-key"); msg != "Error: invalid key [redacted]" {
+		t.Errorf("expected the sensitive value masked in errors, got %q", msg)
+	}
+}
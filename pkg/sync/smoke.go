@@ -0,0 +1,259 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/tracing"
+	"go.uber.org/zap"
+)
+
+// maxTestLogs bounds the logs kept per test, keeping their end
+const maxTestLogs = 4096
+
+// testJobPoll is how often the status of a test Job is checked
+var testJobPoll = 2 * time.Second
+
+// LabelTestOf is set on test Jobs to the release they test
+const LabelTestOf = "helmfire.dev/test-of"
+
+// TestResult is the outcome of one smoke test of a release
+type TestResult struct {
+	Name     string        `json:"name"`
+	Passed   bool          `json:"passed"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+
+	// Logs are the end of the test's output
+	Logs string `json:"logs,omitempty"`
+}
+
+// runTests runs the smoke tests of a synced release in order, returning
+// their results and an error naming those that failed
+func (e *Executor) runTests(ctx context.Context, release helmstate.Release, namespace string) (_ []TestResult, err error) {
+	if len(release.Tests) == 0 || e.dryRun {
+		return nil, nil
+	}
+	ctx, span := tracing.Start(ctx, "release.test", tracing.Int("tests", len(release.Tests)))
+	defer func() { span.End(err) }()
+
+	var results []TestResult
+	var failed []string
+	for _, test := range release.Tests {
+		timeout := test.Timeout
+		if timeout <= 0 {
+			timeout = helmstate.DefaultTestTimeout
+		}
+		testCtx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+		var logs string
+		var testErr error
+		if test.Helm != nil {
+			logs, testErr = e.runHelmTest(testCtx, release, namespace, *test.Helm, timeout)
+		} else {
+			logs, testErr = e.runTestJob(testCtx, release, namespace, test)
+		}
+		cancel()
+
+		result := TestResult{
+			Name:     test.String(),
+			Passed:   testErr == nil,
+			Duration: time.Since(start),
+			Logs:     tailLogs(e.redact(logs)),
+		}
+		if testErr != nil {
+			result.Error = e.redact(testErr.Error())
+			failed = append(failed, result.Name)
+		}
+		results = append(results, result)
+		e.logger.Info("smoke test finished",
+			zap.String("release", release.Name),
+			zap.String("test", result.Name),
+			zap.Bool("passed", result.Passed),
+			zap.Duration("duration", result.Duration))
+	}
+
+	if len(failed) > 0 {
+		return results, fmt.Errorf("smoke tests failed: %s", strings.Join(failed, ", "))
+	}
+	return results, nil
+}
+
+// runHelmTest runs the chart's test hooks, returning helm's output with the
+// logs of the test pods
+func (e *Executor) runHelmTest(ctx context.Context, release helmstate.Release, namespace string, test helmstate.HelmTest, timeout time.Duration) (string, error) {
+	args := []string{"test", release.Name, "--namespace", namespace, "--logs", "--timeout", timeout.String()}
+	for _, filter := range test.Filter {
+		args = append(args, "--filter", filter)
+	}
+	if kubeContext := e.ReleaseKubeContext(release); kubeContext != "" {
+		args = append(args, "--kube-context", kubeContext)
+	}
+
+	stdout, stderr, err := e.runTool(ctx, e.helmBinary, nil, nil, args...)
+	logs := strings.TrimSpace(stdout + "\n" + stderr)
+	if err != nil {
+		return logs, fmt.Errorf("helm test failed: %w", err)
+	}
+	return logs, nil
+}
+
+// testJob is the Job a TestJob runs as
+type testJob struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		GenerateName string            `json:"generateName"`
+		Namespace    string            `json:"namespace"`
+		Labels       map[string]string `json:"labels"`
+	} `json:"metadata"`
+	Spec struct {
+		BackoffLimit            int `json:"backoffLimit"`
+		TTLSecondsAfterFinished int `json:"ttlSecondsAfterFinished"`
+		Template                struct {
+			Metadata struct {
+				Labels map[string]string `json:"labels"`
+			} `json:"metadata"`
+			Spec struct {
+				RestartPolicy string          `json:"restartPolicy"`
+				Containers    []testContainer `json:"containers"`
+			} `json:"spec"`
+		} `json:"template"`
+	} `json:"spec"`
+}
+
+type testContainer struct {
+	Name    string         `json:"name"`
+	Image   string         `json:"image"`
+	Command []string       `json:"command,omitempty"`
+	Args    []string       `json:"args,omitempty"`
+	Env     []testEnvValue `json:"env,omitempty"`
+}
+
+type testEnvValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// jobStatus is the part of a Job's status runTestJob reads
+type jobStatus struct {
+	Status struct {
+		Succeeded int `json:"succeeded"`
+		Failed    int `json:"failed"`
+	} `json:"status"`
+}
+
+// nonDNSChars are the characters not allowed in the names of resources
+var nonDNSChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// newTestJob builds the Job running a test of release
+func newTestJob(release, namespace string, test helmstate.ReleaseTest) testJob {
+	name := nonDNSChars.ReplaceAllString(strings.ToLower(release+"-test-"+test.Name), "-")
+	if len(name) > 50 {
+		name = name[:50]
+	}
+	labels := map[string]string{LabelManagedBy: "helmfire", LabelTestOf: release}
+
+	var job testJob
+	job.APIVersion, job.Kind = "batch/v1", "Job"
+	job.Metadata.GenerateName = strings.TrimSuffix(name, "-") + "-"
+	job.Metadata.Namespace = namespace
+	job.Metadata.Labels = labels
+	job.Spec.TTLSecondsAfterFinished = 3600
+	job.Spec.Template.Metadata.Labels = labels
+	job.Spec.Template.Spec.RestartPolicy = "Never"
+
+	container := testContainer{Name: "test", Image: test.Job.Image, Command: test.Job.Command, Args: test.Job.Args}
+	for key, value := range test.Job.Env {
+		container.Env = append(container.Env, testEnvValue{Name: key, Value: value})
+	}
+	sort.Slice(container.Env, func(i, j int) bool { return container.Env[i].Name < container.Env[j].Name })
+	job.Spec.Template.Spec.Containers = []testContainer{container}
+	return job
+}
+
+// runTestJob creates the Job of a test, waits for it to finish and returns
+// the logs of its pod. The Job is deleted afterwards, or by its TTL when
+// that fails.
+func (e *Executor) runTestJob(ctx context.Context, release helmstate.Release, namespace string, test helmstate.ReleaseTest) (string, error) {
+	manifest, err := json.Marshal(newTestJob(release.Name, namespace, test))
+	if err != nil {
+		return "", err
+	}
+	kubeContext := e.ReleaseKubeContext(release)
+	stdout, stderr, err := e.runTool(ctx, e.kubectl, strings.NewReader(string(manifest)), nil,
+		kubectlArgs(kubeContext, "create", "--filename", "-", "--output", "name")...)
+	if err != nil {
+		return "", fmt.Errorf("failed to create test job: %w: %s", err, strings.TrimSpace(stderr))
+	}
+	job := strings.TrimSpace(stdout)
+	defer func() {
+		// The test's deadline may have passed; deleting still has to happen
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if _, stderr, err := e.runTool(cleanupCtx, e.kubectl, nil, nil, kubectlArgs(kubeContext,
+			"delete", job, "--namespace", namespace, "--ignore-not-found", "--wait=false", "--cascade=background")...); err != nil {
+			e.logger.Warn("failed to delete test job", zap.String("job", job), zap.Error(err), zap.String("stderr", stderr))
+		}
+	}()
+
+	passed, waitErr := e.waitTestJob(ctx, job, namespace, kubeContext)
+	logsCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	logs, _, err := e.runTool(logsCtx, e.kubectl, nil, nil, kubectlArgs(kubeContext,
+		"logs", job, "--namespace", namespace, "--all-containers")...)
+	if err != nil {
+		e.logger.Debug("failed to get test job logs", zap.String("job", job), zap.Error(err))
+	}
+
+	switch {
+	case waitErr != nil:
+		return logs, waitErr
+	case !passed:
+		return logs, fmt.Errorf("%s failed", job)
+	}
+	return logs, nil
+}
+
+// waitTestJob polls a Job until it succeeded or failed
+func (e *Executor) waitTestJob(ctx context.Context, job, namespace, kubeContext string) (bool, error) {
+	for {
+		stdout, stderr, err := e.runTool(ctx, e.kubectl, nil, nil, kubectlArgs(kubeContext,
+			"get", job, "--namespace", namespace, "--output", "json")...)
+		if err == nil {
+			var status jobStatus
+			if err := json.Unmarshal([]byte(stdout), &status); err != nil {
+				return false, fmt.Errorf("invalid job status: %w", err)
+			}
+			if status.Status.Succeeded > 0 || status.Status.Failed > 0 {
+				return status.Status.Succeeded > 0, nil
+			}
+		} else if ctx.Err() == nil {
+			e.logger.Debug("failed to get test job status", zap.String("job", job), zap.Error(err), zap.String("stderr", stderr))
+		}
+
+		select {
+		case <-ctx.Done():
+			return false, fmt.Errorf("%s still running: %w", job, ErrTimeout)
+		case <-time.After(testJobPoll):
+		}
+	}
+}
+
+// tailLogs keeps the end of logs within maxTestLogs
+func tailLogs(logs string) string {
+	if len(logs) <= maxTestLogs {
+		return logs
+	}
+	logs = logs[len(logs)-maxTestLogs:]
+	if i := strings.IndexByte(logs, '\n'); i >= 0 {
+		logs = logs[i+1:]
+	}
+	return "…\n" + logs
+}
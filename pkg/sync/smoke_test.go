@@ -0,0 +1,130 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"go.uber.org/zap"
+)
+
+func TestSmokeTests(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm and kubectl scripts require a POSIX shell")
+	}
+
+	// Fake helm fails its tests when $TEST_FAIL is set; fake kubectl saves
+	// the Job it creates, which fails the same way
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	job := filepath.Join(dir, "job.json")
+	helm := filepath.Join(dir, "helm")
+	kubectl := filepath.Join(dir, "kubectl")
+	helmScript := `#!/bin/sh
+case "$1" in
+test) echo "$@" >> ` + log + `; echo "POD LOGS: web-test-connection"; [ -z "$TEST_FAIL" ] || { echo 'Error: pod web-test-connection failed' >&2; exit 1; } ;;
+*) echo '{"name":"web","namespace":"apps","version":3,"info":{"status":"deployed"}}' ;;
+esac
+`
+	kubectlScript := `#!/bin/sh
+echo "$@" >> ` + log + `
+case "$1" in
+create) cat > ` + job + `; echo job.batch/web-test-api-x7k2p ;;
+get) if [ -n "$TEST_FAIL" ]; then echo '{"status":{"failed":1}}'; else echo '{"status":{"succeeded":1}}'; fi ;;
+logs) echo "GET /api 200" ;;
+esac
+`
+	if err := os.WriteFile(helm, []byte(helmScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(kubectl, []byte(kubectlScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	executor.SetHelmBinary(helm)
+	executor.SetKubectl(kubectl)
+	executor.SetCreateNamespace(false)
+	release := helmstate.Release{Name: "web", Namespace: "apps", Chart: "./web", Tests: []helmstate.ReleaseTest{
+		{Helm: &helmstate.HelmTest{Filter: []string{"name=web-test-connection"}}},
+		{Name: "api", Job: &helmstate.TestJob{Image: "curlimages/curl", Args: []string{"http://web/api"}, Env: map[string]string{"RETRIES": "3"}}},
+	}}
+
+	helmRelease, err := executor.UpgradeReleaseContext(context.Background(), release)
+	if err != nil {
+		t.Fatalf("UpgradeReleaseContext failed: %v", err)
+	}
+	if helmRelease == nil || len(helmRelease.Tests) != 2 {
+		t.Fatalf("unexpected helm release %+v", helmRelease)
+	}
+	for _, test := range helmRelease.Tests {
+		if !test.Passed || test.Error != "" {
+			t.Errorf("expected test %s to pass, got %+v", test.Name, test)
+		}
+	}
+	if helmRelease.Tests[0].Name != "helm test" || !strings.Contains(helmRelease.Tests[0].Logs, "POD LOGS") {
+		t.Errorf("unexpected helm test result %+v", helmRelease.Tests[0])
+	}
+	if helmRelease.Tests[1].Name != "api" || helmRelease.Tests[1].Logs != "GET /api 200\n" {
+		t.Errorf("unexpected job test result %+v", helmRelease.Tests[1])
+	}
+
+	data, _ := os.ReadFile(log)
+	calls := strings.Split(strings.TrimSpace(string(data)), "\n")
+	want := []string{
+		"test web --namespace apps --logs --timeout 5m0s --filter name=web-test-connection",
+		"create --filename - --output name",
+		"get job.batch/web-test-api-x7k2p --namespace apps --output json",
+		"logs job.batch/web-test-api-x7k2p --namespace apps --all-containers",
+		"delete job.batch/web-test-api-x7k2p --namespace apps --ignore-not-found --wait=false --cascade=background",
+	}
+	if strings.Join(calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected calls:\n%s", data)
+	}
+
+	var created testJob
+	data, _ = os.ReadFile(job)
+	if err := json.Unmarshal(data, &created); err != nil {
+		t.Fatalf("invalid job %s: %v", data, err)
+	}
+	container := created.Spec.Template.Spec.Containers[0]
+	if created.Metadata.GenerateName != "web-test-api-" || created.Metadata.Labels[LabelTestOf] != "web" ||
+		created.Spec.Template.Spec.RestartPolicy != "Never" || container.Image != "curlimages/curl" ||
+		len(container.Env) != 1 || container.Env[0].Name != "RETRIES" {
+		t.Errorf("unexpected job %s", data)
+	}
+
+	// Failing tests fail the release, which helm did deploy, and keep
+	// their logs
+	t.Setenv("TEST_FAIL", "1")
+	helmRelease, err = executor.UpgradeReleaseContext(context.Background(), release)
+	if err == nil || err.Error() != "smoke tests failed: helm test, api" {
+		t.Fatalf("expected both tests to fail, got %v", err)
+	}
+	if helmRelease == nil || helmRelease.Revision != 3 || len(helmRelease.Tests) != 2 {
+		t.Fatalf("expected the deployed release returned with the error, got %+v", helmRelease)
+	}
+	if failed := helmRelease.Tests[0]; failed.Passed || !strings.Contains(failed.Logs, "pod web-test-connection failed") {
+		t.Errorf("unexpected failed helm test %+v", failed)
+	}
+	if failed := helmRelease.Tests[1]; failed.Passed || failed.Error != "job.batch/web-test-api-x7k2p failed" {
+		t.Errorf("unexpected failed job test %+v", failed)
+	}
+}
+
+func TestTailLogs(t *testing.T) {
+	if logs := tailLogs("short\n"); logs != "short\n" {
+		t.Errorf("expected short logs kept, got %q", logs)
+	}
+	long := strings.Repeat("line of output\n", 1000) + "the end\n"
+	logs := tailLogs(long)
+	if len(logs) > maxTestLogs+10 || !strings.HasPrefix(logs, "…\nline of output\n") || !strings.HasSuffix(logs, "the end\n") {
+		t.Errorf("unexpected tail %q", logs[:40])
+	}
+}
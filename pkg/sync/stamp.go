@@ -0,0 +1,215 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"gopkg.in/yaml.v3"
+)
+
+// Labels and annotations stamped on the resources of a release
+const (
+	LabelManaged                = "helmfire.dev/managed"
+	LabelRelease                = "helmfire.dev/release"
+	AnnotationSyncID            = "helmfire.dev/sync-id"
+	AnnotationSubstitutedImages = "helmfire.dev/substituted-images"
+
+	// AnnotationSubstitutionsChecksum is set on pod templates so workloads
+	// restart when the image substitutions of their release change
+	AnnotationSubstitutionsChecksum = "helmfire.dev/substitutions-checksum"
+)
+
+// podTemplateKinds are the workloads whose pods restart when their
+// spec.template changes
+var podTemplateKinds = map[string]bool{
+	"Deployment":  true,
+	"StatefulSet": true,
+	"DaemonSet":   true,
+	"ReplicaSet":  true,
+}
+
+// Stamp configures the labels and annotations the post-renderer adds to the
+// metadata of every rendered resource
+type Stamp struct {
+	// Managed adds LabelManaged, LabelRelease and AnnotationSyncID, and
+	// AnnotationSubstitutedImages to resources whose images were substituted
+	Managed bool
+
+	// Labels and Annotations are added as given
+	Labels      map[string]string
+	Annotations map[string]string
+
+	// RestartOnSubstitution adds AnnotationSubstitutionsChecksum to the pod
+	// templates of releases with image substitutions
+	RestartOnSubstitution bool
+}
+
+// Enabled reports whether the stamp adds anything
+func (s Stamp) Enabled() bool {
+	return s.Managed || len(s.Labels) > 0 || len(s.Annotations) > 0
+}
+
+// ParseStampValues parses key=value pairs, as given to the --stamp-label and
+// --stamp-annotation flags
+func ParseStampValues(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	values := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid %q: must be key=value", pair)
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+type syncIDKey struct{}
+
+// WithSyncID returns a context whose release syncs are stamped with id
+func WithSyncID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, syncIDKey{}, id)
+}
+
+// syncIDFrom returns the sync ID of ctx, or a new one
+func syncIDFrom(ctx context.Context) string {
+	if id, ok := ctx.Value(syncIDKey{}).(string); ok && id != "" {
+		return id
+	}
+	return newSyncID()
+}
+
+// newSyncID returns a sync ID: the UTC start time and a random suffix
+func newSyncID() string {
+	b := make([]byte, 3)
+	rand.Read(b)
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b)
+}
+
+// releaseStamp returns the labels and annotations stamped on the resources
+// of a release synced with syncID
+func (s Stamp) releaseStamp(release, syncID string) (labels, annotations map[string]string) {
+	labels = make(map[string]string, len(s.Labels)+2)
+	annotations = make(map[string]string, len(s.Annotations)+1)
+	if s.Managed {
+		labels[LabelManaged] = "true"
+		labels[LabelRelease] = release
+		annotations[AnnotationSyncID] = syncID
+	}
+	for k, v := range s.Labels {
+		labels[k] = v
+	}
+	for k, v := range s.Annotations {
+		annotations[k] = v
+	}
+	return labels, annotations
+}
+
+// substitutionsChecksum returns the SHA-256 of image substitutions,
+// independent of their order
+func substitutionsChecksum(substitutions []substitute.ImageSubstitution) string {
+	lines := make([]string, 0, len(substitutions))
+	for _, sub := range substitutions {
+		lines = append(lines, sub.Original+"="+sub.Replacement)
+	}
+	sort.Strings(lines)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// stampDocument adds labels and annotations to the metadata of the resource
+// in a rendered YAML document, and podAnnotations to the pod template of
+// workloads. Documents without a resource are returned unchanged.
+func stampDocument(doc []byte, labels, annotations, podAnnotations map[string]string) ([]byte, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(doc, &node); err != nil {
+		return nil, err
+	}
+	if node.Kind != yaml.DocumentNode || len(node.Content) == 0 || node.Content[0].Kind != yaml.MappingNode {
+		return doc, nil
+	}
+	resource := node.Content[0]
+	if mappingValue(resource, "kind") == nil {
+		return doc, nil
+	}
+
+	metadata := mappingEntry(resource, "metadata")
+	if len(labels) > 0 {
+		setMappingValues(mappingEntry(metadata, "labels"), labels)
+	}
+	if len(annotations) > 0 {
+		setMappingValues(mappingEntry(metadata, "annotations"), annotations)
+	}
+	if kind := mappingValue(resource, "kind"); len(podAnnotations) > 0 && podTemplateKinds[kind.Value] {
+		template := mappingEntry(mappingEntry(resource, "spec"), "template")
+		setMappingValues(mappingEntry(mappingEntry(template, "metadata"), "annotations"), podAnnotations)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// mappingValue returns the value of key in a mapping node, or nil
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// mappingEntry returns the mapping under key, replacing a null or missing
+// value with an empty mapping
+func mappingEntry(mapping *yaml.Node, key string) *yaml.Node {
+	value := mappingValue(mapping, key)
+	if value != nil && value.Kind == yaml.MappingNode {
+		return value
+	}
+
+	entry := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if value != nil {
+		*value = *entry
+		return value
+	}
+	mapping.Content = append(mapping.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, entry)
+	return entry
+}
+
+// setMappingValues sets string values in a mapping node, in key order
+func setMappingValues(mapping *yaml.Node, values map[string]string) {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: values[k]}
+		if existing := mappingValue(mapping, k); existing != nil {
+			*existing = *value
+			continue
+		}
+		mapping.Content = append(mapping.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k}, value)
+	}
+}
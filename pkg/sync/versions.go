@@ -0,0 +1,122 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"go.uber.org/zap"
+)
+
+// ChartVersion compares the chart version a release pins with the latest
+// version in its repository
+type ChartVersion struct {
+	Release   string `json:"release"`
+	Namespace string `json:"namespace,omitempty"`
+	Chart     string `json:"chart"`
+	// Pinned is the release's version: a version, a constraint such as
+	// "~1.4", or empty when the release takes the latest version
+	Pinned string `json:"pinned,omitempty"`
+	Latest string `json:"latest,omitempty"`
+	// Outdated is set when Latest is newer than a pinned version, or
+	// outside a pinned constraint
+	Outdated bool `json:"outdated"`
+	// Local charts have no repository to compare with
+	Local bool   `json:"local,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// ChartVersions looks up the latest version of the chart of each release.
+// Repositories must be synced first. Lookups that fail are reported in the
+// release's Error.
+func (e *Executor) ChartVersions(ctx context.Context, releases []helmstate.Release) []ChartVersion {
+	type lookup struct {
+		version string
+		err     error
+	}
+	// Releases often share a chart; look each one up once
+	lookups := make(map[string]lookup)
+
+	versions := make([]ChartVersion, 0, len(releases))
+	for _, release := range releases {
+		v := ChartVersion{
+			Release:   release.Name,
+			Namespace: e.ReleaseNamespace(release),
+			Chart:     release.Chart,
+			Pinned:    release.Version,
+		}
+		if !helmstate.IsRemoteChart(release.Chart) {
+			v.Local = true
+			versions = append(versions, v)
+			continue
+		}
+
+		l, ok := lookups[release.Chart]
+		if !ok {
+			l.version, l.err = e.LatestChartVersion(ctx, release.Chart)
+			lookups[release.Chart] = l
+		}
+		v.Latest = l.version
+		err := l.err
+		if err == nil {
+			v.Outdated, err = isOutdated(release.Version, l.version)
+		}
+		if err != nil {
+			v.Error = err.Error()
+		}
+		versions = append(versions, v)
+	}
+	return versions
+}
+
+// LatestChartVersion returns the latest stable version of a repository
+// chart, such as bitnami/nginx, or of an OCI chart
+func (e *Executor) LatestChartVersion(ctx context.Context, chart string) (string, error) {
+	if strings.HasPrefix(chart, "oci://") {
+		meta, err := e.showChart(ctx, chart, "")
+		if err != nil {
+			return "", err
+		}
+		return meta.Version, nil
+	}
+
+	out, err := e.runHelmOutput(ctx, "search", "repo", chart, "--output", "json")
+	if err != nil {
+		return "", err
+	}
+	var results []struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal([]byte(out), &results); err != nil {
+		return "", fmt.Errorf("failed to parse helm search output: %w", err)
+	}
+	// Searches match substrings, so bitnami/nginx also finds
+	// bitnami/nginx-ingress-controller
+	for _, result := range results {
+		if strings.EqualFold(result.Name, chart) {
+			e.logger.Debug("latest chart version", zap.String("chart", chart), zap.String("version", result.Version))
+			return result.Version, nil
+		}
+	}
+	return "", fmt.Errorf("chart %s not found in its repository; is the repository in the helmfile?", chart)
+}
+
+// isOutdated reports whether latest is newer than pinned, a version, or
+// outside it, a constraint. Unpinned releases already take the latest.
+func isOutdated(pinned, latest string) (bool, error) {
+	if pinned == "" {
+		return false, nil
+	}
+	if cmp, err := substitute.CompareVersions(latest, pinned); err == nil {
+		return cmp > 0, nil
+	}
+	ok, err := substitute.SatisfiesConstraint(latest, pinned)
+	if err != nil {
+		return false, err
+	}
+	return !ok, nil
+}
@@ -0,0 +1,75 @@
+package sync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"go.uber.org/zap"
+)
+
+func TestChartVersions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake helm script requires a POSIX shell")
+	}
+
+	// Fake helm logs its arguments and finds bitnami/nginx, among others
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	helm := filepath.Join(dir, "helm")
+	script := `#!/bin/sh
+echo "$@" >> ` + log + `
+case "$3" in
+bitnami/nginx) echo '[{"name":"bitnami/nginx","version":"15.4.2"},{"name":"bitnami/nginx-ingress-controller","version":"11.0.0"}]' ;;
+*) echo '[]' ;;
+esac
+`
+	if err := os.WriteFile(helm, []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write fake helm: %v", err)
+	}
+
+	executor := NewExecutor(zap.NewNop(), substitute.NewManager())
+	executor.SetHelmBinary(helm)
+	versions := executor.ChartVersions(context.Background(), []helmstate.Release{
+		{Name: "web", Chart: "bitnami/nginx", Version: "15.0.0"},
+		{Name: "edge", Chart: "bitnami/nginx", Version: "~15.4"},
+		{Name: "latest", Chart: "bitnami/nginx"},
+		{Name: "app", Chart: "./charts/app"},
+		{Name: "cache", Chart: "bitnami/redis", Version: "17.0.0"},
+	})
+
+	expected := []struct {
+		latest   string
+		outdated bool
+		local    bool
+		failed   bool
+	}{
+		{latest: "15.4.2", outdated: true},
+		{latest: "15.4.2"},
+		{latest: "15.4.2"},
+		{local: true},
+		{failed: true},
+	}
+	if len(versions) != len(expected) {
+		t.Fatalf("expected %d versions, got %+v", len(expected), versions)
+	}
+	for i, want := range expected {
+		v := versions[i]
+		if v.Latest != want.latest || v.Outdated != want.outdated || v.Local != want.local || (v.Error != "") != want.failed {
+			t.Errorf("%s: unexpected %+v", v.Release, v)
+		}
+	}
+	if v := versions[0]; v.Namespace != "default" || v.Pinned != "15.0.0" {
+		t.Errorf("expected the release's namespace and pinned version, got %+v", v)
+	}
+
+	data, _ := os.ReadFile(log)
+	if searches := strings.Count(string(data), "search repo bitnami/nginx"); searches != 1 {
+		t.Errorf("expected bitnami/nginx to be searched once, got %d times:\n%s", searches, data)
+	}
+}
@@ -0,0 +1,39 @@
+package sync
+
+import (
+	"context"
+
+	"github.com/oleksiyp/helmfire/pkg/helmstate"
+)
+
+// workloadKinds are the kinds that run replicas of pods
+var workloadKinds = map[string]bool{
+	"Deployment":  true,
+	"StatefulSet": true,
+	"DaemonSet":   true,
+}
+
+// Workloads returns the Deployments, StatefulSets and DaemonSets a release
+// renders, as Kind/name
+func (e *Executor) Workloads(ctx context.Context, release helmstate.Release) ([]string, error) {
+	chart, namespace, err := e.resolveReleaseContext(ctx, release)
+	if err != nil {
+		return nil, err
+	}
+	manifests, err := e.renderManifests(ctx, release, chart, namespace)
+	if err != nil {
+		return nil, err
+	}
+	resources, err := parseRenderedResources(manifests)
+	if err != nil {
+		return nil, err
+	}
+
+	var workloads []string
+	for _, resource := range resources {
+		if workloadKinds[resource.Kind] {
+			workloads = append(workloads, resource.Kind+"/"+resource.Metadata.Name)
+		}
+	}
+	return workloads, nil
+}
@@ -0,0 +1,344 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/httpclient"
+)
+
+// Batching of exported spans
+const (
+	batchSize     = 256
+	batchInterval = 5 * time.Second
+	exportTimeout = 10 * time.Second
+)
+
+// Config configures the exporter
+type Config struct {
+	// Endpoint is the base URL of the OTLP/HTTP collector, e.g.
+	// http://localhost:4318; spans are posted to its /v1/traces
+	Endpoint string
+	// TracesEndpoint, when set, is the full URL spans are posted to and
+	// takes precedence over Endpoint
+	TracesEndpoint string
+	// Headers are sent with every export, e.g. for authentication
+	Headers map[string]string
+	// ServiceName is the service.name of exported spans
+	ServiceName string
+	// OnError is called when an export fails
+	OnError func(error)
+}
+
+// ConfigFromEnv returns the configuration the standard OTEL_* variables
+// describe
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Endpoint:       os.Getenv(EnvEndpoint),
+		TracesEndpoint: os.Getenv(EnvTracesEndpoint),
+		ServiceName:    os.Getenv(EnvServiceName),
+	}
+	if headers := os.Getenv(EnvHeaders); headers != "" {
+		cfg.Headers = ParseHeaders(headers)
+	}
+	return cfg
+}
+
+// ParseHeaders parses headers in the OTEL_EXPORTER_OTLP_HEADERS format,
+// comma-separated key=value pairs with URL-encoded values
+func ParseHeaders(s string) map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			continue
+		}
+		if decoded, err := url.QueryUnescape(strings.TrimSpace(value)); err == nil {
+			value = decoded
+		}
+		headers[key] = value
+	}
+	return headers
+}
+
+// Enabled reports whether the configuration names an endpoint
+func (c Config) Enabled() bool {
+	return c.Endpoint != "" || c.TracesEndpoint != ""
+}
+
+// tracesURL returns the URL spans are posted to
+func (c Config) tracesURL() string {
+	if c.TracesEndpoint != "" {
+		return c.TracesEndpoint
+	}
+	return strings.TrimRight(c.Endpoint, "/") + "/v1/traces"
+}
+
+// headerString formats the headers the way ParseHeaders parses them
+func (c Config) headerString() string {
+	pairs := make([]string, 0, len(c.Headers))
+	for key, value := range c.Headers {
+		pairs = append(pairs, key+"="+url.QueryEscape(value))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Provider batches ended spans and exports them in the background
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu      sync.Mutex
+	queue   []spanData
+	flush   chan struct{}
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// spanData is an ended span
+type spanData struct {
+	trace      traceID
+	id, parent spanID
+	name       string
+	start, end time.Time
+	attrs      []Attr
+	err        string
+}
+
+// Init starts exporting the spans Start records as cfg says. The returned
+// function flushes the remaining spans and stops exporting; it must be
+// called before the process exits. Init does nothing when cfg names no
+// endpoint.
+func Init(cfg Config) (shutdown func(context.Context) error, err error) {
+	if !cfg.Enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+	if _, err := url.ParseRequestURI(cfg.tracesURL()); err != nil {
+		return nil, fmt.Errorf("invalid OTLP endpoint: %w", err)
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = DefaultServiceName
+	}
+
+	p := &Provider{
+		config:  cfg,
+		client:  httpclient.New(exportTimeout),
+		flush:   make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go p.loop()
+	global.Store(p)
+	return p.Shutdown, nil
+}
+
+// Shutdown flushes the remaining spans and stops exporting
+func (p *Provider) Shutdown(ctx context.Context) error {
+	global.CompareAndSwap(p, nil)
+	select {
+	case <-p.stop:
+	default:
+		close(p.stop)
+	}
+	select {
+	case <-p.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// enqueue adds an ended span to the next batch
+func (p *Provider) enqueue(span spanData) {
+	p.mu.Lock()
+	p.queue = append(p.queue, span)
+	full := len(p.queue) >= batchSize
+	p.mu.Unlock()
+	if full {
+		select {
+		case p.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// loop exports batches until stopped
+func (p *Provider) loop() {
+	defer close(p.stopped)
+	ticker := time.NewTicker(batchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.flush:
+		case <-p.stop:
+			p.export()
+			return
+		}
+		p.export()
+	}
+}
+
+// export posts the queued spans
+func (p *Provider) export() {
+	p.mu.Lock()
+	spans := p.queue
+	p.queue = nil
+	p.mu.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+
+	if err := p.post(spans); err != nil && p.config.OnError != nil {
+		p.config.OnError(fmt.Errorf("failed to export %d span(s): %w", len(spans), err))
+	}
+}
+
+func (p *Provider) post(spans []spanData) error {
+	body, err := json.Marshal(encode(p.config.ServiceName, spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, p.config.tracesURL(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range p.config.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("collector returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// OTLP/JSON encoding of spans, see
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttr `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []otlpAttr `json:"attributes,omitempty"`
+	Status            otlpStatus `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttr struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+// Span kinds and status codes of OTLP
+const (
+	spanKindInternal = 1
+	statusCodeError  = 2
+)
+
+// scopeName is the instrumentation scope of helmfire's spans
+const scopeName = "github.com/oleksiyp/helmfire"
+
+func encode(service string, spans []spanData) otlpRequest {
+	encoded := make([]otlpSpan, len(spans))
+	for i, span := range spans {
+		s := otlpSpan{
+			TraceID:           hex.EncodeToString(span.trace[:]),
+			SpanID:            hex.EncodeToString(span.id[:]),
+			Name:              span.name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+			Attributes:        encodeAttrs(span.attrs),
+		}
+		if span.parent != (spanID{}) {
+			s.ParentSpanID = hex.EncodeToString(span.parent[:])
+		}
+		if span.err != "" {
+			s.Status = otlpStatus{Code: statusCodeError, Message: span.err}
+		}
+		encoded[i] = s
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: encodeAttrs([]Attr{String("service.name", service)})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: scopeName}, Spans: encoded}},
+	}}}
+}
+
+func encodeAttrs(attrs []Attr) []otlpAttr {
+	encoded := make([]otlpAttr, 0, len(attrs))
+	for _, attr := range attrs {
+		var value otlpValue
+		switch v := attr.Value.(type) {
+		case string:
+			value.StringValue = &v
+		case int64:
+			s := strconv.FormatInt(v, 10)
+			value.IntValue = &s
+		case bool:
+			value.BoolValue = &v
+		default:
+			s := fmt.Sprint(v)
+			value.StringValue = &s
+		}
+		encoded = append(encoded, otlpAttr{Key: attr.Key, Value: value})
+	}
+	return encoded
+}
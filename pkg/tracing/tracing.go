@@ -0,0 +1,183 @@
+// Package tracing records OpenTelemetry spans of the sync pipeline and
+// exports them to an OTLP/HTTP collector, so slow stages of large helmfiles
+// can be found in Jaeger, Tempo or any other OpenTelemetry backend.
+// Without an endpoint spans cost nothing and go nowhere.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Environment variables of the OpenTelemetry SDKs honoured here
+const (
+	EnvEndpoint       = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	EnvTracesEndpoint = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+	EnvHeaders        = "OTEL_EXPORTER_OTLP_HEADERS"
+	EnvServiceName    = "OTEL_SERVICE_NAME"
+
+	// EnvTraceparent carries the W3C trace context into child processes,
+	// such as helm running helmfire as its post-renderer
+	EnvTraceparent = "TRACEPARENT"
+)
+
+// DefaultServiceName is the service.name of exported spans
+const DefaultServiceName = "helmfire"
+
+type (
+	traceID [16]byte
+	spanID  [8]byte
+)
+
+// Attr is a span attribute
+type Attr struct {
+	Key   string
+	Value interface{} // string, int64 or bool
+}
+
+// String returns a string attribute
+func String(key, value string) Attr { return Attr{key, value} }
+
+// Int returns an integer attribute
+func Int(key string, value int) Attr { return Attr{key, int64(value)} }
+
+// Bool returns a boolean attribute
+func Bool(key string, value bool) Attr { return Attr{key, value} }
+
+// Span is a timed operation of a trace. A nil span, returned while tracing
+// is off, ignores every call.
+type Span struct {
+	provider *Provider
+	trace    traceID
+	id       spanID
+	parent   spanID
+	name     string
+	start    time.Time
+	attrs    []Attr
+	ended    atomic.Bool
+}
+
+// SetAttributes adds attributes to the span
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// End finishes the span, marking it failed when err is not nil
+func (s *Span) End(err error) {
+	if s == nil || s.ended.Swap(true) {
+		return
+	}
+	data := spanData{
+		trace:  s.trace,
+		id:     s.id,
+		parent: s.parent,
+		name:   s.name,
+		start:  s.start,
+		end:    time.Now(),
+		attrs:  s.attrs,
+	}
+	if err != nil {
+		data.err = err.Error()
+	}
+	s.provider.enqueue(data)
+}
+
+// spanContext identifies the span new spans of a context are children of
+type spanContext struct {
+	trace traceID
+	id    spanID
+}
+
+type contextKey struct{}
+
+// global is the provider Start records spans with
+var global atomic.Pointer[Provider]
+
+// Enabled reports whether spans are exported
+func Enabled() bool {
+	return global.Load() != nil
+}
+
+// Start begins a span named name, a child of the span of ctx if any, and
+// returns a context carrying it
+func Start(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	provider := global.Load()
+	if provider == nil {
+		return ctx, nil
+	}
+
+	span := &Span{provider: provider, name: name, start: time.Now(), attrs: attrs, id: newSpanID()}
+	if parent, ok := ctx.Value(contextKey{}).(spanContext); ok {
+		span.trace, span.parent = parent.trace, parent.id
+	} else {
+		span.trace = newTraceID()
+	}
+	return context.WithValue(ctx, contextKey{}, spanContext{trace: span.trace, id: span.id}), span
+}
+
+// Traceparent returns the W3C traceparent of the span of ctx, or "" when
+// there is none
+func Traceparent(ctx context.Context) string {
+	sc, ok := ctx.Value(contextKey{}).(spanContext)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(sc.trace[:]), hex.EncodeToString(sc.id[:]))
+}
+
+// ContextWithTraceparent returns ctx with the span of a W3C traceparent, as
+// set by another process, as the parent of new spans. Invalid values are
+// ignored.
+func ContextWithTraceparent(ctx context.Context, traceparent string) context.Context {
+	parts := strings.Split(traceparent, "-")
+	if len(parts) != 4 || parts[0] != "00" {
+		return ctx
+	}
+	var sc spanContext
+	if b, err := hex.DecodeString(parts[1]); err != nil || len(b) != len(sc.trace) {
+		return ctx
+	} else {
+		copy(sc.trace[:], b)
+	}
+	if b, err := hex.DecodeString(parts[2]); err != nil || len(b) != len(sc.id) {
+		return ctx
+	} else {
+		copy(sc.id[:], b)
+	}
+	return context.WithValue(ctx, contextKey{}, sc)
+}
+
+// Environ returns the environment a child process needs to add its spans
+// to the trace of ctx: the exporter settings and the traceparent
+func Environ(ctx context.Context) []string {
+	provider := global.Load()
+	if provider == nil {
+		return nil
+	}
+	env := []string{EnvTracesEndpoint + "=" + provider.config.tracesURL()}
+	if headers := provider.config.headerString(); headers != "" {
+		env = append(env, EnvHeaders+"="+headers)
+	}
+	if parent := Traceparent(ctx); parent != "" {
+		env = append(env, EnvTraceparent+"="+parent)
+	}
+	return env
+}
+
+func newTraceID() (id traceID) {
+	rand.Read(id[:])
+	return id
+}
+
+func newSpanID() (id spanID) {
+	rand.Read(id[:])
+	return id
+}
@@ -0,0 +1,204 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// collector records the OTLP requests it receives
+type collector struct {
+	mu       sync.Mutex
+	requests []otlpRequest
+	headers  []http.Header
+	paths    []string
+}
+
+func newCollector(t *testing.T) (*collector, *httptest.Server) {
+	c := &collector{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode export: %v", err)
+		}
+		c.mu.Lock()
+		c.requests = append(c.requests, req)
+		c.headers = append(c.headers, r.Header)
+		c.paths = append(c.paths, r.URL.Path)
+		c.mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+	return c, server
+}
+
+func (c *collector) spans() map[string]otlpSpan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	spans := make(map[string]otlpSpan)
+	for _, req := range c.requests {
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, span := range ss.Spans {
+					spans[span.Name] = span
+				}
+			}
+		}
+	}
+	return spans
+}
+
+func TestStartWithoutInitIsNoop(t *testing.T) {
+	ctx, span := Start(context.Background(), "noop")
+	if span != nil {
+		t.Fatal("expected no span while tracing is off")
+	}
+	span.SetAttributes(String("k", "v"))
+	span.End(errors.New("ignored"))
+
+	if Traceparent(ctx) != "" {
+		t.Error("expected no traceparent while tracing is off")
+	}
+	if Environ(ctx) != nil {
+		t.Error("expected no environment while tracing is off")
+	}
+}
+
+func TestExport(t *testing.T) {
+	c, server := newCollector(t)
+	shutdown, err := Init(Config{Endpoint: server.URL, Headers: map[string]string{"Authorization": "Bearer token"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, root := Start(context.Background(), "helmfire.sync", String("sync.trigger", "cli"))
+	_, child := Start(ctx, "sync.release", String("release.name", "web"), Int("attempt", 2), Bool("dry", true))
+	child.End(errors.New("helm failed"))
+	root.End(nil)
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if Enabled() {
+		t.Error("expected tracing off after shutdown")
+	}
+
+	if len(c.paths) != 1 || c.paths[0] != "/v1/traces" {
+		t.Fatalf("expected one export to /v1/traces, got %v", c.paths)
+	}
+	if got := c.headers[0].Get("Authorization"); got != "Bearer token" {
+		t.Errorf("expected authorization header, got %q", got)
+	}
+	if service := c.requests[0].ResourceSpans[0].Resource.Attributes[0]; service.Key != "service.name" || *service.Value.StringValue != DefaultServiceName {
+		t.Errorf("unexpected resource attribute %+v", service)
+	}
+
+	spans := c.spans()
+	parent, release := spans["helmfire.sync"], spans["sync.release"]
+	if parent.ParentSpanID != "" {
+		t.Errorf("expected root span without parent, got %s", parent.ParentSpanID)
+	}
+	if release.TraceID != parent.TraceID || release.ParentSpanID != parent.SpanID {
+		t.Errorf("expected sync.release to be a child of helmfire.sync: %+v %+v", release, parent)
+	}
+	if len(release.TraceID) != 32 || len(release.SpanID) != 16 {
+		t.Errorf("expected hex ids, got %s %s", release.TraceID, release.SpanID)
+	}
+	if release.Status.Code != statusCodeError || release.Status.Message != "helm failed" {
+		t.Errorf("expected error status, got %+v", release.Status)
+	}
+	if parent.Status.Code != 0 {
+		t.Errorf("expected unset status, got %+v", parent.Status)
+	}
+
+	attrs := make(map[string]otlpValue)
+	for _, attr := range release.Attributes {
+		attrs[attr.Key] = attr.Value
+	}
+	if v := attrs["release.name"]; v.StringValue == nil || *v.StringValue != "web" {
+		t.Errorf("unexpected release.name %+v", v)
+	}
+	if v := attrs["attempt"]; v.IntValue == nil || *v.IntValue != "2" {
+		t.Errorf("unexpected attempt %+v", v)
+	}
+	if v := attrs["dry"]; v.BoolValue == nil || !*v.BoolValue {
+		t.Errorf("unexpected dry %+v", v)
+	}
+}
+
+func TestTracesEndpointTakesPrecedence(t *testing.T) {
+	c, server := newCollector(t)
+	shutdown, err := Init(Config{Endpoint: "http://unused:4318", TracesEndpoint: server.URL + "/custom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := Start(context.Background(), "span")
+	span.End(nil)
+	shutdown(context.Background())
+
+	if len(c.paths) != 1 || c.paths[0] != "/custom" {
+		t.Fatalf("expected export to /custom, got %v", c.paths)
+	}
+}
+
+func TestInitRejectsInvalidEndpoint(t *testing.T) {
+	if _, err := Init(Config{Endpoint: "not a url"}); err == nil {
+		t.Fatal("expected error for invalid endpoint")
+	}
+	if Enabled() {
+		t.Error("expected tracing off")
+	}
+}
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	_, server := newCollector(t)
+	shutdown, err := Init(Config{Endpoint: server.URL, Headers: map[string]string{"x-key": "a b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown(context.Background())
+
+	ctx, span := Start(context.Background(), "helm upgrade")
+	defer span.End(nil)
+
+	parent := Traceparent(ctx)
+	if !strings.HasPrefix(parent, "00-") || len(parent) != 55 {
+		t.Fatalf("unexpected traceparent %q", parent)
+	}
+	child, childSpan := Start(ContextWithTraceparent(context.Background(), parent), "postrender.substitute")
+	if childSpan.trace != span.trace || childSpan.parent != span.id {
+		t.Error("expected the remote span to be the parent")
+	}
+	if Traceparent(child) == parent {
+		t.Error("expected the child to have its own span id")
+	}
+
+	env := strings.Join(Environ(ctx), "\n")
+	for _, want := range []string{EnvTracesEndpoint + "=" + server.URL + "/v1/traces", EnvHeaders + "=x-key=a+b", EnvTraceparent + "=" + parent} {
+		if !strings.Contains(env, want) {
+			t.Errorf("expected %q in environment:\n%s", want, env)
+		}
+	}
+	if got := ParseHeaders("x-key=a+b"); got["x-key"] != "a b" {
+		t.Errorf("expected headers to round trip, got %v", got)
+	}
+}
+
+func TestContextWithInvalidTraceparent(t *testing.T) {
+	for _, value := range []string{"", "garbage", "01-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", "00-xyz-b7ad6b7169203331-01"} {
+		if got := Traceparent(ContextWithTraceparent(context.Background(), value)); got != "" {
+			t.Errorf("expected %q to be ignored, got %q", value, got)
+		}
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	got := ParseHeaders("api-key=secret, x-team = payments,broken,=empty")
+	if len(got) != 2 || got["api-key"] != "secret" || got["x-team"] != "payments" {
+		t.Errorf("unexpected headers %v", got)
+	}
+}
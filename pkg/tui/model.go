@@ -0,0 +1,397 @@
+// Package tui is the interactive terminal UI of helmfire ui: the releases of
+// a running daemon with their sync and drift state, actions on the selected
+// release, the daemon's substitutions and a pane of its events
+package tui
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/daemon"
+	"github.com/oleksiyp/helmfire/pkg/drift"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+)
+
+// maxLogLines bounds the lines kept in the log pane
+const maxLogLines = 500
+
+// Client is the part of the daemon API the UI uses; *daemon.APIClient
+// implements it
+type Client interface {
+	GetReleases() ([]daemon.ReleaseState, error)
+	GetSubstitutions() (*daemon.SubstitutionsResponse, error)
+	Sync(releases []string, dryRun bool) (*daemon.SyncResponse, error)
+	HealRelease(release string, dryRun bool) (*daemon.HealReleaseResponse, error)
+	HealDrift(id string) (*drift.DriftReport, error)
+	CheckDrift(release string) ([]drift.DriftReport, error)
+	AddImageSubstitution(original, replacement string, scope substitute.Scope, ttl time.Duration) error
+	RemoveChartSubstitution(original string, scope substitute.Scope) error
+	RemoveImageSubstitution(original string, scope substitute.Scope) error
+	StreamEvents(ctx context.Context, since int, fn func(daemon.Event)) error
+}
+
+// View is what the upper part of the screen lists
+type View int
+
+// Views
+const (
+	ViewReleases View = iota
+	ViewSubstitutions
+)
+
+// Model is the state of the UI. Keys are handled with HandleKey and the
+// screen drawn with Render; both are safe to call from any goroutine. Run
+// drives it with bubbletea.
+type Model struct {
+	client Client
+	now    func() time.Time
+
+	// Changed receives a value, without blocking, whenever the screen
+	// needs drawing again
+	Changed chan struct{}
+
+	mu       sync.Mutex
+	view     View
+	releases []daemon.ReleaseState
+	subs     []substitution
+	cursor   [2]int // per view
+	busy     map[string]string
+	logs     []string
+	detail   []string // shown instead of the logs until dismissed
+	title    string   // of the detail
+	prompt   *prompt
+	err      error // of the last refresh
+}
+
+// substitution is a row of the substitutions view
+type substitution struct {
+	image    bool
+	original string
+	target   string
+	scope    substitute.Scope
+	expires  *time.Time
+}
+
+// prompt reads a line of input
+type prompt struct {
+	label  string
+	input  string
+	submit func(string) func()
+}
+
+// New returns a model of the daemon behind client
+func New(client Client) *Model {
+	return &Model{
+		client:  client,
+		now:     time.Now,
+		Changed: make(chan struct{}, 1),
+		busy:    make(map[string]string),
+	}
+}
+
+// changed signals that the screen needs drawing; callers hold mu
+func (m *Model) changed() {
+	select {
+	case m.Changed <- struct{}{}:
+	default:
+	}
+}
+
+// Refresh reloads the releases and substitutions from the daemon
+func (m *Model) Refresh() {
+	releases, err := m.client.GetReleases()
+	var subs *daemon.SubstitutionsResponse
+	if err == nil {
+		subs, err = m.client.GetSubstitutions()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+	if err == nil {
+		m.releases = releases
+		m.subs = substitutions(subs)
+		for view, n := range [2]int{len(m.releases), len(m.subs)} {
+			m.cursor[view] = max(0, min(m.cursor[view], n-1))
+		}
+	}
+	m.changed()
+}
+
+// substitutions flattens the charts and images of a response into rows
+func substitutions(resp *daemon.SubstitutionsResponse) []substitution {
+	var rows []substitution
+	for _, c := range resp.Charts {
+		rows = append(rows, substitution{original: c.Original, target: c.LocalPath,
+			scope: substitute.Scope{Release: c.Release, Namespace: c.Namespace}, expires: c.ExpiresAt})
+	}
+	for _, i := range resp.Images {
+		rows = append(rows, substitution{image: true, original: i.Original, target: i.Replacement,
+			scope: substitute.Scope{Release: i.Release, Namespace: i.Namespace}, expires: i.ExpiresAt})
+	}
+	return rows
+}
+
+// Watch adds the daemon's events to the log pane until ctx is done,
+// reconnecting when the stream breaks
+func (m *Model) Watch(ctx context.Context) {
+	since := 0
+	for ctx.Err() == nil {
+		m.client.StreamEvents(ctx, since, func(event daemon.Event) {
+			since = event.ID
+			m.Log(formatEvent(event))
+		})
+		select {
+		case <-ctx.Done():
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+func formatEvent(event daemon.Event) string {
+	mark := "⏳"
+	if event.Ready {
+		mark = "✓"
+	}
+	return fmt.Sprintf("%s %s %s: %s: %s", event.Time.Local().Format("15:04:05"), mark, event.Release, event.Resource, event.Message)
+}
+
+// Log adds lines to the log pane
+func (m *Model) Log(lines ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.logLocked(lines...)
+}
+
+func (m *Model) logLocked(lines ...string) {
+	for _, line := range lines {
+		m.logs = append(m.logs, strings.Split(strings.TrimRight(line, "\n"), "\n")...)
+	}
+	if len(m.logs) > maxLogLines {
+		m.logs = m.logs[len(m.logs)-maxLogLines:]
+	}
+	m.changed()
+}
+
+// HandleKey applies a key, named as bubbletea names it: "up", "down",
+// "delete", "esc", "tab", "enter", "backspace", "ctrl+c", or else the
+// character typed. It returns the action
+// the key started, to run in the background, and whether to quit.
+func (m *Model) HandleKey(key string) (action func(), quit bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer m.changed()
+
+	if m.prompt != nil {
+		return m.promptKey(key), false
+	}
+
+	switch key {
+	case "q", "ctrl+c":
+		return nil, true
+	case "esc":
+		m.detail, m.title = nil, ""
+	case "tab":
+		m.view = 1 - m.view
+	case "up", "k":
+		m.cursor[m.view] = max(0, m.cursor[m.view]-1)
+	case "down", "j":
+		m.cursor[m.view] = max(0, min(m.cursor[m.view]+1, m.rows()-1))
+	case "r":
+		return m.Refresh, false
+	}
+
+	if m.view == ViewReleases {
+		return m.releaseKey(key), false
+	}
+	return m.substitutionKey(key), false
+}
+
+// rows returns the number of rows of the current view
+func (m *Model) rows() int {
+	if m.view == ViewReleases {
+		return len(m.releases)
+	}
+	return len(m.subs)
+}
+
+// releaseKey starts an action on the selected release
+func (m *Model) releaseKey(key string) func() {
+	if len(m.releases) == 0 {
+		return nil
+	}
+	release := m.releases[m.cursor[ViewReleases]]
+	name := release.Name
+	if key == "s" || key == "d" || key == "h" || key == "c" {
+		if m.busy[name] != "" {
+			m.logLocked(fmt.Sprintf("%s is busy %s", name, m.busy[name]))
+			return nil
+		}
+	}
+
+	switch key {
+	case "s":
+		return m.run(name, "syncing", func() ([]string, error) {
+			resp, err := m.client.Sync([]string{name}, false)
+			if err != nil {
+				return nil, err
+			}
+			var lines []string
+			for _, result := range resp.Run.Results {
+				line := fmt.Sprintf("%s %s in %s", result.Name, result.Status, result.Duration.Round(time.Millisecond))
+				if result.Error != "" {
+					line += ": " + result.Error
+				}
+				lines = append(lines, line)
+			}
+			return lines, nil
+		})
+	case "d":
+		return m.run(name, "diffing", func() ([]string, error) {
+			resp, err := m.client.Sync([]string{name}, true)
+			if err != nil {
+				return nil, err
+			}
+			changes := strings.TrimSpace(resp.Changes[name])
+			if changes == "" {
+				changes = "no changes"
+			}
+			m.mu.Lock()
+			m.title, m.detail = "diff of "+name+" (esc to close)", strings.Split(changes, "\n")
+			m.mu.Unlock()
+			return []string{"diffed " + name}, nil
+		})
+	case "h":
+		report := release.Drift
+		return m.run(name, "healing", func() ([]string, error) {
+			if report != nil && report.PendingApproval {
+				if _, err := m.client.HealDrift(report.ID); err != nil {
+					return nil, err
+				}
+				return []string{fmt.Sprintf("approved heal of %s drift of %s", report.Severity, name)}, nil
+			}
+			if _, err := m.client.HealRelease(name, false); err != nil {
+				return nil, err
+			}
+			return []string{"healed " + name}, nil
+		})
+	case "c":
+		return m.run(name, "checking drift", func() ([]string, error) {
+			reports, err := m.client.CheckDrift(name)
+			if err != nil {
+				return nil, err
+			}
+			if len(reports) == 0 {
+				return []string{name + " has no drift"}, nil
+			}
+			var lines []string
+			for _, report := range reports {
+				lines = append(lines, fmt.Sprintf("%s: %s drift (%s): %s", name, report.Severity, report.DriftType, report.Details))
+			}
+			return lines, nil
+		})
+	}
+	return nil
+}
+
+// substitutionKey starts an action on the substitutions
+func (m *Model) substitutionKey(key string) func() {
+	switch key {
+	case "a":
+		m.prompt = &prompt{
+			label: "image substitution (original=replacement [release]): ",
+			submit: func(input string) func() {
+				original, replacement, release, err := parseImagePrompt(input)
+				if err != nil {
+					m.logLocked("✗ " + err.Error())
+					return nil
+				}
+				return m.run("", "", func() ([]string, error) {
+					if err := m.client.AddImageSubstitution(original, replacement, substitute.Scope{Release: release}, 0); err != nil {
+						return nil, err
+					}
+					return []string{fmt.Sprintf("substituted %s with %s", original, replacement)}, nil
+				})
+			},
+		}
+	case "x", "delete":
+		if len(m.subs) == 0 {
+			return nil
+		}
+		sub := m.subs[m.cursor[ViewSubstitutions]]
+		return m.run("", "", func() ([]string, error) {
+			remove := m.client.RemoveChartSubstitution
+			if sub.image {
+				remove = m.client.RemoveImageSubstitution
+			}
+			if err := remove(sub.original, sub.scope); err != nil {
+				return nil, err
+			}
+			return []string{"removed substitution of " + sub.original}, nil
+		})
+	}
+	return nil
+}
+
+// parseImagePrompt parses "original=replacement [release]"
+func parseImagePrompt(input string) (original, replacement, release string, err error) {
+	fields := strings.Fields(input)
+	if len(fields) == 0 || len(fields) > 2 {
+		return "", "", "", fmt.Errorf("expected original=replacement [release]")
+	}
+	original, replacement, ok := strings.Cut(fields[0], "=")
+	if !ok || original == "" || replacement == "" {
+		return "", "", "", fmt.Errorf("expected original=replacement [release]")
+	}
+	if len(fields) == 2 {
+		release = fields[1]
+	}
+	return original, replacement, release, nil
+}
+
+// promptKey edits the prompt
+func (m *Model) promptKey(key string) func() {
+	switch key {
+	case "esc", "ctrl+c":
+		m.prompt = nil
+	case "enter":
+		p := m.prompt
+		m.prompt = nil
+		return p.submit(p.input)
+	case "backspace":
+		if n := len(m.prompt.input); n > 0 {
+			m.prompt.input = m.prompt.input[:n-1]
+		}
+	default:
+		if len([]rune(key)) == 1 && key >= " " {
+			m.prompt.input += key
+		}
+	}
+	return nil
+}
+
+// run returns an action calling fn with release marked busy, logging its
+// result and refreshing afterwards
+func (m *Model) run(release, doing string, fn func() ([]string, error)) func() {
+	if release != "" {
+		m.busy[release] = doing
+		m.logLocked(fmt.Sprintf("%s %s…", doing, release))
+	}
+	return func() {
+		lines, err := fn()
+
+		m.mu.Lock()
+		delete(m.busy, release)
+		if err != nil {
+			m.logLocked("✗ " + err.Error())
+		} else {
+			m.logLocked(lines...)
+		}
+		m.mu.Unlock()
+
+		m.Refresh()
+	}
+}
@@ -0,0 +1,253 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/oleksiyp/helmfire/pkg/daemon"
+	"github.com/oleksiyp/helmfire/pkg/drift"
+	"github.com/oleksiyp/helmfire/pkg/substitute"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+)
+
+// fakeClient serves fixed releases and substitutions and records calls
+type fakeClient struct {
+	releases []daemon.ReleaseState
+	subs     daemon.SubstitutionsResponse
+	calls    []string
+}
+
+func (c *fakeClient) GetReleases() ([]daemon.ReleaseState, error) { return c.releases, nil }
+
+func (c *fakeClient) GetSubstitutions() (*daemon.SubstitutionsResponse, error) {
+	return &c.subs, nil
+}
+
+func (c *fakeClient) Sync(releases []string, dryRun bool) (*daemon.SyncResponse, error) {
+	if dryRun {
+		c.calls = append(c.calls, "diff "+strings.Join(releases, ","))
+		return &daemon.SyncResponse{Changes: map[string]string{"web": "- replicas: 1\n+ replicas: 3\n"}}, nil
+	}
+	c.calls = append(c.calls, "sync "+strings.Join(releases, ","))
+	run := daemon.SyncRun{}
+	run.Results = []sync.ReleaseResult{{Name: "web", Status: sync.ReleaseStatusFailed, Error: "boom"}}
+	return &daemon.SyncResponse{Run: &run}, nil
+}
+
+func (c *fakeClient) HealRelease(release string, dryRun bool) (*daemon.HealReleaseResponse, error) {
+	c.calls = append(c.calls, "heal "+release)
+	return &daemon.HealReleaseResponse{Release: release}, nil
+}
+
+func (c *fakeClient) HealDrift(id string) (*drift.DriftReport, error) {
+	c.calls = append(c.calls, "approve "+id)
+	return &drift.DriftReport{ID: id}, nil
+}
+
+func (c *fakeClient) CheckDrift(release string) ([]drift.DriftReport, error) {
+	c.calls = append(c.calls, "check "+release)
+	return nil, errors.New("cluster unreachable")
+}
+
+func (c *fakeClient) AddImageSubstitution(original, replacement string, scope substitute.Scope, ttl time.Duration) error {
+	c.calls = append(c.calls, "add "+original+"="+replacement+" "+scope.String())
+	return nil
+}
+
+func (c *fakeClient) RemoveChartSubstitution(original string, scope substitute.Scope) error {
+	c.calls = append(c.calls, "remove chart "+original)
+	return nil
+}
+
+func (c *fakeClient) RemoveImageSubstitution(original string, scope substitute.Scope) error {
+	c.calls = append(c.calls, "remove image "+original)
+	return nil
+}
+
+func (c *fakeClient) StreamEvents(ctx context.Context, since int, fn func(daemon.Event)) error {
+	return nil
+}
+
+func newTestModel() (*Model, *fakeClient) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	client := &fakeClient{
+		releases: []daemon.ReleaseState{
+			{Name: "web", Namespace: "apps", Chart: "bitnami/nginx", Version: "15.0.0", Installed: true,
+				LastSync:     &sync.ReleaseResult{Name: "web", Status: sync.ReleaseStatusSucceeded},
+				LastSyncTime: now.Add(-5 * time.Minute),
+				Drift:        &drift.DriftReport{ID: "d1", Severity: drift.SeverityHigh, PendingApproval: true}},
+			{Name: "db", Namespace: "data", Chart: "bitnami/postgresql", Installed: true},
+		},
+		subs: daemon.SubstitutionsResponse{
+			Charts: []daemon.ChartSubstitution{{Original: "bitnami/nginx", LocalPath: "./charts/nginx"}},
+			Images: []daemon.ImageSubstitution{{Original: "api:1.0", Replacement: "api:dev", Release: "web"}},
+		},
+	}
+	m := New(client)
+	m.now = func() time.Time { return now }
+	m.Refresh()
+	return m, client
+}
+
+// press handles keys, running the actions they start
+func press(m *Model, keys ...string) {
+	for _, key := range keys {
+		if action, _ := m.HandleKey(key); action != nil {
+			action()
+		}
+	}
+}
+
+func TestRenderReleases(t *testing.T) {
+	m, _ := newTestModel()
+	screen := m.Render(120, 12)
+
+	for _, want := range []string{
+		"web   apps       bitnami/nginx@15.0.0",
+		"✓ synced 5m ago",
+		"⚠ high drift, awaiting approval",
+		"db    data       bitnami/postgresql",
+		"· never synced",
+		"s sync  d diff  h heal",
+	} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("expected %q on the screen:\n%s", want, screen)
+		}
+	}
+	if lines := strings.Count(screen, "\n"); lines != 11 {
+		t.Errorf("expected the screen to fill 12 rows, got %d", lines+1)
+	}
+}
+
+func TestReleaseActions(t *testing.T) {
+	m, client := newTestModel()
+
+	// The drift of web awaits approval, so heal approves it
+	press(m, "s", "h", "down", "h", "c")
+	want := []string{"sync web", "approve d1", "heal db", "check db"}
+	if !reflect.DeepEqual(client.calls, want) {
+		t.Errorf("expected calls %v, got %v", want, client.calls)
+	}
+
+	screen := m.Render(120, 20)
+	for _, line := range []string{"syncing web…", "web failed in 0s: boom", "approved heal of high drift of web", "✗ cluster unreachable"} {
+		if !strings.Contains(screen, line) {
+			t.Errorf("expected %q in the log pane:\n%s", line, screen)
+		}
+	}
+
+	press(m, "up", "d")
+	if screen := m.Render(120, 20); !strings.Contains(screen, "diff of web") || !strings.Contains(screen, "+ replicas: 3") {
+		t.Errorf("expected the diff in the pane:\n%s", screen)
+	}
+	press(m, "esc")
+	if screen := m.Render(120, 20); strings.Contains(screen, "+ replicas: 3") {
+		t.Errorf("expected esc to close the diff:\n%s", screen)
+	}
+}
+
+func TestBusyRelease(t *testing.T) {
+	m, client := newTestModel()
+
+	action, _ := m.HandleKey("s")
+	if screen := m.Render(120, 12); !strings.Contains(screen, "⟳ syncing") {
+		t.Errorf("expected web shown as syncing:\n%s", screen)
+	}
+	if again, _ := m.HandleKey("s"); again != nil {
+		t.Error("expected no second sync of a busy release")
+	}
+	action()
+	if len(client.calls) != 1 {
+		t.Errorf("expected one sync, got %v", client.calls)
+	}
+}
+
+func TestSubstitutions(t *testing.T) {
+	m, client := newTestModel()
+
+	press(m, "tab")
+	screen := m.Render(120, 12)
+	for _, want := range []string{"chart  bitnami/nginx → ./charts/nginx", "image  api:1.0       → api:dev  [web]"} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("expected %q on the screen:\n%s", want, screen)
+		}
+	}
+
+	press(m, "down", "x", "a")
+	if screen := m.Render(120, 12); !strings.Contains(screen, "original=replacement [release]") {
+		t.Errorf("expected the prompt:\n%s", screen)
+	}
+	press(m, strings.Split("web:1=web:dx", "")...)
+	press(m, "backspace", "e", "v", " ", "w", "e", "b", "enter")
+	press(m, "a", "b", "a", "d", "enter")
+
+	want := []string{"remove image api:1.0", "add web:1=web:dev web"}
+	if !reflect.DeepEqual(client.calls, want) {
+		t.Errorf("expected calls %v, got %v", want, client.calls)
+	}
+	if screen := m.Render(120, 12); !strings.Contains(screen, "expected original=replacement [release]") {
+		t.Errorf("expected the invalid input reported:\n%s", screen)
+	}
+}
+
+func TestQuit(t *testing.T) {
+	m, _ := newTestModel()
+	if _, quit := m.HandleKey("q"); !quit {
+		t.Error("expected q to quit")
+	}
+
+	// Typed into a prompt, q is text
+	press(m, "tab", "a")
+	if _, quit := m.HandleKey("q"); quit {
+		t.Error("expected q to be typed into the prompt")
+	}
+}
+
+func TestProgramKeys(t *testing.T) {
+	m, client := newTestModel()
+	var p tea.Model = newProgram(context.Background(), m)
+
+	// Actions run as commands
+	update := func(msg tea.Msg) tea.Cmd {
+		var cmd tea.Cmd
+		p, cmd = p.Update(msg)
+		if cmd != nil {
+			if batch, ok := cmd().(tea.BatchMsg); ok {
+				for _, c := range batch {
+					c()
+				}
+			}
+		}
+		return cmd
+	}
+
+	update(tea.WindowSizeMsg{Width: 100, Height: 10})
+	update(tea.KeyMsg{Type: tea.KeyDown})
+	update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("s")})
+	update(tea.KeyMsg{Type: tea.KeyTab})
+	update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("a")})
+	// Text pasted into the prompt arrives as one message
+	update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("api:1.0=api:dev")})
+	update(tea.KeyMsg{Type: tea.KeyEnter})
+
+	want := []string{"sync db", "add api:1.0=api:dev *"}
+	if !reflect.DeepEqual(client.calls, want) {
+		t.Errorf("expected calls %v, got %v", want, client.calls)
+	}
+	if lines := strings.Count(p.View(), "\n"); lines != 9 {
+		t.Errorf("expected the screen to fill the window's 10 rows, got %d", lines+1)
+	}
+
+	cmd := update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("q")})
+	if cmd == nil {
+		t.Fatal("expected q to quit")
+	}
+	if _, ok := cmd().(tea.QuitMsg); !ok {
+		t.Error("expected q to quit")
+	}
+}
@@ -0,0 +1,118 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// refreshInterval is how often the releases are reloaded from the daemon
+const refreshInterval = 2 * time.Second
+
+// Run shows the UI of model on the terminal of in and out with bubbletea
+// until the user quits or ctx is done
+func Run(ctx context.Context, model *Model, in io.Reader, out io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go model.Watch(ctx)
+
+	_, err := tea.NewProgram(newProgram(ctx, model),
+		tea.WithContext(ctx), tea.WithInput(in), tea.WithOutput(out), tea.WithAltScreen()).Run()
+	if errors.Is(err, tea.ErrProgramKilled) && ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// program is the bubbletea model drawing a Model: keys go to HandleKey,
+// the actions they start run as commands, and the screen is redrawn
+// whenever the Model changes
+type program struct {
+	ctx           context.Context
+	model         *Model
+	width, height int
+}
+
+// changedMsg is sent when the Model needs drawing again
+type changedMsg struct{}
+
+// refreshMsg is sent every refreshInterval
+type refreshMsg struct{}
+
+func newProgram(ctx context.Context, model *Model) program {
+	return program{ctx: ctx, model: model, width: 80, height: 24}
+}
+
+func (p program) Init() tea.Cmd {
+	return tea.Batch(p.refresh, p.waitChanged, scheduleRefresh())
+}
+
+func (p program) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		p.width, p.height = msg.Width, msg.Height
+	case tea.KeyMsg:
+		var cmds []tea.Cmd
+		for _, key := range keyNames(msg) {
+			action, quit := p.model.HandleKey(key)
+			if quit {
+				return p, tea.Quit
+			}
+			if action != nil {
+				cmds = append(cmds, func() tea.Msg {
+					action()
+					return nil
+				})
+			}
+		}
+		return p, tea.Batch(cmds...)
+	case refreshMsg:
+		return p, tea.Batch(p.refresh, scheduleRefresh())
+	case changedMsg:
+		return p, p.waitChanged
+	}
+	return p, nil
+}
+
+func (p program) View() string {
+	return p.model.Render(p.width, p.height)
+}
+
+// refresh reloads the Model from the daemon
+func (p program) refresh() tea.Msg {
+	p.model.Refresh()
+	return nil
+}
+
+// waitChanged waits for the Model to change
+func (p program) waitChanged() tea.Msg {
+	select {
+	case <-p.model.Changed:
+		return changedMsg{}
+	case <-p.ctx.Done():
+		return nil
+	}
+}
+
+func scheduleRefresh() tea.Cmd {
+	return tea.Tick(refreshInterval, func(time.Time) tea.Msg {
+		return refreshMsg{}
+	})
+}
+
+// keyNames returns the keys HandleKey is given for a key message: its
+// name, or each character of text pasted or typed at once
+func keyNames(msg tea.KeyMsg) []string {
+	if msg.Type != tea.KeyRunes || msg.Alt || len(msg.Runes) < 2 {
+		return []string{msg.String()}
+	}
+	keys := make([]string, len(msg.Runes))
+	for i, r := range msg.Runes {
+		keys[i] = string(r)
+	}
+	return keys
+}
@@ -0,0 +1,201 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/daemon"
+	"github.com/oleksiyp/helmfire/pkg/sync"
+)
+
+// ANSI sequences the screen uses
+const (
+	reverse = "\x1b[7m"
+	dim     = "\x1b[2m"
+	reset   = "\x1b[0m"
+)
+
+var help = map[View]string{
+	ViewReleases:      "↑↓ select  s sync  d diff  h heal  c check drift  r refresh  tab substitutions  q quit",
+	ViewSubstitutions: "↑↓ select  a add image  x remove  r refresh  tab releases  q quit",
+}
+
+// Render draws the screen for a terminal of width columns and height rows
+func (m *Model) Render(width, height int) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	width, height = max(width, 20), max(height, 8)
+	var rows []string
+	var header string
+	if m.view == ViewReleases {
+		rows, header = m.releaseRows(), " RELEASES   substitutions"
+	} else {
+		rows, header = m.substitutionRows(), "  releases  SUBSTITUTIONS"
+	}
+
+	// The list takes up to half of the rows between the header and the
+	// footer; the pane the rest
+	listHeight := max(1, min(len(rows), (height-3)/2))
+	paneHeight := height - 2 - listHeight
+
+	var b strings.Builder
+	b.WriteString(reverse + pad("helmfire ui "+header, width) + reset + "\n")
+
+	cursor := m.cursor[m.view]
+	offset := max(0, cursor-listHeight+1)
+	for i := offset; i < offset+listHeight; i++ {
+		switch {
+		case i >= len(rows):
+			b.WriteString(dim + "  (none)" + reset + "\n")
+		case i == cursor:
+			b.WriteString(reverse + pad(rows[i], width) + reset + "\n")
+		default:
+			b.WriteString(truncate(rows[i], width) + "\n")
+		}
+	}
+
+	title, pane := "logs", m.logs
+	if m.detail != nil {
+		title, pane = m.title, m.detail
+		if len(pane) > paneHeight-1 {
+			pane = pane[:paneHeight-1]
+		}
+	} else if len(pane) > paneHeight-1 {
+		pane = pane[len(pane)-(paneHeight-1):]
+	}
+	b.WriteString(dim + truncate("── "+title+" "+strings.Repeat("─", width), width) + reset + "\n")
+	for i := 0; i < paneHeight-1; i++ {
+		if i < len(pane) {
+			b.WriteString(truncate(pane[i], width))
+		}
+		b.WriteString("\n")
+	}
+
+	switch {
+	case m.prompt != nil:
+		b.WriteString(truncate(m.prompt.label+m.prompt.input+"█", width))
+	case m.err != nil:
+		b.WriteString(truncate("✗ "+m.err.Error(), width))
+	default:
+		b.WriteString(dim + truncate(help[m.view], width) + reset)
+	}
+	return b.String()
+}
+
+// releaseRows formats the releases with their sync and drift state
+func (m *Model) releaseRows() []string {
+	nameWidth, nsWidth, chartWidth := 4, 9, 5
+	charts := make([]string, len(m.releases))
+	for i, release := range m.releases {
+		charts[i] = release.Chart
+		if release.Version != "" {
+			charts[i] += "@" + release.Version
+		}
+		nameWidth = max(nameWidth, len(release.Name))
+		nsWidth = max(nsWidth, len(release.Namespace))
+		chartWidth = max(chartWidth, len(charts[i]))
+	}
+
+	rows := make([]string, len(m.releases))
+	for i, release := range m.releases {
+		rows[i] = fmt.Sprintf("  %-*s  %-*s  %-*s  %-22s  %s",
+			nameWidth, release.Name, nsWidth, release.Namespace, chartWidth, charts[i],
+			m.syncState(release), driftState(release))
+	}
+	return rows
+}
+
+// syncState describes the last sync of a release, or what is being done
+func (m *Model) syncState(release daemon.ReleaseState) string {
+	if doing := m.busy[release.Name]; doing != "" {
+		return "⟳ " + doing
+	}
+	if !release.Installed {
+		return "– not installed"
+	}
+	if release.LastSync == nil {
+		return "· never synced"
+	}
+	ago := formatAgo(m.now().Sub(release.LastSyncTime)) + " ago"
+	switch release.LastSync.Status {
+	case sync.ReleaseStatusSucceeded:
+		if helm := release.LastSync.Helm; helm != nil {
+			return fmt.Sprintf("✓ r%d synced %s", helm.Revision, ago)
+		}
+		return "✓ synced " + ago
+	case sync.ReleaseStatusTimedOut:
+		return "⏱ timed out " + ago
+	case sync.ReleaseStatusSkipped:
+		return "· skipped " + ago
+	default:
+		return "✗ failed " + ago
+	}
+}
+
+// driftState describes the unhealed drift of a release
+func driftState(release daemon.ReleaseState) string {
+	if release.Drift == nil {
+		return ""
+	}
+	state := fmt.Sprintf("⚠ %s drift", release.Drift.Severity)
+	if release.Drift.PendingApproval {
+		state += ", awaiting approval"
+	}
+	return state
+}
+
+// substitutionRows formats the substitutions
+func (m *Model) substitutionRows() []string {
+	originalWidth := 8
+	for _, sub := range m.subs {
+		originalWidth = max(originalWidth, len(sub.original))
+	}
+
+	rows := make([]string, len(m.subs))
+	for i, sub := range m.subs {
+		kind := "chart"
+		if sub.image {
+			kind = "image"
+		}
+		row := fmt.Sprintf("  %-5s  %-*s → %s", kind, originalWidth, sub.original, sub.target)
+		if !sub.scope.IsGlobal() {
+			row += "  [" + sub.scope.String() + "]"
+		}
+		if sub.expires != nil {
+			row += "  expires in " + formatAgo(sub.expires.Sub(m.now()))
+		}
+		rows[i] = row
+	}
+	return rows
+}
+
+// formatAgo formats a duration the way the list shows ages
+func formatAgo(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(max(d, 0).Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
+
+// truncate cuts s to width runes
+func truncate(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) <= width {
+		return s
+	}
+	return string(runes[:width-1]) + "…"
+}
+
+// pad truncates or pads s to exactly width runes
+func pad(s string, width int) string {
+	s = truncate(s, width)
+	return s + strings.Repeat(" ", width-len([]rune(s)))
+}
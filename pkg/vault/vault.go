@@ -0,0 +1,278 @@
+// Package vault reads secrets from HashiCorp Vault for values given as
+// vault:path#key references, so secrets stay out of helmfiles
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oleksiyp/helmfire/pkg/httpclient"
+)
+
+// RefPrefix starts a value read from Vault
+const RefPrefix = "vault:"
+
+// Environment variables configuring the client, as the vault CLI reads them
+const (
+	EnvAddress   = "VAULT_ADDR"
+	EnvToken     = "VAULT_TOKEN"
+	EnvNamespace = "VAULT_NAMESPACE"
+	EnvRoleID    = "VAULT_ROLE_ID"
+	EnvSecretID  = "VAULT_SECRET_ID"
+	EnvAuthPath  = "VAULT_AUTH_PATH" // mount of the approle auth method; approle when empty
+)
+
+// Ref is a reference to the key of a secret
+type Ref struct {
+	Path string
+	Key  string
+}
+
+// String returns the reference as written in values
+func (r Ref) String() string {
+	return RefPrefix + r.Path + "#" + r.Key
+}
+
+// IsRef reports whether value is a vault: reference
+func IsRef(value string) bool {
+	return strings.HasPrefix(value, RefPrefix)
+}
+
+// ParseRef parses a vault:path#key reference
+func ParseRef(value string) (Ref, error) {
+	if !IsRef(value) {
+		return Ref{}, fmt.Errorf("%q is not a vault reference", value)
+	}
+	path, key, ok := strings.Cut(strings.TrimPrefix(value, RefPrefix), "#")
+	path = strings.Trim(path, "/")
+	if !ok || path == "" || key == "" {
+		return Ref{}, fmt.Errorf("invalid vault reference %q (want vault:path#key)", value)
+	}
+	return Ref{Path: path, Key: key}, nil
+}
+
+// Config configures a Client. Token auth is used when Token is set, AppRole
+// auth with RoleID and SecretID otherwise.
+type Config struct {
+	Address   string
+	Token     string
+	Namespace string
+
+	RoleID   string
+	SecretID string
+	AuthPath string // approle when empty
+}
+
+// ConfigFromEnv returns the configuration given by the VAULT_* environment
+// variables, falling back to the token the vault CLI saved in ~/.vault-token
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Address:   os.Getenv(EnvAddress),
+		Token:     os.Getenv(EnvToken),
+		Namespace: os.Getenv(EnvNamespace),
+		RoleID:    os.Getenv(EnvRoleID),
+		SecretID:  os.Getenv(EnvSecretID),
+		AuthPath:  os.Getenv(EnvAuthPath),
+	}
+	if cfg.Token == "" && cfg.RoleID == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			if data, err := os.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+				cfg.Token = strings.TrimSpace(string(data))
+			}
+		}
+	}
+	return cfg
+}
+
+// Client reads secrets over the Vault HTTP API
+type Client struct {
+	config     Config
+	httpClient *http.Client
+
+	mu    sync.Mutex
+	token string // the AppRole login token, once logged in
+}
+
+// NewClient creates a client for cfg
+func NewClient(cfg Config) (*Client, error) {
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("vault address not set (set %s)", EnvAddress)
+	}
+	if cfg.Token == "" && (cfg.RoleID == "" || cfg.SecretID == "") {
+		return nil, fmt.Errorf("vault credentials not set (set %s, or %s and %s)", EnvToken, EnvRoleID, EnvSecretID)
+	}
+	if cfg.AuthPath == "" {
+		cfg.AuthPath = "approle"
+	}
+	cfg.Address = strings.TrimRight(cfg.Address, "/")
+	return &Client{
+		config:     cfg,
+		httpClient: httpclient.New(10 * time.Second),
+	}, nil
+}
+
+// errNotFound is returned for paths Vault has nothing at
+var errNotFound = errors.New("not found")
+
+// errForbidden is returned when the token isn't allowed to read a path,
+// or has expired
+var errForbidden = errors.New("permission denied")
+
+// Read returns the data of the secret at path. Secrets of KV version 2
+// engines can be given with or without the data/ segment of their API path.
+func (c *Client) Read(ctx context.Context, path string) (map[string]interface{}, error) {
+	path = strings.Trim(path, "/")
+	data, err := c.readAuthenticated(ctx, path)
+	if errors.Is(err, errNotFound) {
+		if mount, rest, ok := strings.Cut(path, "/"); ok && !strings.HasPrefix(rest, "data/") {
+			data, err = c.readAuthenticated(ctx, mount+"/data/"+rest)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault secret %s: %w", path, err)
+	}
+
+	// KV version 2 wraps the secret with its metadata
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			return inner, nil
+		}
+	}
+	return data, nil
+}
+
+// Get returns the value of the key a reference names, as a string; other
+// values are returned as JSON
+func (c *Client) Get(ctx context.Context, ref Ref) (string, error) {
+	data, err := c.Read(ctx, ref.Path)
+	if err != nil {
+		return "", err
+	}
+	value, ok := data[ref.Key]
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no key %s", ref.Path, ref.Key)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// readAuthenticated reads path, logging in again once when an AppRole
+// token was rejected
+func (c *Client) readAuthenticated(ctx context.Context, path string) (map[string]interface{}, error) {
+	token, err := c.authToken(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	data, err := c.read(ctx, token, path)
+	if errors.Is(err, errForbidden) && c.config.Token == "" {
+		if token, err = c.authToken(ctx, true); err != nil {
+			return nil, err
+		}
+		data, err = c.read(ctx, token, path)
+	}
+	return data, err
+}
+
+// read gets the data of the API path v1/<path>
+func (c *Client) read(ctx context.Context, token, path string) (map[string]interface{}, error) {
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, path, token, nil, &body); err != nil {
+		return nil, err
+	}
+	if body.Data == nil {
+		return nil, errNotFound
+	}
+	return body.Data, nil
+}
+
+// authToken returns the token to send, logging in with AppRole when no
+// token was configured and none is cached or renew is set
+func (c *Client) authToken(ctx context.Context, renew bool) (string, error) {
+	if c.config.Token != "" {
+		return c.config.Token, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && !renew {
+		return c.token, nil
+	}
+
+	login := map[string]string{"role_id": c.config.RoleID, "secret_id": c.config.SecretID}
+	var body struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	if err := c.do(ctx, http.MethodPost, "auth/"+strings.Trim(c.config.AuthPath, "/")+"/login", "", login, &body); err != nil {
+		return "", fmt.Errorf("vault approle login failed: %w", err)
+	}
+	if body.Auth.ClientToken == "" {
+		return "", fmt.Errorf("vault approle login returned no token")
+	}
+	c.token = body.Auth.ClientToken
+	return c.token, nil
+}
+
+// do sends a request to the API path v1/<path> and decodes the answer
+// into out
+func (c *Client) do(ctx context.Context, method, path, token string, in, out interface{}) error {
+	var payload []byte
+	if in != nil {
+		var err error
+		if payload, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.config.Address+"/v1/"+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if c.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.config.Namespace)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errNotFound
+	case resp.StatusCode == http.StatusForbidden:
+		return errForbidden
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		var body struct {
+			Errors []string `json:"errors"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return fmt.Errorf("vault returned status %d: %s", resp.StatusCode, strings.Join(body.Errors, "; "))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,121 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseRef(t *testing.T) {
+	ref, err := ParseRef("vault:secret/apps/db#password")
+	if err != nil || ref.Path != "secret/apps/db" || ref.Key != "password" {
+		t.Errorf("unexpected ref %+v, %v", ref, err)
+	}
+	if ref.String() != "vault:secret/apps/db#password" {
+		t.Errorf("unexpected String() %s", ref)
+	}
+	for _, value := range []string{"vault:secret/apps/db", "vault:#password", "secret/apps/db#password"} {
+		if _, err := ParseRef(value); err == nil {
+			t.Errorf("expected %q rejected", value)
+		}
+	}
+}
+
+// fakeVault serves a KV v1 secret at kv/db and a KV v2 one at secret/api,
+// accepting token root and the token of an AppRole login
+func fakeVault(t *testing.T, logins *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/auth/approle/login" {
+			var login map[string]string
+			json.NewDecoder(r.Body).Decode(&login)
+			if login["role_id"] != "role" || login["secret_id"] != "secret" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"errors":["invalid role or secret ID"]}`))
+				return
+			}
+			*logins++
+			w.Write([]byte(`{"auth":{"client_token":"approle-token"}}`))
+			return
+		}
+		if token := r.Header.Get("X-Vault-Token"); token != "root" && token != "approle-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/kv/db":
+			w.Write([]byte(`{"data":{"password":"hunter2","port":5432}}`))
+		case "/v1/secret/data/api":
+			w.Write([]byte(`{"data":{"data":{"token":"abc"},"metadata":{"version":3}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+}
+
+func TestClientGet(t *testing.T) {
+	logins := 0
+	server := fakeVault(t, &logins)
+	defer server.Close()
+	ctx := context.Background()
+
+	client, err := NewClient(Config{Address: server.URL, Token: "root"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := client.Get(ctx, Ref{Path: "kv/db", Key: "password"}); err != nil || got != "hunter2" {
+		t.Errorf("expected the KV v1 secret, got %q %v", got, err)
+	}
+	if got, err := client.Get(ctx, Ref{Path: "kv/db", Key: "port"}); err != nil || got != "5432" {
+		t.Errorf("expected the port as JSON, got %q %v", got, err)
+	}
+	if got, err := client.Get(ctx, Ref{Path: "secret/api", Key: "token"}); err != nil || got != "abc" {
+		t.Errorf("expected the KV v2 secret without data/, got %q %v", got, err)
+	}
+	if got, err := client.Get(ctx, Ref{Path: "secret/data/api", Key: "token"}); err != nil || got != "abc" {
+		t.Errorf("expected the KV v2 secret with data/, got %q %v", got, err)
+	}
+	if _, err := client.Get(ctx, Ref{Path: "kv/db", Key: "user"}); err == nil || !strings.Contains(err.Error(), "no key user") {
+		t.Errorf("expected a missing key error, got %v", err)
+	}
+	if _, err := client.Get(ctx, Ref{Path: "kv/missing", Key: "user"}); err == nil {
+		t.Error("expected a missing secret error")
+	}
+}
+
+func TestClientAppRole(t *testing.T) {
+	logins := 0
+	server := fakeVault(t, &logins)
+	defer server.Close()
+	ctx := context.Background()
+
+	client, err := NewClient(Config{Address: server.URL, RoleID: "role", SecretID: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if got, err := client.Get(ctx, Ref{Path: "kv/db", Key: "password"}); err != nil || got != "hunter2" {
+			t.Errorf("expected the secret, got %q %v", got, err)
+		}
+	}
+	if logins != 1 {
+		t.Errorf("expected the login token reused, logged in %d times", logins)
+	}
+
+	client, _ = NewClient(Config{Address: server.URL, RoleID: "role", SecretID: "wrong"})
+	if _, err := client.Get(ctx, Ref{Path: "kv/db", Key: "password"}); err == nil || !strings.Contains(err.Error(), "invalid role or secret ID") {
+		t.Errorf("expected the login error, got %v", err)
+	}
+}
+
+func TestNewClientRequiresCredentials(t *testing.T) {
+	if _, err := NewClient(Config{Token: "root"}); err == nil {
+		t.Error("expected a missing address error")
+	}
+	if _, err := NewClient(Config{Address: "http://vault:8200", RoleID: "role"}); err == nil {
+		t.Error("expected a missing credentials error")
+	}
+}
@@ -0,0 +1,180 @@
+// Package watcher detects changes to local files by polling them. Polling
+// works the same on every platform and on network and container-mounted
+// filesystems, where inotify events are unreliable.
+package watcher
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultInterval is how often watched paths are scanned
+const DefaultInterval = time.Second
+
+// Event is a change to a watched file
+type Event struct {
+	Path    string // absolute path of the file
+	Removed bool
+}
+
+// fileState is what a scan records of a file to notice changes
+type fileState struct {
+	modTime time.Time
+	size    int64
+	mode    fs.FileMode
+}
+
+// Watcher reports changes to files and directory trees
+type Watcher struct {
+	interval time.Duration
+
+	mu    sync.Mutex
+	roots map[string]bool
+	files map[string]fileState
+}
+
+// New returns a watcher scanning every interval, DefaultInterval if zero
+func New(interval time.Duration) *Watcher {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Watcher{
+		interval: interval,
+		roots:    make(map[string]bool),
+		files:    make(map[string]fileState),
+	}
+}
+
+// Add watches a file, or a directory and everything below it. Its current
+// content is the baseline changes are reported against. A path that doesn't
+// exist yet is reported when it is created.
+func (w *Watcher) Add(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.roots[abs] {
+		return nil
+	}
+	w.roots[abs] = true
+	for file, state := range scan(abs) {
+		w.files[file] = state
+	}
+	return nil
+}
+
+// Paths returns the watched paths, sorted
+func (w *Watcher) Paths() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	paths := make([]string, 0, len(w.roots))
+	for root := range w.roots {
+		paths = append(paths, root)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Poll scans the watched paths and returns the files created, modified or
+// removed since the last scan, sorted by path
+func (w *Watcher) Poll() []Event {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	current := make(map[string]fileState, len(w.files))
+	for root := range w.roots {
+		for file, state := range scan(root) {
+			current[file] = state
+		}
+	}
+
+	var events []Event
+	for file, state := range current {
+		if old, ok := w.files[file]; !ok || old != state {
+			events = append(events, Event{Path: file})
+		}
+	}
+	for file := range w.files {
+		if _, ok := current[file]; !ok {
+			events = append(events, Event{Path: file, Removed: true})
+		}
+	}
+	w.files = current
+
+	sort.Slice(events, func(i, j int) bool { return events[i].Path < events[j].Path })
+	return events
+}
+
+// Run polls until ctx is done and calls fn with the changes of each burst
+// of edits. Changes are held back until a scan finds nothing new, so saving
+// many files at once, or an editor writing a file in steps, is one call.
+func (w *Watcher) Run(ctx context.Context, fn func([]Event)) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	pending := make(map[string]Event)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		events := w.Poll()
+		for _, event := range events {
+			pending[event.Path] = event
+		}
+		if len(events) > 0 || len(pending) == 0 {
+			continue
+		}
+
+		batch := make([]Event, 0, len(pending))
+		for _, event := range pending {
+			batch = append(batch, event)
+		}
+		sort.Slice(batch, func(i, j int) bool { return batch[i].Path < batch[j].Path })
+		clear(pending)
+		fn(batch)
+	}
+}
+
+// scan returns the state of the regular files at or below root
+func scan(root string) map[string]fileState {
+	files := make(map[string]fileState)
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Missing or unreadable; removed files are reported by absence
+			return nil
+		}
+		if d.IsDir() {
+			if path != root && skipDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		files[path] = fileState{modTime: info.ModTime(), size: info.Size(), mode: info.Mode()}
+		return nil
+	})
+	return files
+}
+
+// skipDir reports whether a directory is tooling state rather than sources
+func skipDir(name string) bool {
+	switch name {
+	case ".git", ".hg", ".svn", "node_modules", "__pycache__", ".venv":
+		return true
+	}
+	return false
+}
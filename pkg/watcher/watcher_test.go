@@ -0,0 +1,89 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPoll(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	values := filepath.Join(dir, "values.yaml")
+	writeFile(t, filepath.Join(src, "app.py"), "print(1)")
+	writeFile(t, filepath.Join(src, "lib", "util.py"), "x = 1")
+	writeFile(t, filepath.Join(src, ".git", "HEAD"), "ref")
+	writeFile(t, values, "replicas: 1")
+
+	w := New(time.Millisecond)
+	for _, path := range []string{src, values, filepath.Join(dir, "missing.yaml")} {
+		if err := w.Add(path); err != nil {
+			t.Fatalf("Add(%s) failed: %v", path, err)
+		}
+	}
+	if events := w.Poll(); len(events) != 0 {
+		t.Fatalf("expected no changes, got %+v", events)
+	}
+
+	writeFile(t, filepath.Join(src, "app.py"), "print(22)")
+	writeFile(t, filepath.Join(src, "lib", "new.py"), "y = 2")
+	writeFile(t, filepath.Join(src, ".git", "HEAD"), "other")
+	writeFile(t, filepath.Join(dir, "missing.yaml"), "created")
+	if err := os.Remove(values); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Event{
+		{Path: filepath.Join(dir, "missing.yaml")},
+		{Path: filepath.Join(src, "app.py")},
+		{Path: filepath.Join(src, "lib", "new.py")},
+		{Path: values, Removed: true},
+	}
+	if events := w.Poll(); !reflect.DeepEqual(events, want) {
+		t.Errorf("expected %+v, got %+v", want, events)
+	}
+	if events := w.Poll(); len(events) != 0 {
+		t.Errorf("expected changes to be reported once, got %+v", events)
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.txt"), "a")
+
+	w := New(10 * time.Millisecond)
+	if err := w.Add(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	batches := make(chan []Event, 10)
+	go w.Run(ctx, func(events []Event) { batches <- events })
+
+	// Edits in quick succession arrive together once things settle
+	writeFile(t, filepath.Join(dir, "a.txt"), "aa")
+	writeFile(t, filepath.Join(dir, "b.txt"), "b")
+
+	select {
+	case events := <-batches:
+		if len(events) != 2 {
+			t.Errorf("expected both changes in one batch, got %+v", events)
+		}
+	case <-ctx.Done():
+		t.Fatal("no changes reported")
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,8 +1,10 @@
 package test
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/oleksiyp/helmfire/pkg/helmstate"
@@ -49,6 +51,60 @@ releases:
 	}
 }
 
+// BenchmarkHelmfileReload benchmarks loading a 500-release helmfile, once
+// from scratch and once as a watch event reloads it unchanged
+func BenchmarkHelmfileReload(b *testing.B) {
+	tmpDir := b.TempDir()
+	helmfilePath := filepath.Join(tmpDir, "helmfile.yaml")
+
+	var content strings.Builder
+	content.WriteString("repositories:\n  - name: bitnami\n    url: https://charts.bitnami.com/bitnami\n\nreleases:\n")
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(&content, `  - name: app-%d
+    namespace: team-%d
+    chart: bitnami/nginx
+    version: 13.2.0
+    labels:
+      tier: web
+    values:
+      - values/app-%d.yaml
+      - replicaCount: 2
+    set:
+      - name: image.tag
+        value: v1
+`, i, i%10, i)
+	}
+	if err := os.WriteFile(helmfilePath, []byte(content.String()), 0644); err != nil {
+		b.Fatalf("failed to write helmfile: %v", err)
+	}
+
+	for _, strict := range []bool{false, true} {
+		b.Run(fmt.Sprintf("Cold/strict=%t", strict), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				manager := helmstate.NewManager(helmfilePath, "")
+				manager.Strict = strict
+				if err := manager.Load(); err != nil {
+					b.Fatalf("Load failed: %v", err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("Unchanged/strict=%t", strict), func(b *testing.B) {
+			manager := helmstate.NewManager(helmfilePath, "")
+			manager.Strict = strict
+			if err := manager.Load(); err != nil {
+				b.Fatalf("Load failed: %v", err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := manager.Load(); err != nil {
+					b.Fatalf("Load failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
 // BenchmarkSubstitutionManager benchmarks substitution operations
 func BenchmarkSubstitutionManager(b *testing.B) {
 	manager := substitute.NewManager()